@@ -0,0 +1,448 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// personalTokenPrefix marks personal access tokens so they can be told apart
+// from session access tokens and spotted by secret scanners.
+const personalTokenPrefix = "ocp_"
+
+// Limits on personal access token lifetime, in days.
+const (
+	defaultTokenExpiryDays = 90
+	maxTokenExpiryDays     = 365
+)
+
+// tokenTouchInterval limits how often LastUsedAt is written back to disk, so
+// a busy script does not rewrite the token file on every request.
+const tokenTouchInterval = time.Minute
+
+// Scopes that grant a single action rather than a whole resource group.
+const (
+	scopeFunctionsInvoke = "functions:invoke"
+	scopePipelinesRun    = "pipelines:run"
+)
+
+// scopedGroups are the resource groups a personal access token may be scoped
+// to, as "<group>:read" or "<group>:write".  groupAccount is deliberately
+// absent: tokens cannot manage sessions, passwords or other tokens.
+var scopedGroups = []resourceGroup{
+	groupCompute,
+	groupStorage,
+	groupCICD,
+	groupInstance,
+	groupServiceLedger,
+	groupMetrics,
+	groupUsers,
+	groupWebhooks,
+	groupProjects,
+}
+
+// routeScopes lists narrow scopes that are accepted for individual routes in
+// addition to the scope of the route's resource group.
+var routeScopes = map[string]string{
+	"/invoke-function": scopeFunctionsInvoke,
+	"/run-pipeline/":   scopePipelinesRun,
+}
+
+// isValidScope reports whether scope is one a token may be created with.
+func isValidScope(scope string) bool {
+	if scope == scopeFunctionsInvoke || scope == scopePipelinesRun {
+		return true
+	}
+	for _, g := range scopedGroups {
+		if scope == string(g)+":read" || scope == string(g)+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// personalAccessToken is a stored personal access token.  Only the SHA-256
+// hash of the secret is kept; the token itself is shown once on creation.
+type personalAccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	TokenHash  string     `json:"tokenHash"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// allowsRoute reports whether the token's scopes cover path.  The owner's role
+// is checked separately, so a token never grants more than its user has.
+func (t *personalAccessToken) allowsRoute(path string) bool {
+	perm, ok := lookupRoutePermission(path)
+	if !ok {
+		return false
+	}
+
+	var routeScope string
+	for pattern, scope := range routeScopes {
+		if path == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern)) {
+			routeScope = scope
+		}
+	}
+
+	for _, scope := range t.Scopes {
+		switch scope {
+		case routeScope:
+			return true
+		case string(perm.Group) + ":write":
+			return true
+		case string(perm.Group) + ":read":
+			if perm.Access == accessRead {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accessTokenMutex serialises read-modify-write cycles on the token file.
+var accessTokenMutex sync.Mutex
+
+// accessTokensPath returns the path to the personal access token file.
+func accessTokensPath() (string, error) {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "user", "access_tokens.json"), nil
+}
+
+// readAccessTokens loads the token file keyed by token ID, returning an empty
+// map when it does not exist yet.
+func readAccessTokens() (map[string]personalAccessToken, error) {
+	path, err := accessTokensPath()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(map[string]personalAccessToken)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tokens, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("malformed access token file: %w", err)
+	}
+	return tokens, nil
+}
+
+// writeAccessTokens atomically replaces the token file.  Callers must hold
+// accessTokenMutex.
+func writeAccessTokens(tokens map[string]personalAccessToken) error {
+	path, err := accessTokensPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tokens, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// hashAccessToken returns the hex SHA-256 of a raw token.  Tokens carry 256
+// bits of randomness, so a fast hash is sufficient here.
+func hashAccessToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAccessToken stores a new token for username and returns the record
+// together with the raw token, which is not recoverable afterwards.
+func createAccessToken(username, name string, scopes []string, expiresAt, now time.Time) (*personalAccessToken, string, error) {
+	id, err := generateTokenID()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	raw := personalTokenPrefix + hex.EncodeToString(secret)
+
+	token := personalAccessToken{
+		ID:        id,
+		Name:      name,
+		Username:  username,
+		TokenHash: hashAccessToken(raw),
+		Hint:      raw[len(raw)-4:],
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	accessTokenMutex.Lock()
+	defer accessTokenMutex.Unlock()
+
+	tokens, err := readAccessTokens()
+	if err != nil {
+		return nil, "", err
+	}
+	tokens[id] = token
+	if err := writeAccessTokens(tokens); err != nil {
+		return nil, "", err
+	}
+	return &token, raw, nil
+}
+
+// findAccessToken returns the unexpired token matching raw, or nil.
+func findAccessToken(raw string) (*personalAccessToken, error) {
+	tokens, err := readAccessTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hashAccessToken(raw)
+	now := time.Now()
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t.TokenHash), []byte(hash)) == 1 {
+			if now.After(t.ExpiresAt) {
+				return nil, nil
+			}
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+// touchAccessToken records that the token was used, at most once per
+// tokenTouchInterval.
+func touchAccessToken(token *personalAccessToken, now time.Time) error {
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < tokenTouchInterval {
+		return nil
+	}
+
+	accessTokenMutex.Lock()
+	defer accessTokenMutex.Unlock()
+
+	tokens, err := readAccessTokens()
+	if err != nil {
+		return err
+	}
+	stored, ok := tokens[token.ID]
+	if !ok {
+		return nil
+	}
+	stored.LastUsedAt = &now
+	tokens[token.ID] = stored
+	return writeAccessTokens(tokens)
+}
+
+// deleteAccessTokens removes every token for which match returns true and
+// reports how many were removed.
+func deleteAccessTokens(match func(t personalAccessToken) bool) (int, error) {
+	accessTokenMutex.Lock()
+	defer accessTokenMutex.Unlock()
+
+	tokens, err := readAccessTokens()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for id, t := range tokens {
+		if match(t) {
+			delete(tokens, id)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, writeAccessTokens(tokens)
+}
+
+// bearerToken returns the credential from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// createAccessTokenRequest is the JSON body accepted by CreateAccessToken.
+type createAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays,omitempty"`
+}
+
+// accessTokenResponse is the public view of a personal access token.  Token
+// is only populated in the response to CreateAccessToken.
+type accessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+func newAccessTokenResponse(t *personalAccessToken) accessTokenResponse {
+	return accessTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Hint:       t.Hint,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
+
+// CreateAccessToken handles POST /user/create-token.
+//
+// Request body: {"name": "deploy", "scopes": ["functions:invoke"], "expiresInDays": 30}
+//
+// The raw token is returned once in the "token" field and cannot be retrieved
+// again.
+func CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	username, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	var req createAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		apierror.Respond(w, r, http.StatusBadRequest, "name must be 1-100 characters")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		apierror.Respond(w, r, http.StatusBadRequest, "at least one scope is required")
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !isValidScope(scope) {
+			apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("unknown scope %q", scope))
+			return
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultTokenExpiryDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxTokenExpiryDays {
+		apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("expiresInDays must be between 1 and %d", maxTokenExpiryDays))
+		return
+	}
+
+	now := time.Now()
+	token, raw, err := createAccessToken(username, req.Name, req.Scopes, now.AddDate(0, 0, req.ExpiresInDays), now)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+
+	resp := newAccessTokenResponse(token)
+	resp.Token = raw
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// ListAccessTokens handles GET /user/tokens.
+// It returns the caller's personal access tokens, newest first, without
+// their secrets.
+func ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	username, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	tokens, err := readAccessTokens()
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to read tokens")
+		return
+	}
+
+	resp := []accessTokenResponse{}
+	for _, t := range tokens {
+		if t.Username == username {
+			resp = append(resp, newAccessTokenResponse(&t))
+		}
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].CreatedAt.After(resp[j].CreatedAt) })
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RevokeAccessToken handles DELETE /user/tokens/{id}.
+// Callers may only revoke their own tokens.
+func RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	username, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	// URL format: /user/tokens/{id}
+	tokenID := strings.TrimPrefix(r.URL.Path, "/user/tokens/")
+	if tokenID == "" || strings.Contains(tokenID, "/") {
+		apierror.Respond(w, r, http.StatusBadRequest, "token id is required")
+		return
+	}
+
+	removed, err := deleteAccessTokens(func(t personalAccessToken) bool {
+		return t.ID == tokenID && t.Username == username
+	})
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to revoke token")
+		return
+	}
+	if removed == 0 {
+		apierror.Respond(w, r, http.StatusNotFound, "token not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "token revoked", "id": tokenID})
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createTokenForTest creates a personal access token through the API and
+// returns the create response.
+func createTokenForTest(t *testing.T, sessionToken string, req createAccessTokenRequest) accessTokenResponse {
+	t.Helper()
+
+	w := serveUserRequest(t, CreateAccessToken, http.MethodPost, "/user/create-token", sessionToken, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: expected %d, got %d — body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var resp accessTokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode token response: %v", err)
+	}
+	return resp
+}
+
+// serveWithBearer runs handler behind RequireAuth with an Authorization header.
+func serveWithBearer(handler http.HandlerFunc, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	RequireAuth(handler).ServeHTTP(w, req)
+	return w
+}
+
+// TestAccessTokenStoredHashed verifies that only a hash of the token is written to disk.
+func TestAccessTokenStoredHashed(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	login := loginForTest(t, "admin", "admin", "go-test")
+	resp := createTokenForTest(t, login.AccessToken, createAccessTokenRequest{
+		Name:   "deploy",
+		Scopes: []string{scopeFunctionsInvoke},
+	})
+	if !strings.HasPrefix(resp.Token, personalTokenPrefix) {
+		t.Fatalf("expected token with prefix %q, got %q", personalTokenPrefix, resp.Token)
+	}
+
+	path, _ := accessTokensPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read token file: %v", err)
+	}
+	if strings.Contains(string(data), resp.Token) {
+		t.Errorf("raw token must not be stored on disk")
+	}
+	if !strings.Contains(string(data), hashAccessToken(resp.Token)) {
+		t.Errorf("expected token hash to be stored on disk")
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected token file mode 0600, got %o", info.Mode().Perm())
+	}
+}
+
+// TestAccessTokenScopes verifies bearer authentication and scope enforcement.
+func TestAccessTokenScopes(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	login := loginForTest(t, "admin", "admin", "go-test")
+	invoke := createTokenForTest(t, login.AccessToken, createAccessTokenRequest{
+		Name:   "invoke-only",
+		Scopes: []string{scopeFunctionsInvoke},
+	})
+	storage := createTokenForTest(t, login.AccessToken, createAccessTokenRequest{
+		Name:   "storage-read",
+		Scopes: []string{"storage:read"},
+	})
+
+	tests := []struct {
+		token string
+		path  string
+		want  int
+	}{
+		{invoke.Token, "/invoke-function", http.StatusOK},
+		{invoke.Token, "/delete-function", http.StatusForbidden},
+		{invoke.Token, "/list-functions", http.StatusForbidden},
+		{storage.Token, "/list-blob-buckets", http.StatusOK},
+		{storage.Token, "/upload-object", http.StatusForbidden},
+		// Tokens can never manage the account, including other tokens.
+		{storage.Token, "/user/create-token", http.StatusForbidden},
+		{storage.Token, "/user/sessions", http.StatusForbidden},
+		{"ocp_not-a-real-token", "/list-blob-buckets", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := serveWithBearer(protectedEcho, http.MethodPost, tt.path, tt.token)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d — body: %s", tt.path, tt.want, w.Code, w.Body.String())
+		}
+		if tt.want == http.StatusOK && w.Body.String() != "admin" {
+			t.Errorf("%s: expected subject admin, got %q", tt.path, w.Body.String())
+		}
+	}
+}
+
+// TestAccessTokenLimitedByRole verifies that a token cannot exceed its owner's role.
+func TestAccessTokenLimitedByRole(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "val", "viewer-pass")
+	viewer := loginForTest(t, "val", "viewer-pass", "go-test")
+
+	token := createTokenForTest(t, viewer.AccessToken, createAccessTokenRequest{
+		Name:   "too-broad",
+		Scopes: []string{"compute:write"},
+	})
+
+	if w := serveWithBearer(protectedEcho, http.MethodGet, "/get-containers", token.Token); w.Code != http.StatusOK {
+		t.Errorf("read: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serveWithBearer(protectedEcho, http.MethodPost, "/delete-container", token.Token); w.Code != http.StatusForbidden {
+		t.Errorf("write: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+// TestAccessTokenExpiry verifies that expired tokens are rejected.
+func TestAccessTokenExpiry(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	now := time.Now()
+	_, raw, err := createAccessToken("admin", "old", []string{"compute:read"}, now.Add(-time.Minute), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("createAccessToken: %v", err)
+	}
+
+	if w := serveWithBearer(protectedEcho, http.MethodGet, "/get-containers", raw); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestCreateAccessTokenValidation verifies bad names, scopes and expiries are rejected.
+func TestCreateAccessTokenValidation(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	login := loginForTest(t, "admin", "admin", "go-test")
+	tests := []struct {
+		name string
+		req  createAccessTokenRequest
+	}{
+		{"missing name", createAccessTokenRequest{Scopes: []string{"compute:read"}}},
+		{"no scopes", createAccessTokenRequest{Name: "ci"}},
+		{"unknown scope", createAccessTokenRequest{Name: "ci", Scopes: []string{"everything"}}},
+		{"account scope", createAccessTokenRequest{Name: "ci", Scopes: []string{"account:write"}}},
+		{"too long", createAccessTokenRequest{Name: "ci", Scopes: []string{"compute:read"}, ExpiresInDays: maxTokenExpiryDays + 1}},
+	}
+	for _, tt := range tests {
+		w := serveUserRequest(t, CreateAccessToken, http.MethodPost, "/user/create-token", login.AccessToken, tt.req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", tt.name, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// TestListAndRevokeAccessTokens verifies listing shows last use and that a
+// revoked token stops working.
+func TestListAndRevokeAccessTokens(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	login := loginForTest(t, "admin", "admin", "go-test")
+	created := createTokenForTest(t, login.AccessToken, createAccessTokenRequest{
+		Name:   "ci",
+		Scopes: []string{"cicd:write"},
+	})
+
+	if w := serveWithBearer(protectedEcho, http.MethodPost, "/run-pipeline/build", created.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected token to work, got %d", w.Code)
+	}
+
+	w := serveAuthenticated(ListAccessTokens, http.MethodGet, "/user/tokens", login.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var tokens []accessTokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&tokens); err != nil {
+		t.Fatalf("failed to decode tokens: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != created.ID {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+	if tokens[0].Token != "" {
+		t.Errorf("list must not include the raw token")
+	}
+	if tokens[0].LastUsedAt == nil {
+		t.Errorf("expected lastUsedAt to be recorded")
+	}
+
+	w = serveAuthenticated(RevokeAccessToken, http.MethodDelete, "/user/tokens/"+created.ID, login.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := serveWithBearer(protectedEcho, http.MethodPost, "/run-pipeline/build", created.Token); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected revoked token to get %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = serveAuthenticated(RevokeAccessToken, http.MethodDelete, "/user/tokens/"+created.ID, login.AccessToken)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second revoke: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestBearerSessionToken verifies that session access tokens are also
+// accepted in the Authorization header.
+func TestBearerSessionToken(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	login := loginForTest(t, "admin", "admin", "go-test")
+	if w := serveWithBearer(protectedEcho, http.MethodGet, "/get-containers", login.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,256 @@
+// Package apierror defines the error envelope every OpenCloud handler
+// returns.  An error response is always JSON of the form
+//
+//	{"code": "not_found", "message": "...", "details": ..., "requestId": "..."}
+//
+// where code is a stable machine-readable value from the Code constants,
+// message is meant for people, details is optional structured context and
+// requestId echoes the X-Request-ID of the request.  Streaming endpoints
+// send the same envelope as the data of an "event: error" server-sent event.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Stable error codes.  Clients may switch on these, so existing values must
+// never change meaning.
+const (
+	CodeBadRequest             = "bad_request"
+	CodeUnauthorized           = "unauthorized"
+	CodeForbidden              = "forbidden"
+	CodePasswordChangeRequired = "password_change_required"
+	CodeNotFound               = "not_found"
+	CodeMethodNotAllowed       = "method_not_allowed"
+	CodeConflict               = "conflict"
+	CodePayloadTooLarge        = "payload_too_large"
+	CodeTooManyRequests        = "too_many_requests"
+	CodeInternal               = "internal"
+	CodeNotImplemented         = "not_implemented"
+	CodeUnavailable            = "unavailable"
+	CodeTimeout                = "timeout"
+	CodePodmanUnavailable      = "podman_unavailable"
+	CodePodmanError            = "podman_error"
+	CodeFilesystemError        = "filesystem_error"
+	CodeLedgerError            = "ledger_error"
+	CodeIdempotencyKeyInUse    = "idempotency_key_in_use"
+	CodeIdempotencyKeyReused   = "idempotency_key_reused"
+)
+
+// Error is an API error: an HTTP status plus the JSON envelope sent to the
+// client.  Err keeps the underlying cause for errors.Is/As and is never
+// serialised beyond what Message already says.
+type Error struct {
+	Status    int    `json:"-"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	Err       error  `json:"-"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns an Error for status with the code conventionally used for it.
+func New(status int, message string) *Error {
+	return &Error{Status: status, Code: CodeForStatus(status), Message: message}
+}
+
+// WithCode returns e with a more specific code than its status implies.
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// WithDetails attaches structured context, e.g. the offending field.
+func (e *Error) WithDetails(details any) *Error {
+	e.Details = details
+	return e
+}
+
+// CodeForStatus returns the generic code for an HTTP status.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusNotImplemented:
+		return CodeNotImplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// statusCoder is implemented by Podman binding errors, whose Code is the HTTP
+// status the Podman service answered with.
+type statusCoder interface {
+	Code() int
+}
+
+// FromError classifies err and returns the matching Error.  The message is
+// prefix followed by the error text, matching the "Failed to X: cause" style
+// handlers have always used, except for filesystem errors: their text names
+// server paths, so the message is prefix alone, or the status text without
+// one, and the cause is only kept in Err for logging.
+//
+//   - an *Error is returned as is
+//   - a deadline or cancelled context becomes 504 timeout
+//   - a failed network dial (e.g. to the Podman socket) becomes 503 unavailable
+//   - a Podman service error keeps its 400/404/409 status, anything else
+//     is 500 podman_error
+//   - a missing file becomes 404, an existing one 409, a permission problem
+//     or any other filesystem error 500 filesystem_error
+//   - anything else is 500 internal
+func FromError(err error, prefix string) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	message := err.Error()
+	if prefix != "" {
+		message = prefix + ": " + message
+	}
+	e := func(status int, code string) *Error {
+		return &Error{Status: status, Code: code, Message: message, Err: err}
+	}
+	fsErr := func(status int, code string) *Error {
+		message := prefix
+		if message == "" {
+			message = http.StatusText(status)
+		}
+		return &Error{Status: status, Code: code, Message: message, Err: err}
+	}
+
+	var opErr *net.OpError
+	var coder statusCoder
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return e(http.StatusGatewayTimeout, CodeTimeout)
+	case errors.As(err, &opErr):
+		return e(http.StatusServiceUnavailable, CodeUnavailable)
+	case errors.As(err, &coder):
+		switch status := coder.Code(); status {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict:
+			return e(status, CodeForStatus(status))
+		}
+		return e(http.StatusInternalServerError, CodePodmanError)
+	case errors.Is(err, fs.ErrNotExist):
+		return fsErr(http.StatusNotFound, CodeNotFound)
+	case errors.Is(err, fs.ErrExist):
+		return fsErr(http.StatusConflict, CodeConflict)
+	case errors.Is(err, fs.ErrPermission), errors.As(err, &pathErr), errors.As(err, new(*os.LinkError)):
+		return fsErr(http.StatusInternalServerError, CodeFilesystemError)
+	}
+	return e(http.StatusInternalServerError, CodeInternal)
+}
+
+// PodmanUnavailable reports that the Podman service could not be reached.
+func PodmanUnavailable(err error, prefix string) *Error {
+	return &Error{
+		Status:  http.StatusServiceUnavailable,
+		Code:    CodePodmanUnavailable,
+		Message: prefix + ": " + err.Error(),
+		Err:     err,
+	}
+}
+
+// Filesystem reports a failed file operation under the data directory.  The
+// cause is kept for logging but not echoed, as it would reveal server paths.
+func Filesystem(err error, message string) *Error {
+	return &Error{
+		Status:  http.StatusInternalServerError,
+		Code:    CodeFilesystemError,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// Ledger reports a failure to read or update the service ledger.
+func Ledger(err error, prefix string) *Error {
+	return &Error{
+		Status:  http.StatusInternalServerError,
+		Code:    CodeLedgerError,
+		Message: prefix + ": " + err.Error(),
+		Err:     err,
+	}
+}
+
+// Write sends e as the JSON error envelope, filling in the request ID.
+func Write(w http.ResponseWriter, r *http.Request, e *Error) {
+	body := *e
+	if r != nil {
+		body.RequestID = RequestID(r.Context())
+		logServerError(r, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(body.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Respond sends a JSON error with the code conventionally used for status.
+func Respond(w http.ResponseWriter, r *http.Request, status int, message string) {
+	Write(w, r, New(status, message))
+}
+
+// RespondError classifies err with FromError and sends it.
+func RespondError(w http.ResponseWriter, r *http.Request, err error, prefix string) {
+	Write(w, r, FromError(err, prefix))
+}
+
+// WriteEvent sends e as an "event: error" server-sent event for endpoints
+// that have already started streaming and can no longer change the status.
+func WriteEvent(w io.Writer, r *http.Request, e *Error) {
+	body := *e
+	if r != nil {
+		body.RequestID = RequestID(r.Context())
+		logServerError(r, e)
+	}
+	data, _ := json.Marshal(body)
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// logServerError logs a server-side failure with its underlying cause, which
+// the envelope only summarises.  Client errors and errors without a cause
+// are left to the handler.
+func logServerError(r *http.Request, e *Error) {
+	if e.Status < http.StatusInternalServerError || e.Err == nil {
+		return
+	}
+	slog.ErrorContext(r.Context(), e.Message, "method", r.Method, "path", r.URL.Path, "status", e.Status, "code", e.Code, "err", e.Err)
+}
@@ -0,0 +1,170 @@
+package apierror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/WavexSoftware/OpenCloud/logging"
+)
+
+// podmanError mimics the bindings' errorhandling.ErrorModel.
+type podmanError struct{ code int }
+
+func (e podmanError) Error() string { return "podman said no" }
+func (e podmanError) Code() int     { return e.code }
+
+func TestFromError(t *testing.T) {
+	_, statErr := os.Stat("/does/not/exist")
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"api error", New(http.StatusTeapot, "short and stout"), http.StatusTeapot, CodeBadRequest},
+		{"deadline", fmt.Errorf("pull: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, CodeTimeout},
+		{"socket dial", &net.OpError{Op: "dial", Net: "unix", Err: os.ErrNotExist}, http.StatusServiceUnavailable, CodeUnavailable},
+		{"podman not found", podmanError{http.StatusNotFound}, http.StatusNotFound, CodeNotFound},
+		{"podman conflict", fmt.Errorf("remove: %w", podmanError{http.StatusConflict}), http.StatusConflict, CodeConflict},
+		{"podman failure", podmanError{http.StatusInternalServerError}, http.StatusInternalServerError, CodePodmanError},
+		{"missing file", statErr, http.StatusNotFound, CodeNotFound},
+		{"existing file", &fs.PathError{Op: "mkdir", Path: "x", Err: fs.ErrExist}, http.StatusConflict, CodeConflict},
+		{"permission", &fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}, http.StatusInternalServerError, CodeFilesystemError},
+		{"other", errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := FromError(tt.err, "Failed to do it")
+			if e.Status != tt.wantStatus || e.Code != tt.wantCode {
+				t.Errorf("got %d %s, want %d %s", e.Status, e.Code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+
+	if e := FromError(errors.New("boom"), "Failed to do it"); e.Message != "Failed to do it: boom" {
+		t.Errorf("message = %q", e.Message)
+	}
+
+	// Filesystem errors name server paths; only the prefix is sent.
+	linkErr := &os.LinkError{Op: "rename", Old: "/srv/opencloud/a", New: "/srv/opencloud/b", Err: fs.ErrPermission}
+	for _, err := range []error{statErr, fmt.Errorf("load: %w", statErr), linkErr} {
+		e := FromError(err, "Failed to do it")
+		if e.Message != "Failed to do it" || !errors.Is(e.Err, err) {
+			t.Errorf("FromError(%v) message = %q, err = %v", err, e.Message, e.Err)
+		}
+	}
+	if e := FromError(statErr, ""); e.Message != http.StatusText(http.StatusNotFound) {
+		t.Errorf("message without prefix = %q", e.Message)
+	}
+}
+
+func TestWriteIncludesRequestID(t *testing.T) {
+	h := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, New(http.StatusNotFound, "no such bucket").WithDetails(map[string]string{"bucket": "photos"}))
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var body struct {
+		Code      string            `json:"code"`
+		Message   string            `json:"message"`
+		Details   map[string]string `json:"details"`
+		RequestID string            `json:"requestId"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != CodeNotFound || body.Message != "no such bucket" || body.Details["bucket"] != "photos" {
+		t.Errorf("body = %+v", body)
+	}
+	if body.RequestID == "" || body.RequestID != w.Header().Get(RequestIDHeader) {
+		t.Errorf("requestId = %q, header = %q", body.RequestID, w.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestWithRequestIDReusesClientID(t *testing.T) {
+	var seen string
+	h := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+	for id, reuse := range map[string]bool{"abc-123": true, "bad id\r\n": false, strings.Repeat("a", 129): false} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, id)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if (seen == id) != reuse || seen == "" {
+			t.Errorf("client ID %q: got %q, reuse %v", id, seen, reuse)
+		}
+	}
+}
+
+func TestWriteLogsServerErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.NewLogger(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	h := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			Respond(w, r, http.StatusNotFound, "no such bucket")
+			return
+		}
+		Write(w, r, Filesystem(fs.ErrPermission, "Failed to create bucket"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if buf.Len() != 0 {
+		t.Errorf("client error was logged: %s", buf.String())
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/create-bucket", nil))
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log output %q: %v", buf.String(), err)
+	}
+	if line["request_id"] != w.Header().Get(RequestIDHeader) || line["msg"] != "Failed to create bucket" || line["err"] != fs.ErrPermission.Error() {
+		t.Errorf("logged %v", line)
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteEvent(w, nil, FromError(podmanError{http.StatusNotFound}, "Failed to pull image"))
+
+	sc := bufio.NewScanner(w.Body)
+	var lines []string
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if len(lines) < 2 || lines[0] != "event: error" || !strings.HasPrefix(lines[1], "data: ") {
+		t.Fatalf("event = %q", w.Body.String())
+	}
+	var body Error
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != CodeNotFound || body.Message != "Failed to pull image: podman said no" {
+		t.Errorf("body = %+v", body)
+	}
+}
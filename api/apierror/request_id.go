@@ -0,0 +1,55 @@
+package apierror
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/WavexSoftware/OpenCloud/logging"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// WithRequestID gives every request an ID, reusing a well-formed one sent by
+// the client or a proxy, and echoes it in the X-Request-ID response header so
+// an error envelope can be matched to server logs.  Lines logged with the
+// request's context carry the ID too.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// RequestID returns the ID WithRequestID assigned, or "" outside of it.
+func RequestID(ctx context.Context) string {
+	return logging.RequestID(ctx)
+}
+
+// validRequestID accepts short IDs of URL-safe characters, so a client cannot
+// inject arbitrary text into logs or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,458 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// Audit outcomes.  A request is "denied" when authentication or authorisation
+// rejected it and "failure" when the handler answered with any other error.
+const (
+	auditSuccess = "success"
+	auditFailure = "failure"
+	auditDenied  = "denied"
+)
+
+// Limits on the number of records GetAuditLog returns.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// maxAuditBodyBytes bounds the JSON body Audit inspects for the target of a
+// request; larger bodies are passed on untouched and recorded without one.
+const maxAuditBodyBytes = 1 << 20
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Resource   string    `json:"resource"`
+	Target     string    `json:"target,omitempty"`
+	Project    string    `json:"project,omitempty"`
+	Status     int       `json:"status"`
+	Outcome    string    `json:"outcome"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+}
+
+// auditTarget describes the resource a mutating route acts on.
+type auditTarget struct {
+	// resource is the resource type recorded, e.g. "bucket".
+	resource string
+	// fields are query parameters or JSON body fields naming the target;
+	// the values found are joined with "/".  Prefix routes instead take the
+	// first path segment after the prefix.
+	fields []string
+}
+
+// auditRoutes lists every mutating route, keyed like routePermissions.
+// TestEveryWriteRouteIsAudited keeps it in step with that table.
+var auditRoutes = map[string]auditTarget{
+	// Own account
+	"/user/logout":          {resource: "session"},
+	"/user/sessions/":       {resource: "session"},
+	"/user/change-password": {resource: "user", fields: []string{"username"}},
+	"/user/create-token":    {resource: "access_token", fields: []string{"name"}},
+	"/user/tokens/":         {resource: "access_token"},
+	"/user/totp/enroll":     {resource: "totp"},
+	"/user/totp/confirm":    {resource: "totp"},
+	"/user/totp/disable":    {resource: "totp", fields: []string{"username"}},
+
+	// User management
+	"/user/create-user":        {resource: "user", fields: []string{"username"}},
+	"/user/disable-user":       {resource: "user", fields: []string{"username"}},
+	"/user/delete-user":        {resource: "user", fields: []string{"username"}},
+	"/user/set-role":           {resource: "user", fields: []string{"username"}},
+	"/user/unlock-user":        {resource: "user", fields: []string{"username"}},
+	"/user/link-oidc":          {resource: "user", fields: []string{"username"}},
+	"/user/rotate-signing-key": {resource: "signing_key"},
+
+	// Compute
+	"/containers/":         {resource: "container"},
+	"/delete-container":    {resource: "container", fields: []string{"containerId"}},
+	"/pull-and-run":        {resource: "container", fields: []string{"name", "image"}},
+	"/pull-and-run-stream": {resource: "container", fields: []string{"name", "image"}},
+	"/update-container":    {resource: "container", fields: []string{"containerId"}},
+	"/invoke-function":     {resource: "function", fields: []string{"name"}},
+	"/create-function":     {resource: "function", fields: []string{"name"}},
+	"/delete-function":     {resource: "function", fields: []string{"name"}},
+	"/update-function/":    {resource: "function"},
+
+	// Storage
+	"/create-bucket":      {resource: "bucket", fields: []string{"name"}},
+	"/upload-object":      {resource: "object", fields: []string{"bucket"}},
+	"/delete-object":      {resource: "object", fields: []string{"bucket", "name"}},
+	"/delete-bucket":      {resource: "bucket", fields: []string{"name"}},
+	"/rename-bucket":      {resource: "bucket", fields: []string{"currentName"}},
+	"/build-image":        {resource: "image", fields: []string{"imageName"}},
+	"/build-image-stream": {resource: "image", fields: []string{"imageName"}},
+	"/delete-image":       {resource: "image", fields: []string{"imageName"}},
+	"/pull-image":         {resource: "image", fields: []string{"imageName"}},
+	"/pull-image-stream":  {resource: "image", fields: []string{"imageName"}},
+
+	// CI/CD
+	"/create-pipeline":  {resource: "pipeline", fields: []string{"name"}},
+	"/update-pipeline/": {resource: "pipeline"},
+	"/delete-pipeline/": {resource: "pipeline"},
+	"/run-pipeline/":    {resource: "pipeline"},
+	"/stop-pipeline/":   {resource: "pipeline"},
+
+	// Service ledger
+	"/enable-service":        {resource: "service", fields: []string{"service"}},
+	"/enable-service-stream": {resource: "service", fields: []string{"service"}},
+	"/sync-pipelines":        {resource: "service"},
+	"/sync-functions":        {resource: "service"},
+
+	// Instance settings
+	"/set-instance-domain": {resource: "instance", fields: []string{"domain"}},
+	"/configure-ssl":       {resource: "instance", fields: []string{"domain"}},
+
+	// Webhooks
+	"/create-webhook":  {resource: "webhook", fields: []string{"url"}},
+	"/update-webhook/": {resource: "webhook"},
+	"/delete-webhook/": {resource: "webhook"},
+
+	// Projects
+	"/create-project":         {resource: "project", fields: []string{"name"}},
+	"/delete-project/":        {resource: "project"},
+	"/set-project-member/":    {resource: "project"},
+	"/remove-project-member/": {resource: "project"},
+}
+
+// lookupAuditTarget returns the audit entry for path and, for prefix routes,
+// the path segment naming the target.  Matching follows lookupRoutePermission.
+func lookupAuditTarget(path string) (auditTarget, string, bool) {
+	if target, ok := auditRoutes[path]; ok {
+		return target, "", true
+	}
+	var best string
+	for pattern := range auditRoutes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return auditTarget{}, "", false
+	}
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, best), "/")
+	return auditRoutes[best], segment, true
+}
+
+// auditRecordKey is the context key under which Audit stores the record of
+// the request, so RequireAuth can fill in the user once it is known.
+const auditRecordKey authContextKey = "auditRecord"
+
+// setAuditUser records the authenticated user on the request's audit record,
+// if it has one.
+func setAuditUser(r *http.Request, username string) {
+	if rec, ok := r.Context().Value(auditRecordKey).(*auditRecord); ok {
+		rec.User = username
+	}
+}
+
+// Audit wraps next, the mux behind RequireAuth, and appends a record
+// to the audit log for every request to a route in auditRoutes that is not a
+// GET, HEAD or OPTIONS request.  It sits outside RequireAuth so rejected
+// attempts are recorded too.
+func Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, segment, ok := lookupAuditTarget(r.URL.Path)
+		if !ok || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &auditRecord{
+			Method:     r.Method,
+			Route:      r.URL.Path,
+			Resource:   target.resource,
+			Target:     segment,
+			RemoteAddr: clientAddr(r),
+			RequestID:  apierror.RequestID(r.Context()),
+		}
+		if rec.Target == "" && len(target.fields) > 0 {
+			rec.Target = auditTargetValue(r, target.fields)
+		}
+		if isProjectRoute(r.URL.Path) {
+			rec.Project = requestedProject(r)
+		}
+
+		aw := &statusResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), auditRecordKey, rec)))
+
+		rec.Time = time.Now().UTC()
+		rec.Status = aw.status
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		switch {
+		case rec.Status == http.StatusUnauthorized, rec.Status == http.StatusForbidden:
+			rec.Outcome = auditDenied
+		case rec.Status >= 400, aw.streamFailed:
+			rec.Outcome = auditFailure
+		default:
+			rec.Outcome = auditSuccess
+		}
+		if err := appendAuditRecord(*rec); err != nil {
+			slog.WarnContext(r.Context(), "failed to write audit record", "method", rec.Method, "route", rec.Route, "err", err)
+		}
+	})
+}
+
+// auditTargetValue reads fields from the query string, then from a JSON body,
+// restoring the body for the handler.
+func auditTargetValue(r *http.Request, fields []string) string {
+	values := make([]string, 0, len(fields))
+	query := r.URL.Query()
+	for _, f := range fields {
+		if v := query.Get(f); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 && r.Body != nil && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBodyBytes+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+
+		var body map[string]any
+		if err == nil && len(data) <= maxAuditBodyBytes && json.Unmarshal(data, &body) == nil {
+			for _, f := range fields {
+				if v, ok := body[f].(string); ok && v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+	}
+	return strings.Join(values, "/")
+}
+
+// statusResponseWriter captures the status of a response.  Streaming handlers
+// always answer 200, so an "error" event marks the request as failed.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status       int
+	streamFailed bool
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if bytes.HasPrefix(p, []byte("event: error\n")) {
+		w.streamFailed = true
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush keeps server-sent events working through the wrapper.
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// auditMutex serialises appends to the audit log.
+var auditMutex sync.Mutex
+
+// auditDir returns the directory holding the audit log, one JSON-lines file
+// per UTC day named audit-YYYY-MM-DD.jsonl.
+func auditDir() (string, error) {
+	logsDir, err := utils.SubsystemDir(utils.Logs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(logsDir, "audit"), nil
+}
+
+// auditFileName returns the name of the file holding records from day t.
+func auditFileName(t time.Time) string {
+	return "audit-" + t.UTC().Format(time.DateOnly) + ".jsonl"
+}
+
+// appendAuditRecord appends rec to the file for its day.  Files are only ever
+// opened for appending.
+func appendAuditRecord(rec auditRecord) error {
+	dir, err := auditDir()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, auditFileName(rec.Time)), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// auditQuery filters the audit log.  Zero fields match everything.
+type auditQuery struct {
+	User     string
+	Resource string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+func (q auditQuery) matches(rec auditRecord) bool {
+	return (q.User == "" || rec.User == q.User) &&
+		(q.Resource == "" || rec.Resource == q.Resource) &&
+		(q.Since.IsZero() || !rec.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || rec.Time.Before(q.Until))
+}
+
+// queryAuditLog returns up to q.Limit records matching q, newest first.  Only
+// the daily files overlapping the time range are read.
+func queryAuditLog(q auditQuery) ([]auditRecord, error) {
+	dir, err := auditDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []auditRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, "audit-") || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		if (!q.Since.IsZero() && name < auditFileName(q.Since)) || (!q.Until.IsZero() && name > auditFileName(q.Until)) {
+			continue
+		}
+		files = append(files, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	records := []auditRecord{}
+	for _, name := range files {
+		day, err := readAuditFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		for i := len(day) - 1; i >= 0; i-- {
+			if q.matches(day[i]) {
+				records = append(records, day[i])
+				if len(records) == q.Limit {
+					return records, nil
+				}
+			}
+		}
+	}
+	return records, nil
+}
+
+// readAuditFile reads one day of records, skipping lines that do not parse,
+// such as one cut short by a crash.
+func readAuditFile(path string) ([]auditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var rec auditRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// GetAuditLog handles GET /get-audit-log.
+// It returns audit records newest first.  All query parameters are optional:
+//
+//	user      only records of this user
+//	resource  only records of this resource type, e.g. "bucket"
+//	since     RFC 3339 time; only records at or after it
+//	until     RFC 3339 time; only records before it
+//	limit     maximum number of records (default 100, at most 1000)
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	q := auditQuery{
+		User:     params.Get("user"),
+		Resource: params.Get("resource"),
+		Limit:    defaultAuditLimit,
+	}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				apierror.Respond(w, r, http.StatusBadRequest, name+" must be an RFC 3339 time")
+				return
+			}
+			*dst = t
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit))
+			return
+		}
+		q.Limit = n
+	}
+
+	records, err := queryAuditLog(q)
+	if err != nil {
+		apierror.Write(w, r, apierror.Filesystem(err, "failed to read audit log"))
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveAudited sends a request through Audit and RequireAuth to handler.
+func serveAudited(handler http.HandlerFunc, method, target, accessToken, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		req.Header.Set("AccessToken", accessToken)
+	}
+	w := httptest.NewRecorder()
+	Audit(RequireAuth(handler)).ServeHTTP(w, req)
+	return w
+}
+
+// readAuditLog returns every audit record, oldest first.
+func readAuditLog(t *testing.T) []auditRecord {
+	t.Helper()
+	records, err := queryAuditLog(auditQuery{Limit: maxAuditLimit})
+	if err != nil {
+		t.Fatalf("queryAuditLog: %v", err)
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records
+}
+
+// TestAuditRecordsMutatingRequests verifies user, target and outcome are
+// recorded, and that the handler still sees the full request body.
+func TestAuditRecordsMutatingRequests(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+	token := loginForTest(t, "admin", "admin", "go-test").AccessToken
+
+	var gotBody string
+	echoBody := func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		gotBody = string(data)
+	}
+	fail := func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}
+	streamError := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: error\ndata: {}\n\n"))
+	}
+
+	serveAudited(echoBody, http.MethodPost, "/create-bucket", token, `{"name":"photos"}`)
+	if gotBody != `{"name":"photos"}` {
+		t.Errorf("handler saw body %q", gotBody)
+	}
+	serveAudited(fail, http.MethodPost, "/delete-pipeline/p-1", token, "")
+	serveAudited(echoBody, http.MethodPost, "/delete-object", "", `{"bucket":"photos","name":"cat.png"}`)
+	serveAudited(streamError, http.MethodPost, "/pull-image-stream", token, `{"imageName":"nginx"}`)
+	serveAudited(echoBody, http.MethodGet, "/get-containers", token, "")
+	serveAudited(echoBody, http.MethodPost, "/invoke-function?name=hello.py", token, `{}`)
+
+	want := []auditRecord{
+		{User: "admin", Route: "/create-bucket", Resource: "bucket", Target: "photos", Status: http.StatusOK, Outcome: auditSuccess},
+		{User: "admin", Route: "/delete-pipeline/p-1", Resource: "pipeline", Target: "p-1", Status: http.StatusNotFound, Outcome: auditFailure},
+		{User: "", Route: "/delete-object", Resource: "object", Target: "photos/cat.png", Status: http.StatusUnauthorized, Outcome: auditDenied},
+		{User: "admin", Route: "/pull-image-stream", Resource: "image", Target: "nginx", Status: http.StatusOK, Outcome: auditFailure},
+		{User: "admin", Route: "/invoke-function", Resource: "function", Target: "hello.py", Status: http.StatusOK, Outcome: auditSuccess},
+	}
+	got := readAuditLog(t)
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.User != w.User || g.Route != w.Route || g.Resource != w.Resource || g.Target != w.Target || g.Status != w.Status || g.Outcome != w.Outcome {
+			t.Errorf("record %d = %+v, want %+v", i, g, w)
+		}
+		if g.Method != http.MethodPost || g.Time.IsZero() {
+			t.Errorf("record %d has method %q time %v", i, g.Method, g.Time)
+		}
+	}
+}
+
+// TestGetAuditLogFilters verifies the query endpoint's filters and limit.
+func TestGetAuditLogFilters(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+	token := loginForTest(t, "admin", "admin", "go-test").AccessToken
+
+	now := time.Now().UTC()
+	for _, rec := range []auditRecord{
+		{Time: now.Add(-48 * time.Hour), User: "alice", Method: "POST", Route: "/create-bucket", Resource: "bucket", Outcome: auditSuccess},
+		{Time: now.Add(-time.Hour), User: "alice", Method: "POST", Route: "/delete-image", Resource: "image", Outcome: auditSuccess},
+		{Time: now.Add(-time.Minute), User: "bob", Method: "POST", Route: "/delete-bucket", Resource: "bucket", Outcome: auditFailure},
+	} {
+		if err := appendAuditRecord(rec); err != nil {
+			t.Fatalf("appendAuditRecord: %v", err)
+		}
+	}
+
+	tests := []struct {
+		query  string
+		want   []string
+		status int
+	}{
+		{query: "", want: []string{"/delete-bucket", "/delete-image", "/create-bucket"}},
+		{query: "user=alice", want: []string{"/delete-image", "/create-bucket"}},
+		{query: "resource=bucket", want: []string{"/delete-bucket", "/create-bucket"}},
+		{query: "since=" + url.QueryEscape(now.Add(-2*time.Hour).Format(time.RFC3339)), want: []string{"/delete-bucket", "/delete-image"}},
+		{query: "until=" + url.QueryEscape(now.Add(-24*time.Hour).Format(time.RFC3339)), want: []string{"/create-bucket"}},
+		{query: "limit=1", want: []string{"/delete-bucket"}},
+		{query: "since=yesterday", status: http.StatusBadRequest},
+		{query: "limit=0", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serveAuthenticated(GetAuditLog, http.MethodGet, "/get-audit-log?"+tt.query, token)
+			want := tt.status
+			if want == 0 {
+				want = http.StatusOK
+			}
+			if w.Code != want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, want, w.Body.String())
+			}
+			if want != http.StatusOK {
+				return
+			}
+			var records []auditRecord
+			if err := json.NewDecoder(w.Body).Decode(&records); err != nil {
+				t.Fatal(err)
+			}
+			var routes []string
+			for _, rec := range records {
+				routes = append(routes, rec.Route)
+			}
+			if strings.Join(routes, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("routes = %v, want %v", routes, tt.want)
+			}
+		})
+	}
+}
+
+// TestEveryWriteRouteIsAudited keeps auditRoutes in step with the write
+// routes in routePermissions.
+func TestEveryWriteRouteIsAudited(t *testing.T) {
+	for path, perm := range routePermissions {
+		_, audited := auditRoutes[path]
+		if perm.Access == accessWrite && !audited {
+			t.Errorf("write route %s is missing from auditRoutes", path)
+		}
+		if perm.Access == accessRead && audited {
+			t.Errorf("read route %s should not be in auditRoutes", path)
+		}
+	}
+	for path := range auditRoutes {
+		if _, ok := routePermissions[path]; !ok {
+			t.Errorf("audited route %s is not in routePermissions", path)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"bufio"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -9,14 +8,16 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/utils"
 )
 
 // tokenClaims holds the data encoded inside an auth token.
@@ -25,63 +26,20 @@ type tokenClaims struct {
 	ExpiresAt int64  `json:"exp"`
 	IssuedAt  int64  `json:"iat"`
 	TokenID   string `json:"jti"`
-	TokenType string `json:"type"` // "access" or "refresh"
-}
-
-// userSession tracks the refresh token issued to a user.
-type userSession struct {
-	refreshToken  string
-	refreshExpiry time.Time
+	TokenType string `json:"type"`          // "access" or "refresh"
+	SessionID string `json:"sid,omitempty"` // login session the token belongs to
+	KeyID     string `json:"kid,omitempty"` // signing key; empty for pre-rotation tokens
 }
 
-// sessionStore holds active user sessions keyed by username.
-var sessionStore = struct {
-	sync.RWMutex
-	data map[string]*userSession
-}{data: make(map[string]*userSession)}
-
-// tokenSecret is the HMAC signing secret loaded once at startup.
-var (
-	tokenSecret     []byte
-	tokenSecretOnce sync.Once
-)
-
-// loadTokenSecret reads (or creates) the HMAC secret stored at
-// ~/.opencloud/user/secret.  The function panics only on unrecoverable
-// errors because a missing secret would silently break all auth.
-func loadTokenSecret() {
-	tokenSecretOnce.Do(func() {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			panic(fmt.Sprintf("auth: cannot determine home directory: %v", err))
-		}
-		secretPath := filepath.Join(home, ".opencloud", "user", "secret")
-
-		data, err := os.ReadFile(secretPath)
-		if err == nil && len(data) >= 64 {
-			tokenSecret = data
-			return
-		}
-
-		// Generate a new 64-byte random secret.
-		secret := make([]byte, 64)
-		if _, err := rand.Read(secret); err != nil {
-			panic(fmt.Sprintf("auth: cannot generate token secret: %v", err))
-		}
-		encoded := make([]byte, hex.EncodedLen(len(secret)))
-		hex.Encode(encoded, secret)
-
-		if err := os.WriteFile(secretPath, encoded, 0600); err != nil {
-			panic(fmt.Sprintf("auth: cannot write token secret: %v", err))
-		}
-		tokenSecret = encoded
-	})
-}
-
-// makeToken creates a signed token containing the given claims.
+// makeToken creates a token containing the given claims, signed with the
+// active signing key whose ID is recorded in the kid claim.
 // Format: base64url(json(claims)) + "." + hex(HMAC-SHA256(payload, secret))
 func makeToken(claims tokenClaims) (string, error) {
-	loadTokenSecret()
+	kid, secret, err := activeSigningKey()
+	if err != nil {
+		return "", err
+	}
+	claims.KeyID = kid
 
 	payload, err := json.Marshal(claims)
 	if err != nil {
@@ -89,7 +47,7 @@ func makeToken(claims tokenClaims) (string, error) {
 	}
 	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
 
-	mac := hmac.New(sha256.New, tokenSecret)
+	mac := hmac.New(sha256.New, secret)
 	mac.Write([]byte(encodedPayload))
 	sig := hex.EncodeToString(mac.Sum(nil))
 
@@ -100,21 +58,13 @@ func makeToken(claims tokenClaims) (string, error) {
 // When allowExpired is true, the expiry check is skipped (used during token
 // refresh to identify the caller even when the access token has expired).
 func parseToken(token string, allowExpired bool) (*tokenClaims, error) {
-	loadTokenSecret()
-
 	parts := strings.SplitN(token, ".", 2)
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("malformed token")
 	}
 
-	// Verify HMAC signature.
-	mac := hmac.New(sha256.New, tokenSecret)
-	mac.Write([]byte(parts[0]))
-	expectedSig := hex.EncodeToString(mac.Sum(nil))
-	if !hmac.Equal([]byte(expectedSig), []byte(parts[1])) {
-		return nil, fmt.Errorf("invalid token signature")
-	}
-
+	// The payload has to be decoded first to find the signing key, but none
+	// of its claims are trusted until the signature has been checked.
 	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
 	if err != nil {
 		return nil, fmt.Errorf("malformed token payload")
@@ -125,6 +75,18 @@ func parseToken(token string, allowExpired bool) (*tokenClaims, error) {
 		return nil, fmt.Errorf("malformed token claims")
 	}
 
+	// Verify HMAC signature.
+	secret, err := verificationKey(claims.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0]))
+	expectedSig := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expectedSig), []byte(parts[1])) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
 	if !allowExpired && time.Now().Unix() > claims.ExpiresAt {
 		return nil, fmt.Errorf("token expired")
 	}
@@ -141,101 +103,93 @@ func generateTokenID() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-// issueTokenPair creates a new access/refresh token pair for the given user.
-func issueTokenPair(username string) (accessToken, refreshToken string, err error) {
+// issueTokenPair creates a new login session for the given user and returns
+// an access/refresh token pair bound to it.  userAgent and remoteAddr are
+// recorded on the session so users can tell their devices apart.
+func issueTokenPair(username, userAgent, remoteAddr string) (accessToken, refreshToken string, err error) {
 	now := time.Now()
 
-	accessJTI, err := generateTokenID()
+	refreshJTI, err := generateTokenID()
 	if err != nil {
 		return "", "", err
 	}
-	accessToken, err = makeToken(tokenClaims{
-		Subject:   username,
-		IssuedAt:  now.Unix(),
-		ExpiresAt: now.Add(1 * time.Hour).Unix(),
-		TokenID:   accessJTI,
-		TokenType: "access",
-	})
+
+	// Persist the session first so its ID can be embedded in both tokens.
+	session, err := createSession(username, refreshJTI, userAgent, remoteAddr, now)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshJTI, err := generateTokenID()
+	accessToken, err = issueAccessToken(username, session.ID, now)
 	if err != nil {
 		return "", "", err
 	}
-	refreshExpiry := now.Add(7 * 24 * time.Hour)
+
 	refreshToken, err = makeToken(tokenClaims{
 		Subject:   username,
 		IssuedAt:  now.Unix(),
-		ExpiresAt: refreshExpiry.Unix(),
+		ExpiresAt: session.ExpiresAt.Unix(),
 		TokenID:   refreshJTI,
 		TokenType: "refresh",
+		SessionID: session.ID,
 	})
 	if err != nil {
 		return "", "", err
 	}
 
-	// Store the refresh token so RefreshAuth can validate it.
-	sessionStore.Lock()
-	sessionStore.data[username] = &userSession{
-		refreshToken:  refreshToken,
-		refreshExpiry: refreshExpiry,
-	}
-	sessionStore.Unlock()
-
 	return accessToken, refreshToken, nil
 }
 
+// issueAccessToken creates a short-lived access token for the given session.
+func issueAccessToken(username, sessionID string, now time.Time) (string, error) {
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", err
+	}
+	return makeToken(tokenClaims{
+		Subject:   username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(1 * time.Hour).Unix(),
+		TokenID:   jti,
+		TokenType: "access",
+		SessionID: sessionID,
+	})
+}
+
 // credentialsPath returns the path to the credentials file.
 func credentialsPath() (string, error) {
-	home, err := os.UserHomeDir()
+	dataDir, err := utils.DataDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".opencloud", "user", "credentials"), nil
+	return filepath.Join(dataDir, "user", "credentials"), nil
 }
 
-// verifyCredentials checks username/password against the credentials file.
+// verifyCredentials checks username/password against the credentials file
+// and returns the matching account, or nil when the credentials are wrong or
+// the account is disabled.
 //
 // File format (~/.opencloud/user/credentials):
 //
 //	# Lines starting with '#' are comments and are ignored.
 //	# Blank lines are also ignored.
 //	# Each non-blank, non-comment line must have the form:
-//	#   username:bcrypt_hash
-//	admin:$2a$10$...
-func verifyCredentials(username, password string) (bool, error) {
-	path, err := credentialsPath()
-	if err != nil {
-		return false, err
+//	#   username:bcrypt_hash[:flag,flag...]
+//	# where the optional flags are "disabled", "must_change_password" and
+//	# "role=<admin|developer|viewer>".
+//	admin:$2a$10$...:must_change_password,role=admin
+func verifyCredentials(username, password string) (*userRecord, error) {
+	user, err := lookupUser(username)
+	if err != nil || user == nil {
+		return nil, err
 	}
-
-	f, err := os.Open(path)
-	if err != nil {
-		return false, fmt.Errorf("cannot open credentials file: %w", err)
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, nil
 	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		storedUser := parts[0]
-		storedHash := parts[1]
-
-		if storedUser == username {
-			err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password))
-			return err == nil, nil
-		}
+	if user.Disabled {
+		return nil, nil
 	}
-	return false, scanner.Err()
+	return user, nil
 }
 
 // loginRequest is the JSON body accepted by the Login handler.
@@ -246,13 +200,17 @@ type loginRequest struct {
 
 // loginResponse is the JSON body returned by the Login handler on success.
 type loginResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken        string `json:"access_token"`
+	RefreshToken       string `json:"refresh_token"`
+	MustChangePassword bool   `json:"must_change_password,omitempty"`
 }
 
-// errorResponse is a generic JSON error body.
-type errorResponse struct {
-	Message string `json:"message"`
+// mfaChallengeResponse is returned by Login instead of tokens when the user
+// has two-factor authentication enabled.  The challenge token is exchanged
+// for a token pair through VerifyLogin.
+type mfaChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -263,59 +221,102 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 
 // Login handles POST /user/login.
 // It validates the provided credentials and, on success, returns a new
-// access/refresh token pair.
+// access/refresh token pair.  Repeated failures for a username or client
+// address lock further attempts out for a while (see loginThrottlePolicy);
+// locked requests get 429 with a Retry-After header.  Users with two-factor
+// authentication receive an mfaChallengeResponse instead of tokens and finish
+// logging in through VerifyLogin.
 func Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Message: "method not allowed"})
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, errorResponse{Message: "invalid request body"})
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	if req.Username == "" || req.Password == "" {
-		writeJSON(w, http.StatusBadRequest, errorResponse{Message: "username and password are required"})
+		apierror.Respond(w, r, http.StatusBadRequest, "username and password are required")
 		return
 	}
 
-	ok, err := verifyCredentials(req.Username, req.Password)
+	// Refuse to even check the password while the account or the client
+	// address is locked out, so bcrypt is not an oracle during a lockout.
+	// Otherwise the attempt counts as a failure until the password is found
+	// to be correct.
+	now := time.Now()
+	client := clientAddr(r)
+	wait, err := reserveLoginAttempt(req.Username, client, now)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, errorResponse{Message: "authentication service unavailable"})
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
 		return
 	}
-	if !ok {
-		writeJSON(w, http.StatusUnauthorized, errorResponse{Message: "invalid username or password"})
+	if wait > 0 {
+		writeTooManyAttempts(w, r, wait)
 		return
 	}
 
-	accessToken, refreshToken, err := issueTokenPair(req.Username)
+	user, err := verifyCredentials(req.Username, req.Password)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, errorResponse{Message: "failed to issue tokens"})
+		releaseLoginAttemptOrWarn(r, req.Username, client, false)
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return
+	}
+	if user == nil {
+		apierror.Respond(w, r, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	// Users with two-factor authentication only get a challenge here; the
+	// earlier failures are left alone until the second factor succeeds.
+	enrollment, err := getTOTPEnrollment(req.Username)
+	if err != nil {
+		releaseLoginAttemptOrWarn(r, req.Username, client, false)
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return
+	}
+	if enrollment != nil && enrollment.Confirmed {
+		releaseLoginAttemptOrWarn(r, req.Username, client, false)
+		challenge, err := issueMFAChallenge(req.Username, now)
+		if err != nil {
+			apierror.Respond(w, r, http.StatusInternalServerError, "failed to issue tokens")
+			return
+		}
+		writeJSON(w, http.StatusOK, mfaChallengeResponse{MFARequired: true, ChallengeToken: challenge})
+		return
+	}
+
+	releaseLoginAttemptOrWarn(r, req.Username, client, true)
+
+	accessToken, refreshToken, err := issueTokenPair(req.Username, r.UserAgent(), client)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to issue tokens")
 		return
 	}
 
 	writeJSON(w, http.StatusOK, loginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:        accessToken,
+		RefreshToken:       refreshToken,
+		MustChangePassword: user.MustChangePassword,
 	})
 }
 
 // RefreshAuth handles GET /user/get-auth/.
 // It reads the current (possibly expired) access token from the AccessToken
-// header, verifies the HMAC signature to identify the user, checks that a
-// valid refresh session exists, and returns a fresh access token.
+// header, verifies the HMAC signature to identify the user and session,
+// checks that the session is still active, and returns a fresh access token.
 func RefreshAuth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Message: "method not allowed"})
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	rawToken := r.Header.Get("AccessToken")
 	if rawToken == "" {
-		writeJSON(w, http.StatusUnauthorized, errorResponse{Message: "missing access token"})
+		apierror.Respond(w, r, http.StatusUnauthorized, "missing access token")
 		return
 	}
 
@@ -323,41 +324,45 @@ func RefreshAuth(w http.ResponseWriter, r *http.Request) {
 	// identify the caller.
 	claims, err := parseToken(rawToken, true)
 	if err != nil {
-		writeJSON(w, http.StatusUnauthorized, errorResponse{Message: "invalid access token"})
+		apierror.Respond(w, r, http.StatusUnauthorized, "invalid access token")
 		return
 	}
 
-	// Look up the stored refresh session for this user and validate expiry
-	// while still holding the read lock to avoid a TOCTOU race.
-	sessionStore.RLock()
-	session, ok := sessionStore.data[claims.Subject]
-	expired := ok && time.Now().After(session.refreshExpiry)
-	sessionStore.RUnlock()
-
-	if !ok || expired {
-		writeJSON(w, http.StatusUnauthorized, errorResponse{Message: "refresh session expired, please log in again"})
+	// Revoked access tokens (e.g. from a logout) cannot be refreshed.
+	revoked, err := isTokenRevoked(claims.TokenID)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
 		return
 	}
 
-	// Issue a new access token (refresh token is kept the same).
-	jti, err := generateTokenID()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, errorResponse{Message: "failed to generate token"})
+	// Look up the refresh session the token was issued for.  getSession
+	// already treats expired sessions as missing.
+	var session *userSession
+	if !revoked && claims.SessionID != "" {
+		session, err = getSession(claims.SessionID)
+		if err != nil {
+			apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+			return
+		}
+	}
+
+	if session == nil || session.Username != claims.Subject {
+		apierror.Respond(w, r, http.StatusUnauthorized, "refresh session expired, please log in again")
 		return
 	}
+
+	// Issue a new access token (refresh token is kept the same).
 	now := time.Now()
-	newAccessToken, err := makeToken(tokenClaims{
-		Subject:   claims.Subject,
-		IssuedAt:  now.Unix(),
-		ExpiresAt: now.Add(1 * time.Hour).Unix(),
-		TokenID:   jti,
-		TokenType: "access",
-	})
+	newAccessToken, err := issueAccessToken(claims.Subject, session.ID, now)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, errorResponse{Message: "failed to issue token"})
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to issue token")
 		return
 	}
 
+	if err := touchSession(session.ID, now); err != nil {
+		slog.WarnContext(r.Context(), "failed to update session", "session", session.ID, "err", err)
+	}
+
 	writeJSON(w, http.StatusOK, map[string]string{
 		"new_access_token": newAccessToken,
 	})
@@ -38,16 +38,19 @@ func setupCredentialsFile(t *testing.T, username, password string) func() {
 	}
 
 	// Point HOME at the temp directory so credentialsPath() and
-	// loadTokenSecret() resolve paths inside our test tree.
+	// the signing keyring resolve paths inside our test tree.
 	orig := os.Getenv("HOME")
 	os.Setenv("HOME", tmpHome)
 
+	// Keep password changes made by tests fast.
+	origCost := passwordHashCost
+	passwordHashCost = bcrypt.MinCost
+
+	// Sessions are persisted under the temp HOME, so nothing else needs
+	// resetting once HOME is restored.
 	return func() {
 		os.Setenv("HOME", orig)
-		// Clear any sessions created during the test.
-		sessionStore.Lock()
-		sessionStore.data = make(map[string]*userSession)
-		sessionStore.Unlock()
+		passwordHashCost = origCost
 	}
 }
 
@@ -220,7 +223,7 @@ func TestRefreshAuthNoSession(t *testing.T) {
 	cleanup := setupCredentialsFile(t, "admin", "admin")
 	defer cleanup()
 
-	// Create a valid token but without a corresponding session in the store.
+	// Create a valid token that references a session which was never stored.
 	jti, _ := generateTokenID()
 	token, _ := makeToken(tokenClaims{
 		Subject:   "admin",
@@ -228,13 +231,9 @@ func TestRefreshAuthNoSession(t *testing.T) {
 		ExpiresAt: 9999999999,
 		TokenID:   jti,
 		TokenType: "access",
+		SessionID: "missing-session",
 	})
 
-	// Ensure no session exists for this user.
-	sessionStore.Lock()
-	delete(sessionStore.data, "admin")
-	sessionStore.Unlock()
-
 	req := httptest.NewRequest(http.MethodGet, "/user/get-auth/", nil)
 	req.Header.Set("AccessToken", token)
 	w := httptest.NewRecorder()
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// authContextKey is the type used for values stored in the request context by
+// RequireAuth.  Using an unexported type prevents collisions with keys set by
+// other packages.
+type authContextKey string
+
+// Context keys under which RequireAuth stores the authenticated username and
+// the full set of verified token claims.
+const (
+	authSubjectKey authContextKey = "authSubject"
+	authClaimsKey  authContextKey = "authClaims"
+)
+
+// publicRoutes lists the paths that may be reached without an access token.
+// Login, its two-factor step and the single sign-on flow have to be public
+// for obvious reasons, and RefreshAuth identifies the caller from an expired
+// access token, so it performs its own validation.  The OpenAPI document is
+// public so client generators can fetch it.
+var publicRoutes = map[string]bool{
+	"/openapi.json":       true,
+	"/user/login":         true,
+	"/user/login/verify":  true,
+	"/user/get-auth/":     true,
+	"/user/oidc/status":   true,
+	"/user/oidc/login":    true,
+	"/user/oidc/callback": true,
+}
+
+// passwordChangeRoutes lists the paths still reachable by a user who has been
+// flagged to change their password.  Everything else answers 403 until they do.
+var passwordChangeRoutes = map[string]bool{
+	"/user/change-password": true,
+	"/user/logout":          true,
+}
+
+// AuthenticatedUser returns the username stored in ctx by RequireAuth.
+// The boolean is false when the request did not pass through the middleware
+// or was served from a public route.
+func AuthenticatedUser(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(authSubjectKey).(string)
+	return subject, ok && subject != ""
+}
+
+// authenticatedClaims returns the verified token claims stored in ctx by RequireAuth.
+func authenticatedClaims(ctx context.Context) (*tokenClaims, bool) {
+	claims, ok := ctx.Value(authClaimsKey).(*tokenClaims)
+	return claims, ok && claims != nil
+}
+
+// withAuthenticatedClaims returns a copy of ctx carrying the token claims and subject.
+func withAuthenticatedClaims(ctx context.Context, claims *tokenClaims) context.Context {
+	ctx = context.WithValue(ctx, authClaimsKey, claims)
+	return context.WithValue(ctx, authSubjectKey, claims.Subject)
+}
+
+// RequireAuth wraps next so that every request must carry valid credentials:
+// either a session access token in the AccessToken header (or as a bearer
+// token), or a personal access token in an "Authorization: Bearer" header.
+// Requests that fail validation are rejected with a 401 JSON body; successful
+// requests have the token subject stored in their context (see AuthenticatedUser).
+// Users flagged with must_change_password get 403 on everything except the
+// routes in passwordChangeRoutes, and users whose role lacks the permission a
+// route needs (see routePermissions) get 403 as well.  On the routes of
+// projectRoutes that role is the user's role in the project the request names
+// (see RequestProject).  Personal access tokens are additionally limited to
+// their scopes.
+//
+// CORS preflight requests are passed through untouched because browsers never
+// attach credentials to them.
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || publicRoutes[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rawToken := r.Header.Get("AccessToken")
+		if rawToken == "" {
+			rawToken = bearerToken(r)
+		}
+		if rawToken == "" {
+			apierror.Respond(w, r, http.StatusUnauthorized, "missing access token")
+			return
+		}
+
+		var (
+			subject string
+			claims  *tokenClaims
+			pat     *personalAccessToken
+		)
+		if strings.HasPrefix(rawToken, personalTokenPrefix) {
+			var err error
+			pat, err = findAccessToken(rawToken)
+			if err != nil {
+				apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+				return
+			}
+			if pat == nil {
+				apierror.Respond(w, r, http.StatusUnauthorized, "invalid or expired personal access token")
+				return
+			}
+			subject = pat.Username
+		} else {
+			var reason string
+			claims, reason = authenticateSessionToken(w, r, rawToken)
+			if claims == nil {
+				if reason != "" {
+					apierror.Respond(w, r, http.StatusUnauthorized, reason)
+				}
+				return
+			}
+			subject = claims.Subject
+		}
+
+		setAuditUser(r, subject)
+
+		// The account may have been deleted or disabled since the token was
+		// issued, or may still be using a password that has to be replaced.
+		user, err := lookupUser(subject)
+		if err != nil {
+			apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+			return
+		}
+		if user == nil || user.Disabled {
+			apierror.Respond(w, r, http.StatusUnauthorized, "account is disabled or no longer exists")
+			return
+		}
+		if user.MustChangePassword && !passwordChangeRoutes[r.URL.Path] {
+			apierror.Write(w, r, apierror.New(http.StatusForbidden, "password change required").WithCode(apierror.CodePasswordChangeRequired))
+			return
+		}
+		// Routes acting on the resources of a project are authorised with
+		// the user's role in that project rather than their instance role.
+		role, project := user.Role, ""
+		if isProjectRoute(r.URL.Path) {
+			var apiErr *apierror.Error
+			if project, role, apiErr = resolveProject(r, user); apiErr != nil {
+				apierror.Write(w, r, apiErr)
+				return
+			}
+		}
+		if !authorizeRoute(role, r.URL.Path) {
+			apierror.Respond(w, r, http.StatusForbidden, "insufficient permissions")
+			return
+		}
+		if pat != nil && !pat.allowsRoute(r.URL.Path) {
+			apierror.Respond(w, r, http.StatusForbidden, "token scope does not allow this request")
+			return
+		}
+
+		ctx := r.Context()
+		if claims != nil {
+			ctx = withAuthenticatedClaims(ctx, claims)
+		} else {
+			ctx = context.WithValue(ctx, authSubjectKey, subject)
+			if err := touchAccessToken(pat, time.Now()); err != nil {
+				slog.WarnContext(ctx, "failed to update access token", "token", pat.ID, "err", err)
+			}
+		}
+		ctx = context.WithValue(ctx, authRoleKey, user.Role)
+		if project != "" {
+			ctx = WithRequestProject(ctx, project)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateSessionToken verifies a session access token.  It returns the
+// claims on success; otherwise it returns a client-safe reason for a 401, or
+// "" when it has already written an error response itself.
+func authenticateSessionToken(w http.ResponseWriter, r *http.Request, rawToken string) (*tokenClaims, string) {
+	claims, err := parseToken(rawToken, false)
+	if err != nil {
+		return nil, "invalid or expired access token"
+	}
+
+	// Refresh tokens are long lived and must only ever be exchanged for a
+	// new access token; they are not accepted as API credentials.
+	if claims.TokenType != "access" {
+		return nil, "invalid token type"
+	}
+
+	// Tokens belonging to a revoked or expired session are rejected even
+	// if the token itself has not yet expired.
+	reason, err := validateSessionClaims(claims)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return nil, ""
+	}
+	if reason != "" {
+		return nil, reason
+	}
+	return claims, ""
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// protectedEcho is a trivial handler used behind RequireAuth in tests.  It
+// writes back the authenticated subject so tests can assert on the context.
+func protectedEcho(w http.ResponseWriter, r *http.Request) {
+	subject, _ := AuthenticatedUser(r.Context())
+	w.Write([]byte(subject))
+}
+
+// mustMakeToken builds a signed token bound to a freshly created session for
+// tests, or fails the test.
+func mustMakeToken(t *testing.T, subject, tokenType string, expiresAt time.Time) string {
+	t.Helper()
+	jti, err := generateTokenID()
+	if err != nil {
+		t.Fatalf("failed to generate token id: %v", err)
+	}
+	session, err := createSession(subject, "", "go-test", "127.0.0.1", time.Now())
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	token, err := makeToken(tokenClaims{
+		Subject:   subject,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		TokenID:   jti,
+		TokenType: tokenType,
+		SessionID: session.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	return token
+}
+
+// TestRequireAuthMissingToken verifies that requests without a token are rejected with JSON.
+func TestRequireAuthMissingToken(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/get-containers", nil)
+	w := httptest.NewRecorder()
+
+	RequireAuth(http.HandlerFunc(protectedEcho)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+	var body apierror.Error
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Message == "" {
+		t.Errorf("expected JSON error body, got err=%v body=%+v", err, body)
+	}
+}
+
+// TestRequireAuthValidToken verifies that a valid access token reaches the handler
+// and that the subject is available from the request context.
+func TestRequireAuthValidToken(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/get-containers", nil)
+	req.Header.Set("AccessToken", mustMakeToken(t, "admin", "access", time.Now().Add(time.Hour)))
+	w := httptest.NewRecorder()
+
+	RequireAuth(http.HandlerFunc(protectedEcho)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if got := w.Body.String(); got != "admin" {
+		t.Errorf("expected subject %q in context, got %q", "admin", got)
+	}
+}
+
+// TestRequireAuthExpiredToken verifies that expired access tokens are rejected.
+func TestRequireAuthExpiredToken(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/get-containers", nil)
+	req.Header.Set("AccessToken", mustMakeToken(t, "admin", "access", time.Now().Add(-time.Minute)))
+	w := httptest.NewRecorder()
+
+	RequireAuth(http.HandlerFunc(protectedEcho)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestRequireAuthRejectsRefreshToken verifies that a refresh token cannot be used as an access token.
+func TestRequireAuthRejectsRefreshToken(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/get-containers", nil)
+	req.Header.Set("AccessToken", mustMakeToken(t, "admin", "refresh", time.Now().Add(time.Hour)))
+	w := httptest.NewRecorder()
+
+	RequireAuth(http.HandlerFunc(protectedEcho)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestRequireAuthUnboundToken verifies that a token without a session is rejected.
+func TestRequireAuthUnboundToken(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	token, _ := makeToken(tokenClaims{
+		Subject:   "admin",
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		TokenID:   "unbound",
+		TokenType: "access",
+	})
+	req := httptest.NewRequest(http.MethodGet, "/get-containers", nil)
+	req.Header.Set("AccessToken", token)
+	w := httptest.NewRecorder()
+
+	RequireAuth(http.HandlerFunc(protectedEcho)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestRequireAuthTamperedToken verifies that a token with a bad signature is rejected.
+func TestRequireAuthTamperedToken(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	token := mustMakeToken(t, "admin", "access", time.Now().Add(time.Hour))
+	lastChar := "0"
+	if token[len(token)-1] == '0' {
+		lastChar = "1"
+	}
+	req := httptest.NewRequest(http.MethodGet, "/get-containers", nil)
+	req.Header.Set("AccessToken", token[:len(token)-1]+lastChar)
+	w := httptest.NewRecorder()
+
+	RequireAuth(http.HandlerFunc(protectedEcho)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestRequireAuthPublicRoutes verifies that the login and refresh routes are reachable without a token.
+func TestRequireAuthPublicRoutes(t *testing.T) {
+	for _, path := range []string{"/user/login", "/user/get-auth/"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		w := httptest.NewRecorder()
+
+		RequireAuth(http.HandlerFunc(protectedEcho)).ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected %d, got %d", path, http.StatusOK, w.Code)
+		}
+	}
+}
+
+// TestRequireAuthPreflight verifies that CORS preflight requests are not blocked.
+func TestRequireAuthPreflight(t *testing.T) {
+	req := httptest.NewRequest(http.MethodOptions, "/get-containers", nil)
+	w := httptest.NewRecorder()
+
+	RequireAuth(http.HandlerFunc(protectedEcho)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
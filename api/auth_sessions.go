@@ -0,0 +1,502 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// refreshSessionTTL is how long a login session (and its refresh token) stays valid.
+const refreshSessionTTL = 7 * 24 * time.Hour
+
+// userSession is a single login session.  A user may hold several sessions
+// at once, typically one per browser or device.
+type userSession struct {
+	ID             string    `json:"id"`
+	Username       string    `json:"username"`
+	RefreshTokenID string    `json:"refreshTokenId"`
+	UserAgent      string    `json:"userAgent,omitempty"`
+	RemoteAddr     string    `json:"remoteAddr,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	LastUsedAt     time.Time `json:"lastUsedAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// sessionFile is the on-disk layout of ~/.opencloud/user/sessions.json.
+//
+// Sessions are keyed by session ID.  RevokedTokens maps a revoked token ID
+// (jti) to the Unix time at which the token would have expired anyway, so
+// entries can be pruned once they no longer matter.
+type sessionFile struct {
+	Sessions      map[string]userSession `json:"sessions"`
+	RevokedTokens map[string]int64       `json:"revokedTokens"`
+}
+
+// sessionMutex serialises read-modify-write cycles on the sessions file.
+var sessionMutex sync.Mutex
+
+// sessionsPath returns the path to the persisted sessions file.
+func sessionsPath() (string, error) {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "user", "sessions.json"), nil
+}
+
+// readSessionFile loads the sessions file, returning an empty store when it
+// does not exist yet.  Callers that intend to write must hold sessionMutex.
+func readSessionFile() (*sessionFile, error) {
+	path, err := sessionsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &sessionFile{
+		Sessions:      make(map[string]userSession),
+		RevokedTokens: make(map[string]int64),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("malformed sessions file: %w", err)
+	}
+	if store.Sessions == nil {
+		store.Sessions = make(map[string]userSession)
+	}
+	if store.RevokedTokens == nil {
+		store.RevokedTokens = make(map[string]int64)
+	}
+	return store, nil
+}
+
+// writeSessionFile prunes expired entries and atomically replaces the
+// sessions file.  Callers must hold sessionMutex.
+func writeSessionFile(store *sessionFile) error {
+	path, err := sessionsPath()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for id, s := range store.Sessions {
+		if now.After(s.ExpiresAt) {
+			delete(store.Sessions, id)
+		}
+	}
+	for jti, exp := range store.RevokedTokens {
+		if now.Unix() > exp {
+			delete(store.RevokedTokens, jti)
+		}
+	}
+
+	data, err := json.MarshalIndent(store, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// createSession records a new login session and returns it.
+func createSession(username, refreshTokenID, userAgent, remoteAddr string, now time.Time) (*userSession, error) {
+	id, err := generateTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	session := userSession{
+		ID:             id,
+		Username:       username,
+		RefreshTokenID: refreshTokenID,
+		UserAgent:      userAgent,
+		RemoteAddr:     remoteAddr,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+		ExpiresAt:      now.Add(refreshSessionTTL),
+	}
+
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	store, err := readSessionFile()
+	if err != nil {
+		return nil, err
+	}
+	store.Sessions[id] = session
+	if err := writeSessionFile(store); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// getSession returns the active session with the given ID, or nil when it
+// does not exist or has expired.
+func getSession(sessionID string) (*userSession, error) {
+	store, err := readSessionFile()
+	if err != nil {
+		return nil, err
+	}
+	session, ok := store.Sessions[sessionID]
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// touchSession updates the last-used timestamp of a session.
+func touchSession(sessionID string, now time.Time) error {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	store, err := readSessionFile()
+	if err != nil {
+		return err
+	}
+	session, ok := store.Sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	session.LastUsedAt = now
+	store.Sessions[sessionID] = session
+	return writeSessionFile(store)
+}
+
+// listSessions returns the active sessions belonging to username, newest first.
+func listSessions(username string) ([]userSession, error) {
+	store, err := readSessionFile()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := []userSession{}
+	for _, s := range store.Sessions {
+		if s.Username == username && now.Before(s.ExpiresAt) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// revokeSession deletes the session with the given ID and blacklists its
+// refresh token, plus any extra token IDs supplied (e.g. the access token
+// used to call logout).  When owner is non-empty the session must belong to
+// that user.  It reports whether a matching session was found.
+func revokeSession(sessionID, owner string, extraTokens map[string]int64) (bool, error) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	store, err := readSessionFile()
+	if err != nil {
+		return false, err
+	}
+
+	session, ok := store.Sessions[sessionID]
+	if !ok || (owner != "" && session.Username != owner) {
+		return false, nil
+	}
+
+	delete(store.Sessions, sessionID)
+	if session.RefreshTokenID != "" {
+		store.RevokedTokens[session.RefreshTokenID] = session.ExpiresAt.Unix()
+	}
+	for jti, exp := range extraTokens {
+		store.RevokedTokens[jti] = exp
+	}
+
+	return true, writeSessionFile(store)
+}
+
+// revokeUserSessions ends every session belonging to username except the one
+// with ID exceptSessionID (pass "" to end them all).  Access tokens issued for
+// those sessions stop working immediately because their session is gone.
+func revokeUserSessions(username, exceptSessionID string) error {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	store, err := readSessionFile()
+	if err != nil {
+		return err
+	}
+
+	for id, s := range store.Sessions {
+		if s.Username != username || id == exceptSessionID {
+			continue
+		}
+		delete(store.Sessions, id)
+		if s.RefreshTokenID != "" {
+			store.RevokedTokens[s.RefreshTokenID] = s.ExpiresAt.Unix()
+		}
+	}
+	return writeSessionFile(store)
+}
+
+// revokeTokenIDs blacklists the given token IDs until their expiry.
+func revokeTokenIDs(tokens map[string]int64) error {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	store, err := readSessionFile()
+	if err != nil {
+		return err
+	}
+	for jti, exp := range tokens {
+		store.RevokedTokens[jti] = exp
+	}
+	return writeSessionFile(store)
+}
+
+// isTokenRevoked reports whether the token ID has been explicitly revoked.
+func isTokenRevoked(tokenID string) (bool, error) {
+	store, err := readSessionFile()
+	if err != nil {
+		return false, err
+	}
+	_, revoked := store.RevokedTokens[tokenID]
+	return revoked, nil
+}
+
+// validateSessionClaims checks that a token has not been revoked and that the
+// session it was issued for is still active.  It returns a client-safe
+// message describing the failure, or "" when the claims are acceptable.
+func validateSessionClaims(claims *tokenClaims) (string, error) {
+	revoked, err := isTokenRevoked(claims.TokenID)
+	if err != nil {
+		return "", err
+	}
+	if revoked {
+		return "token has been revoked", nil
+	}
+
+	if claims.SessionID == "" {
+		return "token is not bound to a session", nil
+	}
+	session, err := getSession(claims.SessionID)
+	if err != nil {
+		return "", err
+	}
+	if session == nil || session.Username != claims.Subject {
+		return "session has ended, please log in again", nil
+	}
+	return "", nil
+}
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For and
+// X-Real-IP headers clientAddr believes.  It is set once at startup.
+var trustedProxies []netip.Prefix
+
+// SetTrustedProxies sets the addresses of the reverse proxies in front of
+// the API.  It must be called before the server starts.
+func SetTrustedProxies(prefixes []netip.Prefix) {
+	trustedProxies = prefixes
+}
+
+// isTrustedProxy reports whether host is the address of a trusted proxy.
+func isTrustedProxy(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the IP address of the client that sent the request,
+// without the port.  When the peer is a trusted proxy the address comes
+// from X-Forwarded-For, read from the right and skipping trusted proxies
+// since clients can put anything on the left, or else from X-Real-IP.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		if host = addr.Unmap().String(); !isTrustedProxy(host) {
+			return host
+		}
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+// sessionResponse is the JSON representation of a session returned by ListSessions.
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// Logout handles POST /user/logout.
+// It revokes the session the caller's access token belongs to, along with
+// the access token itself, so neither can be used again.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, ok := authenticatedClaims(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	if _, err := revokeSession(claims.SessionID, claims.Subject, map[string]int64{
+		claims.TokenID: claims.ExpiresAt,
+	}); err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to end session")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "logged out"})
+}
+
+// ListSessions handles GET /user/sessions.
+// It returns every active session belonging to the caller, flagging the one
+// the current access token was issued for.
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, ok := authenticatedClaims(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	sessions, err := listSessions(claims.Subject)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to read sessions")
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, sessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			RemoteAddr: s.RemoteAddr,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == claims.SessionID,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RevokeSession handles DELETE /user/sessions/{id}.
+// Callers may only revoke their own sessions; revoking the current session
+// behaves like Logout.
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, ok := authenticatedClaims(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	// URL format: /user/sessions/{id}
+	sessionID := strings.TrimPrefix(r.URL.Path, "/user/sessions/")
+	if sessionID == "" || strings.Contains(sessionID, "/") {
+		apierror.Respond(w, r, http.StatusBadRequest, "session id is required")
+		return
+	}
+
+	extra := map[string]int64{}
+	if sessionID == claims.SessionID {
+		extra[claims.TokenID] = claims.ExpiresAt
+	}
+
+	found, err := revokeSession(sessionID, claims.Subject, extra)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to revoke session")
+		return
+	}
+	if !found {
+		apierror.Respond(w, r, http.StatusNotFound, "session not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "session revoked", "id": sessionID})
+}
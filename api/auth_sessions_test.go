@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// loginForTest performs a login through the Login handler and returns the
+// resulting token pair.
+func loginForTest(t *testing.T, username, password, userAgent string) loginResponse {
+	t.Helper()
+
+	body, _ := json.Marshal(loginRequest{Username: username, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/user/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+
+	Login(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("login failed: %d — %s", w.Code, w.Body.String())
+	}
+	var resp loginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode login response: %v", err)
+	}
+	return resp
+}
+
+// serveAuthenticated runs handler behind RequireAuth with the given access token.
+func serveAuthenticated(handler http.HandlerFunc, method, path, accessToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("AccessToken", accessToken)
+	w := httptest.NewRecorder()
+	RequireAuth(handler).ServeHTTP(w, req)
+	return w
+}
+
+// TestSessionsPersistedToDisk verifies that logging in writes the session file.
+func TestSessionsPersistedToDisk(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	loginForTest(t, "admin", "admin", "device-a")
+
+	path, err := sessionsPath()
+	if err != nil {
+		t.Fatalf("sessionsPath: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected sessions file to exist: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected sessions file mode 0600, got %o", info.Mode().Perm())
+	}
+}
+
+// TestListSessionsMultipleDevices verifies that each login creates its own session.
+func TestListSessionsMultipleDevices(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	first := loginForTest(t, "admin", "admin", "device-a")
+	loginForTest(t, "admin", "admin", "device-b")
+
+	w := serveAuthenticated(ListSessions, http.MethodGet, "/user/sessions", first.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var sessions []sessionResponse
+	if err := json.NewDecoder(w.Body).Decode(&sessions); err != nil {
+		t.Fatalf("failed to decode sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	current := 0
+	for _, s := range sessions {
+		if s.Current {
+			current++
+			if s.UserAgent != "device-a" {
+				t.Errorf("expected current session to be device-a, got %q", s.UserAgent)
+			}
+		}
+	}
+	if current != 1 {
+		t.Errorf("expected exactly one current session, got %d", current)
+	}
+}
+
+// TestLogoutRevokesSession verifies that after logout neither the access token
+// nor a refresh through it is accepted, while other sessions keep working.
+func TestLogoutRevokesSession(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	first := loginForTest(t, "admin", "admin", "device-a")
+	second := loginForTest(t, "admin", "admin", "device-b")
+
+	w := serveAuthenticated(Logout, http.MethodPost, "/user/logout", first.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", first.AccessToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected revoked token to get %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	refreshReq := httptest.NewRequest(http.MethodGet, "/user/get-auth/", nil)
+	refreshReq.Header.Set("AccessToken", first.AccessToken)
+	refreshW := httptest.NewRecorder()
+	RefreshAuth(refreshW, refreshReq)
+	if refreshW.Code != http.StatusUnauthorized {
+		t.Errorf("expected refresh after logout to get %d, got %d", http.StatusUnauthorized, refreshW.Code)
+	}
+
+	w = serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", second.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected other session to remain valid, got %d", w.Code)
+	}
+}
+
+// TestLogoutMethodNotAllowed verifies that GET requests to /user/logout are rejected.
+func TestLogoutMethodNotAllowed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/user/logout", nil)
+	w := httptest.NewRecorder()
+
+	Logout(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+// TestRevokeSessionByID verifies that a user can revoke one of their other sessions.
+func TestRevokeSessionByID(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	first := loginForTest(t, "admin", "admin", "device-a")
+	second := loginForTest(t, "admin", "admin", "device-b")
+
+	secondClaims, err := parseToken(second.AccessToken, false)
+	if err != nil {
+		t.Fatalf("parseToken: %v", err)
+	}
+
+	w := serveAuthenticated(RevokeSession, http.MethodDelete, "/user/sessions/"+secondClaims.SessionID, first.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", second.AccessToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected revoked session token to get %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestRevokeSessionNotFound verifies that unknown session IDs return 404.
+func TestRevokeSessionNotFound(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	first := loginForTest(t, "admin", "admin", "device-a")
+
+	w := serveAuthenticated(RevokeSession, http.MethodDelete, "/user/sessions/does-not-exist", first.AccessToken)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestRevokedTokenIDRejected verifies that a revoked jti is refused before it expires.
+func TestRevokedTokenIDRejected(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	resp := loginForTest(t, "admin", "admin", "device-a")
+	claims, err := parseToken(resp.AccessToken, false)
+	if err != nil {
+		t.Fatalf("parseToken: %v", err)
+	}
+
+	sessionMutex.Lock()
+	store, err := readSessionFile()
+	if err == nil {
+		store.RevokedTokens[claims.TokenID] = claims.ExpiresAt
+		err = writeSessionFile(store)
+	}
+	sessionMutex.Unlock()
+	if err != nil {
+		t.Fatalf("failed to revoke token: %v", err)
+	}
+
+	w := serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", resp.AccessToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// Background tasks are work that outlives the request that started it, such
+// as pipeline runs.  They are tracked so a shutting-down server can wait for
+// them instead of killing them mid-flight.
+var (
+	backgroundMutex    sync.Mutex
+	backgroundTasks    sync.WaitGroup
+	backgroundDraining bool
+
+	// backgroundCtx is handed to every task and cancelled when the drain
+	// deadline passes, which kills whatever is still running.
+	backgroundCtx, cancelBackground = context.WithCancel(context.Background())
+)
+
+// startBackgroundTask runs fn in a new goroutine.  It returns false without
+// running fn once the server has started shutting down.
+func startBackgroundTask(fn func(ctx context.Context)) bool {
+	backgroundMutex.Lock()
+	defer backgroundMutex.Unlock()
+
+	if backgroundDraining {
+		return false
+	}
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		fn(backgroundCtx)
+	}()
+	return true
+}
+
+// DrainBackgroundTasks stops new background tasks from starting and waits for
+// running ones to finish.  When ctx ends first, the remaining tasks are
+// cancelled and ctx's error is returned once they have exited.
+func DrainBackgroundTasks(ctx context.Context) error {
+	backgroundMutex.Lock()
+	backgroundDraining = true
+	backgroundMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		backgroundTasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancelBackground()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// resetBackgroundTasks undoes a drain so later tests can start tasks again.
+func resetBackgroundTasks(t *testing.T) {
+	t.Cleanup(func() {
+		backgroundMutex.Lock()
+		defer backgroundMutex.Unlock()
+		backgroundDraining = false
+		backgroundCtx, cancelBackground = context.WithCancel(context.Background())
+	})
+}
+
+// TestDrainWaitsForBackgroundTasks verifies a drain waits for running tasks
+// and refuses new ones.
+func TestDrainWaitsForBackgroundTasks(t *testing.T) {
+	resetBackgroundTasks(t)
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	if !startBackgroundTask(func(ctx context.Context) {
+		<-release
+		close(finished)
+	}) {
+		t.Fatal("expected task to start")
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- DrainBackgroundTasks(context.Background()) }()
+
+	// Wait until the drain has begun, then check that new work is refused.
+	for {
+		backgroundMutex.Lock()
+		draining := backgroundDraining
+		backgroundMutex.Unlock()
+		if draining {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if startBackgroundTask(func(context.Context) {}) {
+		t.Error("expected new tasks to be refused while draining")
+	}
+
+	select {
+	case <-drained:
+		t.Fatal("drain returned before the task finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-drained; err != nil {
+		t.Errorf("DrainBackgroundTasks: %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("task did not finish")
+	}
+}
+
+// TestDrainDeadlineCancelsTasks verifies tasks still running at the deadline
+// are cancelled.
+func TestDrainDeadlineCancelsTasks(t *testing.T) {
+	resetBackgroundTasks(t)
+
+	startBackgroundTask(func(ctx context.Context) {
+		<-ctx.Done()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := DrainBackgroundTasks(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
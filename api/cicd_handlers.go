@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
@@ -17,7 +18,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/api/listing"
+	"github.com/WavexSoftware/OpenCloud/logging"
 	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
 )
 
 var pipelineNameRegex = regexp.MustCompile(`[^a-zA-Z0-9\-_.]`)
@@ -49,37 +55,37 @@ type CreatePipelineRequest struct {
 
 func CreatePipeline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Parse request body
 	var req CreatePipelineRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
 	// Validate required fields
 	if req.Name == "" || req.Code == "" {
-		http.Error(w, "Missing required fields: name and code", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing required fields: name and code")
 		return
 	}
 
 	// Validate pipeline name: no spaces and max 50 characters
 	if strings.ContainsAny(req.Name, " \t\n\r") {
-		http.Error(w, "Pipeline name cannot contain spaces", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline name cannot contain spaces")
 		return
 	}
 	if len(req.Name) > 50 {
-		http.Error(w, "Pipeline name must be 50 characters or fewer", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline name must be 50 characters or fewer")
 		return
 	}
 
 	// Sanitize pipeline name to prevent directory traversal and invalid filenames
 	sanitizedName := sanitizePipelineName(req.Name)
 	if sanitizedName == "" {
-		http.Error(w, "Invalid pipeline name", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid pipeline name")
 		return
 	}
 
@@ -88,25 +94,25 @@ func CreatePipeline(w http.ResponseWriter, r *http.Request) {
 		req.Branch = "main"
 	}
 
-	// Get home directory and create pipelines directory
-	home, err := os.UserHomeDir()
+	// Get and create the pipelines directory of the project
+	project := RequestProject(r.Context())
+	pipelineDir, err := utils.ProjectDir(project, utils.Pipelines)
 	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve pipelines directory"))
 		return
 	}
-
-	pipelineDir := filepath.Join(home, ".opencloud", "pipelines")
 	if err := os.MkdirAll(pipelineDir, 0755); err != nil {
-		http.Error(w, "Failed to create pipelines directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to create pipelines directory"))
 		return
 	}
 
 	// Generate unique ID for the pipeline
 	pipelineID, err := generatePipelineID()
 	if err != nil {
-		http.Error(w, "Failed to generate pipeline ID", http.StatusInternalServerError)
+		apierror.Respond(w, r, http.StatusInternalServerError, "Failed to generate pipeline ID")
 		return
 	}
+	key := service_ledger.ProjectKey(project, pipelineID)
 
 	// Create shell script filename from sanitized name
 	pipelineFileName := sanitizedName + ".sh"
@@ -114,13 +120,13 @@ func CreatePipeline(w http.ResponseWriter, r *http.Request) {
 
 	// Check if pipeline already exists
 	if _, err := os.Stat(pipelinePath); err == nil {
-		http.Error(w, "Pipeline already exists", http.StatusConflict)
+		apierror.Respond(w, r, http.StatusConflict, "Pipeline already exists")
 		return
 	}
 
 	// Write pipeline code to shell script file
 	if err := os.WriteFile(pipelinePath, []byte(req.Code), 0755); err != nil {
-		http.Error(w, "Failed to create pipeline file", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to create pipeline file"))
 		return
 	}
 
@@ -137,7 +143,7 @@ func CreatePipeline(w http.ResponseWriter, r *http.Request) {
 
 	// Update service ledger with pipeline entry
 	if err := service_ledger.UpdatePipelineEntry(
-		pipelineID,
+		key,
 		req.Name,
 		req.Description,
 		req.Code,
@@ -146,7 +152,7 @@ func CreatePipeline(w http.ResponseWriter, r *http.Request) {
 		pipeline.CreatedAt.Format(time.RFC3339),
 	); err != nil {
 		// Log the error but don't fail the request since pipeline file was already created
-		fmt.Printf("Warning: Failed to update service ledger: %v\n", err)
+		slog.WarnContext(r.Context(), "failed to update service ledger", "pipeline", pipeline.ID, "err", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -154,22 +160,44 @@ func CreatePipeline(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(pipeline)
 }
 
-// GetPipelines retrieves all pipelines from the ~/.opencloud/pipelines directory
+// pipelineListing describes the list parameters of GetPipelines.  Pipelines
+// missing from the ledger get a new ID on every call, so the key is the name,
+// which is unique as well.
+var pipelineListing = listing.Spec[Pipeline]{
+	Key: func(p Pipeline) string { return p.Name },
+	Sorts: map[string]listing.Field[Pipeline]{
+		"name":    {String: func(p Pipeline) string { return p.Name }},
+		"created": {Int: func(p Pipeline) int64 { return p.CreatedAt.UnixNano() }},
+		"status":  {String: func(p Pipeline) string { return p.Status }},
+	},
+	DefaultSort: "name",
+	Filters: map[string]listing.Filter[Pipeline]{
+		"status": listing.Equal(func(p Pipeline) string { return p.Status }),
+		"prefix": listing.Prefix(func(p Pipeline) string { return p.Name }),
+	},
+}
+
+// GetPipelines retrieves all pipelines from the pipelines directory of the
+// request's project.  It takes the list parameters of pipelineListing.
 func GetPipelines(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	q, apiErr := pipelineListing.Parse(r.URL.Query())
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
 
-	// Get home directory
-	home, err := os.UserHomeDir()
+	// Get the pipelines directory of the project
+	project := RequestProject(r.Context())
+	pipelineDir, err := utils.ProjectDir(project, utils.Pipelines)
 	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve pipelines directory"))
 		return
 	}
 
-	pipelineDir := filepath.Join(home, ".opencloud", "pipelines")
-
 	// Check if directory exists
 	if _, err := os.Stat(pipelineDir); os.IsNotExist(err) {
 		// Return empty list if directory doesn't exist
@@ -181,14 +209,14 @@ func GetPipelines(w http.ResponseWriter, r *http.Request) {
 	// Read all files in the pipelines directory
 	entries, err := os.ReadDir(pipelineDir)
 	if err != nil {
-		http.Error(w, "Failed to read pipelines directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to read pipelines directory"))
 		return
 	}
 
 	// Get all pipeline entries from the service ledger
 	ledgerPipelines, err := service_ledger.GetAllPipelineEntries()
 	if err != nil {
-		fmt.Printf("Warning: Failed to read service ledger: %v\n", err)
+		slog.WarnContext(r.Context(), "failed to read service ledger", "err", err)
 		ledgerPipelines = make(map[string]service_ledger.PipelineEntry)
 	}
 
@@ -196,7 +224,7 @@ func GetPipelines(w http.ResponseWriter, r *http.Request) {
 	// Note: Ledger stores original names, but filenames use sanitized names,
 	// so we need to sanitize ledger names to match against filenames
 	sanitizedNameToEntry := make(map[string]service_ledger.PipelineEntry)
-	for _, entry := range ledgerPipelines {
+	for _, entry := range service_ledger.ProjectEntries(ledgerPipelines, project) {
 		sanitizedName := sanitizePipelineName(entry.Name)
 		sanitizedNameToEntry[sanitizedName] = entry
 	}
@@ -266,7 +294,9 @@ func GetPipelines(w http.ResponseWriter, r *http.Request) {
 
 		pipelines = append(pipelines, pipeline)
 	}
+	pipelines, next := pipelineListing.Apply(q, pipelines)
 
+	listing.SetNextCursor(w, next)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(pipelines)
 }
@@ -292,7 +322,7 @@ func sanitizePipelineName(name string) string {
 // GetPipeline retrieves a single pipeline by its ID
 func GetPipeline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -300,19 +330,21 @@ func GetPipeline(w http.ResponseWriter, r *http.Request) {
 	// URL format: /get-pipeline/{id}
 	pipelineID := strings.TrimPrefix(r.URL.Path, "/get-pipeline/")
 	if pipelineID == "" {
-		http.Error(w, "Pipeline ID is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline ID is required")
 		return
 	}
+	project := RequestProject(r.Context())
+	key := pipelineKey(project, pipelineID)
 
 	// Get pipeline entry from service ledger
-	ledgerEntry, err := service_ledger.GetPipelineEntry(pipelineID)
+	ledgerEntry, err := service_ledger.GetPipelineEntry(key)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve pipeline: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to retrieve pipeline")
 		return
 	}
 
 	if ledgerEntry == nil {
-		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Pipeline not found")
 		return
 	}
 
@@ -320,7 +352,7 @@ func GetPipeline(w http.ResponseWriter, r *http.Request) {
 	createdAt, err := time.Parse(time.RFC3339, ledgerEntry.CreatedAt)
 	if err != nil {
 		// If parsing fails, log the error and use zero time to indicate unknown creation time
-		fmt.Printf("Warning: Failed to parse creation time for pipeline %s: %v\n", pipelineID, err)
+		slog.WarnContext(r.Context(), "failed to parse pipeline creation time", "pipeline", pipelineID, "err", err)
 		createdAt = time.Time{}
 	}
 
@@ -340,6 +372,15 @@ func GetPipeline(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(pipeline)
 }
 
+// pipelineKey returns the ledger key of the pipeline with the given ID in
+// project, or "" when the ID could name a pipeline of another project.
+func pipelineKey(project, pipelineID string) string {
+	if !utils.ValidResourceName(pipelineID) {
+		return ""
+	}
+	return service_ledger.ProjectKey(project, pipelineID)
+}
+
 // generatePipelineID creates a unique identifier for the pipeline
 func generatePipelineID() (string, error) {
 	b := make([]byte, 8)
@@ -361,7 +402,7 @@ type UpdatePipelineRequest struct {
 // UpdatePipeline updates an existing pipeline by its ID
 func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -369,30 +410,32 @@ func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
 	// URL format: /update-pipeline/{id}
 	pipelineID := strings.TrimPrefix(r.URL.Path, "/update-pipeline/")
 	if pipelineID == "" {
-		http.Error(w, "Pipeline ID is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline ID is required")
 		return
 	}
+	project := RequestProject(r.Context())
+	key := pipelineKey(project, pipelineID)
 
 	// Parse request body
 	var req UpdatePipelineRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
 	// Validate required fields
 	if req.Name == "" || req.Code == "" {
-		http.Error(w, "Missing required fields: name and code", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing required fields: name and code")
 		return
 	}
 
 	// Validate pipeline name: no spaces and max 50 characters
 	if strings.ContainsAny(req.Name, " \t\n\r") {
-		http.Error(w, "Pipeline name cannot contain spaces", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline name cannot contain spaces")
 		return
 	}
 	if len(req.Name) > 50 {
-		http.Error(w, "Pipeline name must be 50 characters or fewer", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline name must be 50 characters or fewer")
 		return
 	}
 
@@ -402,31 +445,29 @@ func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get existing pipeline entry from service ledger to verify it exists
-	existingEntry, err := service_ledger.GetPipelineEntry(pipelineID)
+	existingEntry, err := service_ledger.GetPipelineEntry(key)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve pipeline: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to retrieve pipeline")
 		return
 	}
 
 	if existingEntry == nil {
-		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Pipeline not found")
 		return
 	}
 
-	// Get home directory and pipelines directory
-	home, err := os.UserHomeDir()
+	// Get pipelines directory
+	pipelineDir, err := utils.ProjectDir(project, utils.Pipelines)
 	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve pipelines directory"))
 		return
 	}
 
-	pipelineDir := filepath.Join(home, ".opencloud", "pipelines")
-
 	// Update service ledger with the new pipeline data first
 	// This ensures the ledger is updated before filesystem changes to maintain consistency
 	// Preserve the original creation time
 	if err := service_ledger.UpdatePipelineEntry(
-		pipelineID,
+		key,
 		req.Name,
 		req.Description,
 		req.Code,
@@ -434,7 +475,7 @@ func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
 		existingEntry.Status, // Preserve existing status
 		existingEntry.CreatedAt, // Preserve original creation time
 	); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update service ledger: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Ledger(err, "Failed to update service ledger"))
 		return
 	}
 
@@ -451,8 +492,8 @@ func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
 		if _, err := os.Stat(oldPipelinePath); err == nil {
 			if err := os.Remove(oldPipelinePath); err != nil {
 				// Log the specific error for debugging
-				fmt.Printf("Warning: Failed to remove old pipeline file %s: %v\n", oldPipelinePath, err)
-				http.Error(w, fmt.Sprintf("Failed to remove old pipeline file: %v", err), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "failed to remove old pipeline file", "path", oldPipelinePath, "err", err)
+				apierror.RespondError(w, r, err, "Failed to remove old pipeline file")
 				return
 			}
 		}
@@ -464,8 +505,8 @@ func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
 	
 	if err := os.WriteFile(pipelinePath, []byte(req.Code), 0755); err != nil {
 		// Log the specific error for debugging
-		fmt.Printf("Error: Failed to write pipeline file %s: %v\n", pipelinePath, err)
-		http.Error(w, fmt.Sprintf("Failed to update pipeline file: %v", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to write pipeline file", "path", pipelinePath, "err", err)
+		apierror.RespondError(w, r, err, "Failed to update pipeline file")
 		return
 	}
 
@@ -493,7 +534,7 @@ func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
 // DeletePipeline deletes a pipeline by its ID
 func DeletePipeline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -501,30 +542,35 @@ func DeletePipeline(w http.ResponseWriter, r *http.Request) {
 	// URL format: /delete-pipeline/{id}
 	pipelineID := strings.TrimPrefix(r.URL.Path, "/delete-pipeline/")
 	if pipelineID == "" {
-		http.Error(w, "Pipeline ID is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline ID is required")
 		return
 	}
+	project := RequestProject(r.Context())
+	key := pipelineKey(project, pipelineID)
 
 	// Get pipeline entry from service ledger
-	ledgerEntry, err := service_ledger.GetPipelineEntry(pipelineID)
+	ledgerEntry, err := service_ledger.GetPipelineEntry(key)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve pipeline: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to retrieve pipeline")
 		return
 	}
 
 	if ledgerEntry == nil {
-		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Pipeline not found")
 		return
 	}
 
-	// Get home directory and pipelines directory
-	home, err := os.UserHomeDir()
+	// Get pipelines and log directories
+	pipelineDir, err := utils.ProjectDir(project, utils.Pipelines)
 	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve pipelines directory"))
+		return
+	}
+	logDir, err := pipelineLogDir(project)
+	if err != nil {
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve log directory"))
 		return
 	}
-
-	pipelineDir := filepath.Join(home, ".opencloud", "pipelines")
 
 	// Delete pipeline file
 	sanitizedName := sanitizePipelineName(ledgerEntry.Name)
@@ -533,20 +579,19 @@ func DeletePipeline(w http.ResponseWriter, r *http.Request) {
 
 	if _, err := os.Stat(pipelinePath); err == nil {
 		if err := os.Remove(pipelinePath); err != nil {
-			fmt.Printf("Warning: Failed to remove pipeline file %s: %v\n", pipelinePath, err)
-			http.Error(w, fmt.Sprintf("Failed to remove pipeline file: %v", err), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "failed to remove pipeline file", "path", pipelinePath, "err", err)
+			apierror.RespondError(w, r, err, "Failed to remove pipeline file")
 			return
 		}
 	}
 
 	// Delete from service ledger
-	if err := service_ledger.DeletePipelineEntry(pipelineID); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to delete pipeline from ledger: %v", err), http.StatusInternalServerError)
+	if err := service_ledger.DeletePipelineEntry(key); err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "Failed to delete pipeline from ledger"))
 		return
 	}
 
 	// Delete log file if it exists
-	logDir := filepath.Join(home, ".opencloud", "logs", "pipelines")
 	logFileName := sanitizedName + ".log"
 	logFilePath := filepath.Join(logDir, logFileName)
 	if _, err := os.Stat(logFilePath); err == nil {
@@ -570,7 +615,7 @@ type PipelineLog struct {
 // RunPipeline executes a pipeline by its ID
 func RunPipeline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -578,44 +623,50 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 	// URL format: /run-pipeline/{id}
 	pipelineID := strings.TrimPrefix(r.URL.Path, "/run-pipeline/")
 	if pipelineID == "" {
-		http.Error(w, "Pipeline ID is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline ID is required")
 		return
 	}
+	project := RequestProject(r.Context())
+	key := pipelineKey(project, pipelineID)
 
 	// Get pipeline entry from service ledger
-	ledgerEntry, err := service_ledger.GetPipelineEntry(pipelineID)
+	ledgerEntry, err := service_ledger.GetPipelineEntry(key)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve pipeline: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to retrieve pipeline")
 		return
 	}
 
 	if ledgerEntry == nil {
-		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Pipeline not found")
 		return
 	}
 
-	// Get home directory
-	home, err := os.UserHomeDir()
+	// Get pipelines and log directories
+	pipelineDir, err := utils.ProjectDir(project, utils.Pipelines)
+	if err != nil {
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve pipelines directory"))
+		return
+	}
+	logDir, err := pipelineLogDir(project)
 	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve log directory"))
 		return
 	}
 
 	// Construct path to pipeline script
-	pipelineDir := filepath.Join(home, ".opencloud", "pipelines")
 	sanitizedName := sanitizePipelineName(ledgerEntry.Name)
 	pipelineFileName := sanitizedName + ".sh"
 	pipelinePath := filepath.Join(pipelineDir, pipelineFileName)
 
 	// Check if pipeline file exists
 	if _, err := os.Stat(pipelinePath); os.IsNotExist(err) {
-		http.Error(w, "Pipeline script file not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Pipeline script file not found")
 		return
 	}
 
 	// Update status to "running"
 	if err := service_ledger.UpdatePipelineEntry(
-		pipelineID,
+		key,
 		ledgerEntry.Name,
 		ledgerEntry.Description,
 		ledgerEntry.Code,
@@ -623,23 +674,29 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 		"running",
 		ledgerEntry.CreatedAt,
 	); err != nil {
-		fmt.Printf("Warning: Failed to update pipeline status: %v\n", err)
+		slog.WarnContext(r.Context(), "failed to update pipeline status", "pipeline", pipelineID, "err", err)
 	}
 
-	// Execute pipeline in a goroutine to avoid blocking
-	go func() {
-		ctx := context.Background()
+	// Execute pipeline in the background to avoid blocking.  The task context
+	// is cancelled only if a server shutdown runs out of time, and carries
+	// the request ID so the run's log lines can be traced to this request.
+	requestID := apierror.RequestID(r.Context())
+	started := startBackgroundTask(func(ctx context.Context) {
+		ctx = logging.ContextWithRequestID(ctx, requestID)
+		slog.InfoContext(ctx, "pipeline started", "pipeline", pipelineID, "name", ledgerEntry.Name)
+		events.Publish(events.PipelineStarted, map[string]any{"id": pipelineID, "name": ledgerEntry.Name, "project": project})
 
 		// Create a unique temporary run directory for this pipeline execution so that
 		// each run is isolated and cannot interfere with concurrent or previous runs.
 		runDir, mkErr := os.MkdirTemp(pipelineDir, sanitizedName+"-run-")
 		if mkErr != nil {
-			fmt.Printf("Warning: failed to create pipeline run directory: %v\n", mkErr)
+			slog.ErrorContext(ctx, "failed to create pipeline run directory", "pipeline", pipelineID, "err", mkErr)
+			pipelineRuns.Inc(ledgerEntry.Name, outcomeLabel(false))
 			// Without an isolated run directory the isolation guarantee cannot be met,
 			// so fail the pipeline immediately and update the ledger accordingly.
-			if updatedEntry, getErr := service_ledger.GetPipelineEntry(pipelineID); getErr == nil && updatedEntry != nil {
+			if updatedEntry, getErr := service_ledger.GetPipelineEntry(key); getErr == nil && updatedEntry != nil {
 				_ = service_ledger.UpdatePipelineEntry(
-					pipelineID,
+					key,
 					updatedEntry.Name,
 					updatedEntry.Description,
 					updatedEntry.Code,
@@ -648,6 +705,7 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 					updatedEntry.CreatedAt,
 				)
 			}
+			events.Publish(events.PipelineFinished, map[string]any{"id": pipelineID, "name": ledgerEntry.Name, "project": project, "status": "failed"})
 			return
 		}
 
@@ -670,15 +728,18 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 
 		// Store the command in the map so it can be stopped
 		pipelineMutex.Lock()
-		pipelineProcesses[pipelineID] = cmd
+		pipelineProcesses[key] = cmd
 		pipelineMutex.Unlock()
 
 		// Execute the pipeline
+		runStart := time.Now()
 		err := cmd.Run()
+		runDuration := time.Since(runStart)
+		recordPipelineRun(ledgerEntry.Name, err == nil, runDuration)
 
 		// Remove from running processes
 		pipelineMutex.Lock()
-		delete(pipelineProcesses, pipelineID)
+		delete(pipelineProcesses, key)
 		pipelineMutex.Unlock()
 
 		// Determine status
@@ -688,9 +749,8 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Create log directory
-		logDir := filepath.Join(home, ".opencloud", "logs", "pipelines")
 		if mkErr := os.MkdirAll(logDir, 0755); mkErr != nil {
-			fmt.Printf("Warning: failed to create log directory: %v\n", mkErr)
+			slog.WarnContext(ctx, "failed to create log directory", "err", mkErr)
 		}
 
 		// Create log file
@@ -698,7 +758,7 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 		logFilePath := filepath.Join(logDir, logFileName)
 		logFile, fileErr := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if fileErr != nil {
-			fmt.Printf("Warning: failed to open log file: %v\n", fileErr)
+			slog.WarnContext(ctx, "failed to open pipeline log", "err", fileErr)
 		} else {
 			defer logFile.Close()
 		}
@@ -715,15 +775,15 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 		// Write to log file
 		if logFile != nil {
 			if _, writeErr := logFile.WriteString(logEntry); writeErr != nil {
-				fmt.Printf("Warning: failed to write log file: %v\n", writeErr)
+				slog.WarnContext(ctx, "failed to write pipeline log", "err", writeErr)
 			}
 		}
 
 		// Update pipeline status to final status
-		updatedEntry, err := service_ledger.GetPipelineEntry(pipelineID)
+		updatedEntry, err := service_ledger.GetPipelineEntry(key)
 		if err == nil && updatedEntry != nil {
 			if err := service_ledger.UpdatePipelineEntry(
-				pipelineID,
+				key,
 				updatedEntry.Name,
 				updatedEntry.Description,
 				updatedEntry.Code,
@@ -731,10 +791,34 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 				status,
 				updatedEntry.CreatedAt,
 			); err != nil {
-				fmt.Printf("Warning: Failed to update pipeline status: %v\n", err)
+				slog.WarnContext(ctx, "failed to update pipeline status", "pipeline", pipelineID, "err", err)
 			}
 		}
-	}()
+
+		slog.InfoContext(ctx, "pipeline finished", "pipeline", pipelineID, "status", status, "duration", runDuration)
+		events.Publish(events.PipelineFinished, map[string]any{
+			"id":         pipelineID,
+			"name":       ledgerEntry.Name,
+			"project":    project,
+			"status":     status,
+			"durationMs": runDuration.Milliseconds(),
+		})
+	})
+	if !started {
+		if err := service_ledger.UpdatePipelineEntry(
+			key,
+			ledgerEntry.Name,
+			ledgerEntry.Description,
+			ledgerEntry.Code,
+			ledgerEntry.Branch,
+			ledgerEntry.Status,
+			ledgerEntry.CreatedAt,
+		); err != nil {
+			slog.WarnContext(r.Context(), "failed to update pipeline status", "pipeline", pipelineID, "err", err)
+		}
+		apierror.Respond(w, r, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
 
 	// Return success immediately (pipeline runs in background)
 	w.Header().Set("Content-Type", "application/json")
@@ -744,10 +828,20 @@ func RunPipeline(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// pipelineLogDir returns the directory holding the run logs of the pipelines
+// of project.
+func pipelineLogDir(project string) (string, error) {
+	logsDir, err := utils.ProjectDir(project, utils.Logs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(logsDir, "pipelines"), nil
+}
+
 // GetPipelineLogs retrieves execution logs for a pipeline
 func GetPipelineLogs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -755,31 +849,32 @@ func GetPipelineLogs(w http.ResponseWriter, r *http.Request) {
 	// URL format: /get-pipeline-logs/{id}
 	pipelineID := strings.TrimPrefix(r.URL.Path, "/get-pipeline-logs/")
 	if pipelineID == "" {
-		http.Error(w, "Pipeline ID is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline ID is required")
 		return
 	}
+	project := RequestProject(r.Context())
+	key := pipelineKey(project, pipelineID)
 
 	// Get pipeline entry from service ledger
-	ledgerEntry, err := service_ledger.GetPipelineEntry(pipelineID)
+	ledgerEntry, err := service_ledger.GetPipelineEntry(key)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve pipeline: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to retrieve pipeline")
 		return
 	}
 
 	if ledgerEntry == nil {
-		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Pipeline not found")
 		return
 	}
 
-	// Get home directory
-	home, err := os.UserHomeDir()
+	// Get log directory
+	logDir, err := pipelineLogDir(project)
 	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve log directory"))
 		return
 	}
 
 	// Construct path to log file
-	logDir := filepath.Join(home, ".opencloud", "logs", "pipelines")
 	sanitizedName := sanitizePipelineName(ledgerEntry.Name)
 	logFileName := sanitizedName + ".log"
 	logFilePath := filepath.Join(logDir, logFileName)
@@ -795,7 +890,7 @@ func GetPipelineLogs(w http.ResponseWriter, r *http.Request) {
 	// Read and parse log file
 	file, err := os.Open(logFilePath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to open log file: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to open log file")
 		return
 	}
 	defer file.Close()
@@ -852,7 +947,7 @@ func GetPipelineLogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to read log file: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to read log file")
 		return
 	}
 
@@ -863,7 +958,7 @@ func GetPipelineLogs(w http.ResponseWriter, r *http.Request) {
 // StopPipeline stops a running pipeline
 func StopPipeline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -871,34 +966,36 @@ func StopPipeline(w http.ResponseWriter, r *http.Request) {
 	// URL format: /stop-pipeline/{id}
 	pipelineID := strings.TrimPrefix(r.URL.Path, "/stop-pipeline/")
 	if pipelineID == "" {
-		http.Error(w, "Pipeline ID is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline ID is required")
 		return
 	}
+	project := RequestProject(r.Context())
+	key := pipelineKey(project, pipelineID)
 
 	// Get the running process
 	pipelineMutex.Lock()
-	cmd, exists := pipelineProcesses[pipelineID]
+	cmd, exists := pipelineProcesses[key]
 	if exists {
-		delete(pipelineProcesses, pipelineID)
+		delete(pipelineProcesses, key)
 	}
 	pipelineMutex.Unlock()
 
 	if !exists || cmd.Process == nil {
-		http.Error(w, "Pipeline is not running", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Pipeline is not running")
 		return
 	}
 
 	// Kill the process
 	if err := cmd.Process.Kill(); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to stop pipeline: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to stop pipeline")
 		return
 	}
 
 	// Update status to "idle"
-	ledgerEntry, err := service_ledger.GetPipelineEntry(pipelineID)
+	ledgerEntry, err := service_ledger.GetPipelineEntry(key)
 	if err == nil && ledgerEntry != nil {
 		if err := service_ledger.UpdatePipelineEntry(
-			pipelineID,
+			key,
 			ledgerEntry.Name,
 			ledgerEntry.Description,
 			ledgerEntry.Code,
@@ -906,7 +1003,7 @@ func StopPipeline(w http.ResponseWriter, r *http.Request) {
 			"idle",
 			ledgerEntry.CreatedAt,
 		); err != nil {
-			fmt.Printf("Warning: Failed to update pipeline status: %v\n", err)
+			slog.WarnContext(r.Context(), "failed to update pipeline status", "pipeline", pipelineID, "err", err)
 		}
 	}
 
@@ -6,7 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
@@ -14,6 +14,10 @@ import (
 	"time"
 
 	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/api/listing"
+	"github.com/WavexSoftware/OpenCloud/utils"
 	"github.com/containers/podman/v5/pkg/bindings"
 	"github.com/containers/podman/v5/pkg/bindings/containers"
 	"github.com/containers/podman/v5/pkg/bindings/images"
@@ -45,29 +49,105 @@ var (
 
 type ContainerInfo = opencloudapi.ContainerInfo
 
-// GetContainers lists all containers from Podman and returns their state along
-// with common runtime metrics such as memory usage and the host PID of the main
-// container process.
+// containerName returns the first name of a container, without the leading
+// slash some Podman versions add.
+func containerName(c ContainerInfo) string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// containerListing describes the list parameters of GetContainers.  The
+// default order, newest first, is the one of "podman ps".
+var containerListing = listing.Spec[ContainerInfo]{
+	Key: func(c ContainerInfo) string { return c.ID },
+	Sorts: map[string]listing.Field[ContainerInfo]{
+		"name":    {String: containerName},
+		"created": {Int: func(c ContainerInfo) int64 { return c.Created }},
+		"state":   {String: func(c ContainerInfo) string { return c.State }},
+		"image":   {String: func(c ContainerInfo) string { return c.Image }},
+	},
+	DefaultSort: "-created",
+	Filters: map[string]listing.Filter[ContainerInfo]{
+		"state":  listing.Equal(func(c ContainerInfo) string { return c.State }),
+		"label":  listing.Label(func(c ContainerInfo) map[string]string { return c.Labels }),
+		"prefix": listing.Prefix(containerName),
+	},
+}
+
+// containerProjectOf returns the project of a container; it is replaced in
+// tests to avoid requiring a live Podman daemon.
+var containerProjectOf = podmanContainerProject
+
+// podmanContainerProject inspects a container for its project label.
+func podmanContainerProject(conn context.Context, nameOrID string) (string, error) {
+	data, err := containers.Inspect(conn, nameOrID, nil)
+	if err != nil {
+		return "", err
+	}
+	if data.Config == nil {
+		return utils.DefaultProject, nil
+	}
+	return opencloudapi.ContainerProject(data.Config.Labels), nil
+}
+
+// checkContainerProject answers 404 and returns false unless the container
+// belongs to the request's project.  Container names are unique across
+// projects, as Podman has no notion of them.
+func checkContainerProject(w http.ResponseWriter, r *http.Request, project string) bool {
+	if project != opencloudapi.RequestProject(r.Context()) {
+		apierror.Respond(w, r, http.StatusNotFound, "Container not found")
+		return false
+	}
+	return true
+}
+
+// lookupContainerProject looks up the project of a container and calls
+// checkContainerProject.
+func lookupContainerProject(w http.ResponseWriter, r *http.Request, conn context.Context, nameOrID string) bool {
+	project, err := containerProjectOf(conn, nameOrID)
+	if err != nil {
+		apierror.RespondError(w, r, err, "Failed to inspect container")
+		return false
+	}
+	return checkContainerProject(w, r, project)
+}
+
+// GetContainers lists the containers of the request's project from Podman and
+// returns their state along with common runtime metrics such as memory usage
+// and the host PID of the main container process.  It takes the list
+// parameters of containerListing.
 func GetContainers(w http.ResponseWriter, r *http.Request) {
+	q, apiErr := containerListing.Parse(r.URL.Query())
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	conn, err := getContainersConnection(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
 		return
 	}
 
 	containerList, err := listPodmanContainers(conn, new(containers.ListOptions).WithAll(true).WithSync(true))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to list containers: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to list containers")
 		return
 	}
 
 	// Initialize to an empty slice so JSON encodes as [] rather than null
 	// when no containers are present.
 	result := make([]opencloudapi.ContainerInfo, 0, len(containerList))
+	project := opencloudapi.RequestProject(r.Context())
 	for _, ctr := range containerList {
+		if opencloudapi.ContainerProject(ctr.Labels) != project {
+			continue
+		}
 		names := append([]string(nil), ctr.Names...)
 		if len(names) == 0 {
 			names = []string{ctr.ID}
@@ -88,17 +168,21 @@ func GetContainers(w http.ResponseWriter, r *http.Request) {
 			Labels:  ctr.Labels,
 			PID:     pid,
 		}
+		result = append(result, ci)
+	}
 
-		if ci.PID > 0 {
-			ci.MemoryUsageBytes = containerMemoryUsageBytes(ci.PID)
+	// Memory usage is read from /proc, so only for the containers returned.
+	result, next := containerListing.Apply(q, result)
+	for i := range result {
+		if result[i].PID > 0 {
+			result[i].MemoryUsageBytes = containerMemoryUsageBytes(result[i].PID)
 		}
-
-		result = append(result, ci)
 	}
 
+	listing.SetNextCursor(w, next)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(result); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "")
 		return
 	}
 }
@@ -112,7 +196,7 @@ type DeleteContainerRequest struct {
 // requests with a JSON body containing the containerId to delete.
 func DeleteContainer(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -120,13 +204,13 @@ func DeleteContainer(w http.ResponseWriter, r *http.Request) {
 
 	var req DeleteContainerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
 	req.ContainerID = strings.TrimSpace(req.ContainerID)
 	if req.ContainerID == "" {
-		http.Error(w, "containerId is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "containerId is required")
 		return
 	}
 
@@ -135,14 +219,18 @@ func DeleteContainer(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := deleteContainerConnection(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
+		return
+	}
+	if !lookupContainerProject(w, r, conn, req.ContainerID) {
 		return
 	}
 
 	if _, err := removePodmanContainer(conn, req.ContainerID, new(containers.RemoveOptions).WithForce(true)); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to delete container: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to delete container")
 		return
 	}
+	events.Publish(events.ContainerRemoved, map[string]any{"containerId": req.ContainerID, "project": opencloudapi.RequestProject(r.Context())})
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{
@@ -155,21 +243,21 @@ func DeleteContainer(w http.ResponseWriter, r *http.Request) {
 // /containers/{containerId}/{action}.
 func ContainerAction(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	path := strings.TrimPrefix(r.URL.Path, "/containers/")
 	parts := strings.Split(path, "/")
 	if len(parts) != 2 {
-		http.Error(w, "container ID and action are required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "container ID and action are required")
 		return
 	}
 
 	containerID := strings.TrimSpace(parts[0])
 	action := strings.TrimSpace(parts[1])
 	if containerID == "" || action == "" {
-		http.Error(w, "container ID and action are required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "container ID and action are required")
 		return
 	}
 
@@ -187,7 +275,7 @@ func ContainerAction(w http.ResponseWriter, r *http.Request) {
 			return stopPodmanContainer(ctx, id, nil)
 		}
 	default:
-		http.Error(w, "Unsupported container action", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Unsupported container action")
 		return
 	}
 
@@ -196,14 +284,22 @@ func ContainerAction(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := containerActionConnection(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
+		return
+	}
+	if !lookupContainerProject(w, r, conn, containerID) {
 		return
 	}
 
 	if err := performAction(conn, containerID); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to %s container: %v", action, err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, fmt.Sprintf("Failed to %s container", action))
 		return
 	}
+	eventType := events.ContainerStarted
+	if action == "stop" {
+		eventType = events.ContainerStopped
+	}
+	events.Publish(eventType, map[string]any{"containerId": containerID, "project": opencloudapi.RequestProject(r.Context())})
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{
@@ -250,13 +346,13 @@ type ContainerDetail struct {
 // Route: GET /get-container?id=<containerId>
 func GetContainer(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	containerID := strings.TrimSpace(r.URL.Query().Get("id"))
 	if containerID == "" {
-		http.Error(w, "id query parameter is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "id query parameter is required")
 		return
 	}
 
@@ -265,13 +361,20 @@ func GetContainer(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := getContainerConnection(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
 		return
 	}
 
 	data, err := inspectPodmanContainer(conn, containerID, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to inspect container: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to inspect container")
+		return
+	}
+	project := utils.DefaultProject
+	if data.Config != nil {
+		project = opencloudapi.ContainerProject(data.Config.Labels)
+	}
+	if !checkContainerProject(w, r, project) {
 		return
 	}
 
@@ -448,7 +551,7 @@ func GetContainer(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(detail); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "")
 	}
 }
 
@@ -461,13 +564,13 @@ func GetContainer(w http.ResponseWriter, r *http.Request) {
 // (default 100, max 1000). A value of "all" returns all available log lines.
 func GetContainerLogs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	containerID := strings.TrimSpace(r.URL.Query().Get("id"))
 	if containerID == "" {
-		http.Error(w, "id query parameter is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "id query parameter is required")
 		return
 	}
 
@@ -478,7 +581,7 @@ func GetContainerLogs(w http.ResponseWriter, r *http.Request) {
 		} else {
 			n, err := strconv.Atoi(t)
 			if err != nil || n < 1 || n > 1000 {
-				http.Error(w, "tail must be a positive integer up to 1000 or 'all'", http.StatusBadRequest)
+				apierror.Respond(w, r, http.StatusBadRequest, "tail must be a positive integer up to 1000 or 'all'")
 				return
 			}
 			tail = strconv.Itoa(n)
@@ -490,7 +593,10 @@ func GetContainerLogs(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := containerLogsConnection(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
+		return
+	}
+	if !lookupContainerProject(w, r, conn, containerID) {
 		return
 	}
 
@@ -534,7 +640,7 @@ func GetContainerLogs(w http.ResponseWriter, r *http.Request) {
 
 	<-done
 	if logErr != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve container logs: %v", logErr), http.StatusInternalServerError)
+		apierror.RespondError(w, r, logErr, "Failed to retrieve container logs")
 		return
 	}
 
@@ -1135,7 +1241,7 @@ func parsePortMapping(mapping string) (nettypes.PortMapping, error) {
 // PullAndRunRequest and returns the new container ID on success.
 func PullAndRun(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -1143,21 +1249,18 @@ func PullAndRun(w http.ResponseWriter, r *http.Request) {
 
 	var req PullAndRunRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
-	fmt.Printf("PullAndRun raw request from frontend: %+v\n", req)
-	fmt.Printf("PullAndRun frontend image=%q name=%q command=%q restartPolicy=%q autoRemove=%v\n",
-		req.Image, req.Name, req.Command, req.RestartPolicy, req.AutoRemove)
-	fmt.Printf("PullAndRun frontend ports=%v\n", req.Ports)
-	fmt.Printf("PullAndRun frontend env=%v\n", req.Env)
-	fmt.Printf("PullAndRun frontend volumes=%v\n", req.Volumes)
+	// Environment values are left out because they often hold secrets.
+	slog.DebugContext(r.Context(), "PullAndRun request", "image", req.Image, "name", req.Name, "command", req.Command,
+		"restart_policy", req.RestartPolicy, "auto_remove", req.AutoRemove, "ports", req.Ports, "volumes", req.Volumes)
 
 	// If the caller supplied a fully custom command string, parse it into individual
 	// fields so that the rest of the handler can proceed unchanged.
 	if err := applyFullCustomCommand(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -1165,106 +1268,97 @@ func PullAndRun(w http.ResponseWriter, r *http.Request) {
 	req.Name = strings.TrimSpace(req.Name)
 
 	if req.Image == "" {
-		http.Error(w, "image is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "image is required")
 		return
 	}
 
 	// Validate the image name to prevent command injection or path traversal.
 	if errMsg := opencloudapi.ValidateImageName(req.Image); errMsg != "" {
-		http.Error(w, errMsg, http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 		return
 	}
 
 	// Validate the optional container name.
 	if req.Name != "" {
 		if errMsg := validateContainerName(req.Name); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	// Validate port mappings.
 	for _, port := range req.Ports {
-		fmt.Printf("Validating port mapping from frontend: %q\n", port)
 		if errMsg := validatePortMapping(port); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	// Validate volume mounts for path traversal.
 	for _, vol := range req.Volumes {
-		fmt.Printf("Validating volume mount from frontend: %q\n", vol)
 		if errMsg := validateVolumeMount(vol); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	// Validate restart policy when explicitly provided.
 	if req.RestartPolicy != "" && !validRestartPolicies[req.RestartPolicy] {
-		http.Error(w, "invalid restart policy: must be one of no, always, on-failure, unless-stopped", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid restart policy: must be one of no, always, on-failure, unless-stopped")
 		return
 	}
 
 	// autoRemove conflicts with any restart policy other than "no" because the
 	// container runtime cannot both remove the container on exit and restart it.
 	if req.AutoRemove && req.RestartPolicy != "" && req.RestartPolicy != "no" {
-		http.Error(w, "autoRemove cannot be used with a restart policy other than 'no'", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "autoRemove cannot be used with a restart policy other than 'no'")
 		return
 	}
 
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
-	fmt.Printf("PullAndRun using Podman socket: %s\n", socket)
 
 	ctx, cancel := context.WithTimeout(r.Context(), opencloudapi.BuildTimeout)
 	defer cancel()
 
 	conn, err := bindings.NewConnection(ctx, socket)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman socket %q: %v", socket, err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, fmt.Sprintf("Failed to connect to Podman socket %q", socket)))
 		return
 	}
-	fmt.Println("PullAndRun connected to Podman successfully")
 
 	imageRef, err := ensurePodmanImage(conn, req.Image)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to resolve image %q: %v", req.Image, err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, fmt.Sprintf("Failed to resolve image %q", req.Image))
 		return
 	}
-	fmt.Printf("PullAndRun resolved imageRef: %q\n", imageRef)
 
 	// Build the unique container ID from the requested name (or a timestamp fallback).
 	containerID := req.Name
 	if containerID == "" {
 		containerID = fmt.Sprintf("opencloud-%d", time.Now().UnixNano())
 	}
-	fmt.Printf("PullAndRun containerID: %q\n", containerID)
 
 	namedVolumes, mounts := parseVolumeStrings(req.Volumes)
-	fmt.Printf("PullAndRun namedVolumes: %+v\n", namedVolumes)
-	fmt.Printf("PullAndRun bindMounts: %+v\n", mounts)
 
 	var portMappings []nettypes.PortMapping
 	for _, mapping := range req.Ports {
 		portMapping, err := parsePortMapping(mapping)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
-		fmt.Printf("Parsed port mapping from %q -> %+v\n", mapping, portMapping)
 		portMappings = append(portMappings, portMapping)
 	}
 
 	envMap := envListToMap(req.Env)
-	fmt.Printf("Parsed env map: %+v\n", envMap)
 
 	labels := map[string]string{
-		"opencloud/name": containerID,
+		"opencloud/name":          containerID,
+		opencloudapi.ProjectLabel: opencloudapi.RequestProject(r.Context()),
 	}
 	if req.RestartPolicy != "" {
 		labels["opencloud/restart-policy"] = req.RestartPolicy
@@ -1280,7 +1374,6 @@ func PullAndRun(w http.ResponseWriter, r *http.Request) {
 	if len(req.Volumes) > 0 {
 		labels["opencloud/volumes"] = strings.Join(req.Volumes, "\n")
 	}
-	fmt.Printf("Container labels: %+v\n", labels)
 
 	spec := specgen.NewSpecGenerator(imageRef, false)
 	spec.Name = containerID
@@ -1298,30 +1391,22 @@ func PullAndRun(w http.ResponseWriter, r *http.Request) {
 		spec.Command = strings.Fields(req.Command)
 	}
 
-	fmt.Printf("Final spec.Name: %q\n", spec.Name)
-	fmt.Printf("Final spec.Image: %q\n", imageRef)
-	fmt.Printf("Final spec.NetNS: %+v\n", spec.NetNS)
-	fmt.Printf("Final spec.Env: %+v\n", spec.Env)
-	fmt.Printf("Final spec.Mounts: %+v\n", spec.Mounts)
-	fmt.Printf("Final spec.PortMappings: %+v\n", spec.PortMappings)
-	fmt.Printf("Final spec.RestartPolicy: %q\n", spec.RestartPolicy)
-	fmt.Printf("Final spec.Remove: %+v\n", spec.Remove)
-	fmt.Printf("Final spec.Command: %+v\n", spec.Command)
-	fmt.Printf("Final spec.Entrypoint: %+v\n", spec.Entrypoint)
+	slog.DebugContext(r.Context(), "creating container", "name", spec.Name, "image", imageRef, "socket", socket,
+		"port_mappings", spec.PortMappings, "mounts", spec.Mounts, "volumes", spec.Volumes, "labels", labels)
 
 	createResponse, err := containers.CreateWithSpec(conn, spec, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create container: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to create container")
 		return
 	}
-	fmt.Printf("Container created successfully: ID=%s\n", createResponse.ID)
 
 	if err := containers.Start(conn, createResponse.ID, nil); err != nil {
 		_, _ = containers.Remove(conn, createResponse.ID, new(containers.RemoveOptions).WithForce(true).WithIgnore(true))
-		http.Error(w, fmt.Sprintf("Failed to start container: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to start container")
 		return
 	}
-	fmt.Printf("Container started successfully: ID=%s\n", createResponse.ID)
+	slog.InfoContext(r.Context(), "container started", "container", createResponse.ID, "name", containerID, "image", imageRef)
+	publishContainerRun(createResponse.ID, containerID, imageRef, opencloudapi.RequestProject(r.Context()))
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{
@@ -1332,6 +1417,13 @@ func PullAndRun(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// publishContainerRun announces a container of project created from image
+// and started.
+func publishContainerRun(id, name, image, project string) {
+	events.Publish(events.ContainerCreated, map[string]any{"containerId": id, "name": name, "image": image, "project": project})
+	events.Publish(events.ContainerStarted, map[string]any{"containerId": id, "project": project})
+}
+
 // pullProgressEvent mirrors Docker's JSON progress protocol as emitted by
 // Podman's progress writer during an image pull.
 type pullProgressEvent struct {
@@ -1357,10 +1449,10 @@ type pullProgressEvent struct {
 //
 //	On error:
 //	event: error
-//	data: <error message>
+//	data: {"code":"...","message":"...","requestId":"..."}
 func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -1368,7 +1460,7 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 
 	var req PullAndRunRequest
 	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
@@ -1378,61 +1470,61 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 	// If the caller supplied a fully custom command string, parse it into individual
 	// fields so that the rest of the handler can proceed unchanged.
 	if err := applyFullCustomCommand(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if req.Image == "" {
-		http.Error(w, "image is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "image is required")
 		return
 	}
 
 	if errMsg := opencloudapi.ValidateImageName(req.Image); errMsg != "" {
-		http.Error(w, errMsg, http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 		return
 	}
 
 	if req.Name != "" {
 		if errMsg := validateContainerName(req.Name); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	for _, port := range req.Ports {
 		if errMsg := validatePortMapping(port); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	for _, vol := range req.Volumes {
 		if errMsg := validateVolumeMount(vol); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	if req.RestartPolicy != "" && !validRestartPolicies[req.RestartPolicy] {
-		http.Error(w, "invalid restart policy: must be one of no, always, on-failure, unless-stopped", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid restart policy: must be one of no, always, on-failure, unless-stopped")
 		return
 	}
 
 	if req.AutoRemove && req.RestartPolicy != "" && req.RestartPolicy != "no" {
-		http.Error(w, "autoRemove cannot be used with a restart policy other than 'no'", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "autoRemove cannot be used with a restart policy other than 'no'")
 		return
 	}
 
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
 
 	// Upgrade the connection to SSE before any long-running operations.
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		apierror.Respond(w, r, http.StatusInternalServerError, "Streaming not supported")
 		return
 	}
 
@@ -1444,9 +1536,8 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "data: %s\n\n", line)
 		flusher.Flush()
 	}
-	sendError := func(msg string) {
-		fmt.Fprintf(w, "event: error\ndata: %s\n\n", msg)
-		flusher.Flush()
+	sendError := func(e *apierror.Error) {
+		apierror.WriteEvent(w, r, e)
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), opencloudapi.BuildTimeout)
@@ -1454,7 +1545,7 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := bindings.NewConnection(ctx, socket)
 	if err != nil {
-		sendError(fmt.Sprintf("Failed to connect to Podman: %v", err))
+		sendError(apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
 		return
 	}
 
@@ -1492,7 +1583,7 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 			var event pullProgressEvent
 			if json.Unmarshal([]byte(raw), &event) == nil {
 				if event.Error != "" {
-					sendError(event.Error)
+					sendError(apierror.New(http.StatusInternalServerError, event.Error).WithCode(apierror.CodePodmanError))
 					return
 				}
 				msg := strings.TrimSpace(event.Stream)
@@ -1514,7 +1605,7 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := <-pullErr; err != nil {
-			sendError(fmt.Sprintf("Failed to pull image %q: %v", imageRef, err))
+			sendError(apierror.FromError(err, fmt.Sprintf("Failed to pull image %q", imageRef)))
 			return
 		}
 	}
@@ -1531,7 +1622,7 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 	for _, mapping := range req.Ports {
 		pm, err := parsePortMapping(mapping)
 		if err != nil {
-			sendError(err.Error())
+			sendError(apierror.New(http.StatusBadRequest, err.Error()))
 			return
 		}
 		portMappings = append(portMappings, pm)
@@ -1540,7 +1631,8 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 	envMap := envListToMap(req.Env)
 
 	labels := map[string]string{
-		"opencloud/name": containerID,
+		"opencloud/name":          containerID,
+		opencloudapi.ProjectLabel: opencloudapi.RequestProject(r.Context()),
 	}
 	if req.RestartPolicy != "" {
 		labels["opencloud/restart-policy"] = req.RestartPolicy
@@ -1576,7 +1668,7 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 
 	createResponse, err := containers.CreateWithSpec(conn, spec, nil)
 	if err != nil {
-		sendError(fmt.Sprintf("Failed to create container: %v", err))
+		sendError(apierror.FromError(err, "Failed to create container"))
 		return
 	}
 
@@ -1584,9 +1676,10 @@ func PullAndRunStream(w http.ResponseWriter, r *http.Request) {
 
 	if err := containers.Start(conn, createResponse.ID, nil); err != nil {
 		_, _ = containers.Remove(conn, createResponse.ID, new(containers.RemoveOptions).WithForce(true).WithIgnore(true))
-		sendError(fmt.Sprintf("Failed to start container: %v", err))
+		sendError(apierror.FromError(err, "Failed to start container"))
 		return
 	}
+	publishContainerRun(createResponse.ID, containerID, imageRef, opencloudapi.RequestProject(r.Context()))
 
 	donePayload, _ := json.Marshal(map[string]string{
 		"status":      "success",
@@ -1627,7 +1720,7 @@ type UpdateContainerRequest struct {
 // Route: POST /update-container
 func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -1635,7 +1728,7 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 
 	var req UpdateContainerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
@@ -1644,48 +1737,48 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 	req.Name = strings.TrimSpace(req.Name)
 
 	if req.ContainerID == "" {
-		http.Error(w, "containerId is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "containerId is required")
 		return
 	}
 
 	if req.Image == "" {
-		http.Error(w, "image is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "image is required")
 		return
 	}
 
 	if errMsg := opencloudapi.ValidateImageName(req.Image); errMsg != "" {
-		http.Error(w, errMsg, http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 		return
 	}
 
 	if req.Name != "" {
 		if errMsg := validateContainerName(req.Name); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	for _, port := range req.Ports {
 		if errMsg := validatePortMapping(port); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	for _, vol := range req.Volumes {
 		if errMsg := validateVolumeMount(vol); errMsg != "" {
-			http.Error(w, errMsg, http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 			return
 		}
 	}
 
 	if req.RestartPolicy != "" && !validRestartPolicies[req.RestartPolicy] {
-		http.Error(w, "invalid restart policy: must be one of no, always, on-failure, unless-stopped", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid restart policy: must be one of no, always, on-failure, unless-stopped")
 		return
 	}
 
 	if req.AutoRemove && req.RestartPolicy != "" && req.RestartPolicy != "no" {
-		http.Error(w, "autoRemove cannot be used with a restart policy other than 'no'", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "autoRemove cannot be used with a restart policy other than 'no'")
 		return
 	}
 
@@ -1694,14 +1787,21 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := updateContainerConnection(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
 		return
 	}
 
 	// Inspect the existing container to check its current state.
 	data, err := updateContainerInspect(conn, req.ContainerID, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to inspect container %q: %v", req.ContainerID, err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, fmt.Sprintf("Failed to inspect container %q", req.ContainerID))
+		return
+	}
+	project := utils.DefaultProject
+	if data.Config != nil {
+		project = opencloudapi.ContainerProject(data.Config.Labels)
+	}
+	if !checkContainerProject(w, r, project) {
 		return
 	}
 
@@ -1775,7 +1875,7 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 		// pruned between inspect and rollback).
 		resolvedOldImage, ensureErr := updateContainerEnsureImage(conn, oldImageName)
 		if ensureErr != nil {
-			log.Printf("UpdateContainer rollback: original image %q unavailable, cannot restore container %q: %v", oldImageName, oldName, ensureErr)
+			slog.ErrorContext(r.Context(), "UpdateContainer rollback: original image unavailable, cannot restore container", "image", oldImageName, "name", oldName, "err", ensureErr)
 			return
 		}
 
@@ -1784,7 +1884,7 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 		for _, p := range oldPortStrings {
 			pm, parseErr := parsePortMapping(p)
 			if parseErr != nil {
-				log.Printf("UpdateContainer rollback: skipping unparseable port %q: %v", p, parseErr)
+				slog.WarnContext(r.Context(), "UpdateContainer rollback: skipping unparseable port", "port", p, "err", parseErr)
 				continue
 			}
 			oldPortMappings = append(oldPortMappings, pm)
@@ -1808,13 +1908,13 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 
 		createResp, createErr := updateContainerCreateWithSpec(conn, oldSpec, nil)
 		if createErr != nil {
-			log.Printf("UpdateContainer rollback: failed to recreate original container %q: %v", oldName, createErr)
+			slog.ErrorContext(r.Context(), "UpdateContainer rollback: failed to recreate original container", "name", oldName, "err", createErr)
 			return
 		}
 
 		if oldWasRunning {
 			if startErr := updateContainerStart(conn, createResp.ID, nil); startErr != nil {
-				log.Printf("UpdateContainer rollback: failed to start recreated container %q: %v", createResp.ID, startErr)
+				slog.ErrorContext(r.Context(), "UpdateContainer rollback: failed to start recreated container", "container", createResp.ID, "err", startErr)
 				_, _ = updateContainerRemove(conn, createResp.ID, new(containers.RemoveOptions).WithForce(true).WithIgnore(true))
 			}
 		}
@@ -1826,7 +1926,7 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 	// call uses --force which kills and removes in one shot regardless of state.
 	if data.State != nil && data.State.Status == "running" {
 		if err := updateContainerStop(conn, canonicalID, nil); err != nil {
-			log.Printf("UpdateContainer: non-fatal stop error for %s (proceeding to force remove): %v", canonicalID, err)
+			slog.WarnContext(r.Context(), "UpdateContainer: stop failed, proceeding to force remove", "container", canonicalID, "err", err)
 		}
 	}
 
@@ -1834,18 +1934,18 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 	// WithIgnore(true) suppresses "not found" errors so we tolerate a container
 	// that disappeared between inspect and remove.
 	if reports, err := updateContainerRemove(conn, canonicalID, new(containers.RemoveOptions).WithForce(true).WithIgnore(true)); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to remove container %q: %v", canonicalID, err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, fmt.Sprintf("Failed to remove container %q", canonicalID))
 		return
 	} else if len(reports) > 0 && reports[0].Err != nil {
 		// A non-fatal per-container error (e.g. already removed) – log and continue.
-		log.Printf("UpdateContainer: non-fatal remove error for %s: %v", canonicalID, reports[0].Err)
+		slog.WarnContext(r.Context(), "UpdateContainer: remove failed", "container", canonicalID, "err", reports[0].Err)
 	}
 
 	// Resolve the image reference, pulling if necessary.
 	imageRef, err := updateContainerEnsureImage(conn, req.Image)
 	if err != nil {
 		rollbackOldContainer()
-		http.Error(w, fmt.Sprintf("Failed to resolve image %q: %v", req.Image, err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, fmt.Sprintf("Failed to resolve image %q", req.Image))
 		return
 	}
 
@@ -1861,7 +1961,7 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 	for _, mapping := range req.Ports {
 		pm, err := parsePortMapping(mapping)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 		portMappings = append(portMappings, pm)
@@ -1870,7 +1970,8 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 	envMap := envListToMap(req.Env)
 
 	labels := map[string]string{
-		"opencloud/name": containerName,
+		"opencloud/name":          containerName,
+		opencloudapi.ProjectLabel: opencloudapi.RequestProject(r.Context()),
 	}
 	if req.RestartPolicy != "" {
 		labels["opencloud/restart-policy"] = req.RestartPolicy
@@ -1909,16 +2010,18 @@ func UpdateContainer(w http.ResponseWriter, r *http.Request) {
 	createResponse, err := updateContainerCreateWithSpec(conn, spec, nil)
 	if err != nil {
 		rollbackOldContainer()
-		http.Error(w, fmt.Sprintf("Failed to create container: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to create container")
 		return
 	}
 
 	if err := updateContainerStart(conn, createResponse.ID, nil); err != nil {
 		_, _ = updateContainerRemove(conn, createResponse.ID, new(containers.RemoveOptions).WithForce(true).WithIgnore(true))
 		rollbackOldContainer()
-		http.Error(w, fmt.Sprintf("Failed to start container: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to start container")
 		return
 	}
+	events.Publish(events.ContainerRemoved, map[string]any{"containerId": canonicalID, "project": project})
+	publishContainerRun(createResponse.ID, containerName, imageRef, opencloudapi.RequestProject(r.Context()))
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{
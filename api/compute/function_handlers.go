@@ -3,8 +3,10 @@ package compute
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
@@ -12,7 +14,12 @@ import (
 	"strings"
 	"time"
 
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/api/listing"
 	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
 )
 
 type FunctionItem struct {
@@ -57,22 +64,52 @@ func detectRuntime(filename string) string {
 	}
 }
 
+// functionListing describes the list parameters of ListFunctions.
+var functionListing = listing.Spec[FunctionItem]{
+	Key: func(fn FunctionItem) string { return fn.Name },
+	Sorts: map[string]listing.Field[FunctionItem]{
+		"name":        {String: func(fn FunctionItem) string { return fn.Name }},
+		"modified":    {Int: func(fn FunctionItem) int64 { return fn.LastModified.UnixNano() }},
+		"invocations": {Int: func(fn FunctionItem) int64 { return int64(fn.Invocations) }},
+		"runtime":     {String: func(fn FunctionItem) string { return fn.Runtime }},
+	},
+	DefaultSort: "name",
+	Filters: map[string]listing.Filter[FunctionItem]{
+		"runtime": listing.Equal(func(fn FunctionItem) string { return fn.Runtime }),
+		"prefix":  listing.Prefix(func(fn FunctionItem) string { return fn.Name }),
+	},
+}
+
+// ListFunctions lists the functions in the functions directory of the
+// request's project.  It takes the list parameters of functionListing.
 func ListFunctions(w http.ResponseWriter, r *http.Request) {
-	home, err := os.UserHomeDir()
-	functionDir := filepath.Join(home, ".opencloud", "functions")
+	q, apiErr := functionListing.Parse(r.URL.Query())
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	}
 
-	files, err := os.ReadDir(functionDir)
+	project := opencloudapi.RequestProject(r.Context())
+	functionDir, err := utils.ProjectDir(project, utils.Functions)
 	if err != nil {
-		http.Error(w, "Failed to read functions directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve functions directory"))
+		return
+	}
+
+	// The directory of a project is created with its first function
+	files, err := os.ReadDir(functionDir)
+	if err != nil && !os.IsNotExist(err) {
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to read functions directory"))
 		return
 	}
 
 	// Get all function entries from the service ledger
 	ledgerFunctions, err := service_ledger.GetAllFunctionEntries()
 	if err != nil {
-		fmt.Printf("Warning: Failed to read service ledger: %v\n", err)
+		slog.WarnContext(r.Context(), "failed to read service ledger", "err", err)
 		ledgerFunctions = make(map[string]service_ledger.FunctionEntry)
 	}
+	ledgerFunctions = service_ledger.ProjectEntries(ledgerFunctions, project)
 
 	var functions []FunctionItem
 
@@ -114,7 +151,9 @@ func ListFunctions(w http.ResponseWriter, r *http.Request) {
 
 		functions = append(functions, fn)
 	}
+	functions, next := functionListing.Apply(q, functions)
 
+	listing.SetNextCursor(w, next)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(functions)
 }
@@ -125,21 +164,22 @@ func InvokeFunction(w http.ResponseWriter, r *http.Request) {
 	// Parse function name from query string, e.g. ?name=hello.py
 	fnName := r.URL.Query().Get("name")
 	if fnName == "" {
-		http.Error(w, "Missing function name", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing function name")
 		return
 	}
 
 	// Locate the function file
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to resolve home directory", http.StatusInternalServerError)
+	project := opencloudapi.RequestProject(ctx)
+	fnPath, apiErr := functionPath(project, fnName)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
-	fnPath := filepath.Join(home, ".opencloud", "functions", fnName)
+	key := service_ledger.ProjectKey(project, fnName)
 
 	// Check that it exists
 	if _, err := os.Stat(fnPath); os.IsNotExist(err) {
-		http.Error(w, "Function not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Function not found")
 		return
 	}
 
@@ -159,7 +199,7 @@ func InvokeFunction(w http.ResponseWriter, r *http.Request) {
 	case "ruby":
 		cmd = exec.CommandContext(ctx, "ruby", fnPath)
 	default:
-		http.Error(w, "Unsupported runtime", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Unsupported runtime")
 		return
 	}
 
@@ -178,21 +218,13 @@ func InvokeFunction(w http.ResponseWriter, r *http.Request) {
 	cmd.Stdout = &out
 	cmd.Stderr = &stderr
 
-	err = cmd.Run()
-
-	logDir := filepath.Join(home, ".opencloud", "logs", "functions")
-	if mkErr := os.MkdirAll(logDir, 0755); mkErr != nil {
-		fmt.Printf("Warning: failed to create log directory: %v\n", mkErr)
-	}
-
-	// Change function_name.extenesion to function_name.log
-	baseName := strings.TrimSuffix(fnName, filepath.Ext(fnName))
-	logFileName := baseName + ".log"
-	logFilePath := filepath.Join(logDir, logFileName)
+	started := time.Now()
+	err := cmd.Run()
+	duration := time.Since(started)
 
-	logFile, fileErr := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	logFile, fileErr := openFunctionLog(project, fnName)
 	if fileErr != nil {
-		fmt.Printf("Warning: failed to open log file: %v\n", fileErr)
+		slog.WarnContext(r.Context(), "failed to open function log", "function", fnName, "err", fileErr)
 	} else {
 		defer logFile.Close()
 	}
@@ -208,16 +240,23 @@ func InvokeFunction(w http.ResponseWriter, r *http.Request) {
 
 	if logFile != nil {
 		if _, writeErr := logFile.WriteString(logEntry); writeErr != nil {
-			fmt.Printf("Warning: failed to write log file: %v\n", writeErr)
+			slog.WarnContext(r.Context(), "failed to write function log", "function", fnName, "err", writeErr)
 		}
 	}
 
 	// Increment the invocation count in the service ledger
-	if incrementErr := service_ledger.IncrementFunctionInvocations(fnName); incrementErr != nil {
-		fmt.Printf("Warning: failed to increment invocation count: %v\n", incrementErr)
+	if incrementErr := service_ledger.IncrementFunctionInvocations(key); incrementErr != nil {
+		slog.WarnContext(r.Context(), "failed to increment invocation count", "function", fnName, "err", incrementErr)
 	}
+	opencloudapi.RecordFunctionInvocation(key, err == nil && !hasError, duration)
+	events.Publish(events.FunctionInvoked, map[string]any{
+		"name":       fnName,
+		"project":    project,
+		"success":    err == nil && !hasError,
+		"durationMs": duration.Milliseconds(),
+	})
 
-	fmt.Print(out.String() + stderr.String())
+	slog.DebugContext(r.Context(), "function invoked", "function", fnName, "duration", duration, "output", out.String()+stderr.String())
 
 	// Send JSON response
 	resp := map[string]string{
@@ -231,63 +270,65 @@ func InvokeFunction(w http.ResponseWriter, r *http.Request) {
 func DeleteFunction(w http.ResponseWriter, r *http.Request) {
 	fnName := r.URL.Query().Get("name")
 	if fnName == "" {
-		http.Error(w, "Missing function name", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing function name")
 		return
 	}
 
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to resolve home directory", http.StatusInternalServerError)
+	project := opencloudapi.RequestProject(r.Context())
+	fnPath, apiErr := functionPath(project, fnName)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
-
-	fnPath := filepath.Join(home, ".opencloud", "functions", fnName)
+	key := service_ledger.ProjectKey(project, fnName)
 
 	if _, err := os.Stat(fnPath); os.IsNotExist(err) {
-		http.Error(w, "Function not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Function not found")
 		return
 	}
 
 	// Get function entry from service ledger to check if it has a cron trigger
-	functionEntry, err := service_ledger.GetFunctionEntry(fnName)
+	functionEntry, err := service_ledger.GetFunctionEntry(key)
 	if err != nil {
-		fmt.Printf("Warning: Failed to retrieve function entry from service ledger: %v\n", err)
+		slog.WarnContext(r.Context(), "failed to read function entry from service ledger", "function", fnName, "err", err)
 	}
 
 	// Remove the function file first
 	if err := os.Remove(fnPath); err != nil {
-		http.Error(w, "Failed to delete function: "+err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to delete function")
 		return
 	}
 
 	// After successful file deletion, remove cron job if the function has a cron trigger
 	if functionEntry != nil && functionEntry.Trigger == "cron" {
-		if err := removeCron(fnPath); err != nil {
-			fmt.Printf("Warning: Failed to remove cron job: %v\n", err)
+		if err := removeCron(project, fnPath); err != nil {
+			slog.WarnContext(r.Context(), "failed to remove cron job", "function", fnName, "err", err)
 		}
 	}
 
 	// Remove log files
-	logsDir := filepath.Join(home, ".opencloud", "logs")
-
-	// Remove execution log file (~/.opencloud/logs/functions/{baseName}.log)
-	// Strip extension from function name to match how logs are created
-	baseName := strings.TrimSuffix(fnName, filepath.Ext(fnName))
-	executionLogPath := filepath.Join(logsDir, "functions", baseName+".log")
-	if err := os.Remove(executionLogPath); err != nil && !os.IsNotExist(err) {
-		fmt.Printf("Warning: Failed to remove execution log file: %v\n", err)
-	}
+	if logDir, err := functionLogDir(project); err != nil {
+		slog.WarnContext(r.Context(), "failed to resolve log directory", "err", err)
+	} else {
+		// Remove execution log file (<logs dir>/functions/{baseName}.log)
+		// Strip extension from function name to match how logs are created
+		baseName := strings.TrimSuffix(fnName, filepath.Ext(fnName))
+		executionLogPath := filepath.Join(logDir, baseName+".log")
+		if err := os.Remove(executionLogPath); err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(r.Context(), "failed to remove execution log", "function", fnName, "err", err)
+		}
 
-	// Remove cron log file (~/.opencloud/logs/functions/{functionName}.log)
-	cronLogPath := filepath.Join(logsDir, "functions", fmt.Sprintf("%s.log", fnName))
-	if err := os.Remove(cronLogPath); err != nil && !os.IsNotExist(err) {
-		fmt.Printf("Warning: Failed to remove cron log file: %v\n", err)
+		// Remove cron log file (<logs dir>/functions/{functionName}.log)
+		cronLogPath := filepath.Join(logDir, fmt.Sprintf("%s.log", fnName))
+		if err := os.Remove(cronLogPath); err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(r.Context(), "failed to remove cron log", "function", fnName, "err", err)
+		}
 	}
 
 	// Delete function entry from service ledger
-	if err := service_ledger.DeleteFunctionEntry(fnName); err != nil {
+	if err := service_ledger.DeleteFunctionEntry(key); err != nil {
 		// Log the error but don't fail the request
-		fmt.Printf("Warning: Failed to delete function from service ledger: %v\n", err)
+		slog.WarnContext(r.Context(), "failed to delete function from service ledger", "function", fnName, "err", err)
 	}
 
 	resp := map[string]string{
@@ -305,36 +346,36 @@ func GetFunction(w http.ResponseWriter, r *http.Request) {
 	// Extract function name from path after /get-function/
 	fnName := strings.TrimPrefix(r.URL.Path, "/get-function/")
 	if fnName == "" || fnName == "/get-function" {
-		http.Error(w, "Missing function name", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing function name")
 		return
 	}
 
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to resolve home directory", http.StatusInternalServerError)
+	project := opencloudapi.RequestProject(r.Context())
+	fnPath, apiErr := functionPath(project, fnName)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
 
-	fnPath := filepath.Join(home, ".opencloud", "functions", fnName)
 	info, err := os.Stat(fnPath)
 	if os.IsNotExist(err) {
-		http.Error(w, "Function not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Function not found")
 		return
 	} else if err != nil {
-		http.Error(w, "Error checking function file", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Error checking function file"))
 		return
 	}
 
 	code, err := os.ReadFile(fnPath)
 	if err != nil {
-		http.Error(w, "Failed to read function file", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to read function file"))
 		return
 	}
 
 	// Get trigger information and invocations from service ledger
 	var trigger *Trigger
 	var invocations int
-	if ledgerEntry, err := service_ledger.GetFunctionEntry(fnName); err == nil && ledgerEntry != nil {
+	if ledgerEntry, err := service_ledger.GetFunctionEntry(service_ledger.ProjectKey(project, fnName)); err == nil && ledgerEntry != nil {
 		invocations = ledgerEntry.Invocations
 		// The presence of trigger and schedule in the ledger indicates the trigger is enabled
 		if ledgerEntry.Trigger != "" && ledgerEntry.Schedule != "" {
@@ -361,9 +402,67 @@ func GetFunction(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func addCron(filePath string, schedule string) error {
+// functionPath returns the file of the function called fnName in project.  A
+// name that could reach outside the project's functions directory is
+// reported as not found.
+func functionPath(project, fnName string) (string, *apierror.Error) {
+	if !utils.ValidResourceName(fnName) {
+		return "", apierror.New(http.StatusNotFound, "Function not found")
+	}
+	fnDir, err := utils.ProjectDir(project, utils.Functions)
+	if err != nil {
+		return "", apierror.Filesystem(err, "Failed to resolve functions directory")
+	}
+	return filepath.Join(fnDir, fnName), nil
+}
+
+// functionLogDir returns the directory holding the execution logs of the
+// functions of project.
+func functionLogDir(project string) (string, error) {
+	logsDir, err := utils.ProjectDir(project, utils.Logs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(logsDir, "functions"), nil
+}
+
+// functionCronDir returns the directory holding the cron wrapper scripts of
+// the functions of project: <data dir>/cron for the default project and a
+// subdirectory named after the project for the others.
+func functionCronDir(project string) (string, error) {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	cronDir := filepath.Join(dataDir, "cron")
+	if project != "" && project != utils.DefaultProject {
+		if !utils.ValidProjectName(project) {
+			return "", fmt.Errorf("invalid project name %q", project)
+		}
+		cronDir = filepath.Join(cronDir, project)
+	}
+	return cronDir, nil
+}
 
-	fmt.Println(schedule)
+// openFunctionLog opens the execution log of function fnName of project for
+// appending, creating the log directory if needed.
+func openFunctionLog(project, fnName string) (*os.File, error) {
+	logDir, err := functionLogDir(project)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	// Change function_name.extenesion to function_name.log
+	baseName := strings.TrimSuffix(fnName, filepath.Ext(fnName))
+	return os.OpenFile(filepath.Join(logDir, baseName+".log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+// addCron adds a cron job running the function file filePath of project on
+// schedule to the user's crontab.
+func addCron(project, filePath string, schedule string) error {
 
 	cmd := exec.Command("crontab", "-l")
 	output, err := cmd.CombinedOutput()
@@ -372,7 +471,7 @@ func addCron(filePath string, schedule string) error {
 	// Handle case where user has no crontab yet
 	if err != nil {
 		if strings.Contains(out, "no crontab for") {
-			fmt.Println("No crontab found — continuing with empty crontab.")
+			slog.Debug("no crontab found, starting an empty one")
 			out = "" // treat as empty crontab
 		} else {
 			// Real error → stop
@@ -382,15 +481,11 @@ func addCron(filePath string, schedule string) error {
 
 	currentCrontab := out
 
-	// Resolve home directory
-	home, err := os.UserHomeDir()
+	// Prepare log directory
+	logDir, err := functionLogDir(project)
 	if err != nil {
-		fmt.Println("Home dir not grabbed")
-		return nil
+		return err
 	}
-
-	// Prepare log directory
-	logDir := filepath.Join(home, ".opencloud", "logs", "functions")
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("failed to create logs directory: %v", err)
 	}
@@ -400,7 +495,10 @@ func addCron(filePath string, schedule string) error {
 	logFile := filepath.Join(logDir, baseName+".log")
 
 	// Create cron wrapper script directory
-	cronDir := filepath.Join(home, ".opencloud", "cron")
+	cronDir, err := functionCronDir(project)
+	if err != nil {
+		return err
+	}
 	if err := os.MkdirAll(cronDir, 0755); err != nil {
 		return fmt.Errorf("failed to create cron directory: %v", err)
 	}
@@ -443,7 +541,7 @@ rm -f "$TMPOUT" "$TMPERR"
 
 	// Prevent duplicate entries
 	if strings.Contains(currentCrontab, newCronJob) {
-		fmt.Println("Cron job already exists — skipping add.")
+		slog.Debug("cron job already exists", "job", newCronJob)
 		return nil
 	}
 
@@ -463,12 +561,13 @@ rm -f "$TMPOUT" "$TMPERR"
 		return fmt.Errorf("error updating crontab: %v\n%s", err, output)
 	}
 
-	fmt.Println("Crontab updated successfully.")
+	slog.Info("cron job added", "job", newCronJob)
 	return nil
 }
 
-// removeCron removes a cron job entry for the given file path from the user's crontab
-func removeCron(filePath string) error {
+// removeCron removes a cron job entry for the given file path of project from
+// the user's crontab
+func removeCron(project, filePath string) error {
 	// Get current crontab
 	cmd := exec.Command("crontab", "-l")
 	output, err := cmd.CombinedOutput()
@@ -477,7 +576,7 @@ func removeCron(filePath string) error {
 	// Handle case where user has no crontab
 	if err != nil {
 		if strings.Contains(out, "no crontab for") {
-			fmt.Println("No crontab found — nothing to remove.")
+			slog.Debug("no crontab found, nothing to remove")
 			return nil // No crontab means nothing to remove
 		} else {
 			// Real error → stop
@@ -488,20 +587,19 @@ func removeCron(filePath string) error {
 	currentCrontab := out
 
 	// Derive the wrapper script path that addCron would have created.
-	// If home directory resolution fails, fall back to old-style matching only.
+	// If data directory resolution fails, fall back to old-style matching only.
 	var wrapperScript string
-	home, homeErr := os.UserHomeDir()
-	if homeErr == nil {
+	cronDir, dataDirErr := functionCronDir(project)
+	if dataDirErr == nil {
 		fileName := filepath.Base(filePath)
 		baseName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
-		cronDir := filepath.Join(home, ".opencloud", "cron")
 		candidate := filepath.Join(cronDir, baseName+".sh")
 		// Validate the candidate stays within the cron directory
 		if strings.HasPrefix(filepath.Clean(candidate), filepath.Clean(cronDir)+string(filepath.Separator)) {
 			wrapperScript = candidate
 		}
 	} else {
-		fmt.Printf("Warning: could not determine home directory for wrapper script path: %v\n", homeErr)
+		slog.Warn("could not determine data directory for wrapper script path", "err", dataDirErr)
 	}
 
 	// Build the expected cron job pattern to remove
@@ -518,7 +616,7 @@ func removeCron(filePath string) error {
 			strings.Contains(line, " "+filePath+" ") ||
 			strings.Contains(line, " "+filePath+" >>")) {
 			removed = true
-			fmt.Printf("Removing cron job: %s\n", line)
+			slog.Info("removing cron job", "job", line)
 			continue
 		}
 		// Keep all other non-empty lines
@@ -528,7 +626,7 @@ func removeCron(filePath string) error {
 	}
 
 	if !removed {
-		fmt.Println("No matching cron job found — nothing to remove.")
+		slog.Debug("no matching cron job found", "path", filePath)
 		return nil
 	}
 
@@ -552,18 +650,101 @@ func removeCron(filePath string) error {
 	if wrapperScript != "" {
 		if _, statErr := os.Stat(wrapperScript); statErr == nil {
 			if removeErr := os.Remove(wrapperScript); removeErr != nil {
-				fmt.Printf("Warning: failed to remove cron wrapper script: %v\n", removeErr)
+				slog.Warn("failed to remove cron wrapper script", "path", wrapperScript, "err", removeErr)
 			}
 		}
 	}
 
-	fmt.Println("Cron job removed successfully.")
 	return nil
 }
 
+// RelocateCronJobs points the cron wrapper scripts and crontab entries of
+// functions with cron triggers at the paths their files were moved to by
+// utils.MigrateData.  It runs after the move, so the wrapper scripts are
+// already in <data dir>/cron and its project subdirectories.
+func RelocateCronJobs(moves []utils.DataMove) error {
+	var pairs []string
+	for _, m := range moves {
+		sep := string(filepath.Separator)
+		pairs = append(pairs, m.From+sep, m.To+sep)
+	}
+	relocate := strings.NewReplacer(pairs...)
+
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return err
+	}
+	scripts, err := filepath.Glob(filepath.Join(dataDir, "cron", "*.sh"))
+	if err != nil {
+		return err
+	}
+	projectScripts, err := filepath.Glob(filepath.Join(dataDir, "cron", "*", "*.sh"))
+	if err != nil {
+		return err
+	}
+	scripts = append(scripts, projectScripts...)
+	for _, script := range scripts {
+		content, err := os.ReadFile(script)
+		if err != nil {
+			return err
+		}
+		if updated := relocate.Replace(string(content)); updated != string(content) {
+			if err := os.WriteFile(script, []byte(updated), 0755); err != nil {
+				return fmt.Errorf("failed to update cron wrapper script: %v", err)
+			}
+		}
+	}
+
+	output, err := exec.Command("crontab", "-l").CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "no crontab for") {
+			return nil
+		}
+		return fmt.Errorf("Unexpected crontab error: %v\n%s", err, output)
+	}
+	updatedCrontab := relocate.Replace(string(output))
+	if updatedCrontab == string(output) {
+		return nil
+	}
+
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = strings.NewReader(updatedCrontab)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error updating crontab: %v\n%s", err, output)
+	}
+	return nil
+}
+
+// RestoreCronJobs adds the crontab entries of the functions with cron
+// triggers in the service ledger and rewrites their wrapper scripts for the
+// current directories.  It runs after a backup is restored, since the
+// crontab is not part of the backup.  Entries already present are kept.
+func RestoreCronJobs() error {
+	entries, err := service_ledger.GetAllFunctionEntries()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for key, entry := range entries {
+		if entry.Trigger != "cron" || entry.Schedule == "" {
+			continue
+		}
+		project, name := service_ledger.SplitProjectKey(key)
+		fnDir, err := utils.ProjectDir(project, utils.Functions)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("function %s: %w", key, err))
+			continue
+		}
+		if err := addCron(project, filepath.Join(fnDir, name), entry.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("function %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func CreateFunction(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -575,13 +756,13 @@ func CreateFunction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
 	// Validate required fields
 	if req.Name == "" || req.Runtime == "" || req.Code == "" {
-		http.Error(w, "Missing required fields: name, runtime, and code", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing required fields: name, runtime, and code")
 		return
 	}
 
@@ -597,7 +778,7 @@ func CreateFunction(w http.ResponseWriter, r *http.Request) {
 	} else if strings.Contains(runtimeLower, "ruby") {
 		extension = ".rb"
 	} else {
-		http.Error(w, "Unsupported runtime: "+req.Runtime, http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Unsupported runtime: "+req.Runtime)
 		return
 	}
 
@@ -606,44 +787,49 @@ func CreateFunction(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasSuffix(functionFileName, extension) {
 		functionFileName += extension
 	}
+	if !utils.ValidResourceName(functionFileName) {
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid function name")
+		return
+	}
 
 	// Resolve file path
-	home, err := os.UserHomeDir()
+	project := opencloudapi.RequestProject(r.Context())
+	key := service_ledger.ProjectKey(project, functionFileName)
+	fnDir, err := utils.ProjectDir(project, utils.Functions)
 	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve functions directory"))
 		return
 	}
-	fnDir := filepath.Join(home, ".opencloud", "functions")
 	fnPath := filepath.Join(fnDir, functionFileName)
 
 	// Create the functions directory if it doesn't exist
 	if err := os.MkdirAll(fnDir, 0755); err != nil {
-		http.Error(w, "Failed to create functions directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to create functions directory"))
 		return
 	}
 
 	// Check if function already exists (both file and ledger)
 	if _, err := os.Stat(fnPath); err == nil {
-		http.Error(w, "Function already exists", http.StatusConflict)
+		apierror.Respond(w, r, http.StatusConflict, "Function already exists")
 		return
 	}
 
 	// Also check if function exists in service ledger
-	if existingEntry, err := service_ledger.GetFunctionEntry(functionFileName); err == nil && existingEntry != nil {
-		http.Error(w, "Function already exists in service ledger", http.StatusConflict)
+	if existingEntry, err := service_ledger.GetFunctionEntry(key); err == nil && existingEntry != nil {
+		apierror.Respond(w, r, http.StatusConflict, "Function already exists in service ledger")
 		return
 	}
 
 	// Write function code to file
 	if err := os.WriteFile(fnPath, []byte(req.Code), 0644); err != nil {
-		http.Error(w, "Failed to create function file", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to create function file"))
 		return
 	}
 
 	// Update service ledger with function entry
-	if err := service_ledger.UpdateFunctionEntry(functionFileName, req.Runtime, "", "", req.Code); err != nil {
+	if err := service_ledger.UpdateFunctionEntry(key, req.Runtime, "", "", req.Code); err != nil {
 		// Log the error but don't fail the request since function file was already created
-		fmt.Printf("Warning: Failed to update service ledger: %v\n", err)
+		slog.WarnContext(r.Context(), "failed to update service ledger", "function", functionFileName, "err", err)
 	}
 
 	// Respond with created function info
@@ -664,14 +850,14 @@ func CreateFunction(w http.ResponseWriter, r *http.Request) {
 func UpdateFunction(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Extract function ID from URL path
 	id := strings.TrimPrefix(r.URL.Path, "/update-function/")
 	if id == "" {
-		http.Error(w, "Function ID not provided", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Function ID not provided")
 		return
 	}
 
@@ -679,39 +865,44 @@ func UpdateFunction(w http.ResponseWriter, r *http.Request) {
 	var req UpdateFunctionRequest
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Failed to read request body")
 		return
 	}
 	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
 	// Validate required fields
 	if req.Name == "" {
-		http.Error(w, "Function name is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Function name is required")
 		return
 	}
 	if req.Runtime == "" {
-		http.Error(w, "Runtime is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Runtime is required")
+		return
+	}
+
+	if !utils.ValidResourceName(req.Name) {
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid function name")
 		return
 	}
 
 	// Resolve file path
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+	project := opencloudapi.RequestProject(r.Context())
+	fnPath, apiErr := functionPath(project, id)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
-	fnDir := filepath.Join(home, ".opencloud", "functions")
-	fnPath := filepath.Join(fnDir, id)
+	fnDir := filepath.Dir(fnPath)
 
 	// Check if function exists
 	if _, err := os.Stat(fnPath); os.IsNotExist(err) {
-		http.Error(w, "Function not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Function not found")
 		return
 	} else if err != nil {
-		http.Error(w, "Failed to read function", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to read function"))
 		return
 	}
 
@@ -724,50 +915,51 @@ func UpdateFunction(w http.ResponseWriter, r *http.Request) {
 	// If renaming, check that the new file doesn't already exist
 	if needsRename {
 		if _, err := os.Stat(newFnPath); err == nil {
-			http.Error(w, "A function with the new name already exists", http.StatusConflict)
+			apierror.Respond(w, r, http.StatusConflict, "A function with the new name already exists")
 			return
 		}
 	}
 
 	// Get old cron trigger status before making changes
-	oldFunctionEntry, _ := service_ledger.GetFunctionEntry(id)
+	oldFunctionEntry, _ := service_ledger.GetFunctionEntry(service_ledger.ProjectKey(project, id))
 	hadCronTrigger := oldFunctionEntry != nil && oldFunctionEntry.Trigger == "cron"
 
 	// Remove old cron job if it existed
 	if hadCronTrigger {
-		if err := removeCron(fnPath); err != nil {
-			fmt.Printf("Warning: Failed to remove old cron job: %v\n", err)
+		if err := removeCron(project, fnPath); err != nil {
+			slog.WarnContext(r.Context(), "failed to remove old cron job", "function", id, "err", err)
 		}
 	}
 
 	// Update function code (write to the current path first)
 	if err := os.WriteFile(fnPath, []byte(req.Code), 0644); err != nil {
-		http.Error(w, "Failed to update function code", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to update function code"))
 		return
 	}
 
 	// If renaming the function, rename the file
 	if needsRename {
 		if err := os.Rename(fnPath, newFnPath); err != nil {
-			http.Error(w, "Failed to rename function file", http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.Filesystem(err, "Failed to rename function file"))
 			return
 		}
 
 		// Delete old entry from service ledger
-		if err := service_ledger.DeleteFunctionEntry(id); err != nil {
-			fmt.Printf("Warning: Failed to delete old service ledger entry: %v\n", err)
+		if err := service_ledger.DeleteFunctionEntry(service_ledger.ProjectKey(project, id)); err != nil {
+			slog.WarnContext(r.Context(), "failed to delete old service ledger entry", "function", id, "err", err)
 		}
 
 		// Rename log file if it exists
-		logsDir := filepath.Join(home, ".opencloud", "logs", "functions")
-		oldBaseName := strings.TrimSuffix(id, filepath.Ext(id))
-		newBaseName := strings.TrimSuffix(newFileName, filepath.Ext(newFileName))
-		oldLogPath := filepath.Join(logsDir, oldBaseName+".log")
-		newLogPath := filepath.Join(logsDir, newBaseName+".log")
-
-		if _, err := os.Stat(oldLogPath); err == nil {
-			if err := os.Rename(oldLogPath, newLogPath); err != nil {
-				fmt.Printf("Warning: Failed to rename log file: %v\n", err)
+		if logsDir, err := functionLogDir(project); err == nil {
+			oldBaseName := strings.TrimSuffix(id, filepath.Ext(id))
+			newBaseName := strings.TrimSuffix(newFileName, filepath.Ext(newFileName))
+			oldLogPath := filepath.Join(logsDir, oldBaseName+".log")
+			newLogPath := filepath.Join(logsDir, newBaseName+".log")
+
+			if _, err := os.Stat(oldLogPath); err == nil {
+				if err := os.Rename(oldLogPath, newLogPath); err != nil {
+					slog.WarnContext(r.Context(), "failed to rename function log", "function", id, "err", err)
+				}
 			}
 		}
 
@@ -783,21 +975,22 @@ func UpdateFunction(w http.ResponseWriter, r *http.Request) {
 		trigger = req.Trigger.Type
 		schedule = req.Trigger.Schedule
 		// Add cron job to system crontab with the new file path
-		if err := addCron(fnPath, req.Trigger.Schedule); err != nil {
-			http.Error(w, "Failed to save cron trigger metadata", http.StatusInternalServerError)
+		if err := addCron(project, fnPath, req.Trigger.Schedule); err != nil {
+			slog.ErrorContext(r.Context(), "failed to add cron job", "function", id, "err", err)
+			apierror.Respond(w, r, http.StatusInternalServerError, "Failed to save cron trigger metadata")
 			return
 		}
 	}
 
 	// Update service ledger with function entry using the new filename
-	if err := service_ledger.UpdateFunctionEntry(id, req.Runtime, trigger, schedule, req.Code); err != nil {
+	if err := service_ledger.UpdateFunctionEntry(service_ledger.ProjectKey(project, id), req.Runtime, trigger, schedule, req.Code); err != nil {
 		// Log the error but don't fail the request since function code was already updated
-		fmt.Printf("Warning: Failed to update service ledger: %v\n", err)
+		slog.WarnContext(r.Context(), "failed to update service ledger", "function", id, "err", err)
 	}
 
 	// Read invocations count from service ledger for the response
 	var invocations int
-	if ledgerEntry, err := service_ledger.GetFunctionEntry(id); err == nil && ledgerEntry != nil {
+	if ledgerEntry, err := service_ledger.GetFunctionEntry(service_ledger.ProjectKey(project, id)); err == nil && ledgerEntry != nil {
 		invocations = ledgerEntry.Invocations
 	}
 
@@ -824,21 +1017,26 @@ func GetFunctionLogs(w http.ResponseWriter, r *http.Request) {
 	// Extract function name from path after /get-function-logs/
 	fnName := strings.TrimPrefix(r.URL.Path, "/get-function-logs/")
 	if fnName == "" || fnName == "/get-function-logs" {
-		http.Error(w, "Missing function name", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing function name")
+		return
+	}
+
+	if !utils.ValidResourceName(fnName) {
+		apierror.Respond(w, r, http.StatusNotFound, "Function not found")
 		return
 	}
 
-	// Get home directory
-	home, err := os.UserHomeDir()
+	// Get log directory
+	logDir, err := functionLogDir(opencloudapi.RequestProject(r.Context()))
 	if err != nil {
-		http.Error(w, "Failed to resolve home directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to resolve log directory"))
 		return
 	}
 
 	// Construct log file path: remove extension from function name and add .log
 	baseName := strings.TrimSuffix(fnName, filepath.Ext(fnName))
 	logFileName := baseName + ".log"
-	logFilePath := filepath.Join(home, ".opencloud", "logs", "functions", logFileName)
+	logFilePath := filepath.Join(logDir, logFileName)
 
 	// Read log file
 	logContent, err := os.ReadFile(logFilePath)
@@ -849,7 +1047,7 @@ func GetFunctionLogs(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode([]service_ledger.FunctionLog{})
 			return
 		}
-		http.Error(w, "Failed to read log file", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to read log file"))
 		return
 	}
 
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
 	"github.com/containers/podman/v5/libpod/define"
 	"github.com/containers/podman/v5/pkg/bindings/containers"
 	"github.com/containers/podman/v5/pkg/domain/entities/reports"
@@ -118,7 +119,7 @@ func TestAddCron(t *testing.T) {
 
 	// Test adding a cron job
 	testSchedule := "0 0 * * *"
-	err := addCron(testFuncPath, testSchedule)
+	err := addCron(utils.DefaultProject, testFuncPath, testSchedule)
 	if err != nil {
 		t.Fatalf("addCron failed: %v", err)
 	}
@@ -217,12 +218,12 @@ func TestAddCronDuplicatePrevention(t *testing.T) {
 
 	// Add the same cron job twice
 	testSchedule := "0 0 * * *"
-	err := addCron(testFuncPath, testSchedule)
+	err := addCron(utils.DefaultProject, testFuncPath, testSchedule)
 	if err != nil {
 		t.Fatalf("First addCron failed: %v", err)
 	}
 
-	err = addCron(testFuncPath, testSchedule)
+	err = addCron(utils.DefaultProject, testFuncPath, testSchedule)
 	if err != nil {
 		t.Fatalf("Second addCron failed: %v", err)
 	}
@@ -291,7 +292,7 @@ func TestAddCronMultipleFunctions(t *testing.T) {
 	// Add all cron jobs
 	for _, fn := range functions {
 		testFuncPath := filepath.Join(funcDir, fn.name)
-		err := addCron(testFuncPath, fn.schedule)
+		err := addCron(utils.DefaultProject, testFuncPath, fn.schedule)
 		if err != nil {
 			t.Fatalf("addCron failed for %s: %v", fn.name, err)
 		}
@@ -362,7 +363,7 @@ func TestRemoveCron(t *testing.T) {
 
 	// First add a cron job
 	testSchedule := "0 0 * * *"
-	err := addCron(testFuncPath, testSchedule)
+	err := addCron(utils.DefaultProject, testFuncPath, testSchedule)
 	if err != nil {
 		t.Fatalf("addCron failed: %v", err)
 	}
@@ -379,7 +380,7 @@ func TestRemoveCron(t *testing.T) {
 	}
 
 	// Now remove the cron job
-	err = removeCron(testFuncPath)
+	err = removeCron(utils.DefaultProject, testFuncPath)
 	if err != nil {
 		t.Fatalf("removeCron failed: %v", err)
 	}
@@ -442,7 +443,7 @@ func TestRemoveCronMultipleFunctions(t *testing.T) {
 
 	// Add all cron jobs
 	for i, fn := range functions {
-		err := addCron(funcPaths[i], fn.schedule)
+		err := addCron(utils.DefaultProject, funcPaths[i], fn.schedule)
 		if err != nil {
 			t.Fatalf("addCron failed for %s: %v", fn.name, err)
 		}
@@ -462,7 +463,7 @@ func TestRemoveCronMultipleFunctions(t *testing.T) {
 	}
 
 	// Remove one cron job (the middle one)
-	err = removeCron(funcPaths[1])
+	err = removeCron(utils.DefaultProject, funcPaths[1])
 	if err != nil {
 		t.Fatalf("removeCron failed: %v", err)
 	}
@@ -513,7 +514,7 @@ func TestRemoveCronNonExistent(t *testing.T) {
 	defer cleanup()
 
 	// Try to remove a cron job that doesn't exist
-	err := removeCron(testFuncPath)
+	err := removeCron(utils.DefaultProject, testFuncPath)
 	if err != nil {
 		t.Fatalf("removeCron should not fail for non-existent cron job: %v", err)
 	}
@@ -3671,3 +3672,44 @@ func TestApplyFullCustomCommand(t *testing.T) {
 		}
 	})
 }
+
+func TestRestoreCronJobs(t *testing.T) {
+	if _, err := exec.LookPath("crontab"); err != nil {
+		t.Skip("crontab command not available")
+	}
+	tmpHome := t.TempDir()
+	t.Setenv("HOME", tmpHome)
+	cleanup := setupCrontabTest(t)
+	defer cleanup()
+
+	saved, err := service_ledger.SnapshotServiceLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service_ledger.ReplaceServiceLedger(saved) })
+	service_ledger.ReplaceServiceLedger(service_ledger.ServiceLedger{
+		"Functions": {Enabled: true, Functions: map[string]service_ledger.FunctionEntry{
+			"nightly.py": {Runtime: "python", Trigger: "cron", Schedule: "0 3 * * *"},
+			"manual.py":  {Runtime: "python"},
+		}},
+	})
+
+	// Restoring twice adds each entry once.
+	for i := 0; i < 2; i++ {
+		if err := RestoreCronJobs(); err != nil {
+			t.Fatalf("RestoreCronJobs: %v", err)
+		}
+	}
+	output, err := exec.Command("crontab", "-l").CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to read crontab: %v", err)
+	}
+	funcPath := filepath.Join(tmpHome, ".opencloud", "functions", "nightly.py")
+	job := "0 3 * * * " + cronWrapperPath(tmpHome, funcPath)
+	if n := strings.Count(string(output), job); n != 1 {
+		t.Errorf("crontab has %d entries %q, want 1:\n%s", n, job, output)
+	}
+	if strings.Contains(string(output), "manual") {
+		t.Errorf("crontab has an entry for a function without a cron trigger:\n%s", output)
+	}
+}
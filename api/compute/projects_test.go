@@ -0,0 +1,142 @@
+package compute
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/domain/entities/reports"
+)
+
+func TestMain(m *testing.M) {
+	// The container handler tests use fake Podman connections; their
+	// containers belong to the default project unless a test says otherwise.
+	containerProjectOf = func(context.Context, string) (string, error) {
+		return utils.DefaultProject, nil
+	}
+	os.Exit(m.Run())
+}
+
+func TestDeleteContainerOfAnotherProject(t *testing.T) {
+	origConnection := deleteContainerConnection
+	origRemove := removePodmanContainer
+	origProject := containerProjectOf
+	t.Cleanup(func() {
+		deleteContainerConnection = origConnection
+		removePodmanContainer = origRemove
+		containerProjectOf = origProject
+	})
+
+	deleteContainerConnection = func(ctx context.Context) (context.Context, error) {
+		return ctx, nil
+	}
+	containerProjectOf = func(context.Context, string) (string, error) {
+		return "team-a", nil
+	}
+	removeCalled := false
+	removePodmanContainer = func(ctx context.Context, nameOrID string, opts *containers.RemoveOptions) ([]*reports.RmReport, error) {
+		removeCalled = true
+		return nil, nil
+	}
+
+	for _, tc := range []struct {
+		project string
+		status  int
+	}{
+		{utils.DefaultProject, http.StatusNotFound},
+		{"team-b", http.StatusNotFound},
+		{"team-a", http.StatusOK},
+	} {
+		removeCalled = false
+		req := httptest.NewRequest(http.MethodPost, "/delete-container", strings.NewReader(`{"containerId":"web"}`))
+		req = req.WithContext(opencloudapi.WithRequestProject(req.Context(), tc.project))
+		w := httptest.NewRecorder()
+
+		DeleteContainer(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("project %s: expected %d, got %d", tc.project, tc.status, w.Code)
+		}
+		if removeCalled != (tc.status == http.StatusOK) {
+			t.Errorf("project %s: remove called = %v", tc.project, removeCalled)
+		}
+	}
+}
+
+func TestFunctionsAreIsolatedByProject(t *testing.T) {
+	tmpHome := t.TempDir()
+	t.Setenv("HOME", tmpHome)
+
+	fnName := "test_project_isolation.py"
+	funcDir := filepath.Join(tmpHome, ".opencloud", "functions")
+	if err := os.MkdirAll(funcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(funcDir, fnName), []byte("print('default')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer service_ledger.DeleteFunctionEntry(service_ledger.ProjectKey("team-a", fnName))
+
+	inProject := func(r *http.Request, project string) *http.Request {
+		return r.WithContext(opencloudapi.WithRequestProject(r.Context(), project))
+	}
+
+	// The same name can be created in another project.
+	body := `{"name":"test_project_isolation","runtime":"python","code":"print('team')"}`
+	w := httptest.NewRecorder()
+	CreateFunction(w, inProject(httptest.NewRequest(http.MethodPost, "/create-function", strings.NewReader(body)), "team-a"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateFunction in team-a: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(funcDir, ".projects", "team-a", fnName)); err != nil {
+		t.Fatalf("function file of team-a: %v", err)
+	}
+
+	list := func(project string) []FunctionItem {
+		t.Helper()
+		w := httptest.NewRecorder()
+		ListFunctions(w, inProject(httptest.NewRequest(http.MethodGet, "/list-functions", nil), project))
+		if w.Code != http.StatusOK {
+			t.Fatalf("ListFunctions in %s: expected 200, got %d", project, w.Code)
+		}
+		var functions []FunctionItem
+		if err := json.NewDecoder(w.Body).Decode(&functions); err != nil {
+			t.Fatal(err)
+		}
+		return functions
+	}
+	if got := list(utils.DefaultProject); len(got) != 1 || got[0].Name != fnName {
+		t.Errorf("default project functions = %+v", got)
+	}
+	if got := list("team-a"); len(got) != 1 || got[0].Name != fnName {
+		t.Errorf("team-a functions = %+v", got)
+	}
+	if got := list("team-b"); len(got) != 0 {
+		t.Errorf("team-b functions = %+v, want none", got)
+	}
+
+	w = httptest.NewRecorder()
+	GetFunction(w, inProject(httptest.NewRequest(http.MethodGet, "/get-function/"+fnName, nil), "team-a"))
+	var fn struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&fn); err != nil || fn.Code != "print('team')" {
+		t.Errorf("GetFunction in team-a = %d %+v, %v", w.Code, fn, err)
+	}
+
+	// A name cannot reach into the directory of another project.
+	w = httptest.NewRecorder()
+	GetFunction(w, httptest.NewRequest(http.MethodGet, "/get-function/.projects/team-a/"+fnName, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GetFunction through .projects: expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// GET /events streams platform activity as server-sent events.  Each event
+// is sent as an unnamed SSE message, so EventSource.onmessage sees them all:
+//
+//	id: evt_3f0c...
+//	data: {"id":"evt_3f0c...","type":"pipeline.finished","time":"...","data":{...}}
+//
+// A client that reconnects with Last-Event-ID (or the lastEventId query
+// parameter, for the first connection of a page) first receives the events
+// it missed, from a history of the last eventHistorySize events kept under
+// <logs dir>/events.jsonl.
+
+const (
+	// eventHistorySize is how many events GET /events can replay.
+	eventHistorySize = 1000
+	// eventStreamBuffer is how many events a stream may fall behind before
+	// further events are dropped for it.
+	eventStreamBuffer = 64
+	// eventStreamRetry is the reconnection delay suggested to clients.
+	eventStreamRetry = 3 * time.Second
+)
+
+// eventStreamKeepAlive is how often an idle stream sends a comment, so
+// proxies do not close the connection.
+var eventStreamKeepAlive = 30 * time.Second
+
+// eventStreamsCtx ends every stream once the server starts shutting down;
+// otherwise open streams would hold the shutdown until its deadline.
+var eventStreamsCtx, closeEventStreams = context.WithCancel(context.Background())
+
+// OpenEventHistory starts recording platform events so GET /events can
+// replay them.  It is called once at startup.
+func OpenEventHistory() error {
+	logsDir, err := utils.SubsystemDir(utils.Logs)
+	if err != nil {
+		return err
+	}
+	h, err := events.OpenHistory(filepath.Join(logsDir, "events.jsonl"), eventHistorySize)
+	if err != nil {
+		return err
+	}
+	events.KeepHistory(h)
+	return nil
+}
+
+// CloseEventStreams ends every GET /events stream.  The server calls it when
+// shutting down.
+func CloseEventStreams() {
+	closeEventStreams()
+}
+
+// StreamEvents handles GET /events.
+// The optional "types" parameter is a comma-separated list of event types
+// to receive; all types are sent when it is absent.  Events of projects the
+// caller is not a member of are left out.
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var types []string
+	if v := r.URL.Query().Get("types"); v != "" {
+		for _, typ := range strings.Split(v, ",") {
+			typ = strings.TrimSpace(typ)
+			if !events.IsValidType(typ) {
+				apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("unknown event type %q; valid types are %s", typ, strings.Join(events.Types, ", ")))
+				return
+			}
+			types = append(types, typ)
+		}
+	}
+	// Events naming a project are only sent to users with access to it.
+	var user *userRecord
+	if username, ok := AuthenticatedUser(r.Context()); ok {
+		var err error
+		if user, err = lookupUser(username); err != nil || user == nil {
+			apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+			return
+		}
+	}
+	wanted := func(ev events.Event) bool {
+		if types != nil && !slices.Contains(types, ev.Type) {
+			return false
+		}
+		project, _ := ev.Data["project"].(string)
+		return user == nil || project == "" || canSeeProject(user, project)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Respond(w, r, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	var replay []events.Event
+	var ch <-chan events.Event
+	var cancel func()
+	if lastID != "" {
+		replay, ch, cancel = events.SubscribeSince(lastID, eventStreamBuffer)
+	} else {
+		ch, cancel = events.Subscribe(eventStreamBuffer)
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry.Milliseconds())
+	flusher.Flush()
+
+	send := func(ev events.Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\ndata: %s\n\n", ev.ID, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	for _, ev := range replay {
+		if !wanted(ev) {
+			continue
+		}
+		if err := send(ev); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-eventStreamsCtx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !wanted(ev) {
+				continue
+			}
+			if err := send(ev); err != nil {
+				return
+			}
+		}
+	}
+}
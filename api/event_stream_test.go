@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// openEventStream connects to GET /events on srv and returns a reader of
+// its messages.
+func openEventStream(t *testing.T, srv *httptest.Server, query, lastID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /events: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(resp.Body)
+	if id, _ := readStreamedEvent(t, r); id != "" {
+		t.Fatalf("first message has id %q, want the retry hint", id)
+	}
+	return r
+}
+
+// readStreamedEvent reads one SSE message and returns its id and decoded
+// event, skipping comments.
+func readStreamedEvent(t *testing.T, r *bufio.Reader) (string, events.Event) {
+	t.Helper()
+	var id string
+	var ev events.Event
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return id, ev
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+				t.Fatalf("bad event data %q: %v", line, err)
+			}
+		}
+	}
+}
+
+// useEventHistory records events in a temporary data directory.
+func useEventHistory(t *testing.T) {
+	t.Helper()
+	utils.SetDataDir(t.TempDir())
+	t.Cleanup(func() {
+		events.KeepHistory(nil)
+		utils.SetDataDir("")
+	})
+	if err := OpenEventHistory(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamEventsReplaysFromLastEventID(t *testing.T) {
+	useEventHistory(t)
+	srv := httptest.NewServer(http.HandlerFunc(StreamEvents))
+	defer srv.Close()
+
+	first := events.Publish(events.PipelineStarted, map[string]any{"id": "p-1"})
+	second := events.Publish(events.PipelineFinished, map[string]any{"id": "p-1", "status": "success"})
+
+	stream := openEventStream(t, srv, "", first.ID)
+	if id, ev := readStreamedEvent(t, stream); id != second.ID || ev.Type != events.PipelineFinished || ev.Data["status"] != "success" {
+		t.Fatalf("replayed %s %+v, want %s", id, ev, second.ID)
+	}
+	third := events.Publish(events.ContainerStarted, map[string]any{"containerId": "c1"})
+	if id, _ := readStreamedEvent(t, stream); id != third.ID {
+		t.Errorf("received %s, want the live event %s", id, third.ID)
+	}
+}
+
+func TestStreamEventsFiltersTypes(t *testing.T) {
+	useEventHistory(t)
+	srv := httptest.NewServer(http.HandlerFunc(StreamEvents))
+	defer srv.Close()
+
+	stream := openEventStream(t, srv, "?types=image.built,image.pulled", "")
+	events.Publish(events.FunctionInvoked, nil)
+	pulled := events.Publish(events.ImagePulled, map[string]any{"imageName": "nginx"})
+	if id, _ := readStreamedEvent(t, stream); id != pulled.ID {
+		t.Errorf("received %s, want %s", id, pulled.ID)
+	}
+
+	resp, err := http.Get(srv.URL + "/events?types=image.deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown type: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestCloseEventStreamsEndsStreams(t *testing.T) {
+	useEventHistory(t)
+	origCtx, origClose := eventStreamsCtx, closeEventStreams
+	eventStreamsCtx, closeEventStreams = context.WithCancel(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(StreamEvents))
+	t.Cleanup(func() {
+		srv.Close()
+		eventStreamsCtx, closeEventStreams = origCtx, origClose
+	})
+
+	stream := openEventStream(t, srv, "", "")
+	CloseEventStreams()
+	if _, err := stream.ReadString('\n'); err == nil {
+		t.Error("stream still open after CloseEventStreams")
+	}
+}
@@ -0,0 +1,180 @@
+// Package events is an in-process bus for platform events, such as a
+// function being invoked or a pipeline run finishing.  Handlers publish
+// events as the work happens; webhooks and other listeners subscribe to them.
+//
+// Publishing never blocks.  Each subscriber has a buffer, and events that do
+// not fit in it are dropped for that subscriber only, so a slow listener
+// cannot hold up the handler that published.
+//
+// A bus may keep a History of recent events on disk, so that listeners that
+// reconnect, even to a restarted server, can replay what they missed.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	ServiceEnabled      = "service.enabled"
+	FunctionInvoked     = "function.invoked"
+	PipelineStarted     = "pipeline.started"
+	PipelineFinished    = "pipeline.finished"
+	ImageBuilt          = "image.built"
+	ImagePulled         = "image.pulled"
+	ContainerCreated    = "container.created"
+	ContainerStarted    = "container.started"
+	ContainerStopped    = "container.stopped"
+	ContainerRemoved    = "container.removed"
+	BucketObjectCreated = "bucket.object.created"
+)
+
+// Types lists every event type.
+var Types = []string{
+	ServiceEnabled,
+	FunctionInvoked,
+	PipelineStarted,
+	PipelineFinished,
+	ImageBuilt,
+	ImagePulled,
+	ContainerCreated,
+	ContainerStarted,
+	ContainerStopped,
+	ContainerRemoved,
+	BucketObjectCreated,
+}
+
+// IsValidType reports whether typ is one of Types.
+func IsValidType(typ string) bool {
+	for _, t := range Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is one thing that happened on the platform.
+type Event struct {
+	// ID is unique to the event, so receivers can discard duplicates.
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Data describes the event; its fields depend on the type.
+	Data map[string]any `json:"data"`
+}
+
+// Bus delivers published events to its subscribers.  The zero value is not
+// usable; use NewBus.
+type Bus struct {
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	history *History
+}
+
+// NewBus returns a bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan Event]struct{})}
+}
+
+// Publish sends an event of type typ to every subscriber and returns it.
+func (b *Bus) Publish(typ string, data map[string]any) Event {
+	ev := Event{ID: newID(), Type: typ, Time: time.Now().UTC(), Data: data}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.history != nil {
+		b.history.add(ev)
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			slog.Warn("event subscriber is not keeping up, dropped event", "event_type", ev.Type, "event", ev.ID)
+		}
+	}
+	return ev
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// holding up to buffer events the caller has not yet received, and a
+// function that ends the subscription and closes the channel.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscribeLocked(buffer)
+}
+
+// SubscribeSince is Subscribe for a listener catching up: it also returns
+// the recorded events published after the one with ID lastID, or every
+// recorded event when lastID is not among them.  No event is both replayed
+// and sent on the channel, and none published in between is missed.
+func (b *Bus) SubscribeSince(lastID string, buffer int) ([]Event, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var replay []Event
+	if b.history != nil {
+		replay = b.history.Since(lastID)
+	}
+	ch, cancel := b.subscribeLocked(buffer)
+	return replay, ch, cancel
+}
+
+// KeepHistory records every event published from now on in h.
+func (b *Bus) KeepHistory(h *History) {
+	b.mu.Lock()
+	b.history = h
+	b.mu.Unlock()
+}
+
+func (b *Bus) subscribeLocked(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.subs[ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// defaultBus is the process-wide bus used by Publish and Subscribe.
+var defaultBus = NewBus()
+
+// Publish publishes an event on the process-wide bus.
+func Publish(typ string, data map[string]any) Event {
+	return defaultBus.Publish(typ, data)
+}
+
+// Subscribe subscribes to the process-wide bus.
+func Subscribe(buffer int) (<-chan Event, func()) {
+	return defaultBus.Subscribe(buffer)
+}
+
+// SubscribeSince subscribes to the process-wide bus, replaying its history.
+func SubscribeSince(lastID string, buffer int) ([]Event, <-chan Event, func()) {
+	return defaultBus.SubscribeSince(lastID, buffer)
+}
+
+// KeepHistory records the events of the process-wide bus in h.
+func KeepHistory(h *History) {
+	defaultBus.KeepHistory(h)
+}
+
+// newID returns a random event ID.
+func newID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms.
+		panic(err)
+	}
+	return "evt_" + hex.EncodeToString(b)
+}
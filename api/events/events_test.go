@@ -0,0 +1,70 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishReachesEverySubscriber(t *testing.T) {
+	bus := NewBus()
+	a, cancelA := bus.Subscribe(1)
+	defer cancelA()
+	b, cancelB := bus.Subscribe(1)
+	defer cancelB()
+
+	sent := bus.Publish(ImageBuilt, map[string]any{"imageName": "app:latest"})
+	if sent.ID == "" || sent.Type != ImageBuilt || sent.Time.IsZero() {
+		t.Fatalf("Publish returned %+v", sent)
+	}
+	for _, ch := range []<-chan Event{a, b} {
+		select {
+		case got := <-ch:
+			if got.ID != sent.ID || got.Data["imageName"] != "app:latest" {
+				t.Errorf("received %+v, want %+v", got, sent)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("event not received")
+		}
+	}
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	bus := NewBus()
+	ch, cancel := bus.Subscribe(1)
+	defer cancel()
+
+	first := bus.Publish(FunctionInvoked, nil)
+	bus.Publish(FunctionInvoked, nil) // dropped: the buffer is full
+
+	if got := <-ch; got.ID != first.ID {
+		t.Errorf("received %s, want the first event %s", got.ID, first.ID)
+	}
+	select {
+	case got := <-ch:
+		t.Errorf("received %s, want nothing", got.ID)
+	default:
+	}
+}
+
+func TestCancelClosesChannel(t *testing.T) {
+	bus := NewBus()
+	ch, cancel := bus.Subscribe(1)
+	cancel()
+	cancel() // cancelling twice is harmless
+
+	if _, ok := <-ch; ok {
+		t.Error("channel still open after cancel")
+	}
+	bus.Publish(PipelineFinished, nil) // must not send on the closed channel
+}
+
+func TestIsValidType(t *testing.T) {
+	for _, typ := range Types {
+		if !IsValidType(typ) {
+			t.Errorf("IsValidType(%q) = false", typ)
+		}
+	}
+	if IsValidType("function.deleted") {
+		t.Error("IsValidType accepted an unknown type")
+	}
+}
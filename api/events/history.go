@@ -0,0 +1,154 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// History keeps the most recent events, in memory and in a JSON lines file
+// that survives restarts.  The file is rewritten with only the retained
+// events whenever it holds twice as many lines as that.
+type History struct {
+	mu     sync.Mutex
+	path   string
+	max    int
+	events []Event
+	// lines is the number of lines in the file.
+	lines int
+}
+
+// OpenHistory returns a history of the last max events, loading the events
+// already recorded in the file at path.  Lines that do not parse are skipped.
+func OpenHistory(path string, max int) (*History, error) {
+	if max < 1 {
+		return nil, fmt.Errorf("history must keep at least one event")
+	}
+	h := &History{path: path, max: max}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			h.lines++
+			var ev Event
+			if json.Unmarshal(scanner.Bytes(), &ev) == nil && ev.ID != "" {
+				h.keep(ev)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.lines > len(h.events) {
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Since returns the events recorded after the one with ID lastID, oldest
+// first, or every recorded event when lastID is not among them.
+func (h *History) Since(lastID string) []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := 0
+	for i := len(h.events) - 1; i >= 0; i-- {
+		if h.events[i].ID == lastID {
+			start = i + 1
+			break
+		}
+	}
+	return append([]Event(nil), h.events[start:]...)
+}
+
+// add records ev.  A failure to write the file is reported but leaves the
+// event in memory.
+func (h *History) add(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.keep(ev)
+	if err := h.append(ev); err != nil {
+		slog.Warn("failed to record event", "event", ev.ID, "path", h.path, "err", err)
+		return
+	}
+	h.lines++
+	if h.lines >= 2*h.max {
+		if err := h.rewrite(); err != nil {
+			slog.Warn("failed to compact event history", "path", h.path, "err", err)
+		}
+	}
+}
+
+// keep adds ev to the events in memory, dropping the oldest beyond max.
+func (h *History) keep(ev Event) {
+	h.events = append(h.events, ev)
+	if len(h.events) > h.max {
+		h.events = h.events[len(h.events)-h.max:]
+	}
+}
+
+func (h *History) append(ev Event) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewrite replaces the file with the events in memory.
+func (h *History) rewrite() error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, ev := range h.events {
+		if err := enc.Encode(ev); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return err
+	}
+	h.lines = len(h.events)
+	return nil
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func eventIDs(evs []Event) []string {
+	ids := make([]string, len(evs))
+	for i, ev := range evs {
+		ids[i] = ev.ID
+	}
+	return ids
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestHistoryReplaysAfterLastID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	h, err := OpenHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewBus()
+	bus.KeepHistory(h)
+
+	var sent []Event
+	for i := 0; i < 5; i++ {
+		sent = append(sent, bus.Publish(ImageBuilt, nil))
+	}
+
+	if got := eventIDs(h.Since(sent[2].ID)); len(got) != 2 || got[0] != sent[3].ID || got[1] != sent[4].ID {
+		t.Errorf("Since(third) = %v", got)
+	}
+	if got := h.Since(sent[4].ID); len(got) != 0 {
+		t.Errorf("Since(last) = %v, want nothing", eventIDs(got))
+	}
+	// The first events were dropped, so all that is kept is replayed.
+	if got := eventIDs(h.Since(sent[0].ID)); len(got) != 3 || got[0] != sent[2].ID {
+		t.Errorf("Since(dropped) = %v", got)
+	}
+
+	// A restarted server picks up where it left off.
+	reopened, err := OpenHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventIDs(reopened.Since(sent[3].ID)); len(got) != 1 || got[0] != sent[4].ID {
+		t.Errorf("Since(fourth) after reopening = %v", got)
+	}
+}
+
+func TestHistoryFileStaysBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	h, err := OpenHistory(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewBus()
+	bus.KeepHistory(h)
+	for i := 0; i < 50; i++ {
+		bus.Publish(FunctionInvoked, nil)
+	}
+	if n := countLines(t, path); n >= 8 {
+		t.Errorf("history file has %d lines, want fewer than 8", n)
+	}
+
+	// Opening a history with a smaller limit trims the file at once.
+	if _, err := OpenHistory(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := countLines(t, path); n != 2 {
+		t.Errorf("history file has %d lines after reopening, want 2", n)
+	}
+}
+
+func TestSubscribeSinceMissesNothing(t *testing.T) {
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "events.jsonl"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewBus()
+	bus.KeepHistory(h)
+	first := bus.Publish(PipelineStarted, nil)
+	second := bus.Publish(PipelineFinished, nil)
+
+	replay, ch, cancel := bus.SubscribeSince(first.ID, 1)
+	defer cancel()
+	third := bus.Publish(ContainerStarted, nil)
+
+	if got := eventIDs(replay); len(got) != 1 || got[0] != second.ID {
+		t.Errorf("replayed %v, want only %s", got, second.ID)
+	}
+	if got := <-ch; got.ID != third.ID {
+		t.Errorf("received %s, want %s", got.ID, third.ID)
+	}
+}
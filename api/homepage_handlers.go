@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
@@ -93,7 +94,7 @@ func startCPUPoller() {
 		go func() {
 			prev, err := readCPUStats()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "CPU poller: initial read error: %v\n", err)
+				slog.Warn("CPU poller: initial read failed", "err", err)
 			}
 
 			for {
@@ -101,7 +102,7 @@ func startCPUPoller() {
 
 				cur, err := readCPUStats()
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "CPU poller: read error: %v\n", err)
+					slog.Warn("CPU poller: read failed", "err", err)
 					continue
 				}
 
@@ -140,7 +141,7 @@ func getCPUUsage() int {
 
 	s1, err := readCPUStats()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading CPU stats: %v\n", err)
+		slog.Error("failed to read CPU stats", "err", err)
 		return 0
 	}
 
@@ -148,7 +149,7 @@ func getCPUUsage() int {
 
 	s2, err := readCPUStats()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading CPU stats: %v\n", err)
+		slog.Error("failed to read CPU stats", "err", err)
 		return 0
 	}
 
@@ -172,19 +173,19 @@ func getStorageMetrics() (float64, float64, float64) {
 
 		The function uses the unix.Statfs system call to gather filesystem information.
 		If an error occurs (for example, failing to get the working directory or filesystem stats),
-		the function prints the error to stderr and returns zeros for all values.
+		the function logs the error and returns zeros for all values.
 	*/
 
 	wd, err := os.Getwd()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting pwd: %v\n", err)
+		slog.Error("failed to get working directory", "err", err)
 		return 0, 0, 0
 	}
 
 	var statfs unix.Statfs_t
 	err = unix.Statfs(wd, &statfs)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting statfs for %s: %v\n", wd, err)
+		slog.Error("failed to get file system stats", "path", wd, "err", err)
 		return 0, 0, 0
 	}
 
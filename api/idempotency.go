@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// IdempotencyKeyHeader carries a client-chosen key that makes retrying a
+// creating request safe: the server runs the first request with a key and
+// replays its response to every retry with the same key and body.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayHeader is set on replayed responses.
+const idempotentReplayHeader = "Idempotent-Replayed"
+
+// idempotentRoutes lists the creating POST routes that honour an
+// Idempotency-Key, keyed like routePermissions.
+var idempotentRoutes = map[string]bool{
+	"/user/create-user":        true,
+	"/user/create-token":       true,
+	"/user/rotate-signing-key": true,
+	"/pull-and-run":            true,
+	"/pull-and-run-stream":     true,
+	"/create-function":         true,
+	"/create-bucket":           true,
+	"/create-pipeline":         true,
+	"/run-pipeline/":           true,
+	"/create-webhook":          true,
+	"/create-project":          true,
+}
+
+// idempotencyWindow is how long a response is kept for replay.  It is a
+// variable so tests can shorten it.
+var idempotencyWindow = 24 * time.Hour
+
+// Limits on what Idempotent stores: keys, request bodies and responses
+// beyond these are refused or not replayed.
+const (
+	maxIdempotencyKeyLength    = 255
+	maxIdempotentBodyBytes     = 1 << 20
+	maxIdempotentResponseBytes = 1 << 20
+)
+
+// idempotentResponse is the first response to a request with a key, or a
+// placeholder while that request is still running.
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte
+	expires     time.Time
+	done        bool
+	// tooLarge marks a response that completed but was not kept because it
+	// exceeded maxIdempotentResponseBytes.
+	tooLarge bool
+	status   int
+	header   http.Header
+	body     []byte
+}
+
+// idempotencyStore holds responses by user and key.  It lives in memory, so
+// keys are forgotten when the server restarts.
+var idempotencyStore = struct {
+	sync.Mutex
+	responses map[string]*idempotentResponse
+}{responses: map[string]*idempotentResponse{}}
+
+// isIdempotentRoute reports whether path is in idempotentRoutes, matching
+// prefix routes like lookupRoutePermission.
+func isIdempotentRoute(path string) bool {
+	if idempotentRoutes[path] {
+		return true
+	}
+	for pattern := range idempotentRoutes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// validIdempotencyKey accepts 1 to 255 printable ASCII characters.
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyFingerprint identifies what a request asks for, so a key reused
+// for a different request can be told apart from a retry.
+func idempotencyFingerprint(r *http.Request, body []byte) [sha256.Size]byte {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	h.Write(body)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// Idempotent wraps next, the mux behind RequireAuth, so POST requests to a
+// route in idempotentRoutes that carry an Idempotency-Key run at most once
+// per user and key within idempotencyWindow.  A retry with the same key and
+// body gets the stored response, marked with Idempotent-Replayed: true; a
+// retry while the first request is still running gets 409, and the same key
+// with a different body 422.  Server errors and failed streams are not
+// kept, so the request can be retried.
+func Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost || !isIdempotentRoute(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			apierror.Respond(w, r, http.StatusBadRequest, "Idempotency-Key must be 1 to 255 printable ASCII characters")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apierror.Respond(w, r, http.StatusRequestEntityTooLarge, "request body too large for an idempotent request")
+				return
+			}
+			apierror.Respond(w, r, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		user, _ := AuthenticatedUser(r.Context())
+		storeKey := user + "\x00" + key
+		fingerprint := idempotencyFingerprint(r, body)
+		now := time.Now()
+
+		idempotencyStore.Lock()
+		for k, resp := range idempotencyStore.responses {
+			if now.After(resp.expires) {
+				delete(idempotencyStore.responses, k)
+			}
+		}
+		stored, ok := idempotencyStore.responses[storeKey]
+		if !ok {
+			stored = &idempotentResponse{fingerprint: fingerprint, expires: now.Add(idempotencyWindow)}
+			idempotencyStore.responses[storeKey] = stored
+		}
+		idempotencyStore.Unlock()
+
+		if ok {
+			replayIdempotentResponse(w, r, stored, fingerprint)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w, before: w.Header().Clone()}
+		completed := false
+		defer func() {
+			idempotencyStore.Lock()
+			defer idempotencyStore.Unlock()
+			if !completed || rec.status >= 500 || rec.streamFailed {
+				delete(idempotencyStore.responses, storeKey)
+				return
+			}
+			stored.done = true
+			stored.tooLarge = rec.tooLarge
+			stored.status = rec.status
+			stored.header = rec.header
+			if !rec.tooLarge {
+				stored.body = rec.body.Bytes()
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.WriteHeader(http.StatusOK)
+		}
+		completed = true
+	})
+}
+
+// replayIdempotentResponse answers a retry of the request stored holds.
+func replayIdempotentResponse(w http.ResponseWriter, r *http.Request, stored *idempotentResponse, fingerprint [sha256.Size]byte) {
+	idempotencyStore.Lock()
+	resp := *stored
+	idempotencyStore.Unlock()
+
+	switch {
+	case resp.fingerprint != fingerprint:
+		apierror.Write(w, r, apierror.New(http.StatusUnprocessableEntity,
+			"Idempotency-Key was already used for a different request").WithCode(apierror.CodeIdempotencyKeyReused))
+	case !resp.done:
+		w.Header().Set("Retry-After", "1")
+		apierror.Write(w, r, apierror.New(http.StatusConflict,
+			"a request with this Idempotency-Key is still in progress").WithCode(apierror.CodeIdempotencyKeyInUse))
+	case resp.tooLarge:
+		apierror.Respond(w, r, http.StatusConflict, "a request with this Idempotency-Key already completed, but its response is too large to replay")
+	default:
+		for name, values := range resp.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(idempotentReplayHeader, "true")
+		w.WriteHeader(resp.status)
+		w.Write(resp.body)
+	}
+}
+
+// idempotencyRecorder passes a response through while keeping a copy of its
+// status, the headers the handler set and the body.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	// before is the header as it was before the handler ran.
+	before       http.Header
+	status       int
+	header       http.Header
+	body         bytes.Buffer
+	tooLarge     bool
+	streamFailed bool
+}
+
+func (w *idempotencyRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = http.Header{}
+		for name, values := range w.ResponseWriter.Header() {
+			if name != apierror.RequestIDHeader && !slices.Equal(w.before[name], values) {
+				w.header[name] = append([]string(nil), values...)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotencyRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if bytes.HasPrefix(p, []byte("event: error\n")) {
+		w.streamFailed = true
+	}
+	if !w.tooLarge {
+		if w.body.Len()+len(p) > maxIdempotentResponseBytes {
+			w.tooLarge = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush keeps server-sent events working through the wrapper.
+func (w *idempotencyRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *idempotencyRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// resetIdempotencyStore empties the store before and after the test.
+func resetIdempotencyStore(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		idempotencyStore.Lock()
+		idempotencyStore.responses = map[string]*idempotentResponse{}
+		idempotencyStore.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// serveIdempotent sends a POST as user through Idempotent to handler.
+func serveIdempotent(handler http.Handler, user, target, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	req = req.WithContext(withAuthenticatedClaims(req.Context(), &tokenClaims{Subject: user}))
+	w := httptest.NewRecorder()
+	Idempotent(handler).ServeHTTP(w, req)
+	return w
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var e apierror.Error
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatalf("decoding error body %q: %v", w.Body.String(), err)
+	}
+	return e.Code
+}
+
+func TestIdempotentReplaysFirstResponse(t *testing.T) {
+	resetIdempotencyStore(t)
+	var calls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]int32{"call": n})
+	})
+
+	first := serveIdempotent(handler, "alice", "/create-pipeline", "key-1", `{"name":"build"}`)
+	retry := serveIdempotent(handler, "alice", "/create-pipeline", "key-1", `{"name":"build"}`)
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls.Load())
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %q, want %d %q", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get(idempotentReplayHeader) != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("retry headers = %v", retry.Header())
+	}
+	if first.Header().Get(idempotentReplayHeader) != "" {
+		t.Error("first response marked as replayed")
+	}
+
+	// The same key with another body is rejected; another user's key of
+	// the same name is independent.
+	if w := serveIdempotent(handler, "alice", "/create-pipeline", "key-1", `{"name":"deploy"}`); w.Code != http.StatusUnprocessableEntity || errorCode(t, w) != apierror.CodeIdempotencyKeyReused {
+		t.Errorf("different body = %d %s", w.Code, w.Body)
+	}
+	if w := serveIdempotent(handler, "bob", "/create-pipeline", "key-1", `{"name":"build"}`); w.Code != http.StatusCreated || calls.Load() != 2 {
+		t.Errorf("other user = %d after %d calls", w.Code, calls.Load())
+	}
+
+	// Without a key, or on a route that does not create, nothing is kept.
+	serveIdempotent(handler, "alice", "/create-pipeline", "", `{"name":"build"}`)
+	serveIdempotent(handler, "alice", "/delete-pipeline/1", "key-2", "")
+	serveIdempotent(handler, "alice", "/delete-pipeline/1", "key-2", "")
+	if calls.Load() != 5 {
+		t.Errorf("handler ran %d times, want 5", calls.Load())
+	}
+}
+
+func TestIdempotentRetriesServerErrors(t *testing.T) {
+	resetIdempotencyStore(t)
+	var calls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			apierror.Respond(w, r, http.StatusInternalServerError, "podman went away")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	serveIdempotent(handler, "alice", "/pull-and-run", "key-1", `{"image":"nginx"}`)
+	if w := serveIdempotent(handler, "alice", "/pull-and-run", "key-1", `{"image":"nginx"}`); w.Code != http.StatusCreated {
+		t.Errorf("retry after a server error = %d, want it to run again", w.Code)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2", calls.Load())
+	}
+}
+
+func TestIdempotentRejectsConcurrentRetry(t *testing.T) {
+	resetIdempotencyStore(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serveIdempotent(handler, "alice", "/create-function", "key-1", `{}`) }()
+	<-started
+	w := serveIdempotent(handler, "alice", "/create-function", "key-1", `{}`)
+	if w.Code != http.StatusConflict || errorCode(t, w) != apierror.CodeIdempotencyKeyInUse {
+		t.Errorf("concurrent retry = %d %s", w.Code, w.Body)
+	}
+	close(release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("first request = %d", first.Code)
+	}
+}
+
+func TestIdempotentRejectsInvalidKey(t *testing.T) {
+	resetIdempotencyStore(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran for an invalid key")
+	})
+	if w := serveIdempotent(handler, "alice", "/create-bucket", strings.Repeat("k", 256), `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("long key = %d, want 400", w.Code)
+	}
+}
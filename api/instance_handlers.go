@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
 	"github.com/WavexSoftware/OpenCloud/service_ledger"
 )
 
@@ -92,13 +93,13 @@ type SetInstanceDomainResponse struct {
 // Response: {"domain": "<value>"}
 func GetInstanceDomainHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	domain, err := service_ledger.GetInstanceDomain()
 	if err != nil {
-		http.Error(w, "Failed to read instance domain: "+err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to read instance domain")
 		return
 	}
 
@@ -116,7 +117,7 @@ func GetInstanceDomainHandler(w http.ResponseWriter, r *http.Request) {
 // Response:     SetInstanceDomainResponse
 func SetInstanceDomainHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -125,23 +126,23 @@ func SetInstanceDomainHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON body")
 		return
 	}
 
 	if req.Domain == "" {
-		http.Error(w, "Missing required field: domain", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing required field: domain")
 		return
 	}
 
 	if !isValidDomain(req.Domain) {
-		http.Error(w, "Invalid domain name", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid domain name")
 		return
 	}
 
 	// Persist the domain in the service ledger.
 	if err := service_ledger.SetInstanceDomain(req.Domain); err != nil {
-		http.Error(w, "Failed to save domain: "+err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to save domain")
 		return
 	}
 
@@ -182,13 +183,13 @@ type ConfigureSSLResponse struct {
 // Response: {"email": "<value>"}
 func GetSSLStatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	email, err := service_ledger.GetInstanceSSLEmail()
 	if err != nil {
-		http.Error(w, "Failed to read SSL status: "+err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to read SSL status")
 		return
 	}
 
@@ -206,23 +207,23 @@ func GetSSLStatusHandler(w http.ResponseWriter, r *http.Request) {
 // Response:     ConfigureSSLResponse
 func ConfigureSSLHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req ConfigureSSLRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON body")
 		return
 	}
 
 	if req.Domain == "" {
-		http.Error(w, "Missing required field: domain", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing required field: domain")
 		return
 	}
 
 	if !isValidDomain(req.Domain) {
-		http.Error(w, "Invalid domain name", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid domain name")
 		return
 	}
 
@@ -0,0 +1,253 @@
+// Package listing implements the pagination, filtering and sorting shared by
+// the list endpoints.  A list request may carry
+//
+//	limit=N       return at most N items, 1 to 1000; without it every item is returned
+//	cursor=C      continue after the page whose response carried C in X-Next-Cursor
+//	sort=FIELD    order by FIELD, or by -FIELD for descending order
+//	FILTER=VALUE  keep only matching items; a repeated filter must match every value
+//
+// Items with equal sort values are ordered by their key, and a cursor holds
+// the sort value and key of the last item of its page rather than an offset,
+// so following the cursors returns every item that exists throughout exactly
+// once, even when other items are added or removed in between.
+package listing
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// NextCursorHeader carries the cursor of the next page.  It is absent on the
+// last page.
+const NextCursorHeader = "X-Next-Cursor"
+
+// MaxLimit is the largest page size a request may ask for.
+const MaxLimit = 1000
+
+// Field is a sort field.  Exactly one of String and Int is set.
+type Field[T any] struct {
+	String func(T) string
+	Int    func(T) int64
+}
+
+// Filter reports whether item matches value, one value of a filter parameter.
+type Filter[T any] func(item T, value string) bool
+
+// Spec describes how the items of one endpoint are listed.
+type Spec[T any] struct {
+	// Key returns a stable value unique to item, which orders items with
+	// equal sort values.
+	Key func(item T) string
+	// Sorts maps the accepted sort fields to their values.
+	Sorts map[string]Field[T]
+	// DefaultSort is the sort used when a request names none, e.g. "name"
+	// or "-created".
+	DefaultSort string
+	// Filters maps the accepted filter parameters to their predicates.
+	Filters map[string]Filter[T]
+}
+
+// Query is a parsed list request.
+type Query struct {
+	// Limit is the page size; 0 returns every item.
+	Limit int
+	// Sort is the sort field and Desc whether the order is descending.
+	Sort string
+	Desc bool
+
+	filters url.Values
+	after   *cursor
+}
+
+// cursor is the position after the last item of a page, in the order of the
+// page's query.
+type cursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Str  string `json:"v,omitempty"`
+	Int  int64  `json:"n,omitempty"`
+	Key  string `json:"k"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Parse reads the limit, cursor, sort and filter parameters of a request.
+// Query parameters that are none of these are left to the handler.
+func (s Spec[T]) Parse(params url.Values) (Query, *apierror.Error) {
+	q := Query{filters: url.Values{}}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return q, apierror.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", MaxLimit))
+		}
+		q.Limit = n
+	}
+
+	sort := params.Get("sort")
+	if sort == "" {
+		sort = s.DefaultSort
+	}
+	q.Sort, q.Desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	if _, ok := s.Sorts[q.Sort]; !ok {
+		fields := make([]string, 0, len(s.Sorts))
+		for name := range s.Sorts {
+			fields = append(fields, name)
+		}
+		slices.Sort(fields)
+		return q, apierror.New(http.StatusBadRequest, fmt.Sprintf("unknown sort field %q; use one of %s, optionally prefixed with -", q.Sort, strings.Join(fields, ", ")))
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		after, err := decodeCursor(v)
+		if err != nil {
+			return q, apierror.New(http.StatusBadRequest, "invalid cursor")
+		}
+		if after.Sort != q.Sort || after.Desc != q.Desc {
+			return q, apierror.New(http.StatusBadRequest, "cursor belongs to a different sort order")
+		}
+		q.after = after
+	}
+
+	for name := range s.Filters {
+		for _, v := range params[name] {
+			if v != "" {
+				q.filters.Add(name, v)
+			}
+		}
+	}
+	return q, nil
+}
+
+// compare orders a and b by the query's sort field and then by key.
+func (s Spec[T]) compare(q Query, a, b T) int {
+	f := s.Sorts[q.Sort]
+	c := 0
+	if f.Int != nil {
+		c = cmp.Compare(f.Int(a), f.Int(b))
+	} else {
+		c = strings.Compare(f.String(a), f.String(b))
+	}
+	if c == 0 {
+		c = strings.Compare(s.Key(a), s.Key(b))
+	}
+	if q.Desc {
+		return -c
+	}
+	return c
+}
+
+// compareToCursor orders item against the position after.
+func (s Spec[T]) compareToCursor(q Query, item T, after *cursor) int {
+	f := s.Sorts[q.Sort]
+	c := 0
+	if f.Int != nil {
+		c = cmp.Compare(f.Int(item), after.Int)
+	} else {
+		c = strings.Compare(f.String(item), after.Str)
+	}
+	if c == 0 {
+		c = strings.Compare(s.Key(item), after.Key)
+	}
+	if q.Desc {
+		return -c
+	}
+	return c
+}
+
+// match reports whether item passes every filter of q.
+func (s Spec[T]) match(q Query, item T) bool {
+	for name, values := range q.filters {
+		for _, v := range values {
+			if !s.Filters[name](item, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Apply filters and sorts items, which it reorders, and returns the page q
+// asks for together with the cursor of the next page, or "" on the last page.
+func (s Spec[T]) Apply(q Query, items []T) ([]T, string) {
+	items = slices.DeleteFunc(items, func(item T) bool { return !s.match(q, item) })
+	slices.SortFunc(items, func(a, b T) int { return s.compare(q, a, b) })
+
+	if q.after != nil {
+		start, _ := slices.BinarySearchFunc(items, q.after, func(item T, after *cursor) int {
+			// Items at the cursor belong to the previous page.
+			if c := s.compareToCursor(q, item, after); c != 0 {
+				return c
+			}
+			return -1
+		})
+		items = items[start:]
+	}
+	if q.Limit == 0 || len(items) <= q.Limit {
+		return items, ""
+	}
+
+	items = items[:q.Limit]
+	last := items[len(items)-1]
+	next := cursor{Sort: q.Sort, Desc: q.Desc, Key: s.Key(last)}
+	if f := s.Sorts[q.Sort]; f.Int != nil {
+		next.Int = f.Int(last)
+	} else {
+		next.Str = f.String(last)
+	}
+	return items, next.encode()
+}
+
+// SetNextCursor sets the X-Next-Cursor header unless next is empty.
+func SetNextCursor(w http.ResponseWriter, next string) {
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+}
+
+// Prefix returns a filter keeping items whose value starts with the filter
+// value.
+func Prefix[T any](value func(T) string) Filter[T] {
+	return func(item T, prefix string) bool { return strings.HasPrefix(value(item), prefix) }
+}
+
+// Equal returns a filter keeping items whose value equals the filter value,
+// ignoring case.
+func Equal[T any](value func(T) string) Filter[T] {
+	return func(item T, want string) bool { return strings.EqualFold(value(item), want) }
+}
+
+// Label returns a filter keeping items that have the label named by the
+// filter value, or, for a value of the form key=value, that label with that
+// value.
+func Label[T any](labels func(T) map[string]string) Filter[T] {
+	return func(item T, want string) bool {
+		key, value, hasValue := strings.Cut(want, "=")
+		got, ok := labels(item)[key]
+		return ok && (!hasValue || got == value)
+	}
+}
@@ -0,0 +1,173 @@
+package listing
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+type item struct {
+	Name   string
+	Size   int64
+	State  string
+	Labels map[string]string
+}
+
+var testSpec = Spec[item]{
+	Key: func(it item) string { return it.Name },
+	Sorts: map[string]Field[item]{
+		"name":  {String: func(it item) string { return it.Name }},
+		"size":  {Int: func(it item) int64 { return it.Size }},
+		"state": {String: func(it item) string { return it.State }},
+	},
+	DefaultSort: "name",
+	Filters: map[string]Filter[item]{
+		"state":  Equal(func(it item) string { return it.State }),
+		"prefix": Prefix(func(it item) string { return it.Name }),
+		"label":  Label(func(it item) map[string]string { return it.Labels }),
+	},
+}
+
+// testItems returns n items whose sizes repeat, so sorting by size has ties.
+func testItems(n int) []item {
+	items := make([]item, n)
+	for i := range items {
+		state := "running"
+		if i%3 == 0 {
+			state = "exited"
+		}
+		items[i] = item{Name: fmt.Sprintf("item-%02d", n-1-i), Size: int64(i % 4), State: state}
+	}
+	return items
+}
+
+func names(items []item) []string {
+	out := make([]string, len(items))
+	for i, it := range items {
+		out[i] = it.Name
+	}
+	return out
+}
+
+// walk follows the cursors of query from the first page to the last,
+// calling between with the names seen so far after each page, and returns
+// the names seen.
+func walk(t *testing.T, items func() []item, query string, between func(seen []string)) []string {
+	t.Helper()
+	var seen []string
+	params, _ := url.ParseQuery(query)
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("pagination did not terminate")
+		}
+		q, err := testSpec.Parse(params)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", params.Encode(), err)
+		}
+		page, next := testSpec.Apply(q, items())
+		seen = append(seen, names(page)...)
+		if next == "" {
+			return seen
+		}
+		params.Set("cursor", next)
+		if between != nil {
+			between(seen)
+		}
+	}
+}
+
+func TestPagesAreStable(t *testing.T) {
+	all := testItems(23)
+	for _, sort := range []string{"name", "-name", "size", "-size", "state"} {
+		t.Run(sort, func(t *testing.T) {
+			q, _ := testSpec.Parse(url.Values{"sort": {sort}})
+			want, _ := testSpec.Apply(q, slices.Clone(all))
+
+			got := walk(t, func() []item { return slices.Clone(all) }, "limit=4&sort="+url.QueryEscape(sort), nil)
+			if !slices.Equal(got, names(want)) {
+				t.Errorf("pages = %v, want %v", got, names(want))
+			}
+		})
+	}
+}
+
+func TestPagesSurviveChanges(t *testing.T) {
+	current := testItems(10)
+	original := names(current)
+	added := 0
+	between := func(seen []string) {
+		// Remove an item already returned, and add one sorting before, one
+		// sorting after and one among what has been seen.
+		added++
+		current = slices.DeleteFunc(current, func(it item) bool { return it.Name == seen[0] })
+		current = append(current,
+			item{Name: fmt.Sprintf("aaa-%d", added), Size: 0},
+			item{Name: fmt.Sprintf("zzz-%d", added), Size: 3},
+			item{Name: fmt.Sprintf("mmm-%d", added), Size: 1},
+		)
+	}
+
+	got := walk(t, func() []item { return slices.Clone(current) }, "limit=3&sort=size", between)
+	seen := map[string]int{}
+	for _, name := range got {
+		seen[name]++
+	}
+	for _, name := range original {
+		if seen[name] != 1 {
+			t.Errorf("%s seen %d times, want once", name, seen[name])
+		}
+	}
+	for name, n := range seen {
+		if n > 1 {
+			t.Errorf("%s seen %d times", name, n)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	items := []item{
+		{Name: "web-1", State: "running", Labels: map[string]string{"app": "web", "tier": "front"}},
+		{Name: "web-2", State: "exited", Labels: map[string]string{"app": "web"}},
+		{Name: "db-1", State: "Running", Labels: map[string]string{"app": "db"}},
+	}
+	for query, want := range map[string][]string{
+		"state=running":                 {"db-1", "web-1"},
+		"prefix=web-":                   {"web-1", "web-2"},
+		"label=app=web":                 {"web-1", "web-2"},
+		"label=app=web&label=tier":      {"web-1"},
+		"label=app":                     {"db-1", "web-1", "web-2"},
+		"state=exited&prefix=db":        nil,
+		"prefix=web&sort=-name&limit=1": {"web-2"},
+	} {
+		params, _ := url.ParseQuery(query)
+		q, err := testSpec.Parse(params)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", query, err)
+		}
+		got, _ := testSpec.Apply(q, slices.Clone(items))
+		if !slices.Equal(names(got), want) && !(len(got) == 0 && len(want) == 0) {
+			t.Errorf("%s = %v, want %v", query, names(got), want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidParameters(t *testing.T) {
+	q, _ := testSpec.Parse(url.Values{"limit": {"1"}})
+	_, next := testSpec.Apply(q, testItems(3))
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=1001",
+		"limit=ten",
+		"sort=color",
+		"cursor=not-a-cursor",
+		"sort=-name&cursor=" + next,
+	} {
+		params, _ := url.ParseQuery(query)
+		if _, err := testSpec.Parse(params); err == nil || err.Status != http.StatusBadRequest {
+			t.Errorf("Parse(%s) = %v, want a 400 error", query, err)
+		}
+	}
+}
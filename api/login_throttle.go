@@ -0,0 +1,314 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// loginThrottlePolicy controls how failed logins are limited for one kind of
+// key (a username or a client IP).  Up to Threshold failures are free; each
+// further failure locks the key for BaseLockout, doubling per failure up to
+// MaxLockout.  Failures are forgotten after ResetAfter without new failures.
+type loginThrottlePolicy struct {
+	Threshold   int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	ResetAfter  time.Duration
+}
+
+// Throttle policies for usernames and client IPs.  The IP limit is looser
+// because several users may share an address.  They are variables so tests
+// can shorten them.
+var (
+	userLoginPolicy = loginThrottlePolicy{
+		Threshold:   5,
+		BaseLockout: 30 * time.Second,
+		MaxLockout:  30 * time.Minute,
+		ResetAfter:  time.Hour,
+	}
+	clientLoginPolicy = loginThrottlePolicy{
+		Threshold:   20,
+		BaseLockout: 30 * time.Second,
+		MaxLockout:  30 * time.Minute,
+		ResetAfter:  time.Hour,
+	}
+)
+
+// loginAttempts tracks failed logins for one key.
+type loginAttempts struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil,omitempty"`
+}
+
+// loginThrottleFile is the on-disk layout of ~/.opencloud/user/login_attempts.json.
+type loginThrottleFile struct {
+	Users   map[string]loginAttempts `json:"users"`
+	Clients map[string]loginAttempts `json:"clients"`
+}
+
+// loginThrottleMutex serialises read-modify-write cycles on the attempts file.
+var loginThrottleMutex sync.Mutex
+
+// loginAttemptsPath returns the path to the persisted login attempts file.
+func loginAttemptsPath() (string, error) {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "user", "login_attempts.json"), nil
+}
+
+// readLoginThrottleFile loads the attempts file, returning an empty store when
+// it does not exist yet.
+func readLoginThrottleFile() (*loginThrottleFile, error) {
+	path, err := loginAttemptsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &loginThrottleFile{
+		Users:   make(map[string]loginAttempts),
+		Clients: make(map[string]loginAttempts),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("malformed login attempts file: %w", err)
+	}
+	if store.Users == nil {
+		store.Users = make(map[string]loginAttempts)
+	}
+	if store.Clients == nil {
+		store.Clients = make(map[string]loginAttempts)
+	}
+	return store, nil
+}
+
+// writeLoginThrottleFile drops stale entries and atomically replaces the
+// attempts file.  Callers must hold loginThrottleMutex.
+func writeLoginThrottleFile(store *loginThrottleFile, now time.Time) error {
+	path, err := loginAttemptsPath()
+	if err != nil {
+		return err
+	}
+
+	pruneLoginAttempts(store.Users, userLoginPolicy, now)
+	pruneLoginAttempts(store.Clients, clientLoginPolicy, now)
+
+	data, err := json.MarshalIndent(store, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// pruneLoginAttempts removes entries that are neither locked nor recent
+// enough to count any more.
+func pruneLoginAttempts(entries map[string]loginAttempts, policy loginThrottlePolicy, now time.Time) {
+	for key, a := range entries {
+		if now.After(a.LockedUntil) && now.Sub(a.LastFailure) > policy.ResetAfter {
+			delete(entries, key)
+		}
+	}
+}
+
+// lockoutFor returns how long a key is locked after its n-th failure.
+func (p loginThrottlePolicy) lockoutFor(failures int) time.Duration {
+	over := failures - p.Threshold
+	if over <= 0 {
+		return 0
+	}
+	// Cap the exponent; MaxLockout is reached long before 2^30 anyway.
+	backoff := float64(p.BaseLockout) * math.Pow(2, float64(min(over-1, 30)))
+	if backoff > float64(p.MaxLockout) {
+		return p.MaxLockout
+	}
+	return time.Duration(backoff)
+}
+
+// recordFailure returns a with one more failure counted.
+func (p loginThrottlePolicy) recordFailure(a loginAttempts, now time.Time) loginAttempts {
+	if now.Sub(a.LastFailure) > p.ResetAfter {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailure = now
+	if lockout := p.lockoutFor(a.Failures); lockout > 0 {
+		a.LockedUntil = now.Add(lockout)
+	}
+	return a
+}
+
+// releaseFailure returns a with one failure taken back, undoing a
+// reservation whose attempt did not fail.
+func (p loginThrottlePolicy) releaseFailure(a loginAttempts) loginAttempts {
+	if a.Failures > 0 {
+		a.Failures--
+	}
+	a.LockedUntil = time.Time{}
+	if lockout := p.lockoutFor(a.Failures); lockout > 0 {
+		a.LockedUntil = a.LastFailure.Add(lockout)
+	}
+	return a
+}
+
+// throttlesClient reports whether failed logins are limited per client for
+// clientIP.  A loopback address is usually a reverse proxy that is not
+// listed in the trusted proxies, so every user would share its lockout;
+// those logins are limited per user only.
+func throttlesClient(clientIP string) bool {
+	addr, err := netip.ParseAddr(clientIP)
+	return err != nil || !addr.Unmap().IsLoopback()
+}
+
+// reserveLoginAttempt checks whether username may try a password or second
+// factor from clientIP and, if so, counts the attempt as a failure before it
+// is verified.  Checking and counting under one lock means parallel guesses
+// cannot all pass the check before any of them is recorded.  It returns how
+// long the caller must wait when locked out, in which case nothing is
+// counted.  An attempt that turns out not to fail is handed back with
+// releaseLoginAttempt.
+func reserveLoginAttempt(username, clientIP string, now time.Time) (time.Duration, error) {
+	loginThrottleMutex.Lock()
+	defer loginThrottleMutex.Unlock()
+
+	store, err := readLoginThrottleFile()
+	if err != nil {
+		return 0, err
+	}
+
+	throttleClient := throttlesClient(clientIP)
+	locks := []time.Time{store.Users[username].LockedUntil}
+	if throttleClient {
+		locks = append(locks, store.Clients[clientIP].LockedUntil)
+	}
+	var wait time.Duration
+	for _, lockedUntil := range locks {
+		if d := lockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+
+	store.Users[username] = userLoginPolicy.recordFailure(store.Users[username], now)
+	if throttleClient {
+		store.Clients[clientIP] = clientLoginPolicy.recordFailure(store.Clients[clientIP], now)
+	}
+	return 0, writeLoginThrottleFile(store, now)
+}
+
+// releaseLoginAttempt takes back an attempt counted by reserveLoginAttempt
+// that did not fail.  With clearUser, as after a complete login, every
+// failure recorded for username is forgotten as well.  The client IP only
+// loses the reservation so one valid account cannot be used to reset an
+// address that is guessing passwords for others.
+func releaseLoginAttempt(username, clientIP string, clearUser bool) error {
+	loginThrottleMutex.Lock()
+	defer loginThrottleMutex.Unlock()
+
+	store, err := readLoginThrottleFile()
+	if err != nil {
+		return err
+	}
+	if a, ok := store.Users[username]; ok {
+		if a = userLoginPolicy.releaseFailure(a); clearUser || a.Failures == 0 {
+			delete(store.Users, username)
+		} else {
+			store.Users[username] = a
+		}
+	}
+	if a, ok := store.Clients[clientIP]; ok && throttlesClient(clientIP) {
+		if a = clientLoginPolicy.releaseFailure(a); a.Failures == 0 {
+			delete(store.Clients, clientIP)
+		} else {
+			store.Clients[clientIP] = a
+		}
+	}
+	return writeLoginThrottleFile(store, time.Now())
+}
+
+// releaseLoginAttemptOrWarn calls releaseLoginAttempt for a handler, which
+// goes ahead even if the attempt could not be handed back.
+func releaseLoginAttemptOrWarn(r *http.Request, username, clientIP string, clearUser bool) {
+	if err := releaseLoginAttempt(username, clientIP, clearUser); err != nil {
+		slog.WarnContext(r.Context(), "failed to release login attempt", "user", username, "err", err)
+	}
+}
+
+// clearLoginFailures forgets the failures recorded for username, leaving
+// the client IPs alone.
+func clearLoginFailures(username string) (bool, error) {
+	loginThrottleMutex.Lock()
+	defer loginThrottleMutex.Unlock()
+
+	store, err := readLoginThrottleFile()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := store.Users[username]; !ok {
+		return false, nil
+	}
+	delete(store.Users, username)
+	return true, writeLoginThrottleFile(store, time.Now())
+}
+
+// writeTooManyAttempts sends a 429 with a Retry-After header in whole seconds.
+func writeTooManyAttempts(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	apierror.Write(w, r, apierror.New(http.StatusTooManyRequests,
+		fmt.Sprintf("too many failed login attempts, try again in %d seconds", seconds),
+	).WithDetails(map[string]int{"retryAfter": seconds}))
+}
+
+// UnlockUser handles POST /user/unlock-user.
+// It clears the failed login attempts and any lockout for an account.
+//
+// Request body: {"username": "..."}
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req usernameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "username is required")
+		return
+	}
+
+	cleared, err := clearLoginFailures(req.Username)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to unlock user")
+		return
+	}
+	if !cleared {
+		writeJSON(w, http.StatusOK, map[string]string{"message": "user was not locked", "username": req.Username})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "user unlocked", "username": req.Username})
+}
@@ -0,0 +1,310 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// attemptLogin posts a login from the given client address.
+func attemptLogin(username, password, remoteAddr string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(loginRequest{Username: username, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/user/login", bytes.NewBuffer(body))
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	Login(w, req)
+	return w
+}
+
+// TestLockoutBackoff verifies that lockouts start after the threshold and
+// double with each further failure up to the maximum.
+func TestLockoutBackoff(t *testing.T) {
+	p := loginThrottlePolicy{Threshold: 3, BaseLockout: time.Second, MaxLockout: 5 * time.Second}
+
+	want := map[int]time.Duration{
+		1:  0,
+		3:  0,
+		4:  time.Second,
+		5:  2 * time.Second,
+		6:  4 * time.Second,
+		7:  5 * time.Second,
+		99: 5 * time.Second,
+	}
+	for failures, d := range want {
+		if got := p.lockoutFor(failures); got != d {
+			t.Errorf("lockoutFor(%d) = %v, want %v", failures, got, d)
+		}
+	}
+}
+
+// TestLoginLockout verifies that repeated failures lock the account with a
+// 429 and Retry-After, even for the correct password.
+func TestLoginLockout(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	for i := 0; i < userLoginPolicy.Threshold+1; i++ {
+		if w := attemptLogin("admin", "wrong", "10.0.0.1:1234"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected %d, got %d", i+1, http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	w := attemptLogin("admin", "admin", "10.0.0.2:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusTooManyRequests, w.Code, w.Body.String())
+	}
+	retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retry <= 0 || time.Duration(retry)*time.Second > userLoginPolicy.BaseLockout {
+		t.Errorf("unexpected Retry-After %q", w.Header().Get("Retry-After"))
+	}
+}
+
+// TestLoginLockoutPerClient verifies that one address guessing many
+// usernames gets locked out.
+func TestLoginLockoutPerClient(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	for i := 0; i < clientLoginPolicy.Threshold+1; i++ {
+		attemptLogin("user"+strconv.Itoa(i), "wrong", "10.0.0.9:1234")
+	}
+
+	if w := attemptLogin("admin", "admin", "10.0.0.9:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("locked client: expected %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w := attemptLogin("admin", "admin", "10.0.0.10:1234"); w.Code != http.StatusOK {
+		t.Errorf("other client: expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// TestLoginLockoutLoopbackClient verifies that logins through an untrusted
+// local proxy are limited per user only, so one user guessing passwords
+// cannot lock everyone else out.
+func TestLoginLockoutLoopbackClient(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	for i := 0; i < clientLoginPolicy.Threshold+1; i++ {
+		attemptLogin("user"+strconv.Itoa(i), "wrong", "127.0.0.1:1234")
+	}
+	if w := attemptLogin("admin", "admin", "127.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("other user through the proxy: expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	for i := 0; i < userLoginPolicy.Threshold+1; i++ {
+		attemptLogin("admin", "wrong", "127.0.0.1:1234")
+	}
+	if w := attemptLogin("admin", "admin", "[::1]:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("locked user through the proxy: expected %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+// TestLoginLockoutBehindTrustedProxy verifies that the client address is
+// taken from the forwarding headers of a trusted proxy only.
+func TestLoginLockoutBehindTrustedProxy(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+	SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	forwarded := func(username, password, remoteAddr, client string) int {
+		body, _ := json.Marshal(loginRequest{Username: username, Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/user/login", bytes.NewBuffer(body))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", client)
+		w := httptest.NewRecorder()
+		Login(w, req)
+		return w.Code
+	}
+	for i := 0; i < clientLoginPolicy.Threshold+1; i++ {
+		forwarded("user"+strconv.Itoa(i), "wrong", "127.0.0.1:1234", "203.0.113.7")
+	}
+	if code := forwarded("admin", "admin", "127.0.0.1:1234", "203.0.113.7"); code != http.StatusTooManyRequests {
+		t.Errorf("locked client through the proxy: expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+	if code := forwarded("admin", "admin", "127.0.0.1:1234", "203.0.113.8"); code != http.StatusOK {
+		t.Errorf("other client through the proxy: expected %d, got %d", http.StatusOK, code)
+	}
+	// Anyone else cannot choose the address they are limited by.
+	if code := forwarded("admin", "admin", "192.0.2.1:1234", "203.0.113.8"); code != http.StatusOK {
+		t.Errorf("untrusted peer: expected %d, got %d", http.StatusOK, code)
+	}
+}
+
+// TestClientAddr verifies which address a request is attributed to.
+func TestClientAddr(t *testing.T) {
+	SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.0.0.0/8")})
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	for _, tc := range []struct {
+		name, remoteAddr, forwardedFor, realIP, want string
+	}{
+		{"direct", "192.0.2.1:1234", "", "", "192.0.2.1"},
+		{"untrusted peer", "192.0.2.1:1234", "203.0.113.7", "203.0.113.8", "192.0.2.1"},
+		{"trusted proxy", "127.0.0.1:1234", "203.0.113.7", "", "203.0.113.7"},
+		{"spoofed left entry", "127.0.0.1:1234", "198.51.100.1, 203.0.113.7", "", "203.0.113.7"},
+		{"proxy chain", "127.0.0.1:1234", "203.0.113.7, 10.1.1.1", "", "203.0.113.7"},
+		{"real ip", "127.0.0.1:1234", "", "203.0.113.8", "203.0.113.8"},
+		{"no header", "127.0.0.1:1234", "", "", "127.0.0.1"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		}
+		if tc.realIP != "" {
+			req.Header.Set("X-Real-IP", tc.realIP)
+		}
+		if got := clientAddr(req); got != tc.want {
+			t.Errorf("%s: clientAddr = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestLoginLockoutSurvivesRestart verifies lockouts are read back from disk.
+func TestLoginLockoutSurvivesRestart(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	now := time.Now()
+	for i := 0; i < userLoginPolicy.Threshold+1; i++ {
+		if _, err := reserveLoginAttempt("admin", "10.0.0.1", now); err != nil {
+			t.Fatalf("reserveLoginAttempt: %v", err)
+		}
+	}
+
+	// Nothing is cached in memory, so a fresh read is what a restarted
+	// server would see.
+	wait, err := reserveLoginAttempt("admin", "10.0.0.3", now)
+	if err != nil {
+		t.Fatalf("reserveLoginAttempt: %v", err)
+	}
+	if wait != userLoginPolicy.BaseLockout {
+		t.Errorf("expected wait %v, got %v", userLoginPolicy.BaseLockout, wait)
+	}
+}
+
+// TestSuccessfulLoginResetsFailures verifies that a correct password below
+// the threshold clears the failure count.
+func TestSuccessfulLoginResetsFailures(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	for i := 0; i < userLoginPolicy.Threshold; i++ {
+		attemptLogin("admin", "wrong", "10.0.0.1:1234")
+	}
+	if w := attemptLogin("admin", "admin", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := attemptLogin("admin", "wrong", "10.0.0.1:1234"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := attemptLogin("admin", "admin", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected counter to have been reset, got %d", w.Code)
+	}
+}
+
+// TestConcurrentLoginAttempts verifies that guesses sent in parallel cannot
+// all pass the lockout check before any failure is recorded.
+func TestConcurrentLoginAttempts(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	const attempts = 20
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- attemptLogin("admin", "wrong", "10.0.0.1:1234").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	if got, want := counts[http.StatusUnauthorized], userLoginPolicy.Threshold+1; got != want {
+		t.Errorf("%d passwords were checked, want %d (responses: %v)", got, want, counts)
+	}
+}
+
+// TestSuccessfulLoginsDoNotLockClient verifies that the attempt reserved
+// for a correct password is handed back to the client address.
+func TestSuccessfulLoginsDoNotLockClient(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	for i := 0; i < clientLoginPolicy.Threshold+2; i++ {
+		if w := attemptLogin("admin", "admin", "10.0.0.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("login %d: expected %d, got %d", i+1, http.StatusOK, w.Code)
+		}
+	}
+	store, err := readLoginThrottleFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := store.Clients["10.0.0.1"]; ok {
+		t.Errorf("client failures after successful logins = %+v", a)
+	}
+}
+
+// TestChangePasswordThrottled verifies that the current password cannot be
+// guessed through a session faster than through the login form.
+func TestChangePasswordThrottled(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	for i := 0; i < userLoginPolicy.Threshold+1; i++ {
+		w := serveUserRequest(t, ChangePassword, http.MethodPost, "/user/change-password", admin.AccessToken,
+			map[string]string{"currentPassword": "wrong", "newPassword": "a new password"})
+		if w.Code == http.StatusTooManyRequests {
+			t.Fatalf("attempt %d was throttled too early", i+1)
+		}
+	}
+
+	w := serveUserRequest(t, ChangePassword, http.MethodPost, "/user/change-password", admin.AccessToken,
+		map[string]string{"currentPassword": "admin", "newPassword": "a new password"})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusTooManyRequests, w.Code, w.Body.String())
+	}
+	if w := attemptLogin("admin", "admin", "10.0.0.2:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the login to share the lockout, got %d", w.Code)
+	}
+}
+
+// TestUnlockUser verifies that an admin can lift a lockout.
+func TestUnlockUser(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "alice", "correct-horse")
+
+	for i := 0; i < userLoginPolicy.Threshold+1; i++ {
+		attemptLogin("alice", "wrong", "10.0.0.1:1234")
+	}
+	if w := attemptLogin("alice", "correct-horse", "10.0.0.2:1234"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected lockout, got %d", w.Code)
+	}
+
+	w := serveUserRequest(t, UnlockUser, http.MethodPost, "/user/unlock-user", admin.AccessToken,
+		map[string]string{"username": "alice"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlock: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if w := attemptLogin("alice", "correct-horse", "10.0.0.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected login after unlock to succeed, got %d", w.Code)
+	}
+}
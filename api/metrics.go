@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/metrics"
+)
+
+// Histogram buckets, in seconds, for work that takes longer than a request.
+var (
+	functionBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+	pipelineBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+	buildBuckets    = []float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800}
+)
+
+// Metrics served at /metrics.  Counters and histograms are updated as work
+// happens; the gauges are refreshed on every scrape.
+var (
+	httpRequests = metrics.NewCounter("opencloud_http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "code")
+	httpRequestDuration = metrics.NewHistogram("opencloud_http_request_duration_seconds",
+		"HTTP request latency by route and method.", metrics.DefBuckets, "route", "method")
+
+	functionInvocations = metrics.NewCounter("opencloud_function_invocations_total",
+		"Function invocations by function and outcome.", "function", "outcome")
+	functionDuration = metrics.NewHistogram("opencloud_function_invocation_duration_seconds",
+		"Function run time by function.", functionBuckets, "function")
+
+	pipelineRuns = metrics.NewCounter("opencloud_pipeline_runs_total",
+		"Finished pipeline runs by pipeline and outcome.", "pipeline", "outcome")
+	pipelineDuration = metrics.NewHistogram("opencloud_pipeline_run_duration_seconds",
+		"Pipeline run time by pipeline.", pipelineBuckets, "pipeline")
+
+	imageBuildDuration = metrics.NewHistogram("opencloud_image_build_duration_seconds",
+		"Container image build time by outcome.", buildBuckets, "outcome")
+
+	containersByState = metrics.NewGauge("opencloud_containers",
+		"Containers by state.", "state")
+	podmanUp = metrics.NewGauge("opencloud_podman_up",
+		"Whether Podman answered the last container count.")
+
+	hostCPUUsage = metrics.NewGauge("opencloud_host_cpu_usage_percent",
+		"Host CPU usage over the last poll interval.")
+	hostDiskUsed = metrics.NewGauge("opencloud_host_disk_used_bytes",
+		"Used space on the filesystem holding the server's working directory.")
+	hostDiskAvailable = metrics.NewGauge("opencloud_host_disk_available_bytes",
+		"Space available to the server on the filesystem holding its working directory.")
+	hostDiskSize = metrics.NewGauge("opencloud_host_disk_size_bytes",
+		"Size of the filesystem holding the server's working directory.")
+)
+
+// countContainersByState returns how many containers Podman has in each
+// state.  Tests replace it.
+var countContainersByState = podmanContainerStates
+
+// outcomeLabel returns the outcome label for a finished job.
+func outcomeLabel(succeeded bool) string {
+	if succeeded {
+		return "success"
+	}
+	return "failed"
+}
+
+// RecordFunctionInvocation records one run of a function.
+func RecordFunctionInvocation(function string, succeeded bool, d time.Duration) {
+	functionInvocations.Inc(function, outcomeLabel(succeeded))
+	functionDuration.Observe(d.Seconds(), function)
+}
+
+// RecordImageBuild records one image build.
+func RecordImageBuild(succeeded bool, d time.Duration) {
+	imageBuildDuration.Observe(d.Seconds(), outcomeLabel(succeeded))
+}
+
+// recordPipelineRun records a finished pipeline run.
+func recordPipelineRun(pipeline string, succeeded bool, d time.Duration) {
+	pipelineRuns.Inc(pipeline, outcomeLabel(succeeded))
+	pipelineDuration.Observe(d.Seconds(), pipeline)
+}
+
+// InstrumentRoutes counts the requests next serves and their latency.  The
+// route label is the mux pattern the request matches, so prefix routes such
+// as /run-pipeline/ are not split per ID, and /api/v1 requests are counted
+// under the legacy route they translate onto.  Unknown paths share "other".
+func InstrumentRoutes(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "other"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+		}
+
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.Inc(route, r.Method, strconv.Itoa(status))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+	})
+}
+
+// collectHostMetrics refreshes the CPU and disk gauges from the values the
+// dashboard uses.
+func collectHostMetrics() {
+	hostCPUUsage.Set(float64(getCPUUsage()))
+
+	used, available, total := getStorageMetrics()
+	if total > 0 {
+		// getStorageMetrics reports decimal gigabytes.
+		hostDiskUsed.Set(used * 1e9)
+		hostDiskAvailable.Set(available * 1e9)
+		hostDiskSize.Set(total * 1e9)
+	}
+}
+
+// collectContainerMetrics refreshes the container gauges.  When Podman does
+// not answer, the counts are dropped rather than left stale.
+func collectContainerMetrics(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	states, err := countContainersByState(ctx)
+	containersByState.Reset()
+	if err != nil {
+		podmanUp.Set(0)
+		return
+	}
+	podmanUp.Set(1)
+	for state, n := range states {
+		containersByState.Set(float64(n), state)
+	}
+}
+
+// GetPrometheusMetrics handles GET /metrics.
+// It serves every metric in the Prometheus text exposition format.
+func GetPrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	collectHostMetrics()
+	collectContainerMetrics(r.Context())
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	metrics.WriteText(w)
+}
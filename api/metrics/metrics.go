@@ -0,0 +1,289 @@
+// Package metrics is a small Prometheus instrumentation library.  It provides
+// labelled counters, gauges and histograms that register themselves in one
+// process-wide registry, and writes that registry in the Prometheus text
+// exposition format.
+//
+// Metrics are meant to be declared as package-level variables.  Declaring two
+// metrics with the same name, or passing the wrong number of label values, is
+// a programming error and panics.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are histogram buckets, in seconds, suited to HTTP request latency.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is implemented by every metric kind.
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]metric{}
+)
+
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[m.name()]; ok {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	registry[m.name()] = m
+}
+
+// desc holds what every metric kind has in common.
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (d *desc) name() string { return d.metricName }
+
+// key checks values against the label names and returns the series key.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// writeHeader writes the HELP and TYPE lines.
+func (d *desc) writeHeader(w *bufio.Writer, kind string) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, help, d.metricName, kind)
+}
+
+// labelPairs renders {name="value",...} for values plus any extra pairs,
+// or "" when there are none.
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var b strings.Builder
+	b.WriteByte('{')
+	pair := func(name, value string) {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escape.Replace(value))
+		b.WriteByte('"')
+	}
+	for i, v := range values {
+		pair(d.labels[i], v)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pair(extra[i], extra[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// formatValue renders v the way Prometheus expects.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sample is one series of a counter or gauge.
+type sample struct {
+	values []string
+	value  float64
+}
+
+// scalar implements counters and gauges.
+type scalar struct {
+	desc
+	kind   string
+	mu     sync.Mutex
+	series map[string]*sample
+}
+
+func newScalar(kind, name, help string, labels []string) *scalar {
+	s := &scalar{desc: desc{metricName: name, help: help, labels: labels}, kind: kind, series: map[string]*sample{}}
+	register(s)
+	return s
+}
+
+// update applies f to the series for values, creating it at zero.
+func (s *scalar) update(values []string, f func(*sample)) {
+	key := s.key(values)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	smp, ok := s.series[key]
+	if !ok {
+		smp = &sample{values: append([]string(nil), values...)}
+		s.series[key] = smp
+	}
+	f(smp)
+}
+
+func (s *scalar) write(w *bufio.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeHeader(w, s.kind)
+	for _, key := range sortedKeys(s.series) {
+		smp := s.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", s.metricName, s.labelPairs(smp.values), formatValue(smp.value))
+	}
+}
+
+// Counter is a cumulative count that only goes up.
+type Counter struct{ s *scalar }
+
+// NewCounter registers a counter.  By convention its name ends in _total.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newScalar("counter", name, help, labels)}
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds v, which must not be negative, to the series with the given label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.s.metricName + " cannot decrease")
+	}
+	c.s.update(values, func(smp *sample) { smp.value += v })
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ s *scalar }
+
+// NewGauge registers a gauge.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newScalar("gauge", name, help, labels)}
+}
+
+// Set sets the series with the given label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.s.update(values, func(smp *sample) { smp.value = v })
+}
+
+// Reset drops every series, for gauges that are rebuilt from scratch, so a
+// label value that no longer occurs stops being exported.
+func (g *Gauge) Reset() {
+	g.s.mu.Lock()
+	g.s.series = map[string]*sample{}
+	g.s.mu.Unlock()
+}
+
+// bucketSample is one series of a histogram.  counts are per bucket, not
+// cumulative; the last entry counts observations above every bound.
+type bucketSample struct {
+	values []string
+	counts []uint64
+	sum    float64
+}
+
+// Histogram counts observations into buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*bucketSample
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// which must be sorted.  The +Inf bucket is implied.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+	for _, l := range labels {
+		if l == "le" {
+			panic("metrics: histogram " + name + " cannot have an le label")
+		}
+	}
+	h := &Histogram{
+		desc:    desc{metricName: name, help: help, labels: labels},
+		buckets: append([]float64(nil), buckets...),
+		series:  map[string]*bucketSample{},
+	}
+	register(h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	smp, ok := h.series[key]
+	if !ok {
+		smp = &bucketSample{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = smp
+	}
+	smp.counts[i]++
+	smp.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		smp := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += smp.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(smp.values, "le", formatValue(bound)), cumulative)
+		}
+		cumulative += smp.counts[len(h.buckets)]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(smp.values, "le", "+Inf"), cumulative)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelPairs(smp.values), formatValue(smp.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelPairs(smp.values), cumulative)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteText writes every registered metric, sorted by name, in the text
+// exposition format.
+func WriteText(w io.Writer) error {
+	registryMutex.Lock()
+	metrics := make(map[string]metric, len(registry))
+	for name, m := range registry {
+		metrics[name] = m
+	}
+	registryMutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, name := range sortedKeys(metrics) {
+		metrics[name].write(bw)
+	}
+	return bw.Flush()
+}
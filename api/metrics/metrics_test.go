@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// exposition returns the lines WriteText writes for the metric called name.
+func exposition(t *testing.T, name string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "# "))
+		if len(fields) == 0 {
+			continue
+		}
+		metric := fields[0]
+		if metric == "HELP" || metric == "TYPE" {
+			metric = fields[1]
+		}
+		if metric == name || strings.HasPrefix(metric, name+"{") || strings.HasPrefix(metric, name+"_") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests\nhandled.", "route", "code")
+	c.Inc("/b", "200")
+	c.Inc("/a", "500")
+	c.Add(2, "/b", "200")
+
+	want := `# HELP test_requests_total Requests\nhandled.
+# TYPE test_requests_total counter
+test_requests_total{route="/a",code="500"} 1
+test_requests_total{route="/b",code="200"} 3`
+	if got := exposition(t, "test_requests_total"); got != want {
+		t.Errorf("counter exposition:\n%s\nwant:\n%s", got, want)
+	}
+
+	g := NewGauge("test_temperature", "Temperature.", "room")
+	g.Set(21.5, `say "hi"\`)
+	g.Set(-3, "cellar")
+	want = `# HELP test_temperature Temperature.
+# TYPE test_temperature gauge
+test_temperature{room="cellar"} -3
+test_temperature{room="say \"hi\"\\"} 21.5`
+	if got := exposition(t, "test_temperature"); got != want {
+		t.Errorf("gauge exposition:\n%s\nwant:\n%s", got, want)
+	}
+
+	g.Reset()
+	g.Set(1, "attic")
+	if got := exposition(t, "test_temperature"); strings.Contains(got, "cellar") || !strings.Contains(got, `{room="attic"} 1`) {
+		t.Errorf("Reset kept old series:\n%s", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1}, "job")
+	h.Observe(0.05, "build")
+	h.Observe(0.1, "build")
+	h.Observe(0.5, "build")
+	h.Observe(7, "build")
+
+	want := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{job="build",le="0.1"} 2
+test_duration_seconds_bucket{job="build",le="1"} 3
+test_duration_seconds_bucket{job="build",le="+Inf"} 4
+test_duration_seconds_sum{job="build"} 7.65
+test_duration_seconds_count{job="build"} 4`
+	if got := exposition(t, "test_duration_seconds"); got != want {
+		t.Errorf("histogram exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMisusePanics(t *testing.T) {
+	NewCounter("test_misuse_total", "Misuse.", "a")
+	tests := map[string]func(){
+		"duplicate name":       func() { NewGauge("test_misuse_total", "Again.") },
+		"missing label value":  func() { NewCounter("test_labels_total", "Labels.", "a", "b").Inc("x") },
+		"negative counter add": func() { NewCounter("test_negative_total", "Negative.").Add(-1) },
+		"unsorted buckets":     func() { NewHistogram("test_unsorted", "Unsorted.", []float64{2, 1}) },
+		"le label":             func() { NewHistogram("test_le", "Le.", DefBuckets, "le") },
+	}
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("did not panic")
+				}
+			}()
+			f()
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape fetches /metrics and returns the body.
+func scrape(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	GetPrometheusMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics: status %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return w.Body.String()
+}
+
+// TestInstrumentRoutes verifies requests are counted per mux pattern, so
+// prefix routes are not split per ID and unknown paths share one label.
+func TestInstrumentRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run-pipeline/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/list-functions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	handler := InstrumentRoutes(mux, mux)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodPost, "/run-pipeline/a"},
+		{http.MethodPost, "/run-pipeline/b"},
+		{http.MethodGet, "/list-functions"},
+		{http.MethodGet, "/no-such-route"},
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	body := scrape(t)
+	for _, want := range []string{
+		`opencloud_http_requests_total{route="/run-pipeline/",method="POST",code="202"} 2`,
+		`opencloud_http_requests_total{route="/list-functions",method="GET",code="200"} 1`,
+		`opencloud_http_requests_total{route="other",method="GET",code="404"} 1`,
+		`opencloud_http_request_duration_seconds_count{route="/run-pipeline/",method="POST"} 2`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("/metrics is missing %q", want)
+		}
+	}
+}
+
+// TestGetPrometheusMetrics verifies the job metrics and the gauges that are
+// refreshed on every scrape.
+func TestGetPrometheusMetrics(t *testing.T) {
+	orig := countContainersByState
+	defer func() { countContainersByState = orig }()
+	countContainersByState = func(ctx context.Context) (map[string]int, error) {
+		return map[string]int{"running": 2, "exited": 1}, nil
+	}
+
+	RecordFunctionInvocation("hello.py", true, 300*time.Millisecond)
+	RecordFunctionInvocation("hello.py", false, 2*time.Second)
+	recordPipelineRun("deploy", false, 90*time.Second)
+	RecordImageBuild(true, 45*time.Second)
+
+	body := scrape(t)
+	for _, want := range []string{
+		`opencloud_function_invocations_total{function="hello.py",outcome="success"} 1`,
+		`opencloud_function_invocations_total{function="hello.py",outcome="failed"} 1`,
+		`opencloud_function_invocation_duration_seconds_bucket{function="hello.py",le="0.5"} 1`,
+		`opencloud_function_invocation_duration_seconds_count{function="hello.py"} 2`,
+		`opencloud_pipeline_runs_total{pipeline="deploy",outcome="failed"} 1`,
+		`opencloud_pipeline_run_duration_seconds_bucket{pipeline="deploy",le="120"} 1`,
+		`opencloud_image_build_duration_seconds_bucket{outcome="success",le="60"} 1`,
+		`opencloud_containers{state="running"} 2`,
+		`opencloud_containers{state="exited"} 1`,
+		`opencloud_podman_up 1`,
+		`# TYPE opencloud_host_cpu_usage_percent gauge`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("/metrics is missing %q", want)
+		}
+	}
+
+	countContainersByState = func(ctx context.Context) (map[string]int, error) {
+		return nil, errors.New("podman is not running")
+	}
+	body = scrape(t)
+	if strings.Contains(body, "opencloud_containers{") {
+		t.Errorf("container counts were kept after Podman stopped answering")
+	}
+	if !strings.Contains(body, "opencloud_podman_up 0\n") {
+		t.Errorf("/metrics does not report Podman as down")
+	}
+}
@@ -0,0 +1,799 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// oidcConfig is read from ~/.opencloud/user/oidc.json.  Single sign-on is
+// disabled while the file does not exist.
+//
+// Example:
+//
+//	{
+//	    "issuer": "https://idp.example.com",
+//	    "clientId": "opencloud",
+//	    "clientSecret": "...",
+//	    "redirectUrl": "https://cloud.example.com/api/user/oidc/callback",
+//	    "roleClaim": "groups",
+//	    "roleMapping": {"cloud-admins": "admin", "developers": "developer"},
+//	    "defaultRole": "viewer",
+//	    "autoCreateUsers": true
+//	}
+type oidcConfig struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	RedirectURL  string   `json:"redirectUrl"`
+	Scopes       []string `json:"scopes,omitempty"`
+
+	// UsernameClaim names the ID token claim used as the username of new
+	// local accounts (default "preferred_username").  Logins are matched to
+	// accounts by the token's issuer and subject, never by this claim.
+	UsernameClaim string `json:"usernameClaim,omitempty"`
+	// RoleClaim names a string or string-array claim whose values are looked
+	// up in RoleMapping.  When several values map, the most privileged wins.
+	RoleClaim   string            `json:"roleClaim,omitempty"`
+	RoleMapping map[string]string `json:"roleMapping,omitempty"`
+	// DefaultRole is used when no claim value maps to a role.  Leave it empty
+	// to refuse logins from users without a mapped role.
+	DefaultRole string `json:"defaultRole,omitempty"`
+	// AutoCreateUsers creates a local account on first login.  Otherwise an
+	// administrator has to create the account beforehand and link it with
+	// LinkOIDCUser.
+	AutoCreateUsers bool `json:"autoCreateUsers,omitempty"`
+	// PostLoginRedirect is where the browser is sent after a successful
+	// login, with the tokens in the URL fragment (default "/login").
+	PostLoginRedirect string `json:"postLoginRedirect,omitempty"`
+}
+
+// oidcPlaceholderHash is stored as the password hash of accounts created
+// through single sign-on.  It is not a valid bcrypt hash, so password login
+// never succeeds for them until an administrator sets a password.
+const oidcPlaceholderHash = "!oidc"
+
+// oidcStateTTL bounds how long a user may spend at the identity provider.
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie holds a hash of the state of the browser's pending login,
+// so a callback can only complete a login started by the same browser.
+const oidcStateCookie = "opencloud_oidc_state"
+
+// maxOIDCPending caps the logins in progress, which anyone can start.
+const maxOIDCPending = 1000
+
+// oidcHTTPClient is used for all requests to the identity provider.
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcConfigPath returns the path to the OIDC configuration file.
+func oidcConfigPath() (string, error) {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "user", "oidc.json"), nil
+}
+
+// loadOIDCConfig returns the OIDC configuration, or nil when SSO is not set up.
+func loadOIDCConfig() (*oidcConfig, error) {
+	path, err := oidcConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var cfg oidcConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("malformed oidc config: %w", err)
+	}
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc config requires issuer, clientId and redirectUrl")
+	}
+	if cfg.DefaultRole != "" && !isValidRole(cfg.DefaultRole) {
+		return nil, fmt.Errorf("oidc config has unknown defaultRole %q", cfg.DefaultRole)
+	}
+	for group, role := range cfg.RoleMapping {
+		if !isValidRole(role) {
+			return nil, fmt.Errorf("oidc roleMapping for %q has unknown role %q", group, role)
+		}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.PostLoginRedirect == "" {
+		cfg.PostLoginRedirect = "/login"
+	}
+	return &cfg, nil
+}
+
+// oidcProviderMetadata is the subset of the discovery document we use.
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// fetchJSON GETs url and decodes the JSON response into v.
+func fetchJSON(rawURL string, v any) error {
+	resp, err := oidcHTTPClient.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// discoverOIDCProvider fetches the provider's discovery document.
+func discoverOIDCProvider(issuer string) (*oidcProviderMetadata, error) {
+	var meta oidcProviderMetadata
+	if err := fetchJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if meta.Issuer != issuer {
+		return nil, fmt.Errorf("oidc discovery returned issuer %q, expected %q", meta.Issuer, issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery document is incomplete")
+	}
+	return &meta, nil
+}
+
+// oidcPendingLogin is the server-side state of a login in progress, keyed by
+// the OAuth state parameter.
+type oidcPendingLogin struct {
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// Pending logins are short lived and bound to one server process; a restart
+// during the redirect simply means clicking "sign in" again.
+var (
+	oidcPending      = make(map[string]oidcPendingLogin)
+	oidcPendingMutex sync.Mutex
+)
+
+// storeOIDCPending records a pending login and drops expired ones.  It
+// reports false when maxOIDCPending logins are already in progress.
+func storeOIDCPending(state string, p oidcPendingLogin) bool {
+	oidcPendingMutex.Lock()
+	defer oidcPendingMutex.Unlock()
+
+	now := time.Now()
+	for k, v := range oidcPending {
+		if now.After(v.ExpiresAt) {
+			delete(oidcPending, k)
+		}
+	}
+	if len(oidcPending) >= maxOIDCPending {
+		return false
+	}
+	oidcPending[state] = p
+	return true
+}
+
+// takeOIDCPending returns and removes the pending login for state.
+func takeOIDCPending(state string) (oidcPendingLogin, bool) {
+	oidcPendingMutex.Lock()
+	defer oidcPendingMutex.Unlock()
+
+	p, ok := oidcPending[state]
+	delete(oidcPending, state)
+	if !ok || time.Now().After(p.ExpiresAt) {
+		return oidcPendingLogin{}, false
+	}
+	return p, true
+}
+
+// oidcStateHash returns the value of oidcStateCookie for state.
+func oidcStateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// setOIDCStateCookie sets oidcStateCookie for the callback URL, or clears
+// it when state is empty.
+func setOIDCStateCookie(w http.ResponseWriter, cfg *oidcConfig, state string) {
+	path := "/"
+	if u, err := url.Parse(cfg.RedirectURL); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.RedirectURL, "https://"),
+		// Lax, not Strict: the cookie has to come along on the top-level
+		// navigation back from the identity provider.
+		SameSite: http.SameSiteLaxMode,
+	}
+	if state == "" {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Value = oidcStateHash(state)
+		cookie.MaxAge = int(oidcStateTTL.Seconds())
+	}
+	http.SetCookie(w, cookie)
+}
+
+// randomURLString returns n random bytes encoded as unpadded base64url.
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallenge returns the S256 code challenge for verifier (RFC 7636).
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// jsonWebKey is a single RSA key from a JWKS document.
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// rsaPublicKey decodes the key material of an RSA JWK.
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid key exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+// verifyIDToken checks the signature and standard claims of an RS256 ID
+// token and returns its claims.
+func verifyIDToken(rawToken string, cfg *oidcConfig, meta *oidcProviderMetadata, nonce string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJSON, &header) != nil {
+		return nil, fmt.Errorf("malformed id token header")
+	}
+	// RS256 is the only algorithm every OIDC provider must support; refusing
+	// everything else rules out "none" and algorithm confusion attacks.
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported id token algorithm %q", header.Alg)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := fetchJSON(meta.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	var key *rsa.PublicKey
+	for _, k := range jwks.Keys {
+		if k.Kty == "RSA" && (header.Kid == "" || k.Kid == header.Kid) && (k.Use == "" || k.Use == "sig") {
+			if key, err = k.rsaPublicKey(); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no signing key matches id token kid %q", header.Kid)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("invalid id token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id token payload")
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed id token claims")
+	}
+
+	if iss, _ := claims["iss"].(string); iss != cfg.Issuer {
+		return nil, fmt.Errorf("id token issuer %q does not match", iss)
+	}
+	if !audienceContains(claims["aud"], cfg.ClientID) {
+		return nil, fmt.Errorf("id token audience does not include client id")
+	}
+	exp, _ := claims["exp"].(float64)
+	if now.Unix() > int64(exp) {
+		return nil, fmt.Errorf("id token expired")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// audienceContains reports whether the aud claim (string or array) includes clientID.
+func audienceContains(aud any, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimStrings returns a claim as a list of strings, accepting either a
+// single string or an array.
+func claimStrings(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// roleRank orders roles from least to most privileged.
+var roleRank = map[string]int{roleViewer: 1, roleDeveloper: 2, roleAdmin: 3}
+
+// mapOIDCRole returns the most privileged role mapped from the token claims,
+// falling back to cfg.DefaultRole.  It returns "" when the user may not log in.
+func mapOIDCRole(cfg *oidcConfig, claims map[string]any) string {
+	role := ""
+	if cfg.RoleClaim != "" {
+		for _, value := range claimStrings(claims, cfg.RoleClaim) {
+			if mapped, ok := cfg.RoleMapping[value]; ok && roleRank[mapped] > roleRank[role] {
+				role = mapped
+			}
+		}
+	}
+	if role == "" {
+		role = cfg.DefaultRole
+	}
+	return role
+}
+
+// exchangeOIDCCode redeems an authorization code at the token endpoint and
+// returns the raw ID token.
+func exchangeOIDCCode(cfg *oidcConfig, meta *oidcProviderMetadata, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("client_id", cfg.ClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("malformed token response: %w", err)
+	}
+	if tokenResp.IDToken == "" {
+		return "", fmt.Errorf("token response did not include an id_token")
+	}
+	return tokenResp.IDToken, nil
+}
+
+// oidcIdentity returns the value stored in userRecord.OIDCIdentity for the
+// identity provider account sub of issuer.  Unlike the username claim, the
+// pair never changes and cannot be chosen by the user.
+func oidcIdentity(issuer, subject string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(issuer)) + "." + base64.RawURLEncoding.EncodeToString([]byte(subject))
+}
+
+// Errors returned by provisionOIDCUser.
+var (
+	errOIDCInvalidUsername = fmt.Errorf("username claim is not a valid username")
+	errOIDCNotLinked       = fmt.Errorf("account is not linked to this identity provider account")
+)
+
+// provisionOIDCUser finds or creates the local account for an SSO login and
+// brings its role in line with the identity provider.
+//
+// Accounts are matched on identity, the issuer and subject of the ID token.
+// The username claim is only used to name a new account, or to link an
+// account created by an earlier SSO login that has no identity yet; accounts
+// with a password are only reachable through SSO once an administrator
+// linked them with LinkOIDCUser.
+func provisionOIDCUser(cfg *oidcConfig, identity, username, role string) (*userRecord, error) {
+	users, err := listUsers()
+	if err != nil {
+		return nil, err
+	}
+	var user *userRecord
+	for i := range users {
+		if users[i].OIDCIdentity == identity {
+			user = &users[i]
+			break
+		}
+	}
+
+	if user == nil {
+		if !usernameRegex.MatchString(username) {
+			return nil, errOIDCInvalidUsername
+		}
+		if user, err = lookupUser(username); err != nil {
+			return nil, err
+		}
+		if user == nil {
+			if !cfg.AutoCreateUsers {
+				return nil, fmt.Errorf("no local account for %q", username)
+			}
+			user = &userRecord{Username: username, PasswordHash: oidcPlaceholderHash, Role: role, OIDCIdentity: identity}
+			if err := addUser(user); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+		err := updateUser(username, func(u *userRecord, _ []*userRecord) (bool, error) {
+			if u.OIDCIdentity != "" || u.PasswordHash != oidcPlaceholderHash {
+				return false, errOIDCNotLinked
+			}
+			u.OIDCIdentity = identity
+			return false, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("account %q: %w", username, err)
+		}
+	}
+
+	if user.Disabled {
+		return nil, fmt.Errorf("account %q is disabled", user.Username)
+	}
+	if user.Role != role {
+		err := updateUser(user.Username, func(u *userRecord, users []*userRecord) (bool, error) {
+			if isActiveAdmin(u) && role != roleAdmin && activeAdminCount(users) <= 1 {
+				// Keep the last admin rather than locking everyone out.
+				return false, nil
+			}
+			u.Role = role
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// linkOIDCRequest is the JSON body accepted by LinkOIDCUser.
+type linkOIDCRequest struct {
+	Username string `json:"username"`
+	// Subject is the "sub" claim of the identity provider account; empty
+	// unlinks the account.
+	Subject string `json:"subject"`
+}
+
+// LinkOIDCUser handles POST /user/link-oidc.
+// It links an account to an account at the configured identity provider, so
+// its owner can sign in with SSO, or unlinks it.  This is the only way to
+// enable SSO for accounts that have a password.
+func LinkOIDCUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req linkOIDCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "username is required")
+		return
+	}
+	identity := ""
+	if req.Subject != "" {
+		cfg, err := loadOIDCConfig()
+		if err != nil || cfg == nil {
+			apierror.Respond(w, r, http.StatusNotFound, "single sign-on is not configured")
+			return
+		}
+		identity = oidcIdentity(cfg.Issuer, req.Subject)
+	}
+
+	var updated userRecord
+	err := updateUser(req.Username, func(u *userRecord, users []*userRecord) (bool, error) {
+		for _, other := range users {
+			if identity != "" && other.OIDCIdentity == identity && other.Username != u.Username {
+				return false, errOIDCLinked
+			}
+		}
+		u.OIDCIdentity = identity
+		updated = *u
+		return false, nil
+	})
+	if err == errOIDCLinked {
+		apierror.Respond(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if !writeUserUpdateError(w, r, err) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(&updated))
+}
+
+// errOIDCLinked is returned when an identity provider account is already
+// linked to another account.
+var errOIDCLinked = fmt.Errorf("identity provider account is linked to another user")
+
+// GetOIDCStatus handles GET /user/oidc/status.
+// It tells the login page whether to offer single sign-on.
+func GetOIDCStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	cfg, err := loadOIDCConfig()
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to load single sign-on settings", "err", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": cfg != nil})
+}
+
+// OIDCLogin handles GET /user/oidc/login.
+// It starts an authorization-code flow with PKCE and redirects the browser
+// to the identity provider.
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	cfg, err := loadOIDCConfig()
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to load single sign-on settings", "err", err)
+		apierror.Respond(w, r, http.StatusInternalServerError, "single sign-on is misconfigured")
+		return
+	}
+	if cfg == nil {
+		apierror.Respond(w, r, http.StatusNotFound, "single sign-on is not configured")
+		return
+	}
+
+	meta, err := discoverOIDCProvider(cfg.Issuer)
+	if err != nil {
+		slog.WarnContext(r.Context(), "oidc provider discovery failed", "issuer", cfg.Issuer, "err", err)
+		apierror.Respond(w, r, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+
+	state, err1 := randomURLString(24)
+	nonce, err2 := randomURLString(24)
+	verifier, err3 := randomURLString(48)
+	if err1 != nil || err2 != nil || err3 != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+	stored := storeOIDCPending(state, oidcPendingLogin{
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if !stored {
+		apierror.Respond(w, r, http.StatusServiceUnavailable, "too many logins in progress, please try again later")
+		return
+	}
+	setOIDCStateCookie(w, cfg, state)
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", cfg.ClientID)
+	q.Set("redirect_uri", cfg.RedirectURL)
+	q.Set("scope", strings.Join(cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", pkceChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, meta.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// OIDCCallback handles GET /user/oidc/callback, where the identity provider
+// sends the browser back.  On success it issues the usual token pair and
+// redirects to PostLoginRedirect with the tokens in the URL fragment, which
+// browsers never send to a server.  Users with two-factor authentication get
+// an MFA challenge token in the fragment instead, to finish through
+// VerifyLogin.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	cfg, err := loadOIDCConfig()
+	if err != nil || cfg == nil {
+		apierror.Respond(w, r, http.StatusNotFound, "single sign-on is not configured")
+		return
+	}
+
+	q := r.URL.Query()
+	if idpErr := q.Get("error"); idpErr != "" {
+		apierror.Respond(w, r, http.StatusUnauthorized, "identity provider denied the login: "+idpErr)
+		return
+	}
+	// A callback without the cookie set by OIDCLogin comes from a login
+	// started in another browser, possibly an attacker's, so it is refused
+	// without touching the pending login.
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(oidcStateHash(state))) != 1 {
+		apierror.Respond(w, r, http.StatusBadRequest, "login was not started in this browser, please try again")
+		return
+	}
+	setOIDCStateCookie(w, cfg, "")
+	pending, ok := takeOIDCPending(state)
+	if !ok {
+		apierror.Respond(w, r, http.StatusBadRequest, "login request expired or unknown, please try again")
+		return
+	}
+	code := q.Get("code")
+	if code == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "missing authorization code")
+		return
+	}
+
+	meta, err := discoverOIDCProvider(cfg.Issuer)
+	if err != nil {
+		slog.WarnContext(r.Context(), "oidc provider discovery failed", "issuer", cfg.Issuer, "err", err)
+		apierror.Respond(w, r, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+	rawIDToken, err := exchangeOIDCCode(cfg, meta, code, pending.CodeVerifier)
+	if err != nil {
+		slog.WarnContext(r.Context(), "oidc code exchange failed", "err", err)
+		apierror.Respond(w, r, http.StatusBadGateway, "failed to complete login with identity provider")
+		return
+	}
+	claims, err := verifyIDToken(rawIDToken, cfg, meta, pending.Nonce, time.Now())
+	if err != nil {
+		slog.WarnContext(r.Context(), "rejected oidc id token", "err", err)
+		apierror.Respond(w, r, http.StatusUnauthorized, "identity provider returned an invalid token")
+		return
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		slog.WarnContext(r.Context(), "rejected oidc id token", "err", "missing sub claim")
+		apierror.Respond(w, r, http.StatusUnauthorized, "identity provider returned an invalid token")
+		return
+	}
+	role := mapOIDCRole(cfg, claims)
+	if role == "" {
+		apierror.Respond(w, r, http.StatusForbidden, "your identity provider account is not allowed to use OpenCloud")
+		return
+	}
+	claimedName, _ := claims[cfg.UsernameClaim].(string)
+	user, err := provisionOIDCUser(cfg, oidcIdentity(cfg.Issuer, subject), claimedName, role)
+	if err == errOIDCInvalidUsername {
+		apierror.Respond(w, r, http.StatusUnauthorized, fmt.Sprintf("claim %q is not a valid username", cfg.UsernameClaim))
+		return
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "oidc login refused", "user", claimedName, "sub", subject, "err", err)
+		apierror.Respond(w, r, http.StatusForbidden, "no active OpenCloud account for this user")
+		return
+	}
+	username := user.Username
+
+	// SSO replaces the password, not the second factor: users with
+	// two-factor authentication get the same challenge as from Login.
+	fragment := url.Values{}
+	fragment.Set("username", username)
+	enrollment, err := getTOTPEnrollment(username)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return
+	}
+	if enrollment != nil && enrollment.Confirmed {
+		challenge, err := issueMFAChallenge(username, time.Now())
+		if err != nil {
+			apierror.Respond(w, r, http.StatusInternalServerError, "failed to issue tokens")
+			return
+		}
+		fragment.Set("mfa_required", "true")
+		fragment.Set("challenge_token", challenge)
+		http.Redirect(w, r, cfg.PostLoginRedirect+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	accessToken, refreshToken, err := issueTokenPair(username, r.UserAgent(), clientAddr(r))
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to issue tokens")
+		return
+	}
+	fragment.Set("access_token", accessToken)
+	fragment.Set("refresh_token", refreshToken)
+	http.Redirect(w, r, cfg.PostLoginRedirect+"#"+fragment.Encode(), http.StatusFound)
+}
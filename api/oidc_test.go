@@ -0,0 +1,531 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIdP is an in-process OpenID Connect provider for tests.  Its authorize
+// endpoint immediately redirects back with a code, as if the user had
+// already signed in.
+type fakeIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu     sync.Mutex
+	claims map[string]any              // claims to put in the next ID token
+	codes  map[string]url.Values       // code -> authorize request parameters
+	tamper func(idToken string) string // optional hook to corrupt issued tokens
+}
+
+func newFakeIdP(t *testing.T, clientID string) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &fakeIdP{key: key, clientID: clientID, codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcProviderMetadata{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			Kid: "test-key",
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code, _ := randomURLString(16)
+		idp.mu.Lock()
+		idp.codes[code] = q
+		idp.mu.Unlock()
+
+		back := url.Values{}
+		back.Set("code", code)
+		back.Set("state", q.Get("state"))
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+back.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		authz, ok := idp.codes[r.Form.Get("code")]
+		delete(idp.codes, r.Form.Get("code"))
+		idp.mu.Unlock()
+
+		if !ok || r.Form.Get("grant_type") != "authorization_code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		// PKCE: the verifier must hash to the challenge sent to /authorize.
+		if authz.Get("code_challenge_method") != "S256" || pkceChallenge(r.Form.Get("code_verifier")) != authz.Get("code_challenge") {
+			http.Error(w, `{"error":"invalid_grant","error_description":"pkce"}`, http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("redirect_uri") != authz.Get("redirect_uri") {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		claims := map[string]any{
+			"iss":   idp.server.URL,
+			"aud":   idp.clientID,
+			"sub":   "subject-1",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(5 * time.Minute).Unix(),
+			"nonce": authz.Get("nonce"),
+		}
+		idp.mu.Lock()
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		tamper := idp.tamper
+		idp.mu.Unlock()
+
+		token := idp.sign(t, claims)
+		if tamper != nil {
+			token = tamper(token)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": token, "token_type": "Bearer"})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// set replaces the claims and tamper hook used for the next ID token.
+func (idp *fakeIdP) set(claims map[string]any, tamper func(string) string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims = claims
+	idp.tamper = tamper
+}
+
+// sign returns an RS256 JWT for claims.
+func (idp *fakeIdP) sign(t *testing.T, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// writeOIDCConfig writes oidc.json into the test HOME.
+func writeOIDCConfig(t *testing.T, cfg oidcConfig) {
+	t.Helper()
+	path, _ := oidcConfigPath()
+	data, _ := json.Marshal(cfg)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write oidc config: %v", err)
+	}
+}
+
+// runOIDCLogin drives the browser side of the flow: OpenCloud login ->
+// IdP authorize -> OpenCloud callback.  It returns the final callback response.
+func runOIDCLogin(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	OIDCCallback(w, startOIDCLogin(t))
+	return w
+}
+
+// startOIDCLogin starts a login and returns the callback request the
+// identity provider sends the browser back with, carrying the browser's
+// cookies.
+func startOIDCLogin(t *testing.T) *http.Request {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	OIDCLogin(w, httptest.NewRequest(http.MethodGet, "/user/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: expected %d, got %d — body: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+
+	// Follow the redirect to the IdP without following its redirect back.
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noFollow.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("bad callback location: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user/oidc/callback?"+callback.RawQuery, nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+// tokensFromRedirect extracts the tokens from the post-login redirect fragment.
+func tokensFromRedirect(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback: expected %d, got %d — body: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("bad location: %v", err)
+	}
+	fragment, err := url.ParseQuery(loc.Fragment)
+	if err != nil {
+		t.Fatalf("bad fragment: %v", err)
+	}
+	return fragment
+}
+
+func setupOIDC(t *testing.T, mutate func(*oidcConfig)) *fakeIdP {
+	t.Helper()
+	idp := newFakeIdP(t, "opencloud")
+	cfg := oidcConfig{
+		Issuer:          idp.server.URL,
+		ClientID:        "opencloud",
+		ClientSecret:    "s3cret",
+		RedirectURL:     "http://cloud.test/api/user/oidc/callback",
+		RoleClaim:       "groups",
+		RoleMapping:     map[string]string{"cloud-admins": roleAdmin, "devs": roleDeveloper},
+		DefaultRole:     roleViewer,
+		AutoCreateUsers: true,
+	}
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	writeOIDCConfig(t, cfg)
+	return idp
+}
+
+// TestOIDCLoginEndToEnd verifies a full login creates the user with the
+// mapped role and issues working tokens.
+func TestOIDCLoginEndToEnd(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	idp := setupOIDC(t, nil)
+	idp.set(map[string]any{"preferred_username": "dana", "groups": []string{"staff", "devs"}}, nil)
+
+	tokens := tokensFromRedirect(t, runOIDCLogin(t))
+	if tokens.Get("username") != "dana" || tokens.Get("refresh_token") == "" {
+		t.Fatalf("unexpected fragment %v", tokens)
+	}
+
+	user, err := lookupUser("dana")
+	if err != nil || user == nil {
+		t.Fatalf("expected dana to be provisioned, got %v (err %v)", user, err)
+	}
+	if user.Role != roleDeveloper {
+		t.Errorf("expected role %s, got %s", roleDeveloper, user.Role)
+	}
+	if found, _ := verifyCredentials("dana", oidcPlaceholderHash); found != nil {
+		t.Errorf("placeholder hash must not work as a password")
+	}
+
+	if w := serveAuthenticated(protectedEcho, http.MethodPost, "/run-pipeline/x", tokens.Get("access_token")); w.Code != http.StatusOK || w.Body.String() != "dana" {
+		t.Errorf("expected developer access as dana, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// TestOIDCRoleSync verifies existing users get their role updated from claims.
+func TestOIDCRoleSync(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	idp := setupOIDC(t, nil)
+	if err := addUser(&userRecord{Username: "erin", PasswordHash: oidcPlaceholderHash, Role: roleViewer}); err != nil {
+		t.Fatalf("addUser: %v", err)
+	}
+	idp.set(map[string]any{"preferred_username": "erin", "groups": "cloud-admins"}, nil)
+
+	tokensFromRedirect(t, runOIDCLogin(t))
+	if user, _ := lookupUser("erin"); user == nil || user.Role != roleAdmin {
+		t.Errorf("expected erin to be promoted to admin, got %+v", user)
+	}
+}
+
+// TestOIDCUsernameClaimCannotTakeOverAccounts verifies the username claim
+// alone never reaches an account with a password or one linked to another
+// identity provider account, and that an admin can link accounts.
+func TestOIDCUsernameClaimCannotTakeOverAccounts(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	idp := setupOIDC(t, nil)
+	idp.set(map[string]any{"preferred_username": "admin", "groups": "cloud-admins"}, nil)
+	if w := runOIDCLogin(t); w.Code != http.StatusForbidden {
+		t.Fatalf("SSO login as the password account admin: expected %d, got %d — body: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+	if user, _ := lookupUser("admin"); user == nil || user.OIDCIdentity != "" {
+		t.Errorf("admin after a refused SSO login = %+v", user)
+	}
+
+	// erin's account was created by SSO for another IdP account.
+	other := oidcIdentity(idp.server.URL, "subject-2")
+	if err := addUser(&userRecord{Username: "erin", PasswordHash: oidcPlaceholderHash, Role: roleViewer, OIDCIdentity: other}); err != nil {
+		t.Fatalf("addUser: %v", err)
+	}
+	idp.set(map[string]any{"preferred_username": "erin"}, nil)
+	if w := runOIDCLogin(t); w.Code != http.StatusForbidden {
+		t.Errorf("SSO login as another IdP account's user: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Once an admin links it, the account is found whatever the username claim says.
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	w := serveUserRequest(t, LinkOIDCUser, http.MethodPost, "/user/link-oidc", admin.AccessToken,
+		linkOIDCRequest{Username: "admin", Subject: "subject-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("link admin: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	w = serveUserRequest(t, LinkOIDCUser, http.MethodPost, "/user/link-oidc", admin.AccessToken,
+		linkOIDCRequest{Username: "erin", Subject: "subject-1"})
+	if w.Code != http.StatusConflict {
+		t.Errorf("linking a second account to subject-1: expected %d, got %d", http.StatusConflict, w.Code)
+	}
+	idp.set(map[string]any{"preferred_username": "erin", "groups": "cloud-admins"}, nil)
+	if tokens := tokensFromRedirect(t, runOIDCLogin(t)); tokens.Get("username") != "admin" {
+		t.Errorf("linked SSO login signed in as %q, want admin", tokens.Get("username"))
+	}
+}
+
+// TestOIDCLoginRequiresSecondFactor verifies SSO does not bypass TOTP.
+func TestOIDCLoginRequiresSecondFactor(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	idp := setupOIDC(t, nil)
+	idp.set(map[string]any{"preferred_username": "dana", "groups": "devs"}, nil)
+	first := tokensFromRedirect(t, runOIDCLogin(t))
+	secret, _ := enrollTOTPForTest(t, first.Get("access_token"))
+
+	fragment := tokensFromRedirect(t, runOIDCLogin(t))
+	if fragment.Get("access_token") != "" || fragment.Get("refresh_token") != "" {
+		t.Fatalf("SSO login of a TOTP user issued tokens: %v", fragment)
+	}
+	if fragment.Get("mfa_required") != "true" || fragment.Get("challenge_token") == "" || fragment.Get("username") != "dana" {
+		t.Fatalf("unexpected fragment %v", fragment)
+	}
+
+	w := postJSON(VerifyLogin, "/user/login/verify", verifyLoginRequest{
+		ChallengeToken: fragment.Get("challenge_token"),
+		Code:           currentTOTPCode(t, secret, time.Now()),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var tokens loginResponse
+	json.NewDecoder(w.Body).Decode(&tokens)
+	if w := serveAuthenticated(protectedEcho, http.MethodPost, "/run-pipeline/x", tokens.AccessToken); w.Code != http.StatusOK || w.Body.String() != "dana" {
+		t.Errorf("expected developer access as dana, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// TestOIDCRejections verifies the flow refuses bad tokens and unmapped users.
+func TestOIDCRejections(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(*oidcConfig)
+		claims map[string]any
+		tamper func(string) string
+		want   int
+	}{
+		{
+			name:   "no default role",
+			config: func(c *oidcConfig) { c.DefaultRole = "" },
+			claims: map[string]any{"preferred_username": "fred"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "auto create disabled",
+			config: func(c *oidcConfig) { c.AutoCreateUsers = false },
+			claims: map[string]any{"preferred_username": "fred"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "wrong audience",
+			claims: map[string]any{"preferred_username": "fred", "aud": "someone-else"},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "expired",
+			claims: map[string]any{"preferred_username": "fred", "exp": time.Now().Add(-time.Minute).Unix()},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong nonce",
+			claims: map[string]any{"preferred_username": "fred", "nonce": "replayed"},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "bad signature",
+			claims: map[string]any{"preferred_username": "fred"},
+			tamper: func(tok string) string { return tok[:len(tok)-4] + "AAAA" },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "invalid username",
+			claims: map[string]any{"preferred_username": "fred:admin"},
+			want:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupCredentialsFile(t, "admin", "admin")
+			defer cleanup()
+
+			idp := setupOIDC(t, tt.config)
+			idp.set(tt.claims, tt.tamper)
+
+			w := runOIDCLogin(t)
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d — body: %s", tt.want, w.Code, w.Body.String())
+			}
+			if user, _ := lookupUser("fred"); user != nil {
+				t.Errorf("fred must not be provisioned")
+			}
+		})
+	}
+}
+
+// TestOIDCCallbackUnknownState verifies callbacks without a pending login are refused.
+func TestOIDCCallbackUnknownState(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+	setupOIDC(t, nil)
+
+	w := httptest.NewRecorder()
+	OIDCCallback(w, httptest.NewRequest(http.MethodGet, "/user/oidc/callback?state=forged&code=x", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestOIDCCallbackRequiresStateCookie verifies a callback is refused unless
+// it comes from the browser that started the login, and that the refusal
+// leaves the login pending for that browser.
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+	idp := setupOIDC(t, nil)
+	idp.set(map[string]any{"preferred_username": "dana"}, nil)
+
+	callback := startOIDCLogin(t)
+	cookie, err := callback.Cookie(oidcStateCookie)
+	if err != nil {
+		t.Fatalf("login set no state cookie: %v", err)
+	}
+	if cookie.Value == callback.URL.Query().Get("state") {
+		t.Errorf("state cookie holds the state itself")
+	}
+
+	w := httptest.NewRecorder()
+	OIDCCallback(w, httptest.NewRequest(http.MethodGet, callback.URL.String(), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("without cookie: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	other := startOIDCLogin(t)
+	forged := httptest.NewRequest(http.MethodGet, callback.URL.String(), nil)
+	for _, c := range other.Cookies() {
+		forged.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	OIDCCallback(w, forged)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("with another login's cookie: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	OIDCCallback(w, callback)
+	if tokens := tokensFromRedirect(t, w); tokens.Get("username") != "dana" {
+		t.Errorf("unexpected fragment %v", tokens)
+	}
+}
+
+// TestOIDCPendingLimit verifies logins cannot pile up without bound.
+func TestOIDCPendingLimit(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+	setupOIDC(t, nil)
+
+	oidcPendingMutex.Lock()
+	saved := oidcPending
+	oidcPending = make(map[string]oidcPendingLogin)
+	for i := 0; i < maxOIDCPending; i++ {
+		oidcPending[strconv.Itoa(i)] = oidcPendingLogin{ExpiresAt: time.Now().Add(time.Minute)}
+	}
+	oidcPendingMutex.Unlock()
+	defer func() {
+		oidcPendingMutex.Lock()
+		oidcPending = saved
+		oidcPendingMutex.Unlock()
+	}()
+
+	w := httptest.NewRecorder()
+	OIDCLogin(w, httptest.NewRequest(http.MethodGet, "/user/oidc/login", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("refused login set cookies: %v", w.Result().Cookies())
+	}
+}
+
+// TestOIDCNotConfigured verifies the endpoints report SSO as disabled without a config file.
+func TestOIDCNotConfigured(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	path, _ := oidcConfigPath()
+	os.Remove(path)
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		t.Fatalf("expected user dir: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	OIDCLogin(w, httptest.NewRequest(http.MethodGet, "/user/oidc/login", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("login: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	GetOIDCStatus(w, httptest.NewRequest(http.MethodGet, "/user/oidc/status", nil))
+	var status map[string]bool
+	json.NewDecoder(w.Body).Decode(&status)
+	if status["enabled"] {
+		t.Errorf("expected SSO to be reported as disabled")
+	}
+}
@@ -0,0 +1,1039 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/api/listing"
+)
+
+// The OpenAPI document is assembled from apiOperations, which describe the
+// legacy routes registered in main.go, and v1Routes, whose operations reuse
+// the description of the legacy route they translate onto.  Schemas that
+// mirror a Go type name it in a comment; keep the two in step.
+
+// apiParam is a query parameter of a legacy route.
+type apiParam struct {
+	name        string
+	description string
+	required    bool
+	integer     bool
+}
+
+// apiOperation documents one legacy route.
+type apiOperation struct {
+	// method and path identify the route; segments after a prefix route
+	// are written as {name}, matching the placeholders in v1Routes.
+	method, path string
+	id           string // operationId; v1 operations use it unchanged
+	tag          string
+	summary      string
+	query        []apiParam
+
+	request   any    // JSON request body schema, nil for none
+	multipart any    // multipart/form-data request body schema
+	response  any    // success response schema
+	status    int    // success status, 200 when zero
+	media     string // success media type, application/json when empty
+	public    bool   // reachable without an access token
+	paged     bool   // takes the listing parameters; see listQuery
+}
+
+// listQuery documents the pagination, sort and filter parameters of a list
+// endpoint (see package listing), followed by extra.
+func listQuery(sorts []string, defaultSort string, filters []apiParam, extra ...apiParam) []apiParam {
+	params := []apiParam{
+		{name: "limit", description: fmt.Sprintf("Maximum number of items, 1 to %d; every item when absent.", listing.MaxLimit), integer: true},
+		{name: "cursor", description: "The X-Next-Cursor of the previous page."},
+		{name: "sort", description: fmt.Sprintf("One of %s, prefixed with - for descending order (default %s).", strings.Join(sorts, ", "), defaultSort)},
+	}
+	return append(append(params, filters...), extra...)
+}
+
+// Filters shared by list endpoints.
+var (
+	prefixFilter = apiParam{name: "prefix", description: "Only items whose name starts with this."}
+	labelFilter  = apiParam{name: "label", description: "Only items with this label, given as key or key=value; repeat to require several."}
+)
+
+// Schema helpers.
+
+func schemaRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(items map[string]any) map[string]any {
+	return map[string]any{"type": "array", "items": items}
+}
+
+func stringSchema(description string) map[string]any {
+	return describe(map[string]any{"type": "string"}, description)
+}
+
+func integerSchema(description string) map[string]any {
+	return describe(map[string]any{"type": "integer", "format": "int64"}, description)
+}
+
+func boolSchema(description string) map[string]any {
+	return describe(map[string]any{"type": "boolean"}, description)
+}
+
+func timeSchema(description string) map[string]any {
+	return describe(map[string]any{"type": "string", "format": "date-time"}, description)
+}
+
+func stringListSchema(description string) map[string]any {
+	return describe(arrayOf(map[string]any{"type": "string"}), description)
+}
+
+func stringMapSchema(description string) map[string]any {
+	return describe(map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}}, description)
+}
+
+// describe sets the description of s unless it is empty.
+func describe(s map[string]any, description string) map[string]any {
+	if description != "" {
+		s["description"] = description
+	}
+	return s
+}
+
+// objectSchema builds an object schema; required lists the mandatory properties.
+func objectSchema(description string, props map[string]any, required ...string) map[string]any {
+	s := describe(map[string]any{"type": "object", "properties": props}, description)
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// openAPISchemas are the shared component schemas.
+var openAPISchemas = map[string]any{
+	// apierror.Error
+	"Error": objectSchema("Error envelope returned by every endpoint.  Streaming endpoints send it as the data of an \"error\" event.", map[string]any{
+		"code": map[string]any{
+			"type":        "string",
+			"description": "Stable machine-readable error code.",
+			"enum": []string{
+				apierror.CodeBadRequest, apierror.CodeUnauthorized, apierror.CodeForbidden,
+				apierror.CodePasswordChangeRequired, apierror.CodeNotFound, apierror.CodeMethodNotAllowed,
+				apierror.CodeConflict, apierror.CodePayloadTooLarge, apierror.CodeTooManyRequests,
+				apierror.CodeInternal, apierror.CodeNotImplemented, apierror.CodeUnavailable,
+				apierror.CodeTimeout, apierror.CodePodmanUnavailable, apierror.CodePodmanError,
+				apierror.CodeFilesystemError, apierror.CodeLedgerError, apierror.CodeIdempotencyKeyInUse,
+				apierror.CodeIdempotencyKeyReused,
+			},
+		},
+		"message":   stringSchema("Human-readable error message."),
+		"details":   map[string]any{"description": "Optional structured context, e.g. the build log of a failed build."},
+		"requestId": stringSchema("The X-Request-ID of the request, for matching server logs."),
+	}, "code", "message"),
+	"Message": objectSchema("Confirmation returned by endpoints without a more specific result.", map[string]any{
+		"message": stringSchema("What happened."),
+	}),
+	"Result": map[string]any{
+		"type":                 "object",
+		"description":          "Outcome of an operation.  Besides status and message, handlers add the name or ID of the affected resource.",
+		"properties":           map[string]any{"status": stringSchema("Short status such as \"success\" or \"deleted\"."), "message": stringSchema("What happened.")},
+		"additionalProperties": map[string]any{"type": "string"},
+	},
+
+	// Authentication and accounts
+	"LoginRequest": objectSchema("", map[string]any{
+		"username": stringSchema(""),
+		"password": stringSchema(""),
+	}, "username", "password"),
+	"LoginResponse": objectSchema("Token pair returned by a successful login.", map[string]any{
+		"access_token":         stringSchema("Short-lived token sent in the AccessToken header."),
+		"refresh_token":        stringSchema("Token used to obtain new access tokens."),
+		"must_change_password": boolSchema("Set when the account must change its password before using other endpoints."),
+	}, "access_token", "refresh_token"),
+	"MFAChallenge": objectSchema("Returned by login instead of tokens when two-factor authentication is enabled.", map[string]any{
+		"mfa_required":    boolSchema(""),
+		"challenge_token": stringSchema("Exchanged for a token pair through the verify endpoint."),
+	}, "mfa_required", "challenge_token"),
+	"VerifyLoginRequest": objectSchema("Second login step; send either code or recovery_code.", map[string]any{
+		"challenge_token": stringSchema(""),
+		"code":            stringSchema("Current TOTP code."),
+		"recovery_code":   stringSchema("Single-use recovery code."),
+	}, "challenge_token"),
+	"RefreshResponse": objectSchema("", map[string]any{
+		"new_access_token": stringSchema(""),
+	}, "new_access_token"),
+	"OIDCStatus": objectSchema("", map[string]any{
+		"enabled": boolSchema("Whether single sign-on is configured."),
+	}, "enabled"),
+	"Session": objectSchema("A login session.", map[string]any{
+		"id":         stringSchema(""),
+		"userAgent":  stringSchema(""),
+		"remoteAddr": stringSchema(""),
+		"createdAt":  timeSchema(""),
+		"lastUsedAt": timeSchema(""),
+		"expiresAt":  timeSchema(""),
+		"current":    boolSchema("Whether this is the session making the request."),
+	}, "id", "createdAt", "lastUsedAt", "expiresAt", "current"),
+	"ChangePasswordRequest": objectSchema("Admins may set username to reset another account's password without the current password.", map[string]any{
+		"username":        stringSchema(""),
+		"currentPassword": stringSchema("Required when changing your own password."),
+		"newPassword":     stringSchema(""),
+	}, "newPassword"),
+	"CreateAccessTokenRequest": objectSchema("", map[string]any{
+		"name":          stringSchema(""),
+		"scopes":        stringListSchema("Scopes such as \"compute:read\", \"storage:write\", \"functions:invoke\" or \"pipelines:run\"."),
+		"expiresInDays": integerSchema("Lifetime in days; a server default applies when omitted."),
+	}, "name", "scopes"),
+	"AccessToken": objectSchema("A personal access token.  token is only returned when the token is created.", map[string]any{
+		"id":         stringSchema(""),
+		"name":       stringSchema(""),
+		"token":      stringSchema("The secret, shown once."),
+		"hint":       stringSchema("Last characters of the secret."),
+		"scopes":     stringListSchema(""),
+		"createdAt":  timeSchema(""),
+		"expiresAt":  timeSchema(""),
+		"lastUsedAt": timeSchema(""),
+	}, "id", "name", "hint", "scopes", "createdAt", "expiresAt"),
+	"TOTPStatus": objectSchema("", map[string]any{
+		"enabled":                boolSchema(""),
+		"pending":                boolSchema("Enrollment started but not confirmed."),
+		"recoveryCodesRemaining": integerSchema(""),
+	}, "enabled", "pending", "recoveryCodesRemaining"),
+	"TOTPEnrollment": objectSchema("", map[string]any{
+		"secret":     stringSchema("Base32 secret for manual entry."),
+		"otpauthUri": stringSchema("otpauth:// URI for QR codes."),
+	}, "secret", "otpauthUri"),
+	"TOTPCode": objectSchema("", map[string]any{
+		"code": stringSchema("Current TOTP code."),
+	}, "code"),
+	"TOTPConfirmation": objectSchema("", map[string]any{
+		"message":       stringSchema(""),
+		"recoveryCodes": stringListSchema("Single-use recovery codes, shown once."),
+	}, "recoveryCodes"),
+	"DisableTOTPRequest": objectSchema("Users disabling their own two-factor authentication confirm with their password; admins may name another user instead.", map[string]any{
+		"username": stringSchema(""),
+		"password": stringSchema(""),
+	}),
+
+	// User administration
+	"User": objectSchema("", map[string]any{
+		"username":           stringSchema(""),
+		"role":               map[string]any{"type": "string", "enum": []string{"admin", "developer", "viewer"}},
+		"disabled":           boolSchema(""),
+		"mustChangePassword": boolSchema(""),
+	}, "username", "role", "disabled", "mustChangePassword"),
+	"CreateUserRequest": objectSchema("", map[string]any{
+		"username":           stringSchema(""),
+		"password":           stringSchema(""),
+		"role":               map[string]any{"type": "string", "enum": []string{"admin", "developer", "viewer"}, "description": "Defaults to viewer."},
+		"mustChangePassword": boolSchema(""),
+	}, "username", "password"),
+	"UsernameRequest": objectSchema("", map[string]any{
+		"username": stringSchema(""),
+	}, "username"),
+	"SetUserDisabledRequest": objectSchema("", map[string]any{
+		"username": stringSchema(""),
+		"disabled": boolSchema(""),
+	}, "username", "disabled"),
+	"SetUserRoleRequest": objectSchema("", map[string]any{
+		"username": stringSchema(""),
+		"role":     map[string]any{"type": "string", "enum": []string{"admin", "developer", "viewer"}},
+	}, "username", "role"),
+	"LinkOIDCRequest": objectSchema("", map[string]any{
+		"username": stringSchema(""),
+		"subject":  stringSchema("The \"sub\" claim of the identity provider account; empty unlinks the user."),
+	}, "username"),
+	"SigningKey": objectSchema("A token signing key, without its secret.", map[string]any{
+		"id":        stringSchema(""),
+		"active":    boolSchema(""),
+		"createdAt": timeSchema(""),
+		"retiredAt": timeSchema(""),
+		"expiresAt": timeSchema("When tokens signed with a retired key stop being accepted."),
+	}, "id", "active", "createdAt"),
+	"RotateSigningKeyRequest": objectSchema("", map[string]any{
+		"gracePeriod": stringSchema("Go duration such as \"24h\"; \"0s\" logs everyone out."),
+	}),
+	"RotateSigningKeyResponse": objectSchema("", map[string]any{
+		"activeKeyId": stringSchema(""),
+		"gracePeriod": stringSchema(""),
+	}, "activeKeyId", "gracePeriod"),
+
+	// System
+	// Metrics
+	"Metrics": objectSchema("Host metrics.", map[string]any{
+		"CPU":    integerSchema("CPU usage in percent."),
+		"MEMORY": integerSchema("Memory usage in percent."),
+		"STORAGE": objectSchema("", map[string]any{
+			"UsedStorage":      stringSchema(""),
+			"AvailableStorage": stringSchema(""),
+			"TotalStorage":     stringSchema(""),
+			"PercentageUsed":   stringSchema(""),
+		}),
+	}),
+	// auditRecord
+	"AuditRecord": objectSchema("One mutating request recorded in the audit log.", map[string]any{
+		"time":       timeSchema(""),
+		"user":       stringSchema("Authenticated user; empty when the token was rejected."),
+		"method":     stringSchema(""),
+		"route":      stringSchema("Legacy route that served the request."),
+		"resource":   stringSchema("Resource type, e.g. \"bucket\" or \"container\"."),
+		"target":     stringSchema("Name or ID of the affected resource, when known."),
+		"project":    stringSchema("Project of the affected resource, for routes acting on one."),
+		"status":     integerSchema("HTTP status of the response."),
+		"outcome":    map[string]any{"type": "string", "enum": []string{auditSuccess, auditFailure, auditDenied}},
+		"remoteAddr": stringSchema(""),
+		"requestId":  stringSchema(""),
+	}, "time", "method", "route", "resource", "status", "outcome"),
+
+	// Containers
+	// ContainerInfo
+	"ContainerInfo": objectSchema("A container in the container list.", map[string]any{
+		"Id":               stringSchema(""),
+		"Names":            stringListSchema(""),
+		"Image":            stringSchema(""),
+		"State":            stringSchema("Lifecycle state such as \"running\"."),
+		"Status":           stringSchema(""),
+		"Created":          integerSchema("Unix timestamp."),
+		"Labels":           stringMapSchema(""),
+		"Pid":              integerSchema("Host PID of the init process; zero when not running."),
+		"MemoryUsageBytes": integerSchema(""),
+	}),
+	// compute.ContainerDetail
+	"ContainerDetail": objectSchema("Configuration and state of one container.", map[string]any{
+		"id":               stringSchema(""),
+		"name":             stringSchema(""),
+		"image":            stringSchema(""),
+		"state":            stringSchema(""),
+		"status":           stringSchema(""),
+		"created":          integerSchema("Unix timestamp."),
+		"env":              stringListSchema("KEY=VALUE pairs."),
+		"ports":            stringListSchema("hostIP:hostPort:containerPort/proto mappings."),
+		"binds":            stringListSchema("hostPath:containerPath[:options] binds."),
+		"restartPolicy":    stringSchema(""),
+		"autoRemove":       boolSchema(""),
+		"memoryUsageBytes": integerSchema(""),
+		"command":          stringSchema(""),
+	}),
+	// compute.PullAndRunRequest
+	"PullAndRunRequest": objectSchema("Pulls an image if needed and starts a container from it.", map[string]any{
+		"image":             stringSchema("Image to run, e.g. \"nginx:latest\"."),
+		"name":              stringSchema(""),
+		"ports":             stringListSchema("hostPort:containerPort mappings."),
+		"env":               stringListSchema("KEY=VALUE or KEY entries."),
+		"volumes":           stringListSchema("source:containerPath[:options] mounts."),
+		"restartPolicy":     map[string]any{"type": "string", "enum": []string{"no", "always", "on-failure", "unless-stopped"}},
+		"autoRemove":        boolSchema(""),
+		"command":           stringSchema("Overrides the image entrypoint command."),
+		"fullCustomCommand": stringSchema("Raw \"podman run\" arguments; when set, the other fields are ignored."),
+	}),
+	// compute.UpdateContainerRequest
+	"UpdateContainerRequest": objectSchema("Recreates a container with a new configuration.", map[string]any{
+		"containerId":   stringSchema(""),
+		"image":         stringSchema(""),
+		"name":          stringSchema(""),
+		"ports":         stringListSchema(""),
+		"env":           stringListSchema(""),
+		"volumes":       stringListSchema(""),
+		"restartPolicy": map[string]any{"type": "string", "enum": []string{"no", "always", "on-failure", "unless-stopped"}},
+		"autoRemove":    boolSchema(""),
+		"command":       stringSchema(""),
+	}, "containerId", "image"),
+	"DeleteContainerRequest": objectSchema("", map[string]any{
+		"containerId": stringSchema(""),
+	}, "containerId"),
+
+	// Functions
+	// compute.FunctionItem
+	"Function": objectSchema("A function.", map[string]any{
+		"id":           stringSchema("File name, which is also the function name."),
+		"name":         stringSchema(""),
+		"runtime":      stringSchema(""),
+		"status":       stringSchema(""),
+		"lastModified": timeSchema(""),
+		"invocations":  integerSchema(""),
+		"memorySize":   integerSchema(""),
+		"timeout":      integerSchema(""),
+		"trigger":      schemaRef("Trigger"),
+		"code":         stringSchema("Source code; only returned by create and update."),
+	}),
+	"FunctionDetail": objectSchema("A function with its source code.", map[string]any{
+		"name":         stringSchema(""),
+		"path":         stringSchema(""),
+		"Invocations":  integerSchema(""),
+		"runtime":      stringSchema(""),
+		"lastModified": timeSchema(""),
+		"sizeBytes":    integerSchema(""),
+		"code":         stringSchema(""),
+		"trigger":      schemaRef("Trigger"),
+	}),
+	"Trigger": objectSchema("", map[string]any{
+		"type":     stringSchema("\"cron\"."),
+		"schedule": stringSchema("Cron expression such as \"0 0 * * *\"."),
+		"enabled":  boolSchema(""),
+	}),
+	"CreateFunctionRequest": objectSchema("", map[string]any{
+		"name":    stringSchema("File name including the extension, e.g. \"hello.py\"."),
+		"runtime": stringSchema(""),
+		"code":    stringSchema(""),
+	}, "name", "runtime"),
+	// compute.UpdateFunctionRequest
+	"UpdateFunctionRequest": objectSchema("", map[string]any{
+		"name":       stringSchema(""),
+		"runtime":    stringSchema(""),
+		"code":       stringSchema(""),
+		"memorySize": integerSchema(""),
+		"timeout":    integerSchema(""),
+		"trigger":    schemaRef("Trigger"),
+	}, "name", "runtime"),
+	"FunctionOutput": objectSchema("", map[string]any{
+		"output": stringSchema("Standard output of the run."),
+	}, "output"),
+	"FunctionLog": objectSchema("", map[string]any{
+		"timestamp": stringSchema(""),
+		"output":    stringSchema(""),
+		"error":     stringSchema(""),
+		"status":    map[string]any{"type": "string", "enum": []string{"success", "error"}},
+	}),
+
+	// Blob storage
+	"Bucket": objectSchema("", map[string]any{
+		"name":           stringSchema(""),
+		"objectCount":    integerSchema(""),
+		"totalSize":      integerSchema("Bytes."),
+		"lastModified":   stringSchema(""),
+		"containerMount": boolSchema("Whether the bucket is exposed to containers as a Podman volume."),
+		"volumeName":     stringSchema(""),
+	}),
+	"Blob": objectSchema("An object in a bucket.", map[string]any{
+		"id":           stringSchema(""),
+		"name":         stringSchema(""),
+		"size":         integerSchema("Bytes."),
+		"contentType":  stringSchema(""),
+		"lastModified": stringSchema(""),
+		"bucket":       stringSchema(""),
+	}),
+	"CreateBucketRequest": objectSchema("", map[string]any{
+		"name":           stringSchema(""),
+		"containerMount": boolSchema(""),
+	}, "name"),
+	"RenameBucketRequest": objectSchema("", map[string]any{
+		"currentName": stringSchema(""),
+		"newName":     stringSchema(""),
+	}, "currentName", "newName"),
+	"BucketName": objectSchema("", map[string]any{
+		"name": stringSchema(""),
+	}, "name"),
+	"ObjectRef": objectSchema("", map[string]any{
+		"bucket": stringSchema(""),
+		"name":   stringSchema(""),
+	}, "bucket", "name"),
+	"UploadObjectRequest": objectSchema("The bucket field (or bucket query parameter) must come before the file.", map[string]any{
+		"bucket": stringSchema(""),
+		"file":   map[string]any{"type": "string", "format": "binary"},
+	}, "file"),
+
+	// Images
+	// ImageInfo
+	"ImageInfo": objectSchema("An image in the image list.", map[string]any{
+		"Id":          stringSchema(""),
+		"RepoTags":    stringListSchema(""),
+		"RepoDigests": stringListSchema(""),
+		"Created":     integerSchema("Unix timestamp."),
+		"Size":        integerSchema(""),
+		"VirtualSize": integerSchema(""),
+		"Labels":      stringMapSchema(""),
+		"Names":       stringListSchema(""),
+		"Image":       stringSchema(""),
+		"State":       stringSchema(""),
+		"Status":      stringSchema(""),
+	}),
+	// storage.ImageDetail
+	"ImageDetail": objectSchema("Metadata of one image.", map[string]any{
+		"id":           stringSchema(""),
+		"repoTags":     stringListSchema(""),
+		"repoDigests":  stringListSchema(""),
+		"created":      integerSchema("Unix timestamp."),
+		"size":         integerSchema(""),
+		"virtualSize":  integerSchema(""),
+		"labels":       stringMapSchema(""),
+		"architecture": stringSchema(""),
+		"os":           stringSchema(""),
+		"author":       stringSchema(""),
+		"comment":      stringSchema(""),
+		"namesHistory": stringListSchema(""),
+	}),
+	// storage.BuildImageRequest
+	"BuildImageRequest": objectSchema("", map[string]any{
+		"dockerfile": stringSchema("Must contain a FROM instruction."),
+		"imageName":  stringSchema(""),
+		"context":    stringSchema("Legacy single-file build context."),
+		"files":      stringMapSchema("Build context files, path to contents."),
+		"nocache":    boolSchema(""),
+		"platform":   stringSchema("os/arch, e.g. \"linux/arm64\"."),
+	}, "dockerfile", "imageName"),
+	// storage.PullImageRequest
+	"PullImageRequest": objectSchema("", map[string]any{
+		"imageName": stringSchema("e.g. \"nginx:latest\"."),
+		"registry":  map[string]any{"type": "string", "enum": []string{"docker.io", "quay.io"}, "description": "Defaults to docker.io."},
+	}, "imageName"),
+	// storage.DeleteImageRequest
+	"DeleteImageRequest": objectSchema("", map[string]any{
+		"imageName": stringSchema(""),
+	}, "imageName"),
+
+	// Pipelines
+	// Pipeline
+	"Pipeline": objectSchema("", map[string]any{
+		"id":          stringSchema(""),
+		"name":        stringSchema(""),
+		"description": stringSchema(""),
+		"code":        stringSchema("Shell script run by the pipeline."),
+		"branch":      stringSchema(""),
+		"status":      stringSchema(""),
+		"createdAt":   timeSchema(""),
+		"lastRun":     timeSchema(""),
+		"duration":    stringSchema(""),
+	}),
+	// CreatePipelineRequest
+	"CreatePipelineRequest": objectSchema("", map[string]any{
+		"name":        stringSchema(""),
+		"description": stringSchema(""),
+		"code":        stringSchema(""),
+		"branch":      stringSchema(""),
+	}, "name", "code"),
+	// UpdatePipelineRequest
+	"UpdatePipelineRequest": objectSchema("", map[string]any{
+		"name":        stringSchema(""),
+		"description": stringSchema(""),
+		"code":        stringSchema(""),
+		"branch":      stringSchema(""),
+	}),
+	// PipelineLog
+	"PipelineLog": objectSchema("", map[string]any{
+		"timestamp": stringSchema(""),
+		"output":    stringSchema(""),
+		"error":     stringSchema(""),
+		"status":    map[string]any{"type": "string", "enum": []string{"success", "error"}},
+	}),
+
+	// Services and instance settings
+	"ServiceName": objectSchema("", map[string]any{
+		"service": stringSchema("Service name such as \"blob_storage\"."),
+	}, "service"),
+	"ServiceStatus": objectSchema("", map[string]any{
+		"service": stringSchema(""),
+		"enabled": boolSchema(""),
+		"message": stringSchema(""),
+	}, "service", "enabled"),
+	"Domain": objectSchema("", map[string]any{
+		"domain": stringSchema(""),
+	}, "domain"),
+	// SetInstanceDomainResponse
+	"SetInstanceDomainResponse": objectSchema("Instructions for pointing nginx at the new domain.", map[string]any{
+		"domain":          stringSchema(""),
+		"nginxEditCmd":    stringSchema(""),
+		"nginxConfigLine": stringSchema(""),
+		"nginxReloadCmd":  stringSchema(""),
+		"instructions":    stringSchema(""),
+	}),
+	"SSLStatus": objectSchema("", map[string]any{
+		"email": stringSchema("Let's Encrypt account email; empty when SSL was never configured."),
+	}),
+	// ConfigureSSLResponse
+	"ConfigureSSLResponse": objectSchema("Instructions for obtaining a certificate.", map[string]any{
+		"domain":            stringSchema(""),
+		"certbotInstallCmd": stringSchema(""),
+		"certbotCmd":        stringSchema(""),
+		"autoRenewCmd":      stringSchema(""),
+		"instructions":      stringSchema(""),
+	}),
+
+	// Webhooks
+	// webhookResponse
+	"Webhook": objectSchema("A webhook subscription.", map[string]any{
+		"id":          stringSchema(""),
+		"url":         stringSchema("Where deliveries are POSTed."),
+		"events":      stringListSchema("Event types the webhook receives."),
+		"description": stringSchema(""),
+		"active":      boolSchema("Inactive webhooks receive nothing."),
+		"createdAt":   timeSchema(""),
+		"secret":      stringSchema("Key of the X-OpenCloud-Signature HMAC-SHA256; only returned on creation and rotation."),
+	}, "id", "url", "events", "active", "createdAt"),
+	// webhookRequest
+	"CreateWebhookRequest": objectSchema("", map[string]any{
+		"url":         stringSchema("Absolute http or https URL."),
+		"events":      describe(arrayOf(map[string]any{"type": "string", "enum": events.Types}), ""),
+		"description": stringSchema(""),
+		"active":      boolSchema("Defaults to true."),
+	}, "url", "events"),
+	// updateWebhookRequest
+	"UpdateWebhookRequest": objectSchema("Absent fields are left unchanged.", map[string]any{
+		"url":          stringSchema(""),
+		"events":       describe(arrayOf(map[string]any{"type": "string", "enum": events.Types}), ""),
+		"description":  stringSchema(""),
+		"active":       boolSchema(""),
+		"rotateSecret": boolSchema("Replace the signing secret and return the new one."),
+	}),
+	// webhookDelivery
+	"WebhookDelivery": objectSchema("One delivery attempt.", map[string]any{
+		"id":         stringSchema("Delivery ID, shared by the attempts of one delivery and sent as X-OpenCloud-Delivery."),
+		"eventId":    stringSchema(""),
+		"event":      stringSchema("Event type."),
+		"attempt":    integerSchema("1 for the first attempt."),
+		"time":       timeSchema(""),
+		"success":    boolSchema("Whether the receiver answered 2xx."),
+		"statusCode": integerSchema("HTTP status of the answer, absent when there was none."),
+		"error":      stringSchema("Why the request failed, when there was no answer."),
+		"response":   stringSchema("Start of the receiver's answer."),
+		"durationMs": integerSchema(""),
+	}, "id", "eventId", "event", "attempt", "time", "success", "durationMs"),
+
+	// Projects
+	// projectResponse
+	"Project": objectSchema("A project grouping functions, pipelines, buckets and containers.", map[string]any{
+		"name":        stringSchema(""),
+		"description": stringSchema(""),
+		"createdAt":   timeSchema("Absent for the default project."),
+		"members":     stringMapSchema("Role of each user granted access, by username; instance admins have access without being listed."),
+		"role":        stringSchema("The caller's role in the project."),
+	}, "name", "members", "role"),
+	// projectRequest
+	"CreateProjectRequest": objectSchema("", map[string]any{
+		"name":        stringSchema("1 to 40 lowercase letters, digits and hyphens, starting with a letter."),
+		"description": stringSchema(""),
+	}, "name"),
+	// projectMemberRequest
+	"ProjectMemberRequest": objectSchema("", map[string]any{
+		"username": stringSchema(""),
+		"role":     map[string]any{"type": "string", "enum": projectMemberRoles},
+	}, "username", "role"),
+}
+
+// apiOperations documents every legacy route registered in main.go.
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/openapi.json", id: "getOpenAPISpec", tag: "meta", summary: "This OpenAPI document", response: map[string]any{"type": "object"}, public: true},
+
+	// Authentication
+	{method: "POST", path: "/user/login", id: "login", tag: "auth", summary: "Log in with a username and password", request: schemaRef("LoginRequest"),
+		response: map[string]any{"oneOf": []any{schemaRef("LoginResponse"), schemaRef("MFAChallenge")}}, public: true},
+	{method: "POST", path: "/user/login/verify", id: "verifyLogin", tag: "auth", summary: "Complete a two-factor login", request: schemaRef("VerifyLoginRequest"), response: schemaRef("LoginResponse"), public: true},
+	{method: "GET", path: "/user/get-auth/", id: "refreshAuth", tag: "auth", summary: "Exchange an expired access token for a new one", response: schemaRef("RefreshResponse"), public: true},
+	{method: "POST", path: "/user/logout", id: "logout", tag: "auth", summary: "End the current session", response: schemaRef("Message")},
+	{method: "GET", path: "/user/oidc/status", id: "getOIDCStatus", tag: "auth", summary: "Whether single sign-on is enabled", response: schemaRef("OIDCStatus"), public: true},
+	{method: "GET", path: "/user/oidc/login", id: "oidcLogin", tag: "auth", summary: "Start a single sign-on login", status: http.StatusFound, public: true},
+	{method: "GET", path: "/user/oidc/callback", id: "oidcCallback", tag: "auth", summary: "Single sign-on redirect target",
+		query: []apiParam{{name: "code", required: true}, {name: "state", required: true}}, status: http.StatusFound, public: true},
+
+	// Own account
+	{method: "POST", path: "/user/change-password", id: "changePassword", tag: "account", summary: "Change a password", request: schemaRef("ChangePasswordRequest"), response: schemaRef("Message")},
+	{method: "GET", path: "/user/sessions", id: "listSessions", tag: "account", summary: "List your login sessions", response: arrayOf(schemaRef("Session"))},
+	{method: "DELETE", path: "/user/sessions/{id}", id: "revokeSession", tag: "account", summary: "Revoke a login session", response: schemaRef("Message")},
+	{method: "GET", path: "/user/tokens", id: "listAccessTokens", tag: "account", summary: "List your personal access tokens", response: arrayOf(schemaRef("AccessToken"))},
+	{method: "POST", path: "/user/create-token", id: "createAccessToken", tag: "account", summary: "Create a personal access token", request: schemaRef("CreateAccessTokenRequest"), response: schemaRef("AccessToken"), status: http.StatusCreated},
+	{method: "DELETE", path: "/user/tokens/{id}", id: "revokeAccessToken", tag: "account", summary: "Revoke a personal access token", response: schemaRef("Message")},
+	{method: "GET", path: "/user/totp/status", id: "getTOTPStatus", tag: "account", summary: "Two-factor authentication status", response: schemaRef("TOTPStatus")},
+	{method: "POST", path: "/user/totp/enroll", id: "enrollTOTP", tag: "account", summary: "Start two-factor enrollment", response: schemaRef("TOTPEnrollment")},
+	{method: "POST", path: "/user/totp/confirm", id: "confirmTOTP", tag: "account", summary: "Confirm two-factor enrollment", request: schemaRef("TOTPCode"), response: schemaRef("TOTPConfirmation")},
+	{method: "POST", path: "/user/totp/disable", id: "disableTOTP", tag: "account", summary: "Disable two-factor authentication", request: schemaRef("DisableTOTPRequest"), response: schemaRef("Message")},
+
+	// User administration
+	{method: "GET", path: "/user/list-users", id: "listUsers", tag: "users", summary: "List users", response: arrayOf(schemaRef("User"))},
+	{method: "POST", path: "/user/create-user", id: "createUser", tag: "users", summary: "Create a user", request: schemaRef("CreateUserRequest"), response: schemaRef("User"), status: http.StatusCreated},
+	{method: "DELETE", path: "/user/delete-user", id: "deleteUser", tag: "users", summary: "Delete a user", request: schemaRef("UsernameRequest"), response: schemaRef("Message")},
+	{method: "POST", path: "/user/set-role", id: "setUserRole", tag: "users", summary: "Change a user's role", request: schemaRef("SetUserRoleRequest"), response: schemaRef("User")},
+	{method: "POST", path: "/user/disable-user", id: "setUserDisabled", tag: "users", summary: "Disable or re-enable a user", request: schemaRef("SetUserDisabledRequest"), response: schemaRef("User")},
+	{method: "POST", path: "/user/unlock-user", id: "unlockUser", tag: "users", summary: "Clear a login lockout", request: schemaRef("UsernameRequest"), response: schemaRef("Message")},
+	{method: "POST", path: "/user/link-oidc", id: "linkUserSSO", tag: "users", summary: "Link a user to an identity provider account for single sign-on", request: schemaRef("LinkOIDCRequest"), response: schemaRef("User")},
+	{method: "GET", path: "/user/signing-keys", id: "listSigningKeys", tag: "users", summary: "List token signing keys", response: arrayOf(schemaRef("SigningKey"))},
+	{method: "POST", path: "/user/rotate-signing-key", id: "rotateSigningKey", tag: "users", summary: "Rotate the token signing key", request: schemaRef("RotateSigningKeyRequest"), response: schemaRef("RotateSigningKeyResponse")},
+
+	// System
+	{method: "GET", path: "/get-server-metrics", id: "getSystemMetrics", tag: "system", summary: "CPU, memory and storage usage", response: schemaRef("Metrics")},
+	{method: "GET", path: "/metrics", id: "getPrometheusMetrics", tag: "system", summary: "Metrics in the Prometheus text format", media: "text/plain"},
+	{method: "GET", path: "/get-audit-log", id: "getAuditLog", tag: "system", summary: "Query the audit log of mutating requests, newest first",
+		query: []apiParam{
+			{name: "user", description: "Only records of this user."},
+			{name: "resource", description: "Only records of this resource type."},
+			{name: "since", description: "RFC 3339 time; only records at or after it."},
+			{name: "until", description: "RFC 3339 time; only records before it."},
+			{name: "limit", description: "Maximum number of records, 1 to 1000 (default 100).", integer: true},
+		}, response: arrayOf(schemaRef("AuditRecord"))},
+	{method: "GET", path: "/backup", id: "getBackup", tag: "system", summary: "Download a checksummed archive of the whole instance; write requests wait while it is written, and 503 means they did not finish in time",
+		query: []apiParam{
+			{name: "images", description: "true to include the tagged Podman images."},
+			{name: "volumes", description: "true to include the Podman volumes other than those of container-mount buckets."},
+		}, media: "application/gzip"},
+	{method: "GET", path: "/events", id: "streamEvents", tag: "system", summary: "Stream platform activity as server-sent events; send Last-Event-ID to replay missed events",
+		query: []apiParam{
+			{name: "types", description: "Comma-separated event types to receive; all when absent."},
+			{name: "lastEventId", description: "Replay the events after this one, for clients that cannot send Last-Event-ID."},
+		}, media: "text/event-stream"},
+
+	// Containers
+	{method: "GET", path: "/get-containers", id: "listContainers", tag: "containers", summary: "List containers", paged: true,
+		query: listQuery([]string{"name", "created", "state", "image"}, "-created", []apiParam{
+			{name: "state", description: "Only containers in this state, e.g. running or exited."}, labelFilter, prefixFilter,
+		}), response: arrayOf(schemaRef("ContainerInfo"))},
+	{method: "POST", path: "/pull-and-run", id: "runContainer", tag: "containers", summary: "Pull an image and start a container", request: schemaRef("PullAndRunRequest"), response: schemaRef("Result")},
+	{method: "POST", path: "/pull-and-run-stream", id: "runContainerStream", tag: "containers", summary: "Pull an image and start a container, streaming progress", request: schemaRef("PullAndRunRequest"), media: "text/event-stream"},
+	{method: "GET", path: "/get-container", id: "getContainer", tag: "containers", summary: "Get a container", query: []apiParam{{name: "id", description: "Container ID or name.", required: true}}, response: schemaRef("ContainerDetail")},
+	{method: "POST", path: "/update-container", id: "updateContainer", tag: "containers", summary: "Recreate a container with a new configuration", request: schemaRef("UpdateContainerRequest"), response: schemaRef("Result")},
+	{method: "POST", path: "/delete-container", id: "deleteContainer", tag: "containers", summary: "Remove a container", request: schemaRef("DeleteContainerRequest"), response: schemaRef("Result")},
+	{method: "GET", path: "/container-logs", id: "getContainerLogs", tag: "containers", summary: "Container logs",
+		query: []apiParam{{name: "id", description: "Container ID or name.", required: true}, {name: "tail", description: "Number of lines from the end.", integer: true}}, media: "text/plain"},
+	{method: "POST", path: "/containers/{id}/{action}", id: "containerAction", tag: "containers", summary: "Start or stop a container (action is \"start\" or \"stop\")", response: schemaRef("Result")},
+
+	// Functions
+	{method: "GET", path: "/list-functions", id: "listFunctions", tag: "functions", summary: "List functions", paged: true,
+		query: listQuery([]string{"name", "modified", "invocations", "runtime"}, "name", []apiParam{
+			{name: "runtime", description: "Only functions with this runtime, e.g. python3 or nodejs."}, prefixFilter,
+		}), response: arrayOf(schemaRef("Function"))},
+	{method: "POST", path: "/create-function", id: "createFunction", tag: "functions", summary: "Create a function", request: schemaRef("CreateFunctionRequest"), response: schemaRef("Function"), status: http.StatusCreated},
+	{method: "GET", path: "/get-function/{name}", id: "getFunction", tag: "functions", summary: "Get a function", response: schemaRef("FunctionDetail")},
+	{method: "PUT", path: "/update-function/{name}", id: "updateFunction", tag: "functions", summary: "Update a function", request: schemaRef("UpdateFunctionRequest"), response: schemaRef("Function")},
+	{method: "DELETE", path: "/delete-function", id: "deleteFunction", tag: "functions", summary: "Delete a function", query: []apiParam{{name: "name", required: true}}, response: schemaRef("Result")},
+	{method: "POST", path: "/invoke-function", id: "invokeFunction", tag: "functions", summary: "Run a function; a JSON object body is passed on its standard input",
+		query: []apiParam{{name: "name", required: true}}, request: map[string]any{"type": "object"}, response: schemaRef("FunctionOutput")},
+	{method: "GET", path: "/get-function-logs/{name}", id: "getFunctionLogs", tag: "functions", summary: "Function run logs", response: arrayOf(schemaRef("FunctionLog"))},
+	{method: "POST", path: "/sync-functions", id: "syncFunctions", tag: "functions", summary: "Rebuild the function entries of the service ledger from disk", response: schemaRef("Message")},
+
+	// Blob storage
+	{method: "GET", path: "/list-blob-buckets", id: "listBuckets", tag: "storage", summary: "List buckets", paged: true,
+		query: listQuery([]string{"name", "size", "objects", "modified"}, "name", []apiParam{prefixFilter}), response: arrayOf(schemaRef("Bucket"))},
+	{method: "POST", path: "/create-bucket", id: "createBucket", tag: "storage", summary: "Create a bucket", request: schemaRef("CreateBucketRequest"), response: schemaRef("Result"), status: http.StatusCreated},
+	{method: "PUT", path: "/rename-bucket", id: "renameBucket", tag: "storage", summary: "Rename a bucket", request: schemaRef("RenameBucketRequest"), response: schemaRef("Result")},
+	{method: "DELETE", path: "/delete-bucket", id: "deleteBucket", tag: "storage", summary: "Delete a bucket and its objects", request: schemaRef("BucketName"), response: schemaRef("Result")},
+	{method: "GET", path: "/get-blobs", id: "listObjects", tag: "storage", summary: "List objects", paged: true,
+		query:    listQuery([]string{"name", "size", "modified"}, "name", []apiParam{prefixFilter}, apiParam{name: "bucket", description: "Only list this bucket."}),
+		response: arrayOf(schemaRef("Blob"))},
+	{method: "POST", path: "/upload-object", id: "uploadObject", tag: "storage", summary: "Upload an object", query: []apiParam{{name: "bucket", description: "Target bucket, instead of the bucket form field."}},
+		multipart: schemaRef("UploadObjectRequest"), response: schemaRef("Result"), status: http.StatusCreated},
+	{method: "POST", path: "/download-object", id: "downloadObject", tag: "storage", summary: "Download an object", request: schemaRef("ObjectRef"), media: "application/octet-stream"},
+	{method: "DELETE", path: "/delete-object", id: "deleteObject", tag: "storage", summary: "Delete an object", request: schemaRef("ObjectRef"), response: schemaRef("Result")},
+	{method: "GET", path: "/list-container-mount-buckets", id: "listBucketMounts", tag: "storage", summary: "List buckets mounted into containers", response: arrayOf(schemaRef("Bucket"))},
+
+	// Images
+	{method: "GET", path: "/get-images", id: "listImages", tag: "images", summary: "List images, one item per tag", paged: true,
+		query: listQuery([]string{"name", "created", "size"}, "-created", []apiParam{labelFilter, prefixFilter}), response: arrayOf(schemaRef("ImageInfo"))},
+	{method: "POST", path: "/build-image", id: "buildImage", tag: "images", summary: "Build an image", request: schemaRef("BuildImageRequest"), response: schemaRef("Result")},
+	{method: "POST", path: "/build-image-stream", id: "buildImageStream", tag: "images", summary: "Build an image, streaming progress", request: schemaRef("BuildImageRequest"), media: "text/event-stream"},
+	{method: "POST", path: "/pull-image", id: "pullImage", tag: "images", summary: "Pull an image", request: schemaRef("PullImageRequest"), response: schemaRef("Result")},
+	{method: "POST", path: "/pull-image-stream", id: "pullImageStream", tag: "images", summary: "Pull an image, streaming progress", request: schemaRef("PullImageRequest"), media: "text/event-stream"},
+	{method: "GET", path: "/get-image", id: "getImage", tag: "images", summary: "Get an image", query: []apiParam{{name: "name", description: "Image ID or name.", required: true}}, response: schemaRef("ImageDetail")},
+	{method: "POST", path: "/delete-image", id: "deleteImage", tag: "images", summary: "Delete an image", request: schemaRef("DeleteImageRequest"), response: schemaRef("Result")},
+	{method: "GET", path: "/get-image-logs", id: "getImageLogs", tag: "images", summary: "Build or pull logs of an image", query: []apiParam{{name: "name", description: "Image name.", required: true}}, media: "text/plain"},
+
+	// Pipelines
+	{method: "GET", path: "/get-pipelines", id: "listPipelines", tag: "pipelines", summary: "List pipelines", paged: true,
+		query: listQuery([]string{"name", "created", "status"}, "name", []apiParam{
+			{name: "status", description: "Only pipelines with this status, e.g. running or failed."}, prefixFilter,
+		}), response: arrayOf(schemaRef("Pipeline"))},
+	{method: "POST", path: "/create-pipeline", id: "createPipeline", tag: "pipelines", summary: "Create a pipeline", request: schemaRef("CreatePipelineRequest"), response: schemaRef("Pipeline"), status: http.StatusCreated},
+	{method: "GET", path: "/get-pipeline/{id}", id: "getPipeline", tag: "pipelines", summary: "Get a pipeline", response: schemaRef("Pipeline")},
+	{method: "PUT", path: "/update-pipeline/{id}", id: "updatePipeline", tag: "pipelines", summary: "Update a pipeline", request: schemaRef("UpdatePipelineRequest"), response: schemaRef("Pipeline")},
+	{method: "DELETE", path: "/delete-pipeline/{id}", id: "deletePipeline", tag: "pipelines", summary: "Delete a pipeline", response: schemaRef("Result")},
+	{method: "POST", path: "/run-pipeline/{id}", id: "runPipeline", tag: "pipelines", summary: "Start a pipeline run in the background", response: schemaRef("Result")},
+	{method: "POST", path: "/stop-pipeline/{id}", id: "stopPipeline", tag: "pipelines", summary: "Stop a running pipeline", response: schemaRef("Message")},
+	{method: "GET", path: "/get-pipeline-logs/{id}", id: "getPipelineLogs", tag: "pipelines", summary: "Pipeline run logs", response: arrayOf(schemaRef("PipelineLog"))},
+	{method: "POST", path: "/sync-pipelines", id: "syncPipelines", tag: "pipelines", summary: "Rebuild the pipeline entries of the service ledger from disk", response: schemaRef("Message")},
+
+	// Services
+	{method: "GET", path: "/get-service-status", id: "getServiceStatus", tag: "services", summary: "Whether an optional service is enabled", query: []apiParam{{name: "service", required: true}}, response: schemaRef("ServiceStatus")},
+	{method: "POST", path: "/enable-service", id: "enableService", tag: "services", summary: "Install and enable an optional service", request: schemaRef("ServiceName"), response: schemaRef("ServiceStatus")},
+	{method: "POST", path: "/enable-service-stream", id: "enableServiceStream", tag: "services", summary: "Install and enable an optional service, streaming progress", request: schemaRef("ServiceName"), media: "text/event-stream"},
+
+	// Instance settings
+	{method: "GET", path: "/get-instance-domain", id: "getInstanceDomain", tag: "instance", summary: "Configured domain", response: schemaRef("Domain")},
+	{method: "POST", path: "/set-instance-domain", id: "setInstanceDomain", tag: "instance", summary: "Set the domain", request: schemaRef("Domain"), response: schemaRef("SetInstanceDomainResponse")},
+	{method: "GET", path: "/get-ssl-status", id: "getSSLStatus", tag: "instance", summary: "SSL configuration status", response: schemaRef("SSLStatus")},
+	{method: "POST", path: "/configure-ssl", id: "configureSSL", tag: "instance", summary: "Get instructions for enabling SSL", request: schemaRef("Domain"), response: schemaRef("ConfigureSSLResponse")},
+
+	// Webhooks
+	{method: "GET", path: "/list-webhooks", id: "listWebhooks", tag: "webhooks", summary: "List webhooks", response: arrayOf(schemaRef("Webhook"))},
+	{method: "POST", path: "/create-webhook", id: "createWebhook", tag: "webhooks", summary: "Create a webhook; the response holds its signing secret", request: schemaRef("CreateWebhookRequest"), response: schemaRef("Webhook"), status: http.StatusCreated},
+	{method: "GET", path: "/get-webhook/{id}", id: "getWebhook", tag: "webhooks", summary: "Get a webhook", response: schemaRef("Webhook")},
+	{method: "PUT", path: "/update-webhook/{id}", id: "updateWebhook", tag: "webhooks", summary: "Update a webhook or rotate its secret", request: schemaRef("UpdateWebhookRequest"), response: schemaRef("Webhook")},
+	{method: "DELETE", path: "/delete-webhook/{id}", id: "deleteWebhook", tag: "webhooks", summary: "Delete a webhook and its delivery log", response: schemaRef("Result")},
+	{method: "GET", path: "/get-webhook-deliveries/{id}", id: "getWebhookDeliveries", tag: "webhooks", summary: "Delivery attempts of a webhook, newest first",
+		query: []apiParam{
+			{name: "limit", description: "Maximum number of attempts, 1 to 1000 (default 100).", integer: true},
+		}, response: arrayOf(schemaRef("WebhookDelivery"))},
+
+	// Projects
+	{method: "GET", path: "/list-projects", id: "listProjects", tag: "projects", summary: "List the projects you can access", response: arrayOf(schemaRef("Project"))},
+	{method: "POST", path: "/create-project", id: "createProject", tag: "projects", summary: "Create a project", request: schemaRef("CreateProjectRequest"), response: schemaRef("Project"), status: http.StatusCreated},
+	{method: "GET", path: "/get-project/{name}", id: "getProject", tag: "projects", summary: "Get a project", response: schemaRef("Project")},
+	{method: "DELETE", path: "/delete-project/{name}", id: "deleteProject", tag: "projects", summary: "Delete an empty project", response: schemaRef("Message")},
+	{method: "PUT", path: "/set-project-member/{name}", id: "setProjectMember", tag: "projects", summary: "Grant a user a role in a project", request: schemaRef("ProjectMemberRequest"), response: schemaRef("Project")},
+	{method: "DELETE", path: "/remove-project-member/{name}", id: "removeProjectMember", tag: "projects", summary: "Revoke a user's access to a project", request: schemaRef("UsernameRequest"), response: schemaRef("Project")},
+}
+
+// projectParam documents the query parameter selecting the project of the
+// routes that act on the resources of one.
+var projectParam = apiParam{name: "project", description: "Project to work in (default \"default\")."}
+
+// findAPIOperation returns the documentation of a legacy route given as
+// "METHOD /path", ignoring any query template.
+func findAPIOperation(route string) (apiOperation, bool) {
+	method, rawURL, _ := strings.Cut(route, " ")
+	path, _, _ := strings.Cut(rawURL, "?")
+	for _, op := range apiOperations {
+		if op.method == method && op.path == path {
+			return op, true
+		}
+	}
+	return apiOperation{}, false
+}
+
+// coversRequired reports whether body, the fields a v1 route fills in from
+// its path, includes every required property of the request schema, so the
+// v1 operation needs no request body.
+func coversRequired(request any, body map[string]string) bool {
+	ref, ok := request.(map[string]any)["$ref"].(string)
+	if !ok {
+		return false
+	}
+	schema, _ := openAPISchemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+	required, _ := schema["required"].([]string)
+	for _, name := range required {
+		if _, ok := body[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// pathParameters describes the {name} segments of path.
+func pathParameters(path string) []any {
+	var params []any
+	for _, name := range patternWildcards(path) {
+		params = append(params, map[string]any{
+			"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	return params
+}
+
+// queryParameters describes params, leaving out those in skip.
+func queryParameters(params []apiParam, skip map[string]bool) []any {
+	var out []any
+	for _, p := range params {
+		if skip[p.name] {
+			continue
+		}
+		typ := "string"
+		if p.integer {
+			typ = "integer"
+		}
+		param := map[string]any{"name": p.name, "in": "query", "required": p.required, "schema": map[string]any{"type": typ}}
+		if p.description != "" {
+			param["description"] = p.description
+		}
+		out = append(out, param)
+	}
+	return out
+}
+
+// responses builds the responses object for op, adding stream as an
+// alternative text/event-stream representation when it is set.
+func (op apiOperation) responses(stream bool) map[string]any {
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	content := map[string]any{}
+	switch {
+	case op.media == "text/event-stream", op.media == "text/plain":
+		content[op.media] = map[string]any{"schema": map[string]any{"type": "string"}}
+	case op.media != "":
+		content[op.media] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+	case op.response != nil:
+		content["application/json"] = map[string]any{"schema": op.response}
+	}
+	if stream {
+		content["text/event-stream"] = map[string]any{"schema": map[string]any{"type": "string"}}
+	}
+
+	success := map[string]any{"description": http.StatusText(status)}
+	if len(content) > 0 {
+		success["content"] = content
+	}
+	if op.paged {
+		success["headers"] = map[string]any{
+			listing.NextCursorHeader: map[string]any{
+				"description": "Cursor of the next page; absent on the last page.",
+				"schema":      map[string]any{"type": "string"},
+			},
+		}
+	}
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/json": map[string]any{"schema": schemaRef("Error")}},
+		}
+	}
+	resp := map[string]any{
+		strconv.Itoa(status): success,
+		"default":            errorResponse("Error"),
+	}
+	if !op.public {
+		resp["401"] = errorResponse("Missing or invalid access token")
+		resp["403"] = errorResponse("The caller's role or token scopes do not allow this")
+	}
+	return resp
+}
+
+// operation renders op as an OpenAPI operation object.
+func (op apiOperation) operation(id, path string, skipQuery map[string]bool, stream bool) map[string]any {
+	out := map[string]any{
+		"operationId": id,
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+		"responses":   op.responses(stream),
+	}
+	query := op.query
+	if route, _, _ := strings.Cut(op.path, "{"); isProjectRoute(route) {
+		query = append(query[:len(query):len(query)], projectParam)
+	}
+	params := append(pathParameters(path), queryParameters(query, skipQuery)...)
+	if op.method == http.MethodPost && isIdempotentRoute(op.path) {
+		params = append(params, map[string]any{
+			"name": IdempotencyKeyHeader, "in": "header", "required": false, "schema": map[string]any{"type": "string", "maxLength": maxIdempotencyKeyLength},
+			"description": "Makes retries safe: the first response is kept for 24 hours and replayed, with Idempotent-Replayed: true, " +
+				"to retries with the same key and body.  Reusing the key for a different request is rejected with 422.",
+		})
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+	switch {
+	case op.request != nil:
+		out["requestBody"] = map[string]any{
+			"content": map[string]any{"application/json": map[string]any{"schema": op.request}},
+		}
+	case op.multipart != nil:
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"multipart/form-data": map[string]any{"schema": op.multipart}},
+		}
+	}
+	if op.public {
+		out["security"] = []any{}
+	}
+	return out
+}
+
+// buildOpenAPISpec assembles the OpenAPI document.
+func buildOpenAPISpec() map[string]any {
+	paths := map[string]map[string]any{}
+	addOperation := func(path, method string, operation map[string]any) {
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(method)] = operation
+	}
+
+	for _, route := range v1Routes {
+		op, ok := findAPIOperation(route.legacy)
+		if !ok {
+			continue
+		}
+		method, path, _ := strings.Cut(route.pattern, " ")
+
+		// Query parameters and body fields filled in from the path are
+		// not part of the v1 operation.
+		skip := map[string]bool{}
+		_, legacyURL, _ := strings.Cut(route.legacy, " ")
+		if _, rawQuery, ok := strings.Cut(legacyURL, "?"); ok {
+			for _, pair := range strings.Split(rawQuery, "&") {
+				name, _, _ := strings.Cut(pair, "=")
+				skip[name] = true
+			}
+		}
+		if len(route.body) > 0 && coversRequired(op.request, route.body) {
+			op.request = nil
+		}
+
+		id := op.id
+		if route.id != "" {
+			id = route.id
+		}
+		addOperation(path, method, op.operation(id, path, skip, route.stream != ""))
+	}
+
+	for _, op := range apiOperations {
+		operation := op.operation("legacy"+strings.ToUpper(op.id[:1])+op.id[1:], op.path, nil, false)
+		if op.path != "/openapi.json" && op.path != "/metrics" {
+			operation["deprecated"] = true
+		}
+		addOperation(op.path, op.method, operation)
+	}
+
+	tags := map[string]bool{}
+	for _, op := range apiOperations {
+		tags[op.tag] = true
+	}
+	tagList := make([]any, 0, len(tags))
+	for _, name := range sortedKeys(tags) {
+		tagList = append(tagList, map[string]any{"name": name})
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "OpenCloud API",
+			"version": "1.0.0",
+			"description": "Resource-oriented endpoints live under /api/v1.  The verb-style routes at the root are " +
+				"deprecated aliases kept for the web UI.  Requests authenticate with an access token or a personal " +
+				"access token in the AccessToken header.",
+		},
+		"tags":     tagList,
+		"paths":    paths,
+		"security": []any{map[string]any{"accessToken": []string{}}},
+		"components": map[string]any{
+			"schemas": openAPISchemas,
+			"securitySchemes": map[string]any{
+				"accessToken": map[string]any{"type": "apiKey", "in": "header", "name": "AccessToken"},
+			},
+		},
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+	openAPIErr  error
+)
+
+// GetOpenAPISpec handles GET /openapi.json.
+// It serves the OpenAPI 3 description of every route.
+func GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	openAPIOnce.Do(func() {
+		openAPIJSON, openAPIErr = json.MarshalIndent(buildOpenAPISpec(), "", "  ")
+	})
+	if openAPIErr != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to build API description")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// servedSpec fetches /openapi.json through the handler and decodes it.
+func servedSpec(t *testing.T) map[string]any {
+	t.Helper()
+	w := httptest.NewRecorder()
+	GetOpenAPISpec(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: status %d", w.Code)
+	}
+	var spec map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if spec["openapi"] != "3.0.3" {
+		t.Fatalf("openapi = %v", spec["openapi"])
+	}
+	return spec
+}
+
+// TestOpenAPICoversEveryRoute fails when a route registered in main.go or an
+// /api/v1 route is missing from the OpenAPI document.
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	src, err := os.ReadFile("../main.go")
+	if err != nil {
+		t.Skipf("main.go not available: %v", err)
+	}
+	paths := servedSpec(t)["paths"].(map[string]any)
+
+	routes := regexp.MustCompile(`HandleFunc\("([^"]+)"`).FindAllStringSubmatch(string(src), -1)
+	if len(routes) == 0 {
+		t.Fatalf("no routes found in main.go")
+	}
+	for _, m := range routes {
+		route := m[1]
+		if _, ok := paths[route]; ok {
+			continue
+		}
+		// A prefix route is documented with its trailing segments as
+		// parameters, e.g. /get-pipeline/ as /get-pipeline/{id}.
+		found := false
+		if strings.HasSuffix(route, "/") {
+			for path := range paths {
+				if strings.HasPrefix(path, route+"{") {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			t.Errorf("route %s is missing from the OpenAPI document", route)
+		}
+	}
+
+	for _, route := range v1Routes {
+		method, path, _ := strings.Cut(route.pattern, " ")
+		item, _ := paths[path].(map[string]any)
+		if _, ok := item[strings.ToLower(method)]; !ok {
+			t.Errorf("%s is missing from the OpenAPI document", route.pattern)
+		}
+	}
+}
+
+// TestOpenAPIOperationsAreWellFormed checks operation IDs are unique, every
+// path parameter is declared and every $ref resolves.
+func TestOpenAPIOperationsAreWellFormed(t *testing.T) {
+	spec := servedSpec(t)
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+
+	ids := map[string]string{}
+	for path, item := range spec["paths"].(map[string]any) {
+		for method, raw := range item.(map[string]any) {
+			op := raw.(map[string]any)
+			where := strings.ToUpper(method) + " " + path
+
+			id, _ := op["operationId"].(string)
+			if id == "" {
+				t.Errorf("%s has no operationId", where)
+			} else if other, dup := ids[id]; dup {
+				t.Errorf("operationId %s used by %s and %s", id, other, where)
+			}
+			ids[id] = where
+
+			declared := map[string]bool{}
+			params, _ := op["parameters"].([]any)
+			for _, p := range params {
+				if p := p.(map[string]any); p["in"] == "path" {
+					declared[p["name"].(string)] = true
+				}
+			}
+			for _, name := range patternWildcards(path) {
+				if !declared[name] {
+					t.Errorf("%s does not declare path parameter %s", where, name)
+				}
+			}
+		}
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+					t.Errorf("unresolved $ref %s", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+}
+
+// TestOpenAPISchemasMatchTypes keeps the schemas of this package's request
+// and response types in step with their JSON field names.
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	types := map[string]any{
+		"Error":                     apierror.Error{},
+		"LoginRequest":              loginRequest{},
+		"LoginResponse":             loginResponse{},
+		"MFAChallenge":              mfaChallengeResponse{},
+		"VerifyLoginRequest":        verifyLoginRequest{},
+		"Session":                   sessionResponse{},
+		"ChangePasswordRequest":     changePasswordRequest{},
+		"CreateAccessTokenRequest":  createAccessTokenRequest{},
+		"AccessToken":               accessTokenResponse{},
+		"TOTPStatus":                totpStatusResponse{},
+		"User":                      userResponse{},
+		"CreateUserRequest":         createUserRequest{},
+		"LinkOIDCRequest":           linkOIDCRequest{},
+		"SigningKey":                signingKeyInfo{},
+		"RotateSigningKeyRequest":   rotateSigningKeyRequest{},
+		"Metrics":                   Metrics{},
+		"AuditRecord":               auditRecord{},
+		"ContainerInfo":             ContainerInfo{},
+		"ImageInfo":                 ImageInfo{},
+		"Pipeline":                  Pipeline{},
+		"CreatePipelineRequest":     CreatePipelineRequest{},
+		"UpdatePipelineRequest":     UpdatePipelineRequest{},
+		"PipelineLog":               PipelineLog{},
+		"SetInstanceDomainResponse": SetInstanceDomainResponse{},
+		"ConfigureSSLResponse":      ConfigureSSLResponse{},
+		"Webhook":                   webhookResponse{},
+		"CreateWebhookRequest":      webhookRequest{},
+		"UpdateWebhookRequest":      updateWebhookRequest{},
+		"WebhookDelivery":           webhookDelivery{},
+		"Project":                   projectResponse{},
+		"CreateProjectRequest":      projectRequest{},
+		"ProjectMemberRequest":      projectMemberRequest{},
+	}
+
+	for name, value := range types {
+		schema, ok := openAPISchemas[name].(map[string]any)
+		if !ok {
+			t.Errorf("no schema %s", name)
+			continue
+		}
+		var documented []string
+		for prop := range schema["properties"].(map[string]any) {
+			documented = append(documented, prop)
+		}
+		var fields []string
+		typ := reflect.TypeOf(value)
+		for i := 0; i < typ.NumField(); i++ {
+			tag, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if tag != "" && tag != "-" {
+				fields = append(fields, tag)
+			}
+		}
+		sort.Strings(documented)
+		sort.Strings(fields)
+		if !reflect.DeepEqual(documented, fields) {
+			t.Errorf("schema %s has properties %v, but %s has fields %v", name, documented, typ.Name(), fields)
+		}
+	}
+}
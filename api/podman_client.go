@@ -9,11 +9,11 @@ import (
 	"strings"
 
 	"github.com/containers/podman/v5/pkg/bindings"
+	"github.com/containers/podman/v5/pkg/bindings/containers"
 )
 
 func rootlessPodmanSocket() (string, error) {
 	if xdg := os.Getenv("XDG_RUNTIME_DIR"); xdg != "" {
-		fmt.Println("Actually we are here")
 		return "unix://" + filepath.Join("/run/user", "1000", "podman", "podman.sock"), nil
 		//return "unix://" + filepath.Join(xdg, "podman", "podman.sock"), nil
 	}
@@ -64,6 +64,42 @@ func RootlessPodmanConnection(ctx context.Context) (context.Context, error) {
 	return rootlessPodmanConnection(ctx)
 }
 
+// podmanContainerStates counts the containers in the rootless Podman store
+// by state, e.g. {"running": 3, "exited": 1}.
+func podmanContainerStates(ctx context.Context) (map[string]int, error) {
+	conn, err := rootlessPodmanConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, err := containers.List(conn, new(containers.ListOptions).WithAll(true))
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]int)
+	for _, ctr := range list {
+		states[ctr.State]++
+	}
+	return states, nil
+}
+
+// podmanProjectContainers counts the containers in the rootless Podman store
+// labelled with project.  Without a Podman socket there are none.
+func podmanProjectContainers(ctx context.Context, project string) (int, error) {
+	if !hasPodmanSocket() {
+		return 0, nil
+	}
+	conn, err := rootlessPodmanConnection(ctx)
+	if err != nil {
+		return 0, err
+	}
+	filters := map[string][]string{"label": {ProjectLabel + "=" + project}}
+	list, err := containers.List(conn, new(containers.ListOptions).WithAll(true).WithFilters(filters))
+	if err != nil {
+		return 0, err
+	}
+	return len(list), nil
+}
+
 func hasPodmanSocket() bool {
 	for _, uri := range podmanSocketCandidates() {
 		socketPath := podmanSocketPath(uri)
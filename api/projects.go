@@ -0,0 +1,531 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// Projects group functions, pipelines, buckets and containers, so teams that
+// share an instance each get their own namespace.  A request picks the
+// project it works in with the "project" query parameter; without one it
+// works in utils.DefaultProject, which holds everything created before
+// projects existed.
+//
+// Access to a project follows the caller's role in it: instance admins are
+// admins in every project, the default project uses the instance role, and
+// any other project uses the role the user was granted as a member.  Users
+// who are not members of a project cannot reach its resources at all.
+
+// ProjectLabel is the container label naming the project a container belongs
+// to.  Containers without it belong to the default project.
+const ProjectLabel = "opencloud/project"
+
+// ContainerProject returns the project of a container with the given labels.
+func ContainerProject(labels map[string]string) string {
+	if project := labels[ProjectLabel]; project != "" {
+		return project
+	}
+	return utils.DefaultProject
+}
+
+// projectRoutes lists the routes that act on the resources of one project,
+// keyed like routePermissions.  Images and the service ledger are shared by
+// the whole instance.
+var projectRoutes = map[string]bool{
+	// Containers
+	"/get-containers":      true,
+	"/get-container":       true,
+	"/container-logs":      true,
+	"/containers/":         true,
+	"/delete-container":    true,
+	"/pull-and-run":        true,
+	"/pull-and-run-stream": true,
+	"/update-container":    true,
+
+	// Functions
+	"/list-functions":     true,
+	"/get-function/":      true,
+	"/get-function-logs/": true,
+	"/invoke-function":    true,
+	"/create-function":    true,
+	"/delete-function":    true,
+	"/update-function/":   true,
+
+	// Blob storage
+	"/list-blob-buckets":            true,
+	"/get-blobs":                    true,
+	"/download-object":              true,
+	"/list-container-mount-buckets": true,
+	"/create-bucket":                true,
+	"/upload-object":                true,
+	"/delete-object":                true,
+	"/delete-bucket":                true,
+	"/rename-bucket":                true,
+
+	// CI/CD pipelines
+	"/get-pipelines":      true,
+	"/get-pipeline/":      true,
+	"/get-pipeline-logs/": true,
+	"/create-pipeline":    true,
+	"/update-pipeline/":   true,
+	"/delete-pipeline/":   true,
+	"/run-pipeline/":      true,
+	"/stop-pipeline/":     true,
+}
+
+// projectMemberRoles are the roles a user can be granted in a project.
+// Administering a project is left to instance admins.
+var projectMemberRoles = []string{roleDeveloper, roleViewer}
+
+// isProjectRoute reports whether path is in projectRoutes, matching prefix
+// routes like lookupRoutePermission.
+func isProjectRoute(path string) bool {
+	if projectRoutes[path] {
+		return true
+	}
+	for pattern := range projectRoutes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedProject returns the project named by the request's "project"
+// query parameter, or the default project when there is none.
+func requestedProject(r *http.Request) string {
+	if project := r.URL.Query().Get("project"); project != "" {
+		return project
+	}
+	return utils.DefaultProject
+}
+
+// projectContextKey is the context key under which RequireAuth stores the
+// project a request works in.
+const projectContextKey authContextKey = "project"
+
+// RequestProject returns the project the request with context ctx works in,
+// as stored by RequireAuth.  It is the default project for requests that did
+// not pass through the middleware.
+func RequestProject(ctx context.Context) string {
+	if project, ok := ctx.Value(projectContextKey).(string); ok && project != "" {
+		return project
+	}
+	return utils.DefaultProject
+}
+
+// WithRequestProject returns a copy of ctx working in project, for callers
+// and tests that bypass RequireAuth.
+func WithRequestProject(ctx context.Context, project string) context.Context {
+	return context.WithValue(ctx, projectContextKey, project)
+}
+
+// projectRole returns the role user holds in project, or "" when the user
+// has no access to it or it does not exist.
+func projectRole(user *userRecord, project *service_ledger.ProjectEntry) string {
+	if user.Role == roleAdmin || project.Name == utils.DefaultProject {
+		return user.Role
+	}
+	return project.Members[user.Username]
+}
+
+// resolveProject finds the project the request works in and the role user
+// holds in it.  The error answers requests for a project that is invalid,
+// unknown, or out of the user's reach.
+func resolveProject(r *http.Request, user *userRecord) (string, string, *apierror.Error) {
+	name := requestedProject(r)
+	if !utils.ValidProjectName(name) {
+		return "", "", apierror.New(http.StatusBadRequest, "invalid project name")
+	}
+	project, err := service_ledger.GetProjectEntry(name)
+	if err != nil {
+		return "", "", apierror.Ledger(err, "failed to read projects")
+	}
+	if project == nil {
+		return "", "", apierror.New(http.StatusNotFound, fmt.Sprintf("project %q not found", name))
+	}
+	role := projectRole(user, project)
+	if role == "" {
+		return "", "", apierror.New(http.StatusForbidden, fmt.Sprintf("you are not a member of project %q", name))
+	}
+	return name, role, nil
+}
+
+// canSeeProject reports whether user may see the events of project.
+func canSeeProject(user *userRecord, project string) bool {
+	if user.Role == roleAdmin || project == utils.DefaultProject {
+		return true
+	}
+	entry, err := service_ledger.GetProjectEntry(project)
+	if err != nil || entry == nil {
+		return false
+	}
+	return projectRole(user, entry) != ""
+}
+
+// countProjectContainers returns how many containers belong to project.
+// Tests replace it.
+var countProjectContainers = podmanProjectContainers
+
+// projectResources describes what is left in project, such as
+// "2 functions, 1 containers", or returns "" when it is empty.
+func projectResources(ctx context.Context, project string) (string, error) {
+	var left []string
+	add := func(count int, kind string) {
+		if count > 0 {
+			left = append(left, fmt.Sprintf("%d %s", count, kind))
+		}
+	}
+
+	for _, dir := range []struct {
+		subsystem utils.Subsystem
+		kind      string
+	}{{utils.Functions, "functions"}, {utils.BlobStorage, "buckets"}} {
+		path, err := utils.ProjectDir(project, dir.subsystem)
+		if err != nil {
+			return "", err
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		add(len(entries), dir.kind)
+	}
+	pipelines, err := service_ledger.GetAllPipelineEntries()
+	if err != nil {
+		return "", err
+	}
+	add(len(service_ledger.ProjectEntries(pipelines, project)), "pipelines")
+	count, err := countProjectContainers(ctx, project)
+	if err != nil {
+		return "", err
+	}
+	add(count, "containers")
+
+	return strings.Join(left, ", "), nil
+}
+
+// projectRequest is the JSON body accepted by CreateProject.
+type projectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// projectMemberRequest is the JSON body accepted by SetProjectMember and
+// RemoveProjectMember.
+type projectMemberRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// projectResponse is the public view of a project.  Role is the caller's
+// role in it.
+type projectResponse struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	CreatedAt   string            `json:"createdAt,omitempty"`
+	Members     map[string]string `json:"members"`
+	Role        string            `json:"role"`
+}
+
+func newProjectResponse(project service_ledger.ProjectEntry, role string) projectResponse {
+	members := project.Members
+	if members == nil {
+		members = map[string]string{}
+	}
+	return projectResponse{
+		Name:        project.Name,
+		Description: project.Description,
+		CreatedAt:   project.CreatedAt,
+		Members:     members,
+		Role:        role,
+	}
+}
+
+// callerRecord returns the account of the authenticated caller, answering
+// the request itself when it cannot be found.
+func callerRecord(w http.ResponseWriter, r *http.Request) (*userRecord, bool) {
+	username, _ := AuthenticatedUser(r.Context())
+	user, err := lookupUser(username)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return nil, false
+	}
+	if user == nil {
+		apierror.Respond(w, r, http.StatusUnauthorized, "account is disabled or no longer exists")
+		return nil, false
+	}
+	return user, true
+}
+
+// lookupProject loads the project named in the path after prefix, answering
+// the request itself when there is none or the caller has no access to it.
+// It returns the caller's role in the project as well.
+func lookupProject(w http.ResponseWriter, r *http.Request, prefix string) (*service_ledger.ProjectEntry, string, bool) {
+	user, ok := callerRecord(w, r)
+	if !ok {
+		return nil, "", false
+	}
+	name := strings.TrimPrefix(r.URL.Path, prefix)
+	if !utils.ValidProjectName(name) {
+		apierror.Respond(w, r, http.StatusNotFound, "project not found")
+		return nil, "", false
+	}
+	project, err := service_ledger.GetProjectEntry(name)
+	if err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to read projects"))
+		return nil, "", false
+	}
+	role := ""
+	if project != nil {
+		role = projectRole(user, project)
+	}
+	if role == "" {
+		apierror.Respond(w, r, http.StatusNotFound, "project not found")
+		return nil, "", false
+	}
+	return project, role, true
+}
+
+// ListProjects handles GET /list-projects.
+// Admins see every project; other users see the default project and those
+// they are members of.
+func ListProjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	user, ok := callerRecord(w, r)
+	if !ok {
+		return
+	}
+	projects, err := service_ledger.GetAllProjectEntries()
+	if err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to read projects"))
+		return
+	}
+	resp := []projectResponse{}
+	for _, project := range projects {
+		if role := projectRole(user, &project); role != "" {
+			resp = append(resp, newProjectResponse(project, role))
+		}
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].Name < resp[j].Name })
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreateProject handles POST /create-project.
+//
+// Request body: {"name": "team-a", "description": "Team A's services"}
+func CreateProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req projectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !utils.ValidProjectName(req.Name) {
+		apierror.Respond(w, r, http.StatusBadRequest, "name must be 1 to 40 lowercase letters, digits and hyphens, starting with a letter")
+		return
+	}
+
+	project := service_ledger.ProjectEntry{
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	err := service_ledger.CreateProjectEntry(project)
+	if errors.Is(err, service_ledger.ErrProjectExists) {
+		apierror.Respond(w, r, http.StatusConflict, "project already exists")
+		return
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to save project"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newProjectResponse(project, roleAdmin))
+}
+
+// GetProject handles GET /get-project/{name}.
+func GetProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	project, role, ok := lookupProject(w, r, "/get-project/")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newProjectResponse(*project, role))
+}
+
+// DeleteProject handles DELETE /delete-project/{name}.
+// Only a project without functions, pipelines, buckets or containers can be
+// deleted; the default project never can.
+func DeleteProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	project, _, ok := lookupProject(w, r, "/delete-project/")
+	if !ok {
+		return
+	}
+	if project.Name == utils.DefaultProject {
+		apierror.Respond(w, r, http.StatusBadRequest, "the default project cannot be deleted")
+		return
+	}
+	left, err := projectResources(r.Context(), project.Name)
+	if err != nil {
+		apierror.RespondError(w, r, err, "failed to check project resources")
+		return
+	}
+	if left != "" {
+		apierror.Respond(w, r, http.StatusConflict, fmt.Sprintf("project %q still holds %s", project.Name, left))
+		return
+	}
+	if err := service_ledger.DeleteProjectEntry(project.Name); err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to delete project"))
+		return
+	}
+
+	// Remove the empty directories and the logs the project leaves behind.
+	for _, s := range utils.Subsystems {
+		if dir, err := utils.ProjectDir(project.Name, s); err == nil {
+			if err := os.RemoveAll(dir); err != nil {
+				slog.WarnContext(r.Context(), "failed to remove project directory", "project", project.Name, "dir", dir, "err", err)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Project deleted successfully", "name": project.Name})
+}
+
+// SetProjectMember handles PUT /set-project-member/{name}.
+// It grants a user a role in the project, replacing any role they had.
+//
+// Request body: {"username": "alice", "role": "developer"}
+func SetProjectMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	project, _, ok := lookupProject(w, r, "/set-project-member/")
+	if !ok {
+		return
+	}
+	var req projectMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "username is required")
+		return
+	}
+	if !isProjectMemberRole(req.Role) {
+		apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("role must be one of %s", strings.Join(projectMemberRoles, ", ")))
+		return
+	}
+	if project.Name == utils.DefaultProject {
+		apierror.Respond(w, r, http.StatusBadRequest, "access to the default project follows the instance roles")
+		return
+	}
+	member, err := lookupUser(req.Username)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to read users")
+		return
+	}
+	if member == nil {
+		apierror.Respond(w, r, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if !writeProjectUpdateError(w, r, service_ledger.SetProjectMember(project.Name, req.Username, req.Role)) {
+		return
+	}
+	writeUpdatedProject(w, r, project.Name)
+}
+
+// RemoveProjectMember handles DELETE /remove-project-member/{name}.
+//
+// Request body: {"username": "alice"}
+func RemoveProjectMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	project, _, ok := lookupProject(w, r, "/remove-project-member/")
+	if !ok {
+		return
+	}
+	var req projectMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "username is required")
+		return
+	}
+	if _, ok := project.Members[req.Username]; !ok {
+		apierror.Respond(w, r, http.StatusNotFound, "user is not a member of the project")
+		return
+	}
+
+	if !writeProjectUpdateError(w, r, service_ledger.RemoveProjectMember(project.Name, req.Username)) {
+		return
+	}
+	writeUpdatedProject(w, r, project.Name)
+}
+
+// isProjectMemberRole reports whether role can be granted in a project.
+func isProjectMemberRole(role string) bool {
+	for _, r := range projectMemberRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// writeProjectUpdateError answers the request when err is not nil and
+// reports whether it was nil.
+func writeProjectUpdateError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service_ledger.ErrProjectNotFound):
+		apierror.Respond(w, r, http.StatusNotFound, "project not found")
+	default:
+		apierror.Write(w, r, apierror.Ledger(err, "failed to save project"))
+	}
+	return false
+}
+
+// writeUpdatedProject answers with the project as stored after a change.
+func writeUpdatedProject(w http.ResponseWriter, r *http.Request, name string) {
+	project, err := service_ledger.GetProjectEntry(name)
+	if err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to read projects"))
+		return
+	}
+	if project == nil {
+		apierror.Respond(w, r, http.StatusNotFound, "project not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newProjectResponse(*project, roleAdmin))
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// projectEcho writes back the project a request works in.
+func projectEcho(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(RequestProject(r.Context())))
+}
+
+// createProjectForTest creates a project through CreateProject and removes
+// it from the ledger when the test ends.
+func createProjectForTest(t *testing.T, adminToken, name string) {
+	t.Helper()
+	w := serveUserRequest(t, CreateProject, http.MethodPost, "/create-project", adminToken,
+		projectRequest{Name: name, Description: "Test team"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create project %s: expected %d, got %d — body: %s", name, http.StatusCreated, w.Code, w.Body.String())
+	}
+	t.Cleanup(func() { service_ledger.DeleteProjectEntry(name) })
+}
+
+func TestRequireAuthResolvesProject(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "dev", "developer-pass")
+	w := serveUserRequest(t, SetUserRole, http.MethodPost, "/user/set-role", admin.AccessToken,
+		map[string]string{"username": "dev", "role": roleDeveloper})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set role: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	dev := loginForTest(t, "dev", "developer-pass", "go-test")
+	createProjectForTest(t, admin.AccessToken, "test-team")
+
+	for _, tc := range []struct {
+		name, method, path, token string
+		status                    int
+		project                   string
+	}{
+		{"default project", http.MethodGet, "/get-containers", dev.AccessToken, http.StatusOK, utils.DefaultProject},
+		{"non-member", http.MethodGet, "/get-containers?project=test-team", dev.AccessToken, http.StatusForbidden, ""},
+		{"admin", http.MethodPost, "/delete-container?project=test-team", admin.AccessToken, http.StatusOK, "test-team"},
+		{"unknown project", http.MethodGet, "/get-containers?project=no-such-team", dev.AccessToken, http.StatusNotFound, ""},
+		{"invalid project", http.MethodGet, "/get-containers?project=Test_Team", dev.AccessToken, http.StatusBadRequest, ""},
+		{"not a project route", http.MethodGet, "/get-images?project=no-such-team", dev.AccessToken, http.StatusOK, utils.DefaultProject},
+	} {
+		w := serveAuthenticated(projectEcho, tc.method, tc.path, tc.token)
+		if w.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d — body: %s", tc.name, tc.status, w.Code, w.Body.String())
+			continue
+		}
+		if tc.project != "" && w.Body.String() != tc.project {
+			t.Errorf("%s: handler saw project %q, want %q", tc.name, w.Body.String(), tc.project)
+		}
+	}
+
+	// A member's role in the project replaces their instance role.
+	w = serveUserRequest(t, SetProjectMember, http.MethodPut, "/set-project-member/test-team", admin.AccessToken,
+		projectMemberRequest{Username: "dev", Role: roleViewer})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set project member: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := serveAuthenticated(projectEcho, http.MethodGet, "/get-containers?project=test-team", dev.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("viewer member read: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serveAuthenticated(projectEcho, http.MethodPost, "/delete-container?project=test-team", dev.AccessToken); w.Code != http.StatusForbidden {
+		t.Errorf("viewer member write: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = serveUserRequest(t, ListProjects, http.MethodGet, "/list-projects", dev.AccessToken, nil)
+	var projects []projectResponse
+	if err := json.NewDecoder(w.Body).Decode(&projects); err != nil {
+		t.Fatalf("failed to decode projects: %v", err)
+	}
+	if len(projects) != 2 || projects[0].Name != utils.DefaultProject || projects[0].Role != roleDeveloper ||
+		projects[1].Name != "test-team" || projects[1].Role != roleViewer {
+		t.Errorf("projects of dev = %+v", projects)
+	}
+
+	w = serveUserRequest(t, RemoveProjectMember, http.MethodDelete, "/remove-project-member/test-team", admin.AccessToken,
+		map[string]string{"username": "dev"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("remove project member: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := serveAuthenticated(projectEcho, http.MethodGet, "/get-containers?project=test-team", dev.AccessToken); w.Code != http.StatusForbidden {
+		t.Errorf("removed member read: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w := serveUserRequest(t, GetProject, http.MethodGet, "/get-project/test-team", dev.AccessToken, nil); w.Code != http.StatusNotFound {
+		t.Errorf("non-member get project: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestCreateProjectValidation(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createProjectForTest(t, admin.AccessToken, "test-team")
+
+	for _, tc := range []struct {
+		name   string
+		status int
+	}{
+		{"test-team", http.StatusConflict},
+		{utils.DefaultProject, http.StatusConflict},
+		{"Test Team", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	} {
+		w := serveUserRequest(t, CreateProject, http.MethodPost, "/create-project", admin.AccessToken, projectRequest{Name: tc.name})
+		if w.Code != tc.status {
+			t.Errorf("create project %q: expected %d, got %d — body: %s", tc.name, tc.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCreateProjectIdempotent(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+	resetIdempotencyStore(t)
+	t.Cleanup(func() { service_ledger.DeleteProjectEntry("test-team") })
+
+	body := `{"name":"test-team","description":"Test team"}`
+	first := serveIdempotent(http.HandlerFunc(CreateProject), "admin", "/create-project", "key-1", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("create project: expected %d, got %d — body: %s", http.StatusCreated, first.Code, first.Body.String())
+	}
+	retry := serveIdempotent(http.HandlerFunc(CreateProject), "admin", "/create-project", "key-1", body)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %q, want %d %q", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get(idempotentReplayHeader) != "true" {
+		t.Error("retry not marked as replayed")
+	}
+}
+
+func TestDeleteProject(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+	orig := countProjectContainers
+	countProjectContainers = func(context.Context, string) (int, error) { return 0, nil }
+	t.Cleanup(func() { countProjectContainers = orig })
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createProjectForTest(t, admin.AccessToken, "test-team")
+
+	fnDir, err := utils.ProjectDir("test-team", utils.Functions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(fnDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fnPath := filepath.Join(fnDir, "hello.py")
+	if err := os.WriteFile(fnPath, []byte("print('hello')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serveUserRequest(t, DeleteProject, http.MethodDelete, "/delete-project/test-team", admin.AccessToken, nil); w.Code != http.StatusConflict {
+		t.Errorf("delete project with a function: expected %d, got %d — body: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	if w := serveUserRequest(t, DeleteProject, http.MethodDelete, "/delete-project/default", admin.AccessToken, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("delete default project: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if err := os.Remove(fnPath); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveUserRequest(t, DeleteProject, http.MethodDelete, "/delete-project/test-team", admin.AccessToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete empty project: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if entry, err := service_ledger.GetProjectEntry("test-team"); err != nil || entry != nil {
+		t.Errorf("project entry after delete = %+v, %v", entry, err)
+	}
+	if _, err := os.Stat(fnDir); !os.IsNotExist(err) {
+		t.Errorf("project functions directory after delete: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"strings"
+)
+
+// Roles a user can hold.  The role is stored per user in the credentials file
+// as a "role=<name>" flag.
+const (
+	roleAdmin     = "admin"
+	roleDeveloper = "developer"
+	roleViewer    = "viewer"
+)
+
+// defaultRole is assumed for credentials lines written before roles existed,
+// so upgrading an installation never locks out its existing users.
+const defaultRole = roleAdmin
+
+// resourceGroup identifies a family of routes that share permissions.
+type resourceGroup string
+
+const (
+	groupCompute       resourceGroup = "compute"
+	groupStorage       resourceGroup = "storage"
+	groupCICD          resourceGroup = "cicd"
+	groupInstance      resourceGroup = "instance"
+	groupServiceLedger resourceGroup = "service_ledger"
+	groupMetrics       resourceGroup = "metrics"
+	groupUsers         resourceGroup = "users"
+	groupWebhooks      resourceGroup = "webhooks"
+	groupProjects      resourceGroup = "projects"
+	// groupAccount covers a user's own password and sessions; every role has it.
+	groupAccount resourceGroup = "account"
+)
+
+// accessLevel is the kind of access a route needs on its resource group.
+type accessLevel int
+
+const (
+	accessRead accessLevel = iota
+	accessWrite
+)
+
+func (a accessLevel) String() string {
+	if a == accessWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// routePermission is the permission required to call a route.
+type routePermission struct {
+	Group  resourceGroup
+	Access accessLevel
+}
+
+// routePermissions maps every registered route to the permission it needs.
+// Keys ending in "/" match any path with that prefix, mirroring ServeMux.
+// Routes missing from this table are admin-only so new endpoints fail closed.
+var routePermissions = map[string]routePermission{
+	// Own account
+	"/user/logout":          {groupAccount, accessWrite},
+	"/user/sessions":        {groupAccount, accessRead},
+	"/user/sessions/":       {groupAccount, accessWrite},
+	"/user/change-password": {groupAccount, accessWrite},
+	"/user/create-token":    {groupAccount, accessWrite},
+	"/user/tokens":          {groupAccount, accessRead},
+	"/user/tokens/":         {groupAccount, accessWrite},
+	"/user/totp/status":     {groupAccount, accessRead},
+	"/user/totp/enroll":     {groupAccount, accessWrite},
+	"/user/totp/confirm":    {groupAccount, accessWrite},
+	"/user/totp/disable":    {groupAccount, accessWrite},
+
+	// User management
+	"/user/list-users":   {groupUsers, accessRead},
+	"/user/create-user":  {groupUsers, accessWrite},
+	"/user/disable-user": {groupUsers, accessWrite},
+	"/user/delete-user":  {groupUsers, accessWrite},
+	"/user/set-role":     {groupUsers, accessWrite},
+	"/user/unlock-user":  {groupUsers, accessWrite},
+	"/user/link-oidc":    {groupUsers, accessWrite},
+
+	// Token signing keys
+	"/user/signing-keys":       {groupUsers, accessRead},
+	"/user/rotate-signing-key": {groupUsers, accessWrite},
+
+	"/get-server-metrics": {groupMetrics, accessRead},
+	"/metrics":            {groupMetrics, accessRead},
+	"/events":             {groupMetrics, accessRead},
+
+	// The audit log names every user and resource, so it is admin-only.
+	"/get-audit-log": {groupUsers, accessRead},
+
+	// A backup holds every credential and signing key, so it is admin-only.
+	"/backup": {groupUsers, accessRead},
+
+	// Compute: containers and functions
+	"/get-containers":      {groupCompute, accessRead},
+	"/get-container":       {groupCompute, accessRead},
+	"/container-logs":      {groupCompute, accessRead},
+	"/containers/":         {groupCompute, accessWrite},
+	"/delete-container":    {groupCompute, accessWrite},
+	"/pull-and-run":        {groupCompute, accessWrite},
+	"/pull-and-run-stream": {groupCompute, accessWrite},
+	"/update-container":    {groupCompute, accessWrite},
+	"/list-functions":      {groupCompute, accessRead},
+	"/get-function/":       {groupCompute, accessRead},
+	"/get-function-logs/":  {groupCompute, accessRead},
+	"/invoke-function":     {groupCompute, accessWrite},
+	"/create-function":     {groupCompute, accessWrite},
+	"/delete-function":     {groupCompute, accessWrite},
+	"/update-function/":    {groupCompute, accessWrite},
+
+	// Storage: blob buckets and the container registry
+	"/list-blob-buckets":            {groupStorage, accessRead},
+	"/get-blobs":                    {groupStorage, accessRead},
+	"/download-object":              {groupStorage, accessRead},
+	"/list-container-mount-buckets": {groupStorage, accessRead},
+	"/create-bucket":                {groupStorage, accessWrite},
+	"/upload-object":                {groupStorage, accessWrite},
+	"/delete-object":                {groupStorage, accessWrite},
+	"/delete-bucket":                {groupStorage, accessWrite},
+	"/rename-bucket":                {groupStorage, accessWrite},
+	"/get-images":                   {groupStorage, accessRead},
+	"/get-image":                    {groupStorage, accessRead},
+	"/get-image-logs":               {groupStorage, accessRead},
+	"/build-image":                  {groupStorage, accessWrite},
+	"/build-image-stream":           {groupStorage, accessWrite},
+	"/delete-image":                 {groupStorage, accessWrite},
+	"/pull-image":                   {groupStorage, accessWrite},
+	"/pull-image-stream":            {groupStorage, accessWrite},
+
+	// CI/CD pipelines
+	"/get-pipelines":      {groupCICD, accessRead},
+	"/get-pipeline/":      {groupCICD, accessRead},
+	"/get-pipeline-logs/": {groupCICD, accessRead},
+	"/create-pipeline":    {groupCICD, accessWrite},
+	"/update-pipeline/":   {groupCICD, accessWrite},
+	"/delete-pipeline/":   {groupCICD, accessWrite},
+	"/run-pipeline/":      {groupCICD, accessWrite},
+	"/stop-pipeline/":     {groupCICD, accessWrite},
+
+	// Service ledger
+	"/get-service-status":    {groupServiceLedger, accessRead},
+	"/enable-service":        {groupServiceLedger, accessWrite},
+	"/enable-service-stream": {groupServiceLedger, accessWrite},
+	"/sync-pipelines":        {groupServiceLedger, accessWrite},
+	"/sync-functions":        {groupServiceLedger, accessWrite},
+
+	// Instance settings
+	"/get-instance-domain": {groupInstance, accessRead},
+	"/get-ssl-status":      {groupInstance, accessRead},
+	"/set-instance-domain": {groupInstance, accessWrite},
+	"/configure-ssl":       {groupInstance, accessWrite},
+
+	// Webhooks
+	"/list-webhooks":           {groupWebhooks, accessRead},
+	"/get-webhook/":            {groupWebhooks, accessRead},
+	"/get-webhook-deliveries/": {groupWebhooks, accessRead},
+	"/create-webhook":          {groupWebhooks, accessWrite},
+	"/update-webhook/":         {groupWebhooks, accessWrite},
+	"/delete-webhook/":         {groupWebhooks, accessWrite},
+
+	// Projects; which projects a user may list or read is decided by the
+	// handlers, from the user's memberships.
+	"/list-projects":          {groupProjects, accessRead},
+	"/get-project/":           {groupProjects, accessRead},
+	"/create-project":         {groupProjects, accessWrite},
+	"/delete-project/":        {groupProjects, accessWrite},
+	"/set-project-member/":    {groupProjects, accessWrite},
+	"/remove-project-member/": {groupProjects, accessWrite},
+}
+
+// rolePermissions is the permission table: for each role, the highest access
+// level it holds on each resource group.  A group that is absent grants nothing.
+var rolePermissions = map[string]map[resourceGroup]accessLevel{
+	roleAdmin: {
+		groupCompute:       accessWrite,
+		groupStorage:       accessWrite,
+		groupCICD:          accessWrite,
+		groupInstance:      accessWrite,
+		groupServiceLedger: accessWrite,
+		groupMetrics:       accessWrite,
+		groupUsers:         accessWrite,
+		groupWebhooks:      accessWrite,
+		groupProjects:      accessWrite,
+		groupAccount:       accessWrite,
+	},
+	roleDeveloper: {
+		groupCompute:       accessWrite,
+		groupStorage:       accessWrite,
+		groupCICD:          accessWrite,
+		groupInstance:      accessRead,
+		groupServiceLedger: accessWrite,
+		groupMetrics:       accessRead,
+		groupWebhooks:      accessRead,
+		groupProjects:      accessRead,
+		groupAccount:       accessWrite,
+	},
+	roleViewer: {
+		groupCompute:       accessRead,
+		groupStorage:       accessRead,
+		groupCICD:          accessRead,
+		groupInstance:      accessRead,
+		groupServiceLedger: accessRead,
+		groupMetrics:       accessRead,
+		groupProjects:      accessRead,
+		groupAccount:       accessWrite,
+	},
+}
+
+// isValidRole reports whether role is one of the known roles.
+func isValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// hasPermission reports whether role grants at least access on group.
+func hasPermission(role string, group resourceGroup, access accessLevel) bool {
+	granted, ok := rolePermissions[role][group]
+	return ok && granted >= access
+}
+
+// lookupRoutePermission returns the permission required for path.  An exact
+// match wins; otherwise the longest matching "/"-terminated prefix is used.
+func lookupRoutePermission(path string) (routePermission, bool) {
+	if perm, ok := routePermissions[path]; ok {
+		return perm, true
+	}
+
+	var best string
+	for pattern := range routePermissions {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return routePermission{}, false
+	}
+	return routePermissions[best], true
+}
+
+// authorizeRoute reports whether role may call path.  Unknown routes are
+// reserved for admins.
+func authorizeRoute(role, path string) bool {
+	perm, ok := lookupRoutePermission(path)
+	if !ok {
+		return role == roleAdmin
+	}
+	return hasPermission(role, perm.Group, perm.Access)
+}
+
+// authRoleKey is the context key under which RequireAuth stores the caller's role.
+const authRoleKey authContextKey = "authRole"
+
+// AuthenticatedRole returns the role of the user stored in ctx by RequireAuth.
+func AuthenticatedRole(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(authRoleKey).(string)
+	return role, ok && role != ""
+}
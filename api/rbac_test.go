@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+)
+
+// TestPermissionMatrix verifies the access each role has on each resource group.
+func TestPermissionMatrix(t *testing.T) {
+	const (
+		none  = "-"
+		read  = "r"
+		write = "rw"
+	)
+	matrix := map[string]map[resourceGroup]string{
+		roleAdmin: {
+			groupCompute: write, groupStorage: write, groupCICD: write, groupInstance: write,
+			groupServiceLedger: write, groupMetrics: write, groupUsers: write, groupAccount: write,
+			groupWebhooks: write, groupProjects: write,
+		},
+		roleDeveloper: {
+			groupCompute: write, groupStorage: write, groupCICD: write, groupInstance: read,
+			groupServiceLedger: write, groupMetrics: read, groupUsers: none, groupAccount: write,
+			groupWebhooks: read, groupProjects: read,
+		},
+		roleViewer: {
+			groupCompute: read, groupStorage: read, groupCICD: read, groupInstance: read,
+			groupServiceLedger: read, groupMetrics: read, groupUsers: none, groupAccount: write,
+			groupWebhooks: none, groupProjects: read,
+		},
+	}
+
+	for role, groups := range matrix {
+		for group, want := range groups {
+			gotRead := hasPermission(role, group, accessRead)
+			gotWrite := hasPermission(role, group, accessWrite)
+			if gotRead != (want != none) || gotWrite != (want == write) {
+				t.Errorf("%s on %s: read=%v write=%v, want %q", role, group, gotRead, gotWrite, want)
+			}
+		}
+	}
+
+	if hasPermission("unknown", groupCompute, accessRead) {
+		t.Errorf("unknown role must not have any permission")
+	}
+}
+
+// TestAuthorizeRoute verifies route lookup, including prefix routes and the
+// admin-only fallback for unknown routes.
+func TestAuthorizeRoute(t *testing.T) {
+	tests := []struct {
+		role string
+		path string
+		want bool
+	}{
+		{roleViewer, "/get-containers", true},
+		{roleViewer, "/delete-container", false},
+		{roleViewer, "/get-pipeline/build", true},
+		{roleViewer, "/run-pipeline/build", false},
+		{roleViewer, "/enable-service", false},
+		{roleViewer, "/user/change-password", true},
+		{roleDeveloper, "/run-pipeline/build", true},
+		{roleDeveloper, "/upload-object", true},
+		{roleDeveloper, "/configure-ssl", false},
+		{roleDeveloper, "/get-ssl-status", true},
+		{roleDeveloper, "/user/list-users", false},
+		{roleAdmin, "/configure-ssl", true},
+		{roleAdmin, "/user/create-user", true},
+		{roleAdmin, "/not-a-route", true},
+		{roleDeveloper, "/not-a-route", false},
+	}
+
+	for _, tt := range tests {
+		if got := authorizeRoute(tt.role, tt.path); got != tt.want {
+			t.Errorf("authorizeRoute(%q, %q) = %v, want %v", tt.role, tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestEveryRouteHasPermission verifies that each route registered in main.go
+// has an entry in routePermissions, so none silently falls back to admin-only.
+func TestEveryRouteHasPermission(t *testing.T) {
+	src, err := os.ReadFile("../main.go")
+	if err != nil {
+		t.Skipf("main.go not available: %v", err)
+	}
+
+	routes := regexp.MustCompile(`HandleFunc\("([^"]+)"`).FindAllStringSubmatch(string(src), -1)
+	if len(routes) == 0 {
+		t.Fatalf("no routes found in main.go")
+	}
+	for _, m := range routes {
+		path := m[1]
+		if publicRoutes[path] {
+			continue
+		}
+		if _, ok := lookupRoutePermission(path); !ok {
+			t.Errorf("route %s has no entry in routePermissions", path)
+		}
+	}
+}
+
+// TestRequireAuthEnforcesRole verifies that the middleware returns 403 when
+// the caller's role lacks the permission a route needs.
+func TestRequireAuthEnforcesRole(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	w := serveUserRequest(t, CreateUser, http.MethodPost, "/user/create-user", admin.AccessToken,
+		createUserRequest{Username: "val", Password: "viewer-pass"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create viewer: expected %d, got %d — body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	viewer := loginForTest(t, "val", "viewer-pass", "go-test")
+
+	if w := serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", viewer.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("viewer read: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serveAuthenticated(protectedEcho, http.MethodPost, "/delete-container", viewer.AccessToken); w.Code != http.StatusForbidden {
+		t.Errorf("viewer write: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w := serveAuthenticated(protectedEcho, http.MethodGet, "/user/list-users", viewer.AccessToken); w.Code != http.StatusForbidden {
+		t.Errorf("viewer user management: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = serveUserRequest(t, ChangePassword, http.MethodPost, "/user/change-password", viewer.AccessToken,
+		changePasswordRequest{Username: "admin", NewPassword: "taken-over!"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("viewer resetting admin password: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+// TestSetUserRole verifies role changes take effect on the next request and
+// that the last admin cannot be demoted.
+func TestSetUserRole(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "dev", "developer-pass")
+	dev := loginForTest(t, "dev", "developer-pass", "go-test")
+
+	if w := serveAuthenticated(protectedEcho, http.MethodPost, "/run-pipeline/build", dev.AccessToken); w.Code != http.StatusForbidden {
+		t.Fatalf("expected viewer to get %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w := serveUserRequest(t, SetUserRole, http.MethodPost, "/user/set-role", admin.AccessToken,
+		map[string]string{"username": "dev", "role": roleDeveloper})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set role: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if w := serveAuthenticated(protectedEcho, http.MethodPost, "/run-pipeline/build", dev.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("expected developer to get %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = serveUserRequest(t, SetUserRole, http.MethodPost, "/user/set-role", admin.AccessToken,
+		map[string]string{"username": "dev", "role": "superuser"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid role: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = serveUserRequest(t, SetUserRole, http.MethodPost, "/user/set-role", admin.AccessToken,
+		map[string]string{"username": "admin", "role": roleViewer})
+	if w.Code != http.StatusConflict {
+		t.Errorf("demoting last admin: expected %d, got %d", http.StatusConflict, w.Code)
+	}
+}
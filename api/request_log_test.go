@@ -0,0 +1,43 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/logging"
+)
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.NewLogger(&buf, "info", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	handler := apierror.WithRequestID(LogRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+	})))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/functions", nil))
+	if buf.Len() != 0 {
+		t.Errorf("successful GET logged at info level: %s", buf.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/functions", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	out := buf.String()
+	for _, want := range []string{"method=POST", "path=/v1/functions", "status=201", "request_id=req-42"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log line %q lacks %s", out, want)
+		}
+	}
+}
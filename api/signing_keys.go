@@ -0,0 +1,347 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// signingKey is one HMAC key used to sign auth tokens.  Exactly one key is
+// active at a time; keys replaced by a rotation keep verifying tokens until
+// ExpiresAt and are then removed from the keyring.
+type signingKey struct {
+	ID        string    `json:"id"`
+	Secret    string    `json:"secret"` // used as the HMAC key as is
+	CreatedAt time.Time `json:"createdAt"`
+	RetiredAt time.Time `json:"retiredAt,omitempty"` // when it stopped signing
+	ExpiresAt time.Time `json:"expiresAt,omitempty"` // when it stops verifying
+}
+
+// signingKeyring is the on-disk layout of ~/.opencloud/user/signing_keys.json.
+type signingKeyring struct {
+	ActiveKeyID string       `json:"activeKeyId"`
+	Keys        []signingKey `json:"keys"`
+}
+
+// legacyKeyID is the ID given to the secret imported from the pre-rotation
+// ~/.opencloud/user/secret file.  Tokens without a kid were signed with it.
+const legacyKeyID = "legacy"
+
+// DefaultSigningKeyGrace is how long a rotated-out key keeps verifying
+// tokens when no grace period is given.  It matches the refresh token
+// lifetime so a routine rotation logs nobody out.
+var DefaultSigningKeyGrace = refreshSessionTTL
+
+// The keyring is cached in memory and re-read whenever the file changes, so
+// a rotation done from the command line reaches a running server.
+var (
+	keyringMutex   sync.Mutex
+	cachedKeyring  *signingKeyring
+	cachedKeyPath  string
+	cachedKeyMTime time.Time
+)
+
+// signingKeysPath returns the path to the signing keyring.
+func signingKeysPath() (string, error) {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "user", "signing_keys.json"), nil
+}
+
+// newSigningKey generates a fresh 64-byte key.
+func newSigningKey(now time.Time) (signingKey, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 64)
+	if _, err := rand.Read(id); err != nil {
+		return signingKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return signingKey{}, err
+	}
+	return signingKey{ID: hex.EncodeToString(id), Secret: hex.EncodeToString(secret), CreatedAt: now}, nil
+}
+
+// writeKeyring atomically replaces the keyring file and refreshes the cache.
+// Callers must hold keyringMutex.
+func writeKeyring(path string, ring *signingKeyring) error {
+	data, err := json.MarshalIndent(ring, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		cachedKeyring, cachedKeyPath, cachedKeyMTime = ring, path, info.ModTime()
+	}
+	return nil
+}
+
+// initKeyring creates the keyring on first use.  An existing legacy secret
+// is imported as the active key so tokens issued before the upgrade keep
+// working.  Callers must hold keyringMutex.
+func initKeyring(path string, now time.Time) (*signingKeyring, error) {
+	key, err := newSigningKey(now)
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := os.ReadFile(filepath.Join(filepath.Dir(path), "secret"))
+	if err == nil && len(legacy) >= 64 {
+		key = signingKey{ID: legacyKeyID, Secret: string(legacy), CreatedAt: now}
+	}
+
+	ring := &signingKeyring{ActiveKeyID: key.ID, Keys: []signingKey{key}}
+	if err := writeKeyring(path, ring); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// retireExpiredKeys drops rotated-out keys whose grace period has ended and
+// reports whether anything was removed.
+func retireExpiredKeys(ring *signingKeyring, now time.Time) bool {
+	kept := ring.Keys[:0]
+	for _, k := range ring.Keys {
+		if k.ID == ring.ActiveKeyID || k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt) {
+			kept = append(kept, k)
+		}
+	}
+	removed := len(kept) != len(ring.Keys)
+	ring.Keys = kept
+	return removed
+}
+
+// loadKeyring returns the current keyring, creating it on first use and
+// retiring expired keys.  Callers must hold keyringMutex.
+func loadKeyring(now time.Time) (string, *signingKeyring, error) {
+	path, err := signingKeysPath()
+	if err != nil {
+		return "", nil, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		ring, err := initKeyring(path, now)
+		return path, ring, err
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	ring := cachedKeyring
+	if ring == nil || cachedKeyPath != path || !info.ModTime().Equal(cachedKeyMTime) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", nil, err
+		}
+		ring = &signingKeyring{}
+		if err := json.Unmarshal(data, ring); err != nil {
+			return "", nil, fmt.Errorf("malformed signing keyring: %w", err)
+		}
+		if ring.activeKey() == nil {
+			return "", nil, fmt.Errorf("signing keyring has no active key %q", ring.ActiveKeyID)
+		}
+		cachedKeyring, cachedKeyPath, cachedKeyMTime = ring, path, info.ModTime()
+	}
+
+	if retireExpiredKeys(ring, now) {
+		if err := writeKeyring(path, ring); err != nil {
+			slog.Warn("failed to retire expired signing keys", "err", err)
+		}
+	}
+	return path, ring, nil
+}
+
+// activeKey returns the key new tokens are signed with.
+func (ring *signingKeyring) activeKey() *signingKey {
+	return ring.key(ring.ActiveKeyID)
+}
+
+// key returns the key with the given ID, or nil.
+func (ring *signingKeyring) key(id string) *signingKey {
+	for i := range ring.Keys {
+		if ring.Keys[i].ID == id {
+			return &ring.Keys[i]
+		}
+	}
+	return nil
+}
+
+// activeSigningKey returns the ID and secret to sign new tokens with.
+func activeSigningKey() (string, []byte, error) {
+	keyringMutex.Lock()
+	defer keyringMutex.Unlock()
+
+	_, ring, err := loadKeyring(time.Now())
+	if err != nil {
+		return "", nil, err
+	}
+	k := ring.activeKey()
+	return k.ID, []byte(k.Secret), nil
+}
+
+// verificationKey returns the secret for kid if the key may still verify
+// tokens.  Tokens issued before key IDs existed carry no kid and map to the
+// imported legacy key.
+func verificationKey(kid string) ([]byte, error) {
+	keyringMutex.Lock()
+	defer keyringMutex.Unlock()
+
+	_, ring, err := loadKeyring(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if kid == "" {
+		kid = legacyKeyID
+	}
+	k := ring.key(kid)
+	if k == nil {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+	return []byte(k.Secret), nil
+}
+
+// signingKeyInfo describes a key without its secret.
+type signingKeyInfo struct {
+	ID        string     `json:"id"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// describeKeys lists the keys in ring, newest first.
+func describeKeys(ring *signingKeyring) []signingKeyInfo {
+	out := make([]signingKeyInfo, 0, len(ring.Keys))
+	for i := len(ring.Keys) - 1; i >= 0; i-- {
+		k := ring.Keys[i]
+		info := signingKeyInfo{ID: k.ID, Active: k.ID == ring.ActiveKeyID, CreatedAt: k.CreatedAt}
+		if !k.RetiredAt.IsZero() {
+			info.RetiredAt = &k.RetiredAt
+		}
+		if !k.ExpiresAt.IsZero() {
+			info.ExpiresAt = &k.ExpiresAt
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+// RotateSigningKey makes a new key active.  The previous key keeps verifying
+// tokens for grace; a grace of zero invalidates every outstanding token at
+// once, which is the right response to a leaked key.  It returns the new
+// key ID and is also used by the rotate-signing-key command.
+func RotateSigningKey(grace time.Duration) (string, error) {
+	if grace < 0 {
+		return "", fmt.Errorf("grace period must not be negative")
+	}
+
+	keyringMutex.Lock()
+	defer keyringMutex.Unlock()
+
+	now := time.Now()
+	path, ring, err := loadKeyring(now)
+	if err != nil {
+		return "", err
+	}
+	key, err := newSigningKey(now)
+	if err != nil {
+		return "", err
+	}
+
+	// Work on a copy so a failed write leaves the cached keyring intact.
+	next := &signingKeyring{ActiveKeyID: key.ID, Keys: append([]signingKey(nil), ring.Keys...)}
+	for i := range next.Keys {
+		k := &next.Keys[i]
+		if k.ID == ring.ActiveKeyID {
+			k.RetiredAt = now
+		}
+		// A shorter grace also cuts short keys that were already retiring.
+		if k.ExpiresAt.IsZero() || now.Add(grace).Before(k.ExpiresAt) {
+			k.ExpiresAt = now.Add(grace)
+		}
+	}
+	next.Keys = append(next.Keys, key)
+	retireExpiredKeys(next, now.Add(time.Nanosecond))
+
+	if err := writeKeyring(path, next); err != nil {
+		return "", err
+	}
+	return key.ID, nil
+}
+
+// rotateSigningKeyRequest is the body accepted by RotateSigningKeyHandler.
+type rotateSigningKeyRequest struct {
+	// GracePeriod is a Go duration such as "24h" or "0s".  It defaults to
+	// DefaultSigningKeyGrace.
+	GracePeriod string `json:"gracePeriod"`
+}
+
+// ListSigningKeys handles GET /user/signing-keys.
+func ListSigningKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	keyringMutex.Lock()
+	_, ring, err := loadKeyring(time.Now())
+	var keys []signingKeyInfo
+	if err == nil {
+		keys = describeKeys(ring)
+	}
+	keyringMutex.Unlock()
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to read signing keys")
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// RotateSigningKeyHandler handles POST /user/rotate-signing-key.
+func RotateSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req rotateSigningKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	grace := DefaultSigningKeyGrace
+	if req.GracePeriod != "" {
+		d, err := time.ParseDuration(req.GracePeriod)
+		if err != nil || d < 0 {
+			apierror.Respond(w, r, http.StatusBadRequest, "gracePeriod must be a non-negative duration such as \"24h\"")
+			return
+		}
+		grace = d
+	}
+
+	id, err := RotateSigningKey(grace)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "signing key rotation failed", "err", err)
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to rotate signing key")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"activeKeyId": id, "gracePeriod": grace.String()})
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readKeyringForTest returns the keyring as stored on disk.
+func readKeyringForTest(t *testing.T) *signingKeyring {
+	t.Helper()
+	path, _ := signingKeysPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read keyring: %v", err)
+	}
+	var ring signingKeyring
+	if err := json.Unmarshal(data, &ring); err != nil {
+		t.Fatalf("decode keyring: %v", err)
+	}
+	return &ring
+}
+
+// tokenKeyID returns the kid claim of a token without verifying it.
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	payload, err := base64.RawURLEncoding.DecodeString(strings.SplitN(token, ".", 2)[0])
+	if err != nil {
+		t.Fatalf("decode token: %v", err)
+	}
+	var claims tokenClaims
+	json.Unmarshal(payload, &claims)
+	return claims.KeyID
+}
+
+// TestRotateSigningKeyGrace verifies tokens signed with the previous key
+// keep working during the grace period and new tokens use the new key.
+func TestRotateSigningKeyGrace(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	before := loginForTest(t, "admin", "admin", "go-test")
+	oldKID := tokenKeyID(t, before.AccessToken)
+	if oldKID == "" {
+		t.Fatal("expected tokens to carry a key ID")
+	}
+
+	newKID, err := RotateSigningKey(time.Hour)
+	if err != nil {
+		t.Fatalf("RotateSigningKey: %v", err)
+	}
+	if newKID == oldKID {
+		t.Fatal("expected a new key ID")
+	}
+
+	if _, err := parseToken(before.AccessToken, false); err != nil {
+		t.Errorf("old token during grace period: %v", err)
+	}
+	after := loginForTest(t, "admin", "admin", "go-test")
+	if kid := tokenKeyID(t, after.AccessToken); kid != newKID {
+		t.Errorf("new token signed with %q, want %q", kid, newKID)
+	}
+
+	ring := readKeyringForTest(t)
+	if ring.ActiveKeyID != newKID || len(ring.Keys) != 2 {
+		t.Fatalf("unexpected keyring %+v", ring)
+	}
+	if old := ring.key(oldKID); old.RetiredAt.IsZero() || old.ExpiresAt.IsZero() {
+		t.Errorf("expected retired key to have retiredAt and expiresAt, got %+v", old)
+	}
+}
+
+// TestRotateSigningKeyImmediate verifies a zero grace period invalidates
+// every outstanding token.
+func TestRotateSigningKeyImmediate(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	before := loginForTest(t, "admin", "admin", "go-test")
+	RotateSigningKey(time.Hour)
+	if _, err := RotateSigningKey(0); err != nil {
+		t.Fatalf("RotateSigningKey: %v", err)
+	}
+
+	if _, err := parseToken(before.AccessToken, true); err == nil {
+		t.Error("expected token signed with a removed key to be rejected")
+	}
+	if ring := readKeyringForTest(t); len(ring.Keys) != 1 {
+		t.Errorf("expected only the active key to remain, got %d keys", len(ring.Keys))
+	}
+}
+
+// TestSigningKeysRetireAutomatically verifies keys past their grace period
+// are dropped the next time the keyring is loaded.
+func TestSigningKeysRetireAutomatically(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	before := loginForTest(t, "admin", "admin", "go-test")
+	if _, err := RotateSigningKey(time.Minute); err != nil {
+		t.Fatalf("RotateSigningKey: %v", err)
+	}
+
+	keyringMutex.Lock()
+	_, ring, err := loadKeyring(time.Now().Add(2 * time.Minute))
+	keyringMutex.Unlock()
+	if err != nil {
+		t.Fatalf("loadKeyring: %v", err)
+	}
+	if len(ring.Keys) != 1 || len(readKeyringForTest(t).Keys) != 1 {
+		t.Errorf("expected the expired key to be removed from memory and disk")
+	}
+	if _, err := parseToken(before.AccessToken, true); err == nil {
+		t.Error("expected token signed with a retired key to be rejected")
+	}
+}
+
+// TestLegacySecretImported verifies tokens signed with the old single
+// secret, which carry no kid, still verify after the upgrade.
+func TestLegacySecretImported(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	home, _ := os.UserHomeDir()
+	legacy := []byte(strings.Repeat("ab", 64))
+	if err := os.WriteFile(filepath.Join(home, ".opencloud", "user", "secret"), legacy, 0600); err != nil {
+		t.Fatalf("write legacy secret: %v", err)
+	}
+
+	payload, _ := json.Marshal(tokenClaims{Subject: "admin", ExpiresAt: time.Now().Add(time.Hour).Unix(), TokenType: "access"})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, legacy)
+	mac.Write([]byte(encoded))
+	oldToken := encoded + "." + hex.EncodeToString(mac.Sum(nil))
+
+	claims, err := parseToken(oldToken, false)
+	if err != nil {
+		t.Fatalf("legacy token rejected: %v", err)
+	}
+	if claims.Subject != "admin" {
+		t.Errorf("unexpected subject %q", claims.Subject)
+	}
+	if ring := readKeyringForTest(t); ring.ActiveKeyID != legacyKeyID {
+		t.Errorf("expected legacy key to be active, got %q", ring.ActiveKeyID)
+	}
+}
+
+// TestKeyringReloadedAfterExternalRotation verifies a running server picks
+// up a rotation written by another process.
+func TestKeyringReloadedAfterExternalRotation(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	before := loginForTest(t, "admin", "admin", "go-test")
+
+	// Replace the keyring behind the cache's back, as the command would.
+	path, _ := signingKeysPath()
+	key, _ := newSigningKey(time.Now())
+	data, _ := json.Marshal(signingKeyring{ActiveKeyID: key.ID, Keys: []signingKey{key}})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write keyring: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+
+	if _, err := parseToken(before.AccessToken, false); err == nil {
+		t.Error("expected token signed with the replaced key to be rejected")
+	}
+	after := loginForTest(t, "admin", "admin", "go-test")
+	if kid := tokenKeyID(t, after.AccessToken); kid != key.ID {
+		t.Errorf("new token signed with %q, want %q", kid, key.ID)
+	}
+}
+
+// TestRotateSigningKeyHandler verifies the endpoint's validation and response.
+func TestRotateSigningKeyHandler(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+
+	w := serveUserRequest(t, RotateSigningKeyHandler, http.MethodPost, "/user/rotate-signing-key", admin.AccessToken,
+		map[string]string{"gracePeriod": "-1h"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("negative grace: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = serveUserRequest(t, RotateSigningKeyHandler, http.MethodPost, "/user/rotate-signing-key", admin.AccessToken,
+		map[string]string{"gracePeriod": "30m"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = serveUserRequest(t, ListSigningKeys, http.MethodGet, "/user/signing-keys", admin.AccessToken, nil)
+	var keys []signingKeyInfo
+	json.NewDecoder(w.Body).Decode(&keys)
+	if len(keys) != 2 || !keys[0].Active || keys[1].ExpiresAt == nil {
+		t.Errorf("unexpected key list %+v", keys)
+	}
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Error("key list must not include secrets")
+	}
+}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/backup"
+	service_ledger "github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/containers/podman/v5/pkg/bindings/volumes"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+// backupWriteTimeout is how long GetBackup waits for the write requests in
+// flight to finish before answering 503.
+const backupWriteTimeout = 30 * time.Second
+
+// PodmanBackup implements backup.Podman with the rootless Podman service.
+type PodmanBackup struct{}
+
+// ListImages returns the tags of every tagged image.  Dangling images are
+// left out, since an image archive cannot name them.
+func (PodmanBackup) ListImages(ctx context.Context) ([]string, error) {
+	conn, err := blobStoragePodmanConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to Podman: %w", err)
+	}
+	imageList, err := images.List(conn, nil)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, img := range imageList {
+		for _, tag := range img.RepoTags {
+			if tag != "" && tag != "<none>:<none>" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags), nil
+}
+
+// ExportImages writes the images as one docker-archive, which keeps their
+// tags when loaded.
+func (PodmanBackup) ExportImages(ctx context.Context, tags []string, w io.Writer) error {
+	conn, err := blobStoragePodmanConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to Podman: %w", err)
+	}
+	return images.Export(conn, tags, w, new(images.ExportOptions).WithFormat("docker-archive"))
+}
+
+// LoadImages loads an archive written by ExportImages.
+func (PodmanBackup) LoadImages(ctx context.Context, r io.Reader) error {
+	conn, err := blobStoragePodmanConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to Podman: %w", err)
+	}
+	_, err = images.Load(conn, r)
+	return err
+}
+
+// ListVolumes returns every volume except those of container-mount buckets,
+// which only point at a blob storage directory.
+func (PodmanBackup) ListVolumes(ctx context.Context) ([]string, error) {
+	conn, err := blobStoragePodmanConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to Podman: %w", err)
+	}
+	volumeList, err := volumes.List(conn, nil)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := service_ledger.GetAllBucketEntries()
+	if err != nil {
+		return nil, err
+	}
+	bucketVolumes := make(map[string]bool)
+	for _, entry := range buckets {
+		if entry.VolumeName != "" {
+			bucketVolumes[entry.VolumeName] = true
+		}
+	}
+	var names []string
+	for _, v := range volumeList {
+		if !bucketVolumes[v.Name] {
+			names = append(names, v.Name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// ExportVolume writes the contents of a volume as a tar archive.
+func (PodmanBackup) ExportVolume(ctx context.Context, name string, w io.Writer) error {
+	conn, err := blobStoragePodmanConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to Podman: %w", err)
+	}
+	return volumes.Export(conn, name, w)
+}
+
+// ImportVolume creates the volume with the local driver unless it exists
+// and unpacks r into it.
+func (PodmanBackup) ImportVolume(ctx context.Context, name string, r io.Reader) error {
+	conn, err := blobStoragePodmanConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to Podman: %w", err)
+	}
+	exists, err := volumes.Exists(conn, name, nil)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := createPodmanVolume(conn, entitiesTypes.VolumeCreateOptions{Name: name}, nil); err != nil {
+			return err
+		}
+	}
+	return volumes.Import(conn, name, r)
+}
+
+// GetBackup streams a backup archive of the instance.  The query parameters
+// images=true and volumes=true add the Podman images and volumes.  Write
+// requests are held off while the instance files are copied to a snapshot,
+// so the archive is consistent, but not while the Podman state is exported
+// or the archive is sent; GetBackup answers 503 when the writes in flight do
+// not finish in time.
+func GetBackup(w http.ResponseWriter, r *http.Request) {
+	opts := backup.Options{Podman: PodmanBackup{}}
+	for name, value := range map[string]*bool{"images": &opts.Images, "volumes": &opts.Volumes} {
+		if v := r.URL.Query().Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("%s must be true or false", name))
+				return
+			}
+			*value = b
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), backupWriteTimeout)
+	release, err := opencloudapi.HoldWrites(ctx)
+	cancel()
+	if err != nil {
+		w.Header().Set("Retry-After", "30")
+		apierror.Respond(w, r, http.StatusServiceUnavailable, "Timed out waiting for write requests to finish; try again later")
+		return
+	}
+	user, _ := opencloudapi.AuthenticatedUser(r.Context())
+	slog.InfoContext(r.Context(), "backup started", "user", user, "images", opts.Images, "volumes", opts.Volumes)
+
+	started := time.Now().UTC()
+	snapshot, err := backup.TakeSnapshot(r.Context())
+	release()
+	if err != nil {
+		apierror.RespondError(w, r, err, "Failed to back up the instance")
+		return
+	}
+	defer snapshot.Close()
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename=opencloud-backup-"+started.Format("20060102T150405Z")+".tar.gz")
+	cw := &countingWriter{w: w}
+	manifest, err := backup.WriteSnapshot(r.Context(), cw, snapshot, opts)
+	if err != nil {
+		if cw.n == 0 {
+			w.Header().Del("Content-Disposition")
+			apierror.RespondError(w, r, err, "Failed to back up the instance")
+			return
+		}
+		// The status is sent; cutting the archive short makes it fail
+		// verification.
+		slog.ErrorContext(r.Context(), "backup failed", "user", user, "bytes", cw.n, "err", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "backup finished", "user", user, "files", len(manifest.Files),
+		"images", len(manifest.Images), "volumes", len(manifest.Volumes), "bytes", cw.n, "duration", time.Since(started))
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// RestoreContainerMountVolumes creates the Podman volume of every
+// container-mount bucket in the ledger that has none, binding it to the
+// bucket's directory, and records its name in the ledger.  A volume that
+// exists but binds another directory, as after restoring into a different
+// blob storage directory, is reported rather than replaced, since
+// containers may still use it.
+func RestoreContainerMountVolumes(ctx context.Context) error {
+	buckets, err := service_ledger.GetAllBucketEntries()
+	if err != nil {
+		return err
+	}
+	conn, err := blobStoragePodmanConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to Podman: %w", err)
+	}
+
+	names := make([]string, 0, len(buckets))
+	for name := range buckets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var errs []error
+	for _, key := range names {
+		entry := buckets[key]
+		if !entry.ContainerMount {
+			continue
+		}
+		project, name := service_ledger.SplitProjectKey(key)
+		volumeName := entry.VolumeName
+		if volumeName == "" {
+			volumeName = podmanVolumeNameForBucket(project, name)
+		}
+		blobDir, err := utils.ProjectDir(project, utils.BlobStorage)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bucket %s: %w", key, err))
+			continue
+		}
+		bucketPath := filepath.Join(blobDir, name)
+
+		if existing, err := inspectPodmanVolume(conn, volumeName, nil); err == nil {
+			if device := existing.Options["device"]; device != bucketPath {
+				errs = append(errs, fmt.Errorf("volume %s of bucket %s binds %s rather than %s; remove it and run the restore again", volumeName, key, device, bucketPath))
+				continue
+			}
+		} else if err := createContainerMountVolume(volumeName, bucketPath); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create volume %s of bucket %s: %w", volumeName, key, err))
+			continue
+		}
+		if entry.VolumeName != volumeName {
+			if err := service_ledger.UpdateBucketEntry(key, entry.CreatedAt, true, volumeName); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/backup"
+	service_ledger "github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/containers/podman/v5/libpod/define"
+	"github.com/containers/podman/v5/pkg/bindings/volumes"
+	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
+)
+
+func TestGetBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	credentials := filepath.Join(tmpDir, ".opencloud", "user", "credentials")
+	if err := os.MkdirAll(filepath.Dir(credentials), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(credentials, []byte("admin:hash\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	GetBackup(w, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/gzip" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "opencloud-backup-") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	manifest, err := backup.Verify(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	found := false
+	for _, f := range manifest.Files {
+		found = found || f.Path == "data/user/credentials"
+	}
+	if !found {
+		t.Errorf("credentials missing from %+v", manifest.Files)
+	}
+
+	w = httptest.NewRecorder()
+	GetBackup(w, httptest.NewRequest(http.MethodGet, "/backup?images=maybe", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("images=maybe status = %d, want 400", w.Code)
+	}
+}
+
+// stalledWriter is a ResponseWriter whose client stops reading: Write
+// blocks until unblock is closed.  started is closed by the first Write.
+type stalledWriter struct {
+	header  http.Header
+	started chan struct{}
+	unblock chan struct{}
+	once    bool
+}
+
+func (s *stalledWriter) Header() http.Header { return s.header }
+func (s *stalledWriter) WriteHeader(int)     {}
+
+func (s *stalledWriter) Write(p []byte) (int, error) {
+	if !s.once {
+		s.once = true
+		close(s.started)
+	}
+	<-s.unblock
+	return len(p), nil
+}
+
+func TestGetBackupReleasesWritesWhileStreaming(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	credentials := filepath.Join(tmpDir, ".opencloud", "user", "credentials")
+	if err := os.MkdirAll(filepath.Dir(credentials), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(credentials, []byte("admin:hash\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sw := &stalledWriter{header: http.Header{}, started: make(chan struct{}), unblock: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		GetBackup(sw, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	}()
+	defer func() {
+		close(sw.unblock)
+		<-done
+	}()
+
+	select {
+	case <-sw.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("backup did not start streaming")
+	}
+
+	posted := make(chan int, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		handler := opencloudapi.GateWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/create-bucket", nil))
+		posted <- w.Code
+	}()
+	select {
+	case code := <-posted:
+		if code != http.StatusCreated {
+			t.Errorf("POST status = %d, want %d", code, http.StatusCreated)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("POST blocked while a backup download was stalled")
+	}
+}
+
+func TestRestoreContainerMountVolumes(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	blobStoragePath := filepath.Join(tmpDir, ".opencloud", "blob_storage")
+
+	saved, err := service_ledger.SnapshotServiceLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service_ledger.ReplaceServiceLedger(saved) })
+	service_ledger.ReplaceServiceLedger(service_ledger.ServiceLedger{
+		"blob_storage": {Enabled: true, Buckets: map[string]service_ledger.BucketEntry{
+			"plain":     {Name: "plain", CreatedAt: "2024-01-01T00:00:00Z"},
+			"missing":   {Name: "missing", CreatedAt: "2024-01-01T00:00:00Z", ContainerMount: true, VolumeName: "opencloud-missing"},
+			"unnamed":   {Name: "unnamed", CreatedAt: "2024-01-01T00:00:00Z", ContainerMount: true},
+			"present":   {Name: "present", CreatedAt: "2024-01-01T00:00:00Z", ContainerMount: true, VolumeName: "opencloud-present"},
+			"elsewhere": {Name: "elsewhere", CreatedAt: "2024-01-01T00:00:00Z", ContainerMount: true, VolumeName: "opencloud-elsewhere"},
+		}},
+	})
+
+	origCreate, origInspect, origConn := createPodmanVolume, inspectPodmanVolume, blobStoragePodmanConnection
+	t.Cleanup(func() {
+		createPodmanVolume, inspectPodmanVolume, blobStoragePodmanConnection = origCreate, origInspect, origConn
+	})
+	blobStoragePodmanConnection = func(ctx context.Context) (context.Context, error) { return ctx, nil }
+	existing := map[string]string{
+		"opencloud-present":   filepath.Join(blobStoragePath, "present"),
+		"opencloud-elsewhere": "/old/blob_storage/elsewhere",
+	}
+	inspectPodmanVolume = func(ctx context.Context, name string, _ *volumes.InspectOptions) (*entitiesTypes.VolumeConfigResponse, error) {
+		device, ok := existing[name]
+		if !ok {
+			return nil, errors.New("no such volume")
+		}
+		return &entitiesTypes.VolumeConfigResponse{InspectVolumeData: define.InspectVolumeData{Name: name, Options: map[string]string{"device": device}}}, nil
+	}
+	created := map[string]string{}
+	createPodmanVolume = func(ctx context.Context, opts entitiesTypes.VolumeCreateOptions, _ *volumes.CreateOptions) (*entitiesTypes.VolumeConfigResponse, error) {
+		created[opts.Name] = opts.Options["device"]
+		return nil, nil
+	}
+
+	err = RestoreContainerMountVolumes(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "opencloud-elsewhere") {
+		t.Errorf("err = %v, want the volume binding another directory reported", err)
+	}
+	want := map[string]string{
+		"opencloud-missing": filepath.Join(blobStoragePath, "missing"),
+		"opencloud-unnamed": filepath.Join(blobStoragePath, "unnamed"),
+	}
+	if len(created) != len(want) {
+		t.Errorf("created %v, want %v", created, want)
+	}
+	for name, device := range want {
+		if created[name] != device {
+			t.Errorf("volume %s binds %q, want %q", name, created[name], device)
+		}
+	}
+	if entry, _ := service_ledger.GetBucketEntry("unnamed"); entry == nil || entry.VolumeName != "opencloud-unnamed" {
+		t.Errorf("unnamed bucket entry = %+v", entry)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
 	"os"
@@ -15,26 +15,74 @@ import (
 	"time"
 
 	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/api/listing"
 	service_ledger "github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
 	"github.com/containers/podman/v5/pkg/bindings/volumes"
 	entitiesTypes "github.com/containers/podman/v5/pkg/domain/entities/types"
 )
 
 // podmanVolumePrefix is the prefix applied to Podman named volumes created for
-// blob storage container mounts (e.g. "opencloud-my-bucket").
+// blob storage container mounts (e.g. "opencloud-my-bucket", or
+// "opencloud-team-a_my-bucket" in project team-a).
 const podmanVolumePrefix = "opencloud-"
 
-// Mockable Podman volume operations used by CreateBucket and DeleteBucket.
-// These vars are replaced in tests to avoid requiring a live Podman daemon.
+// Mockable Podman volume operations used by CreateBucket, DeleteBucket and
+// RestoreContainerMountVolumes.  These vars are replaced in tests to avoid
+// requiring a live Podman daemon.
 var (
 	blobStoragePodmanConnection = opencloudapi.RootlessPodmanConnection
 	createPodmanVolume          = volumes.Create
 	removePodmanVolume          = volumes.Remove
+	inspectPodmanVolume         = volumes.Inspect
 )
 
-// podmanVolumeNameForBucket returns the Podman named volume name for a bucket.
-func podmanVolumeNameForBucket(bucketName string) string {
-	return podmanVolumePrefix + bucketName
+// podmanVolumeNameForBucket returns the Podman named volume name for a bucket
+// of project.  Podman volumes are not grouped by project, so the name of a
+// project other than the default one is part of it, separated by an
+// underscore, which neither project nor bucket names may contain.
+func podmanVolumeNameForBucket(project, bucketName string) string {
+	if project == "" || project == utils.DefaultProject {
+		return podmanVolumePrefix + bucketName
+	}
+	return podmanVolumePrefix + project + "_" + bucketName
+}
+
+// blobStorageDir returns the blob storage directory of project, holding one
+// directory per bucket.
+func blobStorageDir(project string) (string, *apierror.Error) {
+	dir, err := utils.ProjectDir(project, utils.BlobStorage)
+	if err != nil {
+		return "", apierror.Filesystem(err, "Failed to resolve blob storage directory")
+	}
+	return dir, nil
+}
+
+// readBuckets returns the bucket directories in root, the blob storage
+// directory of a project; a project without buckets may have none.
+func readBuckets(root string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	buckets := entries[:0]
+	for _, entry := range entries {
+		if entry.IsDir() && !utils.IsProjectsDir(entry.Name()) {
+			buckets = append(buckets, entry)
+		}
+	}
+	return buckets, nil
+}
+
+// validObjectName reports whether name can be the name of an object, which
+// has to stay inside its bucket directory.
+func validObjectName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
 }
 
 // Blob represents a single object stored in blob storage.
@@ -84,83 +132,151 @@ func createContainerMountVolume(volumeName, bucketPath string) error {
 	return err
 }
 
+// podmanVolumeExists reports whether a Podman volume named name exists.  It
+// reports false when Podman cannot be reached; creating the volume then
+// fails and is logged.
+func podmanVolumeExists(ctx context.Context, name string) bool {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	conn, err := blobStoragePodmanConnection(ctx)
+	if err != nil {
+		return false
+	}
+	_, err = inspectPodmanVolume(conn, name, nil)
+	return err == nil
+}
+
 // removeContainerMountVolume removes a Podman named volume created for a container mount bucket.
 // Errors are logged but do not cause a hard failure so bucket deletion can proceed regardless.
 // A 15-second timeout is applied so the bucket DELETE request never hangs if Podman is slow.
-func removeContainerMountVolume(volumeName string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func removeContainerMountVolume(ctx context.Context, volumeName string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
 	defer cancel()
 
 	conn, err := blobStoragePodmanConnection(ctx)
 	if err != nil {
-		log.Printf("Warning: failed to connect to Podman to remove volume %q: %v", volumeName, err)
+		slog.WarnContext(ctx, "failed to connect to Podman to remove volume", "volume", volumeName, "err", err)
 		return
 	}
 	// Force=true ensures the volume is removed even if a container is still referencing it.
 	opts := new(volumes.RemoveOptions).WithForce(true)
 	if err := removePodmanVolume(conn, volumeName, opts); err != nil {
-		log.Printf("Warning: failed to remove Podman volume %q: %v", volumeName, err)
+		slog.WarnContext(ctx, "failed to remove Podman volume", "volume", volumeName, "err", err)
 	}
 }
 
-// ListBlobBuckets returns a list of blob storage buckets with metadata.
-func ListBlobBuckets(w http.ResponseWriter, r *http.Request) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
-		return
-	}
+// bucketListing describes the list parameters of ListBlobBuckets.
+var bucketListing = listing.Spec[Bucket]{
+	Key: func(b Bucket) string { return b.Name },
+	Sorts: map[string]listing.Field[Bucket]{
+		"name":     {String: func(b Bucket) string { return b.Name }},
+		"size":     {Int: func(b Bucket) int64 { return b.TotalSize }},
+		"objects":  {Int: func(b Bucket) int64 { return int64(b.ObjectCount) }},
+		"modified": {String: func(b Bucket) string { return b.LastModified }},
+	},
+	DefaultSort: "name",
+	Filters: map[string]listing.Filter[Bucket]{
+		"prefix": listing.Prefix(func(b Bucket) string { return b.Name }),
+	},
+}
 
-	root := filepath.Join(home, ".opencloud", "blob_storage")
-	entries, err := os.ReadDir(root)
+// blobListing describes the list parameters of GetBlobBuckets.
+var blobListing = listing.Spec[Blob]{
+	Key: func(b Blob) string { return b.Bucket + "/" + b.Name },
+	Sorts: map[string]listing.Field[Blob]{
+		"name":     {String: func(b Blob) string { return b.Name }},
+		"size":     {Int: func(b Blob) int64 { return b.Size }},
+		"modified": {String: func(b Blob) string { return b.LastModified }},
+	},
+	DefaultSort: "name",
+	Filters: map[string]listing.Filter[Blob]{
+		"prefix": listing.Prefix(func(b Blob) string { return b.Name }),
+	},
+}
+
+// fillBucketStats sets the object count, total size and last modification
+// time of b from the objects in its directory.  It returns false if the
+// bucket directory is gone.
+func fillBucketStats(b *Bucket, bucketPath string) bool {
+	bucketInfo, err := os.Stat(bucketPath)
 	if err != nil {
-		http.Error(w, "Failed to read blob storage directory", http.StatusInternalServerError)
-		return
+		return false
 	}
+	lastModified := bucketInfo.ModTime()
 
-	var buckets []Bucket
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	files, _ := os.ReadDir(bucketPath)
+	for _, file := range files {
+		if file.IsDir() {
 			continue
 		}
-
-		bucketPath := filepath.Join(root, entry.Name())
-		bucketInfo, err := os.Stat(bucketPath)
+		info, err := file.Info()
 		if err != nil {
 			continue
 		}
+		b.ObjectCount++
+		b.TotalSize += info.Size()
+		if info.ModTime().After(lastModified) {
+			lastModified = info.ModTime()
+		}
+	}
+	b.LastModified = lastModified.UTC().Format(time.RFC3339)
+	return true
+}
 
-		// Count objects and calculate total size
-		files, _ := os.ReadDir(bucketPath)
-		objectCount := 0
-		var totalSize int64
-		var lastModified time.Time = bucketInfo.ModTime()
+// ListBlobBuckets returns a list of the blob storage buckets of the request's
+// project with metadata.  It takes the list parameters of bucketListing;
+// sorted by name, only the buckets returned are walked for their statistics.
+func ListBlobBuckets(w http.ResponseWriter, r *http.Request) {
+	q, apiErr := bucketListing.Parse(r.URL.Query())
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	}
 
-		for _, file := range files {
-			if file.IsDir() {
-				continue
-			}
-			objectCount++
-			info, _ := os.Stat(filepath.Join(bucketPath, file.Name()))
-			totalSize += info.Size()
-			if info.ModTime().After(lastModified) {
-				lastModified = info.ModTime()
+	project := opencloudapi.RequestProject(r.Context())
+	root, apiErr := blobStorageDir(project)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	}
+
+	entries, err := readBuckets(root)
+	if err != nil {
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to read blob storage directory"))
+		return
+	}
+
+	var buckets []Bucket
+	for _, entry := range entries {
+		buckets = append(buckets, Bucket{Name: entry.Name()})
+	}
+
+	// Count objects and calculate total size, before paging when the order
+	// depends on them.
+	fillStats := func(buckets []Bucket) []Bucket {
+		filled := buckets[:0]
+		for _, b := range buckets {
+			if fillBucketStats(&b, filepath.Join(root, b.Name)) {
+				filled = append(filled, b)
 			}
 		}
-
-		buckets = append(buckets, Bucket{
-			Name:         entry.Name(),
-			ObjectCount:  objectCount,
-			TotalSize:    totalSize,
-			LastModified: lastModified.UTC().Format(time.RFC3339),
-		})
+		return filled
+	}
+	if q.Sort != "name" {
+		buckets = fillStats(buckets)
+	}
+	buckets, next := bucketListing.Apply(q, buckets)
+	if q.Sort == "name" {
+		buckets = fillStats(buckets)
 	}
 
 	// Enrich buckets with container mount status and volume name from the service ledger
 	allEntries, ledgerErr := service_ledger.GetAllBucketEntries()
 	if ledgerErr != nil {
-		log.Printf("Warning: failed to read bucket entries from service ledger: %v", ledgerErr)
+		slog.WarnContext(r.Context(), "failed to read bucket entries from service ledger", "err", ledgerErr)
 	}
+	allEntries = service_ledger.ProjectEntries(allEntries, project)
 	for i := range buckets {
 		if entry, ok := allEntries[buckets[i].Name]; ok {
 			buckets[i].ContainerMount = entry.ContainerMount
@@ -168,96 +284,71 @@ func ListBlobBuckets(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	listing.SetNextCursor(w, next)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(buckets)
 }
 
-// ListContainerMountBuckets returns blob storage buckets that are marked as container volume mounts.
+// ListContainerMountBuckets returns the blob storage buckets of the request's
+// project that are marked as container volume mounts.
 func ListContainerMountBuckets(w http.ResponseWriter, r *http.Request) {
 	allEntries, err := service_ledger.GetAllBucketEntries()
 	if err != nil {
-		http.Error(w, "Failed to read bucket entries", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Ledger(err, "Failed to read bucket entries"))
 		return
 	}
 
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+	project := opencloudapi.RequestProject(r.Context())
+	root, apiErr := blobStorageDir(project)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
 
-	root := filepath.Join(home, ".opencloud", "blob_storage")
-
 	var buckets []Bucket
-	for name, entry := range allEntries {
+	for name, entry := range service_ledger.ProjectEntries(allEntries, project) {
 		if !entry.ContainerMount {
 			continue
 		}
 
-		bucketPath := filepath.Join(root, name)
-		bucketInfo, err := os.Stat(bucketPath)
-		if err != nil {
+		bucket := Bucket{Name: name, ContainerMount: true, VolumeName: entry.VolumeName}
+		if !fillBucketStats(&bucket, filepath.Join(root, name)) {
 			continue // bucket directory doesn't exist on disk, skip
 		}
-
-		files, _ := os.ReadDir(bucketPath)
-		objectCount := 0
-		var totalSize int64
-		var lastModified time.Time = bucketInfo.ModTime()
-
-		for _, file := range files {
-			if file.IsDir() {
-				continue
-			}
-			objectCount++
-			info, err := os.Stat(filepath.Join(bucketPath, file.Name()))
-			if err != nil {
-				continue
-			}
-			totalSize += info.Size()
-			if info.ModTime().After(lastModified) {
-				lastModified = info.ModTime()
-			}
-		}
-
-		buckets = append(buckets, Bucket{
-			Name:           name,
-			ObjectCount:    objectCount,
-			TotalSize:      totalSize,
-			LastModified:   lastModified.UTC().Format(time.RFC3339),
-			ContainerMount: true,
-			VolumeName:     entry.VolumeName,
-		})
+		buckets = append(buckets, bucket)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(buckets)
 }
 
-// GetBlobBuckets returns blobs from all buckets or a specific bucket if specified.
+// GetBlobBuckets returns blobs from all buckets of the request's project or
+// a specific bucket if specified.  It takes the list parameters of blobListing; sorted by name,
+// only the objects returned are read for their size and modification time.
 func GetBlobBuckets(w http.ResponseWriter, r *http.Request) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+	q, apiErr := blobListing.Parse(r.URL.Query())
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	}
+
+	root, apiErr := blobStorageDir(opencloudapi.RequestProject(r.Context()))
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
 
 	// Check if a specific bucket is requested via query parameter
 	bucketFilter := r.URL.Query().Get("bucket")
 
-	root := filepath.Join(home, ".opencloud", "blob_storage")
-	entries, err := os.ReadDir(root)
+	entries, err := readBuckets(root)
 	if err != nil {
-		http.Error(w, "Failed to read blob storage directory", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to read blob storage directory"))
 		return
 	}
 
 	var blobs []Blob
 	for _, bucket := range entries {
-		if !bucket.IsDir() {
-			continue
-		}
-
 		// Skip if a specific bucket is requested and this isn't it
 		if bucketFilter != "" && bucket.Name() != bucketFilter {
 			continue
@@ -270,19 +361,39 @@ func GetBlobBuckets(w http.ResponseWriter, r *http.Request) {
 			if file.IsDir() {
 				continue
 			}
-			info, _ := os.Stat(filepath.Join(bucketPath, file.Name()))
-
 			blobs = append(blobs, Blob{
-				ID:           fmt.Sprintf("%s-%s", bucket.Name(), file.Name()), // simple unique ID
-				Name:         file.Name(),
-				Size:         info.Size(),
-				ContentType:  mime.TypeByExtension(filepath.Ext(file.Name())),
-				LastModified: info.ModTime().UTC().Format(time.RFC3339),
-				Bucket:       bucket.Name(),
+				ID:          fmt.Sprintf("%s-%s", bucket.Name(), file.Name()), // simple unique ID
+				Name:        file.Name(),
+				ContentType: mime.TypeByExtension(filepath.Ext(file.Name())),
+				Bucket:      bucket.Name(),
 			})
 		}
 	}
 
+	// Read sizes and modification times, before paging when the order
+	// depends on them.
+	fillInfo := func(blobs []Blob) []Blob {
+		filled := blobs[:0]
+		for _, b := range blobs {
+			info, err := os.Stat(filepath.Join(root, b.Bucket, b.Name))
+			if err != nil {
+				continue // deleted since the directory was read
+			}
+			b.Size = info.Size()
+			b.LastModified = info.ModTime().UTC().Format(time.RFC3339)
+			filled = append(filled, b)
+		}
+		return filled
+	}
+	if q.Sort != "name" {
+		blobs = fillInfo(blobs)
+	}
+	blobs, next := blobListing.Apply(q, blobs)
+	if q.Sort == "name" {
+		blobs = fillInfo(blobs)
+	}
+
+	listing.SetNextCursor(w, next)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(blobs)
 }
@@ -294,33 +405,47 @@ func CreateBucket(w http.ResponseWriter, r *http.Request) {
 		ContainerMount bool   `json:"containerMount"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	// Validate bucket name: required, no spaces, and max 50 characters
+	// Validate bucket name: required, no spaces or underscores, and max 50 characters
 	if body.Name == "" {
-		http.Error(w, "Bucket name is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name is required")
 		return
 	}
 	if strings.ContainsAny(body.Name, " \t\n\r") {
-		http.Error(w, "Bucket name cannot contain spaces", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name cannot contain spaces")
 		return
 	}
 	if len(body.Name) > 50 {
-		http.Error(w, "Bucket name must be 50 characters or fewer", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name must be 50 characters or fewer")
+		return
+	}
+	if !utils.ValidResourceName(body.Name) {
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name cannot start with a dot or contain slashes")
+		return
+	}
+	if strings.Contains(body.Name, "_") {
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name cannot contain underscores")
 		return
 	}
 
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+	project := opencloudapi.RequestProject(r.Context())
+	blobDir, apiErr := blobStorageDir(project)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
 
-	bucketPath := filepath.Join(home, ".opencloud", "blob_storage", body.Name)
+	// The blob storage directory of a project is created with its first bucket
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to create blob storage directory"))
+		return
+	}
+	bucketPath := filepath.Join(blobDir, body.Name)
 	if err := os.Mkdir(bucketPath, 0755); err != nil {
-		http.Error(w, "Failed to create bucket", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to create bucket"))
 		return
 	}
 
@@ -328,16 +453,23 @@ func CreateBucket(w http.ResponseWriter, r *http.Request) {
 	// volume backed by the blob storage directory so containers can mount it by name.
 	volumeName := ""
 	if body.ContainerMount {
-		volumeName = podmanVolumeNameForBucket(body.Name)
+		volumeName = podmanVolumeNameForBucket(project, body.Name)
+		// A volume left behind by a deleted or renamed bucket would be
+		// reused by containers expecting the old contents.
+		if podmanVolumeExists(r.Context(), volumeName) {
+			os.Remove(bucketPath)
+			apierror.Respond(w, r, http.StatusConflict, fmt.Sprintf("A Podman volume named %s already exists", volumeName))
+			return
+		}
 		if volErr := createContainerMountVolume(volumeName, bucketPath); volErr != nil {
 			// Volume creation failure is non-fatal: log the error but continue.
-			log.Printf("Warning: failed to create Podman volume %q for bucket %s: %v", volumeName, body.Name, volErr)
+			slog.WarnContext(r.Context(), "failed to create Podman volume", "volume", volumeName, "bucket", body.Name, "err", volErr)
 			volumeName = ""
 		}
 	}
 
-	if ledgerErr := service_ledger.UpdateBucketEntry(body.Name, time.Now().UTC().Format(time.RFC3339), body.ContainerMount, volumeName); ledgerErr != nil {
-		log.Printf("Warning: failed to record bucket %s in service ledger: %v", body.Name, ledgerErr)
+	if ledgerErr := service_ledger.UpdateBucketEntry(service_ledger.ProjectKey(project, body.Name), time.Now().UTC().Format(time.RFC3339), body.ContainerMount, volumeName); ledgerErr != nil {
+		slog.WarnContext(r.Context(), "failed to record bucket in service ledger", "bucket", body.Name, "err", ledgerErr)
 	}
 
 	resp := map[string]string{"status": "ok", "bucket": body.Name}
@@ -351,7 +483,7 @@ func CreateBucket(w http.ResponseWriter, r *http.Request) {
 // RenameBucket renames an existing blob storage bucket
 func RenameBucket(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -360,59 +492,71 @@ func RenameBucket(w http.ResponseWriter, r *http.Request) {
 		NewName     string `json:"newName"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	// Validate current name is provided
 	if body.CurrentName == "" {
-		http.Error(w, "Current bucket name is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Current bucket name is required")
 		return
 	}
 
-	// Validate new name: required, no spaces, and max 50 characters
+	// Validate new name: required, no spaces or underscores, and max 50 characters
 	if body.NewName == "" {
-		http.Error(w, "New bucket name is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "New bucket name is required")
 		return
 	}
 	if strings.ContainsAny(body.NewName, " \t\n\r") {
-		http.Error(w, "Bucket name cannot contain spaces", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name cannot contain spaces")
 		return
 	}
 	if len(body.NewName) > 50 {
-		http.Error(w, "Bucket name must be 50 characters or fewer", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name must be 50 characters or fewer")
+		return
+	}
+	if !utils.ValidResourceName(body.NewName) {
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name cannot start with a dot or contain slashes")
+		return
+	}
+	if strings.Contains(body.NewName, "_") {
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name cannot contain underscores")
+		return
+	}
+	if !utils.ValidResourceName(body.CurrentName) {
+		apierror.Respond(w, r, http.StatusNotFound, "Bucket not found")
 		return
 	}
 
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+	project := opencloudapi.RequestProject(r.Context())
+	basePath, apiErr := blobStorageDir(project)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
 
-	basePath := filepath.Join(home, ".opencloud", "blob_storage")
 	currentPath := filepath.Join(basePath, body.CurrentName)
 	newPath := filepath.Join(basePath, body.NewName)
 
 	// Ensure the current bucket exists
 	if _, err := os.Stat(currentPath); os.IsNotExist(err) {
-		http.Error(w, "Bucket not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Bucket not found")
 		return
 	}
 
 	// Ensure the new name is not already taken
 	if _, err := os.Stat(newPath); err == nil {
-		http.Error(w, "A bucket with that name already exists", http.StatusConflict)
+		apierror.Respond(w, r, http.StatusConflict, "A bucket with that name already exists")
 		return
 	}
 
 	if err := os.Rename(currentPath, newPath); err != nil {
-		http.Error(w, "Failed to rename bucket", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to rename bucket"))
 		return
 	}
 
-	if ledgerErr := service_ledger.RenameBucketEntry(body.CurrentName, body.NewName); ledgerErr != nil {
-		log.Printf("Warning: failed to rename bucket %s to %s in service ledger: %v", body.CurrentName, body.NewName, ledgerErr)
+	if ledgerErr := service_ledger.RenameBucketEntry(service_ledger.ProjectKey(project, body.CurrentName), service_ledger.ProjectKey(project, body.NewName)); ledgerErr != nil {
+		slog.WarnContext(r.Context(), "failed to rename bucket in service ledger", "bucket", body.CurrentName, "new_name", body.NewName, "err", ledgerErr)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -422,16 +566,21 @@ func RenameBucket(w http.ResponseWriter, r *http.Request) {
 // UploadObject uploads a file to a blob storage bucket.
 // It uses streaming multipart parsing so that files of any size can be uploaded
 // without buffering the entire request body in memory or temporary files.
-// The "bucket" field must appear before the "file" field in the multipart form.
+// The bucket is taken from the "bucket" query parameter or from a "bucket"
+// field, which must appear before the "file" field in the multipart form.
 func UploadObject(w http.ResponseWriter, r *http.Request) {
 	mr, err := r.MultipartReader()
 	if err != nil {
-		http.Error(w, "Error parsing multipart form", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Error parsing multipart form")
 		return
 	}
 
-	var bucket string
+	project := opencloudapi.RequestProject(r.Context())
+	bucket := r.URL.Query().Get("bucket")
 	var filename string
+	// created collects the uploaded objects; events are published once the
+	// whole request has been read.
+	var created []map[string]any
 
 	for {
 		part, err := mr.NextPart()
@@ -439,7 +588,7 @@ func UploadObject(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 		if err != nil {
-			http.Error(w, "Error reading multipart data", http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, "Error reading multipart data")
 			return
 		}
 
@@ -447,48 +596,60 @@ func UploadObject(w http.ResponseWriter, r *http.Request) {
 			// Read the plain-text bucket field value.
 			var buf bytes.Buffer
 			if _, err := io.Copy(&buf, part); err != nil {
-				http.Error(w, "Error reading bucket field", http.StatusBadRequest)
+				apierror.Respond(w, r, http.StatusBadRequest, "Error reading bucket field")
 				return
 			}
 			bucket = buf.String()
 		} else if part.FileName() != "" {
 			// Stream the file part directly to disk without buffering.
 			if bucket == "" {
-				http.Error(w, "Bucket field must appear before file in form", http.StatusBadRequest)
+				apierror.Respond(w, r, http.StatusBadRequest, "Bucket field must appear before file in form")
+				return
+			}
+			if !utils.ValidResourceName(bucket) {
+				apierror.Respond(w, r, http.StatusBadRequest, "Invalid bucket name")
 				return
 			}
 			filename = part.FileName()
+			if !validObjectName(filename) {
+				apierror.Respond(w, r, http.StatusBadRequest, "Invalid file name")
+				return
+			}
 
-			home, err := os.UserHomeDir()
+			blobDir, err := utils.ProjectDir(project, utils.BlobStorage)
 			if err != nil {
-				http.Error(w, "Error determining home directory", http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.Filesystem(err, "Error determining blob storage directory"))
 				return
 			}
-			bucketPath := filepath.Join(home, ".opencloud", "blob_storage", bucket)
+			bucketPath := filepath.Join(blobDir, bucket)
 			if err := os.MkdirAll(bucketPath, 0755); err != nil {
-				http.Error(w, "Error creating bucket directory", http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.Filesystem(err, "Error creating bucket directory"))
 				return
 			}
 
 			dst, err := os.Create(filepath.Join(bucketPath, filename))
 			if err != nil {
-				http.Error(w, "Error creating file", http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.Filesystem(err, "Error creating file"))
 				return
 			}
 			defer dst.Close()
 
-			if _, err := io.Copy(dst, part); err != nil {
-				fmt.Println(err)
-				http.Error(w, "Error writing file", http.StatusInternalServerError)
+			size, err := io.Copy(dst, part)
+			if err != nil {
+				apierror.Write(w, r, apierror.Filesystem(err, "Error writing file"))
 				return
 			}
+			created = append(created, map[string]any{"bucket": bucket, "name": filename, "project": project, "size": size})
 		}
 	}
 
 	if bucket == "" || filename == "" {
-		http.Error(w, "Missing bucket or file", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing bucket or file")
 		return
 	}
+	for _, object := range created {
+		events.Publish(events.BucketObjectCreated, object)
+	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -501,7 +662,7 @@ func UploadObject(w http.ResponseWriter, r *http.Request) {
 // DeleteBucket deletes a blob storage bucket and all of its contents.
 func DeleteBucket(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -509,40 +670,46 @@ func DeleteBucket(w http.ResponseWriter, r *http.Request) {
 		Name string `json:"name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	if body.Name == "" {
-		http.Error(w, "Bucket name is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Bucket name is required")
+		return
+	}
+	if !utils.ValidResourceName(body.Name) {
+		apierror.Respond(w, r, http.StatusNotFound, "Bucket not found")
 		return
 	}
 
-	home, err := os.UserHomeDir()
-	if err != nil {
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+	project := opencloudapi.RequestProject(r.Context())
+	blobDir, apiErr := blobStorageDir(project)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
 		return
 	}
 
-	bucketPath := filepath.Join(home, ".opencloud", "blob_storage", body.Name)
+	bucketPath := filepath.Join(blobDir, body.Name)
+	key := service_ledger.ProjectKey(project, body.Name)
 
 	if _, err := os.Stat(bucketPath); os.IsNotExist(err) {
-		http.Error(w, "Bucket not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "Bucket not found")
 		return
 	}
 
 	if err := os.RemoveAll(bucketPath); err != nil {
-		http.Error(w, "Failed to delete bucket", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Failed to delete bucket"))
 		return
 	}
 
 	// Remove the associated Podman named volume if this was a container mount bucket.
-	if entry, entryErr := service_ledger.GetBucketEntry(body.Name); entryErr == nil && entry != nil && entry.VolumeName != "" {
-		removeContainerMountVolume(entry.VolumeName)
+	if entry, entryErr := service_ledger.GetBucketEntry(key); entryErr == nil && entry != nil && entry.VolumeName != "" {
+		removeContainerMountVolume(r.Context(), entry.VolumeName)
 	}
 
-	if ledgerErr := service_ledger.DeleteBucketEntry(body.Name); ledgerErr != nil {
-		log.Printf("Warning: failed to remove bucket %s from service ledger: %v", body.Name, ledgerErr)
+	if ledgerErr := service_ledger.DeleteBucketEntry(key); ledgerErr != nil {
+		slog.WarnContext(r.Context(), "failed to remove bucket from service ledger", "bucket", body.Name, "err", ledgerErr)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -557,19 +724,24 @@ func DeleteObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !utils.ValidResourceName(req.Bucket) || !validObjectName(req.Name) {
+		apierror.Respond(w, r, http.StatusNotFound, "File not found")
 		return
 	}
 
-	home, _ := os.UserHomeDir()
-	filePath := filepath.Join(home, ".opencloud", "blob_storage", req.Bucket, req.Name)
+	blobDir, _ := utils.ProjectDir(opencloudapi.RequestProject(r.Context()), utils.BlobStorage)
+	filePath := filepath.Join(blobDir, req.Bucket, req.Name)
 
 	if err := os.Remove(filePath); err != nil {
 		if os.IsNotExist(err) {
-			http.Error(w, "File not found", http.StatusNotFound)
+			apierror.Respond(w, r, http.StatusNotFound, "File not found")
 			return
 		}
-		http.Error(w, "Error deleting file", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Filesystem(err, "Error deleting file"))
 		return
 	}
 
@@ -584,31 +756,36 @@ func DeleteObject(w http.ResponseWriter, r *http.Request) {
 // DownloadObject downloads a file from blob storage
 func DownloadObject(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Decode JSON body into a map
 	var body map[string]string
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	bucket, ok1 := body["bucket"]
 	name, ok2 := body["name"]
 	if !ok1 || !ok2 || bucket == "" || name == "" {
-		http.Error(w, "Missing bucket or name", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing bucket or name")
+		return
+	}
+
+	if !utils.ValidResourceName(bucket) || !validObjectName(name) {
+		apierror.Respond(w, r, http.StatusNotFound, "File not found")
 		return
 	}
 
 	// Adjust this path to match your storage layout
-	home, _ := os.UserHomeDir()
-	filePath := filepath.Join(home, ".opencloud", "blob_storage", bucket, name)
+	blobDir, _ := utils.ProjectDir(opencloudapi.RequestProject(r.Context()), utils.BlobStorage)
+	filePath := filepath.Join(blobDir, bucket, name)
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
+		apierror.Respond(w, r, http.StatusNotFound, "File not found")
 		return
 	}
 	defer file.Close()
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -45,6 +47,55 @@ func TestGetBlobBuckets(t *testing.T) {
 	}
 }
 
+// TestGetBlobBucketsPages tests paging through a bucket's objects in size
+// order, where objects of equal size are ordered by name.
+func TestGetBlobBucketsPages(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	bucketDir := filepath.Join(tmpDir, ".opencloud", "blob_storage", "photos")
+	if err := os.MkdirAll(bucketDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"a.jpg": 3, "b.jpg": 1, "c.png": 3, "d.jpg": 2, "e.jpg": 1} {
+		if err := os.WriteFile(filepath.Join(bucketDir, name), bytes.Repeat([]byte("x"), size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		req := httptest.NewRequest(http.MethodGet, "/get-blobs?bucket=photos&sort=-size&limit=2&cursor="+cursor, nil)
+		w := httptest.NewRecorder()
+		GetBlobBuckets(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("page %d: status %d: %s", pages, w.Code, w.Body)
+		}
+		var blobs []Blob
+		if err := json.NewDecoder(w.Body).Decode(&blobs); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range blobs {
+			names = append(names, b.Name)
+		}
+		if cursor = w.Header().Get("X-Next-Cursor"); cursor == "" {
+			break
+		}
+	}
+	if got, want := fmt.Sprint(names), "[c.png a.jpg d.jpg e.jpg b.jpg]"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/get-blobs?bucket=photos&prefix=c", nil)
+	w := httptest.NewRecorder()
+	GetBlobBuckets(w, req)
+	var blobs []Blob
+	json.NewDecoder(w.Body).Decode(&blobs)
+	if len(blobs) != 1 || blobs[0].Name != "c.png" || blobs[0].Size != 3 {
+		t.Errorf("prefix=c = %+v", blobs)
+	}
+}
+
 // newUploadRequest builds a multipart POST request with bucket and file fields.
 // When bucketFirst is true the bucket field precedes the file, which is the
 // order required by the streaming UploadObject handler.
@@ -104,6 +155,39 @@ func TestUploadObjectSuccess(t *testing.T) {
 	}
 }
 
+// TestUploadObjectBucketFromQuery tests that the bucket can be given as a
+// query parameter instead of a form field, as /api/v1 uploads do.
+func TestUploadObjectBucketFromQuery(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "query.txt")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	fw.Write([]byte("from query"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-object?bucket=query-bucket", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	UploadObject(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(tmpDir, ".opencloud", "blob_storage", "query-bucket", "query.txt"))
+	if err != nil {
+		t.Fatalf("Uploaded file not found: %v", err)
+	}
+	if string(data) != "from query" {
+		t.Errorf("File content mismatch: got %q", string(data))
+	}
+}
+
 // TestUploadObjectLargeFile tests that files larger than the old 10 MB in-memory
 // limit upload successfully using the streaming multipart handler.
 func TestUploadObjectLargeFile(t *testing.T) {
@@ -425,6 +509,13 @@ func TestRenameBucketValidation(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			description:    "Should reject newName longer than 50 characters",
 		},
+		{
+			name:           "New name with underscore",
+			currentName:    "old-name",
+			newName:        "new_name",
+			expectedStatus: http.StatusBadRequest,
+			description:    "Should reject newName containing an underscore",
+		},
 		{
 			name:           "Non-existent current bucket",
 			currentName:    "does-not-exist-12345",
@@ -716,6 +807,60 @@ func TestCreateBucketWithContainerMount(t *testing.T) {
 	}
 }
 
+// TestCreateBucketVolumeNameCollision tests that CreateBucket refuses bucket
+// names that could map to another project's volume, and container-mount
+// buckets whose volume name is already taken.
+func TestCreateBucketVolumeNameCollision(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	blobStoragePath := filepath.Join(tmpDir, ".opencloud", "blob_storage")
+	if err := os.MkdirAll(blobStoragePath, 0755); err != nil {
+		t.Fatalf("Failed to create blob_storage directory: %v", err)
+	}
+
+	created := false
+	origCreate, origInspect, origConn := createPodmanVolume, inspectPodmanVolume, blobStoragePodmanConnection
+	t.Cleanup(func() {
+		createPodmanVolume, inspectPodmanVolume, blobStoragePodmanConnection = origCreate, origInspect, origConn
+	})
+	blobStoragePodmanConnection = func(ctx context.Context) (context.Context, error) {
+		return ctx, nil
+	}
+	inspectPodmanVolume = func(ctx context.Context, name string, _ *volumes.InspectOptions) (*entitiesTypes.VolumeConfigResponse, error) {
+		if name == podmanVolumePrefix+"taken" {
+			return &entitiesTypes.VolumeConfigResponse{}, nil
+		}
+		return nil, errors.New("no such volume")
+	}
+	createPodmanVolume = func(ctx context.Context, opts entitiesTypes.VolumeCreateOptions, _ *volumes.CreateOptions) (*entitiesTypes.VolumeConfigResponse, error) {
+		created = true
+		return nil, nil
+	}
+
+	createBucket := func(name string) int {
+		body, _ := json.Marshal(map[string]interface{}{"name": name, "containerMount": true})
+		w := httptest.NewRecorder()
+		CreateBucket(w, httptest.NewRequest(http.MethodPost, "/create-bucket", bytes.NewBuffer(body)))
+		return w.Code
+	}
+
+	// "team_reports" in the default project would get the volume of the
+	// bucket "reports" in the project "team".
+	if code := createBucket("team_reports"); code != http.StatusBadRequest {
+		t.Errorf("bucket name with underscore: expected %d, got %d", http.StatusBadRequest, code)
+	}
+	if code := createBucket("taken"); code != http.StatusConflict {
+		t.Errorf("existing volume: expected %d, got %d", http.StatusConflict, code)
+	}
+	if created {
+		t.Error("Expected no Podman volume to be created")
+	}
+	if _, err := os.Stat(filepath.Join(blobStoragePath, "taken")); !os.IsNotExist(err) {
+		t.Errorf("Expected the bucket directory to be removed, got %v", err)
+	}
+}
+
 // TestDeleteBucketWithContainerMount tests that deleting a container-mount bucket removes
 // the bucket directory, calls Podman volume removal (with Force=true), and returns 200 OK.
 func TestDeleteBucketWithContainerMount(t *testing.T) {
@@ -7,7 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -15,6 +15,9 @@ import (
 	"time"
 
 	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/api/listing"
 	service_ledger "github.com/WavexSoftware/OpenCloud/service_ledger"
 	buildahDefine "github.com/containers/buildah/define"
 	"github.com/containers/podman/v5/pkg/bindings"
@@ -247,11 +250,35 @@ func expandImageTags(entry imageTagEntry) []opencloudapi.ImageInfo {
 	return result
 }
 
+// imageListing describes the list parameters of GetContainerRegistry.  An
+// image is listed once per tag, so its key combines the ID and the tag.  The
+// default order, newest first, is the one of "podman images".
+var imageListing = listing.Spec[opencloudapi.ImageInfo]{
+	Key: func(img opencloudapi.ImageInfo) string { return img.ID + " " + img.Image },
+	Sorts: map[string]listing.Field[opencloudapi.ImageInfo]{
+		"name":    {String: func(img opencloudapi.ImageInfo) string { return img.Image }},
+		"created": {Int: func(img opencloudapi.ImageInfo) int64 { return img.Created }},
+		"size":    {Int: func(img opencloudapi.ImageInfo) int64 { return img.Size }},
+	},
+	DefaultSort: "-created",
+	Filters: map[string]listing.Filter[opencloudapi.ImageInfo]{
+		"label":  listing.Label(func(img opencloudapi.ImageInfo) map[string]string { return img.Labels }),
+		"prefix": listing.Prefix(func(img opencloudapi.ImageInfo) string { return img.Image }),
+	},
+}
+
 // GetContainerRegistry lists all container images available through Podman.
+// It takes the list parameters of imageListing.
 func GetContainerRegistry(w http.ResponseWriter, r *http.Request) {
+	q, apiErr := imageListing.Parse(r.URL.Query())
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	}
+
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
 
@@ -260,13 +287,13 @@ func GetContainerRegistry(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := bindings.NewConnection(ctx, socket)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman socket %q: %v", socket, err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, fmt.Sprintf("Failed to connect to Podman socket %q", socket)))
 		return
 	}
 
 	imageList, err := images.List(conn, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to list images: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to list images")
 		return
 	}
 
@@ -283,10 +310,12 @@ func GetContainerRegistry(w http.ResponseWriter, r *http.Request) {
 			Labels:      img.Labels,
 		})...)
 	}
+	result, next := imageListing.Apply(q, result)
 
+	listing.SetNextCursor(w, next)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(result); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "")
 		return
 	}
 }
@@ -294,7 +323,7 @@ func GetContainerRegistry(w http.ResponseWriter, r *http.Request) {
 // BuildImage handles building a container image using the Podman API.
 func BuildImage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -305,7 +334,7 @@ func BuildImage(w http.ResponseWriter, r *http.Request) {
 	dec.DisallowUnknownFields()
 
 	if err := dec.Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid JSON payload: %v", err), http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid JSON payload: %v", err))
 		return
 	}
 
@@ -313,30 +342,30 @@ func BuildImage(w http.ResponseWriter, r *http.Request) {
 	req.ImageName = strings.TrimSpace(req.ImageName)
 
 	if req.Dockerfile == "" || req.ImageName == "" {
-		http.Error(w, "dockerfile and imageName are required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "dockerfile and imageName are required")
 		return
 	}
 
 	if !hasFromInstruction(req.Dockerfile) {
-		http.Error(w, "dockerfile must contain a FROM instruction", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "dockerfile must contain a FROM instruction")
 		return
 	}
 
 	if errMsg := opencloudapi.ValidateImageName(req.ImageName); errMsg != "" {
-		http.Error(w, errMsg, http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 		return
 	}
 
 	tmpDir, err := os.MkdirTemp("", "opencloud-build-*")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create temp dir: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to create temp dir")
 		return
 	}
 	defer os.RemoveAll(tmpDir)
 
 	dfPath := filepath.Join(tmpDir, "Dockerfile")
 	if err := os.WriteFile(dfPath, []byte(req.Dockerfile), 0644); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write Dockerfile: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to write Dockerfile")
 		return
 	}
 
@@ -345,7 +374,7 @@ func BuildImage(w http.ResponseWriter, r *http.Request) {
 	if req.Context != "" && len(req.Files) == 0 {
 		ctxPath := filepath.Join(tmpDir, "context.txt")
 		if err := os.WriteFile(ctxPath, []byte(req.Context), 0644); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to write context: %v", err), http.StatusInternalServerError)
+			apierror.RespondError(w, r, err, "Failed to write context")
 			return
 		}
 	}
@@ -354,25 +383,25 @@ func BuildImage(w http.ResponseWriter, r *http.Request) {
 	for relPath, content := range req.Files {
 		cleanRel, err := sanitizeRelativePath(relPath)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid file path %q: %v", relPath, err), http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid file path %q: %v", relPath, err))
 			return
 		}
 
 		fullPath := filepath.Join(tmpDir, cleanRel)
 		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create directory for %q: %v", relPath, err), http.StatusInternalServerError)
+			apierror.RespondError(w, r, err, fmt.Sprintf("Failed to create directory for %q", relPath))
 			return
 		}
 
 		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to write %q: %v", relPath, err), http.StatusInternalServerError)
+			apierror.RespondError(w, r, err, fmt.Sprintf("Failed to write %q", relPath))
 			return
 		}
 	}
 
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
 
@@ -381,7 +410,7 @@ func BuildImage(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := bindings.NewConnection(ctx, socket)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman socket %q: %v", socket, err), http.StatusServiceUnavailable)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, fmt.Sprintf("Failed to connect to Podman socket %q", socket)))
 		return
 	}
 
@@ -404,20 +433,21 @@ func BuildImage(w http.ResponseWriter, r *http.Request) {
 	if req.Platform != "" {
 		osName, arch, err := parsePlatform(req.Platform)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 		buildOpts.OS = osName
 		buildOpts.Architecture = arch
 	}
 
-	if _, err := images.Build(conn, []string{"Dockerfile"}, buildOpts); err != nil {
-		log.Printf("BuildImage2 failed for %s: %v", req.ImageName, err)
-		http.Error(
-			w,
-			fmt.Sprintf("Build failed: %v\n\n%s", err, truncateString(buildLogs.String(), maxBuildLogBytes)),
-			http.StatusInternalServerError,
-		)
+	started := time.Now()
+	_, err = images.Build(conn, []string{"Dockerfile"}, buildOpts)
+	opencloudapi.RecordImageBuild(err == nil, time.Since(started))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "image build failed", "image", req.ImageName, "err", err)
+		apierror.Write(w, r, apierror.FromError(err, "Build failed").WithDetails(map[string]string{
+			"buildLog": truncateString(buildLogs.String(), maxBuildLogBytes),
+		}))
 		return
 	}
 
@@ -433,8 +463,9 @@ func BuildImage(w http.ResponseWriter, r *http.Request) {
 		// from the end so the beginning of the output is preserved.
 		truncateString(buildLogs.String(), maxBuildLogBytes),
 	); ledgerErr != nil {
-		log.Printf("Warning: failed to record image %s in service ledger: %v", req.ImageName, ledgerErr)
+		slog.WarnContext(r.Context(), "failed to record image in service ledger", "image", req.ImageName, "err", ledgerErr)
 	}
+	events.Publish(events.ImageBuilt, map[string]any{"imageName": req.ImageName})
 
 	resp := map[string]string{
 		"status":    "success",
@@ -461,10 +492,10 @@ func BuildImage(w http.ResponseWriter, r *http.Request) {
 //
 //	On error:
 //	event: error
-//	data: <error message>
+//	data: {"code":"...","message":"...","requestId":"..."}
 func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -475,7 +506,7 @@ func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 	dec.DisallowUnknownFields()
 
 	if err := dec.Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid JSON payload: %v", err), http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid JSON payload: %v", err))
 		return
 	}
 
@@ -483,30 +514,30 @@ func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 	req.ImageName = strings.TrimSpace(req.ImageName)
 
 	if req.Dockerfile == "" || req.ImageName == "" {
-		http.Error(w, "dockerfile and imageName are required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "dockerfile and imageName are required")
 		return
 	}
 
 	if !hasFromInstruction(req.Dockerfile) {
-		http.Error(w, "dockerfile must contain a FROM instruction", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "dockerfile must contain a FROM instruction")
 		return
 	}
 
 	if errMsg := opencloudapi.ValidateImageName(req.ImageName); errMsg != "" {
-		http.Error(w, errMsg, http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 		return
 	}
 
 	tmpDir, err := os.MkdirTemp("", "opencloud-build-*")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create temp dir: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to create temp dir")
 		return
 	}
 	defer os.RemoveAll(tmpDir)
 
 	dfPath := filepath.Join(tmpDir, "Dockerfile")
 	if err := os.WriteFile(dfPath, []byte(req.Dockerfile), 0644); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write Dockerfile: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to write Dockerfile")
 		return
 	}
 
@@ -514,7 +545,7 @@ func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 	if req.Context != "" && len(req.Files) == 0 {
 		ctxPath := filepath.Join(tmpDir, "context.txt")
 		if err := os.WriteFile(ctxPath, []byte(req.Context), 0644); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to write context: %v", err), http.StatusInternalServerError)
+			apierror.RespondError(w, r, err, "Failed to write context")
 			return
 		}
 	}
@@ -523,30 +554,30 @@ func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 	for relPath, content := range req.Files {
 		cleanRel, err := sanitizeRelativePath(relPath)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid file path %q: %v", relPath, err), http.StatusBadRequest)
+			apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid file path %q: %v", relPath, err))
 			return
 		}
 		fullPath := filepath.Join(tmpDir, cleanRel)
 		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create directory for %q: %v", relPath, err), http.StatusInternalServerError)
+			apierror.RespondError(w, r, err, fmt.Sprintf("Failed to create directory for %q", relPath))
 			return
 		}
 		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to write %q: %v", relPath, err), http.StatusInternalServerError)
+			apierror.RespondError(w, r, err, fmt.Sprintf("Failed to write %q", relPath))
 			return
 		}
 	}
 
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
 
 	// Upgrade the connection to SSE before starting the build.
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		apierror.Respond(w, r, http.StatusInternalServerError, "Streaming not supported")
 		return
 	}
 
@@ -564,8 +595,7 @@ func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := bindings.NewConnection(ctx, socket)
 	if err != nil {
-		fmt.Fprintf(w, "event: error\ndata: %s\n\n", fmt.Sprintf("Failed to connect to Podman: %v", err))
-		flusher.Flush()
+		apierror.WriteEvent(w, r, apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
 		return
 	}
 
@@ -600,7 +630,9 @@ func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 			buildOpts.Architecture = arch
 		}
 
+		started := time.Now()
 		_, err := images.Build(conn, []string{"Dockerfile"}, buildOpts)
+		opencloudapi.RecordImageBuild(err == nil, time.Since(started))
 		pw.Close()
 		buildErrCh <- err
 	}()
@@ -617,8 +649,7 @@ func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := <-buildErrCh; err != nil {
-		fmt.Fprintf(w, "event: error\ndata: %s\n\n", fmt.Sprintf("Build failed: %v", err))
-		flusher.Flush()
+		apierror.WriteEvent(w, r, apierror.FromError(err, "Build failed"))
 		return
 	}
 
@@ -635,8 +666,9 @@ func BuildImageStream(w http.ResponseWriter, r *http.Request) {
 		time.Now().UTC().Format(time.RFC3339),
 		truncateString(strings.Join(buildLogLines, "\n"), maxBuildLogBytes),
 	); ledgerErr != nil {
-		log.Printf("Warning: failed to record image %s in service ledger: %v", req.ImageName, ledgerErr)
+		slog.WarnContext(r.Context(), "failed to record image in service ledger", "image", req.ImageName, "err", ledgerErr)
 	}
+	events.Publish(events.ImageBuilt, map[string]any{"imageName": req.ImageName})
 
 	donePayload, _ := json.Marshal(map[string]string{"status": "success", "imageName": req.ImageName})
 	fmt.Fprintf(w, "event: done\ndata: %s\n\n", donePayload)
@@ -680,7 +712,7 @@ func rejectIfImageInUse(conn context.Context, imageName string) error {
 // It accepts a POST request with a JSON body containing the image name to delete.
 func DeleteImage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -688,19 +720,19 @@ func DeleteImage(w http.ResponseWriter, r *http.Request) {
 
 	var req DeleteImageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
 	req.ImageName = strings.TrimSpace(req.ImageName)
 	if req.ImageName == "" {
-		http.Error(w, "imageName is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "imageName is required")
 		return
 	}
 
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
 
@@ -709,24 +741,24 @@ func DeleteImage(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := newDeleteImageConnection(ctx, socket)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman socket %q: %v", socket, err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, fmt.Sprintf("Failed to connect to Podman socket %q", socket)))
 		return
 	}
 
 	// Guard: reject deletion if any container in Container Compute is using this image.
 	if err := rejectIfImageInUse(conn, req.ImageName); err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		apierror.Respond(w, r, http.StatusConflict, err.Error())
 		return
 	}
 
 	if _, errs := images.Remove(conn, []string{req.ImageName}, new(images.RemoveOptions)); len(errs) > 0 {
-		http.Error(w, fmt.Sprintf("Failed to delete image: %v", errs[0]), http.StatusInternalServerError)
+		apierror.RespondError(w, r, errs[0], "Failed to delete image")
 		return
 	}
 
 	ledgerName := strings.TrimPrefix(req.ImageName, "localhost/")
 	if ledgerErr := service_ledger.DeleteContainerImageEntry(ledgerName); ledgerErr != nil {
-		log.Printf("Warning: failed to remove image %s from service ledger: %v", ledgerName, ledgerErr)
+		slog.WarnContext(r.Context(), "failed to remove image from service ledger", "image", ledgerName, "err", ledgerErr)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -741,7 +773,7 @@ func DeleteImage(w http.ResponseWriter, r *http.Request) {
 // using Podman and records the pulled image in the service ledger.
 func PullImage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -749,13 +781,13 @@ func PullImage(w http.ResponseWriter, r *http.Request) {
 
 	var req PullImageRequest
 	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
 	req.ImageName = strings.TrimSpace(req.ImageName)
 	if req.ImageName == "" {
-		http.Error(w, "imageName is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "imageName is required")
 		return
 	}
 
@@ -764,12 +796,12 @@ func PullImage(w http.ResponseWriter, r *http.Request) {
 		req.Registry = "docker.io"
 	}
 	if req.Registry != "docker.io" && req.Registry != "quay.io" {
-		http.Error(w, "registry must be \"docker.io\" or \"quay.io\"", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "registry must be \"docker.io\" or \"quay.io\"")
 		return
 	}
 
 	if errMsg := opencloudapi.ValidateImageName(req.ImageName); errMsg != "" {
-		http.Error(w, errMsg, http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 		return
 	}
 
@@ -782,7 +814,7 @@ func PullImage(w http.ResponseWriter, r *http.Request) {
 
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
 
@@ -791,12 +823,12 @@ func PullImage(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := bindings.NewConnection(ctx, socket)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman socket %q: %v", socket, err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, fmt.Sprintf("Failed to connect to Podman socket %q", socket)))
 		return
 	}
 
 	if _, err := images.Pull(conn, imageRef, new(images.PullOptions).WithQuiet(false)); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to pull image %q: %v", imageRef, err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, fmt.Sprintf("Failed to pull image %q", imageRef))
 		return
 	}
 
@@ -806,8 +838,9 @@ func PullImage(w http.ResponseWriter, r *http.Request) {
 		time.Now().UTC().Format(time.RFC3339),
 		"",
 	); ledgerErr != nil {
-		log.Printf("Warning: failed to record pulled image %s in service ledger: %v", req.ImageName, ledgerErr)
+		slog.WarnContext(r.Context(), "failed to record pulled image in service ledger", "image", req.ImageName, "err", ledgerErr)
 	}
+	events.Publish(events.ImagePulled, map[string]any{"imageName": imageRef})
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{
@@ -840,10 +873,10 @@ type pullProgressEvent struct {
 //
 //	On error:
 //	event: error
-//	data: <error message>
+//	data: {"code":"...","message":"...","requestId":"..."}
 func PullImageStream(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -851,13 +884,13 @@ func PullImageStream(w http.ResponseWriter, r *http.Request) {
 
 	var req PullImageRequest
 	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
 	req.ImageName = strings.TrimSpace(req.ImageName)
 	if req.ImageName == "" {
-		http.Error(w, "imageName is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "imageName is required")
 		return
 	}
 
@@ -866,12 +899,12 @@ func PullImageStream(w http.ResponseWriter, r *http.Request) {
 		req.Registry = "docker.io"
 	}
 	if req.Registry != "docker.io" && req.Registry != "quay.io" {
-		http.Error(w, "registry must be \"docker.io\" or \"quay.io\"", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "registry must be \"docker.io\" or \"quay.io\"")
 		return
 	}
 
 	if errMsg := opencloudapi.ValidateImageName(req.ImageName); errMsg != "" {
-		http.Error(w, errMsg, http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, errMsg)
 		return
 	}
 
@@ -883,14 +916,14 @@ func PullImageStream(w http.ResponseWriter, r *http.Request) {
 
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
 
 	// Upgrade the connection to SSE before any long-running operations.
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		apierror.Respond(w, r, http.StatusInternalServerError, "Streaming not supported")
 		return
 	}
 
@@ -908,8 +941,7 @@ func PullImageStream(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := bindings.NewConnection(ctx, socket)
 	if err != nil {
-		fmt.Fprintf(w, "event: error\ndata: %s\n\n", fmt.Sprintf("Failed to connect to Podman: %v", err))
-		flusher.Flush()
+		apierror.WriteEvent(w, r, apierror.PodmanUnavailable(err, "Failed to connect to Podman"))
 		return
 	}
 
@@ -939,8 +971,7 @@ func PullImageStream(w http.ResponseWriter, r *http.Request) {
 		if json.Unmarshal([]byte(raw), &event) == nil {
 			// Propagate explicit pull errors embedded in the progress stream.
 			if event.Error != "" {
-				fmt.Fprintf(w, "event: error\ndata: %s\n\n", event.Error)
-				flusher.Flush()
+				apierror.WriteEvent(w, r, apierror.New(http.StatusInternalServerError, event.Error).WithCode(apierror.CodePodmanError))
 				return
 			}
 			// Prefer the human-readable "stream" field (e.g. "Pulling from …"),
@@ -967,8 +998,7 @@ func PullImageStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := <-pullErr; err != nil {
-		fmt.Fprintf(w, "event: error\ndata: %s\n\n", fmt.Sprintf("Failed to pull image %q: %v", imageRef, err))
-		flusher.Flush()
+		apierror.WriteEvent(w, r, apierror.FromError(err, fmt.Sprintf("Failed to pull image %q", imageRef)))
 		return
 	}
 
@@ -982,8 +1012,9 @@ func PullImageStream(w http.ResponseWriter, r *http.Request) {
 		time.Now().UTC().Format(time.RFC3339),
 		truncateString(strings.Join(pullLogLines, "\n"), maxBuildLogBytes),
 	); ledgerErr != nil {
-		log.Printf("Warning: failed to record pulled image %s in service ledger: %v", req.ImageName, ledgerErr)
+		slog.WarnContext(r.Context(), "failed to record pulled image in service ledger", "image", req.ImageName, "err", ledgerErr)
 	}
+	events.Publish(events.ImagePulled, map[string]any{"imageName": imageRef})
 
 	donePayload, _ := json.Marshal(map[string]string{"status": "success", "imageName": imageRef})
 	fmt.Fprintf(w, "event: done\ndata: %s\n\n", donePayload)
@@ -997,19 +1028,19 @@ func PullImageStream(w http.ResponseWriter, r *http.Request) {
 // Route: GET /get-image?name=<imageNameOrID>
 func GetImage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	nameOrID := strings.TrimSpace(r.URL.Query().Get("name"))
 	if nameOrID == "" {
-		http.Error(w, "name query parameter is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "name query parameter is required")
 		return
 	}
 
 	socket, err := opencloudapi.RootlessPodmanSocket()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to determine rootless Podman socket: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, "Failed to determine rootless Podman socket"))
 		return
 	}
 
@@ -1018,13 +1049,13 @@ func GetImage(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := newGetImageConnection(ctx, socket)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to Podman socket %q: %v", socket, err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.PodmanUnavailable(err, fmt.Sprintf("Failed to connect to Podman socket %q", socket)))
 		return
 	}
 
 	data, err := inspectPodmanImage(conn, nameOrID, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to inspect image: %v", err), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to inspect image")
 		return
 	}
 
@@ -1054,7 +1085,7 @@ func GetImage(w http.ResponseWriter, r *http.Request) {
 
 	out, err := json.Marshal(detail)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1071,19 +1102,19 @@ func GetImage(w http.ResponseWriter, r *http.Request) {
 // recorded logs an empty string is returned. The response body is plain text.
 func GetImageLogs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	nameOrID := strings.TrimSpace(r.URL.Query().Get("name"))
 	if nameOrID == "" {
-		http.Error(w, "name query parameter is required", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "name query parameter is required")
 		return
 	}
 
 	entry, err := service_ledger.GetContainerImageEntry(nameOrID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to read service ledger: %v", err), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Ledger(err, "Failed to read service ledger"))
 		return
 	}
 
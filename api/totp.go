@@ -0,0 +1,602 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// TOTP parameters (RFC 6238 defaults, which every authenticator app supports).
+const (
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 6
+	totpSkew       = 1 // accept codes from one step either side of now
+	totpSecretSize = 20
+	totpIssuer     = "OpenCloud"
+)
+
+// Recovery code settings.
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+// mfaChallengeTTL is how long the challenge returned by Login stays valid
+// while the user types their code.
+const mfaChallengeTTL = 5 * time.Minute
+
+// totpEnrollment is a user's TOTP state.  Pending enrollments (Confirmed ==
+// false) are not enforced at login until a valid code has been entered once.
+type totpEnrollment struct {
+	Secret        string    `json:"secret"`
+	Confirmed     bool      `json:"confirmed"`
+	RecoveryCodes []string  `json:"recoveryCodes,omitempty"` // SHA-256 hashes, removed once used
+	LastUsedStep  int64     `json:"lastUsedStep,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// totpMutex serialises read-modify-write cycles on the TOTP file.
+var totpMutex sync.Mutex
+
+// totpPath returns the path to the TOTP enrollment file.
+func totpPath() (string, error) {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "user", "totp.json"), nil
+}
+
+// readTOTPFile loads all enrollments keyed by username.
+func readTOTPFile() (map[string]totpEnrollment, error) {
+	path, err := totpPath()
+	if err != nil {
+		return nil, err
+	}
+
+	enrollments := make(map[string]totpEnrollment)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return enrollments, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &enrollments); err != nil {
+		return nil, fmt.Errorf("malformed totp file: %w", err)
+	}
+	return enrollments, nil
+}
+
+// writeTOTPFile atomically replaces the TOTP file.  Callers must hold totpMutex.
+func writeTOTPFile(enrollments map[string]totpEnrollment) error {
+	path, err := totpPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(enrollments, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// getTOTPEnrollment returns the enrollment for username, or nil.
+func getTOTPEnrollment(username string) (*totpEnrollment, error) {
+	enrollments, err := readTOTPFile()
+	if err != nil {
+		return nil, err
+	}
+	e, ok := enrollments[username]
+	if !ok {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// updateTOTPEnrollment applies fn to the enrollment for username under
+// totpMutex.  fn receives nil when there is none; returning nil deletes it.
+func updateTOTPEnrollment(username string, fn func(e *totpEnrollment) (*totpEnrollment, error)) error {
+	totpMutex.Lock()
+	defer totpMutex.Unlock()
+
+	enrollments, err := readTOTPFile()
+	if err != nil {
+		return err
+	}
+
+	var current *totpEnrollment
+	if e, ok := enrollments[username]; ok {
+		current = &e
+	}
+	updated, err := fn(current)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		delete(enrollments, username)
+	} else {
+		enrollments[username] = *updated
+	}
+	return writeTOTPFile(enrollments)
+}
+
+// totpCode computes the RFC 4226 HOTP value of secret for counter step.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// totpStep returns the time step containing t.
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// matchTOTP returns the step at which code is valid for secret around now,
+// or -1 if it does not match.
+func matchTOTP(encodedSecret, code string, now time.Time) int64 {
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(encodedSecret)
+	if err != nil {
+		return -1
+	}
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return -1
+	}
+
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return -1
+}
+
+// newTOTPSecret returns a random base32-encoded secret.
+func newTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// totpURI returns the otpauth:// URI authenticator apps scan from a QR code.
+func totpURI(username, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+	label := url.PathEscape(totpIssuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// newRecoveryCodes returns fresh recovery codes and their hashes.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	// Lower-case alphabet without easily confused characters (i, l, o, 0, 1).
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashAccessToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// Errors returned by verifySecondFactor.
+var (
+	errTOTPNotEnrolled = fmt.Errorf("two-factor authentication is not enabled")
+	errTOTPInvalid     = fmt.Errorf("invalid two-factor code")
+)
+
+// verifySecondFactor checks a TOTP code or a recovery code for username and
+// records its use, so neither can be replayed.
+func verifySecondFactor(username, code, recoveryCode string, now time.Time) error {
+	return updateTOTPEnrollment(username, func(e *totpEnrollment) (*totpEnrollment, error) {
+		if e == nil || !e.Confirmed {
+			return nil, errTOTPNotEnrolled
+		}
+
+		if recoveryCode != "" {
+			hash := hashAccessToken(strings.ToLower(strings.TrimSpace(recoveryCode)))
+			for i, h := range e.RecoveryCodes {
+				if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+					e.RecoveryCodes = append(e.RecoveryCodes[:i], e.RecoveryCodes[i+1:]...)
+					return e, nil
+				}
+			}
+			return nil, errTOTPInvalid
+		}
+
+		step := matchTOTP(e.Secret, code, now)
+		if step < 0 || step <= e.LastUsedStep {
+			return nil, errTOTPInvalid
+		}
+		e.LastUsedStep = step
+		return e, nil
+	})
+}
+
+// issueMFAChallenge returns a short-lived token proving that username passed
+// the password check.  It is only accepted by VerifyLogin.
+func issueMFAChallenge(username string, now time.Time) (string, error) {
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", err
+	}
+	return makeToken(tokenClaims{
+		Subject:   username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(mfaChallengeTTL).Unix(),
+		TokenID:   jti,
+		TokenType: "mfa",
+	})
+}
+
+// verifyLoginRequest is the JSON body accepted by VerifyLogin.  Exactly one of
+// Code and RecoveryCode is expected.
+type verifyLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code,omitempty"`
+	RecoveryCode   string `json:"recovery_code,omitempty"`
+}
+
+// VerifyLogin handles POST /user/login/verify, the second step of a login for
+// users with two-factor authentication.  It exchanges the challenge token
+// returned by Login plus a valid TOTP or recovery code for a token pair.
+func VerifyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req verifyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		apierror.Respond(w, r, http.StatusBadRequest, "challenge_token and code are required")
+		return
+	}
+
+	claims, err := parseToken(req.ChallengeToken, false)
+	if err != nil || claims.TokenType != "mfa" {
+		apierror.Respond(w, r, http.StatusUnauthorized, "invalid or expired challenge, please log in again")
+		return
+	}
+	revoked, err := isTokenRevoked(claims.TokenID)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return
+	}
+	if revoked {
+		apierror.Respond(w, r, http.StatusUnauthorized, "invalid or expired challenge, please log in again")
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords.
+	now := time.Now()
+	client := clientAddr(r)
+	wait, err := reserveLoginAttempt(claims.Subject, client, now)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return
+	}
+	if wait > 0 {
+		writeTooManyAttempts(w, r, wait)
+		return
+	}
+
+	err = verifySecondFactor(claims.Subject, req.Code, req.RecoveryCode, now)
+	switch err {
+	case nil:
+		releaseLoginAttemptOrWarn(r, claims.Subject, client, false)
+	case errTOTPInvalid, errTOTPNotEnrolled:
+		apierror.Respond(w, r, http.StatusUnauthorized, errTOTPInvalid.Error())
+		return
+	default:
+		releaseLoginAttemptOrWarn(r, claims.Subject, client, false)
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return
+	}
+
+	// The account may have been disabled while the challenge was pending.
+	user, err := lookupUser(claims.Subject)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return
+	}
+	if user == nil || user.Disabled {
+		apierror.Respond(w, r, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	if err := revokeTokenIDs(map[string]int64{claims.TokenID: claims.ExpiresAt}); err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+		return
+	}
+	if _, err := clearLoginFailures(claims.Subject); err != nil {
+		slog.WarnContext(r.Context(), "failed to reset login failures", "user", claims.Subject, "err", err)
+	}
+
+	accessToken, refreshToken, err := issueTokenPair(claims.Subject, r.UserAgent(), client)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to issue tokens")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loginResponse{
+		AccessToken:        accessToken,
+		RefreshToken:       refreshToken,
+		MustChangePassword: user.MustChangePassword,
+	})
+}
+
+// totpStatusResponse is the JSON body returned by GetTOTPStatus.
+type totpStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	Pending                bool `json:"pending"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+// GetTOTPStatus handles GET /user/totp/status.
+func GetTOTPStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	username, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	e, err := getTOTPEnrollment(username)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to read two-factor settings")
+		return
+	}
+
+	resp := totpStatusResponse{}
+	if e != nil {
+		resp.Enabled = e.Confirmed
+		resp.Pending = !e.Confirmed
+		resp.RecoveryCodesRemaining = len(e.RecoveryCodes)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// EnrollTOTP handles POST /user/totp/enroll.
+// It generates a new secret for the caller and returns it together with the
+// otpauth:// URI that clients render as a QR code.  The enrollment only takes
+// effect once confirmed through ConfirmTOTP.
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	username, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to generate secret")
+		return
+	}
+
+	err = updateTOTPEnrollment(username, func(e *totpEnrollment) (*totpEnrollment, error) {
+		if e != nil && e.Confirmed {
+			return nil, errTOTPAlreadyEnabled
+		}
+		return &totpEnrollment{Secret: secret, CreatedAt: time.Now()}, nil
+	})
+	if err == errTOTPAlreadyEnabled {
+		apierror.Respond(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to save two-factor settings")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":     secret,
+		"otpauthUri": totpURI(username, secret),
+	})
+}
+
+// errTOTPAlreadyEnabled is returned when enrolling while TOTP is already active.
+var errTOTPAlreadyEnabled = fmt.Errorf("two-factor authentication is already enabled; disable it first")
+
+// ConfirmTOTP handles POST /user/totp/confirm.
+// It activates a pending enrollment once the caller proves their
+// authenticator works, and returns one-time recovery codes.
+//
+// Request body: {"code": "123456"}
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	username, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to generate recovery codes")
+		return
+	}
+
+	err = updateTOTPEnrollment(username, func(e *totpEnrollment) (*totpEnrollment, error) {
+		if e == nil {
+			return nil, errTOTPNotEnrolled
+		}
+		if e.Confirmed {
+			return nil, errTOTPAlreadyEnabled
+		}
+		step := matchTOTP(e.Secret, req.Code, time.Now())
+		if step < 0 {
+			return nil, errTOTPInvalid
+		}
+		e.Confirmed = true
+		e.LastUsedStep = step
+		e.RecoveryCodes = hashes
+		return e, nil
+	})
+	switch err {
+	case nil:
+	case errTOTPNotEnrolled:
+		apierror.Respond(w, r, http.StatusNotFound, "no pending enrollment, call /user/totp/enroll first")
+		return
+	case errTOTPAlreadyEnabled:
+		apierror.Respond(w, r, http.StatusConflict, err.Error())
+		return
+	case errTOTPInvalid:
+		apierror.Respond(w, r, http.StatusBadRequest, err.Error())
+		return
+	default:
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to save two-factor settings")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"message":       "two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTOTP handles POST /user/totp/disable.
+//
+// Users turn off their own two-factor authentication by confirming their
+// password: {"password": "..."}.  Callers with user management permission may
+// instead reset another user who lost their device: {"username": "..."}.
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	caller, ok := AuthenticatedUser(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	var req struct {
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	target := req.Username
+	if target == "" || target == caller {
+		target = caller
+		// The password is guarded by the login throttle, so a stolen session
+		// cannot be used to guess it.
+		client := clientAddr(r)
+		wait, err := reserveLoginAttempt(caller, client, time.Now())
+		if err != nil {
+			apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+			return
+		}
+		if wait > 0 {
+			writeTooManyAttempts(w, r, wait)
+			return
+		}
+		user, err := lookupUser(caller)
+		if err != nil {
+			releaseLoginAttemptOrWarn(r, caller, client, false)
+			apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+			return
+		}
+		if user == nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+			apierror.Respond(w, r, http.StatusForbidden, "password is incorrect")
+			return
+		}
+		releaseLoginAttemptOrWarn(r, caller, client, false)
+	} else if role, _ := AuthenticatedRole(r.Context()); !hasPermission(role, groupUsers, accessWrite) {
+		apierror.Respond(w, r, http.StatusForbidden, "insufficient permissions to reset another user's two-factor authentication")
+		return
+	}
+
+	found := false
+	err := updateTOTPEnrollment(target, func(e *totpEnrollment) (*totpEnrollment, error) {
+		found = e != nil
+		return nil, nil
+	})
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to save two-factor settings")
+		return
+	}
+	if !found {
+		apierror.Respond(w, r, http.StatusNotFound, errTOTPNotEnrolled.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "two-factor authentication disabled", "username": target})
+}
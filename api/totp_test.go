@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// enrollTOTPForTest enrolls and confirms TOTP for the session's user and
+// returns the secret and recovery codes.
+func enrollTOTPForTest(t *testing.T, accessToken string) (string, []string) {
+	t.Helper()
+
+	w := serveUserRequest(t, EnrollTOTP, http.MethodPost, "/user/totp/enroll", accessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enroll: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var enroll map[string]string
+	json.NewDecoder(w.Body).Decode(&enroll)
+	secret := enroll["secret"]
+
+	w = serveUserRequest(t, ConfirmTOTP, http.MethodPost, "/user/totp/confirm", accessToken,
+		map[string]string{"code": currentTOTPCode(t, secret, time.Now().Add(-totpPeriod))})
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var confirm struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	json.NewDecoder(w.Body).Decode(&confirm)
+	return secret, confirm.RecoveryCodes
+}
+
+// currentTOTPCode returns the code for secret at time at.
+func currentTOTPCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("bad secret: %v", err)
+	}
+	return totpCode(raw, totpStep(at))
+}
+
+// postJSON calls an unauthenticated handler with a JSON body.
+func postJSON(handler http.HandlerFunc, path string, body any) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(b))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+// TestTOTPCodeRFC6238 checks totpCode against the RFC 6238 SHA-1 test vectors
+// (truncated to six digits).
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		if got := totpCode(secret, totpStep(time.Unix(unix, 0))); got != want {
+			t.Errorf("totpCode at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+// TestTOTPURI verifies the otpauth URI carries the secret and issuer.
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(totpURI("alice", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("unexpected URI %s", u)
+	}
+	if u.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || u.Query().Get("issuer") != totpIssuer {
+		t.Errorf("unexpected query %s", u.RawQuery)
+	}
+}
+
+// TestTOTPLoginFlow verifies the two-step login and that codes cannot be replayed.
+func TestTOTPLoginFlow(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	login := loginForTest(t, "admin", "admin", "go-test")
+	secret, _ := enrollTOTPForTest(t, login.AccessToken)
+
+	w := postJSON(Login, "/user/login", loginRequest{Username: "admin", Password: "admin"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	var challenge mfaChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challenge)
+	if !challenge.MFARequired || challenge.ChallengeToken == "" {
+		t.Fatalf("expected an MFA challenge, got %+v", challenge)
+	}
+
+	// The challenge is not an API credential.
+	if w := serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", challenge.ChallengeToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("challenge used as access token: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = postJSON(VerifyLogin, "/user/login/verify", verifyLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: "000000"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	code := currentTOTPCode(t, secret, time.Now())
+	w = postJSON(VerifyLogin, "/user/login/verify", verifyLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var tokens loginResponse
+	json.NewDecoder(w.Body).Decode(&tokens)
+	if w := serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", tokens.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("expected issued access token to work, got %d", w.Code)
+	}
+
+	// The same challenge and the same code cannot be used twice.
+	w = postJSON(VerifyLogin, "/user/login/verify", verifyLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("reused challenge: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	w = postJSON(Login, "/user/login", loginRequest{Username: "admin", Password: "admin"})
+	json.NewDecoder(w.Body).Decode(&challenge)
+	w = postJSON(VerifyLogin, "/user/login/verify", verifyLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// TestTOTPRecoveryCode verifies recovery codes work exactly once.
+func TestTOTPRecoveryCode(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	login := loginForTest(t, "admin", "admin", "go-test")
+	_, codes := enrollTOTPForTest(t, login.AccessToken)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		w := postJSON(Login, "/user/login", loginRequest{Username: "admin", Password: "admin"})
+		var challenge mfaChallengeResponse
+		json.NewDecoder(w.Body).Decode(&challenge)
+
+		w = postJSON(VerifyLogin, "/user/login/verify", verifyLoginRequest{ChallengeToken: challenge.ChallengeToken, RecoveryCode: codes[0]})
+		if w.Code != want {
+			t.Errorf("attempt %d: expected %d, got %d", i+1, want, w.Code)
+		}
+	}
+
+	w := serveAuthenticated(GetTOTPStatus, http.MethodGet, "/user/totp/status", login.AccessToken)
+	var status totpStatusResponse
+	json.NewDecoder(w.Body).Decode(&status)
+	if !status.Enabled || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+// TestTOTPPendingNotEnforced verifies an unconfirmed enrollment does not
+// change the login flow.
+func TestTOTPPendingNotEnforced(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	login := loginForTest(t, "admin", "admin", "go-test")
+	if w := serveUserRequest(t, EnrollTOTP, http.MethodPost, "/user/totp/enroll", login.AccessToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("enroll: expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if resp := loginForTest(t, "admin", "admin", "go-test"); resp.AccessToken == "" {
+		t.Errorf("expected tokens while enrollment is pending")
+	}
+}
+
+// TestDisableTOTP verifies users need their password to disable TOTP and
+// that admins can reset another user.
+func TestDisableTOTP(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "alice", "correct-horse")
+	alice := loginForTest(t, "alice", "correct-horse", "go-test")
+	enrollTOTPForTest(t, alice.AccessToken)
+
+	w := serveUserRequest(t, DisableTOTP, http.MethodPost, "/user/totp/disable", alice.AccessToken,
+		map[string]string{"password": "wrong"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("wrong password: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = serveUserRequest(t, DisableTOTP, http.MethodPost, "/user/totp/disable", alice.AccessToken,
+		map[string]string{"username": "admin"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("viewer resetting admin: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = serveUserRequest(t, DisableTOTP, http.MethodPost, "/user/totp/disable", admin.AccessToken,
+		map[string]string{"username": "alice"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin reset: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if resp := loginForTest(t, "alice", "correct-horse", "go-test"); resp.AccessToken == "" {
+		t.Errorf("expected single-step login after reset")
+	}
+}
@@ -0,0 +1,651 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Attribute names understood in the optional third field of a credentials line.
+const (
+	userFlagDisabled           = "disabled"
+	userFlagMustChangePassword = "must_change_password"
+	userAttrRole               = "role="
+	userAttrOIDC               = "oidc="
+)
+
+// minPasswordLength is the shortest password accepted when creating a user or
+// changing a password.
+const minPasswordLength = 8
+
+// passwordHashCost is the bcrypt cost used for new password hashes.  It is a
+// variable so tests can lower it.
+var passwordHashCost = bcrypt.DefaultCost
+
+// usernameRegex restricts usernames to characters that are safe in the
+// colon-separated credentials file and in log output.
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// credentialsMutex serialises read-modify-write cycles on the credentials file.
+var credentialsMutex sync.Mutex
+
+// userRecord is a single account parsed from the credentials file.
+type userRecord struct {
+	Username           string
+	PasswordHash       string
+	Role               string
+	Disabled           bool
+	MustChangePassword bool
+	// OIDCIdentity is the identity provider account linked to this one for
+	// single sign-on, as returned by oidcIdentity; empty when none is.
+	OIDCIdentity string
+}
+
+// credentialLine is one line of the credentials file.  Comment and blank lines
+// are kept verbatim (user == nil) so rewriting the file preserves them.
+type credentialLine struct {
+	raw  string
+	user *userRecord
+}
+
+// parseCredentialLine parses "username:bcrypt_hash[:attr,attr...]".
+// It returns nil for comments, blank lines and malformed entries.  Lines
+// without a role=... attribute get defaultRole.
+func parseCredentialLine(line string) *userRecord {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	// bcrypt hashes never contain ':', so a plain split is unambiguous.
+	parts := strings.SplitN(line, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return nil
+	}
+
+	user := &userRecord{Username: parts[0], PasswordHash: parts[1], Role: defaultRole}
+	if len(parts) == 3 {
+		for _, attr := range strings.Split(parts[2], ",") {
+			attr = strings.TrimSpace(attr)
+			switch {
+			case attr == userFlagDisabled:
+				user.Disabled = true
+			case attr == userFlagMustChangePassword:
+				user.MustChangePassword = true
+			case strings.HasPrefix(attr, userAttrRole):
+				user.Role = strings.TrimPrefix(attr, userAttrRole)
+			case strings.HasPrefix(attr, userAttrOIDC):
+				user.OIDCIdentity = strings.TrimPrefix(attr, userAttrOIDC)
+			}
+		}
+	}
+	return user
+}
+
+// String renders the record back into its credentials file form.
+func (u *userRecord) String() string {
+	var attrs []string
+	if u.Disabled {
+		attrs = append(attrs, userFlagDisabled)
+	}
+	if u.MustChangePassword {
+		attrs = append(attrs, userFlagMustChangePassword)
+	}
+	if u.Role != "" {
+		attrs = append(attrs, userAttrRole+u.Role)
+	}
+	if u.OIDCIdentity != "" {
+		attrs = append(attrs, userAttrOIDC+u.OIDCIdentity)
+	}
+
+	line := u.Username + ":" + u.PasswordHash
+	if len(attrs) > 0 {
+		line += ":" + strings.Join(attrs, ",")
+	}
+	return line
+}
+
+// readCredentialLines loads every line of the credentials file.
+func readCredentialLines() ([]credentialLine, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open credentials file: %w", err)
+	}
+	defer f.Close()
+
+	var lines []credentialLine
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		lines = append(lines, credentialLine{raw: raw, user: parseCredentialLine(raw)})
+	}
+	return lines, scanner.Err()
+}
+
+// writeCredentialLines atomically replaces the credentials file.
+// Callers must hold credentialsMutex.
+func writeCredentialLines(lines []credentialLine) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	for _, l := range lines {
+		if l.user != nil {
+			b.WriteString(l.user.String())
+		} else {
+			b.WriteString(l.raw)
+		}
+		b.WriteString("\n")
+	}
+	return writeFileAtomic(path, []byte(b.String()), 0600)
+}
+
+// listUsers returns every account in the credentials file sorted by name.
+func listUsers() ([]userRecord, error) {
+	lines, err := readCredentialLines()
+	if err != nil {
+		return nil, err
+	}
+	users := []userRecord{}
+	for _, l := range lines {
+		if l.user != nil {
+			users = append(users, *l.user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// lookupUser returns the account with the given name, or nil if none exists.
+func lookupUser(username string) (*userRecord, error) {
+	lines, err := readCredentialLines()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if l.user != nil && l.user.Username == username {
+			return l.user, nil
+		}
+	}
+	return nil, nil
+}
+
+// errUserNotFound is returned by updateUser when the account does not exist.
+var errUserNotFound = fmt.Errorf("user not found")
+
+// updateUser applies fn to the named account and writes the file back.
+// When fn returns remove=true the account is deleted instead.
+func updateUser(username string, fn func(u *userRecord, users []*userRecord) (remove bool, err error)) error {
+	credentialsMutex.Lock()
+	defer credentialsMutex.Unlock()
+
+	lines, err := readCredentialLines()
+	if err != nil {
+		return err
+	}
+
+	var target int = -1
+	var users []*userRecord
+	for i, l := range lines {
+		if l.user == nil {
+			continue
+		}
+		users = append(users, l.user)
+		if l.user.Username == username {
+			target = i
+		}
+	}
+	if target < 0 {
+		return errUserNotFound
+	}
+
+	remove, err := fn(lines[target].user, users)
+	if err != nil {
+		return err
+	}
+	if remove {
+		lines = append(lines[:target], lines[target+1:]...)
+	}
+	return writeCredentialLines(lines)
+}
+
+// errUserExists is returned by addUser when the username is already taken.
+var errUserExists = fmt.Errorf("user already exists")
+
+// addUser appends a new account to the credentials file.
+func addUser(user *userRecord) error {
+	credentialsMutex.Lock()
+	defer credentialsMutex.Unlock()
+
+	lines, err := readCredentialLines()
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if l.user != nil && l.user.Username == user.Username {
+			return errUserExists
+		}
+	}
+	return writeCredentialLines(append(lines, credentialLine{user: user}))
+}
+
+// isActiveAdmin reports whether u is an enabled admin account.
+func isActiveAdmin(u *userRecord) bool {
+	return !u.Disabled && u.Role == roleAdmin
+}
+
+// activeAdminCount returns how many accounts in users are enabled admins.
+func activeAdminCount(users []*userRecord) int {
+	n := 0
+	for _, u := range users {
+		if isActiveAdmin(u) {
+			n++
+		}
+	}
+	return n
+}
+
+// validatePassword returns a client-facing message if password is unacceptable.
+func validatePassword(password string) string {
+	if len(password) < minPasswordLength {
+		return fmt.Sprintf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > 72 {
+		// bcrypt silently ignores everything past 72 bytes.
+		return "password must be 72 characters or fewer"
+	}
+	return ""
+}
+
+// hashPassword returns the bcrypt hash of password.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// userResponse is the public JSON view of an account; it never includes the hash.
+type userResponse struct {
+	Username           string `json:"username"`
+	Role               string `json:"role"`
+	Disabled           bool   `json:"disabled"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+}
+
+func newUserResponse(u *userRecord) userResponse {
+	return userResponse{
+		Username:           u.Username,
+		Role:               u.Role,
+		Disabled:           u.Disabled,
+		MustChangePassword: u.MustChangePassword,
+	}
+}
+
+// createUserRequest is the JSON body accepted by CreateUser.  Role defaults
+// to viewer when omitted.
+type createUserRequest struct {
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	Role               string `json:"role,omitempty"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+}
+
+// changePasswordRequest is the JSON body accepted by ChangePassword.
+// CurrentPassword is required when changing your own password.  Username may
+// be set to reset another account, in which case that account is forced to
+// choose a new password at its next login.
+type changePasswordRequest struct {
+	Username        string `json:"username,omitempty"`
+	CurrentPassword string `json:"currentPassword,omitempty"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// usernameRequest is the JSON body used by handlers that target a single account.
+type usernameRequest struct {
+	Username string `json:"username"`
+	Disabled *bool  `json:"disabled,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// ListUsers handles GET /user/list-users.
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	users, err := listUsers()
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to read users")
+		return
+	}
+
+	resp := make([]userResponse, 0, len(users))
+	for i := range users {
+		resp = append(resp, newUserResponse(&users[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreateUser handles POST /user/create-user.
+//
+// Request body: {"username": "...", "password": "...", "role": "developer", "mustChangePassword": true}
+func CreateUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !usernameRegex.MatchString(req.Username) {
+		apierror.Respond(w, r, http.StatusBadRequest, "username must be 1-64 characters of letters, digits, '.', '_' or '-'")
+		return
+	}
+	if msg := validatePassword(req.Password); msg != "" {
+		apierror.Respond(w, r, http.StatusBadRequest, msg)
+		return
+	}
+	if req.Role == "" {
+		req.Role = roleViewer
+	}
+	if !isValidRole(req.Role) {
+		apierror.Respond(w, r, http.StatusBadRequest, "role must be one of admin, developer or viewer")
+		return
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+	user := &userRecord{
+		Username:           req.Username,
+		PasswordHash:       hash,
+		Role:               req.Role,
+		MustChangePassword: req.MustChangePassword,
+	}
+
+	if err := addUser(user); err != nil {
+		if err == errUserExists {
+			apierror.Respond(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to save user")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newUserResponse(user))
+}
+
+// SetUserDisabled handles POST /user/disable-user.
+// Disabling an account also ends all of its sessions.  Send
+// {"username": "...", "disabled": false} to re-enable an account.
+func SetUserDisabled(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req usernameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "username is required")
+		return
+	}
+	disabled := true
+	if req.Disabled != nil {
+		disabled = *req.Disabled
+	}
+
+	if caller, _ := AuthenticatedUser(r.Context()); disabled && caller == req.Username {
+		apierror.Respond(w, r, http.StatusBadRequest, "you cannot disable your own account")
+		return
+	}
+
+	var updated userRecord
+	err := updateUser(req.Username, func(u *userRecord, users []*userRecord) (bool, error) {
+		if disabled && isActiveAdmin(u) && activeAdminCount(users) <= 1 {
+			return false, errLastAdmin
+		}
+		u.Disabled = disabled
+		updated = *u
+		return false, nil
+	})
+	if !writeUserUpdateError(w, r, err) {
+		return
+	}
+
+	if disabled {
+		if err := revokeUserSessions(req.Username, ""); err != nil {
+			slog.WarnContext(r.Context(), "failed to revoke sessions", "user", req.Username, "err", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(&updated))
+}
+
+// DeleteUser handles DELETE /user/delete-user.
+//
+// Request body: {"username": "..."}
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req usernameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "username is required")
+		return
+	}
+
+	if caller, _ := AuthenticatedUser(r.Context()); caller == req.Username {
+		apierror.Respond(w, r, http.StatusBadRequest, "you cannot delete your own account")
+		return
+	}
+
+	err := updateUser(req.Username, func(u *userRecord, users []*userRecord) (bool, error) {
+		if isActiveAdmin(u) && activeAdminCount(users) <= 1 {
+			return false, errLastAdmin
+		}
+		return true, nil
+	})
+	if !writeUserUpdateError(w, r, err) {
+		return
+	}
+
+	if err := revokeUserSessions(req.Username, ""); err != nil {
+		slog.WarnContext(r.Context(), "failed to revoke sessions", "user", req.Username, "err", err)
+	}
+	// Remove the user's personal access tokens too, so they do not come back
+	// to life if an account with the same name is created later.
+	if _, err := deleteAccessTokens(func(t personalAccessToken) bool { return t.Username == req.Username }); err != nil {
+		slog.WarnContext(r.Context(), "failed to delete access tokens", "user", req.Username, "err", err)
+	}
+	if err := updateTOTPEnrollment(req.Username, func(*totpEnrollment) (*totpEnrollment, error) { return nil, nil }); err != nil {
+		slog.WarnContext(r.Context(), "failed to remove two-factor settings", "user", req.Username, "err", err)
+	}
+	if err := service_ledger.RemoveUserFromProjects(req.Username); err != nil {
+		slog.WarnContext(r.Context(), "failed to remove project memberships", "user", req.Username, "err", err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "user deleted", "username": req.Username})
+}
+
+// ChangePassword handles POST /user/change-password.
+//
+// Without a username (or with the caller's own username) the caller changes
+// their own password: currentPassword must be correct, the must-change flag is
+// cleared and every other session of the caller is ended.  With another
+// username the account's password is reset and it must be changed at the
+// next login.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, ok := authenticatedClaims(r.Context())
+	if !ok {
+		apierror.Respond(w, r, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if msg := validatePassword(req.NewPassword); msg != "" {
+		apierror.Respond(w, r, http.StatusBadRequest, msg)
+		return
+	}
+
+	target := req.Username
+	self := target == "" || target == claims.Subject
+	if self {
+		target = claims.Subject
+	} else if role, _ := AuthenticatedRole(r.Context()); !hasPermission(role, groupUsers, accessWrite) {
+		apierror.Respond(w, r, http.StatusForbidden, "insufficient permissions to reset another user's password")
+		return
+	}
+
+	hash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+
+	// The current password is guarded by the login throttle, so a stolen
+	// session cannot be used to guess it.
+	client := clientAddr(r)
+	if self {
+		wait, err := reserveLoginAttempt(target, client, time.Now())
+		if err != nil {
+			apierror.Respond(w, r, http.StatusInternalServerError, "authentication service unavailable")
+			return
+		}
+		if wait > 0 {
+			writeTooManyAttempts(w, r, wait)
+			return
+		}
+	}
+
+	err = updateUser(target, func(u *userRecord, _ []*userRecord) (bool, error) {
+		if self {
+			if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.CurrentPassword)) != nil {
+				return false, errWrongPassword
+			}
+			if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.NewPassword)) == nil {
+				return false, errPasswordUnchanged
+			}
+		}
+		u.PasswordHash = hash
+		u.MustChangePassword = !self
+		return false, nil
+	})
+	if self && err != errWrongPassword {
+		releaseLoginAttemptOrWarn(r, target, client, false)
+	}
+	if !writeUserUpdateError(w, r, err) {
+		return
+	}
+
+	// End every other session of the account so a leaked password (or the
+	// default one) cannot be used to keep an old session alive.
+	keep := ""
+	if self {
+		keep = claims.SessionID
+	}
+	if err := revokeUserSessions(target, keep); err != nil {
+		slog.WarnContext(r.Context(), "failed to revoke sessions", "user", target, "err", err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "password changed", "username": target})
+}
+
+// SetUserRole handles POST /user/set-role.
+//
+// Request body: {"username": "...", "role": "developer"}
+func SetUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req usernameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		apierror.Respond(w, r, http.StatusBadRequest, "username is required")
+		return
+	}
+	if !isValidRole(req.Role) {
+		apierror.Respond(w, r, http.StatusBadRequest, "role must be one of admin, developer or viewer")
+		return
+	}
+
+	var updated userRecord
+	err := updateUser(req.Username, func(u *userRecord, users []*userRecord) (bool, error) {
+		if req.Role != roleAdmin && isActiveAdmin(u) && activeAdminCount(users) <= 1 {
+			return false, errLastAdmin
+		}
+		u.Role = req.Role
+		updated = *u
+		return false, nil
+	})
+	if !writeUserUpdateError(w, r, err) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(&updated))
+}
+
+// Errors returned from updateUser callbacks and mapped to HTTP statuses by
+// writeUserUpdateError.
+var (
+	errLastAdmin         = fmt.Errorf("at least one active admin must remain")
+	errWrongPassword     = fmt.Errorf("current password is incorrect")
+	errPasswordUnchanged = fmt.Errorf("new password must differ from the current password")
+)
+
+// writeUserUpdateError writes the response for an updateUser error.  It
+// returns true when err is nil and the caller should continue.
+func writeUserUpdateError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case errUserNotFound:
+		apierror.Respond(w, r, http.StatusNotFound, err.Error())
+	case errLastAdmin:
+		apierror.Respond(w, r, http.StatusConflict, err.Error())
+	case errWrongPassword:
+		apierror.Respond(w, r, http.StatusForbidden, err.Error())
+	case errPasswordUnchanged:
+		apierror.Respond(w, r, http.StatusBadRequest, err.Error())
+	default:
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to update user")
+	}
+	return false
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// serveUserRequest runs handler behind RequireAuth with a JSON body.
+func serveUserRequest(t *testing.T, handler http.HandlerFunc, method, path, accessToken string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("AccessToken", accessToken)
+	w := httptest.NewRecorder()
+	RequireAuth(handler).ServeHTTP(w, req)
+	return w
+}
+
+// createUserForTest creates an account through the CreateUser handler.
+func createUserForTest(t *testing.T, adminToken, username, password string) {
+	t.Helper()
+
+	w := serveUserRequest(t, CreateUser, http.MethodPost, "/user/create-user", adminToken,
+		createUserRequest{Username: username, Password: password})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create user %s: expected %d, got %d — body: %s", username, http.StatusCreated, w.Code, w.Body.String())
+	}
+}
+
+// TestParseCredentialLine verifies the credentials line format, including flags.
+func TestParseCredentialLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want *userRecord
+	}{
+		{"# comment", nil},
+		{"", nil},
+		{"nohash", nil},
+		{"alice:$2a$10$hash", &userRecord{Username: "alice", PasswordHash: "$2a$10$hash", Role: defaultRole}},
+		{"bob:$2a$10$hash:disabled,role=viewer", &userRecord{Username: "bob", PasswordHash: "$2a$10$hash", Role: roleViewer, Disabled: true}},
+		{"admin:$2a$10$hash:must_change_password,disabled", &userRecord{Username: "admin", PasswordHash: "$2a$10$hash", Role: defaultRole, Disabled: true, MustChangePassword: true}},
+	}
+
+	for _, tt := range tests {
+		got := parseCredentialLine(tt.line)
+		if (got == nil) != (tt.want == nil) {
+			t.Errorf("parseCredentialLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			continue
+		}
+		if got != nil && *got != *tt.want {
+			t.Errorf("parseCredentialLine(%q) = %+v, want %+v", tt.line, *got, *tt.want)
+		}
+		if got != nil && parseCredentialLine(got.String()) == nil {
+			t.Errorf("round trip of %q failed", tt.line)
+		}
+	}
+}
+
+// TestCreateAndListUsers verifies that created users are persisted with a
+// bcrypt hash and can log in.
+func TestCreateAndListUsers(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "alice", "correct-horse")
+
+	w := serveUserRequest(t, ListUsers, http.MethodGet, "/user/list-users", admin.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "$2a$") {
+		t.Errorf("list response must not include password hashes: %s", w.Body.String())
+	}
+
+	var users []userResponse
+	if err := json.NewDecoder(w.Body).Decode(&users); err != nil {
+		t.Fatalf("failed to decode users: %v", err)
+	}
+	if len(users) != 2 || users[0].Username != "admin" || users[1].Username != "alice" {
+		t.Errorf("unexpected users: %+v", users)
+	}
+
+	loginForTest(t, "alice", "correct-horse", "go-test")
+
+	path, _ := credentialsPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat credentials: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected credentials mode 0600, got %o", info.Mode().Perm())
+	}
+}
+
+// TestCreateUserValidation verifies duplicate names, bad names and short
+// passwords are rejected.
+func TestCreateUserValidation(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+
+	tests := []struct {
+		name string
+		req  createUserRequest
+		want int
+	}{
+		{"duplicate", createUserRequest{Username: "admin", Password: "long-enough"}, http.StatusConflict},
+		{"colon in name", createUserRequest{Username: "a:b", Password: "long-enough"}, http.StatusBadRequest},
+		{"empty name", createUserRequest{Username: "", Password: "long-enough"}, http.StatusBadRequest},
+		{"short password", createUserRequest{Username: "carol", Password: "short"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := serveUserRequest(t, CreateUser, http.MethodPost, "/user/create-user", admin.AccessToken, tt.req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d — body: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestCreateUserPreservesComments verifies that rewriting the credentials
+// file keeps comment lines intact.
+func TestCreateUserPreservesComments(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	path, _ := credentialsPath()
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, append([]byte("# managed by opencloud\n"), data...), 0600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "alice", "correct-horse")
+
+	data, _ = os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "# managed by opencloud\n") {
+		t.Errorf("comment line was not preserved:\n%s", data)
+	}
+}
+
+// TestDisableUserBlocksLoginAndSessions verifies that disabling a user ends
+// their sessions and prevents new logins, and that re-enabling restores access.
+func TestDisableUserBlocksLoginAndSessions(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "alice", "correct-horse")
+	alice := loginForTest(t, "alice", "correct-horse", "go-test")
+
+	w := serveUserRequest(t, SetUserDisabled, http.MethodPost, "/user/disable-user", admin.AccessToken,
+		map[string]string{"username": "alice"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("disable: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", alice.AccessToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected disabled user's token to get %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	body, _ := json.Marshal(loginRequest{Username: "alice", Password: "correct-horse"})
+	req := httptest.NewRequest(http.MethodPost, "/user/login", bytes.NewBuffer(body))
+	lw := httptest.NewRecorder()
+	Login(lw, req)
+	if lw.Code != http.StatusUnauthorized {
+		t.Errorf("expected disabled user login to get %d, got %d", http.StatusUnauthorized, lw.Code)
+	}
+
+	w = serveUserRequest(t, SetUserDisabled, http.MethodPost, "/user/disable-user", admin.AccessToken,
+		map[string]any{"username": "alice", "disabled": false})
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	loginForTest(t, "alice", "correct-horse", "go-test")
+}
+
+// TestDisableOrDeleteSelfRejected verifies users cannot lock themselves out.
+func TestDisableOrDeleteSelfRejected(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+
+	w := serveUserRequest(t, SetUserDisabled, http.MethodPost, "/user/disable-user", admin.AccessToken,
+		map[string]string{"username": "admin"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("disable self: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = serveUserRequest(t, DeleteUser, http.MethodDelete, "/user/delete-user", admin.AccessToken,
+		map[string]string{"username": "admin"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("delete self: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestDeleteUser verifies that deleting a user removes it and ends its sessions.
+func TestDeleteUser(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "alice", "correct-horse")
+	alice := loginForTest(t, "alice", "correct-horse", "go-test")
+
+	w := serveUserRequest(t, DeleteUser, http.MethodDelete, "/user/delete-user", admin.AccessToken,
+		map[string]string{"username": "alice"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	user, err := lookupUser("alice")
+	if err != nil || user != nil {
+		t.Errorf("expected alice to be gone, got %+v (err %v)", user, err)
+	}
+
+	w = serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", alice.AccessToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected deleted user's token to get %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = serveUserRequest(t, DeleteUser, http.MethodDelete, "/user/delete-user", admin.AccessToken,
+		map[string]string{"username": "alice"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second delete: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestMustChangePasswordGate verifies that a flagged user can only change
+// their password, and regains full access afterwards.
+func TestMustChangePasswordGate(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	path, _ := credentialsPath()
+	data, _ := os.ReadFile(path)
+	flagged := strings.TrimSpace(string(data)) + ":" + userFlagMustChangePassword + "\n"
+	if err := os.WriteFile(path, []byte(flagged), 0600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	if !admin.MustChangePassword {
+		t.Errorf("expected login response to report must_change_password")
+	}
+
+	w := serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", admin.AccessToken)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected %d before password change, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = serveUserRequest(t, ChangePassword, http.MethodPost, "/user/change-password", admin.AccessToken,
+		changePasswordRequest{CurrentPassword: "admin", NewPassword: "a-much-better-one"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("change password: expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", admin.AccessToken)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected %d after password change, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	user, _ := lookupUser("admin")
+	if user == nil || user.MustChangePassword {
+		t.Errorf("expected must_change_password to be cleared, got %+v", user)
+	}
+}
+
+// TestChangePasswordRevokesOtherSessions verifies that a password change keeps
+// the current session but ends every other one.
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	current := loginForTest(t, "admin", "admin", "device-a")
+	other := loginForTest(t, "admin", "admin", "device-b")
+
+	w := serveUserRequest(t, ChangePassword, http.MethodPost, "/user/change-password", current.AccessToken,
+		changePasswordRequest{CurrentPassword: "wrong", NewPassword: "a-much-better-one"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("wrong current password: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = serveUserRequest(t, ChangePassword, http.MethodPost, "/user/change-password", current.AccessToken,
+		changePasswordRequest{CurrentPassword: "admin", NewPassword: "a-much-better-one"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if w := serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", current.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("expected current session to survive, got %d", w.Code)
+	}
+	if w := serveAuthenticated(protectedEcho, http.MethodGet, "/get-containers", other.AccessToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected other session to be revoked, got %d", w.Code)
+	}
+
+	loginForTest(t, "admin", "a-much-better-one", "go-test")
+}
+
+// TestResetOtherUserPassword verifies that setting another user's password
+// forces them to change it at next login.
+func TestResetOtherUserPassword(t *testing.T) {
+	cleanup := setupCredentialsFile(t, "admin", "admin")
+	defer cleanup()
+
+	admin := loginForTest(t, "admin", "admin", "go-test")
+	createUserForTest(t, admin.AccessToken, "alice", "correct-horse")
+
+	w := serveUserRequest(t, ChangePassword, http.MethodPost, "/user/change-password", admin.AccessToken,
+		changePasswordRequest{Username: "alice", NewPassword: "temporary-pass"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d — body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	alice := loginForTest(t, "alice", "temporary-pass", "go-test")
+	if !alice.MustChangePassword {
+		t.Errorf("expected reset user to be flagged must_change_password")
+	}
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// The /api/v1 tree exposes every endpoint as a resource with proper HTTP
+// methods.  Each v1 route is translated onto the legacy verb-style handler
+// that implements it, so both trees share one implementation and the same
+// authentication, RBAC and token-scope checks, which key off the legacy path.
+
+// v1Route maps one /api/v1 endpoint onto a legacy route.
+type v1Route struct {
+	// pattern is the ServeMux pattern, e.g. "GET /api/v1/pipelines/{id}".
+	pattern string
+	// legacy is the legacy method and path, optionally with a query, in
+	// which {name} placeholders are replaced by the matching path values.
+	legacy string
+	// stream replaces legacy when the client accepts text/event-stream.
+	stream string
+	// body lists JSON body fields set from path values (field -> wildcard).
+	body map[string]string
+	// slashes allows path values containing "/", for image references that
+	// are only ever passed on in the query string or body.
+	slashes bool
+	// id overrides the OpenAPI operationId taken from the legacy route, for
+	// legacy routes that more than one v1 route translates onto.
+	id string
+}
+
+// maxV1BodyBytes bounds JSON bodies that are rewritten to add path values.
+const maxV1BodyBytes = 1 << 20
+
+// v1Routes is the /api/v1 route table.
+var v1Routes = []v1Route{
+	// Authentication
+	{pattern: "POST /api/v1/auth/login", legacy: "POST /user/login"},
+	{pattern: "POST /api/v1/auth/login/verify", legacy: "POST /user/login/verify"},
+	{pattern: "POST /api/v1/auth/refresh", legacy: "GET /user/get-auth/"},
+	{pattern: "POST /api/v1/auth/logout", legacy: "POST /user/logout"},
+	{pattern: "GET /api/v1/auth/oidc", legacy: "GET /user/oidc/status"},
+	{pattern: "GET /api/v1/auth/oidc/login", legacy: "GET /user/oidc/login"},
+	{pattern: "GET /api/v1/auth/oidc/callback", legacy: "GET /user/oidc/callback"},
+
+	// The signed-in user's own account
+	{pattern: "PUT /api/v1/account/password", legacy: "POST /user/change-password"},
+	{pattern: "GET /api/v1/account/sessions", legacy: "GET /user/sessions"},
+	{pattern: "DELETE /api/v1/account/sessions/{id}", legacy: "DELETE /user/sessions/{id}"},
+	{pattern: "GET /api/v1/account/tokens", legacy: "GET /user/tokens"},
+	{pattern: "POST /api/v1/account/tokens", legacy: "POST /user/create-token"},
+	{pattern: "DELETE /api/v1/account/tokens/{id}", legacy: "DELETE /user/tokens/{id}"},
+	{pattern: "GET /api/v1/account/totp", legacy: "GET /user/totp/status"},
+	{pattern: "POST /api/v1/account/totp/enroll", legacy: "POST /user/totp/enroll"},
+	{pattern: "POST /api/v1/account/totp/confirm", legacy: "POST /user/totp/confirm"},
+	{pattern: "DELETE /api/v1/account/totp", legacy: "POST /user/totp/disable"},
+
+	// User administration
+	{pattern: "GET /api/v1/users", legacy: "GET /user/list-users"},
+	{pattern: "POST /api/v1/users", legacy: "POST /user/create-user"},
+	{pattern: "DELETE /api/v1/users/{username}", legacy: "DELETE /user/delete-user", body: map[string]string{"username": "username"}},
+	{pattern: "PUT /api/v1/users/{username}/role", legacy: "POST /user/set-role", body: map[string]string{"username": "username"}},
+	{pattern: "PUT /api/v1/users/{username}/disabled", legacy: "POST /user/disable-user", body: map[string]string{"username": "username"}},
+	{pattern: "PUT /api/v1/users/{username}/password", legacy: "POST /user/change-password", body: map[string]string{"username": "username"}, id: "resetUserPassword"},
+	{pattern: "POST /api/v1/users/{username}/unlock", legacy: "POST /user/unlock-user", body: map[string]string{"username": "username"}},
+	{pattern: "PUT /api/v1/users/{username}/sso", legacy: "POST /user/link-oidc", body: map[string]string{"username": "username"}},
+	{pattern: "DELETE /api/v1/users/{username}/totp", legacy: "POST /user/totp/disable", body: map[string]string{"username": "username"}, id: "disableUserTOTP"},
+	{pattern: "GET /api/v1/signing-keys", legacy: "GET /user/signing-keys"},
+	{pattern: "POST /api/v1/signing-keys", legacy: "POST /user/rotate-signing-key"},
+
+	// System
+	{pattern: "GET /api/v1/system/metrics", legacy: "GET /get-server-metrics"},
+	{pattern: "GET /api/v1/system/audit-log", legacy: "GET /get-audit-log"},
+	{pattern: "GET /api/v1/system/backup", legacy: "GET /backup"},
+	{pattern: "GET /api/v1/events", legacy: "GET /events"},
+
+	// Containers
+	{pattern: "GET /api/v1/containers", legacy: "GET /get-containers"},
+	{pattern: "POST /api/v1/containers", legacy: "POST /pull-and-run", stream: "POST /pull-and-run-stream"},
+	{pattern: "GET /api/v1/containers/{id}", legacy: "GET /get-container?id={id}"},
+	{pattern: "PUT /api/v1/containers/{id}", legacy: "POST /update-container", body: map[string]string{"containerId": "id"}},
+	{pattern: "DELETE /api/v1/containers/{id}", legacy: "POST /delete-container", body: map[string]string{"containerId": "id"}},
+	{pattern: "GET /api/v1/containers/{id}/logs", legacy: "GET /container-logs?id={id}"},
+	{pattern: "POST /api/v1/containers/{id}/{action}", legacy: "POST /containers/{id}/{action}"},
+
+	// Functions
+	{pattern: "GET /api/v1/functions", legacy: "GET /list-functions"},
+	{pattern: "POST /api/v1/functions", legacy: "POST /create-function"},
+	{pattern: "POST /api/v1/functions/sync", legacy: "POST /sync-functions"},
+	{pattern: "GET /api/v1/functions/{name}", legacy: "GET /get-function/{name}"},
+	{pattern: "PUT /api/v1/functions/{name}", legacy: "PUT /update-function/{name}"},
+	{pattern: "DELETE /api/v1/functions/{name}", legacy: "DELETE /delete-function?name={name}"},
+	{pattern: "POST /api/v1/functions/{name}/invoke", legacy: "POST /invoke-function?name={name}"},
+	{pattern: "GET /api/v1/functions/{name}/logs", legacy: "GET /get-function-logs/{name}"},
+
+	// Blob storage
+	{pattern: "GET /api/v1/buckets", legacy: "GET /list-blob-buckets"},
+	{pattern: "POST /api/v1/buckets", legacy: "POST /create-bucket"},
+	{pattern: "PATCH /api/v1/buckets/{name}", legacy: "PUT /rename-bucket", body: map[string]string{"currentName": "name"}},
+	{pattern: "DELETE /api/v1/buckets/{name}", legacy: "DELETE /delete-bucket", body: map[string]string{"name": "name"}},
+	{pattern: "GET /api/v1/buckets/{name}/objects", legacy: "GET /get-blobs?bucket={name}"},
+	{pattern: "POST /api/v1/buckets/{name}/objects", legacy: "POST /upload-object?bucket={name}"},
+	{pattern: "GET /api/v1/buckets/{name}/objects/{object}", legacy: "POST /download-object", body: map[string]string{"bucket": "name", "name": "object"}},
+	{pattern: "DELETE /api/v1/buckets/{name}/objects/{object}", legacy: "DELETE /delete-object", body: map[string]string{"bucket": "name", "name": "object"}},
+	{pattern: "GET /api/v1/bucket-mounts", legacy: "GET /list-container-mount-buckets"},
+
+	// Container images; {ref} is an image ID or a URL-escaped image name
+	{pattern: "GET /api/v1/images", legacy: "GET /get-images"},
+	{pattern: "POST /api/v1/images/build", legacy: "POST /build-image", stream: "POST /build-image-stream"},
+	{pattern: "POST /api/v1/images/pull", legacy: "POST /pull-image", stream: "POST /pull-image-stream"},
+	{pattern: "GET /api/v1/images/{ref}", legacy: "GET /get-image?name={ref}", slashes: true},
+	{pattern: "DELETE /api/v1/images/{ref}", legacy: "POST /delete-image", body: map[string]string{"imageName": "ref"}, slashes: true},
+	{pattern: "GET /api/v1/images/{ref}/logs", legacy: "GET /get-image-logs?name={ref}", slashes: true},
+
+	// Pipelines
+	{pattern: "GET /api/v1/pipelines", legacy: "GET /get-pipelines"},
+	{pattern: "POST /api/v1/pipelines", legacy: "POST /create-pipeline"},
+	{pattern: "POST /api/v1/pipelines/sync", legacy: "POST /sync-pipelines"},
+	{pattern: "GET /api/v1/pipelines/{id}", legacy: "GET /get-pipeline/{id}"},
+	{pattern: "PUT /api/v1/pipelines/{id}", legacy: "PUT /update-pipeline/{id}"},
+	{pattern: "DELETE /api/v1/pipelines/{id}", legacy: "DELETE /delete-pipeline/{id}"},
+	{pattern: "POST /api/v1/pipelines/{id}/run", legacy: "POST /run-pipeline/{id}"},
+	{pattern: "POST /api/v1/pipelines/{id}/stop", legacy: "POST /stop-pipeline/{id}"},
+	{pattern: "GET /api/v1/pipelines/{id}/logs", legacy: "GET /get-pipeline-logs/{id}"},
+
+	// Optional services
+	{pattern: "GET /api/v1/services/{service}", legacy: "GET /get-service-status?service={service}"},
+	{pattern: "POST /api/v1/services/{service}/enable", legacy: "POST /enable-service", stream: "POST /enable-service-stream", body: map[string]string{"service": "service"}},
+
+	// Instance settings
+	{pattern: "GET /api/v1/instance/domain", legacy: "GET /get-instance-domain"},
+	{pattern: "PUT /api/v1/instance/domain", legacy: "POST /set-instance-domain"},
+	{pattern: "GET /api/v1/instance/ssl", legacy: "GET /get-ssl-status"},
+	{pattern: "POST /api/v1/instance/ssl", legacy: "POST /configure-ssl"},
+
+	// Webhooks
+	{pattern: "GET /api/v1/webhooks", legacy: "GET /list-webhooks"},
+	{pattern: "POST /api/v1/webhooks", legacy: "POST /create-webhook"},
+	{pattern: "GET /api/v1/webhooks/{id}", legacy: "GET /get-webhook/{id}"},
+	{pattern: "PUT /api/v1/webhooks/{id}", legacy: "PUT /update-webhook/{id}"},
+	{pattern: "DELETE /api/v1/webhooks/{id}", legacy: "DELETE /delete-webhook/{id}"},
+	{pattern: "GET /api/v1/webhooks/{id}/deliveries", legacy: "GET /get-webhook-deliveries/{id}"},
+
+	// Projects
+	{pattern: "GET /api/v1/projects", legacy: "GET /list-projects"},
+	{pattern: "POST /api/v1/projects", legacy: "POST /create-project"},
+	{pattern: "GET /api/v1/projects/{name}", legacy: "GET /get-project/{name}"},
+	{pattern: "DELETE /api/v1/projects/{name}", legacy: "DELETE /delete-project/{name}"},
+	{pattern: "PUT /api/v1/projects/{name}/members/{username}", legacy: "PUT /set-project-member/{name}", body: map[string]string{"username": "username"}},
+	{pattern: "DELETE /api/v1/projects/{name}/members/{username}", legacy: "DELETE /remove-project-member/{name}", body: map[string]string{"username": "username"}},
+}
+
+// V1Handler serves the /api/v1 tree by translating each request onto the
+// legacy route that implements it and passing it to legacy, which must be
+// the authenticated legacy mux.
+func V1Handler(legacy http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range v1Routes {
+		mux.Handle(route.pattern, route.handler(legacy))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The mux answers unknown paths and wrong methods in plain text;
+		// rewrite those replies into the JSON error envelope.
+		if h, pattern := mux.Handler(r); pattern == "" {
+			h.ServeHTTP(&muxErrorWriter{ResponseWriter: w, r: r}, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// muxErrorWriter replaces a ServeMux error reply with an apierror envelope,
+// keeping headers such as Allow that the mux sets first.
+type muxErrorWriter struct {
+	http.ResponseWriter
+	r *http.Request
+}
+
+func (w *muxErrorWriter) WriteHeader(status int) {
+	apierror.Respond(w.ResponseWriter, w.r, status, strings.ToLower(http.StatusText(status)))
+}
+
+func (w *muxErrorWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+// DeprecatedAliases marks responses from the legacy verb-style routes as
+// deprecated and points clients at /api/v1.
+func DeprecatedAliases(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", `</api/v1/>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handler returns the http.Handler that translates requests for route.
+func (route v1Route) handler(legacy http.Handler) http.Handler {
+	_, pattern, _ := strings.Cut(route.pattern, " ")
+	wildcards := patternWildcards(pattern)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values := make(map[string]string, len(wildcards))
+		for _, name := range wildcards {
+			value := r.PathValue(name)
+			if !validPathValue(value, route.slashes) {
+				apierror.Respond(w, r, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+			values[name] = value
+		}
+
+		target := route.legacy
+		if route.stream != "" && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			target = route.stream
+		}
+		method, rawURL, _ := strings.Cut(target, " ")
+		path, rawQuery, _ := strings.Cut(rawURL, "?")
+
+		out := r.Clone(r.Context())
+		out.Method = method
+		out.URL.Path = substitutePathValues(path, values, func(s string) string { return s })
+		out.URL.RawPath = ""
+		out.URL.RawQuery = mergeQuery(substitutePathValues(rawQuery, values, url.QueryEscape), r.URL.Query())
+		out.RequestURI = out.URL.RequestURI()
+
+		if len(route.body) > 0 {
+			body, err := injectBodyFields(w, r, route.body, values)
+			if err != nil {
+				apierror.Respond(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			out.Body = io.NopCloser(bytes.NewReader(body))
+			out.ContentLength = int64(len(body))
+			out.Header.Set("Content-Type", "application/json")
+			out.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+
+		legacy.ServeHTTP(w, out)
+	})
+}
+
+// patternWildcards returns the {name} wildcards of a ServeMux path pattern.
+func patternWildcards(pattern string) []string {
+	var names []string
+	for _, segment := range strings.Split(pattern, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(segment[1:len(segment)-1], "..."))
+		}
+	}
+	return names
+}
+
+// validPathValue rejects values that would change the meaning of the legacy
+// path they are spliced into.
+func validPathValue(value string, slashes bool) bool {
+	if value == "" || value == "." || value == ".." || strings.ContainsAny(value, "\\\x00") {
+		return false
+	}
+	return slashes || !strings.Contains(value, "/")
+}
+
+// substitutePathValues replaces {name} placeholders in template with the
+// escaped path values.
+func substitutePathValues(template string, values map[string]string, escape func(string) string) string {
+	for name, value := range values {
+		template = strings.ReplaceAll(template, "{"+name+"}", escape(value))
+	}
+	return template
+}
+
+// mergeQuery adds the client's query parameters to the translated query.
+// Parameters taken from the path win over client-supplied ones.
+func mergeQuery(translated string, client url.Values) string {
+	query, _ := url.ParseQuery(translated)
+	for key, values := range client {
+		if _, ok := query[key]; !ok {
+			query[key] = values
+		}
+	}
+	return query.Encode()
+}
+
+// injectBodyFields adds the path values named in fields to the request's
+// JSON object body, which may be empty.  Path values win over body fields.
+func injectBodyFields(w http.ResponseWriter, r *http.Request, fields, values map[string]string) ([]byte, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxV1BodyBytes))
+	if err != nil {
+		return nil, errRequestBody
+	}
+	object := make(map[string]any)
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, errRequestBody
+		}
+	}
+	if object == nil {
+		object = make(map[string]any)
+	}
+	for field, name := range fields {
+		object[field] = values[name]
+	}
+	return json.Marshal(object)
+}
+
+// errRequestBody is returned for bodies that are not a JSON object.
+var errRequestBody = errors.New("request body must be a JSON object")
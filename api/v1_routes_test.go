@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// recordedRequest is what the fake legacy handler saw.
+type recordedRequest struct {
+	method, path, query string
+	body                map[string]any
+}
+
+// recordLegacy returns a legacy handler that records the translated request.
+func recordLegacy(t *testing.T, got *recordedRequest) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*got = recordedRequest{method: r.Method, path: r.URL.Path, query: r.URL.RawQuery}
+		data, _ := io.ReadAll(r.Body)
+		if len(data) > 0 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.Unmarshal(data, &got.body); err != nil {
+				t.Errorf("legacy handler got invalid JSON %q", data)
+			}
+		}
+		w.WriteHeader(http.StatusTeapot)
+	})
+}
+
+// TestV1Translation verifies v1 requests reach the right legacy route with
+// path values moved into the path, query or body the legacy handler expects.
+func TestV1Translation(t *testing.T) {
+	tests := []struct {
+		name                 string
+		method, target, body string
+		accept               string
+		wantMethod, wantPath string
+		wantQuery            string
+		wantBody             map[string]any
+	}{
+		{name: "list buckets", method: "GET", target: "/api/v1/buckets", wantMethod: "GET", wantPath: "/list-blob-buckets"},
+		{name: "bucket objects", method: "GET", target: "/api/v1/buckets/photos/objects", wantMethod: "GET", wantPath: "/get-blobs", wantQuery: "bucket=photos"},
+		{name: "pipeline by id", method: "GET", target: "/api/v1/pipelines/p-1", wantMethod: "GET", wantPath: "/get-pipeline/p-1"},
+		{name: "run pipeline", method: "POST", target: "/api/v1/pipelines/p-1/run", wantMethod: "POST", wantPath: "/run-pipeline/p-1"},
+		{name: "function", method: "GET", target: "/api/v1/functions/hello.py", wantMethod: "GET", wantPath: "/get-function/hello.py"},
+		{name: "invoke with escaped name", method: "POST", target: "/api/v1/functions/a%20b.js/invoke", wantMethod: "POST", wantPath: "/invoke-function", wantQuery: "name=a+b.js"},
+		{name: "container action", method: "POST", target: "/api/v1/containers/abc/start", wantMethod: "POST", wantPath: "/containers/abc/start"},
+		{name: "container logs keep client query", method: "GET", target: "/api/v1/containers/abc/logs?tail=50", wantMethod: "GET", wantPath: "/container-logs", wantQuery: "id=abc&tail=50"},
+		{name: "path value beats client query", method: "GET", target: "/api/v1/containers/abc?id=other", wantMethod: "GET", wantPath: "/get-container", wantQuery: "id=abc"},
+		{
+			name: "delete bucket without body", method: "DELETE", target: "/api/v1/buckets/photos",
+			wantMethod: "DELETE", wantPath: "/delete-bucket", wantBody: map[string]any{"name": "photos"},
+		},
+		{
+			name: "rename bucket merges body", method: "PATCH", target: "/api/v1/buckets/photos", body: `{"newName":"pics","currentName":"ignored"}`,
+			wantMethod: "PUT", wantPath: "/rename-bucket", wantBody: map[string]any{"currentName": "photos", "newName": "pics"},
+		},
+		{
+			name: "download object", method: "GET", target: "/api/v1/buckets/photos/objects/cat.png",
+			wantMethod: "POST", wantPath: "/download-object", wantBody: map[string]any{"bucket": "photos", "name": "cat.png"},
+		},
+		{
+			name: "set role", method: "PUT", target: "/api/v1/users/alice/role", body: `{"role":"viewer"}`,
+			wantMethod: "POST", wantPath: "/user/set-role", wantBody: map[string]any{"username": "alice", "role": "viewer"},
+		},
+		{
+			name: "delete image by escaped name", method: "DELETE", target: "/api/v1/images/docker.io%2Flibrary%2Fnginx:latest",
+			wantMethod: "POST", wantPath: "/delete-image", wantBody: map[string]any{"imageName": "docker.io/library/nginx:latest"},
+		},
+		{name: "image logs", method: "GET", target: "/api/v1/images/library%2Fnginx/logs", wantMethod: "GET", wantPath: "/get-image-logs", wantQuery: "name=library%2Fnginx"},
+		{name: "pull image", method: "POST", target: "/api/v1/images/pull", body: `{}`, wantMethod: "POST", wantPath: "/pull-image"},
+		{name: "pull image streaming", method: "POST", target: "/api/v1/images/pull", body: `{}`, accept: "text/event-stream", wantMethod: "POST", wantPath: "/pull-image-stream"},
+		{name: "refresh", method: "POST", target: "/api/v1/auth/refresh", wantMethod: "GET", wantPath: "/user/get-auth/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got recordedRequest
+			h := V1Handler(recordLegacy(t, &got))
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != http.StatusTeapot {
+				t.Fatalf("legacy handler not reached: status %d: %s", w.Code, w.Body.String())
+			}
+			if got.method != tt.wantMethod || got.path != tt.wantPath || got.query != tt.wantQuery {
+				t.Errorf("translated to %s %s?%s, want %s %s?%s", got.method, got.path, got.query, tt.wantMethod, tt.wantPath, tt.wantQuery)
+			}
+			if tt.wantBody != nil {
+				if len(got.body) != len(tt.wantBody) {
+					t.Errorf("body = %v, want %v", got.body, tt.wantBody)
+				}
+				for k, v := range tt.wantBody {
+					if got.body[k] != v {
+						t.Errorf("body[%q] = %v, want %v", k, got.body[k], v)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestV1RejectsBadRequests verifies unsafe path values, malformed bodies and
+// wrong methods never reach the legacy handlers.
+func TestV1RejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name, method, target, body string
+		want                       int
+	}{
+		{name: "escaped slash in id", method: "GET", target: "/api/v1/pipelines/a%2F..%2Fb", want: http.StatusBadRequest},
+		{name: "dot dot bucket", method: "GET", target: "/api/v1/buckets/%2E%2E/objects", want: http.StatusBadRequest},
+		{name: "backslash object", method: "DELETE", target: "/api/v1/buckets/b/objects/a%5Cb", want: http.StatusBadRequest},
+		{name: "body not an object", method: "PUT", target: "/api/v1/users/alice/role", body: `["viewer"]`, want: http.StatusBadRequest},
+		{name: "wrong method", method: "POST", target: "/api/v1/buckets/photos/objects/cat.png", want: http.StatusMethodNotAllowed},
+		{name: "unknown route", method: "GET", target: "/api/v1/get-containers", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := V1Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("legacy handler reached with %s %s", r.Method, r.URL)
+			}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			var body apierror.Error
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != apierror.CodeForStatus(tt.want) {
+				t.Errorf("expected JSON error envelope, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+// TestV1RoutesTargetRegisteredRoutes verifies every v1 route translates onto
+// a route that main.go registers, so a renamed legacy route cannot leave a
+// v1 endpoint dangling.
+func TestV1RoutesTargetRegisteredRoutes(t *testing.T) {
+	src, err := os.ReadFile("../main.go")
+	if err != nil {
+		t.Skipf("main.go not available: %v", err)
+	}
+	registered := make(map[string]bool)
+	for _, m := range regexp.MustCompile(`HandleFunc\("([^"]+)"`).FindAllStringSubmatch(string(src), -1) {
+		registered[m[1]] = true
+	}
+
+	isRegistered := func(path string) bool {
+		if registered[path] {
+			return true
+		}
+		for pattern := range registered {
+			if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, route := range v1Routes {
+		for _, target := range []string{route.legacy, route.stream} {
+			if target == "" {
+				continue
+			}
+			_, rawURL, _ := strings.Cut(target, " ")
+			path, _, _ := strings.Cut(rawURL, "?")
+			if !isRegistered(path) {
+				t.Errorf("%s translates to unregistered route %s", route.pattern, path)
+			}
+		}
+	}
+}
+
+// TestDeprecatedAliases verifies legacy responses advertise their successor.
+func TestDeprecatedAliases(t *testing.T) {
+	h := DeprecatedAliases(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/get-containers", nil))
+
+	if w.Header().Get("Deprecation") != "true" {
+		t.Errorf("Deprecation header = %q", w.Header().Get("Deprecation"))
+	}
+	if !strings.Contains(w.Header().Get("Link"), `rel="successor-version"`) {
+		t.Errorf("Link header = %q", w.Header().Get("Link"))
+	}
+}
@@ -0,0 +1,681 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// Webhooks POST platform events to URLs outside OpenCloud.  Subscriptions
+// live in the service ledger; every delivery attempt is appended to a
+// per-webhook log under <data dir>/logs/webhooks.
+//
+// A delivery's body is the JSON events.Event.  It carries these headers:
+//
+//	X-OpenCloud-Event      the event type, e.g. "pipeline.finished"
+//	X-OpenCloud-Delivery   an ID shared by every attempt of the delivery
+//	X-OpenCloud-Signature  "sha256=" and the hex HMAC-SHA256 of the body,
+//	                       keyed with the webhook's secret
+//
+// Any 2xx answer is a success.  Otherwise the delivery is retried with
+// exponential backoff, up to maxWebhookAttempts attempts in all.
+
+// Delivery limits.
+const (
+	maxWebhookAttempts = 5
+	// maxWebhookResponseBytes is how much of the receiver's answer is kept
+	// in the delivery log.
+	maxWebhookResponseBytes = 1024
+	// webhookQueueSize is how many events may wait for the dispatcher.
+	webhookQueueSize = 256
+)
+
+// Limits on the number of records GetWebhookDeliveries returns.
+const (
+	defaultWebhookDeliveryLimit = 100
+	maxWebhookDeliveryLimit     = 1000
+)
+
+// webhookRetryDelay is the wait before the second attempt; it doubles for
+// every attempt after that.  Tests shorten it.
+var webhookRetryDelay = 2 * time.Second
+
+// webhookClient sends deliveries.  Redirects are not followed, so a receiver
+// cannot bounce a signed delivery somewhere else.  Every connection is
+// checked by webhookDialControl, after DNS resolution, and no proxy is used
+// so the check sees the real receiver.
+var webhookClient = newWebhookClient()
+
+func newWebhookClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: webhookDialControl,
+	}).DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookAllowedNetworks are internal addresses that webhooks may deliver
+// to anyway.  It is set once at startup.
+var webhookAllowedNetworks []netip.Prefix
+
+// SetWebhookAllowedNetworks sets the loopback, private and link-local
+// addresses that webhooks may deliver to.  It must be called before the
+// server starts.
+func SetWebhookAllowedNetworks(prefixes []netip.Prefix) {
+	webhookAllowedNetworks = prefixes
+}
+
+// errWebhookAddressBlocked is returned for receivers on internal addresses,
+// which would let anyone who can create a webhook probe the host's network
+// and read the answers from the delivery log.
+var errWebhookAddressBlocked = errors.New("webhooks may not be delivered to loopback, private or link-local addresses")
+
+// webhookAddressAllowed reports whether webhooks may deliver to addr.
+func webhookAddressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range webhookAllowedNetworks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast())
+}
+
+// webhookDialControl refuses connections to addresses webhooks may not
+// deliver to.  It runs for every address a host name resolves to.
+func webhookDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !webhookAddressAllowed(addr) {
+		return errWebhookAddressBlocked
+	}
+	return nil
+}
+
+// startWebhookDelivery runs one delivery, with its retries, in the
+// background.  Tests replace it to deliver synchronously.
+var startWebhookDelivery = startBackgroundTask
+
+// webhookIDPattern matches the IDs newWebhookID generates.
+var webhookIDPattern = regexp.MustCompile(`^wh_[0-9a-f]{16}$`)
+
+// webhookDelivery is one line of a webhook's delivery log: a single attempt.
+type webhookDelivery struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"eventId"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Time       time.Time `json:"time"`
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// StartWebhookDispatcher subscribes to the event bus and delivers every
+// event to the webhooks subscribed to its type.  It is called once at
+// startup.
+func StartWebhookDispatcher() {
+	ch, _ := events.Subscribe(webhookQueueSize)
+	go func() {
+		for ev := range ch {
+			dispatchWebhooks(ev)
+		}
+	}()
+}
+
+// dispatchWebhooks starts a delivery of ev to each active webhook subscribed
+// to its type.
+func dispatchWebhooks(ev events.Event) {
+	hooks, err := service_ledger.GetAllWebhookEntries()
+	if err != nil {
+		slog.Warn("failed to read webhooks", "event_type", ev.Type, "event", ev.ID, "err", err)
+		return
+	}
+	for _, hook := range hooks {
+		if !hook.Active || !slices.Contains(hook.Events, ev.Type) {
+			continue
+		}
+		hook := hook
+		if !startWebhookDelivery(func(ctx context.Context) { deliverWebhook(ctx, hook, ev) }) {
+			slog.Warn("server is shutting down, event not delivered", "event_type", ev.Type, "event", ev.ID, "webhook", hook.ID)
+		}
+	}
+}
+
+// deliverWebhook sends ev to hook until it succeeds, the attempts run out or
+// ctx ends, logging every attempt.
+func deliverWebhook(ctx context.Context, hook service_ledger.WebhookEntry, ev events.Event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to encode event", "event_type", ev.Type, "event", ev.ID, "err", err)
+		return
+	}
+	deliveryID, err := randomHex(8)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to create a delivery ID", "webhook", hook.ID, "err", err)
+		return
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		rec := attemptWebhookDelivery(ctx, hook, body, deliveryID, ev)
+		rec.Attempt = attempt
+		if err := appendWebhookDelivery(hook.ID, rec); err != nil {
+			slog.WarnContext(ctx, "failed to log webhook delivery", "delivery", deliveryID, "webhook", hook.ID, "err", err)
+		}
+		if rec.Success || attempt == maxWebhookAttempts {
+			return
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// attemptWebhookDelivery makes one delivery attempt.
+func attemptWebhookDelivery(ctx context.Context, hook service_ledger.WebhookEntry, body []byte, deliveryID string, ev events.Event) webhookDelivery {
+	rec := webhookDelivery{ID: deliveryID, EventID: ev.ID, Event: ev.Type, Time: time.Now().UTC()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OpenCloud-Webhooks")
+	req.Header.Set("X-OpenCloud-Event", ev.Type)
+	req.Header.Set("X-OpenCloud-Delivery", deliveryID)
+	req.Header.Set("X-OpenCloud-Signature", signWebhookBody(hook.Secret, body))
+
+	started := time.Now()
+	resp, err := webhookClient.Do(req)
+	rec.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	defer resp.Body.Close()
+
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBytes))
+	rec.StatusCode = resp.StatusCode
+	rec.Response = string(answer)
+	rec.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	return rec
+}
+
+// signWebhookBody returns the X-OpenCloud-Signature header value for body.
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomHex returns n random bytes, hex-encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// webhookDeliveryMutex serialises appends to the delivery logs.
+var webhookDeliveryMutex sync.Mutex
+
+// webhookDeliveryPath returns the delivery log of a webhook.
+func webhookDeliveryPath(webhookID string) (string, error) {
+	logsDir, err := utils.SubsystemDir(utils.Logs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(logsDir, "webhooks", webhookID+".jsonl"), nil
+}
+
+// appendWebhookDelivery appends rec to the webhook's delivery log.
+func appendWebhookDelivery(webhookID string, rec webhookDelivery) error {
+	path, err := webhookDeliveryPath(webhookID)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	webhookDeliveryMutex.Lock()
+	defer webhookDeliveryMutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readWebhookDeliveries returns up to limit attempts from the webhook's
+// delivery log, newest first, skipping lines that do not parse.
+func readWebhookDeliveries(webhookID string, limit int) ([]webhookDelivery, error) {
+	path, err := webhookDeliveryPath(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []webhookDelivery{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var all []webhookDelivery
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var rec webhookDelivery
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil {
+			all = append(all, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	records := []webhookDelivery{}
+	for i := len(all) - 1; i >= 0 && len(records) < limit; i-- {
+		records = append(records, all[i])
+	}
+	return records, nil
+}
+
+// webhookRequest is the JSON body accepted by CreateWebhook.
+type webhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	// Active defaults to true.
+	Active *bool `json:"active"`
+}
+
+// updateWebhookRequest is the JSON body accepted by UpdateWebhook.  Absent
+// fields are left unchanged.
+type updateWebhookRequest struct {
+	URL          *string  `json:"url"`
+	Events       []string `json:"events"`
+	Description  *string  `json:"description"`
+	Active       *bool    `json:"active"`
+	RotateSecret bool     `json:"rotateSecret"`
+}
+
+// webhookResponse is the public view of a webhook.  Secret is only populated
+// when it was just created or rotated.
+type webhookResponse struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description,omitempty"`
+	Active      bool     `json:"active"`
+	CreatedAt   string   `json:"createdAt"`
+	Secret      string   `json:"secret,omitempty"`
+}
+
+func newWebhookResponse(hook service_ledger.WebhookEntry) webhookResponse {
+	return webhookResponse{
+		ID:          hook.ID,
+		URL:         hook.URL,
+		Events:      hook.Events,
+		Description: hook.Description,
+		Active:      hook.Active,
+		CreatedAt:   hook.CreatedAt,
+	}
+}
+
+// validateWebhookURL checks that raw is an absolute http or https URL that
+// does not name an internal address.
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	// Host names are checked when connecting, since what they resolve to
+	// can change; addresses and localhost can be refused right away.
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil && !webhookAddressAllowed(addr) {
+		return errWebhookAddressBlocked
+	}
+	host = strings.ToLower(host)
+	if (host == "localhost" || strings.HasSuffix(host, ".localhost")) && !webhookAddressAllowed(netip.MustParseAddr("127.0.0.1")) {
+		return errWebhookAddressBlocked
+	}
+	return nil
+}
+
+// normalizeWebhookEvents checks the event types and removes duplicates.
+func normalizeWebhookEvents(types []string) ([]string, error) {
+	if len(types) == 0 {
+		return nil, fmt.Errorf("at least one event is required; valid events are %s", strings.Join(events.Types, ", "))
+	}
+	var out []string
+	for _, typ := range types {
+		if !events.IsValidType(typ) {
+			return nil, fmt.Errorf("unknown event %q; valid events are %s", typ, strings.Join(events.Types, ", "))
+		}
+		if !slices.Contains(out, typ) {
+			out = append(out, typ)
+		}
+	}
+	return out, nil
+}
+
+// newWebhookSecret returns a random signing secret.
+func newWebhookSecret() (string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + secret, nil
+}
+
+// webhookIDFromPath returns the webhook ID following prefix in the request
+// path, or "" when it is not a valid ID.
+func webhookIDFromPath(r *http.Request, prefix string) string {
+	id := strings.TrimPrefix(r.URL.Path, prefix)
+	if !webhookIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+// ListWebhooks handles GET /list-webhooks.
+// It returns every webhook, oldest first, without their secrets.
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	hooks, err := service_ledger.GetAllWebhookEntries()
+	if err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to read webhooks"))
+		return
+	}
+	resp := []webhookResponse{}
+	for _, hook := range hooks {
+		resp = append(resp, newWebhookResponse(hook))
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		if resp[i].CreatedAt != resp[j].CreatedAt {
+			return resp[i].CreatedAt < resp[j].CreatedAt
+		}
+		return resp[i].ID < resp[j].ID
+	})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreateWebhook handles POST /create-webhook.
+//
+// Request body: {"url": "https://chat.example.com/hook", "events": ["pipeline.finished"], "description": "CI alerts"}
+//
+// The signing secret is returned once in the "secret" field and cannot be
+// retrieved again, only rotated.
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if err := validateWebhookURL(req.URL); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	types, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to create webhook")
+		return
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		apierror.Respond(w, r, http.StatusInternalServerError, "failed to create webhook")
+		return
+	}
+	hook := service_ledger.WebhookEntry{
+		ID:          "wh_" + id,
+		URL:         req.URL,
+		Events:      types,
+		Secret:      secret,
+		Description: strings.TrimSpace(req.Description),
+		Active:      req.Active == nil || *req.Active,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := service_ledger.UpdateWebhookEntry(hook); err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to save webhook"))
+		return
+	}
+
+	resp := newWebhookResponse(hook)
+	resp.Secret = secret
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// GetWebhook handles GET /get-webhook/{id}.
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	hook, ok := lookupWebhook(w, r, "/get-webhook/")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newWebhookResponse(*hook))
+}
+
+// UpdateWebhook handles PUT /update-webhook/{id}.
+// Fields absent from the body are left unchanged; "rotateSecret": true
+// replaces the signing secret and returns the new one.
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	hook, ok := lookupWebhook(w, r, "/update-webhook/")
+	if !ok {
+		return
+	}
+	var req updateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Respond(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.URL != nil {
+		hook.URL = strings.TrimSpace(*req.URL)
+		if err := validateWebhookURL(hook.URL); err != nil {
+			apierror.Respond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Events != nil {
+		types, err := normalizeWebhookEvents(req.Events)
+		if err != nil {
+			apierror.Respond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		hook.Events = types
+	}
+	if req.Description != nil {
+		hook.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	if req.RotateSecret {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			apierror.Respond(w, r, http.StatusInternalServerError, "failed to rotate secret")
+			return
+		}
+		hook.Secret = secret
+	}
+	if err := service_ledger.UpdateWebhookEntry(*hook); err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to save webhook"))
+		return
+	}
+
+	resp := newWebhookResponse(*hook)
+	if req.RotateSecret {
+		resp.Secret = hook.Secret
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DeleteWebhook handles DELETE /delete-webhook/{id}.
+// The webhook's delivery log is removed with it.
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	hook, ok := lookupWebhook(w, r, "/delete-webhook/")
+	if !ok {
+		return
+	}
+	if err := service_ledger.DeleteWebhookEntry(hook.ID); err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to delete webhook"))
+		return
+	}
+	if path, err := webhookDeliveryPath(hook.ID); err == nil {
+		webhookDeliveryMutex.Lock()
+		err = os.Remove(path)
+		webhookDeliveryMutex.Unlock()
+		if err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(r.Context(), "failed to remove webhook delivery log", "webhook", hook.ID, "err", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted successfully", "id": hook.ID})
+}
+
+// GetWebhookDeliveries handles GET /get-webhook-deliveries/{id}.
+// It returns the webhook's delivery attempts newest first; "limit" caps how
+// many (default 100, at most 1000).
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	hook, ok := lookupWebhook(w, r, "/get-webhook-deliveries/")
+	if !ok {
+		return
+	}
+	limit := defaultWebhookDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxWebhookDeliveryLimit {
+			apierror.Respond(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveryLimit))
+			return
+		}
+		limit = n
+	}
+
+	records, err := readWebhookDeliveries(hook.ID, limit)
+	if err != nil {
+		apierror.Write(w, r, apierror.Filesystem(err, "failed to read delivery log"))
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// lookupWebhook loads the webhook named in the path after prefix, answering
+// the request itself when there is none.
+func lookupWebhook(w http.ResponseWriter, r *http.Request, prefix string) (*service_ledger.WebhookEntry, bool) {
+	id := webhookIDFromPath(r, prefix)
+	if id == "" {
+		apierror.Respond(w, r, http.StatusNotFound, "webhook not found")
+		return nil, false
+	}
+	hook, err := service_ledger.GetWebhookEntry(id)
+	if err != nil {
+		apierror.Write(w, r, apierror.Ledger(err, "failed to read webhooks"))
+		return nil, false
+	}
+	if hook == nil {
+		apierror.Respond(w, r, http.StatusNotFound, "webhook not found")
+		return nil, false
+	}
+	return hook, true
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// useWebhookTestEnv keeps delivery logs in a temporary directory, makes
+// deliveries synchronous with short retry delays and lets them reach the
+// test receivers on loopback addresses.
+func useWebhookTestEnv(t *testing.T) {
+	t.Helper()
+	utils.SetDataDir(t.TempDir())
+	origAllowed := webhookAllowedNetworks
+	SetWebhookAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")})
+	origStart, origDelay := startWebhookDelivery, webhookRetryDelay
+	startWebhookDelivery = func(fn func(ctx context.Context)) bool {
+		fn(context.Background())
+		return true
+	}
+	webhookRetryDelay = time.Millisecond
+	t.Cleanup(func() {
+		utils.SetDataDir("")
+		webhookAllowedNetworks = origAllowed
+		startWebhookDelivery, webhookRetryDelay = origStart, origDelay
+	})
+}
+
+// createTestWebhook creates a webhook through CreateWebhook and removes it
+// from the ledger when the test ends.
+func createTestWebhook(t *testing.T, body string) webhookResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/create-webhook", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	CreateWebhook(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateWebhook: %d %s", w.Code, w.Body.String())
+	}
+	var hook webhookResponse
+	if err := json.NewDecoder(w.Body).Decode(&hook); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service_ledger.DeleteWebhookEntry(hook.ID) })
+	return hook
+}
+
+func getTestDeliveries(t *testing.T, id string) []webhookDelivery {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/get-webhook-deliveries/"+id, nil)
+	w := httptest.NewRecorder()
+	GetWebhookDeliveries(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetWebhookDeliveries: %d %s", w.Code, w.Body.String())
+	}
+	var records []webhookDelivery
+	if err := json.NewDecoder(w.Body).Decode(&records); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	useWebhookTestEnv(t)
+
+	var mu sync.Mutex
+	var gotBody []byte
+	var gotHeader http.Header
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeader = r.Header.Clone()
+	}))
+	defer receiver.Close()
+
+	hook := createTestWebhook(t, `{"url":"`+receiver.URL+`","events":["pipeline.finished","pipeline.finished"]}`)
+	if !strings.HasPrefix(hook.Secret, "whsec_") || !hook.Active {
+		t.Fatalf("created webhook = %+v", hook)
+	}
+	if len(hook.Events) != 1 {
+		t.Errorf("events = %v, want duplicates removed", hook.Events)
+	}
+
+	ev := events.NewBus().Publish(events.PipelineFinished, map[string]any{"id": "p-1", "status": "failed"})
+	dispatchWebhooks(ev)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if gotHeader == nil {
+		t.Fatal("webhook was not delivered")
+	}
+	if sig := gotHeader.Get("X-OpenCloud-Signature"); sig != signWebhookBody(hook.Secret, gotBody) {
+		t.Errorf("signature = %q, want the HMAC of the body", sig)
+	}
+	if typ := gotHeader.Get("X-OpenCloud-Event"); typ != events.PipelineFinished {
+		t.Errorf("X-OpenCloud-Event = %q", typ)
+	}
+	var delivered events.Event
+	if err := json.Unmarshal(gotBody, &delivered); err != nil || delivered.ID != ev.ID || delivered.Data["status"] != "failed" {
+		t.Errorf("delivered body %s (%v)", gotBody, err)
+	}
+
+	records := getTestDeliveries(t, hook.ID)
+	if len(records) != 1 || !records[0].Success || records[0].StatusCode != http.StatusOK || records[0].EventID != ev.ID {
+		t.Errorf("deliveries = %+v", records)
+	}
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	useWebhookTestEnv(t)
+
+	var mu sync.Mutex
+	var deliveryIDs []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		deliveryIDs = append(deliveryIDs, r.Header.Get("X-OpenCloud-Delivery"))
+		if len(deliveryIDs) < 3 {
+			http.Error(w, "try again", http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	hook := createTestWebhook(t, `{"url":"`+receiver.URL+`","events":["image.built"]}`)
+	dispatchWebhooks(events.NewBus().Publish(events.ImageBuilt, map[string]any{"imageName": "app"}))
+
+	records := getTestDeliveries(t, hook.ID)
+	if len(records) != 3 {
+		t.Fatalf("got %d delivery records, want 3: %+v", len(records), records)
+	}
+	// Newest first.
+	if !records[0].Success || records[0].Attempt != 3 {
+		t.Errorf("last attempt = %+v", records[0])
+	}
+	if records[2].Success || records[2].StatusCode != http.StatusInternalServerError || !strings.Contains(records[2].Response, "try again") {
+		t.Errorf("first attempt = %+v", records[2])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if deliveryIDs[0] == "" || deliveryIDs[0] != deliveryIDs[2] {
+		t.Errorf("delivery IDs %v differ between attempts", deliveryIDs)
+	}
+}
+
+func TestWebhookSkipsInactiveAndUnsubscribed(t *testing.T) {
+	useWebhookTestEnv(t)
+
+	var mu sync.Mutex
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	createTestWebhook(t, `{"url":"`+receiver.URL+`","events":["function.invoked"],"active":false}`)
+	createTestWebhook(t, `{"url":"`+receiver.URL+`","events":["container.stopped"]}`)
+	dispatchWebhooks(events.NewBus().Publish(events.FunctionInvoked, nil))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 0 {
+		t.Errorf("receiver called %d times, want 0", calls)
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	useWebhookTestEnv(t)
+
+	for _, body := range []string{
+		`{"url":"ftp://example.com","events":["image.built"]}`,
+		`{"url":"/relative","events":["image.built"]}`,
+		`{"url":"https://example.com","events":[]}`,
+		`{"url":"https://example.com","events":["image.deleted"]}`,
+		`not json`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/create-webhook", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		CreateWebhook(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("CreateWebhook(%s) = %d, want 400", body, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/get-webhook/../../etc", nil)
+	w := httptest.NewRecorder()
+	GetWebhook(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GetWebhook with a bad ID = %d, want 404", w.Code)
+	}
+}
+
+// TestWebhookInternalAddresses verifies webhooks cannot reach loopback,
+// private or link-local receivers unless the address is allowed.
+func TestWebhookInternalAddresses(t *testing.T) {
+	useWebhookTestEnv(t)
+
+	var hits int
+	var mu sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		io.WriteString(w, "internal secret")
+	}))
+	defer receiver.Close()
+	hook := createTestWebhook(t, `{"url":"`+receiver.URL+`","events":["image.built"]}`)
+
+	SetWebhookAllowedNetworks(nil)
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:192.168.0.1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/create-webhook", strings.NewReader(`{"url":"`+url+`","events":["image.built"]}`))
+		w := httptest.NewRecorder()
+		CreateWebhook(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("CreateWebhook(%s) = %d, want 400", url, w.Code)
+		}
+	}
+
+	// A webhook saved earlier, or a host name resolving to an internal
+	// address, is stopped when connecting.
+	dispatchWebhooks(events.NewBus().Publish(events.ImageBuilt, map[string]any{"image": "app"}))
+	mu.Lock()
+	defer mu.Unlock()
+	if hits != 0 {
+		t.Errorf("receiver on a loopback address was reached %d times", hits)
+	}
+	records := getTestDeliveries(t, hook.ID)
+	if len(records) == 0 || records[0].Success || records[0].Response != "" ||
+		!strings.Contains(records[0].Error, errWebhookAddressBlocked.Error()) {
+		t.Errorf("deliveries = %+v", records)
+	}
+}
+
+func TestWebhookSecretIsOnlyShownOnce(t *testing.T) {
+	useWebhookTestEnv(t)
+	hook := createTestWebhook(t, `{"url":"https://example.com/hook","events":["image.built"],"description":"builds"}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/get-webhook/"+hook.ID, nil)
+	w := httptest.NewRecorder()
+	GetWebhook(w, req)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "whsec_") {
+		t.Errorf("GetWebhook = %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/list-webhooks", nil)
+	w = httptest.NewRecorder()
+	ListWebhooks(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), hook.ID) || strings.Contains(w.Body.String(), "whsec_") {
+		t.Errorf("ListWebhooks = %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/update-webhook/"+hook.ID, strings.NewReader(`{"active":false,"rotateSecret":true}`))
+	w = httptest.NewRecorder()
+	UpdateWebhook(w, req)
+	var updated webhookResponse
+	if err := json.NewDecoder(w.Body).Decode(&updated); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("UpdateWebhook = %d (%v)", w.Code, err)
+	}
+	if updated.Active || updated.Secret == "" || updated.Secret == hook.Secret || updated.Description != "builds" {
+		t.Errorf("updated webhook = %+v", updated)
+	}
+}
+
+func TestDeleteWebhookRemovesDeliveryLog(t *testing.T) {
+	useWebhookTestEnv(t)
+	hook := createTestWebhook(t, `{"url":"https://example.com/hook","events":["image.built"]}`)
+	if err := appendWebhookDelivery(hook.ID, webhookDelivery{ID: "d1", Attempt: 1}); err != nil {
+		t.Fatal(err)
+	}
+	path, err := webhookDeliveryPath(hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/delete-webhook/"+hook.ID, nil)
+	w := httptest.NewRecorder()
+	DeleteWebhook(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("DeleteWebhook = %d %s", w.Code, w.Body.String())
+	}
+	if entry, err := service_ledger.GetWebhookEntry(hook.ID); err != nil || entry != nil {
+		t.Errorf("ledger entry after delete = %+v, %v", entry, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("delivery log still exists: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// writeGate is held for reading by every request that may change the
+// instance and for writing while a backup copies the instance files, so the
+// backup sees no request half done.
+var writeGate sync.RWMutex
+
+// holdWritesPoll is how often HoldWrites retries.  It is a variable so
+// tests can shorten it.
+var holdWritesPoll = 50 * time.Millisecond
+
+// isWriteMethod reports whether requests with method may change state.
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// GateWrites wraps next so requests other than GET, HEAD and OPTIONS run
+// only while no backup holds the write gate.  They wait for a backup to
+// finish copying the instance files.
+func GateWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWriteMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writeGate.RLock()
+		defer writeGate.RUnlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HoldWrites waits for the write requests in flight to finish and holds off
+// new ones until release is called.  It gives up with ctx's error when ctx
+// is done first.  Waiting requests do not block the ones still arriving, so
+// a steady stream of long writes makes HoldWrites time out rather than
+// stall the server.
+func HoldWrites(ctx context.Context) (release func(), err error) {
+	for !writeGate.TryLock() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(holdWritesPoll):
+		}
+	}
+	return writeGate.Unlock, nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHoldWritesWaitsForWrites(t *testing.T) {
+	holdWritesPoll = time.Millisecond
+	t.Cleanup(func() { holdWritesPoll = 50 * time.Millisecond })
+
+	entered, finish := make(chan struct{}), make(chan struct{})
+	handler := GateWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			close(entered)
+			<-finish
+		}
+	}))
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/create-bucket", nil))
+		close(done)
+	}()
+	<-entered
+
+	// A write in flight keeps the gate.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := HoldWrites(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("HoldWrites during a write = %v, want a timeout", err)
+	}
+
+	close(finish)
+	<-done
+	release, err := HoldWrites(context.Background())
+	if err != nil {
+		t.Fatalf("HoldWrites: %v", err)
+	}
+
+	// Reads pass while the gate is held; writes wait for release.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get-blob-buckets", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET while held = %d", w.Code)
+	}
+	written := make(chan struct{})
+	go func() {
+		GateWrites(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).
+			ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/delete-bucket", nil))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("DELETE ran while the gate was held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	<-written
+}
@@ -0,0 +1,489 @@
+// Package backup writes and restores archives of a whole OpenCloud
+// instance.  An archive is a gzip-compressed tar file holding
+//
+//	serviceLedger.json        the service ledger
+//	data/...                  the data directory: users, credentials, signing keys, cron scripts
+//	functions/...             the subsystem directories, wherever they are configured
+//	pipelines/...
+//	blob_storage/...
+//	logs/...
+//	podman/images.tar         optionally, the tagged Podman images as one image archive
+//	podman/volumes/NAME.tar   optionally, the contents of the Podman volume NAME
+//	manifest.json             the size and SHA-256 checksum of every other entry
+//
+// The manifest is written last, so an archive that was cut short fails
+// Verify.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// Version is the archive format written by Write.  Restore accepts only
+// archives of this version.
+const Version = 1
+
+// Names of the entries of an archive that are not instance files.
+const (
+	manifestName = "manifest.json"
+	ledgerName   = "serviceLedger.json"
+	imagesName   = "podman/images.tar"
+	volumesDir   = "podman/volumes"
+	dataRoot     = "data"
+)
+
+// Manifest describes an archive.  It is its last entry.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Files lists every regular file in the archive except the manifest.
+	Files []File `json:"files"`
+	// Dirs lists the directories in the archive, so empty ones such as
+	// empty buckets are restored too.
+	Dirs []string `json:"dirs"`
+	// Images names the Podman images in podman/images.tar.
+	Images []string `json:"images,omitempty"`
+	// Volumes names the Podman volumes under podman/volumes.
+	Volumes []string `json:"volumes,omitempty"`
+}
+
+// File is a file in an archive and its checksum.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Podman exports and imports the Podman state an archive can hold.  It is
+// implemented next to the container registry handlers, so this package can
+// write and verify archives without Podman.
+type Podman interface {
+	// ListImages returns the tags of the images to back up.
+	ListImages(ctx context.Context) ([]string, error)
+	// ExportImages writes the images named by tags to w as one archive.
+	ExportImages(ctx context.Context, tags []string, w io.Writer) error
+	// LoadImages loads an archive written by ExportImages.
+	LoadImages(ctx context.Context, r io.Reader) error
+	// ListVolumes returns the volumes to back up.  It leaves out the
+	// volumes of container-mount buckets, whose files are in blob storage.
+	ListVolumes(ctx context.Context) ([]string, error)
+	// ExportVolume writes the contents of a volume to w as a tar archive.
+	ExportVolume(ctx context.Context, name string, w io.Writer) error
+	// ImportVolume creates the volume if needed and unpacks r into it.
+	ImportVolume(ctx context.Context, name string, r io.Reader) error
+}
+
+// Options selects the Podman state Write adds to the ledger and the files.
+type Options struct {
+	Images  bool
+	Volumes bool
+	// Podman exports the images and volumes.  It is required when Images
+	// or Volumes is set.
+	Podman Podman
+}
+
+// root is a directory of the instance and the name of its tree in archives.
+type root struct {
+	name string
+	dir  string
+}
+
+// instanceRoots returns the data directory followed by the subsystem
+// directories.
+func instanceRoots() ([]root, error) {
+	dataDir, err := utils.DataDir()
+	if err != nil {
+		return nil, err
+	}
+	roots := []root{{name: dataRoot, dir: dataDir}}
+	for _, s := range utils.Subsystems {
+		dir, err := utils.SubsystemDir(s)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root{name: string(s), dir: dir})
+	}
+	return roots, nil
+}
+
+// Snapshot is the service ledger and the instance files an archive is
+// written from.
+type Snapshot struct {
+	createdAt time.Time
+	ledger    []byte
+	roots     []root
+	// dir holds the copies made by TakeSnapshot; it is empty when roots
+	// are the live directories.
+	dir string
+}
+
+// liveSnapshot returns a Snapshot that reads the live directories.
+func liveSnapshot() (*Snapshot, error) {
+	ledger, err := service_ledger.SnapshotServiceLedger()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service ledger: %w", err)
+	}
+	ledgerData, err := json.MarshalIndent(ledger, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	roots, err := instanceRoots()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{createdAt: time.Now().UTC(), ledger: ledgerData, roots: roots}, nil
+}
+
+// TakeSnapshot copies the service ledger and the data and subsystem
+// directories to a temporary directory, so a running server only has to
+// hold off changes while the files are copied rather than while a whole
+// archive is written and sent.  The copy needs as much space in the
+// temporary directory as the instance files take; Close removes it.
+func TakeSnapshot(ctx context.Context) (*Snapshot, error) {
+	s, err := liveSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if s.dir, err = os.MkdirTemp("", "opencloud-snapshot-*"); err != nil {
+		return nil, err
+	}
+	copies := make([]root, len(s.roots))
+	for i, rt := range s.roots {
+		copies[i] = root{name: rt.name, dir: filepath.Join(s.dir, rt.name)}
+		if err := copyTree(ctx, rt, s.roots, copies[i].dir); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to copy %s: %w", rt.dir, err)
+		}
+	}
+	s.roots = copies
+	return s, nil
+}
+
+// Close removes the copies of a snapshot taken by TakeSnapshot.
+func (s *Snapshot) Close() error {
+	if s.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// Write writes an archive of the instance to w: the service ledger, the
+// data and subsystem directories, and the Podman images and volumes opts
+// asks for.  The ledger and the lists of images and volumes are read before
+// anything is written, so an error from those leaves w untouched.
+//
+// Write reads the files as they are; a running server must hold off
+// changes meanwhile for the archive to be consistent, or write the archive
+// from a snapshot with WriteSnapshot.
+func Write(ctx context.Context, w io.Writer, opts Options) (*Manifest, error) {
+	s, err := liveSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return WriteSnapshot(ctx, w, s, opts)
+}
+
+// WriteSnapshot is like Write but takes the ledger and the files from s.
+// The Podman images and volumes are exported as they are when they are
+// written.
+func WriteSnapshot(ctx context.Context, w io.Writer, s *Snapshot, opts Options) (*Manifest, error) {
+	if (opts.Images || opts.Volumes) && opts.Podman == nil {
+		return nil, errors.New("backing up Podman images or volumes needs a Podman connection")
+	}
+	var err error
+	ledgerData, roots := s.ledger, s.roots
+
+	manifest := &Manifest{Version: Version, CreatedAt: s.createdAt, Files: []File{}, Dirs: []string{}}
+	if opts.Images {
+		if manifest.Images, err = opts.Podman.ListImages(ctx); err != nil {
+			return nil, fmt.Errorf("failed to list Podman images: %w", err)
+		}
+	}
+	if opts.Volumes {
+		if manifest.Volumes, err = opts.Podman.ListVolumes(ctx); err != nil {
+			return nil, fmt.Errorf("failed to list Podman volumes: %w", err)
+		}
+		for _, name := range manifest.Volumes {
+			if !validVolumeName(name) {
+				return nil, fmt.Errorf("cannot back up Podman volume %q: unexpected name", name)
+			}
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	a := &archiveWriter{tw: tar.NewWriter(gz), manifest: manifest}
+	if err := a.addFile(ledgerName, 0600, manifest.CreatedAt, int64(len(ledgerData)), bytes.NewReader(ledgerData)); err != nil {
+		return nil, err
+	}
+	for _, rt := range roots {
+		if err := a.addTree(ctx, rt, roots); err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", rt.dir, err)
+		}
+	}
+	if len(manifest.Images) > 0 {
+		err := a.addSpooled(imagesName, func(w io.Writer) error {
+			return opts.Podman.ExportImages(ctx, manifest.Images, w)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export Podman images: %w", err)
+		}
+	}
+	for _, name := range manifest.Volumes {
+		err := a.addSpooled(volumesDir+"/"+name+".tar", func(w io.Writer) error {
+			return opts.Podman.ExportVolume(ctx, name, w)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export Podman volume %s: %w", name, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: manifestName, Size: int64(len(data)), Mode: 0600, ModTime: manifest.CreatedAt}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := a.tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := a.tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// archiveWriter writes entries to a tar stream and lists them in the
+// manifest.
+type archiveWriter struct {
+	tw       *tar.Writer
+	manifest *Manifest
+}
+
+// addTree adds the directory tree of rt.  Directories of other roots nested
+// inside it are left to their own call, and the service ledger, which is
+// read between writes and added on its own, is left out.  A missing
+// directory adds nothing.
+func (a *archiveWriter) addTree(ctx context.Context, rt root, roots []root) error {
+	if _, err := os.Stat(rt.dir); os.IsNotExist(err) {
+		return nil
+	}
+	ledger, err := utils.LedgerPath()
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(rt.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path != rt.dir && d.IsDir() && isRootDir(path, roots) {
+			return filepath.SkipDir
+		}
+		if path == ledger {
+			return nil
+		}
+		rel, err := filepath.Rel(rt.dir, path)
+		if err != nil {
+			return err
+		}
+		name := rt.name
+		if rel != "." {
+			name += "/" + filepath.ToSlash(rel)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return a.addDir(name, info)
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return a.addFile(name, info.Mode(), info.ModTime(), info.Size(), f)
+		default:
+			slog.Warn("not backing up what is not a regular file", "path", path, "mode", info.Mode().String())
+			return nil
+		}
+	})
+}
+
+// copyTree copies the directory tree of rt to dst, keeping modes and
+// modification times, the way addTree adds it to an archive.
+func copyTree(ctx context.Context, rt root, roots []root, dst string) error {
+	if _, err := os.Stat(rt.dir); os.IsNotExist(err) {
+		return nil
+	}
+	ledger, err := utils.LedgerPath()
+	if err != nil {
+		return err
+	}
+	type dirTime struct {
+		path    string
+		modTime time.Time
+	}
+	var dirs []dirTime
+	err = filepath.WalkDir(rt.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path != rt.dir && d.IsDir() && isRootDir(path, roots) {
+			return filepath.SkipDir
+		}
+		if path == ledger {
+			return nil
+		}
+		rel, err := filepath.Rel(rt.dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTime{target, info.ModTime()})
+			return os.Chmod(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info)
+		default:
+			slog.Warn("not backing up what is not a regular file", "path", path, "mode", info.Mode().String())
+			return nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// Copying a directory's files changed its modification time.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies the first info.Size() bytes of the file src to dst; see
+// addFile.
+func copyFile(src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	n, err := io.CopyN(out, in, info.Size())
+	if errors.Is(err, io.EOF) {
+		err = fmt.Errorf("%s shrank from %d to %d bytes while it was backed up", src, info.Size(), n)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// isRootDir reports whether dir is the directory of one of roots.
+func isRootDir(dir string, roots []root) bool {
+	for _, rt := range roots {
+		if dir == rt.dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *archiveWriter) addDir(name string, info fs.FileInfo) error {
+	a.manifest.Dirs = append(a.manifest.Dirs, name)
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     int64(info.Mode().Perm()),
+		ModTime:  info.ModTime(),
+	})
+}
+
+// addFile adds the first size bytes of r as the file name.  Bytes appended
+// after the size was taken, as to a log, are left out; a file that shrank
+// fails the backup.
+func (a *archiveWriter) addFile(name string, mode fs.FileMode, modTime time.Time, size int64, r io.Reader) error {
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: int64(mode.Perm()), ModTime: modTime}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.CopyN(io.MultiWriter(a.tw, h), r, size)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s shrank from %d to %d bytes while it was backed up", name, size, n)
+	}
+	if err != nil {
+		return err
+	}
+	a.manifest.Files = append(a.manifest.Files, File{Path: name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))})
+	return nil
+}
+
+// addSpooled adds what export writes as the file name.  The output goes to
+// a temporary file first, since a tar header needs the size up front.
+func (a *archiveWriter) addSpooled(name string, export func(w io.Writer) error) error {
+	f, err := os.CreateTemp("", "opencloud-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := export(f); err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return a.addFile(name, 0600, time.Now(), size, f)
+}
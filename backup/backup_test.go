@@ -0,0 +1,366 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// useDataDirs points the data directory and blob storage at new
+// directories until the test ends.
+func useDataDirs(t *testing.T, dataDir, blobDir string) {
+	t.Helper()
+	utils.SetDataDir(dataDir)
+	utils.SetSubsystemDir(utils.BlobStorage, blobDir)
+	t.Cleanup(func() {
+		utils.SetDataDir("")
+		utils.SetSubsystemDir(utils.BlobStorage, "")
+	})
+}
+
+// fakePodman keeps images and volumes in memory.
+type fakePodman struct {
+	images  []string
+	volumes map[string]string
+	loaded  string
+}
+
+func (p *fakePodman) ListImages(ctx context.Context) ([]string, error) { return p.images, nil }
+
+func (p *fakePodman) ExportImages(ctx context.Context, tags []string, w io.Writer) error {
+	_, err := io.WriteString(w, "images:"+strings.Join(tags, ","))
+	return err
+}
+
+func (p *fakePodman) LoadImages(ctx context.Context, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	p.loaded = string(data)
+	return err
+}
+
+func (p *fakePodman) ListVolumes(ctx context.Context) ([]string, error) {
+	var names []string
+	for name := range p.volumes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (p *fakePodman) ExportVolume(ctx context.Context, name string, w io.Writer) error {
+	_, err := io.WriteString(w, p.volumes[name])
+	return err
+}
+
+func (p *fakePodman) ImportVolume(ctx context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if p.volumes == nil {
+		p.volumes = make(map[string]string)
+	}
+	p.volumes[name] = string(data)
+	return err
+}
+
+// writeTestInstance fills the data directories and the ledger with a small
+// instance and returns its archive.
+func writeTestInstance(t *testing.T, root string, podman *fakePodman) []byte {
+	t.Helper()
+	old := filepath.Join(root, "old")
+	useDataDirs(t, old, "")
+	writeTestFile(t, filepath.Join(old, "user", "credentials"), "admin:hash:role=admin\n")
+	writeTestFile(t, filepath.Join(old, "config.json"), `{"logLevel":"debug"}`)
+	writeTestFile(t, filepath.Join(old, "functions", "hello.py"), "print('hi')")
+	writeTestFile(t, filepath.Join(old, "pipelines", "build.sh"), "make")
+	writeTestFile(t, filepath.Join(old, "blob_storage", "photos", "cat.jpg"), "meow")
+	if err := os.MkdirAll(filepath.Join(old, "blob_storage", "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	catTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(old, "blob_storage", "photos", "cat.jpg"), catTime, catTime); err != nil {
+		t.Fatal(err)
+	}
+
+	ledger := service_ledger.ServiceLedger{
+		"Functions": {Enabled: true, Functions: map[string]service_ledger.FunctionEntry{
+			"hello.py": {Runtime: "python", Content: "print('hi')", Invocations: 7},
+		}},
+		"webhooks": {Enabled: true, Webhooks: map[string]service_ledger.WebhookEntry{
+			"w1": {ID: "w1", URL: "https://example.com/hook", Events: []string{"pipeline.finished"}, Active: true},
+		}},
+	}
+	if err := service_ledger.ReplaceServiceLedger(ledger); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	opts := Options{Images: podman != nil, Volumes: podman != nil}
+	if podman != nil {
+		opts.Podman = podman
+	}
+	if _, err := Write(context.Background(), &buf, opts); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteAndRestore(t *testing.T) {
+	root := t.TempDir()
+	podman := &fakePodman{images: []string{"localhost/app:1"}, volumes: map[string]string{"pgdata": "volume-tar"}}
+	archive := writeTestInstance(t, root, podman)
+
+	manifest, err := Verify(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !slices.Equal(manifest.Images, []string{"localhost/app:1"}) || !slices.Equal(manifest.Volumes, []string{"pgdata"}) {
+		t.Errorf("manifest images %v, volumes %v", manifest.Images, manifest.Volumes)
+	}
+	for _, f := range manifest.Files {
+		if strings.HasPrefix(f.Path, "data/functions/") {
+			t.Errorf("%s archived twice, under the data directory and as a subsystem", f.Path)
+		}
+		if f.Path == dataRoot+"/"+utils.LedgerFile {
+			t.Errorf("%s archived twice, under the data directory and as the ledger", f.Path)
+		}
+	}
+
+	// Restore into another layout whose data directory was already used.
+	service_ledger.ReplaceServiceLedger(service_ledger.ServiceLedger{})
+	newData, newBlobs := filepath.Join(root, "new"), filepath.Join(root, "blobs")
+	useDataDirs(t, newData, newBlobs)
+	writeTestFile(t, filepath.Join(newData, "config.json"), `{"dataDir":"new"}`)
+	writeTestFile(t, filepath.Join(newData, "user", "credentials"), "admin:default\n")
+	restored := &fakePodman{}
+
+	report, err := Restore(context.Background(), bytes.NewReader(archive), RestoreOptions{Podman: restored})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	if got := readTestFile(t, filepath.Join(newData, "user", "credentials")); got != "admin:hash:role=admin\n" {
+		t.Errorf("credentials = %q", got)
+	}
+	if got := readTestFile(t, filepath.Join(newData, "config.json")); got != `{"dataDir":"new"}` {
+		t.Errorf("config.json = %q, want the existing one kept", got)
+	}
+	if len(report.Displaced) != 1 || report.Displaced[0].From != newData {
+		t.Fatalf("displaced = %+v", report.Displaced)
+	}
+	if got := readTestFile(t, filepath.Join(report.Displaced[0].To, "user", "credentials")); got != "admin:default\n" {
+		t.Errorf("displaced credentials = %q", got)
+	}
+
+	if got := readTestFile(t, filepath.Join(newData, "functions", "hello.py")); got != "print('hi')" {
+		t.Errorf("function = %q", got)
+	}
+	cat := filepath.Join(newBlobs, "photos", "cat.jpg")
+	if got := readTestFile(t, cat); got != "meow" {
+		t.Errorf("blob = %q", got)
+	}
+	if info, err := os.Stat(cat); err != nil || !info.ModTime().Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("blob modification time = %v, %v", info, err)
+	}
+	if info, err := os.Stat(filepath.Join(newBlobs, "empty")); err != nil || !info.IsDir() {
+		t.Errorf("empty bucket not restored: %v", err)
+	}
+
+	if restored.loaded != "images:localhost/app:1" || restored.volumes["pgdata"] != "volume-tar" {
+		t.Errorf("podman got images %q, volumes %v", restored.loaded, restored.volumes)
+	}
+
+	// The ledger is the archived one, synced with the restored pipelines.
+	ledger, err := service_ledger.SnapshotServiceLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn := ledger["Functions"].Functions["hello.py"]; fn.Invocations != 7 {
+		t.Errorf("function entry = %+v", fn)
+	}
+	if hook := ledger["webhooks"].Webhooks["w1"]; hook.URL != "https://example.com/hook" {
+		t.Errorf("webhook entry = %+v", hook)
+	}
+	found := false
+	for _, p := range ledger["pipelines"].Pipelines {
+		found = found || p.Name == "build"
+	}
+	if !found {
+		t.Errorf("pipelines = %+v, want build synced from disk", ledger["pipelines"].Pipelines)
+	}
+}
+
+func TestWriteSnapshot(t *testing.T) {
+	root := t.TempDir()
+	writeTestInstance(t, root, nil)
+
+	snap, err := TakeSnapshot(context.Background())
+	if err != nil {
+		t.Fatalf("TakeSnapshot: %v", err)
+	}
+	// Changes after the snapshot do not reach the archive.
+	cat := filepath.Join(root, "old", "blob_storage", "photos", "cat.jpg")
+	writeTestFile(t, cat, "woof")
+	if err := service_ledger.ReplaceServiceLedger(service_ledger.ServiceLedger{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := WriteSnapshot(context.Background(), &buf, snap, Options{}); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	files := map[string]string{}
+	var catTime time.Time
+	_, err = scan(bytes.NewReader(buf.Bytes()), func(name string, hdr *tar.Header, body io.Reader) error {
+		if body == nil {
+			return nil
+		}
+		data, err := io.ReadAll(body)
+		files[name] = string(data)
+		if name == "blob_storage/photos/cat.jpg" {
+			catTime = hdr.ModTime
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if got := files["blob_storage/photos/cat.jpg"]; got != "meow" {
+		t.Errorf("archived blob = %q, want the snapshot's", got)
+	}
+	if !catTime.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("archived blob modification time = %v", catTime)
+	}
+	if !strings.Contains(files[ledgerName], "https://example.com/hook") {
+		t.Errorf("archived ledger = %s", files[ledgerName])
+	}
+
+	if err := snap.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(snap.dir); !os.IsNotExist(err) {
+		t.Errorf("snapshot copy left behind: %v", err)
+	}
+}
+
+func TestRestoreWithoutPodmanWarns(t *testing.T) {
+	root := t.TempDir()
+	archive := writeTestInstance(t, root, &fakePodman{images: []string{"app"}})
+	useDataDirs(t, filepath.Join(root, "new"), "")
+
+	report, err := Restore(context.Background(), bytes.NewReader(archive), RestoreOptions{})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "images") {
+		t.Errorf("warnings = %q", report.Warnings)
+	}
+}
+
+// rewrite copies archive entry by entry, replacing the data of the entries
+// edit returns true for and appending extra.
+func rewrite(t *testing.T, archive []byte, edit func(hdr *tar.Header, data []byte) ([]byte, bool), extra ...*tar.Header) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		if edited, ok := edit(hdr, data); ok {
+			data = edited
+			hdr.Size = int64(len(data))
+		}
+		if hdr.Name == manifestName {
+			for _, e := range extra {
+				tw.WriteHeader(e)
+			}
+		}
+		tw.WriteHeader(hdr)
+		tw.Write(data)
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestVerifyRejectsDamagedArchives(t *testing.T) {
+	archive := writeTestInstance(t, t.TempDir(), nil)
+	unchanged := func(*tar.Header, []byte) ([]byte, bool) { return nil, false }
+
+	for name, damaged := range map[string][]byte{
+		"truncated": archive[:len(archive)/2],
+		"not gzip":  []byte("hello"),
+		"tampered": rewrite(t, archive, func(hdr *tar.Header, data []byte) ([]byte, bool) {
+			return []byte("purr"), hdr.Name == "blob_storage/photos/cat.jpg"
+		}),
+		"unlisted entry": rewrite(t, archive, unchanged,
+			&tar.Header{Typeflag: tar.TypeDir, Name: "data/extra/", Mode: 0755}),
+		"escaping path": rewrite(t, archive, unchanged,
+			&tar.Header{Typeflag: tar.TypeDir, Name: "data/../../etc/", Mode: 0755}),
+		"symlink": rewrite(t, archive, unchanged,
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "data/passwd", Linkname: "/etc/passwd"}),
+		"future version": rewrite(t, archive, func(hdr *tar.Header, data []byte) ([]byte, bool) {
+			var m Manifest
+			json.Unmarshal(data, &m)
+			m.Version = Version + 1
+			edited, _ := json.Marshal(m)
+			return edited, hdr.Name == manifestName
+		}),
+	} {
+		if _, err := Verify(bytes.NewReader(damaged)); err == nil {
+			t.Errorf("%s archive verified", name)
+		}
+	}
+
+	// Nothing is touched when the archive does not verify.
+	newData := filepath.Join(t.TempDir(), "new")
+	useDataDirs(t, newData, "")
+	writeTestFile(t, filepath.Join(newData, "user", "credentials"), "admin:default\n")
+	if _, err := Restore(context.Background(), bytes.NewReader(archive[:len(archive)/2]), RestoreOptions{}); err == nil {
+		t.Fatal("Restore of a truncated archive succeeded")
+	}
+	if got := readTestFile(t, filepath.Join(newData, "user", "credentials")); got != "admin:default\n" {
+		t.Errorf("credentials = %q after a failed restore", got)
+	}
+}
@@ -0,0 +1,381 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// Verify reads the archive r to the end and checks it against its
+// manifest: every entry must be listed with a matching size and checksum,
+// every listed entry must be present, and the format version must be one
+// Restore understands.
+func Verify(r io.Reader) (*Manifest, error) {
+	return scan(r, nil)
+}
+
+// scan reads the archive r, passing every entry but the manifest to visit
+// if it is not nil, and checks the entries against the manifest.  visit
+// runs before the manifest is known: the archive is only known to be sound
+// once scan returns.
+func scan(r io.Reader, visit func(name string, hdr *tar.Header, body io.Reader) error) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var manifest *Manifest
+	files := make(map[string]File)
+	dirs := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("damaged archive: %w", err)
+		}
+		if manifest != nil {
+			return nil, fmt.Errorf("damaged archive: %s follows the manifest", hdr.Name)
+		}
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if name == manifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("damaged manifest: %w", err)
+			}
+			continue
+		}
+		if !validEntryName(name) {
+			return nil, fmt.Errorf("archive entry %q is not part of a backup", hdr.Name)
+		}
+		if _, dup := files[name]; dup || dirs[name] {
+			return nil, fmt.Errorf("archive entry %s appears twice", name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			dirs[name] = true
+			if visit != nil {
+				if err := visit(name, hdr, nil); err != nil {
+					return nil, err
+				}
+			}
+		case tar.TypeReg:
+			h := sha256.New()
+			body := io.TeeReader(tr, h)
+			if visit != nil {
+				if err := visit(name, hdr, body); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := io.Copy(io.Discard, body); err != nil {
+				return nil, fmt.Errorf("damaged archive: %w", err)
+			}
+			files[name] = File{Path: name, Size: hdr.Size, SHA256: hex.EncodeToString(h.Sum(nil))}
+		default:
+			return nil, fmt.Errorf("archive entry %s is neither a file nor a directory", name)
+		}
+	}
+
+	if manifest == nil {
+		return nil, errors.New("archive has no manifest; it may have been cut short")
+	}
+	if manifest.Version != Version {
+		return nil, fmt.Errorf("archive format version %d is not supported; this build reads version %d", manifest.Version, Version)
+	}
+	listed := make(map[string]bool)
+	for _, f := range manifest.Files {
+		got, ok := files[f.Path]
+		if !ok {
+			return nil, fmt.Errorf("%s is listed in the manifest but missing from the archive", f.Path)
+		}
+		if got != f {
+			return nil, fmt.Errorf("%s does not match its checksum in the manifest", f.Path)
+		}
+		listed[f.Path] = true
+	}
+	for _, d := range manifest.Dirs {
+		if !dirs[d] {
+			return nil, fmt.Errorf("directory %s is listed in the manifest but missing from the archive", d)
+		}
+		listed[d] = true
+	}
+	for name := range files {
+		if !listed[name] {
+			return nil, fmt.Errorf("%s is not listed in the manifest", name)
+		}
+	}
+	for name := range dirs {
+		if !listed[name] {
+			return nil, fmt.Errorf("directory %s is not listed in the manifest", name)
+		}
+	}
+	if !listed[ledgerName] {
+		return nil, errors.New("archive has no service ledger")
+	}
+	if len(manifest.Images) > 0 && !listed[imagesName] {
+		return nil, errors.New("archive lists Podman images but has no image archive")
+	}
+	for _, v := range manifest.Volumes {
+		if !listed[volumesDir+"/"+v+".tar"] {
+			return nil, fmt.Errorf("archive lists Podman volume %s but not its contents", v)
+		}
+	}
+	return manifest, nil
+}
+
+// validEntryName reports whether name, without a trailing slash, belongs to
+// the archive layout and cannot point outside the directories it is
+// restored into.
+func validEntryName(name string) bool {
+	if name == ledgerName || name == imagesName {
+		return true
+	}
+	if name == "" || name != path.Clean(name) || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return false
+	}
+	top, _, _ := strings.Cut(name, "/")
+	if top == dataRoot || slices.Contains(utils.Subsystems, utils.Subsystem(top)) {
+		return true
+	}
+	dir, file := path.Split(name)
+	return dir == volumesDir+"/" && strings.HasSuffix(file, ".tar") && validVolumeName(strings.TrimSuffix(file, ".tar"))
+}
+
+// validVolumeName accepts the names Podman allows for volumes.
+func validVolumeName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case i > 0 && (c == '_' || c == '.' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RestoreOptions configures Restore.
+type RestoreOptions struct {
+	// Podman loads the images and volumes of the archive.  When it is nil
+	// they are skipped with a warning.
+	Podman Podman
+}
+
+// Report describes what Restore did.
+type Report struct {
+	Manifest *Manifest
+	// Displaced lists the directories whose previous contents were moved
+	// aside, and where to.
+	Displaced []utils.DataMove
+	// Warnings lists what could not be restored, such as images Podman
+	// failed to load.  The files and the ledger were restored regardless.
+	Warnings []string
+}
+
+// Restore verifies the archive in r and, if it is sound, restores it into
+// the current data and subsystem directories, which need not be those it
+// was written from.  Their previous contents are moved aside to sibling
+// directories named <dir>.before-restore-<time> rather than deleted, except
+// for the config.json in the data directory, which stays, as the server
+// reads its settings from it.  The service ledger is replaced by the
+// archived one and synchronised with the restored functions and pipelines,
+// and the archived images and volumes are loaded into Podman.
+//
+// Crontab entries and the volumes of container-mount buckets belong to the
+// host rather than the archive; the caller re-creates them afterwards.  The
+// server must be stopped while Restore runs.
+func Restore(ctx context.Context, r io.ReadSeeker, opts RestoreOptions) (*Report, error) {
+	manifest, err := Verify(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	roots, err := instanceRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Manifest: manifest}
+	stamp := time.Now().Format("20060102-150405")
+	for _, rt := range roots {
+		move, err := displace(rt, stamp)
+		if err != nil {
+			return report, fmt.Errorf("failed to move the contents of %s aside: %w", rt.dir, err)
+		}
+		if move != nil {
+			report.Displaced = append(report.Displaced, *move)
+		}
+	}
+
+	var ledger service_ledger.ServiceLedger
+	_, err = scan(r, func(name string, hdr *tar.Header, body io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		switch {
+		case name == ledgerName:
+			if err := json.NewDecoder(body).Decode(&ledger); err != nil {
+				return fmt.Errorf("malformed service ledger: %w", err)
+			}
+			return nil
+		case name == imagesName:
+			if opts.Podman == nil {
+				report.warn("the Podman images were not loaded: Podman is not available")
+			} else if err := opts.Podman.LoadImages(ctx, body); err != nil {
+				report.warn("failed to load the Podman images: %v", err)
+			}
+			return nil
+		case strings.HasPrefix(name, volumesDir+"/"):
+			volume := strings.TrimSuffix(path.Base(name), ".tar")
+			if opts.Podman == nil {
+				report.warn("Podman volume %s was not restored: Podman is not available", volume)
+			} else if err := opts.Podman.ImportVolume(ctx, volume, body); err != nil {
+				report.warn("failed to restore Podman volume %s: %v", volume, err)
+			}
+			return nil
+		}
+
+		dst, err := destination(name, roots)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(name, dataRoot+"/") && insideSubsystemDir(dst, roots) {
+			// A leftover from before a subsystem moved out of the data
+			// directory; the subsystem's own tree is restored there.
+			return nil
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			return os.MkdirAll(dst, fs.FileMode(hdr.Mode).Perm()|0700)
+		}
+		if name == dataRoot+"/config.json" {
+			if _, err := os.Stat(dst); err == nil {
+				report.warn("kept the existing %s; the archived one was not restored", dst)
+				return nil
+			}
+		}
+		return restoreFile(dst, hdr, body)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// Rebuild the ledger: the archived one, plus whatever restored files it
+	// does not know about.
+	if ledger == nil {
+		ledger = service_ledger.ServiceLedger{}
+	}
+	if err := service_ledger.ReplaceServiceLedger(ledger); err != nil {
+		return report, fmt.Errorf("failed to write the service ledger: %w", err)
+	}
+	if err := service_ledger.SyncFunctions(); err != nil {
+		return report, fmt.Errorf("failed to sync functions into the service ledger: %w", err)
+	}
+	if err := service_ledger.SyncPipelines(); err != nil {
+		return report, fmt.Errorf("failed to sync pipelines into the service ledger: %w", err)
+	}
+	return report, nil
+}
+
+func (r *Report) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// displace moves the contents of rt.dir into a sibling directory named
+// after stamp, so the restore starts from an empty directory.  A directory
+// holding only empty directories is left as it is.
+func displace(rt root, stamp string) (*utils.DataMove, error) {
+	hasFiles, err := utils.ContainsFiles(rt.dir)
+	if err != nil || !hasFiles {
+		return nil, err
+	}
+	entries, err := os.ReadDir(rt.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	aside := rt.dir + ".before-restore-" + stamp
+	if err := os.MkdirAll(aside, 0700); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if rt.name == dataRoot && entry.Name() == "config.json" {
+			continue
+		}
+		if err := os.Rename(filepath.Join(rt.dir, entry.Name()), filepath.Join(aside, entry.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return &utils.DataMove{From: rt.dir, To: aside}, nil
+}
+
+// destination returns the path the archive entry name, under the tree of
+// one of roots, is restored to.
+func destination(name string, roots []root) (string, error) {
+	top, rest, _ := strings.Cut(name, "/")
+	for _, rt := range roots {
+		if rt.name == top {
+			return filepath.Join(rt.dir, filepath.FromSlash(rest)), nil
+		}
+	}
+	return "", fmt.Errorf("archive entry %s has no directory to be restored to", name)
+}
+
+// insideSubsystemDir reports whether path is the directory of one of the
+// subsystem roots, or inside it.
+func insideSubsystemDir(path string, roots []root) bool {
+	for _, rt := range roots {
+		if rt.name == dataRoot {
+			continue
+		}
+		rel, err := filepath.Rel(rt.dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreFile writes body to the new file dst with the mode and modification
+// time in hdr.
+func restoreFile(dst string, hdr *tar.Header, body io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fs.FileMode(hdr.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, hdr.ModTime, hdr.ModTime)
+}
@@ -0,0 +1,371 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// LoginResult is the outcome of Login.  When the account has two-factor
+// authentication enabled, MFARequired is set and the login is completed by
+// passing ChallengeToken to VerifyLogin.  The refresh token is only needed by
+// browser clients; this client renews sessions with the access token.
+type LoginResult struct {
+	AccessToken        string `json:"access_token"`
+	RefreshToken       string `json:"refresh_token"`
+	MustChangePassword bool   `json:"must_change_password,omitempty"`
+	MFARequired        bool   `json:"mfa_required,omitempty"`
+	ChallengeToken     string `json:"challenge_token,omitempty"`
+}
+
+// VerifyLoginRequest completes a two-factor login with either a TOTP code or
+// a recovery code.
+type VerifyLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code,omitempty"`
+	RecoveryCode   string `json:"recovery_code,omitempty"`
+}
+
+// Session is a login session of the signed-in user.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// AccessToken is a personal access token.  Token is only set in the response
+// to CreateAccessToken.
+type AccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// CreateAccessTokenRequest describes a new personal access token.
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays,omitempty"`
+}
+
+// TOTPStatus reports the signed-in user's two-factor authentication state.
+type TOTPStatus struct {
+	Enabled                bool `json:"enabled"`
+	Pending                bool `json:"pending"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+// TOTPEnrollment is the secret of a pending two-factor enrollment.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+// TOTPConfirmation is returned when an enrollment is confirmed.  The recovery
+// codes are shown only once.
+type TOTPConfirmation struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// User is a user account.
+type User struct {
+	Username           string `json:"username"`
+	Role               string `json:"role"`
+	Disabled           bool   `json:"disabled"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+}
+
+// CreateUserRequest describes a new user account.  Role defaults to the
+// server's default role.
+type CreateUserRequest struct {
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	Role               string `json:"role,omitempty"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+}
+
+// SigningKey describes a token signing key.  Secrets are never returned.
+type SigningKey struct {
+	ID        string     `json:"id"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// SigningKeyRotation is the result of RotateSigningKey.
+type SigningKeyRotation struct {
+	ActiveKeyID string `json:"activeKeyId"`
+	GracePeriod string `json:"gracePeriod"`
+}
+
+// Login signs in with a username and password.  On success the client uses
+// the new session for later calls; when two-factor authentication is
+// required, call VerifyLogin with the returned challenge.
+func (c *Client) Login(ctx context.Context, username, password string) (*LoginResult, error) {
+	req, err := jsonRequest(http.MethodPost, "/auth/login", map[string]string{"username": username, "password": password})
+	if err != nil {
+		return nil, err
+	}
+	req.public = true
+	var res LoginResult
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	if !res.MFARequired {
+		c.setAccessToken(res.AccessToken)
+	}
+	return &res, nil
+}
+
+// VerifyLogin completes a two-factor login and uses the new session for
+// later calls.
+func (c *Client) VerifyLogin(ctx context.Context, in VerifyLoginRequest) (*LoginResult, error) {
+	req, err := jsonRequest(http.MethodPost, "/auth/login/verify", in)
+	if err != nil {
+		return nil, err
+	}
+	req.public = true
+	var res LoginResult
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	c.setAccessToken(res.AccessToken)
+	return &res, nil
+}
+
+// Refresh renews the session access token.  The server accepts the current
+// token even after it has expired, as long as its session is still active.
+// Requests refresh automatically; calling it directly is only needed to
+// renew a token ahead of time.
+func (c *Client) Refresh(ctx context.Context) error {
+	if _, ok := c.sessionToken(); !ok {
+		return errors.New("client has no login session to refresh")
+	}
+	httpReq, err := c.newHTTPRequest(ctx, request{method: http.MethodPost, path: "/auth/refresh"})
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	var res struct {
+		NewAccessToken string `json:"new_access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("decoding refresh response: %w", err)
+	}
+	c.setAccessToken(res.NewAccessToken)
+	if c.onRefresh != nil {
+		c.onRefresh(res.NewAccessToken)
+	}
+	return nil
+}
+
+// Logout ends the current session and forgets its tokens.
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.call(ctx, http.MethodPost, "/auth/logout", nil, nil, nil); err != nil {
+		return err
+	}
+	c.setAccessToken("")
+	return nil
+}
+
+// ChangePassword changes the signed-in user's password.
+func (c *Client) ChangePassword(ctx context.Context, currentPassword, newPassword string) error {
+	in := map[string]string{"currentPassword": currentPassword, "newPassword": newPassword}
+	return c.call(ctx, http.MethodPut, "/account/password", nil, in, nil)
+}
+
+// ListSessions lists the signed-in user's login sessions.
+func (c *Client) ListSessions(ctx context.Context) ([]Session, error) {
+	var out []Session
+	err := c.call(ctx, http.MethodGet, "/account/sessions", nil, nil, &out)
+	return out, err
+}
+
+// RevokeSession ends one of the signed-in user's sessions.
+func (c *Client) RevokeSession(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/account/sessions/"+pathEscape(id), nil, nil, nil)
+}
+
+// ListAccessTokens lists the signed-in user's personal access tokens.
+func (c *Client) ListAccessTokens(ctx context.Context) ([]AccessToken, error) {
+	var out []AccessToken
+	err := c.call(ctx, http.MethodGet, "/account/tokens", nil, nil, &out)
+	return out, err
+}
+
+// CreateAccessToken creates a personal access token.
+func (c *Client) CreateAccessToken(ctx context.Context, in CreateAccessTokenRequest) (*AccessToken, error) {
+	var out AccessToken
+	if err := c.call(ctx, http.MethodPost, "/account/tokens", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeAccessToken revokes one of the signed-in user's personal access tokens.
+func (c *Client) RevokeAccessToken(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/account/tokens/"+pathEscape(id), nil, nil, nil)
+}
+
+// GetTOTPStatus reports the signed-in user's two-factor authentication state.
+func (c *Client) GetTOTPStatus(ctx context.Context) (*TOTPStatus, error) {
+	var out TOTPStatus
+	if err := c.call(ctx, http.MethodGet, "/account/totp", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnrollTOTP starts two-factor enrollment for the signed-in user.
+func (c *Client) EnrollTOTP(ctx context.Context) (*TOTPEnrollment, error) {
+	var out TOTPEnrollment
+	if err := c.call(ctx, http.MethodPost, "/account/totp/enroll", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConfirmTOTP enables two-factor authentication with a code from the
+// authenticator app.
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) (*TOTPConfirmation, error) {
+	var out TOTPConfirmation
+	if err := c.call(ctx, http.MethodPost, "/account/totp/confirm", nil, map[string]string{"code": code}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DisableTOTP turns off the signed-in user's two-factor authentication.
+func (c *Client) DisableTOTP(ctx context.Context, password string) error {
+	return c.call(ctx, http.MethodDelete, "/account/totp", nil, map[string]string{"password": password}, nil)
+}
+
+// ListUsers lists all user accounts.
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	var out []User
+	err := c.call(ctx, http.MethodGet, "/users", nil, nil, &out)
+	return out, err
+}
+
+// CreateUser creates a user account.
+func (c *Client) CreateUser(ctx context.Context, in CreateUserRequest) (*User, error) {
+	var out User
+	if err := c.call(ctx, http.MethodPost, "/users", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteUser deletes a user account.
+func (c *Client) DeleteUser(ctx context.Context, username string) error {
+	return c.call(ctx, http.MethodDelete, "/users/"+pathEscape(username), nil, nil, nil)
+}
+
+// SetUserRole changes a user's role.
+func (c *Client) SetUserRole(ctx context.Context, username, role string) (*User, error) {
+	var out User
+	if err := c.call(ctx, http.MethodPut, "/users/"+pathEscape(username)+"/role", nil, map[string]string{"role": role}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetUserDisabled disables or re-enables a user account.
+func (c *Client) SetUserDisabled(ctx context.Context, username string, disabled bool) (*User, error) {
+	var out User
+	if err := c.call(ctx, http.MethodPut, "/users/"+pathEscape(username)+"/disabled", nil, map[string]bool{"disabled": disabled}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LinkUserSSO links a user to the identity provider account with the given
+// "sub" claim, so its owner can sign in with single sign-on.  An empty
+// subject unlinks the user.
+func (c *Client) LinkUserSSO(ctx context.Context, username, subject string) (*User, error) {
+	var out User
+	if err := c.call(ctx, http.MethodPut, "/users/"+pathEscape(username)+"/sso", nil, map[string]string{"subject": subject}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResetUserPassword sets another user's password and makes them choose a
+// new one at their next login.
+func (c *Client) ResetUserPassword(ctx context.Context, username, newPassword string) error {
+	return c.call(ctx, http.MethodPut, "/users/"+pathEscape(username)+"/password", nil, map[string]string{"newPassword": newPassword}, nil)
+}
+
+// UnlockUser clears a user's failed login lockout.
+func (c *Client) UnlockUser(ctx context.Context, username string) error {
+	return c.call(ctx, http.MethodPost, "/users/"+pathEscape(username)+"/unlock", nil, nil, nil)
+}
+
+// ResetUserTOTP turns off another user's two-factor authentication.
+func (c *Client) ResetUserTOTP(ctx context.Context, username string) error {
+	return c.call(ctx, http.MethodDelete, "/users/"+pathEscape(username)+"/totp", nil, nil, nil)
+}
+
+// ListSigningKeys lists the token signing keys, newest first.
+func (c *Client) ListSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	var out []SigningKey
+	err := c.call(ctx, http.MethodGet, "/signing-keys", nil, nil, &out)
+	return out, err
+}
+
+// RotateSigningKey starts signing tokens with a new key.  The old key keeps
+// verifying tokens for gracePeriod, or the server default when it is zero.
+func (c *Client) RotateSigningKey(ctx context.Context, gracePeriod time.Duration) (*SigningKeyRotation, error) {
+	in := map[string]string{}
+	if gracePeriod > 0 {
+		in["gracePeriod"] = gracePeriod.String()
+	}
+	var out SigningKeyRotation
+	if err := c.call(ctx, http.MethodPost, "/signing-keys", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// OIDCEnabled reports whether single sign-on is configured.
+func (c *Client) OIDCEnabled(ctx context.Context) (bool, error) {
+	req := request{method: http.MethodGet, path: "/auth/oidc", public: true, replayable: true}
+	var out struct {
+		Enabled bool `json:"enabled"`
+	}
+	err := c.do(ctx, req, &out)
+	return out.Enabled, err
+}
+
+// queryOf returns query values for the non-empty pairs in kv.
+func queryOf(kv ...string) url.Values {
+	q := url.Values{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			q.Set(kv[i], kv[i+1])
+		}
+	}
+	return q
+}
@@ -0,0 +1,409 @@
+// Package client is a Go client for the OpenCloud API.
+//
+// It talks to the resource-oriented /api/v1 endpoints and reuses the request
+// and response types of the packages that implement them, so a field added to
+// a handler's struct is picked up here as well.  Failed calls return an
+// *apierror.Error carrying the HTTP status, the stable error code and the
+// request ID of the server's error envelope.
+//
+// A client authenticates either with a personal access token or with a login
+// session started by Login (see WithAccessToken).  Session access tokens are
+// short-lived; the client renews them through the refresh endpoint, the
+// legacy /user/get-auth/, when they expire and retries a rejected request
+// once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/listing"
+)
+
+// personalTokenPrefix marks personal access tokens, which are sent as bearer
+// tokens and never refreshed.
+const personalTokenPrefix = "ocp_"
+
+// Client calls the OpenCloud API.  It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	userAgent  string
+	onRefresh  func(accessToken string)
+
+	mu          sync.Mutex
+	accessToken string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient makes the client send requests through hc instead of
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithAccessToken authenticates with token, which is either a personal access
+// token or the access token of a login session, e.g. one saved from an
+// earlier Login.
+func WithAccessToken(token string) Option {
+	return func(c *Client) { c.accessToken = token }
+}
+
+// WithUserAgent sets the User-Agent header, which the server records on
+// login sessions.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// OnTokenRefresh registers f to be called with every new session access
+// token, so callers can persist it.
+func OnTokenRefresh(f func(accessToken string)) Option {
+	return func(c *Client) { c.onRefresh = f }
+}
+
+// New returns a client for the server at baseURL, e.g. "http://localhost:3030".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	c := &Client{baseURL: u, httpClient: http.DefaultClient, userAgent: "opencloud-go-client"}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// AccessToken returns the token the client authenticates with, which
+// changes whenever a session token is refreshed.
+func (c *Client) AccessToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accessToken
+}
+
+// setAccessToken replaces the token the client authenticates with.
+func (c *Client) setAccessToken(token string) {
+	c.mu.Lock()
+	c.accessToken = token
+	c.mu.Unlock()
+}
+
+// sessionToken returns the access token when it belongs to a login session
+// and can therefore be refreshed.
+func (c *Client) sessionToken() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accessToken, c.accessToken != "" && !strings.HasPrefix(c.accessToken, personalTokenPrefix)
+}
+
+// tokenExpired reports whether a session access token's expiry has passed.
+// The claims are only read, never trusted; the server does the checking.
+func tokenExpired(token string, now time.Time) bool {
+	payload, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if json.Unmarshal(data, &claims) != nil || claims.ExpiresAt == 0 {
+		return false
+	}
+	return now.Unix() > claims.ExpiresAt
+}
+
+// idempotencyKeyContextKey is the context key of WithIdempotencyKey.
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a copy of ctx under which POST requests carry
+// key as their Idempotency-Key header.  The server runs a creating request,
+// such as CreateFunction or RunContainer, once per key and replays its
+// response to retries, so a call that failed with a network error can be
+// repeated with the same key without creating a second resource.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// projectContextKey is the context key of WithProject.
+type projectContextKey struct{}
+
+// WithProject returns a copy of ctx under which requests work in the named
+// project instead of the default one: functions, containers, buckets and
+// pipelines are listed, created and changed in that project only.
+func WithProject(ctx context.Context, project string) context.Context {
+	return context.WithValue(ctx, projectContextKey{}, project)
+}
+
+// request describes one API call.
+type request struct {
+	method string
+	path   string // relative to /api/v1
+	query  url.Values
+	accept string
+
+	// body returns a fresh request body for every attempt; nil for none.
+	body        func() io.Reader
+	contentType string
+	// replayable is false for bodies that can only be read once, which
+	// are therefore never retried after a token refresh.
+	replayable bool
+	// public requests are sent without credentials.
+	public bool
+}
+
+// jsonRequest returns a request with v encoded as its JSON body.
+func jsonRequest(method, path string, v any) (request, error) {
+	req := request{method: method, path: path, replayable: true}
+	if v == nil {
+		return req, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return req, err
+	}
+	req.body = func() io.Reader { return bytes.NewReader(data) }
+	req.contentType = "application/json"
+	return req, nil
+}
+
+// send performs req and returns the response of a successful call; error
+// responses are returned as *apierror.Error.  An expired session access
+// token is refreshed first, and a request rejected with 401 is retried once
+// after a refresh.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	if token, ok := c.sessionToken(); ok && !req.public && tokenExpired(token, time.Now()) {
+		if err := c.Refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := c.newHTTPRequest(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		apiErr := decodeError(resp)
+		resp.Body.Close()
+		_, refreshable := c.sessionToken()
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 && refreshable && req.replayable && !req.public {
+			if err := c.Refresh(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return nil, apiErr
+	}
+}
+
+// newHTTPRequest builds the http.Request for one attempt at req.
+func (c *Client) newHTTPRequest(ctx context.Context, req request) (*http.Request, error) {
+	// req.path is already escaped, so path values such as image references
+	// containing "/" reach the server as one segment.
+	u := *c.baseURL
+	u.RawPath = strings.TrimRight(c.baseURL.EscapedPath(), "/") + "/api/v1" + req.path
+	path, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	query := req.query
+	if project, ok := ctx.Value(projectContextKey{}).(string); ok && project != "" {
+		query = url.Values{}
+		for name, values := range req.query {
+			query[name] = values
+		}
+		query.Set("project", project)
+	}
+	u.RawQuery = query.Encode()
+
+	var body io.Reader
+	if req.body != nil {
+		body = req.body()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	accept := req.accept
+	if accept == "" {
+		accept = "application/json"
+	}
+	httpReq.Header.Set("Accept", accept)
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if key, ok := ctx.Value(idempotencyKeyContextKey{}).(string); ok && key != "" && req.method == http.MethodPost {
+		httpReq.Header.Set("Idempotency-Key", key)
+	}
+
+	if !req.public {
+		switch token := c.AccessToken(); {
+		case token == "":
+		case strings.HasPrefix(token, personalTokenPrefix):
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		default:
+			httpReq.Header.Set("AccessToken", token)
+		}
+	}
+	return httpReq, nil
+}
+
+// decodeError turns an error response into an *apierror.Error.  Responses
+// that are not the JSON envelope, e.g. from a proxy, keep their text as the
+// message.
+func decodeError(resp *http.Response) *apierror.Error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	apiErr := &apierror.Error{}
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+		message := strings.TrimSpace(string(data))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		apiErr = apierror.New(resp.StatusCode, message)
+	}
+	apiErr.Status = resp.StatusCode
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get(apierror.RequestIDHeader)
+	}
+	return apiErr
+}
+
+// call sends a JSON request and decodes the JSON response into out, which
+// may be nil.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	req, err := jsonRequest(method, path, in)
+	if err != nil {
+		return err
+	}
+	req.query = query
+	return c.do(ctx, req, out)
+}
+
+// do sends req and decodes the JSON response into out, which may be nil.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// ListOptions selects one page of a list and how the list is sorted and
+// filtered.  Zero fields use the server's defaults, so the zero value lists
+// every item.
+type ListOptions struct {
+	// Limit is the page size, at most 1000.
+	Limit int
+	// Cursor is the next cursor returned with the previous page.
+	Cursor string
+	// Sort is a field of the endpoint, prefixed with "-" for descending
+	// order, e.g. "-created".
+	Sort string
+	// Filters holds the endpoint's filters, e.g. {"state": {"running"},
+	// "label": {"app=web"}}.  Every value must match.
+	Filters url.Values
+}
+
+// query returns the query parameters for o.
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	for name, values := range o.Filters {
+		q[name] = append(q[name], values...)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	return q
+}
+
+// listPage fetches the page of the list at path that opts selects and
+// returns it with the cursor of the next page, or "" on the last page.
+func listPage[T any](ctx context.Context, c *Client, path string, opts ListOptions) ([]T, string, error) {
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: path, query: opts.query(), replayable: true})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	var out []T
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, "", fmt.Errorf("decoding GET %s response: %w", path, err)
+	}
+	return out, resp.Header.Get(listing.NextCursorHeader), nil
+}
+
+// text sends a request for a plain-text resource and returns it.
+func (c *Client) text(ctx context.Context, path string, query url.Values) (string, error) {
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: path, query: query, accept: "text/plain", replayable: true})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+// pathEscape escapes a path value, including any "/".
+func pathEscape(s string) string {
+	return url.PathEscape(s)
+}
+
+// IsStatus reports whether err is an API error with the given HTTP status.
+func IsStatus(err error, status int) bool {
+	var apiErr *apierror.Error
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+// Result is the outcome of an operation without a more specific response:
+// "status" and "message", plus the name or ID of the affected resource under
+// a key such as "imageName" or "containerId".
+type Result map[string]string
+
+// Message is the confirmation returned by some endpoints.
+type Message struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,548 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/storage"
+	"github.com/WavexSoftware/OpenCloud/backup"
+	"github.com/WavexSoftware/OpenCloud/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testAdmin    = "admin"
+	testPassword = "correct horse battery"
+)
+
+// newTestServer serves the real handlers the tests exercise the way main.go
+// does, with a data directory holding a single admin account.  wrap, when
+// not nil, wraps the whole server.
+func newTestServer(t *testing.T, wrap func(http.Handler) http.Handler) *httptest.Server {
+	t.Helper()
+
+	dataDir := t.TempDir()
+	utils.SetDataDir(dataDir)
+	t.Cleanup(func() { utils.SetDataDir("") })
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userDir := filepath.Join(dataDir, "user")
+	if err := os.MkdirAll(userDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	line := testAdmin + ":" + string(hash) + ":role=admin\n"
+	if err := os.WriteFile(filepath.Join(userDir, "credentials"), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/login", opencloudapi.Login)
+	mux.HandleFunc("/user/get-auth/", opencloudapi.RefreshAuth)
+	mux.HandleFunc("/user/logout", opencloudapi.Logout)
+	mux.HandleFunc("/user/sessions", opencloudapi.ListSessions)
+	mux.HandleFunc("/user/list-users", opencloudapi.ListUsers)
+	mux.HandleFunc("/user/create-user", opencloudapi.CreateUser)
+	mux.HandleFunc("/user/delete-user", opencloudapi.DeleteUser)
+	mux.HandleFunc("/user/set-role", opencloudapi.SetUserRole)
+	mux.HandleFunc("/user/create-token", opencloudapi.CreateAccessToken)
+	mux.HandleFunc("/user/tokens", opencloudapi.ListAccessTokens)
+	mux.HandleFunc("/get-audit-log", opencloudapi.GetAuditLog)
+	mux.HandleFunc("/backup", storage.GetBackup)
+	mux.HandleFunc("/build-image-stream", storage.BuildImageStream)
+	mux.HandleFunc("/get-pipelines", opencloudapi.GetPipelines)
+	mux.HandleFunc("/list-projects", opencloudapi.ListProjects)
+	mux.HandleFunc("/create-project", opencloudapi.CreateProject)
+	mux.HandleFunc("/get-project/", opencloudapi.GetProject)
+	mux.HandleFunc("/delete-project/", opencloudapi.DeleteProject)
+	mux.HandleFunc("/set-project-member/", opencloudapi.SetProjectMember)
+	mux.HandleFunc("/remove-project-member/", opencloudapi.RemoveProjectMember)
+	legacy := opencloudapi.Audit(opencloudapi.RequireAuth(opencloudapi.GateWrites(opencloudapi.Idempotent(mux))))
+
+	root := http.NewServeMux()
+	root.Handle("/api/v1/", opencloudapi.V1Handler(legacy))
+	var handler http.Handler = apierror.WithRequestID(root)
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// login returns a client signed in as the test admin.
+func login(t *testing.T, srv *httptest.Server, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(srv.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Login(context.Background(), testAdmin, testPassword)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if res.AccessToken == "" || c.AccessToken() != res.AccessToken {
+		t.Fatalf("Login did not start a session: %+v", res)
+	}
+	return c
+}
+
+func TestLoginAndManageUsers(t *testing.T) {
+	srv := newTestServer(t, nil)
+	ctx := context.Background()
+	c := login(t, srv)
+
+	user, err := c.CreateUser(ctx, CreateUserRequest{Username: "bob", Password: "bobs password", Role: "viewer"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if user.Username != "bob" || user.Role != "viewer" {
+		t.Errorf("CreateUser = %+v", user)
+	}
+
+	if user, err = c.SetUserRole(ctx, "bob", "developer"); err != nil || user.Role != "developer" {
+		t.Errorf("SetUserRole = %+v, %v", user, err)
+	}
+
+	users, err := c.ListUsers(ctx)
+	if err != nil || len(users) != 2 {
+		t.Fatalf("ListUsers = %+v, %v", users, err)
+	}
+
+	if err := c.DeleteUser(ctx, "bob"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	records, err := c.AuditLog(ctx, AuditQuery{Resource: "user"})
+	if err != nil {
+		t.Fatalf("AuditLog: %v", err)
+	}
+	if len(records) != 3 || records[0].Target != "bob" || records[0].User != testAdmin {
+		t.Errorf("AuditLog = %+v", records)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if c.AccessToken() != "" {
+		t.Errorf("Logout kept the access token")
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	srv := newTestServer(t, nil)
+	c := login(t, srv)
+	ctx := WithIdempotencyKey(context.Background(), "create-bob")
+
+	in := CreateUserRequest{Username: "bob", Password: "bobs password", Role: "viewer"}
+	first, err := c.CreateUser(ctx, in)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	// A retry gets the first response instead of a conflict.
+	retry, err := c.CreateUser(ctx, in)
+	if err != nil || *retry != *first {
+		t.Errorf("retried CreateUser = %+v, %v; want %+v", retry, err, first)
+	}
+	if _, err := c.CreateUser(context.Background(), in); !IsStatus(err, http.StatusConflict) {
+		t.Errorf("CreateUser without a key: %v, want 409", err)
+	}
+
+	in.Role = "developer"
+	if _, err := c.CreateUser(ctx, in); !IsStatus(err, http.StatusUnprocessableEntity) {
+		t.Errorf("CreateUser reusing the key for another request: %v, want 422", err)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	srv := newTestServer(t, nil)
+	c := login(t, srv)
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, CreateUserRequest{Username: "bob", Password: "bobs password", Role: "viewer"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	archive, err := c.Backup(ctx, false, false)
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	defer archive.Close()
+	manifest, err := backup.Verify(archive)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	found := false
+	for _, f := range manifest.Files {
+		found = found || f.Path == "data/user/credentials"
+	}
+	if !found || len(manifest.Images) != 0 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	// Only admins may download a backup, since it holds every credential.
+	viewer, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := viewer.Login(ctx, "bob", "bobs password"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := viewer.Backup(ctx, false, false); !IsStatus(err, http.StatusForbidden) {
+		t.Errorf("Backup as a viewer: %v, want 403", err)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	srv := newTestServer(t, nil)
+	c := login(t, srv)
+	ctx := context.Background()
+
+	dir, err := utils.SubsystemDir(utils.Pipelines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"build-a", "build-b", "deploy", "build-c", "build-d"} {
+		if err := os.WriteFile(filepath.Join(dir, name+".sh"), []byte("echo "+name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	opts := ListOptions{Limit: 2, Sort: "-name", Filters: url.Values{"prefix": {"build-"}}}
+	for pages := 1; ; pages++ {
+		page, next, err := c.ListPipelinesPage(ctx, opts)
+		if err != nil {
+			t.Fatalf("ListPipelinesPage: %v", err)
+		}
+		for _, p := range page {
+			names = append(names, p.Name)
+		}
+		if next == "" {
+			if pages != 2 {
+				t.Errorf("got %d pages, want 2", pages)
+			}
+			break
+		}
+		opts.Cursor = next
+	}
+	if got := strings.Join(names, ","); got != "build-d,build-c,build-b,build-a" {
+		t.Errorf("pages = %s", got)
+	}
+
+	if _, _, err := c.ListPipelinesPage(ctx, ListOptions{Sort: "color"}); !IsStatus(err, http.StatusBadRequest) {
+		t.Errorf("unknown sort field: %v, want 400", err)
+	}
+}
+
+func TestProjects(t *testing.T) {
+	srv := newTestServer(t, nil)
+	c := login(t, srv)
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, CreateUserRequest{Username: "bob", Password: "bobs password", Role: "viewer"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	project, err := c.CreateProject(ctx, CreateProjectRequest{Name: "web", Description: "Web team"})
+	if err != nil || project.Name != "web" || project.Role != "admin" {
+		t.Fatalf("CreateProject = %+v, %v", project, err)
+	}
+	if project, err = c.SetProjectMember(ctx, "web", "bob", "developer"); err != nil || project.Members["bob"] != "developer" {
+		t.Errorf("SetProjectMember = %+v, %v", project, err)
+	}
+
+	dir, err := utils.ProjectDir("web", utils.Pipelines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "deploy.sh"), []byte("echo deploy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Login(ctx, "bob", "bobs password"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	projects, err := bob.ListProjects(ctx)
+	if err != nil || len(projects) != 2 || projects[1].Name != "web" || projects[1].Role != "developer" {
+		t.Errorf("ListProjects = %+v, %v", projects, err)
+	}
+	for _, tc := range []struct {
+		project string
+		names   []string
+	}{{"", nil}, {"web", []string{"deploy"}}} {
+		page, _, err := bob.ListPipelinesPage(WithProject(ctx, tc.project), ListOptions{})
+		if err != nil || len(page) != len(tc.names) || (len(page) == 1 && page[0].Name != tc.names[0]) {
+			t.Errorf("pipelines of project %q = %+v, %v", tc.project, page, err)
+		}
+	}
+
+	if _, err := c.RemoveProjectMember(ctx, "web", "bob"); err != nil {
+		t.Fatalf("RemoveProjectMember: %v", err)
+	}
+	if _, _, err := bob.ListPipelinesPage(WithProject(ctx, "web"), ListOptions{}); !IsStatus(err, http.StatusForbidden) {
+		t.Errorf("ListPipelinesPage after removal: %v, want 403", err)
+	}
+	if _, err := bob.GetProject(ctx, "web"); !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("GetProject after removal: %v, want 404", err)
+	}
+
+	// A project is only deleted once it holds no resources.
+	fnDir, err := utils.ProjectDir("web", utils.Functions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(fnDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fnDir, "hello.py"), []byte("print('hello')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteProject(ctx, "web"); !IsStatus(err, http.StatusConflict) {
+		t.Errorf("DeleteProject with a function: %v, want 409", err)
+	}
+	if err := os.Remove(filepath.Join(fnDir, "hello.py")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteProject(ctx, "web"); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if _, err := c.GetProject(ctx, "web"); !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("GetProject after delete: %v, want 404", err)
+	}
+}
+
+// TestErrorEnvelope verifies failed calls return the server's error envelope.
+func TestErrorEnvelope(t *testing.T) {
+	srv := newTestServer(t, nil)
+	ctx := context.Background()
+
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Login(ctx, testAdmin, "wrong password")
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Login with a wrong password: %v (%T), want *apierror.Error", err, err)
+	}
+	if apiErr.Status != http.StatusUnauthorized || apiErr.Code == "" || apiErr.RequestID == "" {
+		t.Errorf("error = %+v", apiErr)
+	}
+
+	c = login(t, srv)
+	if err := c.DeleteUser(ctx, "nobody"); !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("DeleteUser of a missing user: %v, want 404", err)
+	}
+}
+
+// TestRefreshOnUnauthorized verifies a request rejected with 401 is retried
+// once with a token renewed through the refresh endpoint.
+func TestRefreshOnUnauthorized(t *testing.T) {
+	var reject atomic.Bool
+	var refreshes atomic.Int32
+	srv := newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/v1/auth/refresh" {
+				refreshes.Add(1)
+			}
+			if r.URL.Path == "/api/v1/users" && reject.CompareAndSwap(true, false) {
+				apierror.Respond(w, r, http.StatusUnauthorized, "access token expired")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	var refreshed string
+	c := login(t, srv, OnTokenRefresh(func(token string) { refreshed = token }))
+	reject.Store(true)
+
+	if _, err := c.ListUsers(context.Background()); err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("refreshed %d times, want 1", n)
+	}
+	if refreshed == "" || c.AccessToken() != refreshed {
+		t.Errorf("OnTokenRefresh got %q, client uses %q", refreshed, c.AccessToken())
+	}
+}
+
+// TestPersonalAccessToken verifies personal access tokens are sent as bearer
+// tokens, keep their scopes, and are not refreshed.
+func TestPersonalAccessToken(t *testing.T) {
+	srv := newTestServer(t, nil)
+	ctx := context.Background()
+
+	token, err := login(t, srv).CreateAccessToken(ctx, CreateAccessTokenRequest{Name: "ci", Scopes: []string{"users:read"}})
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+
+	c, err := New(srv.URL, WithAccessToken(token.Token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListUsers(ctx); err != nil {
+		t.Errorf("ListUsers with a users:read token: %v", err)
+	}
+	if _, err := c.CreateUser(ctx, CreateUserRequest{Username: "eve", Password: "eves password"}); !IsStatus(err, http.StatusForbidden) {
+		t.Errorf("CreateUser with a users:read token: %v, want 403", err)
+	}
+	if err := c.Refresh(ctx); err == nil {
+		t.Errorf("Refresh with a personal access token succeeded")
+	}
+}
+
+// TestStream verifies progress lines and the result of a streamed operation
+// arrive on the channel.
+func TestStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/images/build" || r.Header.Get("Accept") != "text/event-stream" {
+			apierror.Respond(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: STEP 1/2: FROM alpine\n\n")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "data: STEP 2/2: RUN true\n\n")
+		fmt.Fprint(w, "event: done\ndata: {\"status\":\"success\",\"imageName\":\"demo:latest\"}\n\n")
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := c.BuildImageStream(context.Background(), storage.BuildImageRequest{Dockerfile: "FROM alpine", ImageName: "demo:latest"})
+	if err != nil {
+		t.Fatalf("BuildImageStream: %v", err)
+	}
+
+	var lines []string
+	var result Result
+	if err := Wait(events, func(line string) { lines = append(lines, line) }, &result); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if want := "STEP 1/2: FROM alpine|STEP 2/2: RUN true"; strings.Join(lines, "|") != want {
+		t.Errorf("progress = %q, want %q", lines, want)
+	}
+	if result["imageName"] != "demo:latest" {
+		t.Errorf("result = %v", result)
+	}
+}
+
+// TestStreamErrors verifies failures before and during a stream.
+func TestStreamErrors(t *testing.T) {
+	ctx := context.Background()
+
+	// The real handler rejects the request before it starts streaming.
+	c := login(t, newTestServer(t, nil))
+	_, err := c.BuildImageStream(ctx, storage.BuildImageRequest{Dockerfile: "RUN true", ImageName: "demo"})
+	if !IsStatus(err, http.StatusBadRequest) {
+		t.Errorf("BuildImageStream without FROM: %v, want 400", err)
+	}
+
+	for name, body := range map[string]string{
+		"error event": "data: pulling\n\nevent: error\ndata: {\"code\":\"podman_unavailable\",\"message\":\"podman is not running\"}\n\n",
+		"cut off":     "data: pulling\n\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, body)
+			}))
+			defer srv.Close()
+
+			c, err := New(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events, err := c.PullImageStream(ctx, storage.PullImageRequest{ImageName: "alpine"})
+			if err != nil {
+				t.Fatalf("PullImageStream: %v", err)
+			}
+			err = Wait(events, nil, nil)
+
+			var apiErr *apierror.Error
+			switch name {
+			case "error event":
+				if !errors.As(err, &apiErr) || apiErr.Code != "podman_unavailable" {
+					t.Errorf("Wait = %v, want the error event's envelope", err)
+				}
+			default:
+				if !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Errorf("Wait = %v, want io.ErrUnexpectedEOF", err)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenExpired(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	token := func(claims string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c0ffee"
+	}
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{token(`{"sub":"admin","exp":1699999999}`), true},
+		{token(`{"sub":"admin","exp":1700000060}`), false},
+		{token(`{"sub":"admin"}`), false},
+		{"not a token", false},
+	}
+	for _, tt := range tests {
+		if got := tokenExpired(tt.token, now); got != tt.want {
+			t.Errorf("tokenExpired(%q) = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+}
+
+// TestEscapedPathValues verifies image references containing "/" are sent as
+// one escaped path segment.
+func TestEscapedPathValues(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.EscapedPath()
+		io.WriteString(w, "build log")
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL + "/opencloud/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ImageLogs(context.Background(), "quay.io/prometheus/prometheus:latest"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/opencloud/api/v1/images/quay.io%2Fprometheus%2Fprometheus:latest/logs"; got != want {
+		t.Errorf("path = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/compute"
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+)
+
+// CreateFunctionRequest describes a new function.  The runtime, e.g.
+// "python" or "node", picks the file extension added to Name.
+type CreateFunctionRequest struct {
+	Name    string `json:"name"`
+	Runtime string `json:"runtime"`
+	Code    string `json:"code"`
+}
+
+// FunctionDetail is a function's source and metadata.
+type FunctionDetail struct {
+	Name         string           `json:"name"`
+	Path         string           `json:"path"`
+	Invocations  int              `json:"Invocations"`
+	Runtime      string           `json:"runtime"`
+	LastModified string           `json:"lastModified"`
+	SizeBytes    int64            `json:"sizeBytes"`
+	Code         string           `json:"code"`
+	Trigger      *compute.Trigger `json:"trigger"`
+}
+
+// ListContainers lists all containers.
+func (c *Client) ListContainers(ctx context.Context) ([]opencloudapi.ContainerInfo, error) {
+	var out []opencloudapi.ContainerInfo
+	err := c.call(ctx, http.MethodGet, "/containers", nil, nil, &out)
+	return out, err
+}
+
+// ListContainersPage lists the containers opts selects, newest first unless
+// opts sorts by name, created, state or image, and returns the cursor of the
+// next page.  Containers can be filtered by state, label and name prefix.
+func (c *Client) ListContainersPage(ctx context.Context, opts ListOptions) ([]opencloudapi.ContainerInfo, string, error) {
+	return listPage[opencloudapi.ContainerInfo](ctx, c, "/containers", opts)
+}
+
+// RunContainer pulls an image and starts a container from it.
+func (c *Client) RunContainer(ctx context.Context, in compute.PullAndRunRequest) (Result, error) {
+	var out Result
+	err := c.call(ctx, http.MethodPost, "/containers", nil, in, &out)
+	return out, err
+}
+
+// RunContainerStream is RunContainer with the image pull's progress streamed.
+// The final event's result is the same as RunContainer's.
+func (c *Client) RunContainerStream(ctx context.Context, in compute.PullAndRunRequest) (<-chan Event, error) {
+	req, err := jsonRequest(http.MethodPost, "/containers", in)
+	if err != nil {
+		return nil, err
+	}
+	return c.stream(ctx, req)
+}
+
+// GetContainer returns a container's configuration and state.
+func (c *Client) GetContainer(ctx context.Context, id string) (*compute.ContainerDetail, error) {
+	var out compute.ContainerDetail
+	if err := c.call(ctx, http.MethodGet, "/containers/"+pathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateContainer recreates a container with a new configuration.  The
+// container ID in the request is ignored in favour of id.  The new container
+// gets a new ID, which is returned under "containerId".
+func (c *Client) UpdateContainer(ctx context.Context, id string, in compute.UpdateContainerRequest) (Result, error) {
+	var out Result
+	err := c.call(ctx, http.MethodPut, "/containers/"+pathEscape(id), nil, in, &out)
+	return out, err
+}
+
+// DeleteContainer force-removes a container.
+func (c *Client) DeleteContainer(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/containers/"+pathEscape(id), nil, nil, nil)
+}
+
+// StartContainer starts a stopped container.
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodPost, "/containers/"+pathEscape(id)+"/start", nil, nil, nil)
+}
+
+// StopContainer stops a running container.
+func (c *Client) StopContainer(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodPost, "/containers/"+pathEscape(id)+"/stop", nil, nil, nil)
+}
+
+// ContainerLogs returns the last tail lines of a container's output, or the
+// server default of 100 when tail is zero.  A negative tail returns all of it.
+func (c *Client) ContainerLogs(ctx context.Context, id string, tail int) (string, error) {
+	query := url.Values{}
+	switch {
+	case tail < 0:
+		query.Set("tail", "all")
+	case tail > 0:
+		query.Set("tail", strconv.Itoa(tail))
+	}
+	return c.text(ctx, "/containers/"+pathEscape(id)+"/logs", query)
+}
+
+// ListFunctions lists all functions.
+func (c *Client) ListFunctions(ctx context.Context) ([]compute.FunctionItem, error) {
+	var out []compute.FunctionItem
+	err := c.call(ctx, http.MethodGet, "/functions", nil, nil, &out)
+	return out, err
+}
+
+// ListFunctionsPage lists the functions opts selects, by name unless opts
+// sorts by modified, invocations or runtime, and returns the cursor of the
+// next page.  Functions can be filtered by runtime and name prefix.
+func (c *Client) ListFunctionsPage(ctx context.Context, opts ListOptions) ([]compute.FunctionItem, string, error) {
+	return listPage[compute.FunctionItem](ctx, c, "/functions", opts)
+}
+
+// CreateFunction creates a function.
+func (c *Client) CreateFunction(ctx context.Context, in CreateFunctionRequest) (*compute.FunctionItem, error) {
+	var out compute.FunctionItem
+	if err := c.call(ctx, http.MethodPost, "/functions", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SyncFunctions rebuilds the function records from the function files on
+// the server.
+func (c *Client) SyncFunctions(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/functions/sync", nil, nil, nil)
+}
+
+// GetFunction returns a function's source and metadata.
+func (c *Client) GetFunction(ctx context.Context, name string) (*FunctionDetail, error) {
+	var out FunctionDetail
+	if err := c.call(ctx, http.MethodGet, "/functions/"+pathEscape(name), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateFunction replaces a function's code, settings and trigger.
+func (c *Client) UpdateFunction(ctx context.Context, name string, in compute.UpdateFunctionRequest) (*compute.FunctionItem, error) {
+	var out compute.FunctionItem
+	if err := c.call(ctx, http.MethodPut, "/functions/"+pathEscape(name), nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteFunction deletes a function.
+func (c *Client) DeleteFunction(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, "/functions/"+pathEscape(name), nil, nil, nil)
+}
+
+// InvokeFunction runs a function and returns its output.  A non-nil input is
+// passed to the function as JSON on standard input.
+func (c *Client) InvokeFunction(ctx context.Context, name string, input any) (string, error) {
+	var out struct {
+		Output string `json:"output"`
+	}
+	err := c.call(ctx, http.MethodPost, "/functions/"+pathEscape(name)+"/invoke", nil, input, &out)
+	return out.Output, err
+}
+
+// FunctionLogs returns a function's invocation log.
+func (c *Client) FunctionLogs(ctx context.Context, name string) ([]service_ledger.FunctionLog, error) {
+	var out []service_ledger.FunctionLog
+	err := c.call(ctx, http.MethodGet, "/functions/"+pathEscape(name)+"/logs", nil, nil, &out)
+	return out, err
+}
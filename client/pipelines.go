@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+)
+
+// ListPipelines lists all pipelines.
+func (c *Client) ListPipelines(ctx context.Context) ([]opencloudapi.Pipeline, error) {
+	var out []opencloudapi.Pipeline
+	err := c.call(ctx, http.MethodGet, "/pipelines", nil, nil, &out)
+	return out, err
+}
+
+// ListPipelinesPage lists the pipelines opts selects, by name unless opts
+// sorts by created or status, and returns the cursor of the next page.
+// Pipelines can be filtered by status and name prefix.
+func (c *Client) ListPipelinesPage(ctx context.Context, opts ListOptions) ([]opencloudapi.Pipeline, string, error) {
+	return listPage[opencloudapi.Pipeline](ctx, c, "/pipelines", opts)
+}
+
+// CreatePipeline creates a pipeline.
+func (c *Client) CreatePipeline(ctx context.Context, in opencloudapi.CreatePipelineRequest) (*opencloudapi.Pipeline, error) {
+	var out opencloudapi.Pipeline
+	if err := c.call(ctx, http.MethodPost, "/pipelines", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SyncPipelines rebuilds the pipeline records from the pipeline files on
+// the server.
+func (c *Client) SyncPipelines(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/pipelines/sync", nil, nil, nil)
+}
+
+// GetPipeline returns a pipeline.
+func (c *Client) GetPipeline(ctx context.Context, id string) (*opencloudapi.Pipeline, error) {
+	var out opencloudapi.Pipeline
+	if err := c.call(ctx, http.MethodGet, "/pipelines/"+pathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdatePipeline replaces a pipeline's definition.
+func (c *Client) UpdatePipeline(ctx context.Context, id string, in opencloudapi.UpdatePipelineRequest) (*opencloudapi.Pipeline, error) {
+	var out opencloudapi.Pipeline
+	if err := c.call(ctx, http.MethodPut, "/pipelines/"+pathEscape(id), nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeletePipeline deletes a pipeline and its logs.
+func (c *Client) DeletePipeline(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/pipelines/"+pathEscape(id), nil, nil, nil)
+}
+
+// RunPipeline starts a pipeline run.  It returns once the run has started;
+// poll GetPipeline or PipelineLogs for the outcome.
+func (c *Client) RunPipeline(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodPost, "/pipelines/"+pathEscape(id)+"/run", nil, nil, nil)
+}
+
+// StopPipeline stops a running pipeline.
+func (c *Client) StopPipeline(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodPost, "/pipelines/"+pathEscape(id)+"/stop", nil, nil, nil)
+}
+
+// PipelineLogs returns a pipeline's run log.
+func (c *Client) PipelineLogs(ctx context.Context, id string) ([]opencloudapi.PipelineLog, error) {
+	var out []opencloudapi.PipelineLog
+	err := c.call(ctx, http.MethodGet, "/pipelines/"+pathEscape(id)+"/logs", nil, nil, &out)
+	return out, err
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Project groups functions, containers, buckets and pipelines.  Every
+// instance has the "default" project, which all users can reach with their
+// instance role; other projects are reachable by admins and their members.
+type Project struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CreatedAt   string `json:"createdAt,omitempty"`
+	// Members maps the users granted access to the project to their role
+	// in it, "developer" or "viewer".
+	Members map[string]string `json:"members"`
+	// Role is the caller's role in the project.
+	Role string `json:"role"`
+}
+
+// CreateProjectRequest describes a new project.  Names are lowercase
+// letters, digits and dashes.
+type CreateProjectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// ListProjects lists the projects the caller can reach.
+func (c *Client) ListProjects(ctx context.Context) ([]Project, error) {
+	var out []Project
+	err := c.call(ctx, http.MethodGet, "/projects", nil, nil, &out)
+	return out, err
+}
+
+// CreateProject creates a project.  Only admins may create projects.
+func (c *Client) CreateProject(ctx context.Context, in CreateProjectRequest) (*Project, error) {
+	var out Project
+	if err := c.call(ctx, http.MethodPost, "/projects", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetProject returns a project.
+func (c *Client) GetProject(ctx context.Context, name string) (*Project, error) {
+	var out Project
+	if err := c.call(ctx, http.MethodGet, "/projects/"+pathEscape(name), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteProject deletes a project, which must hold no resources.
+func (c *Client) DeleteProject(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, "/projects/"+pathEscape(name), nil, nil, nil)
+}
+
+// SetProjectMember grants a user a role in a project, replacing any role
+// they had in it.
+func (c *Client) SetProjectMember(ctx context.Context, project, username, role string) (*Project, error) {
+	var out Project
+	path := "/projects/" + pathEscape(project) + "/members/" + pathEscape(username)
+	if err := c.call(ctx, http.MethodPut, path, nil, map[string]string{"role": role}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveProjectMember revokes a user's access to a project.
+func (c *Client) RemoveProjectMember(ctx context.Context, project, username string) (*Project, error) {
+	var out Project
+	path := "/projects/" + pathEscape(project) + "/members/" + pathEscape(username)
+	if err := c.call(ctx, http.MethodDelete, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/storage"
+)
+
+// ListBuckets lists the blob storage buckets.
+func (c *Client) ListBuckets(ctx context.Context) ([]storage.Bucket, error) {
+	var out []storage.Bucket
+	err := c.call(ctx, http.MethodGet, "/buckets", nil, nil, &out)
+	return out, err
+}
+
+// ListBucketsPage lists the buckets opts selects, by name unless opts sorts
+// by size, objects or modified, and returns the cursor of the next page.
+// Buckets can be filtered by name prefix.
+func (c *Client) ListBucketsPage(ctx context.Context, opts ListOptions) ([]storage.Bucket, string, error) {
+	return listPage[storage.Bucket](ctx, c, "/buckets", opts)
+}
+
+// ListBucketMounts lists the buckets that containers can mount.
+func (c *Client) ListBucketMounts(ctx context.Context) ([]storage.Bucket, error) {
+	var out []storage.Bucket
+	err := c.call(ctx, http.MethodGet, "/bucket-mounts", nil, nil, &out)
+	return out, err
+}
+
+// CreateBucket creates a bucket.  A bucket created with containerMount is
+// backed by a Podman volume, returned under "volumeName".
+func (c *Client) CreateBucket(ctx context.Context, name string, containerMount bool) (Result, error) {
+	in := struct {
+		Name           string `json:"name"`
+		ContainerMount bool   `json:"containerMount"`
+	}{name, containerMount}
+	var out Result
+	err := c.call(ctx, http.MethodPost, "/buckets", nil, in, &out)
+	return out, err
+}
+
+// RenameBucket renames a bucket.
+func (c *Client) RenameBucket(ctx context.Context, name, newName string) error {
+	return c.call(ctx, http.MethodPatch, "/buckets/"+pathEscape(name), nil, map[string]string{"newName": newName}, nil)
+}
+
+// DeleteBucket deletes a bucket and everything in it.
+func (c *Client) DeleteBucket(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, "/buckets/"+pathEscape(name), nil, nil, nil)
+}
+
+// ListObjects lists the objects in a bucket.
+func (c *Client) ListObjects(ctx context.Context, bucket string) ([]storage.Blob, error) {
+	var out []storage.Blob
+	err := c.call(ctx, http.MethodGet, "/buckets/"+pathEscape(bucket)+"/objects", nil, nil, &out)
+	return out, err
+}
+
+// ListObjectsPage lists the objects in bucket that opts selects, by name
+// unless opts sorts by size or modified, and returns the cursor of the next
+// page.  Objects can be filtered by name prefix.
+func (c *Client) ListObjectsPage(ctx context.Context, bucket string, opts ListOptions) ([]storage.Blob, string, error) {
+	return listPage[storage.Blob](ctx, c, "/buckets/"+pathEscape(bucket)+"/objects", opts)
+}
+
+// UploadObject stores the contents of r in bucket under name.  The body is
+// streamed, so the upload is not retried if the session token has to be
+// refreshed on the way; an expired token is still refreshed beforehand.
+func (c *Client) UploadObject(ctx context.Context, bucket, name string, r io.Reader) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	// Stop the writer if the request fails before reading the whole body.
+	defer pr.Close()
+
+	req := request{
+		method:      http.MethodPost,
+		path:        "/buckets/" + pathEscape(bucket) + "/objects",
+		body:        func() io.Reader { return pr },
+		contentType: mw.FormDataContentType(),
+	}
+	return c.do(ctx, req, nil)
+}
+
+// DownloadObject opens an object for reading.  The caller must close it.
+func (c *Client) DownloadObject(ctx context.Context, bucket, name string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, request{
+		method:     http.MethodGet,
+		path:       "/buckets/" + pathEscape(bucket) + "/objects/" + pathEscape(name),
+		accept:     "application/octet-stream",
+		replayable: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DeleteObject deletes an object.
+func (c *Client) DeleteObject(ctx context.Context, bucket, name string) error {
+	return c.call(ctx, http.MethodDelete, "/buckets/"+pathEscape(bucket)+"/objects/"+pathEscape(name), nil, nil, nil)
+}
+
+// ListImages lists the container images, one entry per tag.
+func (c *Client) ListImages(ctx context.Context) ([]opencloudapi.ImageInfo, error) {
+	var out []opencloudapi.ImageInfo
+	err := c.call(ctx, http.MethodGet, "/images", nil, nil, &out)
+	return out, err
+}
+
+// ListImagesPage lists the images opts selects, one entry per tag, newest
+// first unless opts sorts by name, created or size, and returns the cursor
+// of the next page.  Images can be filtered by label and name prefix.
+func (c *Client) ListImagesPage(ctx context.Context, opts ListOptions) ([]opencloudapi.ImageInfo, string, error) {
+	return listPage[opencloudapi.ImageInfo](ctx, c, "/images", opts)
+}
+
+// BuildImage builds a container image and returns once the build is done.
+// The build output is returned under "logs".
+func (c *Client) BuildImage(ctx context.Context, in storage.BuildImageRequest) (Result, error) {
+	var out Result
+	err := c.call(ctx, http.MethodPost, "/images/build", nil, in, &out)
+	return out, err
+}
+
+// BuildImageStream builds a container image and streams the build output
+// line by line.
+func (c *Client) BuildImageStream(ctx context.Context, in storage.BuildImageRequest) (<-chan Event, error) {
+	req, err := jsonRequest(http.MethodPost, "/images/build", in)
+	if err != nil {
+		return nil, err
+	}
+	return c.stream(ctx, req)
+}
+
+// PullImage pulls a container image from a registry.
+func (c *Client) PullImage(ctx context.Context, in storage.PullImageRequest) (Result, error) {
+	var out Result
+	err := c.call(ctx, http.MethodPost, "/images/pull", nil, in, &out)
+	return out, err
+}
+
+// PullImageStream pulls a container image and streams the pull progress.
+func (c *Client) PullImageStream(ctx context.Context, in storage.PullImageRequest) (<-chan Event, error) {
+	req, err := jsonRequest(http.MethodPost, "/images/pull", in)
+	if err != nil {
+		return nil, err
+	}
+	return c.stream(ctx, req)
+}
+
+// GetImage returns an image's metadata.  ref is an image ID or name such as
+// "quay.io/prometheus/prometheus:latest".
+func (c *Client) GetImage(ctx context.Context, ref string) (*storage.ImageDetail, error) {
+	var out storage.ImageDetail
+	if err := c.call(ctx, http.MethodGet, "/images/"+pathEscape(ref), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteImage deletes an image.
+func (c *Client) DeleteImage(ctx context.Context, ref string) error {
+	return c.call(ctx, http.MethodDelete, "/images/"+pathEscape(ref), nil, nil, nil)
+}
+
+// ImageLogs returns the saved build or pull output of an image.
+func (c *Client) ImageLogs(ctx context.Context, ref string) (string, error) {
+	return c.text(ctx, "/images/"+pathEscape(ref)+"/logs", nil)
+}
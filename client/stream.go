@@ -0,0 +1,132 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+)
+
+// Event is one message of a streamed operation such as an image build.
+//
+// Progress events carry a Line of output.  The last event on a stream has
+// Done set: Result then holds the operation's JSON result, or Err says why it
+// failed.  A stream that ends without a result, e.g. because the connection
+// dropped, ends with Err set to io.ErrUnexpectedEOF.
+type Event struct {
+	Line   string
+	Done   bool
+	Result json.RawMessage
+	Err    error
+}
+
+// stream sends req with Accept: text/event-stream and decodes the response
+// into events.  The channel is closed after the final event.  Cancelling ctx
+// stops the stream and abandons the operation's result.
+func (c *Client) stream(ctx context.Context, req request) (<-chan Event, error) {
+	req.accept = "text/event-stream"
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		readEvents(ctx, resp.Body, events)
+	}()
+	return events, nil
+}
+
+// readEvents decodes Server-Sent Events from body until the final event.
+func readEvents(ctx context.Context, body io.Reader, events chan<- Event) {
+	send := func(e Event) bool {
+		select {
+		case events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	var name string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				name = value
+			case "data":
+				data = append(data, value)
+			}
+			continue
+		}
+
+		// A blank line dispatches the event.
+		if len(data) == 0 {
+			name = ""
+			continue
+		}
+		payload := strings.Join(data, "\n")
+		switch name {
+		case "done":
+			send(Event{Done: true, Result: json.RawMessage(payload)})
+			return
+		case "error":
+			send(Event{Done: true, Err: decodeEventError(payload)})
+			return
+		default:
+			if !send(Event{Line: payload}) {
+				return
+			}
+		}
+		name, data = "", nil
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	send(Event{Done: true, Err: err})
+}
+
+// decodeEventError decodes the error envelope of an "error" event.  Its
+// Status is left zero because the stream itself was answered with 200.
+func decodeEventError(payload string) error {
+	apiErr := &apierror.Error{}
+	if err := json.Unmarshal([]byte(payload), apiErr); err != nil || apiErr.Message == "" {
+		return fmt.Errorf("stream failed: %s", payload)
+	}
+	return apiErr
+}
+
+// Wait drains events and returns the final result, decoded into out when it
+// is not nil.  Progress lines are passed to progress when it is not nil.
+func Wait(events <-chan Event, progress func(line string), out any) error {
+	for e := range events {
+		if !e.Done {
+			if progress != nil {
+				progress(e.Line)
+			}
+			continue
+		}
+		if e.Err != nil {
+			return e.Err
+		}
+		if out != nil {
+			return json.Unmarshal(e.Result, out)
+		}
+		return nil
+	}
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+)
+
+// AuditRecord is one entry of the audit log.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Resource   string    `json:"resource"`
+	Target     string    `json:"target,omitempty"`
+	Project    string    `json:"project,omitempty"`
+	Status     int       `json:"status"`
+	Outcome    string    `json:"outcome"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+}
+
+// AuditQuery filters the audit log.  Zero fields do not filter; Limit
+// defaults to the server's default of 100.
+type AuditQuery struct {
+	User     string
+	Resource string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// ServiceStatus reports whether an optional service is enabled.
+type ServiceStatus struct {
+	Service string `json:"service"`
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// SystemMetrics returns the host's CPU and disk usage.
+func (c *Client) SystemMetrics(ctx context.Context) (*opencloudapi.Metrics, error) {
+	var out opencloudapi.Metrics
+	if err := c.call(ctx, http.MethodGet, "/system/metrics", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AuditLog returns the audit log records matching q, newest first.
+func (c *Client) AuditLog(ctx context.Context, q AuditQuery) ([]AuditRecord, error) {
+	query := queryOf("user", q.User, "resource", q.Resource)
+	if !q.Since.IsZero() {
+		query.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		query.Set("until", q.Until.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var out []AuditRecord
+	err := c.call(ctx, http.MethodGet, "/system/audit-log", query, nil, &out)
+	return out, err
+}
+
+// Backup downloads an archive of the whole instance, optionally with the
+// Podman images and volumes.  The caller must close the archive; it can be
+// checked with backup.Verify and restored with "opencloud restore".
+func (c *Client) Backup(ctx context.Context, images, volumes bool) (io.ReadCloser, error) {
+	query := url.Values{}
+	if images {
+		query.Set("images", "true")
+	}
+	if volumes {
+		query.Set("volumes", "true")
+	}
+	resp, err := c.send(ctx, request{
+		method:     http.MethodGet,
+		path:       "/system/backup",
+		query:      query,
+		accept:     "application/gzip",
+		replayable: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GetServiceStatus reports whether an optional service, such as
+// "blob_storage", is enabled.
+func (c *Client) GetServiceStatus(ctx context.Context, service string) (*ServiceStatus, error) {
+	var out ServiceStatus
+	if err := c.call(ctx, http.MethodGet, "/services/"+pathEscape(service), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnableService enables an optional service, installing what it needs.
+func (c *Client) EnableService(ctx context.Context, service string) (*ServiceStatus, error) {
+	var out ServiceStatus
+	if err := c.call(ctx, http.MethodPost, "/services/"+pathEscape(service)+"/enable", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnableServiceStream enables an optional service and streams the
+// installer's output.
+func (c *Client) EnableServiceStream(ctx context.Context, service string) (<-chan Event, error) {
+	req, err := jsonRequest(http.MethodPost, "/services/"+pathEscape(service)+"/enable", nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.stream(ctx, req)
+}
+
+// GetInstanceDomain returns the domain the instance is served under.
+func (c *Client) GetInstanceDomain(ctx context.Context) (string, error) {
+	var out struct {
+		Domain string `json:"domain"`
+	}
+	err := c.call(ctx, http.MethodGet, "/instance/domain", nil, nil, &out)
+	return out.Domain, err
+}
+
+// SetInstanceDomain saves the instance's domain and returns the nginx
+// changes needed to serve it.
+func (c *Client) SetInstanceDomain(ctx context.Context, domain string) (*opencloudapi.SetInstanceDomainResponse, error) {
+	var out opencloudapi.SetInstanceDomainResponse
+	if err := c.call(ctx, http.MethodPut, "/instance/domain", nil, map[string]string{"domain": domain}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSSLEmail returns the contact email saved for SSL certificates.
+func (c *Client) GetSSLEmail(ctx context.Context) (string, error) {
+	var out struct {
+		Email string `json:"email"`
+	}
+	err := c.call(ctx, http.MethodGet, "/instance/ssl", nil, nil, &out)
+	return out.Email, err
+}
+
+// ConfigureSSL returns the commands that obtain and install a certificate
+// for the domain.
+func (c *Client) ConfigureSSL(ctx context.Context, in opencloudapi.ConfigureSSLRequest) (*opencloudapi.ConfigureSSLResponse, error) {
+	var out opencloudapi.ConfigureSSLResponse
+	if err := c.call(ctx, http.MethodPost, "/instance/ssl", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
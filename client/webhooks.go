@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook is a subscription that POSTs platform events to a URL.
+type Webhook struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description,omitempty"`
+	Active      bool     `json:"active"`
+	CreatedAt   string   `json:"createdAt"`
+	// Secret signs deliveries.  The server only returns it from
+	// CreateWebhook and when rotating it with UpdateWebhook.
+	Secret string `json:"secret,omitempty"`
+}
+
+// CreateWebhookRequest describes a new webhook.  Active nil means active.
+type CreateWebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+// UpdateWebhookRequest changes a webhook.  Nil fields are left unchanged.
+type UpdateWebhookRequest struct {
+	URL          *string  `json:"url,omitempty"`
+	Events       []string `json:"events,omitempty"`
+	Description  *string  `json:"description,omitempty"`
+	Active       *bool    `json:"active,omitempty"`
+	RotateSecret bool     `json:"rotateSecret,omitempty"`
+}
+
+// WebhookDelivery is one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"eventId"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Time       time.Time `json:"time"`
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// ListWebhooks lists all webhooks, oldest first.
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var out []Webhook
+	err := c.call(ctx, http.MethodGet, "/webhooks", nil, nil, &out)
+	return out, err
+}
+
+// CreateWebhook creates a webhook.  The result holds its signing secret.
+func (c *Client) CreateWebhook(ctx context.Context, in CreateWebhookRequest) (*Webhook, error) {
+	var out Webhook
+	if err := c.call(ctx, http.MethodPost, "/webhooks", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetWebhook returns a webhook.
+func (c *Client) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	var out Webhook
+	if err := c.call(ctx, http.MethodGet, "/webhooks/"+pathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateWebhook changes a webhook or rotates its secret.
+func (c *Client) UpdateWebhook(ctx context.Context, id string, in UpdateWebhookRequest) (*Webhook, error) {
+	var out Webhook
+	if err := c.call(ctx, http.MethodPut, "/webhooks/"+pathEscape(id), nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteWebhook deletes a webhook and its delivery log.
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/webhooks/"+pathEscape(id), nil, nil, nil)
+}
+
+// WebhookDeliveries returns a webhook's delivery attempts, newest first.
+// limit <= 0 uses the server's default of 100.
+func (c *Client) WebhookDeliveries(ctx context.Context, id string, limit int) ([]WebhookDelivery, error) {
+	query := queryOf()
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var out []WebhookDelivery
+	err := c.call(ctx, http.MethodGet, "/webhooks/"+pathEscape(id)+"/deliveries", query, nil, &out)
+	return out, err
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/WavexSoftware/OpenCloud/client"
+	"github.com/urfave/cli"
+)
+
+// totpCodePattern matches authenticator app codes; anything else given at
+// the two-factor prompt is tried as a recovery code.
+var totpCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+
+func (e *cliEnv) loginCommand() cli.Command {
+	return cli.Command{
+		Name:  "login",
+		Usage: "Sign in and save the server and token in the profile",
+		Description: "Prompts for the password, for a two-factor code when the account has one, and\n" +
+			"   for a new password when the account must change it.  With --password-stdin the\n" +
+			"   new password is read from the line after the current one.\n" +
+			"   With --access-token, saves a personal access token instead of signing in.",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "username, u", Usage: "account to sign in as"},
+			cli.BoolFlag{Name: "password-stdin", Usage: "read the password from standard input"},
+			cli.StringFlag{Name: "access-token", Usage: "personal access token to save instead of signing in"},
+		},
+		Action: func(c *cli.Context) error {
+			name := c.GlobalString("profile")
+			server := c.GlobalString("server")
+			if server == "" {
+				pf, err := readProfiles()
+				if err != nil {
+					return err
+				}
+				server = pf.Profiles[name].Server
+			}
+			if server == "" {
+				return fmt.Errorf("--server is required the first time you log in to profile %q", name)
+			}
+			oc, err := client.New(server, client.WithUserAgent("opencloudctl"))
+			if err != nil {
+				return err
+			}
+
+			token := c.String("access-token")
+			if token == "" {
+				if token, err = e.login(c, oc); err != nil {
+					return err
+				}
+			}
+			if err := updateProfile(name, func(p *profile) { p.Server, p.Token = server, token }); err != nil {
+				return fmt.Errorf("failed to save profile: %w", err)
+			}
+			fmt.Fprintf(e.stderr, "Saved profile %q for %s\n", name, server)
+			return nil
+		},
+	}
+}
+
+// login signs in interactively and returns the session's access token.
+func (e *cliEnv) login(c *cli.Context, oc *client.Client) (string, error) {
+	username := c.String("username")
+	if username == "" {
+		var err error
+		if username, err = e.readLine("Username: "); err != nil {
+			return "", err
+		}
+	}
+	var password string
+	var err error
+	if c.Bool("password-stdin") {
+		password, err = e.readLine("")
+	} else {
+		password, err = e.readSecret("Password: ")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	res, err := oc.Login(e.ctx, username, password)
+	if err != nil {
+		return "", err
+	}
+	if res.MFARequired {
+		code, err := e.readSecret("Two-factor code: ")
+		if err != nil {
+			return "", err
+		}
+		req := client.VerifyLoginRequest{ChallengeToken: res.ChallengeToken}
+		if totpCodePattern.MatchString(code) {
+			req.Code = code
+		} else {
+			req.RecoveryCode = code
+		}
+		if res, err = oc.VerifyLogin(e.ctx, req); err != nil {
+			return "", err
+		}
+	}
+	if res.MustChangePassword {
+		// The session cannot be used for anything else until the password
+		// is changed, so do that now rather than save a useless token.
+		fmt.Fprintln(e.stderr, "The password for this account must be changed before it can be used.")
+		var newPassword string
+		if c.Bool("password-stdin") {
+			newPassword, err = e.readLine("")
+		} else {
+			newPassword, err = e.readSecret("New password: ")
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := oc.ChangePassword(e.ctx, password, newPassword); err != nil {
+			return "", fmt.Errorf("failed to change password: %w", err)
+		}
+	}
+	return res.AccessToken, nil
+}
+
+func (e *cliEnv) logoutCommand() cli.Command {
+	return cli.Command{
+		Name:  "logout",
+		Usage: "End the session and remove the token from the profile",
+		Action: func(c *cli.Context) error {
+			name := c.GlobalString("profile")
+			oc, err := e.client(c)
+			if err != nil {
+				return err
+			}
+			// Personal access tokens have no session and are refused by
+			// the logout endpoint; they are only forgotten here and stay
+			// valid until revoked.
+			err = oc.Logout(e.ctx)
+			if err != nil && !client.IsStatus(err, http.StatusUnauthorized) && !client.IsStatus(err, http.StatusForbidden) {
+				fmt.Fprintf(e.stderr, "Warning: failed to end the session: %v\n", err)
+			}
+			if err := updateProfile(name, func(p *profile) { p.Token = "" }); err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stderr, "Logged out of profile %q\n", name)
+			return nil
+		},
+	}
+}
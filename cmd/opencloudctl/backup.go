@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/WavexSoftware/OpenCloud/backup"
+	"github.com/urfave/cli"
+)
+
+func (e *cliEnv) backupCommand() cli.Command {
+	return cli.Command{
+		Name:  "backup",
+		Usage: "Download an archive of the whole instance (admin only); restore it on the server with \"opencloud restore\"",
+		Description: "The archive is checked before it is kept, so FILE is only written when the\n" +
+			"download is complete.  Use - to write to standard output unchecked.",
+		ArgsUsage: "FILE",
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "images", Usage: "include the tagged Podman images"},
+			cli.BoolFlag{Name: "volumes", Usage: "include the Podman volumes other than those of container-mount buckets"},
+		},
+		Action: func(c *cli.Context) error {
+			if err := requireArgs(c, 1); err != nil {
+				return err
+			}
+			dst := c.Args().First()
+			oc, err := e.client(c)
+			if err != nil {
+				return err
+			}
+			body, err := oc.Backup(e.ctx, c.Bool("images"), c.Bool("volumes"))
+			if err != nil {
+				return err
+			}
+			defer body.Close()
+
+			if dst == "-" {
+				_, err = io.Copy(e.stdout, body)
+				return err
+			}
+			partial := dst + ".partial"
+			f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(partial)
+			defer f.Close()
+			if _, err := io.Copy(f, body); err != nil {
+				return err
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			manifest, err := backup.Verify(f)
+			if err != nil {
+				return fmt.Errorf("downloaded archive is not valid: %w", err)
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			if err := os.Rename(partial, dst); err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stderr, "Saved backup to %s: %d files, %d images, %d volumes\n",
+				dst, len(manifest.Files), len(manifest.Images), len(manifest.Volumes))
+			return nil
+		},
+	}
+}
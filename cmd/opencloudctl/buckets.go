@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// remotePrefix marks bucket paths on the command line: oc://BUCKET/OBJECT.
+const remotePrefix = "oc://"
+
+// parseRemote splits an oc://BUCKET[/OBJECT] path.  ok is false for local
+// paths.  Buckets hold no folders, so object names cannot contain "/".
+func parseRemote(arg string) (bucket, object string, ok bool, err error) {
+	rest, ok := strings.CutPrefix(arg, remotePrefix)
+	if !ok {
+		return "", "", false, nil
+	}
+	bucket, object, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", true, fmt.Errorf("%q has no bucket name", arg)
+	}
+	if strings.Contains(object, "/") {
+		return "", "", true, fmt.Errorf("%q: object names cannot contain \"/\"", arg)
+	}
+	return bucket, object, true, nil
+}
+
+func (e *cliEnv) bucketsCommand() cli.Command {
+	return cli.Command{
+		Name:  "buckets",
+		Usage: "Manage blob storage; objects are addressed as oc://BUCKET/OBJECT",
+		Subcommands: []cli.Command{
+			{
+				Name:      "ls",
+				Usage:     "List buckets, or the objects in a bucket",
+				ArgsUsage: "[oc://BUCKET]",
+				Action:    e.bucketsList,
+			},
+			{
+				Name:      "cp",
+				Usage:     "Upload a file to a bucket or download an object",
+				ArgsUsage: "SOURCE DESTINATION",
+				Action:    e.bucketsCopy,
+			},
+			{
+				Name:      "rm",
+				Usage:     "Delete an object, or a whole bucket with --recursive",
+				ArgsUsage: "oc://BUCKET[/OBJECT]",
+				Flags: []cli.Flag{
+					cli.BoolFlag{Name: "recursive, r", Usage: "delete the bucket and everything in it"},
+				},
+				Action: e.bucketsRemove,
+			},
+		},
+	}
+}
+
+func (e *cliEnv) bucketsList(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return errors.New("buckets ls takes at most one bucket")
+	}
+	oc, err := e.client(c)
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() == 0 {
+		buckets, err := oc.ListBuckets(e.ctx)
+		if err != nil {
+			return err
+		}
+		return printResult(e.stdout, format(c), buckets, func() table {
+			t := table{header: []string{"NAME", "OBJECTS", "SIZE", "MOUNTABLE", "MODIFIED"}}
+			for _, b := range buckets {
+				t.add(b.Name, strconv.Itoa(b.ObjectCount), formatBytes(b.TotalSize), strconv.FormatBool(b.ContainerMount), orDash(b.LastModified))
+			}
+			return t
+		})
+	}
+
+	arg := c.Args().First()
+	bucket, object, ok, err := parseRemote(arg)
+	if err == nil && (!ok || object != "") {
+		err = fmt.Errorf("%q is not a bucket; use oc://BUCKET", arg)
+	}
+	if err != nil {
+		return err
+	}
+	blobs, err := oc.ListObjects(e.ctx, bucket)
+	if err != nil {
+		return err
+	}
+	return printResult(e.stdout, format(c), blobs, func() table {
+		t := table{header: []string{"NAME", "SIZE", "TYPE", "MODIFIED"}}
+		for _, b := range blobs {
+			t.add(b.Name, formatBytes(b.Size), orDash(b.ContentType), orDash(b.LastModified))
+		}
+		return t
+	})
+}
+
+func (e *cliEnv) bucketsCopy(c *cli.Context) error {
+	if err := requireArgs(c, 2); err != nil {
+		return err
+	}
+	src, dst := c.Args().Get(0), c.Args().Get(1)
+	srcBucket, srcObject, srcRemote, err := parseRemote(src)
+	if err != nil {
+		return err
+	}
+	dstBucket, dstObject, dstRemote, err := parseRemote(dst)
+	if err != nil {
+		return err
+	}
+	if srcRemote == dstRemote {
+		return errors.New("exactly one of SOURCE and DESTINATION must be an oc:// path")
+	}
+
+	oc, err := e.client(c)
+	if err != nil {
+		return err
+	}
+
+	if dstRemote {
+		// Uploading: like cp, a destination naming only the bucket keeps
+		// the local file name.
+		if dstObject == "" {
+			if src == "-" {
+				return errors.New("uploading standard input needs an object name in DESTINATION")
+			}
+			dstObject += filepath.Base(src)
+		}
+		var r io.Reader = e.stdin
+		if src != "-" {
+			f, err := os.Open(src)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		if err := oc.UploadObject(e.ctx, dstBucket, dstObject, r); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stderr, "Uploaded %s to %s%s/%s\n", src, remotePrefix, dstBucket, dstObject)
+		return nil
+	}
+
+	if srcObject == "" {
+		return fmt.Errorf("%q names a bucket, not an object", src)
+	}
+	body, err := oc.DownloadObject(e.ctx, srcBucket, srcObject)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if dst == "-" {
+		_, err = io.Copy(e.stdout, body)
+		return err
+	}
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		dst = filepath.Join(dst, path.Base(srcObject))
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Downloaded %s to %s\n", src, dst)
+	return nil
+}
+
+func (e *cliEnv) bucketsRemove(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	arg := c.Args().First()
+	bucket, object, ok, err := parseRemote(arg)
+	if err == nil && !ok {
+		err = fmt.Errorf("%q is not an oc:// path", arg)
+	}
+	if err != nil {
+		return err
+	}
+	if object == "" && !c.Bool("recursive") {
+		return fmt.Errorf("%s is a bucket; use --recursive to delete it and everything in it", arg)
+	}
+
+	oc, err := e.client(c)
+	if err != nil {
+		return err
+	}
+	if object == "" {
+		err = oc.DeleteBucket(e.ctx, bucket)
+	} else {
+		err = oc.DeleteObject(e.ctx, bucket, object)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Deleted %s\n", arg)
+	return nil
+}
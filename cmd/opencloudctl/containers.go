@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/WavexSoftware/OpenCloud/api/compute"
+	"github.com/WavexSoftware/OpenCloud/client"
+	"github.com/urfave/cli"
+)
+
+func (e *cliEnv) containersCommand() cli.Command {
+	return cli.Command{
+		Name:  "containers",
+		Usage: "Manage containers",
+		Subcommands: []cli.Command{
+			{
+				Name:  "ls",
+				Usage: "List containers",
+				Action: func(c *cli.Context) error {
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					containers, err := oc.ListContainers(e.ctx)
+					if err != nil {
+						return err
+					}
+					return printResult(e.stdout, format(c), containers, func() table {
+						t := table{header: []string{"ID", "NAME", "IMAGE", "STATE", "CREATED"}}
+						for _, ctr := range containers {
+							id := ctr.ID
+							if len(id) > 12 {
+								id = id[:12]
+							}
+							t.add(id, strings.Join(ctr.Names, ","), ctr.Image, ctr.State, formatUnix(ctr.Created))
+						}
+						return t
+					})
+				},
+			},
+			{
+				Name:      "run",
+				Usage:     "Pull an image and start a container from it",
+				ArgsUsage: "IMAGE",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "name", Usage: "container name"},
+					cli.StringSliceFlag{Name: "publish, p", Usage: "publish a port as HOST:CONTAINER (repeatable)"},
+					cli.StringSliceFlag{Name: "env, e", Usage: "set an environment variable as KEY=VALUE (repeatable)"},
+					cli.StringSliceFlag{Name: "volume, v", Usage: "mount SOURCE:PATH[:OPTIONS] (repeatable)"},
+					cli.StringFlag{Name: "restart", Usage: "restart policy: no, always, on-failure or unless-stopped"},
+					cli.BoolFlag{Name: "rm", Usage: "remove the container when it exits"},
+					cli.StringFlag{Name: "command", Usage: "command to run instead of the image's default"},
+				},
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					events, err := oc.RunContainerStream(e.ctx, compute.PullAndRunRequest{
+						Image:         c.Args().First(),
+						Name:          c.String("name"),
+						Ports:         c.StringSlice("publish"),
+						Env:           c.StringSlice("env"),
+						Volumes:       c.StringSlice("volume"),
+						RestartPolicy: c.String("restart"),
+						AutoRemove:    c.Bool("rm"),
+						Command:       c.String("command"),
+					})
+					if err != nil {
+						return err
+					}
+					var res client.Result
+					if err := e.wait(c, events, &res); err != nil {
+						return err
+					}
+					if format(c) != "json" {
+						fmt.Fprintln(e.stdout, res["containerId"])
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "logs",
+				Usage:     "Print a container's logs",
+				ArgsUsage: "ID",
+				Flags: []cli.Flag{
+					cli.IntFlag{Name: "tail", Usage: "number of lines from the end to show (default: all)", Value: -1},
+				},
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					logs, err := oc.ContainerLogs(e.ctx, c.Args().First(), c.Int("tail"))
+					if err != nil {
+						return err
+					}
+					if format(c) == "json" {
+						return printJSON(e.stdout, map[string]string{"logs": logs})
+					}
+					_, err = fmt.Fprint(e.stdout, logs)
+					return err
+				},
+			},
+			{
+				Name:      "stop",
+				Usage:     "Stop a running container",
+				ArgsUsage: "ID",
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					id := c.Args().First()
+					if err := oc.StopContainer(e.ctx, id); err != nil {
+						return err
+					}
+					fmt.Fprintf(e.stderr, "Stopped %s\n", id)
+					return nil
+				},
+			},
+		},
+	}
+}
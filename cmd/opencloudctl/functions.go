@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/WavexSoftware/OpenCloud/api/compute"
+	"github.com/WavexSoftware/OpenCloud/client"
+	"github.com/WavexSoftware/OpenCloud/service_ledger"
+	"github.com/urfave/cli"
+)
+
+// runtimeByExtension guesses a function's runtime from its source file.
+var runtimeByExtension = map[string]string{
+	".py": "python",
+	".js": "node",
+	".go": "go",
+	".rb": "ruby",
+}
+
+func (e *cliEnv) functionsCommand() cli.Command {
+	return cli.Command{
+		Name:    "functions",
+		Aliases: []string{"fn"},
+		Usage:   "Manage functions",
+		Subcommands: []cli.Command{
+			{
+				Name:  "ls",
+				Usage: "List functions",
+				Action: func(c *cli.Context) error {
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					fns, err := oc.ListFunctions(e.ctx)
+					if err != nil {
+						return err
+					}
+					return printResult(e.stdout, format(c), fns, func() table {
+						t := table{header: []string{"NAME", "RUNTIME", "INVOCATIONS", "TRIGGER", "MODIFIED"}}
+						for _, fn := range fns {
+							t.add(fn.Name, fn.Runtime, strconv.Itoa(fn.Invocations), triggerText(fn.Trigger),
+								fn.LastModified.Local().Format("2006-01-02 15:04"))
+						}
+						return t
+					})
+				},
+			},
+			{
+				Name:      "create",
+				Usage:     "Create a function from a source file",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "file, f", Usage: "source file, or - for standard input"},
+					cli.StringFlag{Name: "runtime, r", Usage: "python, node, go or ruby (default: from the file extension)"},
+				},
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					file := c.String("file")
+					if file == "" {
+						return errors.New("--file is required")
+					}
+					code, err := e.readInput(file)
+					if err != nil {
+						return err
+					}
+					runtime := c.String("runtime")
+					if runtime == "" {
+						if runtime = runtimeByExtension[filepath.Ext(file)]; runtime == "" {
+							return errors.New("cannot tell the runtime from the file name; set --runtime")
+						}
+					}
+
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					fn, err := oc.CreateFunction(e.ctx, client.CreateFunctionRequest{
+						Name:    c.Args().First(),
+						Runtime: runtime,
+						Code:    string(code),
+					})
+					if err != nil {
+						return err
+					}
+					return printResult(e.stdout, format(c), fn, func() table {
+						t := table{header: []string{"NAME", "RUNTIME", "STATUS"}}
+						t.add(fn.Name, fn.Runtime, fn.Status)
+						return t
+					})
+				},
+			},
+			{
+				Name:      "invoke",
+				Usage:     "Run a function and print its output",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "data, d", Usage: "JSON object passed to the function on standard input"},
+				},
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					var input any
+					if data := c.String("data"); data != "" {
+						var object map[string]any
+						if err := json.Unmarshal([]byte(data), &object); err != nil {
+							return fmt.Errorf("--data must be a JSON object: %w", err)
+						}
+						input = object
+					}
+
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					output, err := oc.InvokeFunction(e.ctx, c.Args().First(), input)
+					if err != nil {
+						return err
+					}
+					if format(c) == "json" {
+						return printJSON(e.stdout, map[string]string{"output": output})
+					}
+					_, err = io.WriteString(e.stdout, output)
+					return err
+				},
+			},
+			{
+				Name:      "logs",
+				Usage:     "Show a function's invocation log",
+				ArgsUsage: "NAME",
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					logs, err := oc.FunctionLogs(e.ctx, c.Args().First())
+					if err != nil {
+						return err
+					}
+					return printResult(e.stdout, format(c), logs, func() table {
+						t := table{header: []string{"TIME", "STATUS", "OUTPUT"}}
+						for _, l := range logs {
+							t.add(l.Timestamp, l.Status, functionLogText(l))
+						}
+						return t
+					})
+				},
+			},
+		},
+	}
+}
+
+// triggerText describes a function's trigger for the table output.
+func triggerText(t *compute.Trigger) string {
+	if t == nil || !t.Enabled {
+		return "-"
+	}
+	return t.Type + " " + t.Schedule
+}
+
+// functionLogText is the output of an invocation, or its error.
+func functionLogText(l service_ledger.FunctionLog) string {
+	if l.Error != "" {
+		return l.Error
+	}
+	return l.Output
+}
+
+// readInput reads a file, or standard input for "-".
+func (e *cliEnv) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(e.stdin)
+	}
+	return os.ReadFile(path)
+}
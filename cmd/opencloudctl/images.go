@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/WavexSoftware/OpenCloud/api/storage"
+	"github.com/WavexSoftware/OpenCloud/client"
+	"github.com/urfave/cli"
+)
+
+func (e *cliEnv) imagesCommand() cli.Command {
+	return cli.Command{
+		Name:  "images",
+		Usage: "Manage container images",
+		Subcommands: []cli.Command{
+			{
+				Name:  "ls",
+				Usage: "List images",
+				Action: func(c *cli.Context) error {
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					images, err := oc.ListImages(e.ctx)
+					if err != nil {
+						return err
+					}
+					return printResult(e.stdout, format(c), images, func() table {
+						t := table{header: []string{"NAME", "ID", "SIZE", "CREATED"}}
+						for _, img := range images {
+							names := img.RepoTags
+							if len(names) == 0 {
+								names = []string{"<none>"}
+							}
+							id := strings.TrimPrefix(img.ID, "sha256:")
+							if len(id) > 12 {
+								id = id[:12]
+							}
+							for _, name := range names {
+								t.add(name, id, formatBytes(img.Size), formatUnix(img.Created))
+							}
+						}
+						return t
+					})
+				},
+			},
+			{
+				Name:      "build",
+				Usage:     "Build an image from a local build context",
+				ArgsUsage: "CONTEXT_DIR",
+				Description: "Every file under CONTEXT_DIR, except .git directories, is sent to the server\n" +
+					"   with the Dockerfile and the build output is shown as it runs.",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "tag, t", Usage: "name of the image, e.g. myapp:latest"},
+					cli.StringFlag{Name: "file, f", Usage: "Dockerfile (default: CONTEXT_DIR/Dockerfile)"},
+					cli.BoolFlag{Name: "no-cache", Usage: "do not use cached layers"},
+					cli.StringFlag{Name: "platform", Usage: "target platform, e.g. linux/arm64"},
+				},
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					if c.String("tag") == "" {
+						return errors.New("--tag is required")
+					}
+					dir := c.Args().First()
+					dockerfile := c.String("file")
+					if dockerfile == "" {
+						dockerfile = filepath.Join(dir, "Dockerfile")
+					}
+					df, err := os.ReadFile(dockerfile)
+					if err != nil {
+						return err
+					}
+					files, err := readBuildContext(dir)
+					if err != nil {
+						return err
+					}
+
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					events, err := oc.BuildImageStream(e.ctx, storage.BuildImageRequest{
+						Dockerfile: string(df),
+						ImageName:  c.String("tag"),
+						Files:      files,
+						NoCache:    c.Bool("no-cache"),
+						Platform:   c.String("platform"),
+					})
+					if err != nil {
+						return err
+					}
+					var res client.Result
+					if err := e.wait(c, events, &res); err != nil {
+						return err
+					}
+					if format(c) != "json" {
+						fmt.Fprintf(e.stderr, "Built %s\n", res["imageName"])
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "pull",
+				Usage:     "Pull an image from a registry",
+				ArgsUsage: "IMAGE",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "registry", Usage: "docker.io or quay.io", Value: "docker.io"},
+				},
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					events, err := oc.PullImageStream(e.ctx, storage.PullImageRequest{
+						ImageName: c.Args().First(),
+						Registry:  c.String("registry"),
+					})
+					if err != nil {
+						return err
+					}
+					var res client.Result
+					if err := e.wait(c, events, &res); err != nil {
+						return err
+					}
+					if format(c) != "json" {
+						fmt.Fprintf(e.stderr, "Pulled %s\n", res["imageName"])
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// readBuildContext reads the files under dir, keyed by slash-separated
+// paths relative to it.
+func readBuildContext(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build context: %w", err)
+	}
+	return files, nil
+}
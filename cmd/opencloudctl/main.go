@@ -0,0 +1,209 @@
+// Command opencloudctl manages an OpenCloud server from the command line.
+//
+// Run "opencloudctl login --server URL" once; the server and token are saved
+// in a profile and used by every other command:
+//
+//	opencloudctl functions create hello --runtime python --file hello.py
+//	opencloudctl functions invoke hello.py --data '{"name": "world"}'
+//	opencloudctl buckets cp ./report.pdf oc://reports/report-2024.pdf
+//	opencloudctl images build -t myapp:latest .
+//	opencloudctl -o json containers ls
+//	opencloudctl --project web functions ls
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/WavexSoftware/OpenCloud/client"
+	"github.com/urfave/cli"
+	"golang.org/x/term"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app := newApp(ctx, os.Stdin, os.Stdout, os.Stderr)
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// cliEnv is what commands read from and write to.  Tests substitute buffers.
+type cliEnv struct {
+	ctx    context.Context
+	stdin  *bufio.Reader
+	rawIn  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// newApp returns the opencloudctl application.
+func newApp(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) *cli.App {
+	e := &cliEnv{ctx: ctx, stdin: bufio.NewReader(stdin), rawIn: stdin, stdout: stdout, stderr: stderr}
+
+	app := cli.NewApp()
+	app.Name = "opencloudctl"
+	app.Usage = "Manage an OpenCloud server"
+	app.HideVersion = true
+	app.Writer = stdout
+	app.ErrWriter = stderr
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "profile, P",
+			Usage:  "profile holding the server URL and token",
+			Value:  "default",
+			EnvVar: "OPENCLOUDCTL_PROFILE",
+		},
+		cli.StringFlag{
+			Name:   "server",
+			Usage:  "server URL, overriding the profile's",
+			EnvVar: "OPENCLOUDCTL_SERVER",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "access token, overriding the profile's",
+			EnvVar: "OPENCLOUDCTL_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "project",
+			Usage:  "project to work in; resources outside it are not listed or changed",
+			EnvVar: "OPENCLOUDCTL_PROJECT",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "output format: table or json",
+			Value: "table",
+		},
+		cli.StringFlag{
+			Name:   "idempotency-key",
+			Usage:  "key that makes retrying a create safe: the server replays the first result instead of creating again",
+			EnvVar: "OPENCLOUDCTL_IDEMPOTENCY_KEY",
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		if f := c.String("output"); f != "table" && f != "json" {
+			return fmt.Errorf("unknown output format %q; use table or json", f)
+		}
+		if key := c.String("idempotency-key"); key != "" {
+			e.ctx = client.WithIdempotencyKey(e.ctx, key)
+		}
+		if project := c.String("project"); project != "" {
+			e.ctx = client.WithProject(e.ctx, project)
+		}
+		return nil
+	}
+	app.Commands = []cli.Command{
+		e.loginCommand(),
+		e.logoutCommand(),
+		e.functionsCommand(),
+		e.bucketsCommand(),
+		e.pipelinesCommand(),
+		e.imagesCommand(),
+		e.containersCommand(),
+		e.servicesCommand(),
+		e.projectsCommand(),
+		e.backupCommand(),
+	}
+	return app
+}
+
+// client returns an API client for the selected profile.  Renewed session
+// tokens are saved back to the profile.
+func (e *cliEnv) client(c *cli.Context) (*client.Client, error) {
+	name := c.GlobalString("profile")
+	pf, err := readProfiles()
+	if err != nil {
+		return nil, err
+	}
+	p := pf.Profiles[name]
+
+	server := c.GlobalString("server")
+	if server == "" {
+		server = p.Server
+	}
+	if server == "" {
+		return nil, fmt.Errorf("no server configured for profile %q; run \"opencloudctl login --server URL\"", name)
+	}
+
+	opts := []client.Option{client.WithUserAgent("opencloudctl")}
+	if token := c.GlobalString("token"); token != "" {
+		opts = append(opts, client.WithAccessToken(token))
+	} else if p.Token != "" {
+		opts = append(opts,
+			client.WithAccessToken(p.Token),
+			client.OnTokenRefresh(func(token string) {
+				if err := updateProfile(name, func(p *profile) { p.Token = token }); err != nil {
+					fmt.Fprintf(e.stderr, "Warning: failed to save the renewed token: %v\n", err)
+				}
+			}),
+		)
+	}
+	return client.New(server, opts...)
+}
+
+// format returns the selected output format.
+func format(c *cli.Context) string {
+	return c.GlobalString("output")
+}
+
+// readLine prompts for and reads one line from standard input.
+func (e *cliEnv) readLine(prompt string) (string, error) {
+	if prompt != "" {
+		fmt.Fprint(e.stderr, prompt)
+	}
+	line, err := e.stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errors.New("unexpected end of input")
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readSecret prompts for a secret, without echoing it when standard input
+// is a terminal.
+func (e *cliEnv) readSecret(prompt string) (string, error) {
+	if f, ok := e.rawIn.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(e.stderr, prompt)
+		secret, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(e.stderr)
+		return string(secret), err
+	}
+	return e.readLine(prompt)
+}
+
+// requireArgs fails unless the command got exactly n arguments.
+func requireArgs(c *cli.Context, n int) error {
+	if c.NArg() != n {
+		return fmt.Errorf("%s expects %d argument(s): %s", c.Command.FullName(), n, c.Command.ArgsUsage)
+	}
+	return nil
+}
+
+// wait waits for a streamed operation and decodes its result into out.
+// Progress goes to standard output, or to standard error in the json output
+// format, where the result is printed instead.
+func (e *cliEnv) wait(c *cli.Context, events <-chan client.Event, out any) error {
+	progress := e.stdout
+	if format(c) == "json" {
+		progress = e.stderr
+	}
+	if err := client.Wait(events, func(line string) { fmt.Fprintln(progress, line) }, out); err != nil {
+		return err
+	}
+	if format(c) == "json" {
+		return printJSON(e.stdout, out)
+	}
+	return nil
+}
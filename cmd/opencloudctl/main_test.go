@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	opencloudapi "github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/backup"
+	"github.com/WavexSoftware/OpenCloud/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// run runs opencloudctl with args and returns what it wrote to standard
+// output and standard error.
+func run(t *testing.T, stdin string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	app := newApp(context.Background(), strings.NewReader(stdin), &out, &errOut)
+	err = app.Run(append([]string{"opencloudctl"}, args...))
+	return out.String(), errOut.String(), err
+}
+
+// useProfiles points the profile file at a temporary directory.
+func useProfiles(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "opencloudctl.json")
+	t.Setenv("OPENCLOUDCTL_CONFIG", path)
+	for _, name := range []string{"OPENCLOUDCTL_PROFILE", "OPENCLOUDCTL_SERVER", "OPENCLOUDCTL_TOKEN", "OPENCLOUDCTL_PROJECT"} {
+		t.Setenv(name, "") // restores the variable afterwards
+		os.Unsetenv(name)
+	}
+	return path
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	path := useProfiles(t)
+
+	dataDir := t.TempDir()
+	utils.SetDataDir(dataDir)
+	t.Cleanup(func() { utils.SetDataDir("") })
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dataDir, "user"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	line := "admin:" + string(hash) + ":role=admin\n"
+	if err := os.WriteFile(filepath.Join(dataDir, "user", "credentials"), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/login", opencloudapi.Login)
+	mux.HandleFunc("/user/logout", opencloudapi.Logout)
+	root := http.NewServeMux()
+	root.Handle("/api/v1/", opencloudapi.V1Handler(opencloudapi.RequireAuth(mux)))
+	srv := httptest.NewServer(apierror.WithRequestID(root))
+	defer srv.Close()
+
+	if _, _, err := run(t, "wrong password\n", "--server", srv.URL, "login", "-u", "admin", "--password-stdin"); err == nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("failed login wrote the profile file: %v", err)
+	}
+
+	_, stderr, err := run(t, "s3cret password\n", "--server", srv.URL, "login", "-u", "admin", "--password-stdin")
+	if err != nil {
+		t.Fatalf("login: %v (%s)", err, stderr)
+	}
+	pf, err := readProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pf.Profiles["default"]
+	if p.Server != srv.URL || p.Token == "" {
+		t.Fatalf("profile after login = %+v", p)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("profile file mode = %v, want 0600", mode)
+	}
+
+	if _, stderr, err := run(t, "", "logout"); err != nil {
+		t.Fatalf("logout: %v (%s)", err, stderr)
+	}
+	if pf, err = readProfiles(); err != nil {
+		t.Fatal(err)
+	}
+	if p := pf.Profiles["default"]; p.Server != srv.URL || p.Token != "" {
+		t.Errorf("profile after logout = %+v", p)
+	}
+}
+
+func TestLoginChangesRequiredPassword(t *testing.T) {
+	useProfiles(t)
+
+	dataDir := t.TempDir()
+	utils.SetDataDir(dataDir)
+	t.Cleanup(func() { utils.SetDataDir("") })
+	hash, err := bcrypt.GenerateFromPassword([]byte("initial password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dataDir, "user"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	line := "admin:" + string(hash) + ":must_change_password,role=admin\n"
+	if err := os.WriteFile(filepath.Join(dataDir, "user", "credentials"), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/login", opencloudapi.Login)
+	mux.HandleFunc("/user/change-password", opencloudapi.ChangePassword)
+	root := http.NewServeMux()
+	root.Handle("/api/v1/", opencloudapi.V1Handler(opencloudapi.RequireAuth(mux)))
+	srv := httptest.NewServer(apierror.WithRequestID(root))
+	defer srv.Close()
+
+	_, stderr, err := run(t, "initial password\nreplacement password\n", "--server", srv.URL, "login", "-u", "admin", "--password-stdin")
+	if err != nil {
+		t.Fatalf("login: %v (%s)", err, stderr)
+	}
+	if !strings.Contains(stderr, "must be changed") {
+		t.Errorf("stderr = %q, want a note about the password change", stderr)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, "user", "credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "must_change_password") {
+		t.Errorf("credentials still require a password change: %s", data)
+	}
+	fields := strings.SplitN(strings.TrimSpace(string(data)), ":", 3)
+	if len(fields) < 2 || bcrypt.CompareHashAndPassword([]byte(fields[1]), []byte("replacement password")) != nil {
+		t.Errorf("credentials do not hold the new password: %s", data)
+	}
+}
+
+// fakeServer serves canned API responses and records the token of the last
+// request.
+type fakeServer struct {
+	*httptest.Server
+	token   string
+	project string
+	objects map[string]string
+	backup  []byte
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	fs := &fakeServer{objects: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/functions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"name":"hello.py","runtime":"python","invocations":3,"lastModified":"2024-01-02T03:04:05Z"}]`)
+	})
+	mux.HandleFunc("POST /api/v1/buckets/{bucket}/objects", func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			apierror.Respond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		data, _ := io.ReadAll(file)
+		fs.objects[r.PathValue("bucket")+"/"+header.Filename] = string(data)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"message":"uploaded"}`)
+	})
+	mux.HandleFunc("GET /api/v1/buckets/{bucket}/objects/{name}", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := fs.objects[r.PathValue("bucket")+"/"+r.PathValue("name")]
+		if !ok {
+			apierror.Respond(w, r, http.StatusNotFound, "Object not found")
+			return
+		}
+		io.WriteString(w, data)
+	})
+	mux.HandleFunc("GET /api/v1/projects", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"name":"default","members":{},"role":"admin"},{"name":"web","description":"Web team","members":{"bob":"viewer","alice":"developer"},"role":"admin"}]`)
+	})
+	mux.HandleFunc("PUT /api/v1/projects/{name}/members/{username}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Role string `json:"role"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"name": r.PathValue("name"), "members": map[string]string{r.PathValue("username"): req.Role}, "role": "admin"})
+	})
+	mux.HandleFunc("GET /api/v1/system/backup", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(fs.backup)
+	})
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.token = r.Header.Get("AccessToken")
+		fs.project = r.URL.Query().Get("project")
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			fs.token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func TestOutputFormats(t *testing.T) {
+	useProfiles(t)
+	srv := newFakeServer(t)
+
+	stdout, _, err := run(t, "", "--server", srv.URL, "functions", "ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "NAME") || !strings.HasPrefix(lines[1], "hello.py") {
+		t.Errorf("table output = %q", stdout)
+	}
+
+	stdout, _, err = run(t, "", "--server", srv.URL, "-o", "json", "functions", "ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fns []struct {
+		Name        string `json:"name"`
+		Invocations int    `json:"invocations"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &fns); err != nil || len(fns) != 1 || fns[0].Invocations != 3 {
+		t.Errorf("json output = %q (%v)", stdout, err)
+	}
+
+	if _, _, err := run(t, "", "--server", srv.URL, "-o", "yaml", "functions", "ls"); err == nil {
+		t.Error("unknown output format was accepted")
+	}
+}
+
+func TestTokenOverride(t *testing.T) {
+	useProfiles(t)
+	srv := newFakeServer(t)
+	if err := updateProfile("default", func(p *profile) { p.Server, p.Token = srv.URL, "profile-token" }); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := run(t, "", "functions", "ls"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.token != "profile-token" {
+		t.Errorf("token sent = %q, want the profile's", srv.token)
+	}
+
+	if _, _, err := run(t, "", "--token", "ocp_override", "functions", "ls"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.token != "ocp_override" {
+		t.Errorf("token sent = %q, want the --token value", srv.token)
+	}
+}
+
+func TestProjects(t *testing.T) {
+	useProfiles(t)
+	srv := newFakeServer(t)
+
+	stdout, _, err := run(t, "", "--server", srv.URL, "projects", "ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[2], "web") || !strings.Contains(lines[2], "alice=developer,bob=viewer") {
+		t.Errorf("projects ls = %q", stdout)
+	}
+
+	stdout, _, err = run(t, "", "--server", srv.URL, "projects", "members", "add", "--role", "developer", "web", "carol")
+	if err != nil || !strings.Contains(stdout, "carol=developer") {
+		t.Errorf("projects members add = %q, %v", stdout, err)
+	}
+	if _, _, err := run(t, "", "--server", srv.URL, "projects", "members", "add", "web"); err == nil {
+		t.Error("projects members add without a user succeeded")
+	}
+
+	// The selected project is sent with every request.
+	if _, _, err := run(t, "", "--server", srv.URL, "--project", "web", "functions", "ls"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.project != "web" {
+		t.Errorf("project sent = %q, want web", srv.project)
+	}
+	t.Setenv("OPENCLOUDCTL_PROJECT", "api")
+	if _, _, err := run(t, "", "--server", srv.URL, "functions", "ls"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.project != "api" {
+		t.Errorf("project sent = %q, want the OPENCLOUDCTL_PROJECT value", srv.project)
+	}
+}
+
+func TestBucketsCopy(t *testing.T) {
+	useProfiles(t)
+	srv := newFakeServer(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(src, []byte("quarterly numbers"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, stderr, err := run(t, "", "--server", srv.URL, "buckets", "cp", src, "oc://reports"); err != nil {
+		t.Fatalf("upload: %v (%s)", err, stderr)
+	}
+	if got := srv.objects["reports/report.txt"]; got != "quarterly numbers" {
+		t.Fatalf("uploaded object = %q", got)
+	}
+
+	if _, _, err := run(t, "from stdin", "--server", srv.URL, "buckets", "cp", "-", "oc://reports/notes.txt"); err != nil {
+		t.Fatalf("upload from stdin: %v", err)
+	}
+	if got := srv.objects["reports/notes.txt"]; got != "from stdin" {
+		t.Fatalf("uploaded object = %q", got)
+	}
+
+	stdout, _, err := run(t, "", "--server", srv.URL, "buckets", "cp", "oc://reports/notes.txt", "-")
+	if err != nil || stdout != "from stdin" {
+		t.Fatalf("download to stdout = %q, %v", stdout, err)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := run(t, "", "--server", srv.URL, "buckets", "cp", "oc://reports/report.txt", out); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(out, "report.txt")); err != nil || string(data) != "quarterly numbers" {
+		t.Errorf("downloaded file = %q, %v", data, err)
+	}
+
+	if _, _, err := run(t, "", "--server", srv.URL, "buckets", "cp", "oc://reports/missing", "-"); err == nil {
+		t.Error("downloading a missing object succeeded")
+	}
+	if _, _, err := run(t, "", "--server", srv.URL, "buckets", "cp", src, dir); err == nil {
+		t.Error("copying between two local paths succeeded")
+	}
+
+	// The server has no folders in buckets; the name is refused before
+	// anything is sent.
+	if _, _, err := run(t, "", "--server", srv.URL, "buckets", "cp", src, "oc://reports/2024/report.txt"); err == nil {
+		t.Error("uploading to a nested object name succeeded")
+	}
+	if _, ok := srv.objects["reports/2024/report.txt"]; ok {
+		t.Error("nested object name reached the server")
+	}
+	if _, _, err := run(t, "", "--server", srv.URL, "buckets", "cp", "oc://reports/2024/report.txt", "-"); err == nil {
+		t.Error("downloading a nested object name succeeded")
+	}
+}
+
+func TestBackup(t *testing.T) {
+	useProfiles(t)
+	srv := newFakeServer(t)
+	dir := t.TempDir()
+	utils.SetDataDir(filepath.Join(dir, "data"))
+	t.Cleanup(func() { utils.SetDataDir("") })
+	if err := os.MkdirAll(filepath.Join(dir, "data", "user"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if _, err := backup.Write(context.Background(), &archive, backup.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.backup = archive.Bytes()
+	dst := filepath.Join(dir, "instance.tar.gz")
+	if _, stderr, err := run(t, "", "--server", srv.URL, "backup", dst); err != nil || !strings.Contains(stderr, "Saved backup") {
+		t.Fatalf("backup: %v (%s)", err, stderr)
+	}
+	if data, err := os.ReadFile(dst); err != nil || !bytes.Equal(data, archive.Bytes()) {
+		t.Errorf("saved archive differs from the download: %v", err)
+	}
+
+	// A download cut short is not kept.
+	srv.backup = archive.Bytes()[:archive.Len()/2]
+	cut := filepath.Join(dir, "cut.tar.gz")
+	if _, _, err := run(t, "", "--server", srv.URL, "backup", cut); err == nil {
+		t.Error("backup of a truncated archive succeeded")
+	}
+	if _, err := os.Stat(cut); !os.IsNotExist(err) {
+		t.Errorf("truncated archive was kept: %v", err)
+	}
+	if _, err := os.Stat(cut + ".partial"); !os.IsNotExist(err) {
+		t.Errorf("partial download was left behind: %v", err)
+	}
+}
+
+func TestReadBuildContext(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"Dockerfile":  "FROM alpine\n",
+		"app/main.py": "print('hi')\n",
+		".git/HEAD":   "ref: refs/heads/main\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := readBuildContext(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files["app/main.py"] != "print('hi')\n" || files["Dockerfile"] == "" {
+		t.Errorf("readBuildContext = %v", files)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// table is a command's result as rows for the table output format.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// add appends a row.
+func (t *table) add(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// printResult writes v as indented JSON in the json output format, and
+// otherwise writes the table built by rows.
+func printResult(w io.Writer, format string, v any, rows func() table) error {
+	if format == "json" {
+		return printJSON(w, v)
+	}
+	t := rows()
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		for i, cell := range row {
+			// Keep multi-line values, such as function output, on one row.
+			row[i] = strings.ReplaceAll(strings.TrimSpace(cell), "\n", " ")
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printJSON writes v as indented JSON.
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// formatBytes formats a size in bytes with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatUnix formats a Unix timestamp, or "-" for none.
+func formatUnix(sec int64) string {
+	if sec == 0 {
+		return "-"
+	}
+	return time.Unix(sec, 0).Local().Format("2006-01-02 15:04")
+}
+
+// orDash returns s, or "-" when it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
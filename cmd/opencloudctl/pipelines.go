@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+func (e *cliEnv) pipelinesCommand() cli.Command {
+	return cli.Command{
+		Name:  "pipelines",
+		Usage: "Manage CI/CD pipelines",
+		Subcommands: []cli.Command{
+			{
+				Name:  "ls",
+				Usage: "List pipelines",
+				Action: func(c *cli.Context) error {
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					pipelines, err := oc.ListPipelines(e.ctx)
+					if err != nil {
+						return err
+					}
+					return printResult(e.stdout, format(c), pipelines, func() table {
+						t := table{header: []string{"ID", "NAME", "BRANCH", "STATUS", "LAST RUN", "DURATION"}}
+						for _, p := range pipelines {
+							lastRun := "-"
+							if p.LastRun != nil {
+								lastRun = p.LastRun.Local().Format("2006-01-02 15:04")
+							}
+							t.add(p.ID, p.Name, orDash(p.Branch), p.Status, lastRun, orDash(p.Duration))
+						}
+						return t
+					})
+				},
+			},
+			{
+				Name:        "run",
+				Usage:       "Start a pipeline run",
+				ArgsUsage:   "ID",
+				Description: "The run continues on the server; follow it with \"opencloudctl pipelines logs ID\".",
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					id := c.Args().First()
+					if err := oc.RunPipeline(e.ctx, id); err != nil {
+						return err
+					}
+					fmt.Fprintf(e.stderr, "Started pipeline %s\n", id)
+					return nil
+				},
+			},
+			{
+				Name:      "logs",
+				Usage:     "Show a pipeline's run log",
+				ArgsUsage: "ID",
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					logs, err := oc.PipelineLogs(e.ctx, c.Args().First())
+					if err != nil {
+						return err
+					}
+					if format(c) == "json" {
+						return printJSON(e.stdout, logs)
+					}
+					// Run output is multi-line, so it is printed as is
+					// rather than squeezed into a table.
+					for _, l := range logs {
+						fmt.Fprintf(e.stdout, "=== %s %s\n", l.Timestamp, l.Status)
+						if l.Output != "" {
+							fmt.Fprintln(e.stdout, l.Output)
+						}
+						if l.Error != "" {
+							fmt.Fprintln(e.stdout, l.Error)
+						}
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// profile is a saved server and the token used to talk to it.
+type profile struct {
+	Server string `json:"server"`
+	Token  string `json:"token,omitempty"`
+}
+
+// profileFile is the on-disk layout of the profile file.
+//
+// Example:
+//
+//	{
+//	    "profiles": {
+//	        "default": {"server": "https://cloud.example.com", "token": "..."},
+//	        "lab": {"server": "http://10.0.0.5:3030", "token": "ocp_..."}
+//	    }
+//	}
+type profileFile struct {
+	Profiles map[string]profile `json:"profiles"`
+}
+
+// profilePath returns the path of the profile file: OPENCLOUDCTL_CONFIG when
+// set, otherwise opencloud/opencloudctl.json in the user's config directory.
+func profilePath() (string, error) {
+	if path := os.Getenv("OPENCLOUDCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the config directory: %w", err)
+	}
+	return filepath.Join(dir, "opencloud", "opencloudctl.json"), nil
+}
+
+// readProfiles reads the profile file.  A missing file has no profiles.
+func readProfiles() (*profileFile, error) {
+	path, err := profilePath()
+	if err != nil {
+		return nil, err
+	}
+	pf := &profileFile{Profiles: map[string]profile{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, pf); err != nil {
+		return nil, fmt.Errorf("invalid profile file %s: %w", path, err)
+	}
+	if pf.Profiles == nil {
+		pf.Profiles = map[string]profile{}
+	}
+	return pf, nil
+}
+
+// writeProfiles saves pf.  The file holds tokens, so only the user may read
+// it.
+func writeProfiles(pf *profileFile) error {
+	path, err := profilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pf, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// updateProfile applies fn to the named profile and saves the result.
+func updateProfile(name string, fn func(p *profile)) error {
+	pf, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	p := pf.Profiles[name]
+	fn(&p)
+	pf.Profiles[name] = p
+	return writeProfiles(pf)
+}
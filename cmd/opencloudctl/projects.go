@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/WavexSoftware/OpenCloud/client"
+	"github.com/urfave/cli"
+)
+
+func (e *cliEnv) projectsCommand() cli.Command {
+	return cli.Command{
+		Name:  "projects",
+		Usage: "Manage projects; select the project other commands work in with --project",
+		Subcommands: []cli.Command{
+			{
+				Name:   "ls",
+				Usage:  "List the projects you can reach",
+				Action: e.projectsList,
+			},
+			{
+				Name:      "create",
+				Usage:     "Create a project",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "description, d", Usage: "what the project is for"},
+				},
+				Action: e.projectsCreate,
+			},
+			{
+				Name:      "rm",
+				Usage:     "Delete a project, which must hold no resources",
+				ArgsUsage: "NAME",
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					if err := oc.DeleteProject(e.ctx, c.Args().First()); err != nil {
+						return err
+					}
+					fmt.Fprintf(e.stderr, "Deleted project %s\n", c.Args().First())
+					return nil
+				},
+			},
+			{
+				Name:  "members",
+				Usage: "Grant or revoke users' access to a project",
+				Subcommands: []cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Grant a user a role in a project",
+						ArgsUsage: "PROJECT USERNAME",
+						Flags: []cli.Flag{
+							cli.StringFlag{Name: "role", Usage: "developer or viewer", Value: "viewer"},
+						},
+						Action: func(c *cli.Context) error {
+							if err := requireArgs(c, 2); err != nil {
+								return err
+							}
+							oc, err := e.client(c)
+							if err != nil {
+								return err
+							}
+							project, err := oc.SetProjectMember(e.ctx, c.Args().Get(0), c.Args().Get(1), c.String("role"))
+							if err != nil {
+								return err
+							}
+							return e.printProject(c, project)
+						},
+					},
+					{
+						Name:      "rm",
+						Usage:     "Revoke a user's access to a project",
+						ArgsUsage: "PROJECT USERNAME",
+						Action: func(c *cli.Context) error {
+							if err := requireArgs(c, 2); err != nil {
+								return err
+							}
+							oc, err := e.client(c)
+							if err != nil {
+								return err
+							}
+							project, err := oc.RemoveProjectMember(e.ctx, c.Args().Get(0), c.Args().Get(1))
+							if err != nil {
+								return err
+							}
+							return e.printProject(c, project)
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (e *cliEnv) projectsList(c *cli.Context) error {
+	oc, err := e.client(c)
+	if err != nil {
+		return err
+	}
+	projects, err := oc.ListProjects(e.ctx)
+	if err != nil {
+		return err
+	}
+	return printResult(e.stdout, format(c), projects, func() table {
+		t := table{header: []string{"NAME", "ROLE", "MEMBERS", "DESCRIPTION"}}
+		for _, p := range projects {
+			t.add(p.Name, p.Role, orDash(formatMembers(p.Members)), orDash(p.Description))
+		}
+		return t
+	})
+}
+
+func (e *cliEnv) projectsCreate(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	oc, err := e.client(c)
+	if err != nil {
+		return err
+	}
+	project, err := oc.CreateProject(e.ctx, client.CreateProjectRequest{Name: c.Args().First(), Description: c.String("description")})
+	if err != nil {
+		return err
+	}
+	return e.printProject(c, project)
+}
+
+// printProject prints a single project.
+func (e *cliEnv) printProject(c *cli.Context, p *client.Project) error {
+	return printResult(e.stdout, format(c), p, func() table {
+		t := table{header: []string{"NAME", "MEMBERS", "DESCRIPTION"}}
+		t.add(p.Name, orDash(formatMembers(p.Members)), orDash(p.Description))
+		return t
+	})
+}
+
+// formatMembers lists project members as "user=role", sorted by user.
+func formatMembers(members map[string]string) string {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + members[name]
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/WavexSoftware/OpenCloud/client"
+	"github.com/urfave/cli"
+)
+
+func (e *cliEnv) servicesCommand() cli.Command {
+	return cli.Command{
+		Name:  "services",
+		Usage: "Manage optional services",
+		Subcommands: []cli.Command{
+			{
+				Name:      "status",
+				Usage:     "Show whether a service is enabled",
+				ArgsUsage: "NAME",
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					status, err := oc.GetServiceStatus(e.ctx, c.Args().First())
+					if err != nil {
+						return err
+					}
+					return printResult(e.stdout, format(c), status, func() table {
+						t := table{header: []string{"SERVICE", "ENABLED"}}
+						t.add(status.Service, fmt.Sprint(status.Enabled))
+						return t
+					})
+				},
+			},
+			{
+				Name:      "enable",
+				Usage:     "Enable a service, installing what it needs",
+				ArgsUsage: "NAME",
+				Action: func(c *cli.Context) error {
+					if err := requireArgs(c, 1); err != nil {
+						return err
+					}
+					oc, err := e.client(c)
+					if err != nil {
+						return err
+					}
+					events, err := oc.EnableServiceStream(e.ctx, c.Args().First())
+					if err != nil {
+						return err
+					}
+					var status client.ServiceStatus
+					if err := e.wait(c, events, &status); err != nil {
+						return err
+					}
+					if format(c) != "json" {
+						fmt.Fprintf(e.stderr, "Enabled %s\n", status.Service)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,329 @@
+// Package config resolves the server settings from defaults, an optional
+// JSON config file, OPENCLOUD_* environment variables and command-line
+// flags, in increasing order of precedence.
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WavexSoftware/OpenCloud/logging"
+)
+
+// Duration is a time.Duration written as a Go duration string ("30s", "5m")
+// in the config file.
+type Duration time.Duration
+
+// MarshalJSON writes d as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON parses a duration string such as "30s".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config holds the server settings.
+//
+// Example config file:
+//
+//	{
+//	    "listenAddress": "0.0.0.0:3030",
+//	    "tlsCertFile": "/etc/opencloud/tls.crt",
+//	    "tlsKeyFile": "/etc/opencloud/tls.key",
+//	    "shutdownTimeout": "2m",
+//	    "dataDir": "/srv/opencloud",
+//	    "blobStorageDir": "/mnt/bulk/opencloud-blobs",
+//	    "logLevel": "debug",
+//	    "logFormat": "json",
+//	    "trustedProxies": "127.0.0.1, ::1"
+//	}
+type Config struct {
+	// ListenAddress is the host:port the API listens on.
+	ListenAddress string `json:"listenAddress,omitempty"`
+	// TLSCertFile and TLSKeyFile enable native HTTPS when both are set.
+	TLSCertFile string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `json:"tlsKeyFile,omitempty"`
+
+	// Timeouts applied by the HTTP server; zero disables a timeout.  Write
+	// and read timeouts are off by default because image builds and pulls
+	// stream their output for several minutes.
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout,omitempty"`
+	ReadTimeout       Duration `json:"readTimeout,omitempty"`
+	WriteTimeout      Duration `json:"writeTimeout,omitempty"`
+	IdleTimeout       Duration `json:"idleTimeout,omitempty"`
+	// ShutdownTimeout bounds how long a SIGTERM waits for in-flight requests
+	// and running pipelines before they are cancelled.
+	ShutdownTimeout Duration `json:"shutdownTimeout,omitempty"`
+
+	// DataDir holds functions, pipelines, blob storage, logs and user data.
+	DataDir string `json:"dataDir,omitempty"`
+	// The subsystem directories default to subdirectories of DataDir
+	// named functions, pipelines, blob_storage and logs.
+	FunctionsDir   string `json:"functionsDir,omitempty"`
+	PipelinesDir   string `json:"pipelinesDir,omitempty"`
+	BlobStorageDir string `json:"blobStorageDir,omitempty"`
+	LogsDir        string `json:"logsDir,omitempty"`
+
+	// LogLevel is the least severe level logged: debug, info, warn or
+	// error.  LogFormat is text or json.
+	LogLevel  string `json:"logLevel,omitempty"`
+	LogFormat string `json:"logFormat,omitempty"`
+
+	// TrustedProxies is a comma-separated list of the addresses and CIDR
+	// ranges of reverse proxies in front of the API.  Requests from them
+	// are attributed to the client named in X-Forwarded-For or X-Real-IP;
+	// those headers are ignored from any other peer.
+	TrustedProxies string `json:"trustedProxies,omitempty"`
+
+	// WebhookAllowedNetworks is a comma-separated list of addresses and
+	// CIDR ranges that webhooks may deliver to even though they are
+	// loopback, private or link-local.  Such addresses are refused by
+	// default so webhooks cannot be used to reach internal services.
+	WebhookAllowedNetworks string `json:"webhookAllowedNetworks,omitempty"`
+}
+
+// Default returns the built-in settings.  The API listens on localhost only;
+// external access is expected to go through nginx or Next.js.
+func Default() *Config {
+	cfg := &Config{
+		ListenAddress:     "localhost:3030",
+		ReadHeaderTimeout: Duration(10 * time.Second),
+		IdleTimeout:       Duration(2 * time.Minute),
+		ShutdownTimeout:   Duration(time.Minute),
+		LogLevel:          "info",
+		LogFormat:         "text",
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		cfg.DataDir = filepath.Join(home, ".opencloud")
+	}
+	return cfg
+}
+
+// defaultConfigPath is read when neither -config nor OPENCLOUD_CONFIG is
+// given.  It is optional.
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".opencloud", "config.json")
+}
+
+// setting ties one config field to its flag and environment variable.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	str   *string
+	dur   *Duration
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{flag: "listen", env: "OPENCLOUD_LISTEN_ADDRESS", usage: "address to listen on", str: &c.ListenAddress},
+		{flag: "tls-cert", env: "OPENCLOUD_TLS_CERT_FILE", usage: "TLS certificate file (enables HTTPS)", str: &c.TLSCertFile},
+		{flag: "tls-key", env: "OPENCLOUD_TLS_KEY_FILE", usage: "TLS private key file", str: &c.TLSKeyFile},
+		{flag: "read-header-timeout", env: "OPENCLOUD_READ_HEADER_TIMEOUT", usage: "time allowed to read request headers", dur: &c.ReadHeaderTimeout},
+		{flag: "read-timeout", env: "OPENCLOUD_READ_TIMEOUT", usage: "time allowed to read a whole request (0 for none)", dur: &c.ReadTimeout},
+		{flag: "write-timeout", env: "OPENCLOUD_WRITE_TIMEOUT", usage: "time allowed to write a response (0 for none)", dur: &c.WriteTimeout},
+		{flag: "idle-timeout", env: "OPENCLOUD_IDLE_TIMEOUT", usage: "keep-alive idle timeout", dur: &c.IdleTimeout},
+		{flag: "shutdown-timeout", env: "OPENCLOUD_SHUTDOWN_TIMEOUT", usage: "time to drain in-flight work on SIGTERM", dur: &c.ShutdownTimeout},
+		{flag: "data-dir", env: "OPENCLOUD_DATA_DIR", usage: "directory for OpenCloud data", str: &c.DataDir},
+		{flag: "functions-dir", env: "OPENCLOUD_FUNCTIONS_DIR", usage: "directory for function code (default <data dir>/functions)", str: &c.FunctionsDir},
+		{flag: "pipelines-dir", env: "OPENCLOUD_PIPELINES_DIR", usage: "directory for pipeline runs (default <data dir>/pipelines)", str: &c.PipelinesDir},
+		{flag: "blob-storage-dir", env: "OPENCLOUD_BLOB_STORAGE_DIR", usage: "directory for blob storage buckets (default <data dir>/blob_storage)", str: &c.BlobStorageDir},
+		{flag: "logs-dir", env: "OPENCLOUD_LOGS_DIR", usage: "directory for logs (default <data dir>/logs)", str: &c.LogsDir},
+		{flag: "log-level", env: "OPENCLOUD_LOG_LEVEL", usage: "least severe level logged: debug, info, warn or error", str: &c.LogLevel},
+		{flag: "log-format", env: "OPENCLOUD_LOG_FORMAT", usage: "log output format: text or json", str: &c.LogFormat},
+		{flag: "trusted-proxies", env: "OPENCLOUD_TRUSTED_PROXIES", usage: "comma-separated addresses and CIDR ranges of reverse proxies whose forwarding headers are believed", str: &c.TrustedProxies},
+		{flag: "webhook-allowed-networks", env: "OPENCLOUD_WEBHOOK_ALLOWED_NETWORKS", usage: "comma-separated internal addresses and CIDR ranges that webhooks may deliver to", str: &c.WebhookAllowedNetworks},
+	}
+}
+
+// set parses value into the setting's field.
+func (s setting) set(value string) error {
+	if s.str != nil {
+		*s.str = value
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*s.dur = Duration(d)
+	return nil
+}
+
+// Load registers the config flags on fs, parses args and returns the
+// resulting configuration.  Callers may register their own flags on fs
+// first.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	configPath := fs.String("config", "", "path to a JSON config file (env OPENCLOUD_CONFIG)")
+	// Flags are collected as strings and applied last so they override the
+	// file and the environment.
+	flagValues := make(map[string]*string)
+	cfg := Default()
+	for _, s := range cfg.settings() {
+		flagValues[s.flag] = fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path, required := *configPath, true
+	if path == "" {
+		path = os.Getenv("OPENCLOUD_CONFIG")
+	}
+	if path == "" {
+		path, required = defaultConfigPath(), false
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("malformed config file %s: %w", path, err)
+			}
+		case required || !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range cfg.settings() {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+		if set[s.flag] {
+			if err := s.set(*flagValues[s.flag]); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validate checks settings that would otherwise fail at startup or later.
+func (c *Config) validate() error {
+	if c.ListenAddress == "" {
+		return fmt.Errorf("listen address must not be empty")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("tlsCertFile and tlsKeyFile must be set together")
+	}
+	for name, d := range map[string]Duration{
+		"readHeaderTimeout": c.ReadHeaderTimeout,
+		"readTimeout":       c.ReadTimeout,
+		"writeTimeout":      c.WriteTimeout,
+		"idleTimeout":       c.IdleTimeout,
+		"shutdownTimeout":   c.ShutdownTimeout,
+	} {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if !slices.Contains(logging.Formats, c.LogFormat) {
+		return fmt.Errorf("unknown log format %q; use %s", c.LogFormat, strings.Join(logging.Formats, " or "))
+	}
+	if _, err := parsePrefixes(c.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trustedProxies: %w", err)
+	}
+	if _, err := parsePrefixes(c.WebhookAllowedNetworks); err != nil {
+		return fmt.Errorf("invalid webhookAllowedNetworks: %w", err)
+	}
+	if c.DataDir == "" {
+		return fmt.Errorf("data directory is not set and the home directory is unknown")
+	}
+	dir, err := filepath.Abs(c.DataDir)
+	if err != nil {
+		return fmt.Errorf("invalid data directory: %w", err)
+	}
+	c.DataDir = dir
+	for name, dir := range map[string]*string{
+		"functionsDir":   &c.FunctionsDir,
+		"pipelinesDir":   &c.PipelinesDir,
+		"blobStorageDir": &c.BlobStorageDir,
+		"logsDir":        &c.LogsDir,
+	} {
+		if *dir == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*dir = abs
+	}
+	return nil
+}
+
+// TLSEnabled reports whether the server should serve HTTPS itself.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != ""
+}
+
+// TrustedProxyPrefixes returns the parsed TrustedProxies.  A plain address
+// becomes a single-address prefix.
+func (c *Config) TrustedProxyPrefixes() []netip.Prefix {
+	prefixes, _ := parsePrefixes(c.TrustedProxies)
+	return prefixes
+}
+
+// WebhookAllowedPrefixes returns the parsed WebhookAllowedNetworks.
+func (c *Config) WebhookAllowedPrefixes() []netip.Prefix {
+	prefixes, _ := parsePrefixes(c.WebhookAllowedNetworks)
+	return prefixes
+}
+
+// parsePrefixes parses a comma-separated list of addresses and CIDR ranges.
+func parsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
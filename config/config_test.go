@@ -0,0 +1,186 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadForTest runs Load with a fresh flag set and an isolated HOME.
+func loadForTest(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	return Load(fs, args)
+}
+
+func isolateEnv(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, s := range (&Config{}).settings() {
+		t.Setenv(s.env, "")
+		os.Unsetenv(s.env)
+	}
+	t.Setenv("OPENCLOUD_CONFIG", "")
+	os.Unsetenv("OPENCLOUD_CONFIG")
+	return home
+}
+
+// TestLoadDefaults verifies the built-in settings.
+func TestLoadDefaults(t *testing.T) {
+	home := isolateEnv(t)
+
+	cfg, err := loadForTest(t)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.ListenAddress != "localhost:3030" {
+		t.Errorf("ListenAddress = %q", cfg.ListenAddress)
+	}
+	if cfg.DataDir != filepath.Join(home, ".opencloud") {
+		t.Errorf("DataDir = %q", cfg.DataDir)
+	}
+	if cfg.TLSEnabled() || cfg.WriteTimeout != 0 || cfg.ShutdownTimeout != Duration(time.Minute) {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+}
+
+// TestLoadPrecedence verifies flags beat the environment, which beats the
+// config file, which beats the defaults.
+func TestLoadPrecedence(t *testing.T) {
+	home := isolateEnv(t)
+
+	path := filepath.Join(home, "opencloud.json")
+	os.WriteFile(path, []byte(`{
+		"listenAddress": "0.0.0.0:8080",
+		"shutdownTimeout": "2m",
+		"idleTimeout": "5s",
+		"dataDir": "/srv/from-file"
+	}`), 0600)
+	t.Setenv("OPENCLOUD_CONFIG", path)
+	t.Setenv("OPENCLOUD_SHUTDOWN_TIMEOUT", "3m")
+	t.Setenv("OPENCLOUD_DATA_DIR", "/srv/from-env")
+
+	cfg, err := loadForTest(t, "-data-dir", "/srv/from-flag")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.ListenAddress != "0.0.0.0:8080" || cfg.IdleTimeout != Duration(5*time.Second) {
+		t.Errorf("file settings not applied: %+v", cfg)
+	}
+	if cfg.ShutdownTimeout != Duration(3*time.Minute) {
+		t.Errorf("ShutdownTimeout = %v, want env value", time.Duration(cfg.ShutdownTimeout))
+	}
+	if cfg.DataDir != "/srv/from-flag" {
+		t.Errorf("DataDir = %q, want flag value", cfg.DataDir)
+	}
+	if cfg.ReadHeaderTimeout != Duration(10*time.Second) {
+		t.Errorf("unset settings should keep their defaults, got %v", time.Duration(cfg.ReadHeaderTimeout))
+	}
+}
+
+// TestLoadDefaultConfigFile verifies ~/.opencloud/config.json is optional
+// but used when present.
+func TestLoadDefaultConfigFile(t *testing.T) {
+	home := isolateEnv(t)
+	os.MkdirAll(filepath.Join(home, ".opencloud"), 0755)
+	os.WriteFile(filepath.Join(home, ".opencloud", "config.json"), []byte(`{"listenAddress": "localhost:4040"}`), 0600)
+
+	cfg, err := loadForTest(t)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.ListenAddress != "localhost:4040" {
+		t.Errorf("ListenAddress = %q", cfg.ListenAddress)
+	}
+}
+
+// TestLoadSubsystemDirs verifies the subsystem directories are unset by
+// default and made absolute when given.
+func TestLoadSubsystemDirs(t *testing.T) {
+	isolateEnv(t)
+	t.Setenv("OPENCLOUD_LOGS_DIR", "/var/log/opencloud")
+
+	cfg, err := loadForTest(t, "-blob-storage-dir", "blobs")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	wd, _ := os.Getwd()
+	if cfg.BlobStorageDir != filepath.Join(wd, "blobs") {
+		t.Errorf("BlobStorageDir = %q, want it made absolute", cfg.BlobStorageDir)
+	}
+	if cfg.LogsDir != "/var/log/opencloud" {
+		t.Errorf("LogsDir = %q, want env value", cfg.LogsDir)
+	}
+	if cfg.FunctionsDir != "" || cfg.PipelinesDir != "" {
+		t.Errorf("unset subsystem dirs should stay empty: %+v", cfg)
+	}
+}
+
+// TestLoadTrustedProxies verifies addresses and CIDR ranges are accepted.
+func TestLoadTrustedProxies(t *testing.T) {
+	isolateEnv(t)
+	t.Setenv("OPENCLOUD_TRUSTED_PROXIES", "127.0.0.1, 10.1.2.3/16,::1")
+
+	cfg, err := loadForTest(t)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	got := fmt.Sprint(cfg.TrustedProxyPrefixes())
+	if want := "[127.0.0.1/32 10.1.0.0/16 ::1/128]"; got != want {
+		t.Errorf("TrustedProxyPrefixes() = %s, want %s", got, want)
+	}
+}
+
+// TestLoadWebhookAllowedNetworks verifies the webhook allow-list is parsed
+// like the trusted proxies.
+func TestLoadWebhookAllowedNetworks(t *testing.T) {
+	isolateEnv(t)
+
+	cfg, err := loadForTest(t, "-webhook-allowed-networks", "192.168.1.0/24,10.0.0.5")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	got := fmt.Sprint(cfg.WebhookAllowedPrefixes())
+	if want := "[192.168.1.0/24 10.0.0.5/32]"; got != want {
+		t.Errorf("WebhookAllowedPrefixes() = %s, want %s", got, want)
+	}
+}
+
+// TestLoadErrors verifies invalid settings are reported.
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		args []string
+	}{
+		{name: "missing explicit config", args: []string{"-config", "/does/not/exist.json"}},
+		{name: "malformed file", file: `{"listenAddress": `},
+		{name: "numeric duration", file: `{"idleTimeout": 30}`},
+		{name: "bad duration flag", args: []string{"-read-timeout", "soon"}},
+		{name: "negative timeout", args: []string{"-shutdown-timeout", "-1s"}},
+		{name: "cert without key", args: []string{"-tls-cert", "/etc/cert.pem"}},
+		{name: "empty listen address", args: []string{"-listen", ""}},
+		{name: "unknown log level", args: []string{"-log-level", "verbose"}},
+		{name: "unknown log format", args: []string{"-log-format", "xml"}},
+		{name: "bad trusted proxy", args: []string{"-trusted-proxies", "127.0.0.1, proxy.local"}},
+		{name: "bad webhook network", args: []string{"-webhook-allowed-networks", "intranet"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := isolateEnv(t)
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(home, "config.json")
+				os.WriteFile(path, []byte(tt.file), 0600)
+				args = append([]string{"-config", path}, args...)
+			}
+			if _, err := loadForTest(t, args...); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
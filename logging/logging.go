@@ -0,0 +1,104 @@
+// Package logging sets up the server's log/slog output and attaches the ID
+// of the request being served to every line logged with its context.
+//
+// Code that has a request context logs with the slog *Context functions,
+// for example slog.WarnContext(r.Context(), ...), so the line carries a
+// request_id attribute matching the X-Request-ID response header.  Work a
+// request starts in the background keeps the ID by copying it into its own
+// context with ContextWithRequestID.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Formats lists the accepted output formats.
+var Formats = []string{"text", "json"}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying request ID id, which
+// is added to every line logged with the context.  An empty id leaves ctx
+// unchanged.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ParseLevel parses one of "debug", "info", "warn" or "error".
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q; use debug, info, warn or error", s)
+}
+
+// NewLogger returns a logger writing lines at level or above to w in
+// format, either "text" or "json".
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q; use %s", format, strings.Join(Formats, " or "))
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// Setup makes a logger from NewLogger the default, which also routes the
+// standard log package through it.
+func Setup(w io.Writer, level, format string) error {
+	logger, err := NewLogger(w, level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// contextHandler adds the request ID of the logging context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
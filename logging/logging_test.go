@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	logger.With("component", "test").WarnContext(ctx, "disk almost full", "free_bytes", 10)
+	logger.Info("no request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var first, second map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first["request_id"] != "req-1" || first["component"] != "test" || first["level"] != "WARN" {
+		t.Errorf("first line = %v", first)
+	}
+	if _, ok := second["request_id"]; ok {
+		t.Errorf("line without a request context has a request_id: %v", second)
+	}
+}
+
+func TestNewLoggerLevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "warn", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Error("shown", "err", "boom")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, `level=ERROR msg=shown err=boom`) {
+		t.Errorf("output = %q", out)
+	}
+
+	if _, err := NewLogger(&buf, "verbose", "text"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if _, err := NewLogger(&buf, "info", "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if lvl, _ := ParseLevel("DEBUG"); lvl != slog.LevelDebug {
+		t.Errorf("ParseLevel(DEBUG) = %v", lvl)
+	}
+}
@@ -1,17 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/WavexSoftware/OpenCloud/api"
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
 	computeapi "github.com/WavexSoftware/OpenCloud/api/compute"
 	storageapi "github.com/WavexSoftware/OpenCloud/api/storage"
+	"github.com/WavexSoftware/OpenCloud/backup"
+	"github.com/WavexSoftware/OpenCloud/config"
+	"github.com/WavexSoftware/OpenCloud/logging"
 	"github.com/WavexSoftware/OpenCloud/service_ledger"
 	"github.com/WavexSoftware/OpenCloud/utils"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 )
 
 func withCORS(next http.Handler) http.Handler {
@@ -39,8 +51,9 @@ func withCORS(next http.Handler) http.Handler {
 				// Allow the request with CORS headers
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, AccessToken, X-Request-ID, Idempotency-Key")
+				w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotent-Replayed, X-Next-Cursor")
 
 				// Handle preflight request
 				if r.Method == http.MethodOptions {
@@ -49,8 +62,7 @@ func withCORS(next http.Handler) http.Handler {
 				}
 			} else {
 				// Unauthorized origin - reject the request
-				w.WriteHeader(http.StatusForbidden)
-				w.Write([]byte("CORS policy: origin not allowed"))
+				apierror.Respond(w, r, http.StatusForbidden, "CORS policy: origin not allowed")
 				return
 			}
 		}
@@ -132,23 +144,339 @@ func isLocalhost(hostname string) bool {
 	return h == "localhost" || h == "127.0.0.1" || h == "::1"
 }
 
+// useDataDirs makes the configured data and subsystem directories the ones
+// used by every handler.
+func useDataDirs(cfg *config.Config) {
+	utils.SetDataDir(cfg.DataDir)
+	utils.SetSubsystemDir(utils.Functions, cfg.FunctionsDir)
+	utils.SetSubsystemDir(utils.Pipelines, cfg.PipelinesDir)
+	utils.SetSubsystemDir(utils.BlobStorage, cfg.BlobStorageDir)
+	utils.SetSubsystemDir(utils.Logs, cfg.LogsDir)
+}
+
+// loadCommandConfig loads the configuration of a subcommand, sets up
+// logging to stderr, so stdout carries only the command's output, and
+// points the data directories at the configured ones.
+func loadCommandConfig(fs *flag.FlagSet, args []string) *config.Config {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	if err := logging.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat); err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	useDataDirs(cfg)
+	return cfg
+}
+
+// migrateData implements "opencloud migrate-data".  It moves the data in
+// -from (~/.opencloud by default) to the configured data and subsystem
+// directories and points cron jobs at the new paths.  The server must be
+// stopped while it runs.
+func migrateData(args []string) {
+	fs := flag.NewFlagSet("migrate-data", flag.ExitOnError)
+	defaultFrom := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		defaultFrom = filepath.Join(home, ".opencloud")
+	}
+	from := fs.String("from", defaultFrom, "existing data directory to move")
+	ledger := fs.String("ledger", service_ledger.LegacyLedgerPath(), "service ledger kept in the source tree by earlier versions")
+	dryRun := fs.Bool("dry-run", false, "print the moves without making them")
+	loadCommandConfig(fs, args)
+
+	moves, err := utils.PlanDataMigration(*from, *ledger)
+	if err != nil {
+		fatal("cannot migrate", "from", *from, "err", err)
+	}
+	if len(moves) == 0 {
+		fmt.Printf("Nothing to move: %s is already in place\n", *from)
+		return
+	}
+	for _, m := range moves {
+		fmt.Printf("%s -> %s\n", m.From, m.To)
+	}
+	if *dryRun {
+		return
+	}
+
+	if err := utils.MigrateData(moves); err != nil {
+		fatal("migration stopped", "err", err)
+	}
+	if err := computeapi.RelocateCronJobs(moves); err != nil {
+		slog.Warn("failed to update cron jobs for the new paths", "err", err)
+	}
+
+	// Podman volumes of container-mount buckets are bound to the old bucket
+	// directories.  Recreating them means removing the containers using
+	// them, so that is left to the operator.
+	blobDir, _ := utils.SubsystemDir(utils.BlobStorage)
+	blobsMoved := false
+	for _, m := range moves {
+		blobsMoved = blobsMoved || m.To == blobDir
+	}
+	buckets, _ := service_ledger.GetAllBucketEntries()
+	for key, bucket := range buckets {
+		if !blobsMoved || bucket.VolumeName == "" {
+			continue
+		}
+		project, name := service_ledger.SplitProjectKey(key)
+		bucketDir, _ := utils.ProjectDir(project, utils.BlobStorage)
+		slog.Warn("Podman volume still binds the old directory of its bucket; recreate it",
+			"volume", bucket.VolumeName, "bucket", key,
+			"command", fmt.Sprintf("podman volume rm %s && podman volume create --opt type=none --opt o=bind --opt device=%s %s",
+				bucket.VolumeName, filepath.Join(bucketDir, name), bucket.VolumeName))
+	}
+	fmt.Println("Migration complete")
+}
+
+// backupInstance implements "opencloud backup".  It reads the files as they
+// are, so the server must be stopped for the archive to be consistent; a
+// running server is backed up through GET /api/v1/system/backup instead.
+func backupInstance(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("o", "opencloud-backup-"+time.Now().UTC().Format("20060102T150405Z")+".tar.gz", "archive to write")
+	images := fs.Bool("images", false, "include the tagged Podman images")
+	volumes := fs.Bool("volumes", false, "include the Podman volumes other than those of container-mount buckets")
+	loadCommandConfig(fs, args)
+
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fatal("cannot create the archive", "path", *output, "err", err)
+	}
+	opts := backup.Options{Images: *images, Volumes: *volumes, Podman: storageapi.PodmanBackup{}}
+	manifest, err := backup.Write(context.Background(), f, opts)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(*output)
+		fatal("backup failed", "err", err)
+	}
+	fmt.Printf("Wrote %s: %d files, %d images, %d volumes\n", *output, len(manifest.Files), len(manifest.Images), len(manifest.Volumes))
+}
+
+// restoreInstance implements "opencloud restore ARCHIVE".  It verifies the
+// archive, moves the current contents of the data and subsystem directories
+// aside, unpacks the archive into them and re-creates what lives outside
+// them: cron entries and the Podman volumes of container-mount buckets.
+// The server must be stopped while it runs.
+func restoreInstance(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	verifyOnly := fs.Bool("verify", false, "only check the archive")
+	loadCommandConfig(fs, args)
+	if fs.NArg() != 1 {
+		fatal("usage: opencloud restore [-verify] ARCHIVE")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fatal("cannot open the archive", "err", err)
+	}
+	defer f.Close()
+
+	if *verifyOnly {
+		manifest, err := backup.Verify(f)
+		if err != nil {
+			fatal("archive is not valid", "err", err)
+		}
+		fmt.Printf("%s is valid: created %s, %d files, %d images, %d volumes\n", fs.Arg(0),
+			manifest.CreatedAt.Format(time.RFC3339), len(manifest.Files), len(manifest.Images), len(manifest.Volumes))
+		return
+	}
+
+	report, err := backup.Restore(context.Background(), f, backup.RestoreOptions{Podman: storageapi.PodmanBackup{}})
+	if report != nil {
+		for _, m := range report.Displaced {
+			fmt.Printf("Moved the previous contents of %s to %s\n", m.From, m.To)
+		}
+	}
+	if err != nil {
+		fatal("restore failed", "err", err)
+	}
+
+	if err := utils.InitializeOpenCloudDirectories(); err != nil {
+		slog.Warn("failed to create the OpenCloud directories", "err", err)
+	}
+	if err := computeapi.RestoreCronJobs(); err != nil {
+		slog.Warn("failed to restore cron jobs", "err", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := storageapi.RestoreContainerMountVolumes(ctx); err != nil {
+		slog.Warn("failed to restore container-mount volumes", "err", err)
+	}
+	for _, warning := range report.Warnings {
+		slog.Warn(warning)
+	}
+	fmt.Println("Restore complete")
+}
+
+// rotateSigningKey implements "opencloud rotate-signing-key".  It edits the
+// keyring on disk, which a running server picks up on its next request, so
+// it must run as the same user as the server.
+func rotateSigningKey(args []string) {
+	fs := flag.NewFlagSet("rotate-signing-key", flag.ExitOnError)
+	grace := fs.Duration("grace", api.DefaultSigningKeyGrace, "how long tokens signed with the previous key stay valid (0 logs everyone out)")
+	loadCommandConfig(fs, args)
+
+	id, err := api.RotateSigningKey(*grace)
+	if err != nil {
+		fatal("failed to rotate signing key", "err", err)
+	}
+	fmt.Printf("New signing key %s is active; the previous key is retired after %s\n", id, *grace)
+}
+
+// serve runs the HTTP server until it fails or the process receives SIGTERM
+// or SIGINT.  On a signal it stops accepting connections and waits up to
+// cfg.ShutdownTimeout for in-flight requests and background pipeline runs;
+// whatever is still running after that is cancelled.
+func serve(cfg *config.Config, handler http.Handler) error {
+	// Request contexts derive from baseCtx so a forced shutdown also stops
+	// function invocations and image builds that ignore a closed connection.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	srv := &http.Server{
+		Addr:              cfg.ListenAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	// Event streams never go idle, so end them as soon as shutdown begins.
+	srv.RegisterOnShutdown(api.CloseEventStreams)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLSEnabled() {
+			serveErr <- srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(stop)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-stop:
+		slog.Info("draining in-flight work", "signal", sig.String(), "timeout", time.Duration(cfg.ShutdownTimeout))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	// Shutdown closes the listeners at once and then waits for active
+	// requests; pipelines run outside any request and are drained separately.
+	shutdownErr := srv.Shutdown(ctx)
+	drainErr := api.DrainBackgroundTasks(ctx)
+	if shutdownErr != nil || drainErr != nil {
+		cancelRequests()
+		srv.Close()
+		return fmt.Errorf("shutdown deadline exceeded, remaining work was cancelled")
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// fatal logs msg and its attributes as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
 func main() {
-	// Initialize .opencloud directory structure
+	if len(os.Args) > 1 && os.Args[1] == "rotate-signing-key" {
+		rotateSigningKey(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-data" {
+		migrateData(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		backupInstance(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		restoreInstance(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	if err := logging.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat); err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	useDataDirs(cfg)
+	api.SetTrustedProxies(cfg.TrustedProxyPrefixes())
+	api.SetWebhookAllowedNetworks(cfg.WebhookAllowedPrefixes())
+
+	// Initialize the data directory structure
 	if err := utils.InitializeOpenCloudDirectories(); err != nil {
-		log.Fatalf("Failed to initialize OpenCloud directories: %v", err)
+		fatal("failed to initialize OpenCloud directories", "err", err)
+	}
+	slog.Info("OpenCloud directories initialized", "data_dir", cfg.DataDir)
+
+	// Starting with a fresh ledger would lose track of the existing
+	// resources until they are synced again.
+	if legacy := service_ledger.LegacyLedgerPath(); legacy != "" {
+		ledger, _ := utils.LedgerPath()
+		if _, err := os.Stat(legacy); err == nil {
+			if _, err := os.Stat(ledger); os.IsNotExist(err) {
+				fatal("the service ledger is still in the source tree; run \"opencloud migrate-data\" to move it into the data directory",
+					"ledger", legacy, "data_dir", cfg.DataDir)
+			}
+		}
 	}
-	fmt.Println("OpenCloud directories initialized successfully")
 
 	// Initialize service ledger with default services
 	if err := service_ledger.InitializeServiceLedger(); err != nil {
-		log.Fatalf("Failed to initialize service ledger: %v", err)
+		fatal("failed to initialize service ledger", "err", err)
 	}
-	fmt.Println("Service ledger initialized successfully")
+	slog.Info("service ledger initialized")
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/user/login", api.Login)
+	mux.HandleFunc("/user/login/verify", api.VerifyLogin)
+	mux.HandleFunc("/user/oidc/status", api.GetOIDCStatus)
+	mux.HandleFunc("/user/oidc/login", api.OIDCLogin)
+	mux.HandleFunc("/user/oidc/callback", api.OIDCCallback)
 	mux.HandleFunc("/user/get-auth/", api.RefreshAuth)
+	mux.HandleFunc("/user/logout", api.Logout)
+	mux.HandleFunc("/user/sessions", api.ListSessions)
+	mux.HandleFunc("/user/sessions/", api.RevokeSession)
+	mux.HandleFunc("/user/list-users", api.ListUsers)
+	mux.HandleFunc("/user/create-user", api.CreateUser)
+	mux.HandleFunc("/user/disable-user", api.SetUserDisabled)
+	mux.HandleFunc("/user/delete-user", api.DeleteUser)
+	mux.HandleFunc("/user/change-password", api.ChangePassword)
+	mux.HandleFunc("/user/set-role", api.SetUserRole)
+	mux.HandleFunc("/user/unlock-user", api.UnlockUser)
+	mux.HandleFunc("/user/link-oidc", api.LinkOIDCUser)
+	mux.HandleFunc("/user/signing-keys", api.ListSigningKeys)
+	mux.HandleFunc("/user/rotate-signing-key", api.RotateSigningKeyHandler)
+	mux.HandleFunc("/user/create-token", api.CreateAccessToken)
+	mux.HandleFunc("/user/tokens", api.ListAccessTokens)
+	mux.HandleFunc("/user/tokens/", api.RevokeAccessToken)
+	mux.HandleFunc("/user/totp/status", api.GetTOTPStatus)
+	mux.HandleFunc("/user/totp/enroll", api.EnrollTOTP)
+	mux.HandleFunc("/user/totp/confirm", api.ConfirmTOTP)
+	mux.HandleFunc("/user/totp/disable", api.DisableTOTP)
 	mux.HandleFunc("/get-server-metrics", api.GetSystemMetrics)
+	mux.HandleFunc("/get-audit-log", api.GetAuditLog)
+	mux.HandleFunc("/backup", storageapi.GetBackup)
+	mux.HandleFunc("/events", api.StreamEvents)
 	mux.HandleFunc("/get-containers", computeapi.GetContainers)
 	mux.HandleFunc("/get-images", storageapi.GetContainerRegistry)
 	mux.HandleFunc("/list-blob-buckets", storageapi.ListBlobBuckets)
@@ -197,13 +525,54 @@ func main() {
 	mux.HandleFunc("/set-instance-domain", api.SetInstanceDomainHandler)
 	mux.HandleFunc("/get-ssl-status", api.GetSSLStatusHandler)
 	mux.HandleFunc("/configure-ssl", api.ConfigureSSLHandler)
-	mux.HandleFunc("/", computeapi.GetFunction)
+	mux.HandleFunc("/get-function/", computeapi.GetFunction)
+	mux.HandleFunc("/list-webhooks", api.ListWebhooks)
+	mux.HandleFunc("/create-webhook", api.CreateWebhook)
+	mux.HandleFunc("/get-webhook/", api.GetWebhook)
+	mux.HandleFunc("/update-webhook/", api.UpdateWebhook)
+	mux.HandleFunc("/delete-webhook/", api.DeleteWebhook)
+	mux.HandleFunc("/get-webhook-deliveries/", api.GetWebhookDeliveries)
+	mux.HandleFunc("/list-projects", api.ListProjects)
+	mux.HandleFunc("/create-project", api.CreateProject)
+	mux.HandleFunc("/get-project/", api.GetProject)
+	mux.HandleFunc("/delete-project/", api.DeleteProject)
+	mux.HandleFunc("/set-project-member/", api.SetProjectMember)
+	mux.HandleFunc("/remove-project-member/", api.RemoveProjectMember)
 
-	// Wrap all routes with CORS middleware
-	handler := withCORS(mux)
+	// Keep recent platform events for GET /events to replay, and deliver
+	// them to the webhooks subscribed to them.
+	if err := api.OpenEventHistory(); err != nil {
+		slog.Warn("event history unavailable, GET /events cannot replay missed events", "err", err)
+	}
+	api.StartWebhookDispatcher()
+
+	// Require a valid access token on every route except login/refresh,
+	// record every mutating request in the audit log, hold off mutating
+	// requests while a backup is written, replay the responses of retried
+	// creating requests that carry an Idempotency-Key, and count requests
+	// per route for /metrics.
+	legacy := api.InstrumentRoutes(mux, api.Audit(api.RequireAuth(api.GateWrites(api.Idempotent(mux)))))
+
+	// /api/v1 is the resource-oriented API; it translates onto the routes
+	// above, which stay available as deprecated aliases for the UI.  CORS
+	// wraps everything so preflights are answered first, inside the request
+	// ID middleware so even rejected requests carry an X-Request-ID.
+	root := http.NewServeMux()
+	root.HandleFunc("/openapi.json", api.GetOpenAPISpec)
+	root.Handle("/metrics", api.RequireAuth(http.HandlerFunc(api.GetPrometheusMetrics)))
+	root.Handle("/api/v1/", api.V1Handler(legacy))
+	root.Handle("/", api.DeprecatedAliases(legacy))
+	handler := apierror.WithRequestID(api.LogRequests(withCORS(root)))
 
-	fmt.Println("Server running on localhost:3030")
-	// IMPORTANT: Only listen on localhost for security
-	// External access should go through nginx (port 80/443) or Next.js (port 3000)
-	http.ListenAndServe("localhost:3030", handler)
+	scheme := "http"
+	if cfg.TLSEnabled() {
+		scheme = "https"
+	}
+	slog.Info("server running", "url", scheme+"://"+cfg.ListenAddress, "data_dir", cfg.DataDir)
+	// External access should normally go through nginx (port 80/443) or
+	// Next.js (port 3000); see isAllowedOrigin before listening elsewhere.
+	if err := serve(cfg, handler); err != nil {
+		fatal("server stopped", "err", err)
+	}
+	slog.Info("server stopped")
 }
@@ -0,0 +1,239 @@
+package service_ledger
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/WavexSoftware/OpenCloud/utils"
+)
+
+// Projects group functions, pipelines, buckets and containers so that teams
+// sharing an instance do not collide on names.  The resources of the default
+// project keep the ledger keys they had before projects existed; those of
+// any other project are keyed "<project>/<name>" (see ProjectKey), which no
+// resource name can clash with since names never contain a slash.
+
+// ProjectEntry stores a project other than the default one in the projects
+// service ledger
+type ProjectEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	// Members maps the users granted access to the project to their role in
+	// it ("developer" or "viewer").  Instance admins have access to
+	// every project without being listed.
+	Members map[string]string `json:"members,omitempty"`
+}
+
+var (
+	// ErrProjectExists is returned when creating a project whose name is taken.
+	ErrProjectExists = errors.New("project already exists")
+	// ErrProjectNotFound is returned when changing a project that does not exist.
+	ErrProjectNotFound = errors.New("project not found")
+)
+
+// ProjectKey returns the ledger key of the resource called name in project.
+func ProjectKey(project, name string) string {
+	if project == "" || project == utils.DefaultProject {
+		return name
+	}
+	return project + "/" + name
+}
+
+// SplitProjectKey is the inverse of ProjectKey: it returns the project and
+// name of the resource stored under key.
+func SplitProjectKey(key string) (project, name string) {
+	if project, name, ok := strings.Cut(key, "/"); ok {
+		return project, name
+	}
+	return utils.DefaultProject, key
+}
+
+// ProjectEntries returns the entries of one project out of a map keyed with
+// ProjectKey, such as the result of GetAllFunctionEntries, keyed by name.
+func ProjectEntries[E any](entries map[string]E, project string) map[string]E {
+	if project == "" {
+		project = utils.DefaultProject
+	}
+	result := make(map[string]E)
+	for key, entry := range entries {
+		if p, name := SplitProjectKey(key); p == project {
+			result[name] = entry
+		}
+	}
+	return result
+}
+
+// defaultProjectEntry describes the default project, which is not stored.
+func defaultProjectEntry() ProjectEntry {
+	return ProjectEntry{Name: utils.DefaultProject, Description: "Resources created without naming a project"}
+}
+
+// CreateProjectEntry stores a new project in the projects service ledger.
+// It returns ErrProjectExists if the name is taken.
+func CreateProjectEntry(entry ProjectEntry) error {
+	ledgerMutex.Lock()
+	defer ledgerMutex.Unlock()
+
+	if entry.Name == utils.DefaultProject {
+		return ErrProjectExists
+	}
+
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return err
+	}
+
+	serviceStatus, exists := ledger["projects"]
+	if !exists {
+		serviceStatus = ServiceStatus{Enabled: true, Projects: make(map[string]ProjectEntry)}
+	} else if serviceStatus.Projects == nil {
+		serviceStatus.Projects = make(map[string]ProjectEntry)
+	}
+	if _, exists := serviceStatus.Projects[entry.Name]; exists {
+		return ErrProjectExists
+	}
+
+	serviceStatus.Projects[entry.Name] = entry
+	ledger["projects"] = serviceStatus
+
+	return WriteServiceLedger(ledger)
+}
+
+// DeleteProjectEntry removes a project from the projects service ledger.
+// It does not check that the project is empty; the caller has to.
+func DeleteProjectEntry(name string) error {
+	ledgerMutex.Lock()
+	defer ledgerMutex.Unlock()
+
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return err
+	}
+
+	serviceStatus, exists := ledger["projects"]
+	if !exists || serviceStatus.Projects == nil {
+		return nil // Nothing to delete
+	}
+
+	delete(serviceStatus.Projects, name)
+	ledger["projects"] = serviceStatus
+
+	return WriteServiceLedger(ledger)
+}
+
+// GetProjectEntry retrieves a project from the projects service ledger.  The
+// default project always exists and has no members.
+func GetProjectEntry(name string) (*ProjectEntry, error) {
+	if name == utils.DefaultProject {
+		entry := defaultProjectEntry()
+		return &entry, nil
+	}
+
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	serviceStatus, exists := ledger["projects"]
+	if !exists || serviceStatus.Projects == nil {
+		return nil, nil
+	}
+
+	entry, exists := serviceStatus.Projects[name]
+	if !exists {
+		return nil, nil
+	}
+
+	return &entry, nil
+}
+
+// GetAllProjectEntries retrieves every project, including the default one.
+func GetAllProjectEntries() (map[string]ProjectEntry, error) {
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	projects := map[string]ProjectEntry{utils.DefaultProject: defaultProjectEntry()}
+	for name, entry := range ledger["projects"].Projects {
+		projects[name] = entry
+	}
+
+	return projects, nil
+}
+
+// SetProjectMember grants username role in project, replacing any role they
+// had.  It returns ErrProjectNotFound if the project does not exist or is the
+// default project, whose access follows the instance roles.
+func SetProjectMember(project, username, role string) error {
+	return updateProjectMembers(project, func(members map[string]string) {
+		members[username] = role
+	})
+}
+
+// RemoveProjectMember revokes the access username has to project.
+func RemoveProjectMember(project, username string) error {
+	return updateProjectMembers(project, func(members map[string]string) {
+		delete(members, username)
+	})
+}
+
+// RemoveUserFromProjects revokes the access username has to every project,
+// as when the account is deleted.
+func RemoveUserFromProjects(username string) error {
+	ledgerMutex.Lock()
+	defer ledgerMutex.Unlock()
+
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return err
+	}
+
+	serviceStatus, exists := ledger["projects"]
+	if !exists {
+		return nil
+	}
+
+	changed := false
+	for name, entry := range serviceStatus.Projects {
+		if _, ok := entry.Members[username]; ok {
+			delete(entry.Members, username)
+			serviceStatus.Projects[name] = entry
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	ledger["projects"] = serviceStatus
+
+	return WriteServiceLedger(ledger)
+}
+
+// updateProjectMembers applies update to the members of project and stores
+// the result.
+func updateProjectMembers(project string, update func(members map[string]string)) error {
+	ledgerMutex.Lock()
+	defer ledgerMutex.Unlock()
+
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return err
+	}
+
+	serviceStatus := ledger["projects"]
+	entry, exists := serviceStatus.Projects[project]
+	if !exists {
+		return ErrProjectNotFound
+	}
+
+	if entry.Members == nil {
+		entry.Members = make(map[string]string)
+	}
+	update(entry.Members)
+	serviceStatus.Projects[project] = entry
+	ledger["projects"] = serviceStatus
+
+	return WriteServiceLedger(ledger)
+}
@@ -0,0 +1,121 @@
+package service_ledger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProjectKey(t *testing.T) {
+	for _, tc := range []struct {
+		project, name, key string
+	}{
+		{"default", "hello.py", "hello.py"},
+		{"", "hello.py", "hello.py"},
+		{"team-a", "hello.py", "team-a/hello.py"},
+	} {
+		if got := ProjectKey(tc.project, tc.name); got != tc.key {
+			t.Errorf("ProjectKey(%q, %q) = %q, want %q", tc.project, tc.name, got, tc.key)
+		}
+		project, name := SplitProjectKey(tc.key)
+		if want := tc.project; project != want && !(want == "" && project == "default") {
+			t.Errorf("SplitProjectKey(%q) project = %q, want %q", tc.key, project, want)
+		}
+		if name != tc.name {
+			t.Errorf("SplitProjectKey(%q) name = %q, want %q", tc.key, name, tc.name)
+		}
+	}
+
+	entries := map[string]int{"a": 1, "team-a/a": 2, "team-a/b": 3, "team-b/a": 4}
+	got := ProjectEntries(entries, "team-a")
+	if len(got) != 2 || got["a"] != 2 || got["b"] != 3 {
+		t.Errorf("ProjectEntries(team-a) = %v", got)
+	}
+	if got := ProjectEntries(entries, "default"); len(got) != 1 || got["a"] != 1 {
+		t.Errorf("ProjectEntries(default) = %v", got)
+	}
+}
+
+func TestProjectEntries(t *testing.T) {
+	saveLedgerState(t)
+
+	entry := ProjectEntry{Name: "test-team", Description: "Test team", CreatedAt: "2024-01-01T00:00:00Z"}
+	if err := CreateProjectEntry(entry); err != nil {
+		t.Fatalf("CreateProjectEntry failed: %v", err)
+	}
+	if err := CreateProjectEntry(entry); !errors.Is(err, ErrProjectExists) {
+		t.Errorf("second CreateProjectEntry = %v, want ErrProjectExists", err)
+	}
+	if err := CreateProjectEntry(ProjectEntry{Name: "default"}); !errors.Is(err, ErrProjectExists) {
+		t.Errorf("CreateProjectEntry(default) = %v, want ErrProjectExists", err)
+	}
+
+	if err := SetProjectMember("test-team", "alice", "developer"); err != nil {
+		t.Fatalf("SetProjectMember failed: %v", err)
+	}
+	if err := SetProjectMember("no-such-team", "alice", "developer"); !errors.Is(err, ErrProjectNotFound) {
+		t.Errorf("SetProjectMember on a missing project = %v, want ErrProjectNotFound", err)
+	}
+	if err := SetProjectMember("default", "alice", "developer"); !errors.Is(err, ErrProjectNotFound) {
+		t.Errorf("SetProjectMember on the default project = %v, want ErrProjectNotFound", err)
+	}
+	got, err := GetProjectEntry("test-team")
+	if err != nil || got == nil || got.Members["alice"] != "developer" || got.Description != "Test team" {
+		t.Fatalf("GetProjectEntry = %+v, %v", got, err)
+	}
+
+	all, err := GetAllProjectEntries()
+	if err != nil {
+		t.Fatalf("GetAllProjectEntries failed: %v", err)
+	}
+	if _, ok := all["default"]; !ok {
+		t.Error("GetAllProjectEntries is missing the default project")
+	}
+	if _, ok := all["test-team"]; !ok {
+		t.Error("GetAllProjectEntries is missing test-team")
+	}
+
+	if err := RemoveUserFromProjects("alice"); err != nil {
+		t.Fatalf("RemoveUserFromProjects failed: %v", err)
+	}
+	if got, _ := GetProjectEntry("test-team"); got == nil || len(got.Members) != 0 {
+		t.Errorf("members after RemoveUserFromProjects = %+v", got)
+	}
+
+	if err := DeleteProjectEntry("test-team"); err != nil {
+		t.Fatalf("DeleteProjectEntry failed: %v", err)
+	}
+	if got, err := GetProjectEntry("test-team"); err != nil || got != nil {
+		t.Errorf("Expected no entry after delete, got %+v, %v", got, err)
+	}
+}
+
+func TestSyncFunctionsProjects(t *testing.T) {
+	saveLedgerState(t)
+	tmpHome := t.TempDir()
+	t.Setenv("HOME", tmpHome)
+
+	functionDir := filepath.Join(tmpHome, ".opencloud", "functions")
+	projectDir := filepath.Join(functionDir, ".projects", "test-team")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(functionDir, "test_sync.py"), []byte("print('default')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, "test_sync.py"), []byte("print('team')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SyncFunctions(); err != nil {
+		t.Fatalf("SyncFunctions failed: %v", err)
+	}
+
+	if entry, err := GetFunctionEntry("test_sync.py"); err != nil || entry == nil || entry.Content != "print('default')" {
+		t.Errorf("default project entry = %+v, %v", entry, err)
+	}
+	if entry, err := GetFunctionEntry("test-team/test_sync.py"); err != nil || entry == nil || entry.Content != "print('team')" {
+		t.Errorf("test-team entry = %+v, %v", entry, err)
+	}
+}
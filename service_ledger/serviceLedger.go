@@ -12,12 +12,17 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sync"
+
+	"github.com/WavexSoftware/OpenCloud/api/apierror"
+	"github.com/WavexSoftware/OpenCloud/api/events"
+	"github.com/WavexSoftware/OpenCloud/utils"
 )
 
 // FunctionLog represents a single function execution log
@@ -75,6 +80,20 @@ type BucketEntry struct {
 	VolumeName string `json:"volumeName,omitempty"`
 }
 
+// WebhookEntry stores an outgoing webhook subscription in the service ledger
+type WebhookEntry struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events lists the event types delivered to the webhook, e.g. "pipeline.finished".
+	Events []string `json:"events"`
+	// Secret is the key deliveries are signed with (HMAC-SHA256 of the body).
+	Secret      string `json:"secret"`
+	Description string `json:"description,omitempty"`
+	// Active is false for a paused webhook, which receives no deliveries.
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"createdAt"`
+}
+
 // ServiceStatus represents the status of a single service
 type ServiceStatus struct {
 	Enabled         bool                          `json:"enabled"`
@@ -86,6 +105,10 @@ type ServiceStatus struct {
 	Domain string `json:"domain,omitempty"`
 	// SSLEmail stores the email address used for Let's Encrypt/certbot SSL configuration.
 	SSLEmail string `json:"sslEmail,omitempty"`
+	// Webhooks stores the outgoing webhook subscriptions in the "webhooks" service ledger entry.
+	Webhooks map[string]WebhookEntry `json:"webhooks,omitempty"`
+	// Projects stores the projects other than the default one in the "projects" service ledger entry.
+	Projects map[string]ProjectEntry `json:"projects,omitempty"`
 }
 
 // ServiceLedger represents the complete service ledger
@@ -93,7 +116,8 @@ type ServiceLedger map[string]ServiceStatus
 
 var ledgerMutex sync.Mutex
 
-// serviceLedgerDir is the directory containing the service ledger files.
+// serviceLedgerDir is the source directory of this package, which holds the
+// service installer scripts.
 // It is initialized once during package initialization to avoid runtime.Caller issues.
 var serviceLedgerDir string
 
@@ -109,11 +133,19 @@ func init() {
 }
 
 // getLedgerPath returns the absolute path to the serviceLedger.json file
+// in the data directory.
 func getLedgerPath() (string, error) {
+	return utils.LedgerPath()
+}
+
+// LegacyLedgerPath returns where earlier versions kept the service ledger:
+// next to this package's source.  "opencloud migrate-data" moves it to the
+// data directory.
+func LegacyLedgerPath() string {
 	if serviceLedgerDir == "" {
-		return "", fmt.Errorf("service ledger directory not initialized")
+		return ""
 	}
-	return filepath.Join(serviceLedgerDir, "serviceLedger.json"), nil
+	return filepath.Join(serviceLedgerDir, utils.LedgerFile)
 }
 
 // ReadServiceLedger reads and parses the service ledger JSON file
@@ -152,9 +184,30 @@ func WriteServiceLedger(ledger ServiceLedger) error {
 		return err
 	}
 
+	if err := os.MkdirAll(filepath.Dir(ledgerPath), 0755); err != nil {
+		return err
+	}
 	return os.WriteFile(ledgerPath, data, 0600)
 }
 
+// SnapshotServiceLedger reads the service ledger between writes, so the
+// result never mixes two updates.
+func SnapshotServiceLedger() (ServiceLedger, error) {
+	ledgerMutex.Lock()
+	defer ledgerMutex.Unlock()
+
+	return ReadServiceLedger()
+}
+
+// ReplaceServiceLedger replaces the whole service ledger, as when a backup
+// is restored.
+func ReplaceServiceLedger(ledger ServiceLedger) error {
+	ledgerMutex.Lock()
+	defer ledgerMutex.Unlock()
+
+	return WriteServiceLedger(ledger)
+}
+
 // InitializeServiceLedger ensures the service ledger file exists with default services
 func InitializeServiceLedger() error {
 	ledgerPath, err := getLedgerPath()
@@ -235,7 +288,7 @@ func executeServiceInstaller(serviceName string) error {
 	// Check if the installer script exists
 	if _, err := os.Stat(installerPath); os.IsNotExist(err) {
 		// Installer doesn't exist, which is fine - not all services need installers
-		log.Printf("No installer found for service '%s', skipping installation step", serviceName)
+		slog.Debug("no installer found, skipping installation step", "service", serviceName)
 		return nil
 	} else if err != nil {
 		return fmt.Errorf("failed to check installer script: %w", err)
@@ -247,7 +300,7 @@ func executeServiceInstaller(serviceName string) error {
 	}
 
 	// Execute the installer script
-	log.Printf("Executing installer script for service '%s'...", serviceName)
+	slog.Info("running service installer", "service", serviceName)
 	cmd := exec.Command("/bin/bash", installerPath)
 
 	// Capture both stdout and stderr
@@ -255,14 +308,14 @@ func executeServiceInstaller(serviceName string) error {
 	
 	// Log the output regardless of success or failure
 	if len(output) > 0 {
-		log.Printf("Installer output for '%s':\n%s", serviceName, string(output))
+		slog.Info("service installer output", "service", serviceName, "output", string(output))
 	}
 
 	if err != nil {
 		return fmt.Errorf("installer script failed for service '%s': %w", serviceName, err)
 	}
 
-	log.Printf("Successfully executed installer for service '%s'", serviceName)
+	slog.Info("service installer finished", "service", serviceName)
 	return nil
 }
 
@@ -297,20 +350,24 @@ func EnableService(serviceName string) error {
 
 	ledger[serviceName] = ServiceStatus{Enabled: true}
 
-	return WriteServiceLedger(ledger)
+	if err := WriteServiceLedger(ledger); err != nil {
+		return err
+	}
+	events.Publish(events.ServiceEnabled, map[string]any{"service": serviceName})
+	return nil
 }
 
 // GetServiceStatusHandler is an HTTP handler that returns the status of a service
 func GetServiceStatusHandler(w http.ResponseWriter, r *http.Request) {
 	serviceName := r.URL.Query().Get("service")
 	if serviceName == "" {
-		http.Error(w, "Missing service parameter", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing service parameter")
 		return
 	}
 
 	enabled, err := IsServiceEnabled(serviceName)
 	if err != nil {
-		http.Error(w, "Failed to read service ledger: "+err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Ledger(err, "Failed to read service ledger"))
 		return
 	}
 
@@ -326,7 +383,7 @@ func GetServiceStatusHandler(w http.ResponseWriter, r *http.Request) {
 // EnableServiceHandler is an HTTP handler that enables a service
 func EnableServiceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -335,17 +392,17 @@ func EnableServiceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if body.Service == "" {
-		http.Error(w, "Missing service field", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing service field")
 		return
 	}
 
 	if err := EnableService(body.Service); err != nil {
-		http.Error(w, "Failed to enable service: "+err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to enable service")
 		return
 	}
 
@@ -421,10 +478,10 @@ func enableServiceWithStream(serviceName string, send func(string)) error {
 //
 //	On error:
 //	event: error
-//	data: <error message>
+//	data: {"code":"...","message":"...","requestId":"..."}
 func EnableServiceStreamHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -433,18 +490,18 @@ func EnableServiceStreamHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if body.Service == "" {
-		http.Error(w, "Missing service field", http.StatusBadRequest)
+		apierror.Respond(w, r, http.StatusBadRequest, "Missing service field")
 		return
 	}
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		apierror.Respond(w, r, http.StatusInternalServerError, "Streaming not supported")
 		return
 	}
 
@@ -461,18 +518,14 @@ func EnableServiceStreamHandler(w http.ResponseWriter, r *http.Request) {
 	if body.Service == "containers" {
 		registryEnabled, err := IsServiceEnabled("container_registry")
 		if err != nil {
-			errMsg := fmt.Sprintf("failed to check container_registry status: %s", err.Error())
-			log.Printf("EnableServiceStreamHandler: %s", errMsg)
-			fmt.Fprintf(w, "event: error\ndata: %s\n\n", errMsg)
-			flusher.Flush()
+			e := apierror.Ledger(err, "failed to check container_registry status")
+			apierror.WriteEvent(w, r, e)
 			return
 		}
 		if !registryEnabled {
 			sendLine("[INFO] Container Registry is required by Containers. Enabling Container Registry first...")
 			if err := enableServiceWithStream("container_registry", sendLine); err != nil {
-				log.Printf("EnableServiceStreamHandler: installer error for 'container_registry': %v", err)
-				fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
-				flusher.Flush()
+				apierror.WriteEvent(w, r, apierror.FromError(err, ""))
 				return
 			}
 			// Mark container_registry as enabled in the ledger.
@@ -480,31 +533,26 @@ func EnableServiceStreamHandler(w http.ResponseWriter, r *http.Request) {
 			regLedger, err := ReadServiceLedger()
 			if err != nil {
 				ledgerMutex.Unlock()
-				errMsg := fmt.Sprintf("failed to read service ledger: %s", err.Error())
-				log.Printf("EnableServiceStreamHandler: %s", errMsg)
-				fmt.Fprintf(w, "event: error\ndata: %s\n\n", errMsg)
-				flusher.Flush()
+				e := apierror.Ledger(err, "failed to read service ledger")
+				apierror.WriteEvent(w, r, e)
 				return
 			}
 			regLedger["container_registry"] = ServiceStatus{Enabled: true}
 			if err := WriteServiceLedger(regLedger); err != nil {
 				ledgerMutex.Unlock()
-				errMsg := fmt.Sprintf("failed to write service ledger: %s", err.Error())
-				log.Printf("EnableServiceStreamHandler: %s", errMsg)
-				fmt.Fprintf(w, "event: error\ndata: %s\n\n", errMsg)
-				flusher.Flush()
+				e := apierror.Ledger(err, "failed to write service ledger")
+				apierror.WriteEvent(w, r, e)
 				return
 			}
 			ledgerMutex.Unlock()
+			events.Publish(events.ServiceEnabled, map[string]any{"service": "container_registry"})
 			sendLine("[SUCCESS] Container Registry service enabled successfully!")
 		}
 	}
 
 	// Run the installer with real-time streaming output.
 	if err := enableServiceWithStream(body.Service, sendLine); err != nil {
-		log.Printf("EnableServiceStreamHandler: installer error for '%s': %v", body.Service, err)
-		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
-		flusher.Flush()
+		apierror.WriteEvent(w, r, apierror.FromError(err, ""))
 		return
 	}
 
@@ -513,22 +561,19 @@ func EnableServiceStreamHandler(w http.ResponseWriter, r *http.Request) {
 	ledger, err := ReadServiceLedger()
 	if err != nil {
 		ledgerMutex.Unlock()
-		errMsg := fmt.Sprintf("failed to read service ledger: %s", err.Error())
-		log.Printf("EnableServiceStreamHandler: %s", errMsg)
-		fmt.Fprintf(w, "event: error\ndata: %s\n\n", errMsg)
-		flusher.Flush()
+		e := apierror.Ledger(err, "failed to read service ledger")
+		apierror.WriteEvent(w, r, e)
 		return
 	}
 	ledger[body.Service] = ServiceStatus{Enabled: true}
 	if err := WriteServiceLedger(ledger); err != nil {
 		ledgerMutex.Unlock()
-		errMsg := fmt.Sprintf("failed to write service ledger: %s", err.Error())
-		log.Printf("EnableServiceStreamHandler: %s", errMsg)
-		fmt.Fprintf(w, "event: error\ndata: %s\n\n", errMsg)
-		flusher.Flush()
+		e := apierror.Ledger(err, "failed to write service ledger")
+		apierror.WriteEvent(w, r, e)
 		return
 	}
 	ledgerMutex.Unlock()
+	events.Publish(events.ServiceEnabled, map[string]any{"service": body.Service})
 
 	sendLine(fmt.Sprintf("[SUCCESS] %s service enabled successfully!", body.Service))
 	fmt.Fprintf(w, "event: done\ndata: {\"service\":%q,\"enabled\":true}\n\n", body.Service)
@@ -660,7 +705,8 @@ func IncrementFunctionInvocations(functionName string) error {
 	return WriteServiceLedger(ledger)
 }
 
-// UpdatePipelineEntry updates a specific pipeline entry in the pipelines service ledger
+// UpdatePipelineEntry updates a specific pipeline entry in the pipelines service ledger.
+// pipelineID is the ledger key, as returned by ProjectKey.
 func UpdatePipelineEntry(pipelineID, name, description, code, branch, status, createdAt string) error {
 	ledgerMutex.Lock()
 	defer ledgerMutex.Unlock()
@@ -677,8 +723,9 @@ func UpdatePipelineEntry(pipelineID, name, description, code, branch, status, cr
 		serviceStatus.Pipelines = make(map[string]PipelineEntry)
 	}
 
+	_, id := SplitProjectKey(pipelineID)
 	serviceStatus.Pipelines[pipelineID] = PipelineEntry{
-		ID:          pipelineID,
+		ID:          id,
 		Name:        name,
 		Description: description,
 		Code:        code,
@@ -748,32 +795,25 @@ func GetAllPipelineEntries() (map[string]PipelineEntry, error) {
 	return serviceStatus.Pipelines, nil
 }
 
-// SyncPipelines scans the ~/.opencloud/pipelines/ directory and updates the service ledger
-// with any pipelines that exist on disk but are not yet tracked in the ledger
+// SyncPipelines scans the pipelines directory of every project and updates
+// the service ledger with any pipelines that exist on disk but are not yet
+// tracked in the ledger
 func SyncPipelines() error {
 	ledgerMutex.Lock()
 	defer ledgerMutex.Unlock()
 
-	// Get home directory
-	home, err := os.UserHomeDir()
+	// Get the pipelines directory of each project
+	pipelineDirs, err := utils.ProjectDirs(utils.Pipelines)
 	if err != nil {
 		return err
 	}
 
-	pipelineDir := filepath.Join(home, ".opencloud", "pipelines")
-
 	// Check if directory exists
-	if _, err := os.Stat(pipelineDir); os.IsNotExist(err) {
+	if _, err := os.Stat(pipelineDirs[utils.DefaultProject]); os.IsNotExist(err) {
 		// Directory doesn't exist, nothing to sync
 		return nil
 	}
 
-	// Read all files in the pipelines directory
-	entries, err := os.ReadDir(pipelineDir)
-	if err != nil {
-		return err
-	}
-
 	// Read current ledger
 	ledger, err := ReadServiceLedger()
 	if err != nil {
@@ -788,64 +828,73 @@ func SyncPipelines() error {
 		serviceStatus.Pipelines = make(map[string]PipelineEntry)
 	}
 
-	// Process each shell script file
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		// Only process .sh files
-		if filepath.Ext(entry.Name()) != ".sh" {
-			continue
-		}
-
-		// Read the file content
-		scriptPath := filepath.Join(pipelineDir, entry.Name())
-		scriptData, err := os.ReadFile(scriptPath)
+	for project, pipelineDir := range pipelineDirs {
+		// Read all files in the project's pipelines directory
+		entries, err := os.ReadDir(pipelineDir)
 		if err != nil {
-			fmt.Printf("Warning: Failed to read pipeline file %s: %v\n", entry.Name(), err)
-			continue // Skip files that can't be read
+			return err
 		}
 
-		// Get file info for creation time
-		fileInfo, err := entry.Info()
-		if err != nil {
-			fmt.Printf("Warning: Failed to get file info for %s: %v\n", entry.Name(), err)
-			continue
-		}
+		// Process each shell script file
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
 
-		// Extract pipeline name (remove .sh extension)
-		pipelineName := entry.Name()[:len(entry.Name())-3]
+			// Only process .sh files
+			if filepath.Ext(entry.Name()) != ".sh" {
+				continue
+			}
 
-		// Check if this pipeline already exists in the ledger
-		// We check by comparing the code content to avoid duplicates
-		found := false
-		for _, existing := range serviceStatus.Pipelines {
-			if existing.Code == string(scriptData) {
-				found = true
-				break
+			// Read the file content
+			scriptPath := filepath.Join(pipelineDir, entry.Name())
+			scriptData, err := os.ReadFile(scriptPath)
+			if err != nil {
+				slog.Warn("failed to read pipeline file", "file", scriptPath, "err", err)
+				continue // Skip files that can't be read
 			}
-		}
 
-		// If not found, add it to the ledger
-		if !found {
-			// Generate a unique ID
-			b := make([]byte, 8)
-			if _, err := rand.Read(b); err != nil {
-				fmt.Printf("Warning: Failed to generate pipeline ID for %s: %v\n", entry.Name(), err)
+			// Get file info for creation time
+			fileInfo, err := entry.Info()
+			if err != nil {
+				slog.Warn("failed to get file info", "file", scriptPath, "err", err)
 				continue
 			}
-			pipelineID := hex.EncodeToString(b)
-
-			// Add the pipeline entry
-			serviceStatus.Pipelines[pipelineID] = PipelineEntry{
-				ID:          pipelineID,
-				Name:        pipelineName,
-				Description: "",
-				Code:        string(scriptData),
-				Branch:      "main",
-				Status:      "idle",
-				CreatedAt:   fileInfo.ModTime().Format("2006-01-02T15:04:05Z07:00"),
+
+			// Extract pipeline name (remove .sh extension)
+			pipelineName := entry.Name()[:len(entry.Name())-3]
+
+			// Check if this pipeline already exists in the project's part of
+			// the ledger.  We check by comparing the code content to avoid
+			// duplicates
+			found := false
+			for key, existing := range serviceStatus.Pipelines {
+				if p, _ := SplitProjectKey(key); p == project && existing.Code == string(scriptData) {
+					found = true
+					break
+				}
+			}
+
+			// If not found, add it to the ledger
+			if !found {
+				// Generate a unique ID
+				b := make([]byte, 8)
+				if _, err := rand.Read(b); err != nil {
+					slog.Warn("failed to generate pipeline ID", "file", scriptPath, "err", err)
+					continue
+				}
+				pipelineID := hex.EncodeToString(b)
+
+				// Add the pipeline entry
+				serviceStatus.Pipelines[ProjectKey(project, pipelineID)] = PipelineEntry{
+					ID:          pipelineID,
+					Name:        pipelineName,
+					Description: "",
+					Code:        string(scriptData),
+					Branch:      "main",
+					Status:      "idle",
+					CreatedAt:   fileInfo.ModTime().Format("2006-01-02T15:04:05Z07:00"),
+				}
 			}
 		}
 	}
@@ -859,12 +908,12 @@ func SyncPipelines() error {
 // SyncPipelinesHandler is an HTTP handler that syncs pipelines from disk to the service ledger
 func SyncPipelinesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if err := SyncPipelines(); err != nil {
-		http.Error(w, "Failed to sync pipelines: "+err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to sync pipelines")
 		return
 	}
 
@@ -1012,32 +1061,25 @@ func detectRuntime(filename string) string {
 	}
 }
 
-// SyncFunctions scans the ~/.opencloud/functions/ directory and updates the service ledger
-// with any functions that exist on disk but are not yet tracked in the ledger
+// SyncFunctions scans the functions directory of every project and updates
+// the service ledger with any functions that exist on disk but are not yet
+// tracked in the ledger
 func SyncFunctions() error {
 	ledgerMutex.Lock()
 	defer ledgerMutex.Unlock()
 
-	// Get home directory
-	home, err := os.UserHomeDir()
+	// Get the functions directory of each project
+	functionDirs, err := utils.ProjectDirs(utils.Functions)
 	if err != nil {
 		return err
 	}
 
-	functionDir := filepath.Join(home, ".opencloud", "functions")
-
 	// Check if directory exists
-	if _, err := os.Stat(functionDir); os.IsNotExist(err) {
+	if _, err := os.Stat(functionDirs[utils.DefaultProject]); os.IsNotExist(err) {
 		// Directory doesn't exist, nothing to sync
 		return nil
 	}
 
-	// Read all files in the functions directory
-	entries, err := os.ReadDir(functionDir)
-	if err != nil {
-		return err
-	}
-
 	// Read current ledger
 	ledger, err := ReadServiceLedger()
 	if err != nil {
@@ -1052,41 +1094,50 @@ func SyncFunctions() error {
 		status.Functions = make(map[string]FunctionEntry)
 	}
 
-	// Process each function file
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		functionName := entry.Name()
-
-		// Read the file content
-		functionPath := filepath.Join(functionDir, functionName)
-		functionData, err := os.ReadFile(functionPath)
+	for project, functionDir := range functionDirs {
+		// Read all files in the project's functions directory
+		entries, err := os.ReadDir(functionDir)
 		if err != nil {
-			fmt.Printf("Warning: Failed to read function file %s: %v\n", functionName, err)
-			continue // Skip files that can't be read
+			return err
 		}
 
-		// Check if this function already exists in the ledger
-		existingEntry, exists := status.Functions[functionName]
+		// Process each function file
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+
+			functionName := entry.Name()
+			key := ProjectKey(project, functionName)
 
-		// If it exists, preserve its existing metadata and only update content if changed
-		if exists {
-			// Only update if content has changed
-			if existingEntry.Content != string(functionData) {
-				existingEntry.Content = string(functionData)
-				status.Functions[functionName] = existingEntry
+			// Read the file content
+			functionPath := filepath.Join(functionDir, functionName)
+			functionData, err := os.ReadFile(functionPath)
+			if err != nil {
+				slog.Warn("failed to read function file", "function", key, "err", err)
+				continue // Skip files that can't be read
 			}
-			// If content is the same, don't update anything to preserve logs and metadata
-		} else {
-			// New function - add it to the ledger
-			status.Functions[functionName] = FunctionEntry{
-				Runtime:  detectRuntime(functionName),
-				Trigger:  "",
-				Schedule: "",
-				Content:  string(functionData),
-				Logs:     []FunctionLog{},
+
+			// Check if this function already exists in the ledger
+			existingEntry, exists := status.Functions[key]
+
+			// If it exists, preserve its existing metadata and only update content if changed
+			if exists {
+				// Only update if content has changed
+				if existingEntry.Content != string(functionData) {
+					existingEntry.Content = string(functionData)
+					status.Functions[key] = existingEntry
+				}
+				// If content is the same, don't update anything to preserve logs and metadata
+			} else {
+				// New function - add it to the ledger
+				status.Functions[key] = FunctionEntry{
+					Runtime:  detectRuntime(functionName),
+					Trigger:  "",
+					Schedule: "",
+					Content:  string(functionData),
+					Logs:     []FunctionLog{},
+				}
 			}
 		}
 	}
@@ -1100,12 +1151,12 @@ func SyncFunctions() error {
 // SyncFunctionsHandler is an HTTP handler that syncs functions from disk to the service ledger
 func SyncFunctionsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Respond(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if err := SyncFunctions(); err != nil {
-		http.Error(w, "Failed to sync functions: "+err.Error(), http.StatusInternalServerError)
+		apierror.RespondError(w, r, err, "Failed to sync functions")
 		return
 	}
 
@@ -1118,6 +1169,7 @@ func SyncFunctionsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateBucketEntry stores or updates a blob storage bucket entry in the blob_storage service ledger.
+// bucketName is the ledger key, as returned by ProjectKey.
 func UpdateBucketEntry(bucketName, createdAt string, containerMount bool, volumeName string) error {
 	ledgerMutex.Lock()
 	defer ledgerMutex.Unlock()
@@ -1134,8 +1186,9 @@ func UpdateBucketEntry(bucketName, createdAt string, containerMount bool, volume
 		serviceStatus.Buckets = make(map[string]BucketEntry)
 	}
 
+	_, name := SplitProjectKey(bucketName)
 	serviceStatus.Buckets[bucketName] = BucketEntry{
-		Name:           bucketName,
+		Name:           name,
 		CreatedAt:      createdAt,
 		ContainerMount: containerMount,
 		VolumeName:     volumeName,
@@ -1227,8 +1280,9 @@ func RenameBucketEntry(currentName, newName string) error {
 	}
 
 	// Copy the entry under the new name and remove the old entry
+	_, name := SplitProjectKey(newName)
 	serviceStatus.Buckets[newName] = BucketEntry{
-		Name:           newName,
+		Name:           name,
 		CreatedAt:      existing.CreatedAt,
 		ContainerMount: existing.ContainerMount,
 		VolumeName:     existing.VolumeName,
@@ -1313,3 +1367,82 @@ func SetInstanceSSLEmail(email string) error {
 
 	return WriteServiceLedger(ledger)
 }
+
+// UpdateWebhookEntry stores or replaces a webhook subscription in the webhooks service ledger
+func UpdateWebhookEntry(entry WebhookEntry) error {
+	ledgerMutex.Lock()
+	defer ledgerMutex.Unlock()
+
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return err
+	}
+
+	serviceStatus, exists := ledger["webhooks"]
+	if !exists {
+		serviceStatus = ServiceStatus{Enabled: true, Webhooks: make(map[string]WebhookEntry)}
+	} else if serviceStatus.Webhooks == nil {
+		serviceStatus.Webhooks = make(map[string]WebhookEntry)
+	}
+
+	serviceStatus.Webhooks[entry.ID] = entry
+	ledger["webhooks"] = serviceStatus
+
+	return WriteServiceLedger(ledger)
+}
+
+// DeleteWebhookEntry removes a webhook subscription from the webhooks service ledger
+func DeleteWebhookEntry(webhookID string) error {
+	ledgerMutex.Lock()
+	defer ledgerMutex.Unlock()
+
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return err
+	}
+
+	serviceStatus, exists := ledger["webhooks"]
+	if !exists || serviceStatus.Webhooks == nil {
+		return nil // Nothing to delete
+	}
+
+	delete(serviceStatus.Webhooks, webhookID)
+	ledger["webhooks"] = serviceStatus
+
+	return WriteServiceLedger(ledger)
+}
+
+// GetWebhookEntry retrieves a specific webhook subscription from the webhooks service ledger
+func GetWebhookEntry(webhookID string) (*WebhookEntry, error) {
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	serviceStatus, exists := ledger["webhooks"]
+	if !exists || serviceStatus.Webhooks == nil {
+		return nil, nil
+	}
+
+	entry, exists := serviceStatus.Webhooks[webhookID]
+	if !exists {
+		return nil, nil
+	}
+
+	return &entry, nil
+}
+
+// GetAllWebhookEntries retrieves all webhook subscriptions from the webhooks service ledger
+func GetAllWebhookEntries() (map[string]WebhookEntry, error) {
+	ledger, err := ReadServiceLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	serviceStatus, exists := ledger["webhooks"]
+	if !exists || serviceStatus.Webhooks == nil {
+		return make(map[string]WebhookEntry), nil
+	}
+
+	return serviceStatus.Webhooks, nil
+}
@@ -9,8 +9,41 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/WavexSoftware/OpenCloud/utils"
 )
 
+func TestMain(m *testing.M) {
+	// The ledger is kept in the data directory under $HOME; keep the tests
+	// that do not set HOME themselves out of the real one.
+	home, err := os.MkdirTemp("", "service-ledger-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("HOME", home)
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// TestLedgerInDataDir verifies the ledger follows the data directory.
+func TestLedgerInDataDir(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	utils.SetDataDir(dataDir)
+	t.Cleanup(func() { utils.SetDataDir("") })
+
+	if err := WriteServiceLedger(ServiceLedger{"containers": {Enabled: true}}); err != nil {
+		t.Fatalf("WriteServiceLedger: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "serviceLedger.json")); err != nil {
+		t.Errorf("ledger not in the data directory: %v", err)
+	}
+	if enabled, err := IsServiceEnabled("containers"); err != nil || !enabled {
+		t.Errorf("IsServiceEnabled(containers) = %v, %v", enabled, err)
+	}
+}
+
 // getInstallerDir is a helper function that returns the path to the service_installers directory.
 // This is used by multiple test functions to avoid code duplication.
 func getInstallerDir(t *testing.T) string {
@@ -1603,3 +1636,50 @@ func TestUpdateFunctionEntryPreservesInvocations(t *testing.T) {
 		t.Errorf("Expected invocations to be preserved at 3 after update, got %d", entry.Invocations)
 	}
 }
+
+// TestWebhookEntries tests storing, listing and deleting webhook subscriptions
+func TestWebhookEntries(t *testing.T) {
+	saveLedgerState(t)
+
+	entry := WebhookEntry{
+		ID:        "wh_test_entries",
+		URL:       "https://example.com/hooks/opencloud",
+		Events:    []string{"pipeline.finished"},
+		Secret:    "s3cret",
+		Active:    true,
+		CreatedAt: "2024-01-01T00:00:00Z",
+	}
+	if err := UpdateWebhookEntry(entry); err != nil {
+		t.Fatalf("UpdateWebhookEntry failed: %v", err)
+	}
+
+	got, err := GetWebhookEntry(entry.ID)
+	if err != nil {
+		t.Fatalf("GetWebhookEntry failed: %v", err)
+	}
+	if got == nil || got.URL != entry.URL || got.Secret != entry.Secret || len(got.Events) != 1 {
+		t.Fatalf("Expected %+v, got %+v", entry, got)
+	}
+
+	entry.Active = false
+	if err := UpdateWebhookEntry(entry); err != nil {
+		t.Fatalf("Second UpdateWebhookEntry failed: %v", err)
+	}
+	all, err := GetAllWebhookEntries()
+	if err != nil {
+		t.Fatalf("GetAllWebhookEntries failed: %v", err)
+	}
+	if all[entry.ID].Active {
+		t.Errorf("Expected the webhook to be paused after the update")
+	}
+
+	if err := DeleteWebhookEntry(entry.ID); err != nil {
+		t.Fatalf("DeleteWebhookEntry failed: %v", err)
+	}
+	if got, err := GetWebhookEntry(entry.ID); err != nil || got != nil {
+		t.Errorf("Expected no entry after delete, got %+v, %v", got, err)
+	}
+	if err := DeleteWebhookEntry(entry.ID); err != nil {
+		t.Errorf("DeleteWebhookEntry should not error for a missing webhook, got: %v", err)
+	}
+}
@@ -23,6 +23,7 @@ import {
 import { toast } from "sonner"
 import client from "@/app/utility/post"
 import { stripRegistryPrefix } from "@/lib/image-name"
+import { apiErrorMessage } from "@/lib/utils"
 import {
   ArrowLeft,
   RefreshCw,
@@ -95,14 +96,10 @@ function formatDate(ts: number): string {
   return new Date(ts * 1000).toLocaleString()
 }
 
-// Extracts the plain-text body from an Axios error response so the user sees
-// the specific backend error message rather than the generic HTTP status line.
+// Extracts the message from an Axios error response so the user sees the
+// specific backend error message rather than the generic HTTP status line.
 function getBackendErrorMessage(err: unknown): string {
-  if (err != null && typeof err === "object" && "response" in err) {
-    const data = (err as { response?: { data?: unknown } }).response?.data
-    if (typeof data === "string" && data.trim()) return data.trim()
-  }
-  return err instanceof Error ? err.message : "Failed to update container"
+  return apiErrorMessage(err, err instanceof Error ? err.message : "Failed to update container")
 }
 
 // Parses a port string like "8080:80/tcp", "0.0.0.0:8080:80/tcp", or "80/tcp" (dynamic host port) into a PortMapping.
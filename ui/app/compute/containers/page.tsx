@@ -23,9 +23,11 @@ import { Switch } from "@/components/ui/switch"
 import { Textarea } from "@/components/ui/textarea"
 import { toast } from "sonner"
 import client from "@/app/utility/post"
+import authFetch from "@/app/utility/authFetch"
 import { FUNCTION_NAME_MAX_LENGTH, isValidFunctionName } from "@/lib/function-name"
 import { useFunctionNameWarning } from "@/lib/use-function-name-warning"
 import { stripRegistryPrefix } from "@/lib/image-name"
+import { apiErrorMessage } from "@/lib/utils"
 import { 
   RefreshCw, 
   Search,
@@ -198,7 +200,7 @@ export default function ContainersPage() {
     }
 
     try {
-      const response = await fetch("/api/enable-service-stream", {
+      const response = await authFetch("/api/enable-service-stream", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ service: "containers" }),
@@ -229,7 +231,7 @@ export default function ContainersPage() {
           if (line.startsWith("data: ")) {
             const data = line.slice(6).trim()
             if (data) {
-              appendLine(data)
+              appendLine(apiErrorMessage(data, data))
             }
           } else if (line.startsWith("event: done")) {
             installationSucceeded = true
@@ -435,7 +437,7 @@ export default function ContainersPage() {
         }
       }
 
-      const response = await fetch("/api/pull-and-run-stream", {
+      const response = await authFetch("/api/pull-and-run-stream", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify(requestBody),
@@ -443,7 +445,7 @@ export default function ContainersPage() {
 
       if (!response.ok) {
         const text = await response.text()
-        throw new Error(text || `Server returned ${response.status}`)
+        throw new Error(apiErrorMessage(text, `Server returned ${response.status}`))
       }
 
       if (!response.body) {
@@ -467,7 +469,7 @@ export default function ContainersPage() {
         for (const line of lines) {
           if (line.startsWith("data: ")) {
             const data = line.slice(6).trim()
-            if (data) appendLine(data)
+            if (data) appendLine(apiErrorMessage(data, data))
           } else if (line.startsWith("event: done")) {
             succeeded = true
           } else if (line.startsWith("event: error")) {
@@ -27,8 +27,10 @@ import {
 } from "@/components/ui/select"
 import { Badge } from "@/components/ui/badge"
 import client from "@/app/utility/post"
+import authFetch from "@/app/utility/authFetch"
 import { FUNCTION_NAME_MAX_LENGTH, isValidFunctionName } from "@/lib/function-name"
 import { useFunctionNameWarning } from "@/lib/use-function-name-warning"
+import { apiErrorMessage } from "@/lib/utils"
 import { 
   RefreshCw, 
   Search,
@@ -135,7 +137,7 @@ export default function FunctionsPage() {
     }
 
     try {
-      const response = await fetch("/api/enable-service-stream", {
+      const response = await authFetch("/api/enable-service-stream", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ service: "Functions" }),
@@ -166,7 +168,7 @@ export default function FunctionsPage() {
           if (line.startsWith("data: ")) {
             const data = line.slice(6).trim()
             if (data) {
-              appendLine(data)
+              appendLine(apiErrorMessage(data, data))
             }
           } else if (line.startsWith("event: done")) {
             installationSucceeded = true
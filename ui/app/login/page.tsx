@@ -1,6 +1,6 @@
 'use client'
 
-import { useState } from "react"
+import { useEffect, useState } from "react"
 import { useRouter } from "next/navigation"
 import { Cloud, Loader2 } from "lucide-react"
 
@@ -10,20 +10,104 @@ import { Input } from "@/components/ui/input"
 import { Label } from "@/components/ui/label"
 import client from "@/app/utility/post"
 
+// storeSession persists the tokens for subsequent requests and sets a session
+// cookie so the Next.js middleware can protect other routes.
+function storeSession(accessToken: string, refreshToken: string, username: string) {
+  localStorage.setItem("access_token", accessToken)
+  localStorage.setItem("refresh_token", refreshToken)
+  localStorage.setItem("username", username)
+
+  // The Secure flag is added on HTTPS origins to prevent transmission over HTTP.
+  const secure = window.location.protocol === "https:" ? "; Secure" : ""
+  document.cookie = `opencloud_session=${accessToken}; path=/; SameSite=Strict${secure}`
+}
+
 export default function LoginPage() {
   const router = useRouter()
   const [username, setUsername] = useState("")
   const [password, setPassword] = useState("")
+  // Set when the account has two-factor authentication and the password was accepted.
+  const [challengeToken, setChallengeToken] = useState("")
+  const [code, setCode] = useState("")
+  // Set when the password was accepted but the account must choose a new one,
+  // as the seeded admin account does on a fresh install.
+  const [mustChangePassword, setMustChangePassword] = useState(false)
+  const [newPassword, setNewPassword] = useState("")
+  const [confirmPassword, setConfirmPassword] = useState("")
   const [error, setError] = useState("")
   const [loading, setLoading] = useState(false)
+  const [ssoEnabled, setSsoEnabled] = useState(false)
+
+  useEffect(() => {
+    // Single sign-on redirects back here with the tokens in the URL fragment.
+    const params = new URLSearchParams(window.location.hash.slice(1))
+    const accessToken = params.get("access_token")
+    const refreshToken = params.get("refresh_token")
+    if (accessToken && refreshToken) {
+      storeSession(accessToken, refreshToken, params.get("username") ?? "")
+      window.history.replaceState(null, "", window.location.pathname)
+      router.push("/")
+      router.refresh()
+      return
+    }
+    // Accounts with two-factor authentication still have to enter a code.
+    const challenge = params.get("challenge_token")
+    if (challenge) {
+      setUsername(params.get("username") ?? "")
+      setChallengeToken(challenge)
+      window.history.replaceState(null, "", window.location.pathname)
+      return
+    }
+
+    client
+      .get("/user/oidc/status")
+      .then((res) => setSsoEnabled(!!res.data?.enabled))
+      .catch(() => setSsoEnabled(false))
+  }, [router])
+
+  // handleChangePassword sets the new password for an account that signed in
+  // with must_change_password; every other API call is refused until it does.
+  const handleChangePassword = async () => {
+    if (newPassword !== confirmPassword) {
+      setError("The new passwords do not match.")
+      return
+    }
+    try {
+      await client.post("/user/change-password", {
+        currentPassword: password,
+        newPassword,
+      })
+      router.push("/")
+      router.refresh()
+    } catch (err: any) {
+      setError(err.response?.data?.message || "Failed to change the password. Please try again.")
+    }
+  }
 
   const handleLogin = async (e: React.FormEvent) => {
     e.preventDefault()
     setLoading(true)
     setError("")
 
+    if (mustChangePassword) {
+      await handleChangePassword()
+      setLoading(false)
+      return
+    }
+
     try {
-      const res = await client.post("/user/login", { username, password })
+      const res = challengeToken
+        ? await client.post("/user/login/verify", {
+            challenge_token: challengeToken,
+            // Recovery codes contain a dash; authenticator codes are digits only.
+            ...(code.includes("-") ? { recovery_code: code } : { code }),
+          })
+        : await client.post("/user/login", { username, password })
+
+      if (res.data?.mfa_required) {
+        setChallengeToken(res.data.challenge_token)
+        return
+      }
 
       const accessToken: string | undefined = res.data?.access_token
       const refreshToken: string | undefined = res.data?.refresh_token
@@ -32,19 +116,22 @@ export default function LoginPage() {
         throw new Error("Unexpected response from the server. Please try again.")
       }
 
-      // Persist tokens and username for subsequent requests
-      localStorage.setItem("access_token", accessToken)
-      localStorage.setItem("refresh_token", refreshToken)
-      localStorage.setItem("username", username)
+      storeSession(accessToken, refreshToken, username)
 
-      // Set a session cookie so the Next.js middleware can protect other routes.
-      // The Secure flag is added on HTTPS origins to prevent transmission over HTTP.
-      const secure = window.location.protocol === "https:" ? "; Secure" : ""
-      document.cookie = `opencloud_session=${accessToken}; path=/; SameSite=Strict${secure}`
+      if (res.data?.must_change_password) {
+        setChallengeToken("")
+        setMustChangePassword(true)
+        return
+      }
 
       router.push("/")
       router.refresh()
     } catch (err: any) {
+      // An expired challenge means starting over from the password step.
+      if (challengeToken && err.response?.data?.message?.includes("log in again")) {
+        setChallengeToken("")
+        setCode("")
+      }
       setError(
         err.message && !err.response
           ? err.message
@@ -88,6 +175,57 @@ export default function LoginPage() {
                 </div>
               )}
 
+              {mustChangePassword ? (
+              <>
+              <p className="text-sm text-muted-foreground">
+                You must choose a new password before continuing.
+              </p>
+              <div className="space-y-2">
+                <Label htmlFor="new-password">New password</Label>
+                <Input
+                  id="new-password"
+                  type="password"
+                  placeholder="At least 8 characters"
+                  value={newPassword}
+                  onChange={(e) => setNewPassword(e.target.value)}
+                  required
+                  minLength={8}
+                  maxLength={72}
+                  autoFocus
+                  autoComplete="new-password"
+                />
+              </div>
+
+              <div className="space-y-2">
+                <Label htmlFor="confirm-password">Confirm new password</Label>
+                <Input
+                  id="confirm-password"
+                  type="password"
+                  placeholder="Enter the new password again"
+                  value={confirmPassword}
+                  onChange={(e) => setConfirmPassword(e.target.value)}
+                  required
+                  autoComplete="new-password"
+                />
+              </div>
+              </>
+              ) : challengeToken ? (
+              <div className="space-y-2">
+                <Label htmlFor="code">Authentication code</Label>
+                <Input
+                  id="code"
+                  type="text"
+                  inputMode="numeric"
+                  placeholder="6-digit code or recovery code"
+                  value={code}
+                  onChange={(e) => setCode(e.target.value.trim())}
+                  required
+                  autoFocus
+                  autoComplete="one-time-code"
+                />
+              </div>
+              ) : (
+              <>
               <div className="space-y-2">
                 <Label htmlFor="username">Username</Label>
                 <Input
@@ -113,13 +251,22 @@ export default function LoginPage() {
                   autoComplete="current-password"
                 />
               </div>
+              </>
+              )}
             </CardContent>
 
-            <CardFooter>
+            <CardFooter className="flex flex-col gap-2">
               <Button type="submit" className="w-full" disabled={loading}>
                 {loading && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
-                {loading ? "Signing in…" : "Sign in"}
+                {mustChangePassword
+                  ? loading ? "Saving…" : "Change password"
+                  : loading ? "Signing in…" : challengeToken ? "Verify" : "Sign in"}
               </Button>
+              {ssoEnabled && !challengeToken && !mustChangePassword && (
+                <Button asChild type="button" variant="outline" className="w-full">
+                  <a href="/api/user/oidc/login">Sign in with SSO</a>
+                </Button>
+              )}
             </CardFooter>
           </form>
         </Card>
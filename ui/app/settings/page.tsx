@@ -7,6 +7,8 @@ import { Label } from "@/components/ui/label"
 import { Input } from "@/components/ui/input"
 import { Button } from "@/components/ui/button"
 import { useState, useEffect } from "react"
+import { apiErrorMessage } from "@/lib/utils"
+import authFetch from "@/app/utility/authFetch"
 
 export default function SettingsPage() {
   const { theme, setTheme } = useTheme()
@@ -34,7 +36,7 @@ export default function SettingsPage() {
 
   // Load the current configured domain on mount.
   useEffect(() => {
-    fetch("/api/get-instance-domain")
+    authFetch("/api/get-instance-domain")
       .then((res) => res.json())
       .then((data) => {
         if (data.domain) {
@@ -96,15 +98,14 @@ export default function SettingsPage() {
 
     setDomainLoading(true)
     try {
-      const res = await fetch("/api/set-instance-domain", {
+      const res = await authFetch("/api/set-instance-domain", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ domain: domain.trim() }),
       })
 
       if (!res.ok) {
-        const text = await res.text()
-        setDomainError(text || "Failed to configure domain.")
+        setDomainError(apiErrorMessage(await res.text(), "Failed to configure domain."))
         return
       }
 
@@ -133,7 +134,7 @@ export default function SettingsPage() {
 
     setSSLLoading(true)
     try {
-      const res = await fetch("/api/configure-ssl", {
+      const res = await authFetch("/api/configure-ssl", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({
@@ -142,8 +143,7 @@ export default function SettingsPage() {
       })
 
       if (!res.ok) {
-        const text = await res.text()
-        setSSLError(text || "Failed to configure SSL.")
+        setSSLError(apiErrorMessage(await res.text(), "Failed to configure SSL."))
         return
       }
 
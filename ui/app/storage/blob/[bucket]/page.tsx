@@ -504,7 +504,7 @@ export default function BucketDetail({ params }: { params: Promise<{ bucket: str
                 maxLength={BUCKET_NAME_MAX_LENGTH}
               />
               <p className="text-xs text-muted-foreground">
-                Bucket names cannot contain spaces and must be 50 characters or fewer.
+                Bucket names cannot contain spaces or underscores and must be 50 characters or fewer.
               </p>
               {renameError && (
                 <p className="text-xs text-destructive">{renameError}</p>
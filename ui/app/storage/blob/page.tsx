@@ -289,7 +289,7 @@ export default function BlobStorage() {
                     maxLength={BUCKET_NAME_MAX_LENGTH}
                   />
                   <p className="text-xs text-muted-foreground">
-                    Bucket names cannot contain spaces and must be 50 characters or fewer.
+                    Bucket names cannot contain spaces or underscores and must be 50 characters or fewer.
                   </p>
                 </div>
                 <div className="flex items-center space-x-2">
@@ -18,6 +18,7 @@ import {
 import { toast } from "sonner"
 import client from "@/app/utility/post"
 import { stripRegistryPrefix } from "@/lib/image-name"
+import { apiErrorMessage } from "@/lib/utils"
 import {
   ArrowLeft,
   RefreshCw,
@@ -127,11 +128,10 @@ export default function ImageDetailPage({ params }: { params: Promise<{ id: stri
     } catch (err: unknown) {
       const axiosErr = err as { response?: { status?: number; data?: unknown } }
       if (axiosErr?.response?.status === 409) {
-        const rawData = axiosErr.response?.data
-        const message =
-          typeof rawData === "string" && rawData.trim()
-            ? rawData.trim()
-            : "This image is in use by a container. Remove the container before deleting the image."
+        const message = apiErrorMessage(
+          axiosErr.response?.data,
+          "This image is in use by a container. Remove the container before deleting the image.",
+        )
         toast.error(message)
       } else {
         toast.error("Failed to delete image. Please try again.")
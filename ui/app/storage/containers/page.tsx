@@ -28,9 +28,11 @@ import {
 } from "@/components/ui/select"
 import { toast } from "sonner"
 import client from "@/app/utility/post"
+import authFetch from "@/app/utility/authFetch"
 import { FUNCTION_NAME_MAX_LENGTH, isValidFunctionName } from "@/lib/function-name"
 import { useFunctionNameWarning } from "@/lib/use-function-name-warning"
 import { stripRegistryPrefix } from "@/lib/image-name"
+import { apiErrorMessage } from "@/lib/utils"
 import { 
   Container, 
   RefreshCw, 
@@ -163,7 +165,7 @@ export default function ContainerRegistry() {
     }
 
     try {
-      const response = await fetch("/api/enable-service-stream", {
+      const response = await authFetch("/api/enable-service-stream", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ service: "container_registry" }),
@@ -194,7 +196,7 @@ export default function ContainerRegistry() {
           if (line.startsWith("data: ")) {
             const data = line.slice(6).trim()
             if (data) {
-              appendLine(data)
+              appendLine(apiErrorMessage(data, data))
             }
           } else if (line.startsWith("event: done")) {
             installationSucceeded = true
@@ -263,10 +265,10 @@ export default function ContainerRegistry() {
     } catch (err: unknown) {
       const axiosErr = err as { response?: { status?: number; data?: unknown } }
       if (axiosErr?.response?.status === 409) {
-        const rawData = axiosErr.response.data
-        const message = typeof rawData === "string" && rawData.trim()
-          ? rawData.trim()
-          : "This image is in use by a container. Remove the container before deleting the image."
+        const message = apiErrorMessage(
+          axiosErr.response.data,
+          "This image is in use by a container. Remove the container before deleting the image.",
+        )
         toast.error(message)
       } else {
         toast.error("Failed to delete image. Please try again.")
@@ -317,7 +319,7 @@ export default function ContainerRegistry() {
     }
 
     try {
-      const response = await fetch("/api/build-image-stream", {
+      const response = await authFetch("/api/build-image-stream", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({
@@ -331,7 +333,7 @@ export default function ContainerRegistry() {
 
       if (!response.ok) {
         const text = await response.text()
-        throw new Error(text || `Server returned ${response.status}`)
+        throw new Error(apiErrorMessage(text, `Server returned ${response.status}`))
       }
 
       if (!response.body) {
@@ -354,7 +356,7 @@ export default function ContainerRegistry() {
         for (const line of lines) {
           if (line.startsWith("data: ")) {
             const data = line.slice(6).trim()
-            if (data) appendLine(data)
+            if (data) appendLine(apiErrorMessage(data, data))
           } else if (line.startsWith("event: done")) {
             succeeded = true
           } else if (line.startsWith("event: error")) {
@@ -413,7 +415,7 @@ export default function ContainerRegistry() {
     }
 
     try {
-      const response = await fetch("/api/pull-image-stream", {
+      const response = await authFetch("/api/pull-image-stream", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ imageName: trimmed, registry: pullRegistry }),
@@ -421,7 +423,7 @@ export default function ContainerRegistry() {
 
       if (!response.ok) {
         const text = await response.text()
-        throw new Error(text || `Server returned ${response.status}`)
+        throw new Error(apiErrorMessage(text, `Server returned ${response.status}`))
       }
 
       if (!response.body) {
@@ -445,7 +447,7 @@ export default function ContainerRegistry() {
         for (const line of lines) {
           if (line.startsWith("data: ")) {
             const data = line.slice(6).trim()
-            if (data) appendLine(data)
+            if (data) appendLine(apiErrorMessage(data, data))
           } else if (line.startsWith("event: done")) {
             succeeded = true
           } else if (line.startsWith("event: error")) {
@@ -0,0 +1,39 @@
+import { endSession, storeAccessToken } from "./post"
+
+// withAccessToken returns init with the AccessToken header set to token.
+function withAccessToken(init: RequestInit | undefined, token: string | null): RequestInit {
+  const headers = new Headers(init?.headers)
+  if (token) {
+    headers.set("AccessToken", token)
+  }
+  return { ...init, headers }
+}
+
+// authFetch is fetch for the API calls the axios client in post.tsx cannot
+// make, such as those whose response is read as a stream.  Like the client it
+// sends the access token and, on a 401, refreshes the token once and retries;
+// if the refresh fails the session ends.  Request bodies must be strings so
+// they can be sent again.
+export default async function authFetch(input: string, init?: RequestInit): Promise<Response> {
+  const token = typeof window !== "undefined" ? localStorage.getItem("access_token") : null
+  const response = await fetch(input, withAccessToken(init, token))
+  if (response.status !== 401 || !token) {
+    return response
+  }
+
+  let newToken: string | undefined
+  try {
+    const refreshed = await fetch("/api/user/get-auth/", { headers: { AccessToken: token } })
+    if (refreshed.ok) {
+      newToken = (await refreshed.json())?.new_access_token
+    }
+  } catch {
+    // Handled below like a refused refresh.
+  }
+  if (!newToken) {
+    endSession()
+    return response
+  }
+  storeAccessToken(newToken)
+  return fetch(input, withAccessToken(init, newToken))
+}
@@ -18,6 +18,25 @@ client.interceptors.request.use((config) => {
   return config
 })
 
+// storeAccessToken saves a renewed access token where the API clients and
+// the Next.js middleware read it.
+export function storeAccessToken(token: string) {
+  const secure = window.location.protocol === "https:" ? "; Secure" : ""
+  localStorage.setItem("access_token", token)
+  document.cookie = `opencloud_session=${token}; path=/; SameSite=Strict${secure}`
+}
+
+// endSession clears the stored credentials and sends the user to the login page.
+export function endSession() {
+  localStorage.removeItem("access_token")
+  localStorage.removeItem("refresh_token")
+  localStorage.removeItem("username")
+  const secure = window.location.protocol === "https:" ? "; Secure" : ""
+  document.cookie =
+    `opencloud_session=; path=/; expires=Thu, 01 Jan 1970 00:00:00 GMT; SameSite=Strict${secure}`
+  window.location.href = "/login"
+}
+
 // On a 401 response, attempt a silent token refresh.
 // If the refresh also fails, clear credentials and redirect to the login page.
 // The login endpoint is excluded: a 401 there means bad credentials, not an
@@ -38,20 +57,12 @@ client.interceptors.response.use(null, async (error) => {
         throw new Error("Token refresh returned no access token")
       }
 
-      const secure = window.location.protocol === "https:" ? "; Secure" : ""
-      localStorage.setItem("access_token", newToken)
-      document.cookie = `opencloud_session=${newToken}; path=/; SameSite=Strict${secure}`
+      storeAccessToken(newToken)
 
       error.config.headers["AccessToken"] = newToken
       return axios.request(error.config)
     } catch {
-      localStorage.removeItem("access_token")
-      localStorage.removeItem("refresh_token")
-      localStorage.removeItem("username")
-      const secure = window.location.protocol === "https:" ? "; Secure" : ""
-      document.cookie =
-        `opencloud_session=; path=/; expires=Thu, 01 Jan 1970 00:00:00 GMT; SameSite=Strict${secure}`
-      window.location.href = "/login"
+      endSession()
     }
   }
   return Promise.reject(error)
@@ -1,8 +1,19 @@
 /**
- * Logs the user out by clearing authentication data from localStorage and cookies,
- * then redirecting to the login page.
+ * Logs the user out by revoking the server-side session, clearing authentication
+ * data from localStorage and cookies, then redirecting to the login page.
  */
 export function logout(): void {
+  const token = localStorage.getItem("access_token")
+  if (token) {
+    // Best effort: the local logout proceeds even if the request fails.
+    // keepalive lets the request finish after the page navigates away.
+    fetch("/api/user/logout", {
+      method: "POST",
+      headers: { AccessToken: token },
+      keepalive: true,
+    }).catch(() => {})
+  }
+
   localStorage.removeItem("access_token")
   localStorage.removeItem("refresh_token")
   localStorage.removeItem("username")
@@ -3,4 +3,33 @@ import { twMerge } from "tailwind-merge"
 
 export function cn(...inputs: ClassValue[]) {
   return twMerge(clsx(inputs))
-}
\ No newline at end of file
+}
+
+// Every API error is a JSON envelope; streaming endpoints send the same
+// envelope as the data of an "error" event.
+export interface ApiError {
+  code: string
+  message: string
+  details?: unknown
+  requestId?: string
+}
+
+// Returns the message of an API error envelope.  body may be an Axios error,
+// a parsed response body or raw response/event text; anything that is not an
+// envelope yields the trimmed text, or fallback when there is none.
+export function apiErrorMessage(body: unknown, fallback: string): string {
+  if (body != null && typeof body === "object" && "response" in body) {
+    body = (body as { response?: { data?: unknown } }).response?.data
+  }
+  if (typeof body === "string") {
+    const text = body.trim()
+    try {
+      body = JSON.parse(text)
+    } catch {
+      return text || fallback
+    }
+    if (typeof (body as Partial<ApiError>)?.message !== "string") return text || fallback
+  }
+  const message = (body as Partial<ApiError> | null)?.message
+  return typeof message === "string" && message ? message : fallback
+}
@@ -8,24 +8,26 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// InitializeOpenCloudDirectories creates the necessary .opencloud directory structure
-// in the user's home directory if it doesn't already exist
+// InitializeOpenCloudDirectories creates the necessary directory structure
+// under the data directory (~/.opencloud by default) and the subsystem
+// directories configured elsewhere if it doesn't already exist
 func InitializeOpenCloudDirectories() error {
-	home, err := os.UserHomeDir()
+	dataDir, err := DataDir()
 	if err != nil {
-		return fmt.Errorf("failed to get user home directory: %w", err)
+		return err
 	}
 
 	// Define all required directories
-	directories := []string{
-		filepath.Join(home, ".opencloud"),
-		filepath.Join(home, ".opencloud", "functions"),
-		filepath.Join(home, ".opencloud", "pipelines"),
-		filepath.Join(home, ".opencloud", "blob_storage"),
-		filepath.Join(home, ".opencloud", "logs"),
-		filepath.Join(home, ".opencloud", "logs", "functions"),
-		filepath.Join(home, ".opencloud", "logs", "pipelines"),
-		filepath.Join(home, ".opencloud", "user"),
+	directories := []string{dataDir, filepath.Join(dataDir, "user")}
+	for _, s := range Subsystems {
+		dir, err := SubsystemDir(s)
+		if err != nil {
+			return err
+		}
+		directories = append(directories, dir)
+		if s == Logs {
+			directories = append(directories, filepath.Join(dir, "functions"), filepath.Join(dir, "pipelines"))
+		}
 	}
 
 	// Create all directories with appropriate permissions
@@ -37,18 +39,20 @@ func InitializeOpenCloudDirectories() error {
 
 	// Initialize the credentials file with default admin credentials if it
 	// does not already exist.
-	if err := initializeCredentials(home); err != nil {
+	if err := initializeCredentials(dataDir); err != nil {
 		return fmt.Errorf("failed to initialize credentials: %w", err)
 	}
 
 	return nil
 }
 
-// initializeCredentials creates ~/.opencloud/user/credentials with a default
+// initializeCredentials creates <dataDir>/user/credentials with a default
 // admin account when the file does not yet exist.  Each line in the file has
-// the form "username:bcrypt_hash".
-func initializeCredentials(home string) error {
-	credPath := filepath.Join(home, ".opencloud", "user", "credentials")
+// the form "username:bcrypt_hash[:flags]".  The default admin is flagged with
+// must_change_password so the well-known password has to be replaced on first
+// login.
+func initializeCredentials(dataDir string) error {
+	credPath := filepath.Join(dataDir, "user", "credentials")
 
 	// If the credentials file already exists, leave it unchanged.
 	if _, err := os.Stat(credPath); err == nil {
@@ -60,7 +64,7 @@ func initializeCredentials(home string) error {
 		return fmt.Errorf("failed to hash default password: %w", err)
 	}
 
-	content := fmt.Sprintf("admin:%s\n", hash)
+	content := fmt.Sprintf("admin:%s:must_change_password,role=admin\n", hash)
 	if err := os.WriteFile(credPath, []byte(content), 0600); err != nil {
 		return fmt.Errorf("failed to write credentials file: %w", err)
 	}
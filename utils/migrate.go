@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// DataMove is one top-level entry of an old data directory and the path
+// MigrateData moves it to.
+type DataMove struct {
+	From string
+	To   string
+}
+
+// PlanDataMigration lists the moves that bring the data kept in from, such
+// as an existing ~/.opencloud, into the current data and subsystem
+// directories.  Entries named after a subsystem go to that subsystem's
+// directory and everything else to the same name under the data directory.
+// config.json stays where it is, since that is where the server looks for
+// it by default, and so do entries that are already in place.
+//
+// legacyLedger, when not empty, is a service ledger kept outside from, as
+// earlier versions kept it in the source tree.  If it exists it moves to
+// the data directory too.
+//
+// Nothing is moved.  An error is returned if a destination already holds
+// files or lies inside the entry being moved.
+func PlanDataMigration(from, legacyLedger string) ([]DataMove, error) {
+	from, err := filepath.Abs(from)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", from, err)
+	}
+	dataDir, err := DataDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var moves []DataMove
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "config.json" {
+			continue
+		}
+		src := filepath.Join(from, name)
+		dst := filepath.Join(dataDir, name)
+		for _, s := range Subsystems {
+			if name == string(s) {
+				if dst, err = SubsystemDir(s); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if dst == src {
+			continue
+		}
+		if isWithin(dst, src) {
+			return nil, fmt.Errorf("cannot move %s into %s, which is inside it", src, dst)
+		}
+		hasFiles, err := ContainsFiles(dst)
+		if err != nil {
+			return nil, err
+		}
+		if hasFiles {
+			return nil, fmt.Errorf("%s already exists and is not empty", dst)
+		}
+		moves = append(moves, DataMove{From: src, To: dst})
+	}
+
+	if legacyLedger == "" {
+		return moves, nil
+	}
+	if _, err := os.Stat(legacyLedger); os.IsNotExist(err) {
+		return moves, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ledger, err := LedgerPath()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range moves {
+		if m.To == ledger {
+			return nil, fmt.Errorf("both %s and %s hold a service ledger", m.From, legacyLedger)
+		}
+	}
+	if _, err := os.Stat(ledger); err == nil {
+		return nil, fmt.Errorf("%s already exists", ledger)
+	}
+	// Last, so MigrateData removes from rather than the source tree.
+	return append(moves, DataMove{From: legacyLedger, To: ledger}), nil
+}
+
+// MigrateData performs moves in order, replacing destinations that hold
+// nothing but empty directories, such as those created by
+// InitializeOpenCloudDirectories.  A move across file systems copies the
+// entry and then removes the original.  The directory holding the sources
+// is removed once it is empty.
+func MigrateData(moves []DataMove) error {
+	for _, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.To), 0755); err != nil {
+			return err
+		}
+		hasFiles, err := ContainsFiles(m.To)
+		if err != nil {
+			return err
+		}
+		if hasFiles {
+			return fmt.Errorf("%s already exists and is not empty", m.To)
+		}
+		if err := os.RemoveAll(m.To); err != nil {
+			return err
+		}
+
+		err = os.Rename(m.From, m.To)
+		if errors.Is(err, syscall.EXDEV) {
+			if err = copyTree(m.From, m.To); err == nil {
+				err = os.RemoveAll(m.From)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", m.From, m.To, err)
+		}
+	}
+	if len(moves) > 0 {
+		// Fails, as intended, while config.json or anything else is left.
+		os.Remove(filepath.Dir(moves[0].From))
+	}
+	return nil
+}
+
+// isWithin reports whether path is dir or inside it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ContainsFiles reports whether path exists and is, or holds, anything
+// other than a directory.
+func ContainsFiles(path string) (bool, error) {
+	found := false
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return found, err
+}
+
+// copyTree copies the file or directory src to dst, keeping permissions
+// and symbolic links.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return fmt.Errorf("cannot copy %s: not a regular file", path)
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
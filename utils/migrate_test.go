@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useDataDirs points the data directory and blob storage at new
+// directories for the duration of the test.
+func useDataDirs(t *testing.T, dataDir, blobDir string) {
+	t.Helper()
+	SetDataDir(dataDir)
+	SetSubsystemDir(BlobStorage, blobDir)
+	t.Cleanup(func() {
+		SetDataDir("")
+		SetSubsystemDir(BlobStorage, "")
+	})
+}
+
+func TestSubsystemDir(t *testing.T) {
+	useDataDirs(t, "/srv/opencloud", "/mnt/blobs")
+
+	if dir, _ := SubsystemDir(BlobStorage); dir != "/mnt/blobs" {
+		t.Errorf("SubsystemDir(BlobStorage) = %q, want the override", dir)
+	}
+	if dir, _ := SubsystemDir(Logs); dir != filepath.Join("/srv/opencloud", "logs") {
+		t.Errorf("SubsystemDir(Logs) = %q, want it under the data directory", dir)
+	}
+}
+
+func TestMigrateData(t *testing.T) {
+	root := t.TempDir()
+	old := filepath.Join(root, "old")
+	writeTestFile(t, filepath.Join(old, "config.json"), "{}")
+	writeTestFile(t, filepath.Join(old, "functions", "hello.py"), "print('hi')")
+	writeTestFile(t, filepath.Join(old, "blob_storage", "photos", "cat.jpg"), "meow")
+	writeTestFile(t, filepath.Join(old, "user", "credentials"), "admin:hash")
+	useDataDirs(t, filepath.Join(root, "new"), filepath.Join(root, "blobs"))
+	// A server already started on the new root leaves empty directories.
+	if err := InitializeOpenCloudDirectories(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(root, "new", "user", "credentials"))
+
+	moves, err := PlanDataMigration(old, "")
+	if err != nil {
+		t.Fatalf("PlanDataMigration: %v", err)
+	}
+	if len(moves) != 3 {
+		t.Fatalf("planned %v, want functions, blob_storage and user", moves)
+	}
+	if err := MigrateData(moves); err != nil {
+		t.Fatalf("MigrateData: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(root, "new", "functions", "hello.py"): "print('hi')",
+		filepath.Join(root, "blobs", "photos", "cat.jpg"):   "meow",
+		filepath.Join(root, "new", "user", "credentials"):   "admin:hash",
+		filepath.Join(old, "config.json"):                   "{}",
+	} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(old, "functions")); !os.IsNotExist(err) {
+		t.Errorf("functions left behind in the old directory: %v", err)
+	}
+}
+
+func TestPlanDataMigrationRefusesToOverwrite(t *testing.T) {
+	root := t.TempDir()
+	old := filepath.Join(root, "old")
+	writeTestFile(t, filepath.Join(old, "pipelines", "build.sh"), "make")
+	writeTestFile(t, filepath.Join(root, "new", "pipelines", "deploy.sh"), "make deploy")
+	useDataDirs(t, filepath.Join(root, "new"), "")
+
+	if _, err := PlanDataMigration(old, ""); err == nil {
+		t.Error("expected an error for a non-empty destination")
+	}
+
+	// The new root may not be inside the old one.
+	useDataDirs(t, filepath.Join(old, "pipelines", "data"), "")
+	if _, err := PlanDataMigration(old, ""); err == nil {
+		t.Error("expected an error for a destination inside the source")
+	}
+}
+
+func TestPlanDataMigrationLegacyLedger(t *testing.T) {
+	root := t.TempDir()
+	old := filepath.Join(root, "old")
+	legacy := filepath.Join(root, "src", "service_ledger", LedgerFile)
+	writeTestFile(t, filepath.Join(old, "functions", "hello.py"), "print('hi')")
+	writeTestFile(t, legacy, "{}")
+	useDataDirs(t, filepath.Join(root, "new"), "")
+
+	moves, err := PlanDataMigration(old, legacy)
+	if err != nil {
+		t.Fatalf("PlanDataMigration: %v", err)
+	}
+	ledger := filepath.Join(root, "new", LedgerFile)
+	if len(moves) != 2 || moves[1] != (DataMove{From: legacy, To: ledger}) {
+		t.Fatalf("planned %v, want functions and then the ledger", moves)
+	}
+	if err := MigrateData(moves); err != nil {
+		t.Fatalf("MigrateData: %v", err)
+	}
+	if got, err := os.ReadFile(ledger); err != nil || string(got) != "{}" {
+		t.Errorf("%s = %q, %v", ledger, got, err)
+	}
+
+	// A missing legacy ledger is not an error.
+	if err := os.MkdirAll(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if moves, err := PlanDataMigration(old, legacy); err != nil || len(moves) != 0 {
+		t.Errorf("second plan = %v, %v; want nothing to move", moves, err)
+	}
+
+	// Two ledgers cannot both be kept.
+	writeTestFile(t, legacy, "{}")
+	if _, err := PlanDataMigration(old, legacy); err == nil {
+		t.Error("expected an error when the data directory already has a ledger")
+	}
+	os.Remove(ledger)
+	writeTestFile(t, filepath.Join(old, LedgerFile), "{}")
+	if _, err := PlanDataMigration(old, legacy); err == nil {
+		t.Error("expected an error when from has a ledger too")
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	writeTestFile(t, filepath.Join(src, "a", "b.txt"), "b")
+	if err := os.Symlink("a/b.txt", filepath.Join(src, "link")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	dst := filepath.Join(root, "dst")
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "link")); err != nil || string(got) != "b" {
+		t.Errorf("copied link reads %q, %v", got, err)
+	}
+}
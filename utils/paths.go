@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dataDirOverride replaces the default data directory when set through the
+// server configuration.
+var (
+	dataDirMutex    sync.RWMutex
+	dataDirOverride string
+)
+
+// SetDataDir makes dir the root of all OpenCloud state.  An empty dir
+// restores the default of ~/.opencloud.
+func SetDataDir(dir string) {
+	dataDirMutex.Lock()
+	defer dataDirMutex.Unlock()
+	dataDirOverride = dir
+}
+
+// DataDir returns the directory holding OpenCloud's functions, pipelines,
+// blob storage, logs and user data.  The default is resolved on every call
+// so it follows $HOME.
+func DataDir() (string, error) {
+	dataDirMutex.RLock()
+	dir := dataDirOverride
+	dataDirMutex.RUnlock()
+	if dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".opencloud"), nil
+}
+
+// LedgerFile is the name of the service ledger in the data directory.
+const LedgerFile = "serviceLedger.json"
+
+// LedgerPath returns the path of the service ledger.
+func LedgerPath() (string, error) {
+	dataDir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, LedgerFile), nil
+}
+
+// Subsystem names a part of OpenCloud whose state can live outside the data
+// directory, for example to keep blob storage on a separate disk.
+type Subsystem string
+
+const (
+	Functions   Subsystem = "functions"
+	Pipelines   Subsystem = "pipelines"
+	BlobStorage Subsystem = "blob_storage"
+	Logs        Subsystem = "logs"
+)
+
+// Subsystems lists every subsystem, in the order their directories are
+// created.
+var Subsystems = []Subsystem{Functions, Pipelines, BlobStorage, Logs}
+
+var subsystemDirOverrides = map[Subsystem]string{}
+
+// SetSubsystemDir stores subsystem s in dir instead of under the data
+// directory.  An empty dir restores the default of <data dir>/<s>.
+func SetSubsystemDir(s Subsystem, dir string) {
+	dataDirMutex.Lock()
+	defer dataDirMutex.Unlock()
+	if dir == "" {
+		delete(subsystemDirOverrides, s)
+		return
+	}
+	subsystemDirOverrides[s] = dir
+}
+
+// SubsystemDir returns the directory holding subsystem s: the directory set
+// with SetSubsystemDir, or the subdirectory of the data directory named
+// after s.
+func SubsystemDir(s Subsystem) (string, error) {
+	dataDirMutex.RLock()
+	dir := subsystemDirOverrides[s]
+	dataDirMutex.RUnlock()
+	if dir != "" {
+		return dir, nil
+	}
+
+	dataDir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, string(s)), nil
+}
+
+// DefaultProject is the project holding every resource created without
+// naming one, including everything that existed before projects did.
+const DefaultProject = "default"
+
+// projectsDir is the directory, inside each subsystem directory, that holds
+// the resources of projects other than the default one.  Its leading dot
+// keeps it out of the namespace of function, pipeline and bucket names.
+const projectsDir = ".projects"
+
+// ValidProjectName reports whether name can name a project: 1 to 40
+// lowercase letters, digits and hyphens, starting with a letter.
+func ValidProjectName(name string) bool {
+	if len(name) == 0 || len(name) > 40 || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// ProjectDir returns the directory holding the part of subsystem s that
+// belongs to project.  The default project uses the subsystem directory
+// itself, so data kept from before projects stays where it is; any other
+// project uses its own directory below it.
+func ProjectDir(project string, s Subsystem) (string, error) {
+	dir, err := SubsystemDir(s)
+	if err != nil {
+		return "", err
+	}
+	if project == "" || project == DefaultProject {
+		return dir, nil
+	}
+	if !ValidProjectName(project) {
+		return "", fmt.Errorf("invalid project name %q", project)
+	}
+	return filepath.Join(dir, projectsDir, project), nil
+}
+
+// ProjectDirs returns the directory of subsystem s for each project that has
+// one, keyed by project name and always including the default project.
+func ProjectDirs(s Subsystem) (map[string]string, error) {
+	dir, err := SubsystemDir(s)
+	if err != nil {
+		return nil, err
+	}
+	dirs := map[string]string{DefaultProject: dir}
+	entries, err := os.ReadDir(filepath.Join(dir, projectsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && ValidProjectName(entry.Name()) {
+			dirs[entry.Name()] = filepath.Join(dir, projectsDir, entry.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// IsProjectsDir reports whether name, an entry of a subsystem directory, is
+// the directory holding the other projects rather than a resource of the
+// default project.
+func IsProjectsDir(name string) bool {
+	return name == projectsDir
+}
+
+// ValidResourceName reports whether name can name a function, pipeline or
+// bucket inside a project directory.  Names holding a path separator or
+// starting with a dot are refused, since they could reach the directory of
+// another project.
+func ValidResourceName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
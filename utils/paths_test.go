@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidProjectName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"default":   true,
+		"team-a":    true,
+		"a1":        true,
+		"":          false,
+		"1team":     false,
+		"Team":      false,
+		"team_a":    false,
+		"../etc":    false,
+		".projects": false,
+		"abcdefghijklmnopqrstuvwxyzabcdefghijklmn":  true,
+		"abcdefghijklmnopqrstuvwxyzabcdefghijklmno": false,
+	} {
+		if got := ValidProjectName(name); got != want {
+			t.Errorf("ValidProjectName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestProjectDir(t *testing.T) {
+	blobs := t.TempDir()
+	SetSubsystemDir(BlobStorage, blobs)
+	t.Cleanup(func() { SetSubsystemDir(BlobStorage, "") })
+
+	for project, want := range map[string]string{
+		"":             blobs,
+		DefaultProject: blobs,
+		"team-a":       filepath.Join(blobs, ".projects", "team-a"),
+	} {
+		got, err := ProjectDir(project, BlobStorage)
+		if err != nil || got != want {
+			t.Errorf("ProjectDir(%q) = %q, %v, want %q", project, got, err, want)
+		}
+	}
+	if _, err := ProjectDir("../team-a", BlobStorage); err == nil {
+		t.Error("ProjectDir accepted an invalid project name")
+	}
+
+	if err := os.MkdirAll(filepath.Join(blobs, ".projects", "team-a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(blobs, ".projects", "Not_A_Project"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dirs, err := ProjectDirs(BlobStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		DefaultProject: blobs,
+		"team-a":       filepath.Join(blobs, ".projects", "team-a"),
+	}
+	if len(dirs) != len(want) || dirs[DefaultProject] != want[DefaultProject] || dirs["team-a"] != want["team-a"] {
+		t.Errorf("ProjectDirs = %v, want %v", dirs, want)
+	}
+}
+
+func TestValidResourceName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"hello.py":              true,
+		"my-bucket":             true,
+		"":                      false,
+		".projects":             false,
+		"..":                    false,
+		"team-a/hello.py":       false,
+		`team-a\hello.py`:       false,
+		".projects/team-a/x.py": false,
+	} {
+		if got := ValidResourceName(name); got != want {
+			t.Errorf("ValidResourceName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}